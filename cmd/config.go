@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the layered configuration",
+	Long: `Inspect the configuration merged from its layers, lowest precedence first:
+~/.comanda/config.yaml (user), .comanda/config.yaml in the current or a parent
+directory (project), the env file (COMANDA_ENV or ./.env), the config: block of
+a workflow and --set flags.`,
+}
+
+var configExplainCmd = &cobra.Command{
+	Use:   "explain [workflow.yaml]",
+	Short: "Show where each effective configuration value comes from",
+	Long: `Show the configuration layers and, for every effective value, the layer
+that set it and the layers it overrides. With a workflow file, its config:
+block is applied as well. Secrets are masked.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		effective := envConfig
+		if len(args) == 1 {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("error reading workflow file: %w", err)
+			}
+			var workflow processor.DSLConfig
+			if err := yaml.Unmarshal(data, &workflow); err != nil {
+				return fmt.Errorf("error parsing workflow file: %w", err)
+			}
+			if len(workflow.Config) > 0 {
+				if effective, err = envConfig.WithLayer(config.LayerWorkflow, args[0], workflow.Config); err != nil {
+					return err
+				}
+			}
+		}
+
+		out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(out, "Layers (lowest precedence first):")
+		for _, layer := range effective.Layers() {
+			location := layer.Path
+			if layer.Name == config.LayerCLI {
+				location = "--set"
+			}
+			status := ""
+			if !layer.Found {
+				status = "(not found)"
+			}
+			fmt.Fprintf(out, "  %s\t%s\t%s\n", layer.Name, location, status)
+		}
+		out.Flush()
+
+		fmt.Println()
+		fmt.Fprintln(out, "Effective values:")
+		for _, source := range effective.Explain() {
+			origin := source.Layer
+			if source.File != "" {
+				origin += " " + source.File
+			}
+			if len(source.Overrides) > 0 {
+				origin += ", overrides " + strings.Join(source.Overrides, ", ")
+			}
+			fmt.Fprintf(out, "  %s\t= %v\t[%s]\n", source.Path, source.Value, origin)
+		}
+		return out.Flush()
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configExplainCmd)
+	rootCmd.AddCommand(configCmd)
+}
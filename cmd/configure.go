@@ -2,23 +2,17 @@ package cmd
 
 import (
 	"bufio"
-	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/database"
 	"github.com/kris-hansen/comanda/utils/models"
-	openai "github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 )
 
@@ -26,6 +20,8 @@ var (
 	listFlag                      bool
 	encryptFlag                   bool
 	decryptFlag                   bool
+	rekeyFlag                     bool
+	fieldsFlag                    bool
 	removeFlag                    string
 	updateKeyFlag                 string
 	databaseFlag                  bool
@@ -38,250 +34,47 @@ var (
 // Green checkmark for successful operations
 const greenCheckmark = "\u2705"
 
-// Primary OpenAI models based on the latest o-series and flagship models
-var primaryOpenAIModels = []string{
-	"gpt-4o",               // Appears first in user's list
-	"gpt-4o-audio-preview", // Appears second
-	"o1",                   // Appears third
-	"o3-mini",              // Appears fourth
-	"o1-pro",               // Appears fifth
-	"o4-mini",              // Appears sixth
-	"gpt-4.1",              // Appears seventh
-	// Models from the image that might not be returned by ListModels API
-	"o3-pro",            // Responses API only model
-	"o3",                // Base model
-	"chatgpt-4o-latest", // ChatGPT variant
-	"gpt-5",
-	"gpt-5-mini",
-	"gpt-5-nano",
-}
-
-// Patterns for unsupported model types that should be excluded from selection
-var unsupportedModelPatterns = []string{
-	"dall-e",      // Image generation
-	"tts-",        // Text-to-speech
-	"whisper-",    // Speech-to-text
-	"embedding",   // Text embeddings
-	"moderation",  // Content moderation
-	"babbage-002", // Older completion models
-	"davinci-002", // Older completion models
-}
-
-type OllamaModel struct {
-	Name    string `json:"name"`
-	ModTime string `json:"modified_at"`
-	Size    int64  `json:"size"`
-}
-
-// isUnsupportedModel checks if a model should be excluded from selection
-func isUnsupportedModel(modelName string) bool {
-	modelName = strings.ToLower(modelName)
-
-	// Check against unsupported patterns
-	for _, pattern := range unsupportedModelPatterns {
-		if strings.Contains(modelName, pattern) {
-			return true
-		}
+// setProviderField stores a configuration value declared in a provider's config schema
+func setProviderField(provider *config.Provider, key, value string) error {
+	switch key {
+	case "api_key":
+		provider.APIKey = value
+	case "base_url":
+		provider.BaseURL = value
+	case "auth":
+		provider.Auth = value
+	case "endpoint":
+		provider.Endpoint = value
+	default:
+		return fmt.Errorf("unsupported provider setting '%s'", key)
 	}
-
-	return false
+	return nil
 }
 
-// isPrimaryOpenAIModel checks if a model is in the primary models list
-func isPrimaryOpenAIModel(modelName string) bool {
-	for _, primaryModel := range primaryOpenAIModels {
-		if primaryModel == modelName {
-			return true
-		}
+// splitFeaturedModels separates the featured models, in their declared order,
+// from the other available models
+func splitFeaturedModels(available []string, featured []string) ([]string, []string) {
+	availableSet := make(map[string]bool, len(available))
+	for _, model := range available {
+		availableSet[model] = true
 	}
-	return false
-}
-
-// getOpenAIModelsAndCategorize fetches and categorizes OpenAI models
-func getOpenAIModelsAndCategorize(apiKey string) ([]string, []string, error) {
-	client := openai.NewClient(apiKey)
-	modelsList, err := client.ListModels(context.Background())
 
-	// Create a map of models from API for quick lookup
-	apiModels := make(map[string]bool)
-	if err == nil {
-		for _, model := range modelsList.Models {
-			apiModels[model.ID] = true
+	var featuredModels []string
+	featuredSet := make(map[string]bool, len(featured))
+	for _, model := range featured {
+		if availableSet[model] {
+			featuredModels = append(featuredModels, model)
+			featuredSet[model] = true
 		}
-	} else {
-			log.Printf("Warning: Could not fetch models from OpenAI API: %v\nFalling back to known models.\n", err)
 	}
 
-	var primaryModels []string
 	var otherModels []string
-	processedModels := make(map[string]bool)
-
-	// Create a temporary OpenAI provider to check model support
-	provider := models.NewOpenAIProvider()
-
-	// First, process primary models in the order they're defined
-	for _, modelID := range primaryOpenAIModels {
-		// Skip unsupported models
-		if isUnsupportedModel(modelID) {
-			continue
+	for _, model := range available {
+		if !featuredSet[model] {
+			otherModels = append(otherModels, model)
 		}
-
-		// Check if the model is supported by our backend
-		if !provider.SupportsModel(modelID) {
-			continue
-		}
-
-		// Add to primary models list
-		primaryModels = append(primaryModels, modelID)
-		processedModels[modelID] = true
 	}
-
-	// Then process any other models from the API
-	if err == nil {
-		for _, model := range modelsList.Models {
-			modelID := model.ID
-
-			// Skip if already processed as primary
-			if processedModels[modelID] {
-				continue
-			}
-
-			// Skip unsupported models
-			if isUnsupportedModel(modelID) {
-				continue
-			}
-
-			// Check if the model is supported by our backend
-			if !provider.SupportsModel(modelID) {
-				continue
-			}
-
-			// Add to other models list
-			otherModels = append(otherModels, modelID)
-		}
-
-		// Sort other models alphabetically
-		sort.Strings(otherModels)
-	}
-
-	return primaryModels, otherModels, nil
-}
-
-// getOpenAIModels is kept for backward compatibility
-func getOpenAIModels(apiKey string) ([]string, error) {
-	client := openai.NewClient(apiKey)
-	modelsList, err := client.ListModels(context.Background())
-	if err != nil {
-		return nil, fmt.Errorf("error fetching OpenAI models: %v", err)
-	}
-
-	var allModels []string
-	for _, model := range modelsList.Models {
-		allModels = append(allModels, model.ID)
-	}
-
-	return allModels, nil
-}
-
-func getAnthropicModels() []string {
-	// Get models from the central registry
-	registry := models.GetRegistry()
-	return registry.GetModels("anthropic")
-}
-
-func getXAIModels() []string {
-	// Get models from the central registry
-	registry := models.GetRegistry()
-	return registry.GetModels("xai")
-}
-
-func getDeepseekModels() []string {
-	// Get models from the central registry
-	registry := models.GetRegistry()
-	return registry.GetModels("deepseek")
-}
-
-func getGoogleModels() []string {
-	// Get models from the central registry
-	registry := models.GetRegistry()
-	return registry.GetModels("google")
-}
-
-func getMoonshotModels() []string {
-	// Get models from the central registry
-	registry := models.GetRegistry()
-	return registry.GetModels("moonshot")
-}
-
-func getOllamaModels() ([]OllamaModel, error) {
-	resp, err := http.Get("http://localhost:11434/api/tags")
-	if err != nil {
-		return nil, fmt.Errorf("error connecting to Ollama API: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	var models struct {
-		Models []OllamaModel `json:"models"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
-		return nil, fmt.Errorf("error decoding Ollama response: %v", err)
-	}
-
-	return models.Models, nil
-}
-
-func checkOllamaInstalled() bool {
-	cmd := exec.Command("ollama", "list")
-	if err := cmd.Run(); err != nil {
-		return false
-	}
-	return true
-}
-
-// VLLMModel represents a model from vLLM server
-type VLLMModel struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	OwnedBy string `json:"owned_by"`
-}
-
-func getVLLMModels() ([]VLLMModel, error) {
-	endpoint := "http://localhost:8000"
-	resp, err := http.Get(endpoint + "/v1/models")
-	if err != nil {
-		return nil, fmt.Errorf("error connecting to vLLM API: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("vLLM API error (status %d): %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	var response struct {
-		Data []VLLMModel `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("error decoding vLLM response: %v", err)
-	}
-
-	return response.Data, nil
-}
-
-func checkVLLMInstalled() bool {
-	endpoint := "http://localhost:8000"
-	resp, err := http.Get(endpoint + "/v1/models")
-	if err != nil {
-		return false
-	}
-	defer resp.Body.Close()
-	return resp.StatusCode == http.StatusOK
+	return featuredModels, otherModels
 }
 
 func validatePassword(password string) error {
@@ -475,12 +268,13 @@ func promptForModelSelection(models []string) ([]string, error) {
 	}
 }
 
-// promptForOpenAIModelSelection handles the paginated selection of OpenAI models
-func promptForOpenAIModelSelection(primaryModels []string, otherModels []string) ([]string, error) {
+// promptForPagedModelSelection handles the paginated selection of a provider's
+// featured models and the rest of its catalogue
+func promptForPagedModelSelection(label string, primaryModels []string, otherModels []string) ([]string, error) {
 	reader := bufio.NewReader(os.Stdin)
 
 	// Display primary models first
-	log.Printf("\nPrimary OpenAI Models:\n")
+	log.Printf("\nPrimary %s Models:\n", label)
 	for i, model := range primaryModels {
 		log.Printf("%d. %s\n", i+1, model)
 	}
@@ -507,14 +301,14 @@ func promptForOpenAIModelSelection(primaryModels []string, otherModels []string)
 		// Handle pagination
 		if input == "m" && showingPrimary {
 			showingPrimary = false
-			log.Printf("\nOther OpenAI Models:\n")
+			log.Printf("\nOther %s Models:\n", label)
 			for i, model := range otherModels {
 				log.Printf("%d. %s\n", i+len(primaryModels)+1, model)
 			}
 			continue
 		} else if input == "p" && !showingPrimary {
 			showingPrimary = true
-			log.Printf("\nPrimary OpenAI Models:\n")
+			log.Printf("\nPrimary %s Models:\n", label)
 			for i, model := range primaryModels {
 				log.Printf("%d. %s\n", i+1, model)
 			}
@@ -604,6 +398,8 @@ var configureCmd = &cobra.Command{
 	Use:   "configure",
 	Short: "Configure model settings",
 	Long:  `Configure model settings including provider model name and API key`,
+	// Edits the env file, so it must not see values from other layers
+	Annotations: map[string]string{envFileOnlyAnnotation: "true"},
 	Run: func(cmd *cobra.Command, args []string) {
 		if listFlag {
 			listConfiguration()
@@ -705,6 +501,15 @@ var configureCmd = &cobra.Command{
 				return
 			}
 
+			if fieldsFlag {
+				if err := config.EncryptConfigFields(configPath, password); err != nil {
+					log.Printf("Error encrypting configuration fields: %v\n", err)
+					return
+				}
+				log.Printf("Configuration secret fields encrypted successfully!")
+				return
+			}
+
 			if err := config.EncryptConfig(configPath, password); err != nil {
 				log.Printf("Error encrypting configuration: %v\n", err)
 				return
@@ -721,7 +526,8 @@ var configureCmd = &cobra.Command{
 				return
 			}
 
-			if !config.IsEncrypted(data) {
+			fieldEncrypted := config.IsFieldEncrypted(data)
+			if !fieldEncrypted && !config.IsEncrypted(data) {
 				log.Printf("Configuration file is not encrypted")
 				return
 			}
@@ -732,6 +538,15 @@ var configureCmd = &cobra.Command{
 				return
 			}
 
+			if fieldEncrypted {
+				if err := config.DecryptConfigFields(configPath, password); err != nil {
+					log.Printf("Error decrypting configuration fields: %v\n", err)
+					return
+				}
+				log.Printf("Configuration secret fields decrypted successfully!")
+				return
+			}
+
 			// Decrypt the configuration
 			decrypted, err := config.DecryptConfig(data, password)
 			if err != nil {
@@ -740,7 +555,7 @@ var configureCmd = &cobra.Command{
 			}
 
 			// Write the decrypted data back to the file
-			if err := os.WriteFile(configPath, decrypted, 0644); err != nil {
+			if err := config.WriteConfigFile(configPath, decrypted); err != nil {
 				log.Printf("Error writing decrypted configuration: %v\n", err)
 				return
 			}
@@ -749,6 +564,54 @@ var configureCmd = &cobra.Command{
 			return
 		}
 
+		if rekeyFlag {
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				log.Printf("Error reading configuration file: %v\n", err)
+				return
+			}
+
+			if !config.IsEncrypted(data) && !config.IsFieldEncrypted(data) {
+				log.Printf("Configuration file is not encrypted; use --encrypt to encrypt it")
+				return
+			}
+
+			oldPassword, err := config.PromptPassword("Enter current password: ")
+			if err != nil {
+				log.Printf("Error reading password: %v\n", err)
+				return
+			}
+
+			newPassword, err := config.PromptPassword("Enter new password (minimum 6 characters, may be the current one): ")
+			if err != nil {
+				log.Printf("Error reading password: %v\n", err)
+				return
+			}
+
+			if err := validatePassword(newPassword); err != nil {
+				log.Printf("Error: %v\n", err)
+				return
+			}
+
+			confirmPassword, err := config.PromptPassword("Confirm new password: ")
+			if err != nil {
+				log.Printf("Error reading password: %v\n", err)
+				return
+			}
+
+			if newPassword != confirmPassword {
+				log.Printf("Passwords do not match")
+				return
+			}
+
+			if err := config.RekeyConfig(configPath, oldPassword, newPassword); err != nil {
+				log.Printf("Error re-encrypting configuration: %v\n", err)
+				return
+			}
+			log.Printf("Configuration re-encrypted successfully!")
+			return
+		}
+
 		// Check if file exists and is encrypted before loading
 		var wasEncrypted bool
 		var decryptionPassword string
@@ -829,180 +692,103 @@ var configureCmd = &cobra.Command{
 		} else {
 			reader := bufio.NewReader(os.Stdin)
 			// Prompt for provider
+			// Only providers of text models are configured here; local
+			// transcription and image servers need no configuration
+			var providerNames []string
+			for _, factory := range models.RegisteredProviders() {
+				if factory.HasCapability(models.CapabilityText) {
+					providerNames = append(providerNames, factory.Name)
+				}
+			}
+			var factory models.ProviderFactory
 			var provider string
 			for {
-				log.Printf("Enter provider (openai/anthropic/ollama/vllm/google/xai/deepseek/moonshot): ")
-				provider, _ = reader.ReadString('\n')
-				provider = strings.TrimSpace(provider)
-				if provider == "openai" || provider == "anthropic" || provider == "ollama" || provider == "vllm" || provider == "google" || provider == "xai" || provider == "deepseek" || provider == "moonshot" {
+				log.Printf("Enter provider (%s): ", strings.Join(providerNames, "/"))
+				providerInput, _ := reader.ReadString('\n')
+				provider = strings.TrimSpace(providerInput)
+				kind := provider
+				// Named hosts such as a second Ollama server are configured under their own name
+				if existing, ok := envConfig.Providers[provider]; ok && existing != nil {
+					kind = existing.Kind(provider)
+				}
+				var ok bool
+				if factory, ok = models.LookupProvider(kind); ok && factory.HasCapability(models.CapabilityText) {
 					break
 				}
-				log.Printf("Invalid provider. Please enter 'openai', 'anthropic', 'ollama', 'vllm', 'google', 'xai', 'deepseek', or 'moonshot'")
-			}
-
-			// Special handling for local providers
-			if provider == "ollama" {
-				if !checkOllamaInstalled() {
-					log.Printf("Error: Ollama is not installed or not running. Please install ollama and try again.")
-					return
-				}
-			}
-			if provider == "vllm" {
-				if !checkVLLMInstalled() {
-					log.Printf("Error: vLLM server is not running. Please start vLLM server and try again.")
-					return
-				}
+				log.Printf("Invalid provider. Please enter one of: %s", strings.Join(providerNames, ", "))
 			}
 
 			// Check if provider exists
 			existingProvider, err := envConfig.GetProviderConfig(provider)
+			if errors.Is(err, config.ErrSealedSecret) {
+				log.Printf("Error: %v\n", err)
+				return
+			}
 			var apiKey string
 			if err != nil {
-				if provider != "ollama" && provider != "vllm" {
-					// Only prompt for API key if not local providers
-					log.Printf("Enter API key: ")
-					apiKey, _ = reader.ReadString('\n')
-					apiKey = strings.TrimSpace(apiKey)
-				} else {
-					// For local providers (ollama, vllm), use "LOCAL" as the API key
+				if factory.Local {
+					// Local providers use "LOCAL" as the API key
 					apiKey = "LOCAL"
 				}
 				existingProvider = &config.Provider{
 					APIKey: apiKey,
 					Models: []config.Model{},
 				}
+				// Prompt for the settings the provider declares
+				for _, field := range factory.ConfigSchema {
+					log.Printf("Enter %s: ", field.Description)
+					value, _ := reader.ReadString('\n')
+					if err := setProviderField(existingProvider, field.Key, strings.TrimSpace(value)); err != nil {
+						log.Printf("Error: %v\n", err)
+						return
+					}
+				}
+				apiKey = existingProvider.APIKey
 				envConfig.AddProvider(provider, *existingProvider)
 			} else {
 				apiKey = existingProvider.APIKey
 			}
 
-			// Get available models based on provider
-			var selectedModels []string
-			switch provider {
-			case "openai":
-				if apiKey == "" {
-					log.Printf("Error: API key is required for OpenAI")
-					return
-				}
-
-				// Fetch and categorize OpenAI models
-				primaryModels, otherModels, err := getOpenAIModelsAndCategorize(apiKey)
-				if err != nil {
-					log.Printf("Error fetching OpenAI models: %v\n", err)
-					return
-				}
-
-				// Use the paginated selection for OpenAI
-				selectedModels, err = promptForOpenAIModelSelection(primaryModels, otherModels)
-				if err != nil {
-					log.Printf("Error selecting models: %v\n", err)
-					return
-				}
-
-			case "anthropic":
-				if apiKey == "" {
-					log.Printf("Error: API key is required for Anthropic")
-					return
-				}
-				models := getAnthropicModels()
-				selectedModels, err = promptForModelSelection(models)
-				if err != nil {
-					log.Printf("Error selecting models: %v\n", err)
-					return
-				}
-
-			case "xai":
-				if apiKey == "" {
-					log.Printf("Error: API key is required for X.AI")
-					return
-				}
-				models := getXAIModels()
-				selectedModels, err = promptForModelSelection(models)
-				if err != nil {
-					log.Printf("Error selecting models: %v\n", err)
-					return
-				}
-
-			case "deepseek":
-				if apiKey == "" {
-					log.Printf("Error: API key is required for Deepseek")
-					return
-				}
-				models := getDeepseekModels()
-				selectedModels, err = promptForModelSelection(models)
-				if err != nil {
-					log.Printf("Error selecting models: %v\n", err)
-					return
-				}
-
-			case "google":
-				if apiKey == "" {
-					log.Printf("Error: API key is required for Google")
-					return
-				}
-				models := getGoogleModels()
-				selectedModels, err = promptForModelSelection(models)
-				if err != nil {
-					log.Printf("Error selecting models: %v\n", err)
-					return
-				}
-
-			case "moonshot":
-				if apiKey == "" {
-					log.Printf("Error: API key is required for Moonshot")
-					return
-				}
-				models := getMoonshotModels()
-				selectedModels, err = promptForModelSelection(models)
-				if err != nil {
-					log.Printf("Error selecting models: %v\n", err)
-					return
-				}
+			if !factory.Local && apiKey == "" {
+				log.Printf("Error: API key is required for %s", factory.Label())
+				return
+			}
 
-			case "ollama":
-				models, err := getOllamaModels()
-				if err != nil {
-					log.Printf("Error fetching Ollama models: %v\n", err)
-					return
-				}
-				modelNames := make([]string, len(models))
-				for i, model := range models {
-					modelNames[i] = model.Name
-				}
-				if len(modelNames) == 0 {
-					log.Printf("No models found. Please pull a model first using 'ollama pull <model>'")
+			// Get available models from the provider, using the endpoint just configured
+			models.LoadProviderConfig(envConfig)
+			availableModels, err := models.DiscoverModels(provider, apiKey)
+			if err != nil {
+				if factory.Local {
+					log.Printf("Error: %s is not running or not reachable: %v\n", factory.Label(), err)
 					return
 				}
-				selectedModels, err = promptForModelSelection(modelNames)
-				if err != nil {
-					log.Printf("Error selecting models: %v\n", err)
+				if len(factory.FeaturedModels) == 0 {
+					log.Printf("Error fetching %s models: %v\n", factory.Label(), err)
 					return
 				}
+				log.Printf("Warning: Could not fetch models from %s: %v\nFalling back to known models.\n", factory.Label(), err)
+				availableModels = factory.FeaturedModels
+			}
+			if len(availableModels) == 0 {
+				log.Printf("No models found for %s. Make sure a model is installed or served first.", factory.Label())
+				return
+			}
 
-			case "vllm":
-				models, err := getVLLMModels()
-				if err != nil {
-					log.Printf("Error fetching vLLM models: %v\n", err)
-					return
-				}
-				modelNames := make([]string, len(models))
-				for i, model := range models {
-					modelNames[i] = model.ID
-				}
-				if len(modelNames) == 0 {
-					log.Printf("No models found. Please start vLLM server with a model first")
-					return
-				}
-				selectedModels, err = promptForModelSelection(modelNames)
-				if err != nil {
-					log.Printf("Error selecting models: %v\n", err)
-					return
-				}
+			var selectedModels []string
+			featuredModels, otherModels := splitFeaturedModels(availableModels, factory.FeaturedModels)
+			if len(featuredModels) > 0 && len(otherModels) > 0 {
+				selectedModels, err = promptForPagedModelSelection(factory.Label(), featuredModels, otherModels)
+			} else {
+				selectedModels, err = promptForModelSelection(availableModels)
+			}
+			if err != nil {
+				log.Printf("Error selecting models: %v\n", err)
+				return
 			}
 
 			// Add new models to provider
 			modelType := "external"
-			if provider == "ollama" || provider == "vllm" {
+			if factory.Local {
 				modelType = "local"
 			}
 
@@ -1066,18 +852,15 @@ var configureCmd = &cobra.Command{
 			}
 		}
 
-		// Save configuration
-		if err := config.SaveEnvConfig(configPath, envConfig); err != nil {
-			log.Printf("Error saving configuration: %v\n", err)
-			return
-		}
-
-		// Re-encrypt if it was encrypted before
+		// Save configuration, re-encrypting it if it was encrypted before
 		if wasEncrypted {
-			if err := config.EncryptConfig(configPath, decryptionPassword); err != nil {
-				log.Printf("Error re-encrypting configuration: %v\n", err)
+			if err := config.SaveEncryptedEnvConfig(configPath, envConfig, decryptionPassword); err != nil {
+				log.Printf("Error saving encrypted configuration: %v\n", err)
 				return
 			}
+		} else if err := config.SaveEnvConfig(configPath, envConfig); err != nil {
+			log.Printf("Error saving configuration: %v\n", err)
+			return
 		}
 
 		log.Printf("Configuration saved successfully to %s!\n", configPath)
@@ -1179,6 +962,8 @@ func init() {
 	configureCmd.Flags().BoolVar(&listFlag, "list", false, "List all configured providers and models")
 	configureCmd.Flags().BoolVar(&encryptFlag, "encrypt", false, "Encrypt the configuration file")
 	configureCmd.Flags().BoolVar(&decryptFlag, "decrypt", false, "Decrypt the configuration file")
+	configureCmd.Flags().BoolVar(&fieldsFlag, "fields", false, "With --encrypt, encrypt only secret fields (API keys, passwords, bearer token) and keep the rest readable")
+	configureCmd.Flags().BoolVar(&rekeyFlag, "rekey", false, "Re-encrypt the configuration file with a new password and the current encryption format")
 	configureCmd.Flags().StringVar(&removeFlag, "remove", "", "Remove a model by name")
 	configureCmd.Flags().StringVar(&updateKeyFlag, "update-key", "", "Update API key for specified provider")
 	configureCmd.Flags().BoolVar(&databaseFlag, "database", false, "Configure database settings")
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/kris-hansen/comanda/utils/models"
@@ -12,7 +13,10 @@ import (
 func TestModelConsistency(t *testing.T) {
 	t.Run("Google Models Consistency", func(t *testing.T) {
 		// Get models from configure
-		configModels := getGoogleModels()
+		configModels, err := models.DiscoverModels("google", "")
+		if err != nil {
+			t.Fatalf("Failed to discover Google models: %v", err)
+		}
 		sort.Strings(configModels)
 
 		// Get models from provider
@@ -48,3 +52,10 @@ func TestModelConsistency(t *testing.T) {
 		}
 	})
 }
+
+func TestSplitFeaturedModels(t *testing.T) {
+	featured, other := splitFeaturedModels([]string{"b", "x", "a", "y"}, []string{"a", "b", "c"})
+	if strings.Join(featured, ",") != "a,b" || strings.Join(other, ",") != "x,y" {
+		t.Errorf("splitFeaturedModels = %v, %v", featured, other)
+	}
+}
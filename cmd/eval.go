@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Eval command flags
+var (
+	evalModelFlags   []string
+	evalReportFlags  []string
+	evalBaselineFlag string
+	evalLimitFlag    int
+)
+
+var evalCmd = &cobra.Command{
+	Use:   "eval <file.eval.yaml>",
+	Short: "Score a workflow over a dataset, comparing models",
+	Long: `Run a workflow over each row of a dataset (CSV with a header row, or JSONL)
+and score every output with the scorers of the eval file: exact match, regular
+expression, a JSON field, embedding similarity to the expected output, or a
+judge model grading against a rubric. With several models, the workflow runs
+once per model, replacing the models of its steps, and the mean scores are
+compared side by side.
+
+Reports are written as JSON or HTML, by the extension of --report. A JSON
+report from an earlier run passed as --baseline shows how each model's scores
+changed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := processor.LoadEvalFile(args[0])
+		if err != nil {
+			return err
+		}
+		var baseline *processor.EvalReport
+		if evalBaselineFlag != "" {
+			if baseline, err = processor.LoadEvalReport(evalBaselineFlag); err != nil {
+				return err
+			}
+		}
+
+		opts := processor.EvalOptions{
+			Models:  evalModelFlags,
+			Limit:   evalLimitFlag,
+			Verbose: verbose,
+			OnCase: func(run *processor.EvalRun, c *processor.EvalCase) {
+				var scores []string
+				for _, scorer := range file.Scorers {
+					if score, ok := c.Scores[scorer.Name]; ok {
+						scores = append(scores, fmt.Sprintf("%s=%.2f", scorer.Name, score))
+					}
+				}
+				status := strings.Join(scores, " ")
+				if c.Error != "" {
+					status = "error: " + c.Error
+				}
+				fmt.Printf("%s: row %d: %s (%.2fs)\n", run.Model, c.Row, status, c.Duration.Seconds())
+			},
+		}
+		report, err := file.Run(envConfig, opts)
+		if err != nil {
+			return err
+		}
+		if baseline != nil {
+			report.SetBaseline(evalBaselineFlag, baseline)
+		}
+
+		fmt.Println()
+		report.WriteSummary(os.Stdout)
+		for _, path := range evalReportFlags {
+			if err := report.WriteReport(path); err != nil {
+				return fmt.Errorf("error writing report %s: %w", path, err)
+			}
+			fmt.Printf("Report written to %s\n", path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	evalCmd.Flags().StringArrayVar(&evalModelFlags, "model", nil, "Model to evaluate, replacing the models of the eval file (repeatable)")
+	evalCmd.Flags().StringArrayVar(&evalReportFlags, "report", nil, "Write the report to this .json or .html file (repeatable)")
+	evalCmd.Flags().StringVar(&evalBaselineFlag, "baseline", "", "JSON report of an earlier run to compare the scores with")
+	evalCmd.Flags().IntVar(&evalLimitFlag, "limit", 0, "Evaluate only the first N rows of the dataset")
+	rootCmd.AddCommand(evalCmd)
+}
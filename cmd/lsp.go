@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/lsp"
+)
+
+var lspCmd = &cobra.Command{
+	Use:   "lsp",
+	Short: "Run a language server for workflow files",
+	Long: `Run a Language Server Protocol server on stdin and stdout for editing
+workflow files. It reports the problems found by 'comanda validate' as you
+type, shows the documentation of keys on hover and completes model names
+from the configured providers and aliases.
+
+Configure your editor to start 'comanda lsp' for YAML workflow files.`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{envOptionalAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Without any configuration file there are no models to check or complete
+		lspConfig := envConfig
+		if lspConfig != nil && !hasConfigFile(lspConfig) {
+			lspConfig = nil
+		}
+		return lsp.NewServer(os.Stdin, os.Stdout, lspConfig).Run()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lspCmd)
+}
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/memory"
+)
+
+// Memory command flags
+var (
+	memoryFileFlag      string
+	memoryNamespaceFlag string
+	memoryVersionFlag   int
+	memoryHistoryFlag   bool
+	memorySectionFlag   string
+	memoryKeepFlag      int
+)
+
+var memoryCmd = &cobra.Command{
+	Use:   "memory",
+	Short: "Inspect and manage the memory file",
+	Long: `Inspect and manage the COMANDA.md memory file. Every change made by a
+workflow is recorded as a version that can be shown, diffed or reverted.`,
+}
+
+var memoryShowCmd = &cobra.Command{
+	Use:   "show [section]",
+	Short: "Show the memory, a section, or their history",
+	Long: `Show the current memory document, or only a "## section" of it.
+Use --version to show an earlier version and --history to list versions.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openMemoryStore()
+		if err != nil {
+			return err
+		}
+		section := ""
+		if len(args) == 1 {
+			section = args[0]
+		}
+
+		if memoryHistoryFlag {
+			versions, err := store.History()
+			if err != nil {
+				return err
+			}
+			if section != "" {
+				versions = memory.SectionHistory(versions, section)
+			}
+			printMemoryHistory(store, versions)
+			return nil
+		}
+
+		content, _, err := memoryContent(store, memoryVersionFlag)
+		if err != nil {
+			return err
+		}
+		if section != "" {
+			content = memory.Section(content, section)
+			if content == "" {
+				return fmt.Errorf("section '%s' not found in %s", section, store.Location())
+			}
+			content += "\n"
+		}
+		fmt.Print(content)
+		return nil
+	},
+}
+
+var memoryDiffCmd = &cobra.Command{
+	Use:   "diff [from-version] [to-version]",
+	Short: "Show changes between memory versions",
+	Long: `Show a unified diff between two memory versions. Without arguments, the
+latest change is shown. With one version, it is compared to the current memory.`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openMemoryStore()
+		if err != nil {
+			return err
+		}
+		versions, err := store.History()
+		if err != nil {
+			return err
+		}
+		current, err := store.Read()
+		if err != nil {
+			return err
+		}
+
+		fromID, toID, err := resolveDiffVersions(args, versions, current)
+		if err != nil {
+			return err
+		}
+		fromName, from, err := diffSide(store, fromID)
+		if err != nil {
+			return err
+		}
+		toName, to, err := diffSide(store, toID)
+		if err != nil {
+			return err
+		}
+
+		if memorySectionFlag != "" {
+			from = memory.Section(from, memorySectionFlag)
+			to = memory.Section(to, memorySectionFlag)
+			fromName += " ## " + memorySectionFlag
+			toName += " ## " + memorySectionFlag
+		}
+
+		diff := memory.Diff(fromName, toName, from, to)
+		if diff == "" {
+			fmt.Println("No differences")
+			return nil
+		}
+		fmt.Print(diff)
+		return nil
+	},
+}
+
+var memoryRevertCmd = &cobra.Command{
+	Use:   "revert <version>",
+	Short: "Restore an earlier memory version",
+	Long:  `Restore the memory to an earlier version. The revert is itself recorded as a new version.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid version '%s': must be a number", args[0])
+		}
+		store, err := openMemoryStore()
+		if err != nil {
+			return err
+		}
+		if err := store.Revert(id); err != nil {
+			return err
+		}
+		fmt.Printf("%s Memory at %s reverted to version %d\n", greenCheckmark, store.Location(), id)
+		return nil
+	},
+}
+
+var memoryPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove old memory versions",
+	Long:  `Remove old versions from the memory history, keeping the newest ones. The current memory is not changed.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openMemoryStore()
+		if err != nil {
+			return err
+		}
+		removed, err := store.Prune(memoryKeepFlag)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s Removed %d old version(s) from %s\n", greenCheckmark, removed, store.Location())
+		return nil
+	},
+}
+
+// openMemoryStore opens the memory store selected by the flags and configuration
+func openMemoryStore() (memory.Store, error) {
+	path := memoryFileFlag
+	if path == "" {
+		path = config.GetMemoryPath(envConfig)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no memory file found; run 'comanda configure --init-memory' or set memory_file")
+	}
+
+	namespace := memoryNamespaceFlag
+	if namespace == "" {
+		namespace = config.GetMemoryNamespace(envConfig)
+	}
+	return memory.Open(path, namespace)
+}
+
+// memoryContent returns the content of a version, or the current memory for version 0
+func memoryContent(store memory.Store, id int) (string, string, error) {
+	if id == 0 {
+		content, err := store.Read()
+		return content, "current", err
+	}
+	versions, err := store.History()
+	if err != nil {
+		return "", "", err
+	}
+	version, err := memory.FindVersion(versions, id)
+	if err != nil {
+		return "", "", err
+	}
+	return version.Content, fmt.Sprintf("version %d", id), nil
+}
+
+// diffSide returns the label and content for one side of a diff; -1 is the empty document
+func diffSide(store memory.Store, id int) (string, string, error) {
+	if id < 0 {
+		return "empty", "", nil
+	}
+	content, name, err := memoryContent(store, id)
+	return name, content, err
+}
+
+// resolveDiffVersions turns the diff arguments into version IDs, where 0 is the
+// current memory and -1 the empty document. Without arguments it picks the
+// latest change: the newest version against the current memory if they differ,
+// otherwise the version before the newest against the newest.
+func resolveDiffVersions(args []string, versions []memory.Version, current string) (int, int, error) {
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id < 0 {
+			return 0, 0, fmt.Errorf("invalid version '%s': must be a version number or 0 for the current memory", arg)
+		}
+		ids[i] = id
+	}
+
+	switch len(ids) {
+	case 2:
+		return ids[0], ids[1], nil
+	case 1:
+		return ids[0], 0, nil
+	}
+
+	if len(versions) == 0 {
+		return 0, 0, fmt.Errorf("no memory history recorded yet")
+	}
+	latest := versions[len(versions)-1]
+	if latest.Content != current {
+		return latest.ID, 0, nil
+	}
+	if len(versions) == 1 {
+		return -1, latest.ID, nil
+	}
+	return versions[len(versions)-2].ID, latest.ID, nil
+}
+
+// printMemoryHistory lists versions with their time, size and message
+func printMemoryHistory(store memory.Store, versions []memory.Version) {
+	fmt.Printf("History of %s:\n", store.Location())
+	if len(versions) == 0 {
+		fmt.Println("  (no versions recorded)")
+		return
+	}
+	for _, version := range versions {
+		fmt.Printf("  %4d  %s  %7d bytes  %s\n", version.ID, version.Time.Local().Format("2006-01-02 15:04:05"),
+			len(version.Content), strings.TrimSpace(version.Message))
+	}
+}
+
+func init() {
+	memoryCmd.PersistentFlags().StringVar(&memoryFileFlag, "file", "", "Memory file to use (default: the discovered COMANDA.md)")
+	memoryCmd.PersistentFlags().StringVar(&memoryNamespaceFlag, "namespace", "", "Memory namespace (default: COMANDA_MEMORY_NAMESPACE or memory_namespace)")
+
+	memoryShowCmd.Flags().IntVar(&memoryVersionFlag, "version", 0, "Show an earlier version instead of the current memory")
+	memoryShowCmd.Flags().BoolVar(&memoryHistoryFlag, "history", false, "List recorded versions")
+	memoryDiffCmd.Flags().StringVar(&memorySectionFlag, "section", "", "Only compare one \"## section\"")
+	memoryPruneCmd.Flags().IntVar(&memoryKeepFlag, "keep", memory.DefaultHistoryKeep, "Number of newest versions to keep")
+
+	memoryCmd.AddCommand(memoryShowCmd)
+	memoryCmd.AddCommand(memoryDiffCmd)
+	memoryCmd.AddCommand(memoryRevertCmd)
+	memoryCmd.AddCommand(memoryPruneCmd)
+	rootCmd.AddCommand(memoryCmd)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/memory"
+)
+
+func TestResolveDiffVersions(t *testing.T) {
+	versions := []memory.Version{
+		{ID: 1, Content: "one"},
+		{ID: 2, Content: "two"},
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		versions []memory.Version
+		current  string
+		wantFrom int
+		wantTo   int
+		wantErr  bool
+	}{
+		{"latest change", nil, versions, "two", 1, 2, false},
+		{"edited since latest version", nil, versions, "three", 2, 0, false},
+		{"single version", nil, versions[:1], "one", -1, 1, false},
+		{"one version against current", []string{"1"}, versions, "two", 1, 0, false},
+		{"two versions", []string{"2", "1"}, versions, "two", 2, 1, false},
+		{"no history", nil, nil, "", 0, 0, true},
+		{"invalid version", []string{"latest"}, versions, "two", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := resolveDiffVersions(tt.args, tt.versions, tt.current)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if from != tt.wantFrom || to != tt.wantTo {
+				t.Errorf("Got %d..%d, want %d..%d", from, to, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
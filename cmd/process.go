@@ -17,6 +17,18 @@ import (
 // Runtime directory flag
 var runtimeDir string
 
+// Memory namespace flag
+var memoryNamespace string
+
+// Project flag selecting project-scoped API keys
+var project string
+
+// Workflow params as key=value
+var paramFlags []string
+
+// Dry-run flag printing the execution plan instead of running the workflow
+var dryRun bool
+
 var processCmd = &cobra.Command{
 	Use:   "process [files...]",
 	Short: "Process YAML workflow files",
@@ -50,6 +62,11 @@ var processCmd = &cobra.Command{
 			stdinData = builder.String()
 		}
 
+		params, err := processor.ParseParams(paramFlags)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
 		for _, file := range args {
 			log.Printf("\nProcessing workflow file: %s\n", file)
 
@@ -80,12 +97,39 @@ var processCmd = &cobra.Command{
 				Enabled: false, // Disable server mode for CLI processing
 			}
 			proc := processor.NewProcessor(&dslConfig, envConfig, serverConfig, verbose, runtimeDir)
+			if project != "" {
+				proc.SetProject(project)
+			}
+			if memoryNamespace != "" {
+				if err := proc.SetMemoryNamespace(memoryNamespace); err != nil {
+					log.Printf("Error selecting memory namespace for %s: %v\n", file, err)
+					continue
+				}
+			}
+
+			if len(params) > 0 {
+				if err := proc.SetParams(params); err != nil {
+					log.Printf("Error in params for %s: %v\n", file, err)
+					continue
+				}
+			}
 
 			// If we have STDIN data, set it as initial output
 			if stdinData != "" {
 				proc.SetLastOutput(stdinData)
 			}
 
+			// Show what would run, and what it would cost, without calling any model
+			if dryRun {
+				plan, err := proc.Plan()
+				if err != nil {
+					log.Printf("Error planning workflow file %s: %v\n", file, err)
+					continue
+				}
+				plan.Write(os.Stdout)
+				continue
+			}
+
 			// Print configuration summary before processing
 			log.Printf("\nConfiguration:\n")
 
@@ -110,10 +154,10 @@ var processCmd = &cobra.Command{
 					log.Printf("  - Output: %v\n", proc.NormalizeStringSlice(step.Config.Output))
 
 					// Display memory information if enabled
-					if step.Config.Memory {
+					if step.Config.Memory.Enabled {
 						memoryPath := proc.GetMemoryFilePath()
 						if memoryPath != "" {
-							log.Printf("  - Memory: [Using %s]\n", memoryPath)
+							log.Printf("  - Memory: [Using %s, mode: %s]\n", memoryPath, step.Config.Memory.Mode)
 						} else {
 							log.Printf("  - Memory: [ENABLED but no memory file configured]\n")
 						}
@@ -145,10 +189,10 @@ var processCmd = &cobra.Command{
 				log.Printf("- Output: %v\n", proc.NormalizeStringSlice(step.Config.Output))
 
 				// Display memory information if enabled
-				if step.Config.Memory {
+				if step.Config.Memory.Enabled {
 					memoryPath := proc.GetMemoryFilePath()
 					if memoryPath != "" {
-						log.Printf("- Memory: [Using %s]\n", memoryPath)
+						log.Printf("- Memory: [Using %s, mode: %s]\n", memoryPath, step.Config.Memory.Mode)
 					} else {
 						log.Printf("- Memory: [ENABLED but no memory file configured]\n")
 					}
@@ -175,4 +219,8 @@ func init() {
 
 	// Add runtime directory flag
 	processCmd.Flags().StringVar(&runtimeDir, "runtime-dir", "", "Runtime directory for file operations (relative to data directory)")
+	processCmd.Flags().StringVar(&project, "project", "", "Project whose API keys are used (overrides COMANDA_PROJECT and project)")
+	processCmd.Flags().StringArrayVar(&paramFlags, "param", nil, "Workflow param as key=value, checked against the workflow: block (repeatable)")
+	processCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the execution plan with the prompts and estimated tokens and cost, without calling any model")
+	processCmd.Flags().StringVar(&memoryNamespace, "memory-namespace", "", "Memory namespace to read and write (overrides COMANDA_MEMORY_NAMESPACE and memory_namespace)")
 }
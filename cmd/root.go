@@ -9,7 +9,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/kris-hansen/comanda/utils/cassette"
 	"github.com/kris-hansen/comanda/utils/config"    // Required for input.Input
+	"github.com/kris-hansen/comanda/utils/keypool"   // Required for keypool.Key
 	"github.com/kris-hansen/comanda/utils/models"    // Required for models.DetectProvider
 	"github.com/kris-hansen/comanda/utils/processor" // Required for EmbeddedLLMGuide
 	"github.com/spf13/cobra"
@@ -21,6 +23,17 @@ var version string
 var verbose bool
 var debug bool
 var generateModelName string // Flag for specifying model in generateCmd
+var configOverrides []string // --set path=value overrides, the highest configuration layer
+var recordDir string         // --record directory for provider HTTP cassettes
+var replayDir string         // --replay directory of recorded provider HTTP cassettes
+
+// envFileOnlyAnnotation marks commands that edit the env file and therefore
+// load it alone rather than the layered configuration
+const envFileOnlyAnnotation = "comanda/env-file-only"
+
+// envOptionalAnnotation marks commands that also work without an environment
+// configuration, with envConfig left nil when it cannot be loaded
+const envOptionalAnnotation = "comanda/env-optional"
 
 // envConfig holds the loaded environment configuration, available to all commands
 var envConfig *config.EnvConfig
@@ -65,6 +78,22 @@ for model interactions and executes the specified actions.`,
 		config.Verbose = verbose
 		config.Debug = debug
 
+		// Route provider HTTP traffic through a cassette before any client is built
+		if recordDir != "" && replayDir != "" {
+			return fmt.Errorf("--record and --replay cannot be used together")
+		}
+		if recordDir != "" {
+			if err := cassette.Install(cassette.ModeRecord, recordDir); err != nil {
+				return err
+			}
+			config.VerboseLog("Recording provider HTTP exchanges to %s", recordDir)
+		} else if replayDir != "" {
+			if err := cassette.Install(cassette.ModeReplay, replayDir); err != nil {
+				return err
+			}
+			config.VerboseLog("Replaying provider HTTP exchanges from %s", replayDir)
+		}
+
 		// Get environment file path from COMANDA_ENV or default
 		envPath := config.GetEnvPath()
 		if verbose {
@@ -73,10 +102,24 @@ for model interactions and executes the specified actions.`,
 
 		// Load environment configuration
 		var err error
-		envConfig, err = config.LoadEnvConfigWithPassword(envPath)
+		if cmd.Annotations[envFileOnlyAnnotation] == "true" {
+			envConfig, err = config.LoadEnvConfigWithPassword(envPath)
+		} else {
+			var overrides map[string]interface{}
+			if overrides, err = config.ParseOverrides(configOverrides); err != nil {
+				return err
+			}
+			envConfig, err = config.LoadLayeredEnvConfig(envPath, overrides)
+		}
 		if err != nil {
+			if cmd.Annotations[envOptionalAnnotation] == "true" {
+				config.VerboseLog("Continuing without environment configuration: %v", err)
+				envConfig = nil
+				return nil
+			}
 			return fmt.Errorf("error loading environment configuration: %w", err)
 		}
+		models.LoadProviderConfig(envConfig)
 
 		if verbose {
 			log.Println("[DEBUG] Environment configuration loaded successfully")
@@ -140,6 +183,9 @@ CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be
 		// This logic might need to be more robust, potentially calling a configure method on the provider.
 		provider := models.DetectProvider(modelForGeneration)
 		if provider == nil {
+			if _, err := models.ResolveModel(modelForGeneration); err != nil {
+				return fmt.Errorf("could not detect provider for model: %w", err)
+			}
 			return fmt.Errorf("could not detect provider for model: %s", modelForGeneration)
 		}
 
@@ -149,7 +195,11 @@ CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be
 			// If provider is not in envConfig, it might be a public one like Ollama, or an error
 			log.Printf("Warning: Provider %s not found in env configuration. Assuming it does not require an API key or is pre-configured.\n", provider.Name())
 		} else {
-			if err := provider.Configure(providerConfig.APIKey); err != nil {
+			apiKey, err := keypool.Key(provider.Name(), providerConfig, config.GetProject(envConfig))
+			if err != nil {
+				return err
+			}
+			if err := provider.Configure(apiKey); err != nil {
 				return fmt.Errorf("failed to configure provider %s: %w", provider.Name(), err)
 			}
 		}
@@ -157,7 +207,7 @@ CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be
 
 		// Call the LLM
 		// The SendPrompt method is part of the models.Provider interface.
-		generatedResponse, err := provider.SendPrompt(modelForGeneration, fullPrompt)
+		generatedResponse, err := provider.SendPrompt(models.BareModelName(modelForGeneration), fullPrompt)
 		if err != nil {
 			return fmt.Errorf("LLM execution failed for model '%s': %w", modelForGeneration, err)
 		}
@@ -208,6 +258,9 @@ CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "enable debug logging")
+	rootCmd.PersistentFlags().StringVar(&recordDir, "record", "", "Record provider HTTP exchanges as cassette files in this directory")
+	rootCmd.PersistentFlags().StringVar(&replayDir, "replay", "", "Replay provider HTTP exchanges from the cassette files in this directory")
+	rootCmd.PersistentFlags().StringArrayVar(&configOverrides, "set", nil, "Override a configuration value, e.g. --set default_generation_model=gpt-4o (repeatable)")
 	generateCmd.Flags().StringVarP(&generateModelName, "model", "m", "", "Model to use for workflow generation (optional, uses default if not set)")
 	rootCmd.AddCommand(generateCmd)
 	rootCmd.AddCommand(versionCmd) // Add the version command
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Schema command flags
+var schemaOutputFlag string
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of workflow files",
+	Long: `Print a JSON Schema (draft-07) of the workflow DSL, derived from the step
+configuration types of this version of comanda. Point your editor's YAML
+support at it for completion and validation, e.g. with
+"# yaml-language-server: $schema=comanda-workflow.schema.json" at the top of a
+workflow file.`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{envOptionalAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := os.Stdout
+		if schemaOutputFlag != "" {
+			file, err := os.Create(schemaOutputFlag)
+			if err != nil {
+				return fmt.Errorf("error creating schema file: %w", err)
+			}
+			defer file.Close()
+			out = file
+		}
+
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(processor.WorkflowSchema()); err != nil {
+			return fmt.Errorf("error writing schema: %w", err)
+		}
+		if schemaOutputFlag != "" {
+			fmt.Printf("Schema written to %s\n", schemaOutputFlag)
+		}
+		return nil
+	},
+}
+
+func init() {
+	schemaCmd.Flags().StringVarP(&schemaOutputFlag, "output", "o", "", "Write the schema to a file instead of stdout")
+	rootCmd.AddCommand(schemaCmd)
+}
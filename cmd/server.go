@@ -18,6 +18,9 @@ var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Start and manage the HTTP server",
 	Long:  `Start the HTTP server for processing YAML files, or manage server configuration`,
+	// The server serves and edits the env file, so it runs without the user,
+	// project and --set layers
+	Annotations: map[string]string{envFileOnlyAnnotation: "true"},
 	Run: func(cmd *cobra.Command, args []string) {
 		// Default behavior (no subcommand) is to start the server
 		configPath := config.GetEnvPath()
@@ -27,6 +30,16 @@ var serverCmd = &cobra.Command{
 			return
 		}
 
+		// Ask for the password of encrypted secrets now rather than on the first request
+		if err := envConfig.UnlockSecrets(); err != nil {
+			log.Printf("Error loading configuration: %v\n", err)
+			return
+		}
+		if err := envConfig.Unseal("server"); err != nil {
+			log.Printf("Error loading configuration: %v\n", err)
+			return
+		}
+
 		if err := server.Run(envConfig); err != nil {
 			log.Printf("Server failed to start: %v\n", err)
 			return
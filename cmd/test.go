@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Test command flags
+var (
+	testUpdateFlag bool
+	testRunFlag    string
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test [files or directories...]",
+	Short: "Run workflow tests with scripted model responses",
+	Long: `Run workflow test files (*.test.yaml). Each test runs the workflow in an
+empty temporary directory with fixture inputs, answers its model requests from
+scripted responses instead of calling any provider, and checks STDOUT, the files
+written, variables, memory sections and the requests each step sent.
+
+Directories are searched recursively for test files; the default is the current
+directory. Assertions with a golden file compare against its content, and
+--update rewrites the golden files with the actual output. The exit status is 1
+when any test fails.`,
+	Annotations: map[string]string{envOptionalAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := processor.TestOptions{Update: testUpdateFlag, Verbose: verbose}
+		if testRunFlag != "" {
+			re, err := regexp.Compile(testRunFlag)
+			if err != nil {
+				return fmt.Errorf("invalid --run pattern: %w", err)
+			}
+			opts.Run = re
+		}
+
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+		files, err := processor.FindWorkflowTests(args)
+		if err != nil {
+			return fmt.Errorf("error finding test files: %w", err)
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no test files (*.test.yaml) found")
+		}
+
+		passed, failed := 0, 0
+		for _, file := range files {
+			testFile, err := processor.LoadWorkflowTests(file)
+			if err != nil {
+				fmt.Printf("--- FAIL: %s\n    %v\n", file, err)
+				failed++
+				continue
+			}
+			for _, result := range testFile.Run(opts) {
+				status := "PASS"
+				if !result.Passed() {
+					status = "FAIL"
+					failed++
+				} else {
+					passed++
+				}
+				fmt.Printf("--- %s: %s: %s (%.2fs)\n", status, file, result.Name, result.Duration.Seconds())
+				for _, failure := range result.Failures {
+					fmt.Printf("    %s\n", strings.ReplaceAll(strings.TrimRight(failure, "\n"), "\n", "\n    "))
+				}
+				for _, golden := range result.Updated {
+					fmt.Printf("    updated %s\n", golden)
+				}
+			}
+		}
+
+		fmt.Printf("%d passed, %d failed\n", passed, failed)
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+func init() {
+	testCmd.Flags().BoolVar(&testUpdateFlag, "update", false, "Rewrite golden files with the actual output")
+	testCmd.Flags().StringVar(&testRunFlag, "run", "", "Run only the tests whose name matches this regular expression")
+	rootCmd.AddCommand(testCmd)
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+)
+
+// Validate command flags
+var validateFormatFlag string
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [files...]",
+	Short: "Check workflow files without running them",
+	Long: `Check workflow files for problems without running them or contacting any
+provider: YAML errors, unknown keys, invalid steps, deferred steps that no step
+can call, undefined variables, steps writing the same file and models that are
+not enabled in the configuration. Model checks are skipped when no
+configuration file is found.
+
+Problems are printed as file:line:column: severity: message [rule], or as a
+JSON array with --format json for editor integration. The exit status is 1 when
+any error is found; warnings alone do not fail.`,
+	Args:        cobra.MinimumNArgs(1),
+	Annotations: map[string]string{envOptionalAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if validateFormatFlag != "text" && validateFormatFlag != "json" {
+			return fmt.Errorf("unknown format '%s' (must be text or json)", validateFormatFlag)
+		}
+
+		// Without any configuration file there are no enabled models to check against
+		lintConfig := envConfig
+		if lintConfig != nil && !hasConfigFile(lintConfig) {
+			lintConfig = nil
+		}
+
+		diagnostics := []processor.Diagnostic{}
+		for _, file := range args {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("error reading workflow file: %w", err)
+			}
+			diagnostics = append(diagnostics, processor.Lint(file, data, lintConfig)...)
+		}
+
+		errorCount, warningCount := 0, 0
+		for _, d := range diagnostics {
+			if d.Severity == processor.SeverityError {
+				errorCount++
+			} else {
+				warningCount++
+			}
+		}
+
+		if validateFormatFlag == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(diagnostics); err != nil {
+				return err
+			}
+		} else {
+			for _, d := range diagnostics {
+				fmt.Println(d)
+			}
+			if lintConfig == nil {
+				fmt.Fprintln(os.Stderr, "Note: no configuration found; models were not checked")
+			}
+			fmt.Printf("%d error(s), %d warning(s) in %d file(s)\n", errorCount, warningCount, len(args))
+		}
+
+		if errorCount > 0 {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+// hasConfigFile reports whether any configuration layer was read from a file
+func hasConfigFile(cfg *config.EnvConfig) bool {
+	for _, layer := range cfg.Layers() {
+		if layer.Found && layer.Name != config.LayerCLI {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	validateCmd.Flags().StringVar(&validateFormatFlag, "format", "text", "Output format: text or json")
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,414 @@
+// Package cassette records the HTTP exchanges of a run into a directory of
+// cassette files and replays them without network access. Installed, it routes
+// every request of the process that uses http.DefaultTransport (provider APIs,
+// local model servers, scraping) through the cassette. Credentials are redacted
+// before anything is written.
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Cassette modes
+const (
+	ModeRecord = "record" // Send requests and write each exchange to the cassette
+	ModeReplay = "replay" // Answer requests from the cassette without network access
+)
+
+// ReplayKey is the API key of providers without one while replaying, since
+// replayed requests are not authenticated
+const ReplayKey = "replay"
+
+// Redacted replaces credentials in recorded exchanges
+const Redacted = "REDACTED"
+
+// Interaction is one recorded HTTP exchange
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is the recorded part of an HTTP request
+type Request struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"` // "base64" for binary bodies
+}
+
+// Response is the recorded part of an HTTP response
+type Response struct {
+	Status       int         `json:"status"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"` // "base64" for binary bodies
+}
+
+// Cassette is a directory of recorded exchanges, one JSON file per exchange
+type Cassette struct {
+	mode string
+	dir  string
+
+	mu       sync.Mutex
+	next     int                       // Number of the next recorded file
+	recorded map[string][]*Interaction // Exchanges to replay, by request key
+	replayed map[string]int            // Number of exchanges replayed, by request key
+}
+
+// Open opens a cassette directory for recording, creating it if needed, or
+// loads its exchanges for replaying. Recording adds to the exchanges already
+// in the directory; record into an empty directory to replace a cassette.
+func Open(mode, dir string) (*Cassette, error) {
+	c := &Cassette{mode: mode, dir: dir, recorded: make(map[string][]*Interaction), replayed: make(map[string]int)}
+	switch mode {
+	case ModeRecord:
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+		}
+		files, err := c.files()
+		if err != nil {
+			return nil, err
+		}
+		c.next = len(files) + 1
+	case ModeReplay:
+		files, err := c.files()
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("cassette %s has no recorded exchanges", dir)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			var interaction Interaction
+			if err := json.Unmarshal(data, &interaction); err != nil {
+				return nil, fmt.Errorf("invalid cassette file %s: %w", file, err)
+			}
+			body, err := decodeBody(interaction.Request.Body, interaction.Request.BodyEncoding)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cassette file %s: %w", file, err)
+			}
+			key := requestKey(interaction.Request.Method, interaction.Request.URL, interaction.Request.Headers, body)
+			c.recorded[key] = append(c.recorded[key], &interaction)
+		}
+	default:
+		return nil, fmt.Errorf("unknown cassette mode '%s' (must be %s or %s)", mode, ModeRecord, ModeReplay)
+	}
+	return c, nil
+}
+
+// files returns the exchange files of the cassette in recording order
+func (c *Cassette) files() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Mode returns the mode of the cassette
+func (c *Cassette) Mode() string {
+	return c.mode
+}
+
+// Transport returns a round tripper sending requests through the cassette,
+// with base making the real requests while recording
+func (c *Cassette) Transport(base http.RoundTripper) http.RoundTripper {
+	return &transport{cassette: c, base: base}
+}
+
+// transport is a round tripper of a cassette
+type transport struct {
+	cassette *Cassette
+	base     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.cassette.mode == ModeReplay {
+		return t.cassette.play(req, body)
+	}
+
+	// The request is sent with a copy of the body that was read
+	sent := req.Clone(req.Context())
+	sent.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := t.base.RoundTrip(sent)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if err := t.cassette.record(req, body, resp, respBody); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// record writes an exchange to the next file of the cassette
+func (c *Cassette) record(req *http.Request, body []byte, resp *http.Response, respBody []byte) error {
+	r := newRedactor()
+	headers := r.headers(req.Header)
+	reqURL := r.url(req.URL)
+	interaction := Interaction{
+		Request:  Request{Method: req.Method, URL: reqURL, Headers: headers},
+		Response: Response{Status: resp.StatusCode, Headers: r.headers(resp.Header)},
+	}
+	interaction.Request.Body, interaction.Request.BodyEncoding = encodeBody(r.scrub(body))
+	interaction.Response.Body, interaction.Response.BodyEncoding = encodeBody(r.scrub(respBody))
+
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name := fmt.Sprintf("%04d-%s.json", c.next, fileSafe.ReplaceAllString(req.URL.Hostname(), "_"))
+	if err := os.WriteFile(filepath.Join(c.dir, name), data, 0644); err != nil {
+		return fmt.Errorf("failed to write cassette file: %w", err)
+	}
+	c.next++
+	return nil
+}
+
+// fileSafe matches characters not used in cassette file names
+var fileSafe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// play answers a request with the next recorded exchange of the same request.
+// Once all of them have been replayed, the last one answers again, e.g. for
+// polling requests.
+func (c *Cassette) play(req *http.Request, body []byte) (*http.Response, error) {
+	r := newRedactor()
+	r.headers(req.Header)
+	reqURL := r.url(req.URL)
+	key := requestKey(req.Method, reqURL, req.Header, r.scrub(body))
+
+	c.mu.Lock()
+	recorded := c.recorded[key]
+	n := c.replayed[key]
+	c.replayed[key]++
+	c.mu.Unlock()
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("cassette %s has no recorded response for %s %s", c.dir, req.Method, reqURL)
+	}
+	interaction := recorded[min(n, len(recorded)-1)]
+
+	respBody, err := decodeBody(interaction.Response.Body, interaction.Response.BodyEncoding)
+	if err != nil {
+		return nil, err
+	}
+	status := interaction.Response.Status
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        interaction.Response.Headers.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// requestKey identifies a request for replaying: its method, URL and body.
+// The random boundary of multipart bodies is replaced by a fixed one.
+func requestKey(method, reqURL string, headers http.Header, body []byte) string {
+	if _, params, err := mime.ParseMediaType(headers.Get("Content-Type")); err == nil && params["boundary"] != "" {
+		body = bytes.ReplaceAll(body, []byte(params["boundary"]), []byte("BOUNDARY"))
+	}
+	return method + " " + reqURL + "\n" + string(body)
+}
+
+// encodeBody returns a body as text, or base64 with its encoding if it is binary
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// decodeBody reverses encodeBody
+func decodeBody(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(body), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return nil, fmt.Errorf("unknown body encoding '%s'", encoding)
+}
+
+// sensitiveNames are parts of header and query parameter names that carry credentials
+var sensitiveNames = []string{"auth", "api-key", "api_key", "apikey", "secret", "cookie", "password", "signature", "credential"}
+
+// isSensitive reports whether a header or query parameter carries credentials.
+// Names such as x-ratelimit-remaining-tokens count tokens and are kept.
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range sensitiveNames {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return name == "key" || name == "token" || strings.HasSuffix(name, "_token") || strings.HasSuffix(name, "-token")
+}
+
+// redactor replaces the credentials of an exchange, and every other
+// occurrence of them, e.g. in error messages
+type redactor struct {
+	secrets []string
+}
+
+func newRedactor() *redactor {
+	return &redactor{}
+}
+
+// add remembers a credential; the scheme of an authorization header is kept apart
+func (r *redactor) add(value string) {
+	if _, token, ok := strings.Cut(value, " "); ok {
+		value = token
+	}
+	// Short values such as "true" are not credentials worth scrubbing elsewhere
+	if len(value) >= 8 {
+		r.secrets = append(r.secrets, value)
+	}
+}
+
+// headers returns a copy of headers with the credentials redacted
+func (r *redactor) headers(headers http.Header) http.Header {
+	redacted := make(http.Header, len(headers))
+	for name, values := range headers {
+		if !isSensitive(name) {
+			redacted[name] = append([]string(nil), values...)
+			continue
+		}
+		for _, value := range values {
+			r.add(value)
+			redacted.Add(name, Redacted)
+		}
+	}
+	return redacted
+}
+
+// url returns a URL with the credentials of its query and user info redacted
+func (r *redactor) url(u *url.URL) string {
+	redacted := *u
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			r.add(password)
+			redacted.User = url.UserPassword(u.User.Username(), Redacted)
+		}
+	}
+	query := u.Query()
+	changed := false
+	for name, values := range query {
+		if !isSensitive(name) {
+			continue
+		}
+		for i, value := range values {
+			r.add(value)
+			values[i] = Redacted
+		}
+		changed = true
+	}
+	if changed {
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+// scrub replaces the remembered credentials in a body
+func (r *redactor) scrub(body []byte) []byte {
+	for _, secret := range r.secrets {
+		body = bytes.ReplaceAll(body, []byte(secret), []byte(Redacted))
+	}
+	return body
+}
+
+var (
+	installMu sync.Mutex
+	installed *Cassette
+	original  http.RoundTripper
+)
+
+// Install sends the requests of the process that use http.DefaultTransport
+// through the cassette in dir
+func Install(mode, dir string) error {
+	c, err := Open(mode, dir)
+	if err != nil {
+		return err
+	}
+	installMu.Lock()
+	defer installMu.Unlock()
+	if installed == nil {
+		original = http.DefaultTransport
+	}
+	installed = c
+	http.DefaultTransport = c.Transport(original)
+	return nil
+}
+
+// Installed returns the installed cassette, or nil
+func Installed() *Cassette {
+	installMu.Lock()
+	defer installMu.Unlock()
+	return installed
+}
+
+// Replaying reports whether requests are answered from an installed cassette
+func Replaying() bool {
+	c := Installed()
+	return c != nil && c.mode == ModeReplay
+}
+
+// Wrap sends the requests of a transport that is not based on
+// http.DefaultTransport through the installed cassette, if any
+func Wrap(base http.RoundTripper) http.RoundTripper {
+	if c := Installed(); c != nil {
+		return c.Transport(base)
+	}
+	return base
+}
+
+// BaseTransport returns a copy of the transport making the real requests of
+// http.DefaultTransport, for clients that need their own TLS settings
+func BaseTransport() *http.Transport {
+	installMu.Lock()
+	defer installMu.Unlock()
+	if installed != nil {
+		return original.(*http.Transport).Clone()
+	}
+	return http.DefaultTransport.(*http.Transport).Clone()
+}
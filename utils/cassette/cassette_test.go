@@ -0,0 +1,157 @@
+package cassette
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// client returns an HTTP client sending its requests through a cassette
+func client(t *testing.T, mode, dir string) *http.Client {
+	t.Helper()
+	c, err := Open(mode, dir)
+	if err != nil {
+		t.Fatalf("Failed to open cassette: %v", err)
+	}
+	return &http.Client{Transport: c.Transport(http.DefaultTransport)}
+}
+
+// call sends a POST request and returns the status and body of the response
+func call(t *testing.T, c *http.Client, url, body string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer sk-secret-key-123")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Ratelimit-Remaining-Tokens", "1000")
+		w.Header().Set("Set-Cookie", "session=abcdefghijk")
+		fmt.Fprintf(w, "answer %d to %s (key %s)", n, body, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+	dir := filepath.Join(t.TempDir(), "cassette")
+
+	recorder := client(t, ModeRecord, dir)
+	for _, body := range []string{`{"prompt":"a"}`, `{"prompt":"a"}`, `{"prompt":"b"}`} {
+		if status, _ := call(t, recorder, server.URL+"/v1/chat?key=AIza-secret-123&alt=json", body); status != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 3 || filepath.Base(files[0]) != "0001-127.0.0.1.json" {
+		t.Fatalf("Expected 3 numbered cassette files, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	for _, secret := range []string{"sk-secret-key-123", "AIza-secret-123", "abcdefghijk"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Expected %s to be redacted, got:\n%s", secret, data)
+		}
+	}
+	for _, kept := range []string{"X-Ratelimit-Remaining-Tokens", "alt=json", "key=REDACTED", "(key Bearer REDACTED)"} {
+		if !strings.Contains(string(data), kept) {
+			t.Errorf("Expected the cassette to contain %s, got:\n%s", kept, data)
+		}
+	}
+
+	// Replaying works without the server, and with any API key
+	server.Close()
+	replayer := client(t, ModeReplay, dir)
+	url := server.URL + "/v1/chat?key=other-key-456&alt=json"
+	for i, want := range []string{"answer 1", "answer 2", "answer 2"} {
+		if _, body := call(t, replayer, url, `{"prompt":"a"}`); !strings.HasPrefix(body, want) {
+			t.Errorf("Replay %d: expected %q, got %q", i+1, want, body)
+		}
+	}
+	if _, body := call(t, replayer, url, `{"prompt":"b"}`); !strings.HasPrefix(body, "answer 3") {
+		t.Errorf("Expected the answer to the other request, got %q", body)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"prompt":"c"}`))
+	if _, err := replayer.Do(req); err == nil || !strings.Contains(err.Error(), "no recorded response for POST") {
+		t.Errorf("Expected an unrecorded request to fail, got %v", err)
+	}
+
+	// Recording again adds to the cassette
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	call(t, client(t, ModeRecord, dir), server.URL, "")
+	if files, _ := filepath.Glob(filepath.Join(dir, "0004-*.json")); len(files) != 1 {
+		t.Errorf("Expected a fourth cassette file, got %v", files)
+	}
+}
+
+func TestReplayMultipart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "transcript")
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	send := func(c *http.Client, boundary string) string {
+		body := fmt.Sprintf("--%s\r\nContent-Disposition: form-data; name=\"file\"\r\n\r\naudio\r\n--%s--\r\n", boundary, boundary)
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return string(data)
+	}
+	send(client(t, ModeRecord, dir), "first-boundary")
+	if got := send(client(t, ModeReplay, dir), "second-boundary"); got != "transcript" {
+		t.Errorf("Expected a request with another boundary to match, got %q", got)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	if _, err := Open("rewind", t.TempDir()); err == nil || !strings.Contains(err.Error(), "unknown cassette mode") {
+		t.Errorf("Expected an unknown mode error, got %v", err)
+	}
+	if _, err := Open(ModeReplay, t.TempDir()); err == nil || !strings.Contains(err.Error(), "no recorded exchanges") {
+		t.Errorf("Expected an empty cassette error, got %v", err)
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "0001-host.json"), []byte("{"), 0644)
+	if _, err := Open(ModeReplay, dir); err == nil || !strings.Contains(err.Error(), "invalid cassette file") {
+		t.Errorf("Expected an invalid file error, got %v", err)
+	}
+}
+
+func TestIsSensitive(t *testing.T) {
+	for name, want := range map[string]bool{
+		"Authorization":                true,
+		"x-api-key":                    true,
+		"x-goog-api-key":               true,
+		"key":                          true,
+		"access_token":                 true,
+		"Cookie":                       true,
+		"X-Ratelimit-Remaining-Tokens": false,
+		"Content-Type":                 false,
+		"alt":                          false,
+	} {
+		if got := isSensitive(name); got != want {
+			t.Errorf("isSensitive(%q) = %v, expected %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// The encrypted env file is "ENCRYPTED:" followed by the envelope. Version 2
+// envelopes are "v2:<header>:<sealed>" where the header names the key
+// derivation function with its salt and parameters. Legacy (version 1)
+// envelopes are the base64 nonce and ciphertext with a key from an unsalted
+// SHA-256 of the password; they are still decrypted so that files can be
+// migrated with comanda configure --rekey.
+const (
+	encryptedPrefix   = "ENCRYPTED:"
+	envelopeVersion   = "v2"
+	envelopePrefix    = encryptedPrefix + envelopeVersion + ":"
+	nonceSize         = 12
+	saltSize          = 16
+	encryptionKeySize = 32
+)
+
+// Key derivation functions of version 2 envelopes
+const (
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+)
+
+// Limits on the key derivation parameters read from a file. The header is only
+// authenticated once the key is derived, so a tampered file must not be able to
+// make the derivation take unbounded time or memory.
+const (
+	maxKDFMemory    = 1 << 30 // bytes
+	maxArgon2Time   = 16
+	maxArgon2Thread = 64
+	maxScryptR      = 32
+	maxScryptP      = 16
+)
+
+// envelopeHeader holds the key derivation settings of an encrypted file. It is
+// authenticated together with the ciphertext.
+type envelopeHeader struct {
+	KDF  string `json:"kdf"`
+	Salt []byte `json:"salt"`
+	// argon2id parameters
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"` // KiB
+	Threads uint8  `json:"threads,omitempty"`
+	// scrypt parameters
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+}
+
+// newEnvelopeHeader returns the argon2id settings for new files with a fresh
+// salt, following the second recommendation of RFC 9106 (64 MiB, 3 passes)
+func newEnvelopeHeader() (*envelopeHeader, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("error generating salt: %w", err)
+	}
+	return &envelopeHeader{KDF: KDFArgon2id, Salt: salt, Time: 3, Memory: 64 * 1024, Threads: 4}, nil
+}
+
+// deriveKey returns the key of the header's KDF for a password
+func (h *envelopeHeader) deriveKey(password string) ([]byte, error) {
+	if len(h.Salt) < saltSize {
+		return nil, fmt.Errorf("invalid encrypted data: salt too short")
+	}
+	switch h.KDF {
+	case KDFArgon2id:
+		if h.Time == 0 || h.Memory == 0 || h.Threads == 0 {
+			return nil, fmt.Errorf("invalid encrypted data: missing argon2id parameters")
+		}
+		if h.Time > maxArgon2Time || uint64(h.Memory)*1024 > maxKDFMemory || h.Threads > maxArgon2Thread {
+			return nil, fmt.Errorf("invalid encrypted data: argon2id parameters exceed the supported limits")
+		}
+		return argon2.IDKey([]byte(password), h.Salt, h.Time, h.Memory, h.Threads, encryptionKeySize), nil
+	case KDFScrypt:
+		if h.R > maxScryptR || h.P > maxScryptP || uint64(h.N)*uint64(h.R)*128 > maxKDFMemory {
+			return nil, fmt.Errorf("invalid encrypted data: scrypt parameters exceed the supported limits")
+		}
+		key, err := scrypt.Key([]byte(password), h.Salt, h.N, h.R, h.P, encryptionKeySize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scrypt parameters: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key derivation function '%s'", h.KDF)
+	}
+}
+
+// deriveKey derives the AES-256 key of the legacy format from a password using SHA-256
+func deriveKey(password string) []byte {
+	hash := sha256.Sum256([]byte(password))
+	return hash[:]
+}
+
+// newGCM returns AES-256-GCM for a key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCM: %w", err)
+	}
+	return aesgcm, nil
+}
+
+// IsEncrypted checks if the file content is encrypted
+func IsEncrypted(data []byte) bool {
+	return strings.HasPrefix(string(data), encryptedPrefix)
+}
+
+// IsLegacyEncrypted reports whether the file content is encrypted with the
+// legacy format, which should be migrated with comanda configure --rekey
+func IsLegacyEncrypted(data []byte) bool {
+	return IsEncrypted(data) && !strings.HasPrefix(string(data), envelopePrefix)
+}
+
+// EncryptData encrypts configuration content with a password in the current format
+func EncryptData(plaintext []byte, password string) ([]byte, error) {
+	header, err := newEnvelopeHeader()
+	if err != nil {
+		return nil, err
+	}
+	key, err := header.deriveKey(password)
+	if err != nil {
+		return nil, err
+	}
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding encryption header: %w", err)
+	}
+	// The prefix and header are authenticated, so the KDF parameters cannot be altered
+	aad := envelopePrefix + base64.RawURLEncoding.EncodeToString(headerJSON)
+
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	sealed := aesgcm.Seal(nonce, nonce, plaintext, []byte(aad))
+
+	return []byte(aad + ":" + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// DecryptConfig decrypts the configuration data in the current or the legacy format
+func DecryptConfig(data []byte, password string) ([]byte, error) {
+	DebugLog("Attempting to decrypt configuration data")
+
+	var (
+		key    []byte
+		sealed string
+		aad    []byte
+	)
+	content := strings.TrimSpace(string(data))
+	if strings.HasPrefix(content, envelopePrefix) {
+		encodedHeader, encodedSealed, ok := strings.Cut(strings.TrimPrefix(content, envelopePrefix), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid encrypted data: missing header")
+		}
+		headerJSON, err := base64.RawURLEncoding.DecodeString(encodedHeader)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding encryption header: %w", err)
+		}
+		var header envelopeHeader
+		if err := json.Unmarshal(headerJSON, &header); err != nil {
+			return nil, fmt.Errorf("error parsing encryption header: %w", err)
+		}
+		if key, err = header.deriveKey(password); err != nil {
+			return nil, err
+		}
+		sealed = encodedSealed
+		aad = []byte(envelopePrefix + encodedHeader)
+	} else {
+		DebugLog("Configuration uses the legacy encryption format")
+		key = deriveKey(password)
+		sealed = strings.TrimPrefix(content, encryptedPrefix)
+	}
+
+	// Decode from base64
+	encrypted, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding base64: %w", err)
+	}
+	if len(encrypted) < nonceSize {
+		return nil, fmt.Errorf("invalid encrypted data")
+	}
+
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aesgcm.Open(nil, encrypted[:nonceSize], encrypted[nonceSize:], aad)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting data (wrong password?): %w", err)
+	}
+
+	DebugLog("Successfully decrypted configuration")
+	return plaintext, nil
+}
+
+// EncryptConfig encrypts the configuration file
+func EncryptConfig(path string, password string) error {
+	DebugLog("Attempting to encrypt configuration at: %s", path)
+
+	plaintext, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+	if IsEncrypted(plaintext) {
+		return fmt.Errorf("configuration is already encrypted; use --rekey to change the password")
+	}
+
+	encrypted, err := EncryptData(plaintext, password)
+	if err != nil {
+		return err
+	}
+	if err := WriteConfigFile(path, encrypted); err != nil {
+		return fmt.Errorf("error writing encrypted file: %w", err)
+	}
+
+	DebugLog("Successfully encrypted configuration")
+	return nil
+}
+
+// RekeyConfig re-encrypts an encrypted configuration file, or its encrypted
+// secret fields, with a new password in the current format, migrating files in
+// the legacy format
+func RekeyConfig(path string, oldPassword string, newPassword string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+	if IsFieldEncrypted(data) {
+		return rekeyConfigFields(path, oldPassword, newPassword)
+	}
+	if !IsEncrypted(data) {
+		return fmt.Errorf("configuration is not encrypted")
+	}
+
+	plaintext, err := DecryptConfig(data, oldPassword)
+	if err != nil {
+		return err
+	}
+	encrypted, err := EncryptData(plaintext, newPassword)
+	if err != nil {
+		return err
+	}
+	if err := WriteConfigFile(path, encrypted); err != nil {
+		return fmt.Errorf("error writing encrypted file: %w", err)
+	}
+	return nil
+}
+
+// SaveEncryptedEnvConfig saves the environment configuration encrypted with a
+// password, without writing the plaintext to disk
+func SaveEncryptedEnvConfig(path string, config *EnvConfig, password string) error {
+	data, err := config.marshalYAML()
+	if err != nil {
+		return fmt.Errorf("error marshaling env config: %w", err)
+	}
+	encrypted, err := EncryptData(data, password)
+	if err != nil {
+		return err
+	}
+	if err := WriteConfigFile(path, encrypted); err != nil {
+		return fmt.Errorf("error writing env file: %w", err)
+	}
+	return nil
+}
+
+// WriteConfigFile replaces a file holding configuration or secrets atomically:
+// the content is written to a temporary file with 0600 permissions in the same
+// directory and renamed over the target, so that readers never see a partial
+// file. A symlinked target is replaced where the link points.
+func WriteConfigFile(path string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // No-op after a successful rename
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
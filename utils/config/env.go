@@ -1,13 +1,9 @@
 package config
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -47,15 +43,70 @@ type DatabaseConfig struct {
 
 // Model represents a single model configuration
 type Model struct {
-	Name  string      `yaml:"name"`
-	Type  string      `yaml:"type"`
-	Modes []ModelMode `yaml:"modes"`
+	Name   string      `yaml:"name"`
+	Type   string      `yaml:"type"`
+	Modes  []ModelMode `yaml:"modes"`
+	Params ModelParams `yaml:"params,omitempty"` // Default generation parameters, overridden per step
+	// RateLimit throttles requests to this model
+	RateLimit *RateLimit `yaml:"rate_limit,omitempty"`
+	// Pricing overrides the built-in price of the model in cost estimates
+	Pricing *Pricing `yaml:"pricing,omitempty"`
+}
+
+// Pricing is the price of a model in US dollars per million tokens
+type Pricing struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
 }
 
 // Provider represents a provider's configuration
 type Provider struct {
 	APIKey string  `yaml:"api_key"`
 	Models []Model `yaml:"models"`
+
+	// APIKeys lists several keys, e.g. for different organizations or projects;
+	// it takes precedence over APIKey
+	APIKeys []APIKey `yaml:"api_keys,omitempty"`
+	// KeySelection chooses among APIKeys: round-robin (default) or least-used
+	KeySelection string `yaml:"key_selection,omitempty"`
+
+	// Type selects a generic provider implementation; "openai-compatible" targets
+	// any endpoint that speaks the OpenAI chat completions API
+	Type string `yaml:"type,omitempty"`
+	// BaseURL is the API root of an openai-compatible endpoint, e.g. http://localhost:4000/v1
+	BaseURL string `yaml:"base_url,omitempty"`
+	// Headers are sent with every request to an openai-compatible endpoint
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Auth is how the API key is sent: bearer (default), api-key, header:<Name> or none
+	Auth string `yaml:"auth,omitempty"`
+	// Endpoint overrides the server address of a self-hosted provider such as Ollama or vLLM
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// TLS configures certificates for HTTPS endpoints
+	TLS *TLSConfig `yaml:"tls,omitempty"`
+	// RateLimit throttles requests to all models of the provider together
+	RateLimit *RateLimit `yaml:"rate_limit,omitempty"`
+}
+
+// TLSConfig holds the TLS settings for connecting to a self-hosted provider
+type TLSConfig struct {
+	CACert             string `yaml:"ca_cert,omitempty"`     // PEM bundle used to verify the server
+	ClientCert         string `yaml:"client_cert,omitempty"` // PEM certificate for mutual TLS
+	ClientKey          string `yaml:"client_key,omitempty"`  // PEM key for mutual TLS
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// Kind returns the provider implementation used for a configuration entry: its
+// type when set, otherwise the entry's own name (e.g. "openai" or "ollama")
+func (p *Provider) Kind(name string) string {
+	if p.Type != "" {
+		return p.Type
+	}
+	return name
+}
+
+// IsOpenAICompatible reports whether the provider is a generic OpenAI-compatible endpoint
+func (p *Provider) IsOpenAICompatible() bool {
+	return p.Type == "openai-compatible"
 }
 
 // EnvConfig represents the complete environment configuration
@@ -64,7 +115,18 @@ type EnvConfig struct {
 	Server                 *ServerConfig             `yaml:"server,omitempty"`
 	Databases              map[string]DatabaseConfig `yaml:"databases,omitempty"` // Added database configurations
 	DefaultGenerationModel string                    `yaml:"default_generation_model,omitempty"`
-	MemoryFile             string                    `yaml:"memory_file,omitempty"` // Path to COMANDA.md memory file
+	MemoryFile             string                    `yaml:"memory_file,omitempty"`             // Path to COMANDA.md memory file
+	MemoryCompactionModel  string                    `yaml:"memory_compaction_model,omitempty"` // Model used to summarize old memory entries
+	MemoryNamespace        string                    `yaml:"memory_namespace,omitempty"`        // Default memory namespace (empty for the main document)
+	Aliases                map[string]string         `yaml:"aliases,omitempty"`                 // Short model names such as "fast" mapped to provider/model
+	Project                string                    `yaml:"project,omitempty"`                 // Default project selecting project-scoped API keys
+	Encryption             *FieldEncryption          `yaml:"encryption,omitempty"`              // Set when secret fields are encrypted individually
+
+	secretRefs map[string]secretRef    // Secret references resolved at load time, by field path
+	fieldKeys  *fieldKeys              // Key of the encrypted secret fields, once the password is known
+	layers     []Layer                 // Layers the configuration was loaded from
+	sources    map[string]*ValueSource // Source of every value of a layered configuration, by path
+	layered    bool                    // Merged from several layers, so it cannot be saved to one file
 }
 
 // Verbose indicates whether verbose logging is enabled
@@ -108,105 +170,6 @@ func PromptPassword(prompt string) (string, error) {
 	return string(password), nil
 }
 
-// deriveKey derives an AES-256 key from a password using SHA-256
-func deriveKey(password string) []byte {
-	hash := sha256.Sum256([]byte(password))
-	return hash[:]
-}
-
-// IsEncrypted checks if the file content is encrypted
-func IsEncrypted(data []byte) bool {
-	return strings.HasPrefix(string(data), "ENCRYPTED:")
-}
-
-// EncryptConfig encrypts the configuration file
-func EncryptConfig(path string, password string) error {
-	DebugLog("Attempting to encrypt configuration at: %s", path)
-
-	// Read the original file
-	plaintext, err := os.ReadFile(path)
-	if err != nil {
-		return fmt.Errorf("error reading file: %w", err)
-	}
-
-	// Generate a random nonce
-	nonce := make([]byte, 12)
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return fmt.Errorf("error generating nonce: %w", err)
-	}
-
-	// Create cipher
-	key := deriveKey(password)
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return fmt.Errorf("error creating cipher: %w", err)
-	}
-
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return fmt.Errorf("error creating GCM: %w", err)
-	}
-
-	// Encrypt the data
-	ciphertext := aesgcm.Seal(nil, nonce, plaintext, nil)
-
-	// Combine nonce and ciphertext
-	encrypted := append(nonce, ciphertext...)
-
-	// Encode as base64 and add prefix
-	encodedData := "ENCRYPTED:" + base64.StdEncoding.EncodeToString(encrypted)
-
-	// Write the encrypted data back to the file
-	if err := os.WriteFile(path, []byte(encodedData), 0644); err != nil {
-		return fmt.Errorf("error writing encrypted file: %w", err)
-	}
-
-	DebugLog("Successfully encrypted configuration")
-	return nil
-}
-
-// DecryptConfig decrypts the configuration data
-func DecryptConfig(data []byte, password string) ([]byte, error) {
-	DebugLog("Attempting to decrypt configuration data")
-
-	// Remove the "ENCRYPTED:" prefix
-	encodedData := strings.TrimPrefix(string(data), "ENCRYPTED:")
-
-	// Decode from base64
-	encrypted, err := base64.StdEncoding.DecodeString(encodedData)
-	if err != nil {
-		return nil, fmt.Errorf("error decoding base64: %w", err)
-	}
-
-	// Extract nonce and ciphertext
-	if len(encrypted) < 12 {
-		return nil, fmt.Errorf("invalid encrypted data")
-	}
-	nonce := encrypted[:12]
-	ciphertext := encrypted[12:]
-
-	// Create cipher
-	key := deriveKey(password)
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("error creating cipher: %w", err)
-	}
-
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, fmt.Errorf("error creating GCM: %w", err)
-	}
-
-	// Decrypt the data
-	plaintext, err := aesgcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error decrypting data (wrong password?): %w", err)
-	}
-
-	DebugLog("Successfully decrypted configuration")
-	return plaintext, nil
-}
-
 // LoadEnvConfig loads the environment configuration from .env file
 func LoadEnvConfig(path string) (*EnvConfig, error) {
 	DebugLog("Attempting to load environment configuration from: %s", path)
@@ -242,6 +205,13 @@ func LoadEnvConfig(path string) (*EnvConfig, error) {
 		config.Databases = make(map[string]DatabaseConfig)
 	}
 
+	if err := config.ResolveSecrets(); err != nil {
+		return nil, err
+	}
+	if config.Encryption != nil {
+		config.fieldKeys = &fieldKeys{}
+	}
+
 	DebugLog("Successfully loaded environment configuration")
 	return &config, nil
 }
@@ -283,6 +253,13 @@ func LoadEncryptedEnvConfig(path string, password string) (*EnvConfig, error) {
 		config.Databases = make(map[string]DatabaseConfig)
 	}
 
+	if err := config.ResolveSecrets(); err != nil {
+		return nil, err
+	}
+	if config.Encryption != nil {
+		config.fieldKeys = &fieldKeys{}
+	}
+
 	return &config, nil
 }
 
@@ -300,6 +277,9 @@ func LoadEnvConfigWithPassword(path string) (*EnvConfig, error) {
 	}
 
 	if IsEncrypted(data) {
+		if IsLegacyEncrypted(data) {
+			log.Printf("Warning: %s uses the legacy encryption format; run 'comanda configure --rekey' to upgrade it\n", path)
+		}
 		password, err := PromptPassword("Enter decryption password: ")
 		if err != nil {
 			return nil, err
@@ -307,20 +287,32 @@ func LoadEnvConfigWithPassword(path string) (*EnvConfig, error) {
 		return LoadEncryptedEnvConfig(path, password)
 	}
 
-	return LoadEnvConfig(path)
+	config, err := LoadEnvConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	// Encrypted secret fields ask for the password when a secret is first needed
+	if config.Encryption != nil {
+		config.promptSecretsPassword()
+	}
+	return config, nil
 }
 
 // SaveEnvConfig saves the environment configuration to .env file
 func SaveEnvConfig(path string, config *EnvConfig) error {
 	DebugLog("Attempting to save environment configuration to: %s", path)
 
-	data, err := yaml.Marshal(config)
+	if config.layered {
+		return fmt.Errorf("cannot save a configuration merged from several layers; edit the env file or the layer files instead")
+	}
+
+	data, err := config.marshalYAML()
 	if err != nil {
 		DebugLog("Error marshaling environment config: %v", err)
 		return fmt.Errorf("error marshaling env config: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := WriteConfigFile(path, data); err != nil {
 		DebugLog("Error writing environment file: %v", err)
 		return fmt.Errorf("error writing env file: %w", err)
 	}
@@ -395,6 +387,9 @@ func (c *EnvConfig) GetProviderConfig(providerName string) (*Provider, error) {
 	if provider == nil {
 		return nil, fmt.Errorf("provider %s configuration is nil", providerName)
 	}
+	if err := c.Unseal("providers." + providerName); err != nil {
+		return nil, err
+	}
 	return provider, nil
 }
 
@@ -495,8 +490,12 @@ func (c *EnvConfig) GetModelConfig(providerName, modelName string) (*Model, erro
 	return nil, fmt.Errorf("model %s not found for provider %s", modelName, providerName)
 }
 
-// UpdateAPIKey updates the API key for a specific provider
+// UpdateAPIKey updates the API key for a specific provider. Secret references
+// are rejected, since the key may come from a client of the server.
 func (c *EnvConfig) UpdateAPIKey(providerName, apiKey string) error {
+	if IsSecretRef(apiKey) {
+		return ErrSecretRefNotAllowed
+	}
 	provider, exists := c.Providers[providerName]
 	if !exists {
 		return fmt.Errorf("provider %s not found", providerName)
@@ -545,10 +544,13 @@ func (c *EnvConfig) GetDatabaseConfig(name string) (*DatabaseConfig, error) {
 		return nil, fmt.Errorf("no databases configured")
 	}
 
-	db, exists := c.Databases[name]
-	if !exists {
+	if _, exists := c.Databases[name]; !exists {
 		return nil, fmt.Errorf("database %s not found in configuration", name)
 	}
+	if err := c.Unseal("databases." + name); err != nil {
+		return nil, err
+	}
+	db := c.Databases[name]
 
 	return &db, nil
 }
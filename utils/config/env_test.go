@@ -1,6 +1,8 @@
 package config
 
 import (
+	"encoding/base64"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -242,3 +244,593 @@ func TestLoadEnvConfigWithPassword(t *testing.T) {
 		t.Error("Loading invalid YAML should fail")
 	}
 }
+
+func TestModelParamsMergeAndValidate(t *testing.T) {
+	var params ModelParams
+	if err := yaml.Unmarshal([]byte("temperature: 0\nseed: 3\nstop: [END]\n"), &params); err != nil {
+		t.Fatalf("Failed to parse params: %v", err)
+	}
+	if params.Temperature == nil || *params.Temperature != 0 {
+		t.Fatalf("An explicit zero temperature should be kept, got %v", params.Temperature)
+	}
+	if got := strings.Join(params.Names(), ","); got != "temperature,stop,seed" {
+		t.Errorf("Names = %s", got)
+	}
+
+	override := 0.7
+	merged := params.Merge(ModelParams{Temperature: &override, ReasoningEffort: "high"})
+	if *merged.Temperature != 0.7 || *merged.Seed != 3 || merged.ReasoningEffort != "high" || len(merged.Stop) != 1 {
+		t.Errorf("Unexpected merge result: %+v", merged)
+	}
+	if err := merged.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+
+	invalid := ModelParams{ReasoningEffort: "extreme"}
+	if err := invalid.Validate(); err == nil || !strings.Contains(err.Error(), "reasoning_effort") {
+		t.Errorf("Expected a reasoning_effort error, got %v", err)
+	}
+	if !(ModelParams{}).IsZero() || merged.IsZero() {
+		t.Error("IsZero returned the wrong result")
+	}
+}
+
+func TestGetRateLimits(t *testing.T) {
+	var cfg EnvConfig
+	data := `
+providers:
+  openai:
+    api_key: test-key
+    rate_limit:
+      requests_per_minute: 500
+    models:
+      - name: gpt-4o
+        type: external
+        rate_limit:
+          tokens_per_minute: 30000
+      - name: gpt-4o-mini
+        type: external
+`
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	limits, err := cfg.GetRateLimits("openai", "gpt-4o")
+	if err != nil {
+		t.Fatalf("GetRateLimits failed: %v", err)
+	}
+	if limits["openai"].RequestsPerMinute != 500 || limits["openai/gpt-4o"].TokensPerMinute != 30000 || len(limits) != 2 {
+		t.Errorf("Unexpected limits for gpt-4o: %+v", limits)
+	}
+	if limits, _ := cfg.GetRateLimits("openai", "gpt-4o-mini"); len(limits) != 1 {
+		t.Errorf("gpt-4o-mini should only share the provider limit, got %+v", limits)
+	}
+	if limits, err := cfg.GetRateLimits("anthropic", "claude-sonnet-4-5"); err != nil || len(limits) != 0 {
+		t.Errorf("Unconfigured providers should not be limited, got %+v, %v", limits, err)
+	}
+
+	cfg.Providers["openai"].RateLimit.RequestsPerMinute = -1
+	if _, err := cfg.GetRateLimits("openai", "gpt-4o"); err == nil || !strings.Contains(err.Error(), "requests_per_minute") {
+		t.Errorf("Expected an error for a negative limit, got %v", err)
+	}
+}
+
+func TestProviderKeys(t *testing.T) {
+	single := Provider{APIKey: "sk-single"}
+	if keys := single.Keys(); len(keys) != 1 || keys[0].Name != "default" || keys[0].Key != "sk-single" {
+		t.Errorf("A single api_key should be the default key, got %+v", keys)
+	}
+	if (&Provider{}).HasAPIKey() {
+		t.Error("A provider without keys should report none")
+	}
+
+	multi := Provider{APIKey: "sk-ignored", APIKeys: []APIKey{{Name: "a", Key: "sk-a"}, {Name: "b", Key: "sk-b", Project: "research"}}}
+	if keys := multi.Keys(); len(keys) != 2 || keys[0].Key != "sk-a" {
+		t.Errorf("api_keys should take precedence, got %+v", keys)
+	}
+	if err := multi.ValidateKeys(); err != nil {
+		t.Errorf("ValidateKeys failed: %v", err)
+	}
+
+	multi.KeySelection = "random"
+	if err := multi.ValidateKeys(); err == nil {
+		t.Error("Expected an error for an unknown key_selection")
+	}
+	multi.KeySelection = KeySelectionLeastUsed
+	multi.APIKeys = append(multi.APIKeys, APIKey{Name: "a", Key: "sk-c"})
+	if err := multi.ValidateKeys(); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("Expected a duplicate name error, got %v", err)
+	}
+}
+
+func TestSecretReferences(t *testing.T) {
+	tmpDir := t.TempDir()
+	secretFile := filepath.Join(tmpDir, "db_password")
+	if err := os.WriteFile(secretFile, []byte("db-secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	t.Setenv("TEST_OPENAI_KEY", "sk-from-env")
+
+	envPath := filepath.Join(tmpDir, ".env")
+	content := `providers:
+  openai:
+    api_key: env:TEST_OPENAI_KEY
+    models: []
+  anthropic:
+    api_key: sk-literal
+    api_keys:
+      - name: team
+        key: cmd:echo sk-from-cmd | tr a-z A-Z
+    models: []
+databases:
+  main:
+    type: postgres
+    password: file:` + secretFile + `
+server:
+  bearerToken: env:TEST_OPENAI_KEY
+`
+	if err := os.WriteFile(envPath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+
+	cfg, err := LoadEnvConfig(envPath)
+	if err != nil {
+		t.Fatalf("LoadEnvConfig failed: %v", err)
+	}
+	if got := cfg.Providers["openai"].APIKey; got != "sk-from-env" {
+		t.Errorf("env: reference resolved to %q", got)
+	}
+	if got := cfg.Providers["anthropic"].APIKeys[0].Key; got != "SK-FROM-CMD" {
+		t.Errorf("cmd: reference resolved to %q", got)
+	}
+	if got := cfg.Databases["main"].Password; got != "db-secret" {
+		t.Errorf("file: reference resolved to %q", got)
+	}
+	if got := cfg.Server.BearerToken; got != "sk-from-env" {
+		t.Errorf("bearer token resolved to %q", got)
+	}
+	if got := cfg.Providers["anthropic"].APIKey; got != "sk-literal" {
+		t.Errorf("A literal secret should be kept, got %q", got)
+	}
+
+	// Saving writes the references back, except for secrets that were changed
+	cfg.Server.BearerToken = "new-token"
+	if err := SaveEnvConfig(envPath, cfg); err != nil {
+		t.Fatalf("SaveEnvConfig failed: %v", err)
+	}
+	saved, err := os.ReadFile(envPath)
+	if err != nil {
+		t.Fatalf("Failed to read saved env file: %v", err)
+	}
+	for _, want := range []string{"env:TEST_OPENAI_KEY", "cmd:echo sk-from-cmd | tr a-z A-Z", "file:" + secretFile, "new-token"} {
+		if !strings.Contains(string(saved), want) {
+			t.Errorf("Saved config should contain %q:\n%s", want, saved)
+		}
+	}
+	for _, secret := range []string{"sk-from-env", "SK-FROM-CMD", "db-secret"} {
+		if strings.Contains(string(saved), secret) {
+			t.Errorf("Saved config should not contain the resolved secret %q", secret)
+		}
+	}
+	if cfg.Providers["openai"].APIKey != "sk-from-env" {
+		t.Error("Saving should not change the loaded configuration")
+	}
+
+	// A reference that cannot be resolved fails the load and names the field
+	os.Unsetenv("TEST_OPENAI_KEY")
+	if _, err := LoadEnvConfig(envPath); err == nil || !strings.Contains(err.Error(), "providers.openai.api_key") {
+		t.Errorf("Expected an error naming the unresolved field, got %v", err)
+	}
+}
+
+func TestUpdateAPIKeyRejectsSecretRefs(t *testing.T) {
+	cfg := &EnvConfig{Providers: map[string]*Provider{
+		"openai": {APIKey: "sk-original"},
+	}}
+	for _, key := range []string{"cmd:touch /tmp/pwned", "file:/etc/passwd", "env:HOME"} {
+		if err := cfg.UpdateAPIKey("openai", key); !errors.Is(err, ErrSecretRefNotAllowed) {
+			t.Errorf("Expected %q to be rejected, got %v", key, err)
+		}
+	}
+	if got := cfg.Providers["openai"].APIKey; got != "sk-original" {
+		t.Errorf("A rejected key should leave the API key unchanged, got %q", got)
+	}
+	if err := cfg.UpdateAPIKey("openai", "sk-new"); err != nil || cfg.Providers["openai"].APIKey != "sk-new" {
+		t.Errorf("Expected a literal key to be stored, got %q (%v)", cfg.Providers["openai"].APIKey, err)
+	}
+}
+
+// encryptLegacy encrypts content in the legacy format, with a key from an
+// unsalted SHA-256 of the password
+func encryptLegacy(t *testing.T, plaintext []byte, password string) []byte {
+	t.Helper()
+	aesgcm, err := newGCM(deriveKey(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, nonceSize)
+	sealed := aesgcm.Seal(nonce, nonce, plaintext, nil)
+	return []byte(encryptedPrefix + base64.StdEncoding.EncodeToString(sealed))
+}
+
+func TestEncryptionFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	envPath := filepath.Join(tmpDir, ".env")
+	plaintext := []byte("providers:\n  openai:\n    api_key: sk-test\n")
+	if err := os.WriteFile(envPath, plaintext, 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+
+	if err := EncryptConfig(envPath, "first-password"); err != nil {
+		t.Fatalf("EncryptConfig failed: %v", err)
+	}
+	info, err := os.Stat(envPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Encrypted file should have 0600 permissions, got %o", perm)
+	}
+	data, _ := os.ReadFile(envPath)
+	if !strings.HasPrefix(string(data), envelopePrefix) || IsLegacyEncrypted(data) {
+		t.Fatalf("Expected a versioned envelope, got %q", data[:20])
+	}
+	if err := EncryptConfig(envPath, "first-password"); err == nil {
+		t.Error("Encrypting an encrypted file should fail")
+	}
+
+	// Each encryption uses a fresh salt
+	again, err := EncryptData(plaintext, "first-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Split(string(again), ":")[2] == strings.Split(string(data), ":")[2] {
+		t.Error("Expected a different salt for every encryption")
+	}
+
+	// The header is authenticated: changing the KDF parameters breaks decryption
+	parts := strings.SplitN(string(data), ":", 4)
+	headerJSON, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	tampered := strings.Replace(string(headerJSON), `"time":3`, `"time":1`, 1)
+	parts[2] = base64.RawURLEncoding.EncodeToString([]byte(tampered))
+	if _, err := DecryptConfig([]byte(strings.Join(parts, ":")), "first-password"); err == nil {
+		t.Error("Expected decryption to fail with a tampered header")
+	}
+
+	// Parameters above the limits are rejected before any key is derived
+	salt := make([]byte, saltSize)
+	for _, header := range []envelopeHeader{
+		{KDF: KDFArgon2id, Salt: salt, Time: 3, Memory: 4 << 20, Threads: 4},
+		{KDF: KDFArgon2id, Salt: salt, Time: 1 << 20, Memory: 64 * 1024, Threads: 4},
+		{KDF: KDFScrypt, Salt: salt, N: 1 << 30, R: 8, P: 1},
+		{KDF: KDFScrypt, Salt: salt, N: 1 << 15, R: 8, P: 1 << 20},
+	} {
+		if _, err := header.deriveKey("first-password"); err == nil || !strings.Contains(err.Error(), "limits") {
+			t.Errorf("Expected %+v to exceed the limits, got %v", header, err)
+		}
+	}
+
+	// Rekeying changes the password
+	if err := RekeyConfig(envPath, "wrong-password", "second-password"); err == nil {
+		t.Error("Rekeying with a wrong password should fail")
+	}
+	if err := RekeyConfig(envPath, "first-password", "second-password"); err != nil {
+		t.Fatalf("RekeyConfig failed: %v", err)
+	}
+	data, _ = os.ReadFile(envPath)
+	if decrypted, err := DecryptConfig(data, "second-password"); err != nil || string(decrypted) != string(plaintext) {
+		t.Errorf("Decrypting with the new password failed: %v", err)
+	}
+
+	// Legacy files are still decrypted and rekeying migrates them
+	legacy := encryptLegacy(t, plaintext, "old-password")
+	if !IsLegacyEncrypted(legacy) {
+		t.Fatal("Expected the legacy format to be detected")
+	}
+	if err := os.WriteFile(envPath, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadEncryptedEnvConfig(envPath, "old-password")
+	if err != nil || cfg.Providers["openai"].APIKey != "sk-test" {
+		t.Fatalf("Loading a legacy file failed: %v", err)
+	}
+	if err := RekeyConfig(envPath, "old-password", "old-password"); err != nil {
+		t.Fatalf("RekeyConfig failed for a legacy file: %v", err)
+	}
+	data, _ = os.ReadFile(envPath)
+	if IsLegacyEncrypted(data) {
+		t.Error("Rekeying should migrate the file to the versioned format")
+	}
+	if _, err := LoadEncryptedEnvConfig(envPath, "old-password"); err != nil {
+		t.Errorf("Loading the migrated file failed: %v", err)
+	}
+}
+
+func TestSaveEncryptedEnvConfig(t *testing.T) {
+	envPath := filepath.Join(t.TempDir(), ".env")
+	cfg := &EnvConfig{Providers: map[string]*Provider{"openai": {APIKey: "sk-test"}}}
+	if err := SaveEncryptedEnvConfig(envPath, cfg, "password"); err != nil {
+		t.Fatalf("SaveEncryptedEnvConfig failed: %v", err)
+	}
+	data, _ := os.ReadFile(envPath)
+	if !IsEncrypted(data) || strings.Contains(string(data), "sk-test") {
+		t.Fatal("Expected the configuration to be saved encrypted")
+	}
+	loaded, err := LoadEncryptedEnvConfig(envPath, "password")
+	if err != nil || loaded.Providers["openai"].APIKey != "sk-test" {
+		t.Errorf("Loading the saved configuration failed: %v", err)
+	}
+
+	// Saving through a symlink replaces the file it points to
+	link := filepath.Join(t.TempDir(), "link.env")
+	if err := os.Symlink(envPath, link); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	if err := SaveEnvConfig(link, cfg); err != nil {
+		t.Fatalf("SaveEnvConfig failed: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Saving should keep the symlink")
+	}
+	if data, _ := os.ReadFile(envPath); IsEncrypted(data) {
+		t.Error("Saving through the symlink should replace its target")
+	}
+}
+
+func TestFieldEncryption(t *testing.T) {
+	envPath := filepath.Join(t.TempDir(), ".env")
+	t.Setenv("TEST_ANTHROPIC_KEY", "sk-ant-from-env")
+	cfg := &EnvConfig{
+		Providers: map[string]*Provider{
+			"openai":    {APIKey: "sk-openai", Models: []Model{{Name: "gpt-4o", Type: "external"}}},
+			"anthropic": {APIKey: "env:TEST_ANTHROPIC_KEY"},
+			"ollama":    {APIKeys: []APIKey{{Name: "team", Key: "sk-team"}}},
+		},
+		Databases: map[string]DatabaseConfig{"main": {Type: PostgreSQL, Password: "db-secret"}},
+		Server:    &ServerConfig{Port: 8080, BearerToken: "token"},
+	}
+	if err := SaveEnvConfig(envPath, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EncryptConfigFields(envPath, "password"); err != nil {
+		t.Fatalf("EncryptConfigFields failed: %v", err)
+	}
+	data, _ := os.ReadFile(envPath)
+	if IsEncrypted(data) || !IsFieldEncrypted(data) {
+		t.Fatal("Expected only the secret fields to be encrypted")
+	}
+	for _, secret := range []string{"sk-openai", "sk-team", "db-secret", "bearerToken: token"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Secret %q should be encrypted:\n%s", secret, data)
+		}
+	}
+	for _, plain := range []string{"gpt-4o", "port: 8080", "env:TEST_ANTHROPIC_KEY"} {
+		if !strings.Contains(string(data), plain) {
+			t.Errorf("%q should stay in plain text:\n%s", plain, data)
+		}
+	}
+	if err := EncryptConfigFields(envPath, "password"); err == nil {
+		t.Error("Encrypting the fields twice should fail")
+	}
+
+	// Loading needs no password; secrets stay encrypted until needed
+	loaded, err := LoadEnvConfig(envPath)
+	if err != nil {
+		t.Fatalf("LoadEnvConfig failed: %v", err)
+	}
+	if loaded.Providers["anthropic"].APIKey != "sk-ant-from-env" {
+		t.Error("Secret references should still be resolved at load time")
+	}
+	if _, err := loaded.GetProviderConfig("openai"); !errors.Is(err, ErrSealedSecret) {
+		t.Errorf("Expected ErrSealedSecret without a password, got %v", err)
+	}
+	loaded.SetSecretsPassword("wrong")
+	if _, err := loaded.GetProviderConfig("openai"); err == nil || !strings.Contains(err.Error(), "wrong password") {
+		t.Errorf("Expected a wrong password error, got %v", err)
+	}
+	loaded.SetSecretsPassword("password")
+	openai, err := loaded.GetProviderConfig("openai")
+	if err != nil || openai.APIKey != "sk-openai" {
+		t.Fatalf("Expected the decrypted key, got %v", err)
+	}
+	if !IsSealed(loaded.Providers["ollama"].APIKeys[0].Key) || !IsSealed(loaded.Databases["main"].Password) {
+		t.Error("Secrets of other providers and databases should stay encrypted")
+	}
+	if db, err := loaded.GetDatabaseConfig("main"); err != nil || db.Password != "db-secret" {
+		t.Errorf("Expected the decrypted database password, got %v", err)
+	}
+
+	// A sealed value only opens in the field it was sealed for
+	swappedPath := filepath.Join(filepath.Dir(envPath), "swapped.env")
+	swapped := strings.Replace(string(data), extractLine(t, data, "bearerToken: enc:"), "bearerToken: "+strings.TrimPrefix(extractLine(t, data, "api_key: enc:"), "api_key: "), 1)
+	if err := os.WriteFile(swappedPath, []byte(swapped), 0600); err != nil {
+		t.Fatal(err)
+	}
+	swappedConfig, err := LoadEnvConfig(swappedPath)
+	if err != nil {
+		t.Fatalf("LoadEnvConfig failed: %v", err)
+	}
+	swappedConfig.SetSecretsPassword("password")
+	if err := swappedConfig.Unseal("server"); !errors.Is(err, ErrSealedSecret) {
+		t.Errorf("Expected a sealed value moved to another field to fail, got %v", err)
+	}
+
+	// Saving keeps unchanged sealed values as they were and encrypts new secrets
+	sealedOpenAI := extractLine(t, data, "api_key: enc:")
+	if err := loaded.UpdateAPIKey("openai", "sk-new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveEnvConfig(envPath, loaded); err != nil {
+		t.Fatalf("SaveEnvConfig failed: %v", err)
+	}
+	saved, _ := os.ReadFile(envPath)
+	if strings.Contains(string(saved), "sk-new") || strings.Contains(string(saved), "db-secret") {
+		t.Errorf("Saved secrets should be encrypted:\n%s", saved)
+	}
+	if strings.Contains(string(saved), sealedOpenAI) {
+		t.Error("The changed key should be sealed again")
+	}
+	if !strings.Contains(string(saved), extractLine(t, data, "password: enc:")) {
+		t.Error("An unchanged secret should keep its sealed value")
+	}
+
+	// Rekeying and decrypting
+	if err := RekeyConfig(envPath, "password", "new-password"); err != nil {
+		t.Fatalf("RekeyConfig failed: %v", err)
+	}
+	if err := DecryptConfigFields(envPath, "password"); err == nil {
+		t.Error("Decrypting with the old password should fail")
+	}
+	if err := DecryptConfigFields(envPath, "new-password"); err != nil {
+		t.Fatalf("DecryptConfigFields failed: %v", err)
+	}
+	plain, err := LoadEnvConfig(envPath)
+	if err != nil || plain.Encryption != nil || plain.Providers["openai"].APIKey != "sk-new" || plain.Server.BearerToken != "token" {
+		t.Errorf("Expected the decrypted configuration, got %v", err)
+	}
+}
+
+// extractLine returns the trimmed line of data starting with prefix
+func extractLine(t *testing.T, data []byte, prefix string) string {
+	t.Helper()
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), prefix) {
+			return strings.TrimSpace(line)
+		}
+	}
+	t.Fatalf("No line starting with %q", prefix)
+	return ""
+}
+
+func TestLayeredConfig(t *testing.T) {
+	root := t.TempDir()
+	home := filepath.Join(root, "home")
+	project := filepath.Join(root, "repo")
+	workDir := filepath.Join(project, "sub")
+	for _, dir := range []string{filepath.Join(home, ConfigDirName), filepath.Join(project, ConfigDirName), workDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("TEST_PERSONAL_KEY", "sk-personal")
+	oldDir, _ := os.Getwd()
+	if err := os.Chdir(workDir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(oldDir) })
+
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(home, ConfigDirName, ConfigFileName), `providers:
+  openai:
+    api_key: env:TEST_PERSONAL_KEY
+default_generation_model: gpt-4o-mini
+project: personal
+`)
+	write(filepath.Join(project, ConfigDirName, ConfigFileName), `providers:
+  openai:
+    models:
+      - name: gpt-4o
+        type: external
+        modes: [text]
+      - name: o3
+        type: external
+default_generation_model: gpt-4o
+`)
+	envPath := filepath.Join(workDir, ".env")
+	write(envPath, `providers:
+  openai:
+    api_key: ""
+    models:
+      - name: gpt-4o
+        type: custom
+`)
+
+	overrides, err := ParseOverrides([]string{"project=team", "providers.openai.rate_limit.requests_per_minute=10"})
+	if err != nil {
+		t.Fatalf("ParseOverrides failed: %v", err)
+	}
+	if _, err := ParseOverrides([]string{"project"}); err == nil {
+		t.Error("Expected an error for a --set without a value")
+	}
+
+	cfg, err := LoadLayeredEnvConfig(envPath, overrides)
+	if err != nil {
+		t.Fatalf("LoadLayeredEnvConfig failed: %v", err)
+	}
+	openai := cfg.Providers["openai"]
+	if openai.APIKey != "sk-personal" {
+		t.Errorf("The user's key should survive the empty api_key of the env file, got %q", openai.APIKey)
+	}
+	if len(openai.Models) != 2 || openai.Models[0].Type != "custom" || len(openai.Models[0].Modes) != 1 || openai.Models[1].Name != "o3" {
+		t.Errorf("Expected the project's models merged with the env file's by name, got %+v", openai.Models)
+	}
+	if cfg.DefaultGenerationModel != "gpt-4o" || cfg.Project != "team" {
+		t.Errorf("Unexpected precedence: default model %q, project %q", cfg.DefaultGenerationModel, cfg.Project)
+	}
+	if openai.RateLimit == nil || openai.RateLimit.RequestsPerMinute != 10 {
+		t.Errorf("Expected the --set rate limit, got %+v", openai.RateLimit)
+	}
+	if err := SaveEnvConfig(envPath, cfg); err == nil {
+		t.Error("Saving a layered configuration should fail")
+	}
+
+	// A workflow layer goes below --set flags
+	workflow := map[string]interface{}{"project": "workflow", "default_generation_model": "o3"}
+	if err := ValidateWorkflowConfig(workflow); err != nil {
+		t.Fatalf("ValidateWorkflowConfig failed: %v", err)
+	}
+	withWorkflow, err := cfg.WithLayer(LayerWorkflow, "wf.yaml", workflow)
+	if err != nil {
+		t.Fatalf("WithLayer failed: %v", err)
+	}
+	if !withWorkflow.HasLayer(LayerWorkflow) || cfg.HasLayer(LayerWorkflow) {
+		t.Error("Expected the workflow layer on the copy only")
+	}
+	if withWorkflow.DefaultGenerationModel != "o3" || withWorkflow.Project != "team" {
+		t.Errorf("Expected the workflow below --set, got default model %q, project %q", withWorkflow.DefaultGenerationModel, withWorkflow.Project)
+	}
+	if cfg.DefaultGenerationModel != "gpt-4o" {
+		t.Error("WithLayer should not change the configuration")
+	}
+	var names []string
+	for _, layer := range withWorkflow.Layers() {
+		names = append(names, layer.Name)
+	}
+	if strings.Join(names, ",") != "user,project,env,workflow,cli" {
+		t.Errorf("Unexpected layer order %v", names)
+	}
+
+	explained := make(map[string]ValueSource)
+	for _, source := range withWorkflow.Explain() {
+		explained[source.Path] = source
+	}
+	if source := explained["providers.openai.api_key"]; source.Layer != LayerUser || source.Value != "env:TEST_PERSONAL_KEY" {
+		t.Errorf("Expected the key reference from the user layer, got %+v", source)
+	}
+	if source := explained["providers.openai.models.gpt-4o.type"]; source.Layer != LayerEnv || strings.Join(source.Overrides, ",") != "project" {
+		t.Errorf("Expected the model type from the env file over the project, got %+v", source)
+	}
+	if source := explained["project"]; source.Layer != LayerCLI || strings.Join(source.Overrides, ",") != "user,workflow" {
+		t.Errorf("Expected the project from --set over the user and the workflow, got %+v", source)
+	}
+
+	for _, invalid := range []map[string]interface{}{
+		{"providers": map[string]interface{}{"openai": map[string]interface{}{"api_key": "sk-leak"}}},
+		{"providers": map[string]interface{}{"ollama": map[string]interface{}{"endpoint": "http://attacker:11434"}}},
+		{"providers": map[string]interface{}{"litellm": map[string]interface{}{"base_url": "http://attacker/v1"}}},
+		{"providers": map[string]interface{}{"litellm": map[string]interface{}{"auth": "none"}}},
+		{"providers": map[string]interface{}{"litellm": map[string]interface{}{"tls": map[string]interface{}{"insecure_skip_verify": true}}}},
+		{"server": map[string]interface{}{"port": 9000}},
+		{"default_model": "o3"},
+	} {
+		if err := ValidateWorkflowConfig(invalid); err == nil {
+			t.Errorf("Expected %v to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// Key selection strategies for providers with several API keys
+const (
+	KeySelectionRoundRobin = "round-robin" // Use the keys in turn (default)
+	KeySelectionLeastUsed  = "least-used"  // Use the key with the fewest requests
+)
+
+// APIKey is one of several API keys of a provider, e.g. for different
+// organizations or projects
+type APIKey struct {
+	// Name identifies the key in usage counters and messages
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+	// Project scopes the key to workflows run for a project (cost center);
+	// keys without a project are used when no project is selected
+	Project string `yaml:"project,omitempty"`
+}
+
+// Keys returns the API keys of the provider: the api_keys list, or the single
+// api_key named "default"
+func (p *Provider) Keys() []APIKey {
+	if len(p.APIKeys) > 0 {
+		return p.APIKeys
+	}
+	if p.APIKey != "" {
+		return []APIKey{{Name: "default", Key: p.APIKey}}
+	}
+	return nil
+}
+
+// HasAPIKey reports whether the provider has at least one API key
+func (p *Provider) HasAPIKey() bool {
+	return len(p.Keys()) > 0
+}
+
+// ValidateKeys checks the api_keys list and the key selection strategy
+func (p *Provider) ValidateKeys() error {
+	switch p.KeySelection {
+	case "", KeySelectionRoundRobin, KeySelectionLeastUsed:
+	default:
+		return fmt.Errorf("invalid key_selection '%s' (must be %s or %s)", p.KeySelection, KeySelectionRoundRobin, KeySelectionLeastUsed)
+	}
+	names := make(map[string]bool)
+	for i, key := range p.APIKeys {
+		if key.Name == "" {
+			return fmt.Errorf("api_keys entry %d has no name", i+1)
+		}
+		if key.Key == "" {
+			return fmt.Errorf("api key %s has no key", key.Name)
+		}
+		if names[key.Name] {
+			return fmt.Errorf("duplicate api key name %s", key.Name)
+		}
+		names[key.Name] = true
+	}
+	return nil
+}
+
+// GetProject returns the project whose API keys workflows use: the
+// COMANDA_PROJECT environment variable, then the project setting in .env. The
+// empty project uses the keys without a project.
+func GetProject(envConfig *EnvConfig) string {
+	if project := os.Getenv("COMANDA_PROJECT"); project != "" {
+		return project
+	}
+	if envConfig != nil {
+		return envConfig.Project
+	}
+	return ""
+}
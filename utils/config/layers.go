@@ -0,0 +1,597 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration layers, from the lowest to the highest precedence
+const (
+	LayerUser     = "user"     // ~/.comanda/config.yaml
+	LayerProject  = "project"  // .comanda/config.yaml in the current or a parent directory
+	LayerEnv      = "env"      // The env file from COMANDA_ENV or ./.env
+	LayerWorkflow = "workflow" // The config: block of a workflow
+	LayerCLI      = "cli"      // --set flags
+)
+
+// ConfigDirName and ConfigFileName locate the user and project configuration
+// files, e.g. ~/.comanda/config.yaml
+const (
+	ConfigDirName  = ".comanda"
+	ConfigFileName = "config.yaml"
+)
+
+// Layer is one source of configuration
+type Layer struct {
+	Name  string
+	Path  string // File the layer was read from; empty for workflow and flag overrides
+	Found bool   // Whether the file exists
+	data  map[string]interface{}
+}
+
+// ValueSource records where an effective configuration value came from
+type ValueSource struct {
+	Path      string      // Dotted path, e.g. providers.openai.models.gpt-4o.type
+	Value     interface{} // Value as written in the layer; secrets are masked by Explain
+	Layer     string
+	File      string
+	Overrides []string // Lower layers whose value was replaced
+}
+
+// UserConfigPath returns the path of the user-level configuration file
+func UserConfigPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ConfigDirName, ConfigFileName)
+}
+
+// FindProjectConfig returns the project-level configuration file: the nearest
+// .comanda/config.yaml in the current directory or its parents (up to 5
+// levels), not counting the user-level file in the home directory. Returns an
+// empty string if there is none.
+func FindProjectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	userPath := UserConfigPath()
+	for i := 0; i <= 5; i++ {
+		path := filepath.Join(dir, ConfigDirName, ConfigFileName)
+		if path != userPath && fileExists(path) {
+			DebugLog("Found project configuration: %s", path)
+			return path
+		}
+		parentDir := filepath.Dir(dir)
+		if parentDir == dir {
+			break
+		}
+		dir = parentDir
+	}
+	return ""
+}
+
+// ParseOverrides turns --set flags of the form path=value into a layer, e.g.
+// default_generation_model=gpt-4o or providers.openai.rate_limit.requests_per_minute=10.
+// Values are parsed as YAML scalars.
+func ParseOverrides(sets []string) (map[string]interface{}, error) {
+	overrides := make(map[string]interface{})
+	for _, set := range sets {
+		path, raw, ok := strings.Cut(set, "=")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid --set '%s' (expected path=value)", set)
+		}
+		var value interface{}
+		if err := yaml.Unmarshal([]byte(raw), &value); err != nil || value == nil {
+			value = raw
+		}
+		keys := strings.Split(path, ".")
+		node := overrides
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := node[key].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[key] = child
+			}
+			node = child
+		}
+		node[keys[len(keys)-1]] = value
+	}
+	return overrides, nil
+}
+
+// ValidateWorkflowConfig checks the config: block of a workflow. Workflows may
+// override models, parameters, rate limits, aliases and similar settings, but
+// never contain secrets or server and database settings.
+func ValidateWorkflowConfig(data map[string]interface{}) error {
+	for _, key := range []string{"server", "databases", "encryption"} {
+		if _, ok := data[key]; ok {
+			return fmt.Errorf("workflow config cannot set %s", key)
+		}
+	}
+	for path := range flatten(data, "") {
+		if isSecretPath(path) {
+			return fmt.Errorf("workflow config cannot contain secrets (%s); keep them in the env file", path)
+		}
+	}
+	// Connection settings stay in the env file too, so that a workflow cannot
+	// send the credentials of a configured provider elsewhere
+	if providers, ok := data["providers"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(providers))
+		for name := range providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			settings, _ := providers[name].(map[string]interface{})
+			for _, key := range providerConnectionKeys {
+				if _, ok := settings[key]; ok {
+					return fmt.Errorf("workflow config cannot set providers.%s.%s; keep connection settings in the env file", name, key)
+				}
+			}
+		}
+	}
+	// Reject misspelled settings
+	encoded, err := yaml.Marshal(data)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(encoded))
+	decoder.KnownFields(true)
+	var check EnvConfig
+	if err := decoder.Decode(&check); err != nil {
+		return fmt.Errorf("invalid workflow config: %w", err)
+	}
+	return nil
+}
+
+// providerConnectionKeys are the provider settings that decide where requests
+// and credentials are sent
+var providerConnectionKeys = []string{"api_key", "base_url", "endpoint", "headers", "auth", "tls"}
+
+// isSecretPath reports whether a configuration path holds a secret
+func isSecretPath(path string) bool {
+	parts := strings.Split(path, ".")
+	last := parts[len(parts)-1]
+	switch {
+	case last == "api_key", last == "password", last == "bearerToken":
+		return true
+	case len(parts) >= 3 && parts[len(parts)-3] == "api_keys" && last == "key":
+		return true
+	case len(parts) >= 2 && parts[len(parts)-2] == "headers":
+		return true
+	}
+	return false
+}
+
+// readLayerFile reads a user or project configuration file. Only the env file
+// may be encrypted; other layers use secret references for secrets.
+func readLayerFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	if IsEncrypted(data) {
+		return nil, fmt.Errorf("config file %s is encrypted; only the env file may be encrypted", path)
+	}
+	var layer map[string]interface{}
+	if err := yaml.Unmarshal(data, &layer); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	if _, ok := layer["encryption"]; ok {
+		return nil, fmt.Errorf("config file %s has encrypted fields; only the env file may be encrypted", path)
+	}
+	return layer, nil
+}
+
+// readEnvLayer reads the env file as a layer, prompting for the password if it is encrypted
+func readEnvLayer(path string) (map[string]interface{}, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("error reading env file: %w", err)
+	}
+	if IsEncrypted(data) {
+		if IsLegacyEncrypted(data) {
+			log.Printf("Warning: %s uses the legacy encryption format; run 'comanda configure --rekey' to upgrade it\n", path)
+		}
+		password, err := PromptPassword("Enter decryption password: ")
+		if err != nil {
+			return nil, true, err
+		}
+		if data, err = DecryptConfig(data, password); err != nil {
+			return nil, true, err
+		}
+	}
+	var layer map[string]interface{}
+	if err := yaml.Unmarshal(data, &layer); err != nil {
+		return nil, true, fmt.Errorf("error parsing env file: %w", err)
+	}
+	return layer, true, nil
+}
+
+// LoadLayeredEnvConfig loads the configuration from all layers: the user file,
+// the project file, the env file at envPath and the overrides of --set flags,
+// each overriding the ones before. Without user and project files and
+// overrides, it is the env file as loaded by LoadEnvConfigWithPassword.
+//
+// A layered configuration cannot be saved; comanda configure edits the env file only.
+func LoadLayeredEnvConfig(envPath string, overrides map[string]interface{}) (*EnvConfig, error) {
+	userLayer := Layer{Name: LayerUser, Path: UserConfigPath()}
+	userLayer.Found = userLayer.Path != "" && fileExists(userLayer.Path)
+	projectLayer := Layer{Name: LayerProject, Path: FindProjectConfig()}
+	projectLayer.Found = projectLayer.Path != ""
+	envLayer := Layer{Name: LayerEnv, Path: envPath}
+
+	if !userLayer.Found && !projectLayer.Found && len(overrides) == 0 {
+		config, err := LoadEnvConfigWithPassword(envPath)
+		if err != nil {
+			return nil, err
+		}
+		envLayer.Found = fileExists(envPath)
+		config.layers = []Layer{userLayer, projectLayer, envLayer}
+		return config, nil
+	}
+
+	var err error
+	if userLayer.Found {
+		if userLayer.data, err = readLayerFile(userLayer.Path); err != nil {
+			return nil, err
+		}
+	}
+	if projectLayer.Found {
+		if projectLayer.data, err = readLayerFile(projectLayer.Path); err != nil {
+			return nil, err
+		}
+	}
+	if envLayer.data, envLayer.Found, err = readEnvLayer(envPath); err != nil {
+		return nil, err
+	}
+	layers := []Layer{userLayer, projectLayer, envLayer}
+	if len(overrides) > 0 {
+		layers = append(layers, Layer{Name: LayerCLI, Found: true, data: overrides})
+	}
+
+	merged := make(map[string]interface{})
+	sources := make(map[string]*ValueSource)
+	for _, layer := range layers {
+		if layer.data != nil {
+			mergeLayer(merged, layer.data, "", layer, sources)
+		}
+	}
+
+	config, err := decodeLayers(merged)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.ResolveSecrets(); err != nil {
+		return nil, err
+	}
+	if config.Encryption != nil {
+		config.fieldKeys = &fieldKeys{}
+		config.promptSecretsPassword()
+	}
+	config.layers = layers
+	config.sources = sources
+	config.layered = true
+	DebugLog("Loaded layered configuration from %d layers", len(layers))
+	return config, nil
+}
+
+// WithLayer returns a copy of the configuration with a layer on top, such as
+// the config: block of a workflow. The configuration itself is unchanged.
+func (c *EnvConfig) WithLayer(name, file string, data map[string]interface{}) (*EnvConfig, error) {
+	if c.fieldKeys != nil {
+		c.fieldKeys.mu.Lock()
+	}
+	encoded, err := yaml.Marshal(c)
+	if c.fieldKeys != nil {
+		c.fieldKeys.mu.Unlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var merged map[string]interface{}
+	if err := yaml.Unmarshal(encoded, &merged); err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]*ValueSource)
+	for path, source := range c.valueSources() {
+		copied := *source
+		sources[path] = &copied
+	}
+	layer := Layer{Name: name, Path: file, Found: true, data: data}
+	mergeLayer(merged, data, "", layer, sources)
+
+	// Layers of higher precedence, such as --set flags over a workflow, are applied again on top
+	layers := make([]Layer, 0, len(c.layers)+1)
+	var higher []Layer
+	for _, existing := range c.layers {
+		if layerRank(existing.Name) > layerRank(name) {
+			higher = append(higher, existing)
+			if existing.data != nil {
+				mergeLayer(merged, existing.data, "", existing, sources)
+			}
+			continue
+		}
+		layers = append(layers, existing)
+	}
+	layers = append(append(layers, layer), higher...)
+
+	config, err := decodeLayers(merged)
+	if err != nil {
+		return nil, err
+	}
+	// Secrets are already resolved; sealed ones share the key of this configuration
+	config.fieldKeys = c.fieldKeys
+	config.layers = layers
+	config.sources = sources
+	config.layered = true
+	return config, nil
+}
+
+// layerRank orders the layers by precedence
+func layerRank(name string) int {
+	for i, layer := range []string{LayerUser, LayerProject, LayerEnv, LayerWorkflow, LayerCLI} {
+		if layer == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// decodeLayers decodes merged layers into a configuration
+func decodeLayers(merged map[string]interface{}) (*EnvConfig, error) {
+	encoded, err := yaml.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	var config EnvConfig
+	if err := yaml.Unmarshal(encoded, &config); err != nil {
+		return nil, fmt.Errorf("error parsing merged configuration: %w", err)
+	}
+	if config.Databases == nil {
+		config.Databases = make(map[string]DatabaseConfig)
+	}
+	return &config, nil
+}
+
+// Layers returns the configuration layers, from the lowest to the highest
+// precedence, including the files that were not found
+func (c *EnvConfig) Layers() []Layer {
+	return c.layers
+}
+
+// Layered reports whether the configuration is merged from several layers, in
+// which case it cannot be saved
+func (c *EnvConfig) Layered() bool {
+	return c.layered
+}
+
+// HasLayer reports whether the configuration includes a layer with the given name
+func (c *EnvConfig) HasLayer(name string) bool {
+	for _, layer := range c.layers {
+		if layer.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// valueSources returns the source of every value; a configuration loaded from
+// the env file alone has all of its values from there
+func (c *EnvConfig) valueSources() map[string]*ValueSource {
+	if c.sources != nil {
+		return c.sources
+	}
+	sources := make(map[string]*ValueSource)
+	encoded, err := c.marshalYAML()
+	if err != nil {
+		return sources
+	}
+	var data map[string]interface{}
+	if err := yaml.Unmarshal(encoded, &data); err != nil {
+		return sources
+	}
+	envLayer := Layer{Name: LayerEnv, Path: GetEnvPath()}
+	for _, layer := range c.layers {
+		if layer.Name == LayerEnv {
+			envLayer = layer
+		}
+	}
+	recordLayer(data, "", envLayer, sources)
+	return sources
+}
+
+// Explain returns where each effective value came from, sorted by path.
+// Secrets are masked unless they are references or encrypted.
+func (c *EnvConfig) Explain() []ValueSource {
+	var explained []ValueSource
+	for _, source := range c.valueSources() {
+		if isEmptyValue(source.Value) {
+			continue
+		}
+		entry := *source
+		if value, ok := entry.Value.(string); ok && isSecretPath(entry.Path) && !IsSecretRef(value) && !IsSealed(value) {
+			entry.Value = "********"
+		}
+		explained = append(explained, entry)
+	}
+	sort.Slice(explained, func(i, j int) bool { return explained[i].Path < explained[j].Path })
+	return explained
+}
+
+// mergeLayer merges a layer into merged and records the sources of its values.
+// Mappings are merged key by key and lists of named entries (models, api_keys)
+// entry by entry; other values replace the lower layers' values. Empty values
+// do not override, so that an env file with api_key: "" keeps the user's key.
+func mergeLayer(merged, data map[string]interface{}, prefix string, layer Layer, sources map[string]*ValueSource) {
+	for key, value := range data {
+		if isEmptyValue(value) {
+			continue
+		}
+		path := joinPath(prefix, key)
+		existing, exists := merged[key]
+		if valueMap, ok := value.(map[string]interface{}); ok && exists {
+			if existingMap, ok := existing.(map[string]interface{}); ok {
+				mergeLayer(existingMap, valueMap, path, layer, sources)
+				continue
+			}
+		}
+		if entries, ok := namedEntries(value); ok && exists {
+			if existingEntries, ok := namedEntries(existing); ok {
+				merged[key] = mergeNamedEntries(existingEntries, entries, path, layer, sources)
+				continue
+			}
+		}
+		// Replace the value and everything below it
+		for sourcePath := range sources {
+			if strings.HasPrefix(sourcePath, path+".") {
+				delete(sources, sourcePath)
+			}
+		}
+		merged[key] = deepCopy(value)
+		recordLayer(value, path, layer, sources)
+	}
+}
+
+// mergeNamedEntries merges lists of mappings identified by their name
+func mergeNamedEntries(existing, entries []map[string]interface{}, path string, layer Layer, sources map[string]*ValueSource) []interface{} {
+	byName := make(map[string]map[string]interface{}, len(existing))
+	result := make([]interface{}, 0, len(existing)+len(entries))
+	for _, entry := range existing {
+		byName[entry["name"].(string)] = entry
+		result = append(result, entry)
+	}
+	for _, entry := range entries {
+		name := entry["name"].(string)
+		if current, ok := byName[name]; ok {
+			mergeLayer(current, withoutName(entry), joinPath(path, name), layer, sources)
+			continue
+		}
+		copied := deepCopy(entry).(map[string]interface{})
+		result = append(result, copied)
+		recordLayer(entry, joinPath(path, name), layer, sources)
+	}
+	return result
+}
+
+// recordLayer records a layer as the source of every value below path
+func recordLayer(value interface{}, path string, layer Layer, sources map[string]*ValueSource) {
+	if valueMap, ok := value.(map[string]interface{}); ok {
+		for key, child := range valueMap {
+			recordLayer(child, joinPath(path, key), layer, sources)
+		}
+		return
+	}
+	if entries, ok := namedEntries(value); ok {
+		for _, entry := range entries {
+			recordLayer(withoutName(entry), joinPath(path, entry["name"].(string)), layer, sources)
+		}
+		return
+	}
+	source := &ValueSource{Path: path, Value: value, Layer: layer.Name, File: layer.Path}
+	if previous, ok := sources[path]; ok {
+		for _, overridden := range append(previous.Overrides, previous.Layer) {
+			if overridden != layer.Name {
+				source.Overrides = append(source.Overrides, overridden)
+			}
+		}
+	}
+	sources[path] = source
+}
+
+// withoutName returns a named entry without its name, which identifies the
+// entry in paths rather than being a value of its own
+func withoutName(entry map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{}, len(entry))
+	for key, value := range entry {
+		if key != "name" {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// flatten returns the values of a layer by path
+func flatten(data map[string]interface{}, prefix string) map[string]interface{} {
+	sources := make(map[string]*ValueSource)
+	recordLayer(data, prefix, Layer{}, sources)
+	values := make(map[string]interface{}, len(sources))
+	for path, source := range sources {
+		values[path] = source.Value
+	}
+	return values
+}
+
+// namedEntries returns a list of mappings that all have a name, such as models
+func namedEntries(value interface{}) ([]map[string]interface{}, bool) {
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, false
+	}
+	entries := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if name, ok := entry["name"].(string); !ok || name == "" {
+			return nil, false
+		}
+		entries = append(entries, entry)
+	}
+	return entries, true
+}
+
+// isEmptyValue reports whether a layer value is unset
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// deepCopy copies the maps and lists of a layer value
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			copied[key] = deepCopy(child)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, child := range v {
+			copied[i] = deepCopy(child)
+		}
+		return copied
+	}
+	return value
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -81,6 +81,19 @@ func GetMemoryPath(envConfig *EnvConfig) string {
 	return ""
 }
 
+// GetMemoryNamespace returns the memory namespace to use: the
+// COMANDA_MEMORY_NAMESPACE environment variable, then the memory_namespace
+// setting in .env. The empty namespace is the main memory document.
+func GetMemoryNamespace(envConfig *EnvConfig) string {
+	if namespace := os.Getenv("COMANDA_MEMORY_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	if envConfig != nil {
+		return envConfig.MemoryNamespace
+	}
+	return ""
+}
+
 // fileExists checks if a file exists at the given path
 func fileExists(path string) bool {
 	info, err := os.Stat(path)
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+)
+
+// Generation parameter names, as written in params blocks
+const (
+	ParamTemperature     = "temperature"
+	ParamTopP            = "top_p"
+	ParamMaxTokens       = "max_tokens"
+	ParamStop            = "stop"
+	ParamSeed            = "seed"
+	ParamReasoningEffort = "reasoning_effort"
+	ParamThinkingBudget  = "thinking_budget"
+)
+
+// ModelParams are generation parameters for a model call. They are set per step
+// with a params block and per model in the environment configuration; unset
+// fields keep the provider's defaults.
+type ModelParams struct {
+	Temperature     *float64 `yaml:"temperature,omitempty" json:"temperature,omitempty"`
+	TopP            *float64 `yaml:"top_p,omitempty" json:"top_p,omitempty"`
+	MaxTokens       *int     `yaml:"max_tokens,omitempty" json:"max_tokens,omitempty"`
+	Stop            []string `yaml:"stop,omitempty" json:"stop,omitempty"`
+	Seed            *int     `yaml:"seed,omitempty" json:"seed,omitempty"`
+	ReasoningEffort string   `yaml:"reasoning_effort,omitempty" json:"reasoning_effort,omitempty"` // minimal, low, medium or high
+	ThinkingBudget  *int     `yaml:"thinking_budget,omitempty" json:"thinking_budget,omitempty"`   // Tokens for extended thinking
+}
+
+// Names returns the names of the parameters that are set
+func (p ModelParams) Names() []string {
+	var names []string
+	if p.Temperature != nil {
+		names = append(names, ParamTemperature)
+	}
+	if p.TopP != nil {
+		names = append(names, ParamTopP)
+	}
+	if p.MaxTokens != nil {
+		names = append(names, ParamMaxTokens)
+	}
+	if len(p.Stop) > 0 {
+		names = append(names, ParamStop)
+	}
+	if p.Seed != nil {
+		names = append(names, ParamSeed)
+	}
+	if p.ReasoningEffort != "" {
+		names = append(names, ParamReasoningEffort)
+	}
+	if p.ThinkingBudget != nil {
+		names = append(names, ParamThinkingBudget)
+	}
+	return names
+}
+
+// IsZero reports whether no parameter is set
+func (p ModelParams) IsZero() bool {
+	return len(p.Names()) == 0
+}
+
+// Merge returns the parameters with the ones set in override taking precedence
+func (p ModelParams) Merge(override ModelParams) ModelParams {
+	merged := p
+	if override.Temperature != nil {
+		merged.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		merged.TopP = override.TopP
+	}
+	if override.MaxTokens != nil {
+		merged.MaxTokens = override.MaxTokens
+	}
+	if len(override.Stop) > 0 {
+		merged.Stop = override.Stop
+	}
+	if override.Seed != nil {
+		merged.Seed = override.Seed
+	}
+	if override.ReasoningEffort != "" {
+		merged.ReasoningEffort = override.ReasoningEffort
+	}
+	if override.ThinkingBudget != nil {
+		merged.ThinkingBudget = override.ThinkingBudget
+	}
+	return merged
+}
+
+// Validate checks that the parameters are within the ranges all providers accept
+func (p ModelParams) Validate() error {
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2, got %g", *p.Temperature)
+	}
+	if p.TopP != nil && (*p.TopP < 0 || *p.TopP > 1) {
+		return fmt.Errorf("top_p must be between 0 and 1, got %g", *p.TopP)
+	}
+	if p.MaxTokens != nil && *p.MaxTokens < 1 {
+		return fmt.Errorf("max_tokens must be positive, got %d", *p.MaxTokens)
+	}
+	switch p.ReasoningEffort {
+	case "", "minimal", "low", "medium", "high":
+	default:
+		return fmt.Errorf("reasoning_effort must be minimal, low, medium or high, got %q", p.ReasoningEffort)
+	}
+	if p.ThinkingBudget != nil && *p.ThinkingBudget < 0 {
+		return fmt.Errorf("thinking_budget must not be negative, got %d", *p.ThinkingBudget)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+)
+
+// RateLimit caps the rate of requests sent to a provider or model. A limit set
+// on a provider is shared by all of its models; a limit set on a model applies
+// to that model alone. Zero fields are unlimited.
+type RateLimit struct {
+	RequestsPerMinute int `yaml:"requests_per_minute,omitempty" json:"requests_per_minute,omitempty"`
+	TokensPerMinute   int `yaml:"tokens_per_minute,omitempty" json:"tokens_per_minute,omitempty"` // Estimated prompt and response tokens
+}
+
+// IsZero reports whether no limit is set
+func (r RateLimit) IsZero() bool {
+	return r.RequestsPerMinute == 0 && r.TokensPerMinute == 0
+}
+
+// Validate checks that the limits are not negative
+func (r RateLimit) Validate() error {
+	if r.RequestsPerMinute < 0 {
+		return fmt.Errorf("requests_per_minute must not be negative, got %d", r.RequestsPerMinute)
+	}
+	if r.TokensPerMinute < 0 {
+		return fmt.Errorf("tokens_per_minute must not be negative, got %d", r.TokensPerMinute)
+	}
+	return nil
+}
+
+// GetRateLimits returns the rate limits that apply to a model of a provider,
+// keyed by the scope they are shared in: the provider name for provider limits
+// and "provider/model" for model limits
+func (c *EnvConfig) GetRateLimits(providerName, modelName string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit)
+	provider, err := c.GetProviderConfig(providerName)
+	if err != nil {
+		return limits, nil
+	}
+	if provider.RateLimit != nil && !provider.RateLimit.IsZero() {
+		if err := provider.RateLimit.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid rate_limit for provider %s: %w", providerName, err)
+		}
+		limits[providerName] = *provider.RateLimit
+	}
+	if model, err := c.GetModelConfig(providerName, modelName); err == nil && model.RateLimit != nil && !model.RateLimit.IsZero() {
+		if err := model.RateLimit.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid rate_limit for model %s/%s: %w", providerName, model.Name, err)
+		}
+		limits[providerName+"/"+model.Name] = *model.RateLimit
+	}
+	return limits, nil
+}
@@ -0,0 +1,371 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SealedPrefix marks a secret field encrypted in place, e.g.
+// api_key: enc:3q2+7w...; the rest of the env file stays plain text
+const SealedPrefix = "enc:"
+
+// sealCheck is sealed into the encryption block to detect a wrong password
+const sealCheck = "comanda"
+
+// sealCheckPath is the field path the check value is sealed for
+const sealCheckPath = "encryption.check"
+
+// ErrSealedSecret is returned when an encrypted secret field cannot be decrypted
+var ErrSealedSecret = errors.New("cannot decrypt encrypted secret")
+
+// FieldEncryption is the encryption block of an env file whose secret fields
+// are encrypted individually. It holds the key derivation settings shared by
+// all sealed fields.
+type FieldEncryption struct {
+	KDF     string `yaml:"kdf"`
+	Salt    string `yaml:"salt"`
+	Time    uint32 `yaml:"time,omitempty"`
+	Memory  uint32 `yaml:"memory,omitempty"`
+	Threads uint8  `yaml:"threads,omitempty"`
+	N       int    `yaml:"n,omitempty"`
+	R       int    `yaml:"r,omitempty"`
+	P       int    `yaml:"p,omitempty"`
+	Check   string `yaml:"check"` // A sealed known value, to detect a wrong password
+}
+
+// fieldKeys holds the key of sealed fields once the password is known. The
+// mutex also guards decrypting fields in place, which happens on first use.
+type fieldKeys struct {
+	mu       sync.Mutex
+	password func() (string, error)
+	key      []byte
+}
+
+// IsSealed reports whether a value is an encrypted secret field
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, SealedPrefix)
+}
+
+// IsFieldEncrypted reports whether env file content has individually
+// encrypted secret fields
+func IsFieldEncrypted(data []byte) bool {
+	if IsEncrypted(data) {
+		return false
+	}
+	var probe struct {
+		Encryption *FieldEncryption `yaml:"encryption"`
+	}
+	return yaml.Unmarshal(data, &probe) == nil && probe.Encryption != nil
+}
+
+// newFieldEncryption returns an encryption block for a password with a fresh
+// salt, and the key it derives
+func newFieldEncryption(password string) (*FieldEncryption, []byte, error) {
+	header, err := newEnvelopeHeader()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := header.deriveKey(password)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc := &FieldEncryption{
+		KDF:     header.KDF,
+		Salt:    base64.StdEncoding.EncodeToString(header.Salt),
+		Time:    header.Time,
+		Memory:  header.Memory,
+		Threads: header.Threads,
+	}
+	if enc.Check, err = sealValue(key, sealCheckPath, sealCheck); err != nil {
+		return nil, nil, err
+	}
+	return enc, key, nil
+}
+
+// deriveKey returns the key of the encryption block for a password, checking
+// that the password is the one the fields were sealed with
+func (e *FieldEncryption) deriveKey(password string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(e.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption salt: %w", err)
+	}
+	header := envelopeHeader{KDF: e.KDF, Salt: salt, Time: e.Time, Memory: e.Memory, Threads: e.Threads, N: e.N, R: e.R, P: e.P}
+	key, err := header.deriveKey(password)
+	if err != nil {
+		return nil, err
+	}
+	if check, err := openValue(key, sealCheckPath, e.Check); err != nil || check != sealCheck {
+		return nil, fmt.Errorf("wrong password for encrypted secrets")
+	}
+	return key, nil
+}
+
+// sealValue encrypts a secret field value. The field path is authenticated with
+// it, so that a sealed value cannot be moved to another field.
+func sealValue(key []byte, path string, value string) (string, error) {
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("error generating nonce: %w", err)
+	}
+	return SealedPrefix + base64.StdEncoding.EncodeToString(aesgcm.Seal(nonce, nonce, []byte(value), []byte(path))), nil
+}
+
+// openValue decrypts the sealed value of the secret field with the given path
+func openValue(key []byte, path string, sealed string) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, SealedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("error decoding base64: %w", err)
+	}
+	if len(encrypted) < nonceSize {
+		return "", fmt.Errorf("invalid encrypted data")
+	}
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := aesgcm.Open(nil, encrypted[:nonceSize], encrypted[nonceSize:], []byte(path))
+	if err != nil {
+		return "", fmt.Errorf("error decrypting data: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// SetSecretsPassword sets the password of the encrypted secret fields
+func (c *EnvConfig) SetSecretsPassword(password string) {
+	c.setPasswordSource(func() (string, error) { return password, nil })
+}
+
+// promptSecretsPassword asks for the password of the encrypted secret fields
+// when the first of them is needed
+func (c *EnvConfig) promptSecretsPassword() {
+	c.setPasswordSource(func() (string, error) {
+		return PromptPassword("Enter password for encrypted secrets: ")
+	})
+}
+
+func (c *EnvConfig) setPasswordSource(source func() (string, error)) {
+	if c.fieldKeys == nil {
+		c.fieldKeys = &fieldKeys{}
+	}
+	c.fieldKeys.password = source
+}
+
+// fieldKey returns the key of the sealed fields, asking for the password the
+// first time. The caller holds fieldKeys.mu.
+func (c *EnvConfig) fieldKey() ([]byte, error) {
+	if c.fieldKeys.key != nil {
+		return c.fieldKeys.key, nil
+	}
+	if c.fieldKeys.password == nil {
+		return nil, fmt.Errorf("password required for encrypted secrets")
+	}
+	password, err := c.fieldKeys.password()
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.Encryption.deriveKey(password)
+	if err != nil {
+		return nil, err
+	}
+	c.fieldKeys.key = key
+	return key, nil
+}
+
+// UnlockSecrets asks for the password of the encrypted secret fields, if any,
+// without decrypting them, so that long-running processes such as the server
+// do not ask on first use
+func (c *EnvConfig) UnlockSecrets() error {
+	if c.Encryption == nil {
+		return nil
+	}
+	if c.fieldKeys == nil {
+		c.fieldKeys = &fieldKeys{}
+	}
+	c.fieldKeys.mu.Lock()
+	defer c.fieldKeys.mu.Unlock()
+	if _, err := c.fieldKey(); err != nil {
+		return fmt.Errorf("%w: %v", ErrSealedSecret, err)
+	}
+	return nil
+}
+
+// inScope reports whether a secret field path is within a scope such as
+// "providers.openai"; the empty scope covers every field
+func inScope(path, scope string) bool {
+	return scope == "" || path == scope || strings.HasPrefix(path, scope+".")
+}
+
+// Unseal decrypts the encrypted secret fields within a scope, such as
+// "providers.openai", "databases.main" or "server", asking for the password
+// the first time a secret is needed. The sealed values are kept and written
+// back by SaveEnvConfig as long as the secret is not changed.
+func (c *EnvConfig) Unseal(scope string) error {
+	if c.Encryption == nil {
+		return nil
+	}
+	if c.fieldKeys == nil {
+		c.fieldKeys = &fieldKeys{}
+	}
+	c.fieldKeys.mu.Lock()
+	defer c.fieldKeys.mu.Unlock()
+
+	for _, field := range c.secretFields() {
+		value := field.get()
+		if !IsSealed(value) || !inScope(field.path, scope) {
+			continue
+		}
+		key, err := c.fieldKey()
+		if err != nil {
+			return fmt.Errorf("%w %s: %v", ErrSealedSecret, field.path, err)
+		}
+		secret, err := openValue(key, field.path, value)
+		if err != nil {
+			return fmt.Errorf("%w %s: %v", ErrSealedSecret, field.path, err)
+		}
+		field.set(secret)
+		if c.secretRefs == nil {
+			c.secretRefs = make(map[string]secretRef)
+		}
+		c.secretRefs[field.path] = secretRef{ref: value, resolved: secret}
+		DebugLog("Decrypted secret %s", field.path)
+	}
+	return nil
+}
+
+// sealFields encrypts the secret fields holding plain secrets; empty values,
+// secret references and sealed values are left as they are
+func (c *EnvConfig) sealFields(key []byte) error {
+	for _, field := range c.secretFields() {
+		value := field.get()
+		if value == "" || IsSecretRef(value) || IsSealed(value) {
+			continue
+		}
+		sealed, err := sealValue(key, field.path, value)
+		if err != nil {
+			return err
+		}
+		field.set(sealed)
+	}
+	return nil
+}
+
+// openFields decrypts every sealed secret field
+func (c *EnvConfig) openFields(key []byte) error {
+	for _, field := range c.secretFields() {
+		if value := field.get(); IsSealed(value) {
+			secret, err := openValue(key, field.path, value)
+			if err != nil {
+				return fmt.Errorf("%w %s: %v", ErrSealedSecret, field.path, err)
+			}
+			field.set(secret)
+		}
+	}
+	return nil
+}
+
+// readPlainEnvFile parses an env file that is not encrypted as a whole,
+// without resolving secret references
+func readPlainEnvFile(path string) (*EnvConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+	if IsEncrypted(data) {
+		return nil, fmt.Errorf("configuration is encrypted as a whole; decrypt it first")
+	}
+	var config EnvConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing env file: %w", err)
+	}
+	return &config, nil
+}
+
+// writePlainEnvFile writes a parsed env file back
+func writePlainEnvFile(path string, config *EnvConfig) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("error marshaling env config: %w", err)
+	}
+	if err := WriteConfigFile(path, data); err != nil {
+		return fmt.Errorf("error writing env file: %w", err)
+	}
+	return nil
+}
+
+// EncryptConfigFields encrypts the secret fields of the configuration file (API
+// keys, provider headers, database passwords and the server bearer token) and
+// leaves the rest of it in plain text
+func EncryptConfigFields(path string, password string) error {
+	config, err := readPlainEnvFile(path)
+	if err != nil {
+		return err
+	}
+	if config.Encryption != nil {
+		return fmt.Errorf("configuration fields are already encrypted; use --rekey to change the password")
+	}
+	enc, key, err := newFieldEncryption(password)
+	if err != nil {
+		return err
+	}
+	config.Encryption = enc
+	if err := config.sealFields(key); err != nil {
+		return err
+	}
+	return writePlainEnvFile(path, config)
+}
+
+// DecryptConfigFields decrypts the encrypted secret fields of the configuration file
+func DecryptConfigFields(path string, password string) error {
+	config, err := readPlainEnvFile(path)
+	if err != nil {
+		return err
+	}
+	if config.Encryption == nil {
+		return fmt.Errorf("configuration fields are not encrypted")
+	}
+	key, err := config.Encryption.deriveKey(password)
+	if err != nil {
+		return err
+	}
+	if err := config.openFields(key); err != nil {
+		return err
+	}
+	config.Encryption = nil
+	return writePlainEnvFile(path, config)
+}
+
+// rekeyConfigFields re-encrypts the secret fields of the configuration file with a new password
+func rekeyConfigFields(path string, oldPassword string, newPassword string) error {
+	config, err := readPlainEnvFile(path)
+	if err != nil {
+		return err
+	}
+	oldKey, err := config.Encryption.deriveKey(oldPassword)
+	if err != nil {
+		return err
+	}
+	if err := config.openFields(oldKey); err != nil {
+		return err
+	}
+	enc, newKey, err := newFieldEncryption(newPassword)
+	if err != nil {
+		return err
+	}
+	config.Encryption = enc
+	if err := config.sealFields(newKey); err != nil {
+		return err
+	}
+	return writePlainEnvFile(path, config)
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Prefixes of secret references, which fetch a secret when the configuration
+// is loaded instead of storing it in the env file
+const (
+	SecretEnvPrefix  = "env:"  // env:OPENAI_API_KEY reads an environment variable
+	SecretFilePrefix = "file:" // file:/run/secrets/openai reads a file
+	SecretCmdPrefix  = "cmd:"  // cmd:pass show openai runs a command and reads its output
+)
+
+// secretCmdTimeout bounds how long a cmd: reference may run
+const secretCmdTimeout = 30 * time.Second
+
+// secretRef remembers the reference a secret field was resolved from, so that
+// saving the configuration writes the reference rather than the secret
+type secretRef struct {
+	ref      string
+	resolved string
+}
+
+// secretField is a field of the configuration that may hold a secret
+type secretField struct {
+	path string
+	get  func() string
+	set  func(string)
+}
+
+// ErrSecretRefNotAllowed is returned when a secret reference is set through
+// an API rather than written into the configuration file by hand, since
+// resolving it runs a command or reads a file on the host
+var ErrSecretRefNotAllowed = errors.New("secret references (env:, file:, cmd:) can only be written into the configuration file")
+
+// IsSecretRef reports whether a value is a secret reference
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretEnvPrefix) ||
+		strings.HasPrefix(value, SecretFilePrefix) ||
+		strings.HasPrefix(value, SecretCmdPrefix)
+}
+
+// ResolveSecret returns the secret a reference points to, or the value itself
+// when it is not a reference
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretEnvPrefix):
+		name := strings.TrimPrefix(value, SecretEnvPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok || secret == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, SecretFilePrefix):
+		path := strings.TrimPrefix(value, SecretFilePrefix)
+		if strings.HasPrefix(path, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, path[2:])
+			}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("error reading secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(value, SecretCmdPrefix):
+		return runSecretCommand(strings.TrimPrefix(value, SecretCmdPrefix))
+	}
+	return value, nil
+}
+
+// runSecretCommand runs a command with the shell and returns its output
+// without the trailing newline
+func runSecretCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCmdTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("secret command failed: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("secret command failed: %w", err)
+	}
+	secret := strings.TrimRight(string(output), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("secret command printed nothing")
+	}
+	return secret, nil
+}
+
+// secretFields returns the fields of the configuration that may hold secrets:
+// API keys, provider headers, database passwords and the server bearer token
+func (c *EnvConfig) secretFields() []secretField {
+	var fields []secretField
+
+	providerNames := make([]string, 0, len(c.Providers))
+	for name := range c.Providers {
+		providerNames = append(providerNames, name)
+	}
+	sort.Strings(providerNames)
+	for _, name := range providerNames {
+		provider := c.Providers[name]
+		if provider == nil {
+			continue
+		}
+		fields = append(fields, secretField{
+			path: fmt.Sprintf("providers.%s.api_key", name),
+			get:  func() string { return provider.APIKey },
+			set:  func(v string) { provider.APIKey = v },
+		})
+		for i := range provider.APIKeys {
+			key := &provider.APIKeys[i]
+			fields = append(fields, secretField{
+				path: fmt.Sprintf("providers.%s.api_keys.%s.key", name, key.Name),
+				get:  func() string { return key.Key },
+				set:  func(v string) { key.Key = v },
+			})
+		}
+		headers := make([]string, 0, len(provider.Headers))
+		for header := range provider.Headers {
+			headers = append(headers, header)
+		}
+		sort.Strings(headers)
+		for _, header := range headers {
+			fields = append(fields, secretField{
+				path: fmt.Sprintf("providers.%s.headers.%s", name, header),
+				get:  func() string { return provider.Headers[header] },
+				set:  func(v string) { provider.Headers[header] = v },
+			})
+		}
+	}
+
+	dbNames := make([]string, 0, len(c.Databases))
+	for name := range c.Databases {
+		dbNames = append(dbNames, name)
+	}
+	sort.Strings(dbNames)
+	for _, name := range dbNames {
+		fields = append(fields, secretField{
+			path: fmt.Sprintf("databases.%s.password", name),
+			get:  func() string { return c.Databases[name].Password },
+			set: func(v string) {
+				db := c.Databases[name]
+				db.Password = v
+				c.Databases[name] = db
+			},
+		})
+	}
+
+	if c.Server != nil {
+		server := c.Server
+		fields = append(fields, secretField{
+			path: "server.bearerToken",
+			get:  func() string { return server.BearerToken },
+			set:  func(v string) { server.BearerToken = v },
+		})
+	}
+	return fields
+}
+
+// ResolveSecrets replaces the secret references in the configuration with the
+// secrets they point to. The references are kept and written back by
+// SaveEnvConfig as long as the secret is not changed.
+func (c *EnvConfig) ResolveSecrets() error {
+	for _, field := range c.secretFields() {
+		value := field.get()
+		if !IsSecretRef(value) {
+			continue
+		}
+		secret, err := ResolveSecret(value)
+		if err != nil {
+			return fmt.Errorf("error resolving secret %s (%s): %w", field.path, value, err)
+		}
+		field.set(secret)
+		if c.secretRefs == nil {
+			c.secretRefs = make(map[string]secretRef)
+		}
+		c.secretRefs[field.path] = secretRef{ref: value, resolved: secret}
+		DebugLog("Resolved secret %s from %s", field.path, strings.SplitN(value, ":", 2)[0])
+	}
+	return nil
+}
+
+// marshalYAML marshals the configuration with the secret references and
+// sealed values it was loaded with in place of the resolved secrets. When the
+// secret fields are encrypted, new secrets are encrypted too.
+func (c *EnvConfig) marshalYAML() ([]byte, error) {
+	if c.fieldKeys != nil {
+		c.fieldKeys.mu.Lock()
+		defer c.fieldKeys.mu.Unlock()
+	}
+	if len(c.secretRefs) == 0 && c.Encryption == nil {
+		return yaml.Marshal(c)
+	}
+
+	// Restore the references on a copy; the loaded configuration keeps its secrets
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var saved EnvConfig
+	if err := yaml.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	for _, field := range saved.secretFields() {
+		if ref, ok := c.secretRefs[field.path]; ok && field.get() == ref.resolved {
+			field.set(ref.ref)
+		}
+	}
+	if c.Encryption != nil {
+		if c.fieldKeys == nil {
+			c.fieldKeys = &fieldKeys{}
+		}
+		var key []byte
+		for _, field := range saved.secretFields() {
+			if value := field.get(); value == "" || IsSecretRef(value) || IsSealed(value) {
+				continue
+			}
+			if key == nil {
+				if key, err = c.fieldKey(); err != nil {
+					return nil, fmt.Errorf("cannot encrypt new secret %s: %w", field.path, err)
+				}
+			}
+			sealed, err := sealValue(key, field.path, field.get())
+			if err != nil {
+				return nil, err
+			}
+			field.set(sealed)
+		}
+	}
+	return yaml.Marshal(&saved)
+}
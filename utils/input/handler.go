@@ -27,6 +27,8 @@ const (
 	WebScrapeInput
 	SourceCodeInput
 	StdinInput // Added StdinInput type
+	AudioInput
+	VideoInput
 )
 
 // ScrapeConfig represents the configuration for web scraping
@@ -119,6 +121,16 @@ func (h *Handler) getMimeType(path string) string {
 	case ".bmp":
 		return "image/bmp"
 
+	// Audio and video
+	case ".mp3":
+		return "audio/mpeg"
+	case ".wav":
+		return "audio/wav"
+	case ".m4a":
+		return "audio/mp4"
+	case ".mp4":
+		return "video/mp4"
+
 	// Source code files
 	case ".go":
 		return "text/x-go"
@@ -207,6 +219,26 @@ func (h *Handler) isImageFile(path string) bool {
 	return imageExts[ext]
 }
 
+// isAudioFile checks if the file is an audio recording based on extension
+func (h *Handler) isAudioFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	audioExts := map[string]bool{
+		".mp3": true,
+		".wav": true,
+		".m4a": true,
+	}
+	return audioExts[ext]
+}
+
+// isVideoFile checks if the file is a video recording based on extension
+func (h *Handler) isVideoFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	videoExts := map[string]bool{
+		".mp4": true,
+	}
+	return videoExts[ext]
+}
+
 // ProcessPath handles both file and directory inputs
 func (h *Handler) ProcessPath(path string) error {
 	if path == "screenshot" {
@@ -231,6 +263,14 @@ func (h *Handler) ProcessPath(path string) error {
 		return h.processImage(path)
 	}
 
+	if h.isAudioFile(path) {
+		return h.processMedia(path, AudioInput)
+	}
+
+	if h.isVideoFile(path) {
+		return h.processMedia(path, VideoInput)
+	}
+
 	if h.isSourceCode(path) {
 		return h.processSourceCode(path)
 	}
@@ -277,6 +317,14 @@ func (h *Handler) processWildcard(pattern string) error {
 			if err := h.processImage(match); err != nil {
 				return err
 			}
+		} else if h.isAudioFile(match) {
+			if err := h.processMedia(match, AudioInput); err != nil {
+				return err
+			}
+		} else if h.isVideoFile(match) {
+			if err := h.processMedia(match, VideoInput); err != nil {
+				return err
+			}
 		} else if h.isSourceCode(match) {
 			if err := h.processSourceCode(match); err != nil {
 				return err
@@ -350,6 +398,22 @@ func (h *Handler) processSourceCode(path string) error {
 	return nil
 }
 
+// processMedia handles audio and video file input. The recording itself is not
+// loaded into memory; it is streamed to a transcription backend later on.
+func (h *Handler) processMedia(path string, inputType InputType) error {
+	if err := fileutil.CheckFileSize(path); err != nil {
+		return fmt.Errorf("error reading media file %s: %w", path, err)
+	}
+
+	input := &Input{
+		Path:     path,
+		Type:     inputType,
+		MimeType: h.getMimeType(path),
+	}
+	h.inputs = append(h.inputs, input)
+	return nil
+}
+
 // resizeImage resizes the image if it exceeds maximum dimensions
 func (h *Handler) resizeImage(img image.Image) image.Image {
 	bounds := img.Bounds()
@@ -511,6 +575,16 @@ func (h *Handler) GetAllContents() []byte {
 	return allContents
 }
 
+// SetInputs replaces the processed inputs, e.g. after media has been transcribed
+func (h *Handler) SetInputs(inputs []*Input) {
+	h.inputs = inputs
+}
+
+// IsMedia reports whether the input is an audio or video recording
+func (i *Input) IsMedia() bool {
+	return i.Type == AudioInput || i.Type == VideoInput
+}
+
 // Clear removes all processed inputs
 func (h *Handler) Clear() {
 	h.inputs = make([]*Input, 0)
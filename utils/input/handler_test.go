@@ -244,3 +244,50 @@ func TestContainsWildcard(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessPathMedia(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "comanda-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	files := map[string]struct {
+		inputType InputType
+		mimeType  string
+	}{
+		"meeting.mp3": {AudioInput, "audio/mpeg"},
+		"memo.wav":    {AudioInput, "audio/wav"},
+		"call.m4a":    {AudioInput, "audio/mp4"},
+		"demo.mp4":    {VideoInput, "video/mp4"},
+	}
+
+	for name, expected := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte("not really media"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		handler := NewHandler()
+		if err := handler.ProcessPath(path); err != nil {
+			t.Fatalf("ProcessPath(%s) returned error: %v", name, err)
+		}
+
+		inputs := handler.GetInputs()
+		if len(inputs) != 1 {
+			t.Fatalf("Expected 1 input for %s, got %d", name, len(inputs))
+		}
+		if inputs[0].Type != expected.inputType {
+			t.Errorf("Expected input type %v for %s, got %v", expected.inputType, name, inputs[0].Type)
+		}
+		if inputs[0].MimeType != expected.mimeType {
+			t.Errorf("Expected MIME type %s for %s, got %s", expected.mimeType, name, inputs[0].MimeType)
+		}
+		if !inputs[0].IsMedia() {
+			t.Errorf("Expected %s to be reported as media", name)
+		}
+		if len(inputs[0].Contents) != 0 {
+			t.Errorf("Expected media contents not to be loaded for %s", name)
+		}
+	}
+}
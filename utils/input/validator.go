@@ -29,6 +29,16 @@ var (
 		".bmp",
 	}
 
+	AudioExtensions = []string{
+		".mp3",
+		".wav",
+		".m4a",
+	}
+
+	VideoExtensions = []string{
+		".mp4",
+	}
+
 	DocumentExtensions = []string{
 		".pdf",
 		".doc",
@@ -66,11 +76,13 @@ type Validator struct {
 
 // NewValidator creates a new input validator with default text extensions
 func NewValidator(additionalExtensions []string) *Validator {
-	// Start with text, image, document, and source code extensions
+	// Start with text, image, document, source code, audio and video extensions
 	allExtensions := append([]string{}, TextExtensions...)
 	allExtensions = append(allExtensions, ImageExtensions...)
 	allExtensions = append(allExtensions, DocumentExtensions...)
 	allExtensions = append(allExtensions, SourceCodeExtensions...)
+	allExtensions = append(allExtensions, AudioExtensions...)
+	allExtensions = append(allExtensions, VideoExtensions...)
 
 	// Add any additional extensions
 	if len(additionalExtensions) > 0 {
@@ -167,6 +179,17 @@ func (v *Validator) IsImageFile(path string) bool {
 	return false
 }
 
+// IsMediaFile checks if the file has an audio or video extension
+func (v *Validator) IsMediaFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, mediaExt := range append(append([]string{}, AudioExtensions...), VideoExtensions...) {
+		if ext == mediaExt {
+			return true
+		}
+	}
+	return false
+}
+
 // IsDocumentFile checks if the file has a document extension
 func (v *Validator) IsDocumentFile(path string) bool {
 	ext := strings.ToLower(filepath.Ext(path))
@@ -0,0 +1,290 @@
+// Package keypool spreads requests over the API keys of a provider and takes
+// keys out of rotation when the provider rejects them. Pools are shared by all
+// workflows and server requests in the process.
+package keypool
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// keyErrorStatuses are the HTTP statuses with which providers reject the key
+// itself: invalid or revoked (401), out of credit (402) or not permitted (403)
+var keyErrorStatuses = map[int]bool{401: true, 402: true, 403: true}
+
+// keyErrorCodes are the error codes of an exhausted quota, which comes with
+// status 429 like an ordinary rate limit
+var keyErrorCodes = map[string]bool{"insufficient_quota": true, "billing_hard_limit_reached": true}
+
+// statusPattern finds the HTTP status in the errors of providers that call
+// their API directly, e.g. "status 401" or "(status code: 403)"
+var statusPattern = regexp.MustCompile(`\bstatus(?: code)?:? ([1-5][0-9]{2})\b`)
+
+// IsKeyError reports whether an error means the key used cannot make requests.
+// Errors are classified by their HTTP status and error code, never by their text.
+func IsKeyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return keyErrorStatuses[apiErr.HTTPStatusCode] || keyErrorCodes[fmt.Sprint(apiErr.Code)] || keyErrorCodes[apiErr.Type]
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return keyErrorStatuses[requestErr.HTTPStatusCode]
+	}
+	// Google API errors
+	var httpErr interface{ HTTPCode() int }
+	if errors.As(err, &httpErr) {
+		return keyErrorStatuses[httpErr.HTTPCode()]
+	}
+	if match := statusPattern.FindStringSubmatch(err.Error()); match != nil {
+		status, _ := strconv.Atoi(match[1])
+		return keyErrorStatuses[status]
+	}
+	return false
+}
+
+// Usage reports the counters of one key, as shown by the server
+type Usage struct {
+	Provider   string    `json:"provider"`
+	Name       string    `json:"name"`
+	Project    string    `json:"project,omitempty"`
+	Requests   int64     `json:"requests"`
+	Failures   int64     `json:"failures"`
+	Disabled   bool      `json:"disabled"`
+	Reason     string    `json:"reason,omitempty"`
+	DisabledAt time.Time `json:"disabledAt,omitempty"`
+	LastUsed   time.Time `json:"lastUsed,omitempty"`
+}
+
+// key is a key of a pool with its counters
+type key struct {
+	config.APIKey
+	requests   int64
+	failures   int64
+	disabled   bool
+	reason     string
+	disabledAt time.Time
+	lastUsed   time.Time
+}
+
+// Pool selects the API keys of one provider
+type Pool struct {
+	mu        sync.Mutex
+	provider  string
+	selection string
+	keys      []*key
+	next      int
+	signature string
+}
+
+// newPool returns a pool for the keys of a provider configuration
+func newPool(providerName string, providerConfig *config.Provider, signature string) *Pool {
+	pool := &Pool{provider: providerName, selection: providerConfig.KeySelection, signature: signature}
+	for _, apiKey := range providerConfig.Keys() {
+		pool.keys = append(pool.keys, &key{APIKey: apiKey})
+	}
+	return pool
+}
+
+// Size returns the number of keys in the pool
+func (p *Pool) Size() int {
+	return len(p.keys)
+}
+
+// Select returns the next key for a project. Only keys of the project are
+// used, or the keys without a project when project is empty, so that requests
+// are billed to the right project. Keys taken out of rotation are skipped.
+func (p *Pool) Select(project string) (config.APIKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var eligible []int
+	scoped := 0
+	for i, k := range p.keys {
+		if k.Project != project {
+			continue
+		}
+		scoped++
+		if !k.disabled {
+			eligible = append(eligible, i)
+		}
+	}
+	if scoped == 0 {
+		if project == "" {
+			return config.APIKey{}, fmt.Errorf("provider %s has no API key without a project; select a project with --project or COMANDA_PROJECT", p.provider)
+		}
+		return config.APIKey{}, fmt.Errorf("provider %s has no API key for project %s", p.provider, project)
+	}
+	if len(eligible) == 0 {
+		return config.APIKey{}, fmt.Errorf("all API keys of provider %s%s have been taken out of rotation: %s", p.provider, projectSuffix(project), p.reasons(project))
+	}
+
+	chosen := eligible[0]
+	if p.selection == config.KeySelectionLeastUsed {
+		for _, i := range eligible[1:] {
+			if p.keys[i].requests < p.keys[chosen].requests {
+				chosen = i
+			}
+		}
+	} else {
+		// Round robin: the first eligible key at or after the cursor
+		for _, i := range eligible {
+			if i >= p.next {
+				chosen = i
+				break
+			}
+		}
+		p.next = chosen + 1
+	}
+
+	return p.keys[chosen].APIKey, nil
+}
+
+// Report records a request made with a key. When the pool has several keys, a
+// key error takes the key out of rotation; it returns whether it did.
+func (p *Pool) Report(name string, err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, k := range p.keys {
+		if k.Name != name {
+			continue
+		}
+		k.requests++
+		k.lastUsed = time.Now()
+		if err == nil {
+			return false
+		}
+		k.failures++
+		if IsKeyError(err) && !k.disabled && len(p.keys) > 1 {
+			k.disabled = true
+			k.reason = err.Error()
+			k.disabledAt = time.Now()
+			config.DebugLog("[KeyPool] Taking key %s of provider %s out of rotation: %v", name, p.provider, err)
+			return true
+		}
+	}
+	return false
+}
+
+// Usage returns the counters of the keys
+func (p *Pool) Usage() []Usage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	usage := make([]Usage, 0, len(p.keys))
+	for _, k := range p.keys {
+		usage = append(usage, Usage{
+			Provider:   p.provider,
+			Name:       k.Name,
+			Project:    k.Project,
+			Requests:   k.requests,
+			Failures:   k.failures,
+			Disabled:   k.disabled,
+			Reason:     k.reason,
+			DisabledAt: k.disabledAt,
+			LastUsed:   k.lastUsed,
+		})
+	}
+	return usage
+}
+
+// reasons lists why the keys of a project were taken out of rotation
+func (p *Pool) reasons(project string) string {
+	var reasons []string
+	for _, k := range p.keys {
+		if k.Project == project && k.disabled {
+			reasons = append(reasons, fmt.Sprintf("%s (%s)", k.Name, k.reason))
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+func projectSuffix(project string) string {
+	if project == "" {
+		return ""
+	}
+	return " for project " + project
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Pool)
+)
+
+// signature identifies the keys and strategy of a provider configuration, so
+// that a changed configuration gets a new pool
+func signature(providerConfig *config.Provider) string {
+	var b strings.Builder
+	b.WriteString(providerConfig.KeySelection)
+	for _, k := range providerConfig.Keys() {
+		fmt.Fprintf(&b, "\x00%s\x00%s\x00%s", k.Name, k.Key, k.Project)
+	}
+	return b.String()
+}
+
+// Get returns the pool of a provider, shared by every caller in the process.
+// The pool, with its counters, is replaced when the keys in the configuration change.
+func Get(providerName string, providerConfig *config.Provider) *Pool {
+	sig := signature(providerConfig)
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if pool, ok := registry[providerName]; ok && pool.signature == sig {
+		return pool
+	}
+	pool := newPool(providerName, providerConfig, sig)
+	registry[providerName] = pool
+	return pool
+}
+
+// Key returns the next API key of a provider for a project, or an empty key for
+// providers configured without one, for one-off requests outside workflows
+func Key(providerName string, providerConfig *config.Provider, project string) (string, error) {
+	if !providerConfig.HasAPIKey() {
+		return "", nil
+	}
+	key, err := Get(providerName, providerConfig).Select(project)
+	if err != nil {
+		return "", err
+	}
+	return key.Key, nil
+}
+
+// AllUsage returns the counters of the keys of every pool, by provider and key name
+func AllUsage() []Usage {
+	registryMu.Lock()
+	pools := make([]*Pool, 0, len(registry))
+	for _, pool := range registry {
+		pools = append(pools, pool)
+	}
+	registryMu.Unlock()
+
+	var usage []Usage
+	for _, pool := range pools {
+		usage = append(usage, pool.Usage()...)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Provider != usage[j].Provider {
+			return usage[i].Provider < usage[j].Provider
+		}
+		return usage[i].Name < usage[j].Name
+	})
+	return usage
+}
+
+// Reset removes all pools, for tests
+func Reset() {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = make(map[string]*Pool)
+}
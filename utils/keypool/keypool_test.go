@@ -0,0 +1,135 @@
+package keypool
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func testProvider(selection string) *config.Provider {
+	return &config.Provider{
+		KeySelection: selection,
+		APIKeys: []config.APIKey{
+			{Name: "org-a", Key: "sk-a"},
+			{Name: "org-b", Key: "sk-b"},
+			{Name: "research", Key: "sk-r", Project: "research"},
+		},
+	}
+}
+
+// selectNames selects n keys, reporting each request as successful
+func selectNames(t *testing.T, pool *Pool, project string, n int) []string {
+	var names []string
+	for i := 0; i < n; i++ {
+		key, err := pool.Select(project)
+		if err != nil {
+			t.Fatalf("Select failed: %v", err)
+		}
+		pool.Report(key.Name, nil)
+		names = append(names, key.Name)
+	}
+	return names
+}
+
+func TestRoundRobin(t *testing.T) {
+	pool := newPool("openai", testProvider(""), "")
+	if got := strings.Join(selectNames(t, pool, "", 4), ","); got != "org-a,org-b,org-a,org-b" {
+		t.Errorf("Round robin order = %s", got)
+	}
+	if got := strings.Join(selectNames(t, pool, "research", 2), ","); got != "research,research" {
+		t.Errorf("A project should only use its keys, got %s", got)
+	}
+	if _, err := pool.Select("marketing"); err == nil || !strings.Contains(err.Error(), "project marketing") {
+		t.Errorf("Expected an error for a project without keys, got %v", err)
+	}
+}
+
+func TestLeastUsed(t *testing.T) {
+	pool := newPool("openai", testProvider(config.KeySelectionLeastUsed), "")
+	pool.Report("org-a", nil)
+	pool.Report("org-a", nil)
+	if got := strings.Join(selectNames(t, pool, "", 3), ","); got != "org-b,org-b,org-a" {
+		t.Errorf("Least used order = %s", got)
+	}
+}
+
+func TestKeyErrorTakesKeyOutOfRotation(t *testing.T) {
+	pool := newPool("openai", testProvider(""), "")
+	if pool.Report("org-a", errors.New("request timed out")) {
+		t.Error("Other errors should not take a key out of rotation")
+	}
+	if !pool.Report("org-a", errors.New("error, status code: 401, message: Incorrect API key provided")) {
+		t.Fatal("A 401 should take the key out of rotation")
+	}
+	if got := strings.Join(selectNames(t, pool, "", 2), ","); got != "org-b,org-b" {
+		t.Errorf("The rejected key should be skipped, got %s", got)
+	}
+
+	pool.Report("org-b", fmt.Errorf("OpenAI API error: %w", &openai.APIError{HTTPStatusCode: 429, Code: "insufficient_quota", Message: "You exceeded your current quota"}))
+	_, err := pool.Select("")
+	if err == nil || !strings.Contains(err.Error(), "org-a") || !strings.Contains(err.Error(), "org-b") {
+		t.Errorf("Expected an error naming the rejected keys, got %v", err)
+	}
+
+	usage := pool.Usage()
+	if usage[0].Requests != 2 || usage[0].Failures != 2 || !usage[0].Disabled || usage[1].Requests != 3 || usage[1].Failures != 1 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+}
+
+func TestIsKeyError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("error, status code: 401, status: 401 Unauthorized, message: Incorrect API key provided"), true},
+		{errors.New("API request failed with status 403: {\"type\":\"permission_error\"}"), true},
+		{fmt.Errorf("OpenAI API error: %w", &openai.APIError{HTTPStatusCode: 401}), true},
+		{fmt.Errorf("OpenAI API error: %w", &openai.APIError{HTTPStatusCode: 429, Type: "insufficient_quota"}), true},
+		{fmt.Errorf("OpenAI API error: %w", &openai.APIError{HTTPStatusCode: 429, Code: "rate_limit_exceeded"}), false},
+		{&openai.RequestError{HTTPStatusCode: 402}, true},
+		{errors.New("API request failed with status 400: prompt mentions the 401 billing report"), false},
+		{errors.New("Unauthorized access is described in section 401 of the billing policy"), false},
+		{errors.New("request timed out"), false},
+	} {
+		if got := IsKeyError(tc.err); got != tc.want {
+			t.Errorf("IsKeyError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestSingleKeyStaysInRotation(t *testing.T) {
+	pool := newPool("anthropic", &config.Provider{APIKey: "sk-ant"}, "")
+	if pool.Report("default", errors.New("401 unauthorized")) {
+		t.Error("A single key should not be taken out of rotation")
+	}
+	if key, err := pool.Select(""); err != nil || key.Key != "sk-ant" {
+		t.Errorf("Select = %+v, %v", key, err)
+	}
+}
+
+func TestGetSharesPools(t *testing.T) {
+	Reset()
+	defer Reset()
+	providerConfig := testProvider("")
+	pool := Get("openai", providerConfig)
+	if Get("openai", providerConfig) != pool {
+		t.Error("Callers should share the pool of a provider")
+	}
+	pool.Report("org-a", nil)
+	if usage := AllUsage(); len(usage) != 3 || usage[0].Name != "org-a" || usage[0].Requests != 1 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	providerConfig.APIKeys = providerConfig.APIKeys[:1]
+	if Get("openai", providerConfig) == pool {
+		t.Error("Changed keys should get a new pool")
+	}
+	if key, err := Key("openai", providerConfig, ""); err != nil || key != "sk-a" {
+		t.Errorf("Key = %q, %v", key, err)
+	}
+}
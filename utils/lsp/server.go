@@ -0,0 +1,440 @@
+// Package lsp implements a small Language Server Protocol server for comanda
+// workflow files, with diagnostics from the workflow linter, hover docs from
+// the workflow schema and completion of the configured model names.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
+	"gopkg.in/yaml.v3"
+)
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+)
+
+// LSP diagnostic severities
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+// modelValue matches a line on which a model name is being typed, e.g. "  model: gpt"
+var modelValue = regexp.MustCompile(`^\s*(?:-\s+)?model:\s*["']?[^"'\s]*$`)
+
+// listItem matches a line on which a list item is being typed, e.g. "    - gpt"
+var listItem = regexp.MustCompile(`^(\s*)-\s*["']?[^"'\s]*$`)
+
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type textRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type diagnostic struct {
+	Range    textRange `json:"range"`
+	Severity int       `json:"severity"`
+	Code     string    `json:"code"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+type textDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position position `json:"position"`
+}
+
+type completionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Server is a language server for workflow files, speaking JSON-RPC over a
+// reader and a writer such as stdin and stdout
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	writeMu   sync.Mutex
+	envConfig *config.EnvConfig // May be nil, in which case models are neither checked nor completed
+	documents map[string]string
+	shutdown  bool
+}
+
+// NewServer creates a language server reading requests from in and writing
+// responses and notifications to out
+func NewServer(in io.Reader, out io.Writer, envConfig *config.EnvConfig) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		envConfig: envConfig,
+		documents: make(map[string]string),
+	}
+}
+
+// Run serves requests until the client sends exit or closes the input
+func (s *Server) Run() error {
+	for {
+		body, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+		s.handle(msg)
+	}
+}
+
+// read reads the body of the next message, framed by a Content-Length header
+func (s *Server) read() ([]byte, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length: %w", err)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// write sends a message with its Content-Length header
+func (s *Server) write(msg message) {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		config.DebugLog("[LSP] Failed to encode message: %v", err)
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// reply answers a request, with a null ID when the request could not be read
+func (s *Server) reply(id *json.RawMessage, result interface{}, respErr *responseError) {
+	if id == nil {
+		null := json.RawMessage("null")
+		id = &null
+	}
+	if respErr == nil && result == nil {
+		// A null result must still be sent
+		result = json.RawMessage("null")
+	}
+	s.write(message{ID: id, Result: result, Error: respErr})
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	s.write(message{Method: method, Params: data})
+}
+
+// handle dispatches a request or notification
+func (s *Server) handle(msg message) {
+	config.DebugLog("[LSP] %s", msg.Method)
+	switch msg.Method {
+	case "initialize":
+		s.reply(msg.ID, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // Full document sync
+				"hoverProvider":      true,
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{":", " ", "-"}},
+			},
+			"serverInfo": map[string]string{"name": "comanda"},
+		}, nil)
+	case "initialized", "$/cancelRequest", "$/setTrace", "textDocument/didSave", "workspace/didChangeConfiguration":
+	case "shutdown":
+		s.shutdown = true
+		s.reply(msg.ID, nil, nil)
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params textDocumentPosition
+		if json.Unmarshal(msg.Params, &params) == nil {
+			delete(s.documents, params.TextDocument.URI)
+			s.publish(params.TextDocument.URI, []diagnostic{})
+		}
+	case "textDocument/hover":
+		var params textDocumentPosition
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			s.reply(msg.ID, nil, nil)
+			return
+		}
+		s.reply(msg.ID, s.hover(params), nil)
+	case "textDocument/completion":
+		var params textDocumentPosition
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			s.reply(msg.ID, []completionItem{}, nil)
+			return
+		}
+		s.reply(msg.ID, s.complete(params), nil)
+	default:
+		if msg.ID != nil {
+			s.reply(msg.ID, nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not supported: %s", msg.Method)})
+		}
+	}
+}
+
+// update stores the text of a document and publishes its diagnostics
+func (s *Server) update(uri, text string) {
+	s.documents[uri] = text
+	s.publish(uri, s.diagnostics(uri, text))
+}
+
+func (s *Server) publish(uri string, diagnostics []diagnostic) {
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"diagnostics": diagnostics,
+	})
+}
+
+// diagnostics lints a document, marking each problem from its position to the
+// end of its line
+func (s *Server) diagnostics(uri, text string) []diagnostic {
+	lines := strings.Split(text, "\n")
+	result := []diagnostic{}
+	for _, d := range processor.Lint(uriPath(uri), []byte(text), s.envConfig) {
+		line := max(d.Line-1, 0)
+		start := max(d.Column-1, 0)
+		end := start
+		if line < len(lines) {
+			end = max(utf16Len(strings.TrimRight(lines[line], "\r")), start)
+		}
+		severity := severityWarning
+		if d.Severity == processor.SeverityError {
+			severity = severityError
+		}
+		result = append(result, diagnostic{
+			Range:    textRange{Start: position{line, start}, End: position{line, end}},
+			Severity: severity,
+			Code:     d.Rule,
+			Source:   "comanda",
+			Message:  d.Message,
+		})
+	}
+	return result
+}
+
+// hover describes the key under the cursor
+func (s *Server) hover(params textDocumentPosition) interface{} {
+	text, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+	path, key := keyAt(doc.Content[0], params.Position.Line+1, params.Position.Character+1, nil)
+	if key == nil {
+		return nil
+	}
+	description := processor.SchemaDescription(path)
+	if description == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"contents": map[string]string{
+			"kind":  "markdown",
+			"value": fmt.Sprintf("**%s**\n\n%s", key.Value, description),
+		},
+		"range": textRange{
+			Start: position{key.Line - 1, key.Column - 1},
+			End:   position{key.Line - 1, key.Column - 1 + utf16Len(key.Value)},
+		},
+	}
+}
+
+// keyAt returns the path of the mapping key at a line and column, both 1-based
+func keyAt(node *yaml.Node, line, column int, path []string) ([]string, *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := append(append([]string{}, path...), key.Value)
+			if key.Line == line && column >= key.Column && column <= key.Column+utf16Len(key.Value) {
+				return keyPath, key
+			}
+			if found, foundKey := keyAt(value, line, column, keyPath); foundKey != nil {
+				return found, foundKey
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if found, foundKey := keyAt(item, line, column, path); foundKey != nil {
+				return found, foundKey
+			}
+		}
+	}
+	return nil, nil
+}
+
+// complete offers the configured models and aliases where a model name is typed
+func (s *Server) complete(params textDocumentPosition) []completionItem {
+	items := []completionItem{}
+	text, ok := s.documents[params.TextDocument.URI]
+	if !ok || s.envConfig == nil {
+		return items
+	}
+	lines := strings.Split(text, "\n")
+	if params.Position.Line < 0 || params.Position.Line >= len(lines) {
+		return items
+	}
+	prefix, ok := utf16Prefix(lines[params.Position.Line], params.Position.Character)
+	if !ok {
+		return items
+	}
+	if !modelValue.MatchString(prefix) && !inModelList(lines, params.Position.Line, prefix) {
+		return items
+	}
+
+	for name, provider := range s.envConfig.Providers {
+		if provider == nil {
+			continue
+		}
+		for _, model := range provider.Models {
+			items = append(items, completionItem{Label: model.Name, Kind: 12, Detail: name}) // 12 is the Value kind
+		}
+	}
+	for alias, target := range s.envConfig.Aliases {
+		items = append(items, completionItem{Label: alias, Kind: 12, Detail: "alias for " + target})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+// inModelList reports whether a list item being typed belongs to a model: key,
+// the closest less indented line above it
+func inModelList(lines []string, line int, prefix string) bool {
+	m := listItem.FindStringSubmatch(prefix)
+	if m == nil {
+		return false
+	}
+	indent := len(m[1])
+	for i := line - 1; i >= 0; i-- {
+		above := strings.TrimRight(lines[i], "\r")
+		trimmed := strings.TrimLeft(above, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "-") && len(above)-len(trimmed) == indent {
+			continue
+		}
+		if len(above)-len(trimmed) <= indent {
+			return strings.TrimSpace(trimmed) == "model:"
+		}
+	}
+	return false
+}
+
+// uriPath returns the file path of a file:// URI, or the URI itself
+func uriPath(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+	return uri
+}
+
+// utf16Len returns the length of a string in UTF-16 code units, which LSP
+// positions count
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// utf16Prefix returns the start of a line up to a UTF-16 character offset,
+// or false when the offset is negative
+func utf16Prefix(line string, character int) (string, bool) {
+	if character < 0 {
+		return "", false
+	}
+	units := 0
+	for i, r := range line {
+		if units >= character {
+			return line[:i], true
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return line, true
+}
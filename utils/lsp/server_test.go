@@ -0,0 +1,188 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+const testURI = "file:///work/summarize.yaml"
+
+const testWorkflow = `summarize:
+  input: NA
+  model: gpt-4o
+  acton: Summarize
+  output: STDOUT
+  chunk:
+    size: 10
+compare:
+  input: NA
+  model:
+    - gp
+  action: Compare
+  output: STDOUT
+`
+
+// session runs the server on a sequence of messages and returns the messages it wrote
+func session(t *testing.T, envConfig *config.EnvConfig, messages ...map[string]interface{}) []map[string]interface{} {
+	t.Helper()
+	var in bytes.Buffer
+	for _, msg := range messages {
+		msg["jsonrpc"] = "2.0"
+		body, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+
+	var out bytes.Buffer
+	if err := NewServer(&in, &out, envConfig).Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	reader := NewServer(&out, nil, nil)
+	var written []map[string]interface{}
+	for {
+		body, err := reader.read()
+		if err != nil {
+			break
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("Server wrote invalid JSON: %s", body)
+		}
+		written = append(written, msg)
+	}
+	return written
+}
+
+func request(id int, method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{"id": id, "method": method, "params": params}
+}
+
+func notification(method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{"method": method, "params": params}
+}
+
+func at(line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": testURI},
+		"position":     map[string]int{"line": line, "character": character},
+	}
+}
+
+// response returns the result of the response to a request
+func response(t *testing.T, written []map[string]interface{}, id int) interface{} {
+	t.Helper()
+	for _, msg := range written {
+		if msgID, ok := msg["id"].(float64); ok && int(msgID) == id {
+			return msg["result"]
+		}
+	}
+	t.Fatalf("No response to request %d in %v", id, written)
+	return nil
+}
+
+func TestServer(t *testing.T) {
+	envConfig := &config.EnvConfig{
+		Providers: map[string]*config.Provider{
+			"openai": {Models: []config.Model{{Name: "gpt-4o"}, {Name: "gpt-4o-mini"}}},
+		},
+		Aliases: map[string]string{"fast": "gpt-4o-mini"},
+	}
+	open := map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI, "languageId": "yaml", "version": 1, "text": testWorkflow},
+	}
+
+	written := session(t, envConfig,
+		request(1, "initialize", map[string]interface{}{}),
+		notification("initialized", map[string]interface{}{}),
+		notification("textDocument/didOpen", open),
+		request(2, "textDocument/hover", at(6, 5)),
+		request(3, "textDocument/completion", at(2, 9)),
+		request(4, "textDocument/completion", at(10, 8)),
+		request(5, "textDocument/completion", at(3, 4)),
+		request(6, "textDocument/hover", at(0, 3)),
+		request(7, "workspace/symbol", map[string]interface{}{}),
+		request(9, "textDocument/completion", at(-1, 9)),
+		request(10, "textDocument/completion", at(2, -1)),
+		request(8, "shutdown", nil),
+		notification("exit", nil),
+	)
+
+	capabilities := response(t, written, 1).(map[string]interface{})["capabilities"].(map[string]interface{})
+	if capabilities["hoverProvider"] != true || capabilities["completionProvider"] == nil {
+		t.Errorf("Expected hover and completion capabilities, got %v", capabilities)
+	}
+
+	// Diagnostics are published when the document is opened
+	var diagnostics []interface{}
+	for _, msg := range written {
+		if msg["method"] == "textDocument/publishDiagnostics" {
+			diagnostics = msg["params"].(map[string]interface{})["diagnostics"].([]interface{})
+		}
+	}
+	found := false
+	for _, d := range diagnostics {
+		d := d.(map[string]interface{})
+		if d["code"] == "unknown-key" {
+			found = true
+			start := d["range"].(map[string]interface{})["start"].(map[string]interface{})
+			if start["line"] != float64(3) || start["character"] != float64(2) || d["severity"] != float64(severityError) {
+				t.Errorf("Expected an error at 3:2, got %v", d)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected an unknown-key diagnostic, got %v", diagnostics)
+	}
+
+	hover := response(t, written, 2).(map[string]interface{})
+	if value := hover["contents"].(map[string]interface{})["value"].(string); !strings.Contains(value, "**size**") || !strings.Contains(value, "Chunk size") {
+		t.Errorf("Expected the docs of chunk.size, got %q", value)
+	}
+
+	for _, id := range []int{3, 4} {
+		items := response(t, written, id).([]interface{})
+		var labels []string
+		for _, item := range items {
+			labels = append(labels, item.(map[string]interface{})["label"].(string))
+		}
+		if strings.Join(labels, ",") != "fast,gpt-4o,gpt-4o-mini" {
+			t.Errorf("Request %d: expected the configured models and aliases, got %v", id, labels)
+		}
+	}
+	if items := response(t, written, 5).([]interface{}); len(items) != 0 {
+		t.Errorf("Expected no completion outside model values, got %v", items)
+	}
+	for _, id := range []int{9, 10} {
+		if items := response(t, written, id).([]interface{}); len(items) != 0 {
+			t.Errorf("Request %d: expected no completion at a negative position, got %v", id, items)
+		}
+	}
+	if hover := response(t, written, 6); hover != nil {
+		t.Errorf("Expected no hover on a step name, got %v", hover)
+	}
+
+	for _, msg := range written {
+		if msg["id"] == float64(7) {
+			if msg["error"].(map[string]interface{})["code"] != float64(codeMethodNotFound) {
+				t.Errorf("Expected method not found, got %v", msg)
+			}
+		}
+	}
+}
+
+func TestServerExitWithoutShutdown(t *testing.T) {
+	body := `{"jsonrpc":"2.0","method":"exit"}`
+	in := bufio.NewReader(strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)))
+	if err := NewServer(in, &bytes.Buffer{}, nil).Run(); err == nil {
+		t.Errorf("Expected an error when exiting before shutdown")
+	}
+}
@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	to := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+
+	got := Diff("v1", "v2", from, to)
+	want := `--- v1
++++ v2
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -8,3 +8,4 @@
+ h
+ i
+ j
++k
+`
+	if got != want {
+		t.Errorf("Unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	if Diff("v1", "v2", from, from) != "" {
+		t.Error("Expected no diff for equal documents")
+	}
+}
+
+func TestDiffFromEmpty(t *testing.T) {
+	got := Diff("empty", "v1", "", "one\ntwo\n")
+	if !strings.Contains(got, "@@ -1,0 +1,2 @@\n+one\n+two\n") {
+		t.Errorf("Unexpected diff:\n%s", got)
+	}
+}
@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"fmt"
+	"time"
+)
+
+// JSONLStore keeps every version of every namespace as one JSON line in a
+// single append-only file; the newest version of a namespace is its current
+// document. It suits shared setups such as a server with per-user namespaces.
+type JSONLStore struct {
+	path      string
+	namespace string
+}
+
+// NewJSONLStore creates a store for one namespace of a JSONL memory file
+func NewJSONLStore(path string, namespace string) *JSONLStore {
+	return &JSONLStore{path: path, namespace: namespace}
+}
+
+// Location returns the JSONL file path and namespace
+func (s *JSONLStore) Location() string {
+	if s.namespace == "" {
+		return s.path
+	}
+	return fmt.Sprintf("%s (namespace %s)", s.path, s.namespace)
+}
+
+// Read returns the newest version's content
+func (s *JSONLStore) Read() (string, error) {
+	versions, err := s.History()
+	if err != nil {
+		return "", err
+	}
+	return latestContent(versions), nil
+}
+
+// Update applies fn under the file lock and appends the result as a new
+// version; the newest DefaultHistoryKeep versions of the namespace are kept
+func (s *JSONLStore) Update(message string, fn UpdateFunc) error {
+	lock, err := acquireLock(s.path)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	versions, err := s.History()
+	if err != nil {
+		return err
+	}
+	current := latestContent(versions)
+
+	updated, err := fn(current)
+	if err != nil {
+		return err
+	}
+	if updated == current {
+		return nil
+	}
+
+	if err := appendVersions(s.path, Version{
+		ID:        nextVersionID(versions),
+		Namespace: s.namespace,
+		Time:      time.Now(),
+		Message:   message,
+		Content:   updated,
+	}); err != nil {
+		return err
+	}
+	return trimHistory(s.path, s.namespace, len(versions)+1)
+}
+
+// History returns the namespace's versions, oldest first
+func (s *JSONLStore) History() ([]Version, error) {
+	return readVersions(s.path, s.namespace)
+}
+
+// Revert restores the content of a version
+func (s *JSONLStore) Revert(id int) error {
+	return revert(s, id)
+}
+
+// Prune removes all but the newest keep versions of the namespace
+func (s *JSONLStore) Prune(keep int) (int, error) {
+	lock, err := acquireLock(s.path)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.release()
+	return pruneVersions(s.path, s.namespace, keep)
+}
+
+// latestContent returns the content of the newest version, or "" if there is none
+func latestContent(versions []Version) string {
+	if len(versions) == 0 {
+		return ""
+	}
+	return versions[len(versions)-1].Content
+}
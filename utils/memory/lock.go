@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// fileLock is an exclusive inter-process lock held on a "<path>.lock" file.
+// The lock lives in a separate file because documents are replaced by rename.
+type fileLock struct {
+	file *os.File
+}
+
+// acquireLock takes the exclusive lock for path, waiting up to lockTimeout
+// for other processes to release it
+func acquireLock(path string) (*fileLock, error) {
+	lockPath := path + ".lock"
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s: %w", lockPath, err)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", lockPath, err)
+		}
+		if locked {
+			return &fileLock{file: file}, nil
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("timed out after %s waiting for %s; another comanda process is writing memory", lockTimeout, lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// release drops the lock
+func (l *fileLock) release() error {
+	unlockErr := unlockFile(l.file)
+	closeErr := l.file.Close()
+	if unlockErr != nil {
+		return unlockErr
+	}
+	return closeErr
+}
@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// MarkdownStore keeps the document as a plain markdown file, so it stays easy
+// to read and edit by hand. Versions are recorded in "<file>.history.jsonl".
+type MarkdownStore struct {
+	path string
+}
+
+// NewMarkdownStore creates a store for a markdown memory file
+func NewMarkdownStore(path string) *MarkdownStore {
+	return &MarkdownStore{path: path}
+}
+
+// historyPath returns the JSONL file that records the document's versions
+func (s *MarkdownStore) historyPath() string {
+	return s.path + ".history.jsonl"
+}
+
+// Location returns the markdown file path
+func (s *MarkdownStore) Location() string {
+	return s.path
+}
+
+// Read returns the current file content; a missing file is an empty document
+func (s *MarkdownStore) Read() (string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Update applies fn under the file lock. If the file was changed outside
+// comanda since the last recorded version, that state is recorded first so
+// that hand edits can be diffed and reverted too. The newest DefaultHistoryKeep
+// versions are kept.
+func (s *MarkdownStore) Update(message string, fn UpdateFunc) error {
+	lock, err := acquireLock(s.path)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	current, err := s.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read memory file: %w", err)
+	}
+	versions, err := readVersions(s.historyPath(), "")
+	if err != nil {
+		return err
+	}
+
+	var records []Version
+	nextID := nextVersionID(versions)
+	switch {
+	case len(versions) == 0 && current != "":
+		records = append(records, Version{ID: nextID, Time: time.Now(), Message: "initial content", Content: current})
+		nextID++
+	case len(versions) > 0 && versions[len(versions)-1].Content != current:
+		records = append(records, Version{ID: nextID, Time: time.Now(), Message: "edited outside comanda", Content: current})
+		nextID++
+	}
+
+	updated, err := fn(current)
+	if err != nil {
+		return err
+	}
+	if updated != current {
+		if err := writeFileAtomic(s.path, []byte(updated)); err != nil {
+			return err
+		}
+		records = append(records, Version{ID: nextID, Time: time.Now(), Message: message, Content: updated})
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+	if err := appendVersions(s.historyPath(), records...); err != nil {
+		return err
+	}
+	return trimHistory(s.historyPath(), "", len(versions)+len(records))
+}
+
+// History returns the recorded versions, oldest first
+func (s *MarkdownStore) History() ([]Version, error) {
+	return readVersions(s.historyPath(), "")
+}
+
+// Revert restores the content of a version
+func (s *MarkdownStore) Revert(id int) error {
+	return revert(s, id)
+}
+
+// Prune removes all but the newest keep versions
+func (s *MarkdownStore) Prune(keep int) (int, error) {
+	lock, err := acquireLock(s.path)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.release()
+	return pruneVersions(s.historyPath(), "", keep)
+}
+
+// revert restores a version's content through the store's Update
+func revert(s Store, id int) error {
+	versions, err := s.History()
+	if err != nil {
+		return err
+	}
+	version, err := FindVersion(versions, id)
+	if err != nil {
+		return err
+	}
+	return s.Update(fmt.Sprintf("revert to version %d", id), func(current string) (string, error) {
+		return version.Content, nil
+	})
+}
@@ -0,0 +1,315 @@
+// Package memory stores the project memory document (COMANDA.md) behind a
+// backend abstraction. Every write is made under an inter-process file lock
+// and recorded as a version, so that concurrent runs cannot clobber each
+// other and any change can be inspected, diffed or reverted.
+package memory
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultHistoryKeep is the number of versions a store keeps after each write,
+// and the number kept by Prune when no count is given
+const DefaultHistoryKeep = 20
+
+// lockTimeout is how long a write waits for another process to release the lock
+const lockTimeout = 30 * time.Second
+
+// ErrVersionNotFound is returned when a version ID does not exist in the history
+var ErrVersionNotFound = errors.New("memory version not found")
+
+// namespacePattern restricts namespace names so they are safe to use in file names
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Version is a recorded state of a memory document
+type Version struct {
+	ID        int       `json:"id"`
+	Namespace string    `json:"namespace,omitempty"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message"`
+	Content   string    `json:"content"`
+}
+
+// UpdateFunc computes the new document from the current one
+type UpdateFunc func(current string) (string, error)
+
+// Store is a memory backend. A store holds one namespace of one memory document.
+type Store interface {
+	// Read returns the current document
+	Read() (string, error)
+	// Update applies fn to the current document while holding the write lock
+	// and records the result as a new version. Returning the current document
+	// unchanged records nothing.
+	Update(message string, fn UpdateFunc) error
+	// History returns the recorded versions, oldest first
+	History() ([]Version, error)
+	// Revert restores the content of a version, recording the revert as a new version
+	Revert(id int) error
+	// Prune removes all but the newest keep versions and returns how many were removed
+	Prune(keep int) (int, error)
+	// Location describes where the document is stored
+	Location() string
+}
+
+// Open returns the store for a memory file and namespace. Files ending in
+// .jsonl use the JSONL backend; anything else is a markdown document whose
+// history is kept next to it. The empty namespace is the default one.
+func Open(path string, namespace string) (Store, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no memory file configured")
+	}
+	if err := ValidateNamespace(namespace); err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".jsonl") {
+		return NewJSONLStore(path, namespace), nil
+	}
+	return NewMarkdownStore(NamespacedPath(path, namespace)), nil
+}
+
+// ValidateNamespace checks that a namespace name is usable. The empty name is valid.
+func ValidateNamespace(namespace string) error {
+	if namespace != "" && !namespacePattern.MatchString(namespace) {
+		return fmt.Errorf("invalid memory namespace '%s': use letters, digits, '.', '_' and '-'", namespace)
+	}
+	return nil
+}
+
+// NamespacedPath returns the markdown file for a namespace: COMANDA.md in the
+// default namespace, COMANDA.<namespace>.md otherwise
+func NamespacedPath(path string, namespace string) string {
+	if namespace == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + namespace + ext
+}
+
+// FindVersion returns the version with the given ID
+func FindVersion(versions []Version, id int) (Version, error) {
+	for _, version := range versions {
+		if version.ID == id {
+			return version, nil
+		}
+	}
+	return Version{}, fmt.Errorf("%w: %d", ErrVersionNotFound, id)
+}
+
+// Section returns the content under the "## name" heading, up to the next "## " heading
+func Section(content string, name string) string {
+	if content == "" {
+		return ""
+	}
+
+	sectionHeader := "## " + name
+	var sectionContent []string
+	inSection := false
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, sectionHeader) {
+			inSection = true
+			continue
+		}
+		if inSection && strings.HasPrefix(line, "## ") {
+			break
+		}
+		if inSection {
+			sectionContent = append(sectionContent, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(sectionContent, "\n"))
+}
+
+// SectionHistory returns the versions in which a section changed, with Content
+// set to the section's content at that version. A version in which the section
+// is missing is included (with empty content) only if the section existed before.
+func SectionHistory(versions []Version, name string) []Version {
+	var history []Version
+	previous := ""
+	for _, version := range versions {
+		content := Section(version.Content, name)
+		if content == previous {
+			continue
+		}
+		version.Content = content
+		history = append(history, version)
+		previous = content
+	}
+	return history
+}
+
+// nextVersionID returns the ID that follows the newest version
+func nextVersionID(versions []Version) int {
+	if len(versions) == 0 {
+		return 1
+	}
+	return versions[len(versions)-1].ID + 1
+}
+
+// readVersions reads the version records of a namespace from a JSONL file.
+// A missing file has no versions.
+func readVersions(path string, namespace string) ([]Version, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open memory history %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var versions []Version
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var version Version
+		if err := json.Unmarshal(scanner.Bytes(), &version); err != nil {
+			return nil, fmt.Errorf("failed to parse %s line %d: %w", path, line, err)
+		}
+		if version.Namespace == namespace {
+			versions = append(versions, version)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read memory history %s: %w", path, err)
+	}
+	return versions, nil
+}
+
+// appendVersions appends version records to a JSONL file
+func appendVersions(path string, versions ...Version) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open memory history %s: %w", path, err)
+	}
+	defer file.Close()
+
+	for _, version := range versions {
+		data, err := json.Marshal(version)
+		if err != nil {
+			return fmt.Errorf("failed to encode memory version: %w", err)
+		}
+		if _, err := file.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write memory history %s: %w", path, err)
+		}
+	}
+	return file.Sync()
+}
+
+// trimHistory prunes a history of count versions to DefaultHistoryKeep, so that
+// the history every write reads does not grow without limit
+func trimHistory(path string, namespace string, count int) error {
+	if count <= DefaultHistoryKeep {
+		return nil
+	}
+	_, err := pruneVersions(path, namespace, DefaultHistoryKeep)
+	return err
+}
+
+// pruneVersions rewrites a JSONL file keeping only the newest keep versions of
+// a namespace; records of other namespaces are left untouched
+func pruneVersions(path string, namespace string, keep int) (int, error) {
+	if keep < 1 {
+		return 0, fmt.Errorf("at least one memory version must be kept")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read memory history %s: %w", path, err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	total := 0
+	namespaces := make([]string, len(lines))
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			namespaces[i] = "\x00" // blank line, never kept
+			continue
+		}
+		var version Version
+		if err := json.Unmarshal([]byte(line), &version); err != nil {
+			return 0, fmt.Errorf("failed to parse %s line %d: %w", path, i+1, err)
+		}
+		namespaces[i] = version.Namespace
+		if version.Namespace == namespace {
+			total++
+		}
+	}
+
+	remove := total - keep
+	if remove <= 0 {
+		return 0, nil
+	}
+
+	var kept []string
+	skipped := 0
+	for i, line := range lines {
+		switch {
+		case namespaces[i] == "\x00":
+		case namespaces[i] == namespace && skipped < remove:
+			skipped++
+		default:
+			kept = append(kept, line)
+		}
+	}
+
+	content := ""
+	if len(kept) > 0 {
+		content = strings.Join(kept, "\n") + "\n"
+	}
+	if err := writeFileAtomic(path, []byte(content)); err != nil {
+		return 0, err
+	}
+	return remove, nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path, so
+// readers never see a partially written file. An existing file's mode is kept.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for %s: %w", path, err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath) // No-op after a successful rename
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
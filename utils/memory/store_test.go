@@ -0,0 +1,228 @@
+package memory
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func appendLine(line string) UpdateFunc {
+	return func(current string) (string, error) {
+		return current + line + "\n", nil
+	}
+}
+
+func TestMarkdownStoreHistoryAndRevert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "COMANDA.md")
+	if err := os.WriteFile(path, []byte("# Project Memory\n"), 0644); err != nil {
+		t.Fatalf("Failed to write memory file: %v", err)
+	}
+
+	store, err := Open(path, "")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := store.Update("first", appendLine("one")); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := store.Update("second", appendLine("two")); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	versions, err := store.History()
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	// The pre-existing content is recorded as the first version
+	if len(versions) != 3 || versions[0].Message != "initial content" || versions[2].Message != "second" {
+		t.Fatalf("Unexpected history: %+v", versions)
+	}
+
+	// A hand edit is recorded before the next update
+	if err := os.WriteFile(path, []byte("# Edited\n"), 0644); err != nil {
+		t.Fatalf("Failed to edit memory file: %v", err)
+	}
+	if err := store.Update("third", appendLine("three")); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	versions, _ = store.History()
+	if len(versions) != 5 || versions[3].Message != "edited outside comanda" || versions[3].Content != "# Edited\n" {
+		t.Fatalf("Expected the external edit to be recorded, got %+v", versions)
+	}
+
+	if err := store.Revert(2); err != nil {
+		t.Fatalf("Revert failed: %v", err)
+	}
+	content, _ := store.Read()
+	if content != "# Project Memory\none\n" {
+		t.Errorf("Unexpected content after revert: %q", content)
+	}
+	versions, _ = store.History()
+	if versions[len(versions)-1].Message != "revert to version 2" {
+		t.Errorf("Expected the revert to be recorded, got %q", versions[len(versions)-1].Message)
+	}
+
+	if err := store.Revert(99); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Expected ErrVersionNotFound, got %v", err)
+	}
+}
+
+func TestMarkdownStoreNoChangeRecordsNothing(t *testing.T) {
+	store := NewMarkdownStore(filepath.Join(t.TempDir(), "COMANDA.md"))
+	if err := store.Update("noop", func(current string) (string, error) { return current, nil }); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	versions, _ := store.History()
+	if len(versions) != 0 {
+		t.Errorf("Expected no versions, got %d", len(versions))
+	}
+
+	// A failing update leaves the document alone
+	failure := errors.New("too big")
+	if err := store.Update("fail", func(current string) (string, error) { return "", failure }); !errors.Is(err, failure) {
+		t.Errorf("Expected update error to be returned, got %v", err)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	dir := t.TempDir()
+
+	// Markdown namespaces live in separate files
+	path := filepath.Join(dir, "COMANDA.md")
+	team, err := Open(path, "team")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := team.Update("note", appendLine("team note")); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if team.Location() != filepath.Join(dir, "COMANDA.team.md") {
+		t.Errorf("Unexpected location %s", team.Location())
+	}
+
+	// JSONL namespaces share one file
+	jsonlPath := filepath.Join(dir, "memory.jsonl")
+	alice, _ := Open(jsonlPath, "alice")
+	bob, _ := Open(jsonlPath, "bob")
+	if err := alice.Update("note", appendLine("alice note")); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := bob.Update("note", appendLine("bob note")); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	aliceContent, _ := alice.Read()
+	bobContent, _ := bob.Read()
+	if aliceContent != "alice note\n" || bobContent != "bob note\n" {
+		t.Errorf("Namespaces leaked: alice=%q bob=%q", aliceContent, bobContent)
+	}
+
+	if _, err := Open(path, "../escape"); err == nil {
+		t.Error("Expected invalid namespace error")
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	for _, name := range []string{"COMANDA.md", "memory.jsonl"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+
+			// Separate store instances simulate separate processes
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					store, _ := Open(path, "")
+					if err := store.Update("append", appendLine(strings.Repeat("x", i+1))); err != nil {
+						t.Errorf("Update failed: %v", err)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			store, _ := Open(path, "")
+			content, _ := store.Read()
+			if lines := strings.Count(content, "\n"); lines != 20 {
+				t.Errorf("Expected 20 lines, got %d; concurrent writes were lost", lines)
+			}
+			versions, _ := store.History()
+			if len(versions) != 20 {
+				t.Errorf("Expected 20 versions, got %d", len(versions))
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory.jsonl")
+	main, _ := Open(path, "")
+	other, _ := Open(path, "other")
+	for i := 0; i < 5; i++ {
+		main.Update("append", appendLine("main"))
+	}
+	other.Update("append", appendLine("other"))
+
+	removed, err := main.Prune(2)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("Expected 3 versions removed, got %d", removed)
+	}
+
+	versions, _ := main.History()
+	if len(versions) != 2 || versions[0].ID != 4 {
+		t.Errorf("Expected versions 4 and 5 to remain, got %+v", versions)
+	}
+	content, _ := main.Read()
+	if strings.Count(content, "main") != 5 {
+		t.Errorf("Pruning changed the current content: %q", content)
+	}
+	otherVersions, _ := other.History()
+	if len(otherVersions) != 1 {
+		t.Errorf("Pruning touched another namespace: %+v", otherVersions)
+	}
+
+	if _, err := main.Prune(0); err == nil {
+		t.Error("Expected an error when keeping no versions")
+	}
+}
+
+func TestUpdateKeepsHistoryBounded(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{filepath.Join(dir, "COMANDA.md"), filepath.Join(dir, "memory.jsonl")} {
+		store, _ := Open(path, "")
+		for i := 0; i < DefaultHistoryKeep+5; i++ {
+			if err := store.Update("append", appendLine("entry")); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+		}
+
+		versions, err := store.History()
+		if err != nil {
+			t.Fatalf("History failed: %v", err)
+		}
+		if len(versions) != DefaultHistoryKeep || versions[0].ID != 6 || versions[len(versions)-1].ID != DefaultHistoryKeep+5 {
+			t.Errorf("%s: expected the newest %d versions, got %d starting at %d", path, DefaultHistoryKeep, len(versions), versions[0].ID)
+		}
+		content, _ := store.Read()
+		if strings.Count(content, "entry") != DefaultHistoryKeep+5 {
+			t.Errorf("%s: trimming the history changed the content: %q", path, content)
+		}
+	}
+}
+
+func TestSectionHistory(t *testing.T) {
+	versions := []Version{
+		{ID: 1, Content: "## Status\nstarted\n"},
+		{ID: 2, Content: "## Status\nstarted\n## Notes\nhello\n"},
+		{ID: 3, Content: "## Status\ndone\n## Notes\nhello\n"},
+	}
+	history := SectionHistory(versions, "Status")
+	if len(history) != 2 || history[0].ID != 1 || history[1].ID != 3 || history[1].Content != "done" {
+		t.Errorf("Unexpected section history: %+v", history)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 
@@ -15,6 +16,21 @@ import (
 	"github.com/kris-hansen/comanda/utils/retry"
 )
 
+// defaultAnthropicBaseURL is the root of the Anthropic API
+const defaultAnthropicBaseURL = "https://api.anthropic.com"
+
+// anthropicBaseURL returns the API root. ANTHROPIC_BASE_URL points requests at
+// another server, such as a proxy or a local mock server in tests.
+func anthropicBaseURL() string {
+	if baseURL := strings.TrimRight(os.Getenv("ANTHROPIC_BASE_URL"), "/"); baseURL != "" {
+		return baseURL
+	}
+	return defaultAnthropicBaseURL
+}
+
+// anthropicPDFBeta enables PDF documents in requests
+const anthropicPDFBeta = "pdfs-2024-09-25"
+
 // AnthropicProvider handles Anthropic family of models
 type AnthropicProvider struct {
 	apiKey  string
@@ -34,6 +50,18 @@ func NewAnthropicProvider() *AnthropicProvider {
 	}
 }
 
+func init() {
+	Register(ProviderFactory{
+		Name:         "anthropic",
+		DisplayName:  "Anthropic",
+		New:          func() Provider { return NewAnthropicProvider() },
+		Priority:     40,
+		ConfigSchema: []ConfigField{apiKeyField},
+		Discover:     registryModels("anthropic"),
+		Capabilities: []Capability{CapabilityText, CapabilityVision},
+	})
+}
+
 // debugf prints debug information if verbose mode is enabled (thread-safe)
 func (a *AnthropicProvider) debugf(format string, args ...interface{}) {
 	if a.verbose {
@@ -86,15 +114,23 @@ type anthropicSource struct {
 }
 
 type anthropicRequest struct {
-	Model       string             `json:"model"`
-	Messages    []anthropicMessage `json:"messages"`
-	MaxTokens   int                `json:"max_tokens"`
-	Temperature float64            `json:"temperature,omitempty"`
-	TopP        float64            `json:"top_p,omitempty"`
+	Model         string             `json:"model"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Thinking      *anthropicThinking `json:"thinking,omitempty"`
+}
+
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
 }
 
 type anthropicResponse struct {
 	Content []struct {
+		Type string `json:"type"`
 		Text string `json:"text"`
 	} `json:"content"`
 	Error *struct {
@@ -135,81 +171,9 @@ func (a *AnthropicProvider) SendPrompt(modelName string, prompt string) (string,
 		},
 		MaxTokens: a.config.MaxTokens,
 	}
+	a.applyParams(&reqBody)
 
-	// Claude 4+ models only support either temperature OR top_p, not both
-	// Prefer temperature over top_p
-	reqBody.Temperature = a.config.Temperature
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
-	}
-
-	// Use retry mechanism for API calls
-	result, err := retry.WithRetry(
-		func() (interface{}, error) {
-			req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
-			if err != nil {
-				return "", fmt.Errorf("failed to create request: %v", err)
-			}
-
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("x-api-key", a.apiKey)
-			req.Header.Set("anthropic-version", "2023-06-01")
-
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				return "", fmt.Errorf("failed to send request: %v", err)
-			}
-			defer resp.Body.Close()
-
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return "", fmt.Errorf("failed to read response: %v", err)
-			}
-
-			// Check for rate limit errors (429)
-			if resp.StatusCode == http.StatusTooManyRequests {
-				return "", fmt.Errorf("API request failed with status 429: %s", string(body))
-			}
-
-			if resp.StatusCode != http.StatusOK {
-				return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-			}
-
-			var response anthropicResponse
-			if err := json.Unmarshal(body, &response); err != nil {
-				return "", fmt.Errorf("failed to unmarshal response: %v", err)
-			}
-
-			if response.Error != nil {
-				// Check if the error is related to rate limiting
-				if strings.Contains(strings.ToLower(response.Error.Message), "rate limit") ||
-					strings.Contains(strings.ToLower(response.Error.Message), "quota") {
-					return "", fmt.Errorf("API rate limit error: %s", response.Error.Message)
-				}
-				return "", fmt.Errorf("API error: %s", response.Error.Message)
-			}
-
-			if len(response.Content) == 0 {
-				return "", fmt.Errorf("no response content returned from Anthropic")
-			}
-
-			return response.Content[0].Text, nil
-		},
-		retry.Is429Error,
-		retry.DefaultRetryConfig,
-	)
-
-	if err != nil {
-		return "", err
-	}
-
-	responseText := result.(string)
-	a.debugf("API call completed, response length: %d characters", len(responseText))
-
-	return responseText, nil
+	return a.send(reqBody, "")
 }
 
 // SendPromptWithFile sends a prompt along with a file to the specified model and returns the response
@@ -290,11 +254,80 @@ func (a *AnthropicProvider) SendPromptWithFile(modelName string, prompt string,
 		},
 		MaxTokens: a.config.MaxTokens,
 	}
+	a.applyParams(&reqBody)
+
+	// Add beta header for PDF support when sending PDF files
+	var beta string
+	if file.MimeType == "application/pdf" {
+		beta = anthropicPDFBeta
+	}
+	return a.send(reqBody, beta)
+}
+
+// SendPromptWithFiles sends a prompt with several files in a single request.
+// Images and PDFs are attached as content blocks and other files as labelled text.
+func (a *AnthropicProvider) SendPromptWithFiles(modelName string, prompt string, files []FileInput) (string, error) {
+	a.debugf("Preparing to send prompt with %d files to model: %s", len(files), modelName)
+
+	if a.apiKey == "" {
+		return "", fmt.Errorf("Anthropic provider not configured: missing API key")
+	}
+
+	if !a.ValidateModel(modelName) {
+		return "", fmt.Errorf("invalid Anthropic model: %s", modelName)
+	}
+
+	attachments, err := loadAttachments(files)
+	if err != nil {
+		return "", err
+	}
+
+	content, beta := anthropicAttachmentContent(prompt, attachments)
+
+	reqBody := anthropicRequest{
+		Model:     modelName,
+		Messages:  []anthropicMessage{{Role: "user", Content: content}},
+		MaxTokens: a.config.MaxTokens,
+	}
+	a.applyParams(&reqBody)
 
-	// Claude 4+ models only support either temperature OR top_p, not both
-	// Prefer temperature over top_p
-	reqBody.Temperature = a.config.Temperature
+	return a.send(reqBody, beta)
+}
+
+// anthropicAttachmentContent builds the content blocks for a prompt with
+// attachments: a label and a block per image or PDF, labelled text for other
+// files, then the prompt. It also returns the beta feature the blocks require.
+func anthropicAttachmentContent(prompt string, attachments []attachment) ([]anthropicContent, string) {
+	var content []anthropicContent
+	var beta string
+	for i, file := range attachments {
+		switch {
+		case file.isImage(), file.isPDF():
+			blockType := "image"
+			if file.isPDF() {
+				blockType = "document"
+				beta = anthropicPDFBeta
+			}
+			content = append(content,
+				anthropicContent{Type: "text", Text: file.label(i)},
+				anthropicContent{
+					Type: blockType,
+					Source: &anthropicSource{
+						Type:      "base64",
+						MediaType: file.mimeType,
+						Data:      file.base64Data(),
+					},
+				})
+		default:
+			content = append(content, anthropicContent{Type: "text", Text: file.text(i)})
+		}
+	}
+	return append(content, anthropicContent{Type: "text", Text: prompt}), beta
+}
 
+// send posts a messages request and returns the text of the response. beta
+// names an optional beta feature to enable for the request.
+func (a *AnthropicProvider) send(reqBody anthropicRequest, beta string) (string, error) {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal request: %v", err)
@@ -303,19 +336,12 @@ func (a *AnthropicProvider) SendPromptWithFile(modelName string, prompt string,
 	// Use retry mechanism for API calls
 	result, err := retry.WithRetry(
 		func() (interface{}, error) {
-			req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+			req, err := http.NewRequest("POST", anthropicBaseURL()+"/v1/messages", bytes.NewBuffer(jsonData))
 			if err != nil {
 				return "", fmt.Errorf("failed to create request: %v", err)
 			}
 
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("x-api-key", a.apiKey)
-			req.Header.Set("anthropic-version", "2023-06-01")
-
-			// Add beta header for PDF support when sending PDF files
-			if file.MimeType == "application/pdf" {
-				req.Header.Set("anthropic-beta", "pdfs-2024-09-25")
-			}
+			a.setHeaders(req, beta)
 
 			client := &http.Client{}
 			resp, err := client.Do(req)
@@ -352,11 +378,7 @@ func (a *AnthropicProvider) SendPromptWithFile(modelName string, prompt string,
 				return "", fmt.Errorf("API error: %s", response.Error.Message)
 			}
 
-			if len(response.Content) == 0 {
-				return "", fmt.Errorf("no response content returned from Anthropic")
-			}
-
-			return response.Content[0].Text, nil
+			return response.text()
 		},
 		retry.Is429Error,
 		retry.DefaultRetryConfig,
@@ -403,7 +425,262 @@ func (a *AnthropicProvider) GetConfig() ModelConfig {
 	return a.config
 }
 
+// SupportedParams lists the generation parameters the model accepts
+func (a *AnthropicProvider) SupportedParams(modelName string) []string {
+	return thinkingParams
+}
+
+// applyParams sets the sampling and thinking parameters of a request
+func (a *AnthropicProvider) applyParams(reqBody *anthropicRequest) {
+	params := a.config.Params
+	reqBody.StopSequences = params.Stop
+
+	if params.ThinkingBudget != nil && *params.ThinkingBudget > 0 {
+		// Extended thinking requires the default sampling settings and a token
+		// limit above the thinking budget
+		budget := *params.ThinkingBudget
+		reqBody.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+		if reqBody.MaxTokens <= budget {
+			reqBody.MaxTokens = budget + a.config.MaxTokens
+		}
+		a.debugf("Extended thinking enabled: budget=%d, max_tokens=%d", budget, reqBody.MaxTokens)
+		return
+	}
+
+	// Claude 4+ models only support either temperature OR top_p, not both.
+	// Prefer temperature unless a step sets only top_p.
+	if params.TopP != nil && params.Temperature == nil {
+		topP := a.config.TopP
+		reqBody.TopP = &topP
+		return
+	}
+	temperature := a.config.Temperature
+	reqBody.Temperature = &temperature
+	if params.TopP != nil {
+		topP := a.config.TopP
+		reqBody.TopP = &topP
+	}
+}
+
+// text returns the text blocks of a response, skipping thinking blocks
+func (r anthropicResponse) text() (string, error) {
+	var parts []string
+	for _, block := range r.Content {
+		if block.Type == "" || block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("no response content returned from Anthropic")
+	}
+	return strings.Join(parts, ""), nil
+}
+
 // SetVerbose enables or disables verbose mode
 func (a *AnthropicProvider) SetVerbose(verbose bool) {
 	a.verbose = verbose
 }
+
+// anthropicBatchRequest is one request of a Message Batches submission
+type anthropicBatchRequest struct {
+	CustomID string           `json:"custom_id"`
+	Params   anthropicRequest `json:"params"`
+}
+
+// anthropicBatch is a Message Batches API batch
+type anthropicBatch struct {
+	ID               string `json:"id"`
+	ProcessingStatus string `json:"processing_status"`
+	RequestCounts    struct {
+		Processing int `json:"processing"`
+		Succeeded  int `json:"succeeded"`
+		Errored    int `json:"errored"`
+		Canceled   int `json:"canceled"`
+		Expired    int `json:"expired"`
+	} `json:"request_counts"`
+	ResultsURL string `json:"results_url"`
+}
+
+// anthropicBatchLine is a line of a batch results file
+type anthropicBatchLine struct {
+	CustomID string `json:"custom_id"`
+	Result   struct {
+		Type    string            `json:"type"`
+		Message anthropicResponse `json:"message"`
+		Error   struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"error"`
+	} `json:"result"`
+}
+
+// SubmitBatch submits the requests to the Message Batches API, which processes
+// them within 24 hours at a discount
+func (a *AnthropicProvider) SubmitBatch(requests []BatchRequest) (string, error) {
+	a.debugf("Submitting batch of %d requests", len(requests))
+
+	if a.apiKey == "" {
+		return "", fmt.Errorf("Anthropic provider not configured: missing API key")
+	}
+
+	var body struct {
+		Requests []anthropicBatchRequest `json:"requests"`
+	}
+	var beta string
+	for _, request := range requests {
+		if !a.ValidateModel(request.Model) {
+			return "", fmt.Errorf("invalid Anthropic model: %s", request.Model)
+		}
+		var attachments []attachment
+		if len(request.Files) > 0 {
+			var err error
+			if attachments, err = loadAttachments(request.Files); err != nil {
+				return "", fmt.Errorf("batch request %s: %w", request.CustomID, err)
+			}
+		}
+		content, requestBeta := anthropicAttachmentContent(request.Prompt, attachments)
+		if requestBeta != "" {
+			beta = requestBeta
+		}
+		params := anthropicRequest{
+			Model:     request.Model,
+			Messages:  []anthropicMessage{{Role: "user", Content: content}},
+			MaxTokens: a.config.MaxTokens,
+		}
+		a.applyParams(&params)
+		body.Requests = append(body.Requests, anthropicBatchRequest{CustomID: request.CustomID, Params: params})
+	}
+
+	var batch anthropicBatch
+	if err := a.batchCall("POST", anthropicBaseURL()+"/v1/messages/batches", body, beta, &batch); err != nil {
+		return "", fmt.Errorf("failed to create batch: %w", err)
+	}
+
+	a.debugf("Created batch %s", batch.ID)
+	return batch.ID, nil
+}
+
+// GetBatch returns the progress of a batch
+func (a *AnthropicProvider) GetBatch(batchID string) (BatchStatus, error) {
+	batch, err := a.retrieveBatch(batchID)
+	if err != nil {
+		return BatchStatus{}, err
+	}
+
+	counts := batch.RequestCounts
+	status := BatchStatus{
+		ID:        batch.ID,
+		State:     BatchInProgress,
+		Total:     counts.Processing + counts.Succeeded + counts.Errored + counts.Canceled + counts.Expired,
+		Completed: counts.Succeeded,
+		Failed:    counts.Errored + counts.Canceled + counts.Expired,
+	}
+	if batch.ProcessingStatus == "ended" {
+		status.State = BatchCompleted
+	}
+	return status, nil
+}
+
+// BatchResults downloads the results of a finished batch
+func (a *AnthropicProvider) BatchResults(batchID string) ([]BatchResult, error) {
+	batch, err := a.retrieveBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	if batch.ResultsURL == "" {
+		return nil, fmt.Errorf("batch %s has no results yet (status %s)", batchID, batch.ProcessingStatus)
+	}
+
+	req, err := http.NewRequest("GET", batch.ResultsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	a.setHeaders(req, "")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download batch results: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to download batch results: status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var results []BatchResult
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var line anthropicBatchLine
+		if err := decoder.Decode(&line); err != nil {
+			return nil, fmt.Errorf("failed to parse batch results: %v", err)
+		}
+		result := BatchResult{CustomID: line.CustomID}
+		switch line.Result.Type {
+		case "succeeded":
+			if result.Response, err = line.Result.Message.text(); err != nil {
+				result.Error = err.Error()
+			}
+		case "errored":
+			result.Error = line.Result.Error.Error.Message
+		default:
+			result.Error = "request " + line.Result.Type
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// retrieveBatch returns a batch by ID
+func (a *AnthropicProvider) retrieveBatch(batchID string) (anthropicBatch, error) {
+	var batch anthropicBatch
+	if err := a.batchCall("GET", anthropicBaseURL()+"/v1/messages/batches/"+batchID, nil, "", &batch); err != nil {
+		return batch, fmt.Errorf("failed to retrieve batch %s: %w", batchID, err)
+	}
+	return batch, nil
+}
+
+// batchCall sends a Message Batches API request and decodes the response into result
+func (a *AnthropicProvider) batchCall(method string, url string, body interface{}, beta string, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %v", err)
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	a.setHeaders(req, beta)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+	return nil
+}
+
+// setHeaders adds the authentication and version headers to a request
+func (a *AnthropicProvider) setHeaders(req *http.Request, beta string) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", a.apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	if beta != "" {
+		req.Header.Set("anthropic-beta", beta)
+	}
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/fileutil"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// MultiFileProvider extends Provider with requests that attach several files,
+// such as two screenshots to compare or a specification and a diagram
+type MultiFileProvider interface {
+	Provider
+	SendPromptWithFiles(modelName string, prompt string, files []FileInput) (string, error)
+}
+
+// attachment is a file loaded for a multi-file request
+type attachment struct {
+	path     string
+	mimeType string
+	data     []byte
+}
+
+// loadAttachments reads the files to attach. Files whose data is already loaded
+// are not read again, and data URIs, as produced for images and screenshots, are
+// decoded to the raw bytes.
+func loadAttachments(files []FileInput) ([]attachment, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files to attach")
+	}
+	attachments := make([]attachment, 0, len(files))
+	for _, file := range files {
+		data := file.Data
+		if data == nil {
+			var err error
+			if data, err = fileutil.SafeReadFile(file.Path); err != nil {
+				return nil, fmt.Errorf("failed to read file %s: %v", file.Path, err)
+			}
+		}
+		a := attachment{path: file.Path, mimeType: file.MimeType, data: data}
+		if mimeType, raw, ok := decodeDataURL(data); ok {
+			a.mimeType, a.data = mimeType, raw
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
+
+// decodeDataURL decodes a base64 data URI such as "data:image/png;base64,..."
+func decodeDataURL(data []byte) (string, []byte, bool) {
+	value := string(data)
+	if !strings.HasPrefix(value, "data:") {
+		return "", nil, false
+	}
+	header, encoded, ok := strings.Cut(strings.TrimPrefix(value, "data:"), ";base64,")
+	if !ok {
+		return "", nil, false
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", nil, false
+	}
+	return header, raw, true
+}
+
+// isImage reports whether the attachment is an image
+func (a attachment) isImage() bool {
+	return strings.HasPrefix(a.mimeType, "image/")
+}
+
+// isPDF reports whether the attachment is a PDF document
+func (a attachment) isPDF() bool {
+	return a.mimeType == "application/pdf"
+}
+
+// base64Data returns the attachment encoded as base64
+func (a attachment) base64Data() string {
+	return base64.StdEncoding.EncodeToString(a.data)
+}
+
+// dataURL returns the attachment as a base64 data URI
+func (a attachment) dataURL() string {
+	return fmt.Sprintf("data:%s;base64,%s", a.mimeType, a.base64Data())
+}
+
+// label names the attachment so that the prompt can refer to it, e.g. "File 2 (after.png):"
+func (a attachment) label(index int) string {
+	return fmt.Sprintf("File %d (%s):", index+1, a.path)
+}
+
+// text returns the label followed by the contents of a text attachment
+func (a attachment) text(index int) string {
+	return fmt.Sprintf("%s\n%s", a.label(index), string(a.data))
+}
+
+// rejectPDFs returns an error naming the first PDF attachment, for providers
+// that only accept images and text
+func rejectPDFs(providerName string, attachments []attachment) error {
+	for _, a := range attachments {
+		if a.isPDF() {
+			return fmt.Errorf("%s does not accept PDF attachments (%s); convert it to text or use a Claude or Gemini model", providerName, a.path)
+		}
+	}
+	return nil
+}
+
+// chatAttachmentMessage builds a chat completions user message with one labelled
+// part per attachment followed by the prompt. Images are sent as vision content
+// and other files as text.
+func chatAttachmentMessage(prompt string, attachments []attachment) openai.ChatCompletionMessage {
+	var parts []openai.ChatMessagePart
+	for i, a := range attachments {
+		if a.isImage() {
+			parts = append(parts,
+				openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: a.label(i)},
+				openai.ChatMessagePart{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: a.dataURL()}})
+			continue
+		}
+		parts = append(parts, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: a.text(i)})
+	}
+	parts = append(parts, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: prompt})
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: parts}
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pngDataURL is a data URI as the input handler produces for images
+const pngDataURL = "data:image/png;base64,iVBORw0KGgo="
+
+// writeAttachment writes a text file to attach and returns it as a FileInput
+func writeAttachment(t *testing.T, name string, contents string) FileInput {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return FileInput{Path: path, MimeType: "text/plain"}
+}
+
+func TestLoadAttachments(t *testing.T) {
+	spec := writeAttachment(t, "spec.txt", "The button is blue")
+	attachments, err := loadAttachments([]FileInput{
+		spec,
+		{Path: "screenshot", MimeType: "image/png", Data: []byte(pngDataURL)},
+	})
+	if err != nil {
+		t.Fatalf("loadAttachments failed: %v", err)
+	}
+	if string(attachments[0].data) != "The button is blue" || attachments[0].isImage() {
+		t.Errorf("Unexpected text attachment: %+v", attachments[0])
+	}
+	raw, _ := base64.StdEncoding.DecodeString("iVBORw0KGgo=")
+	if !attachments[1].isImage() || string(attachments[1].data) != string(raw) {
+		t.Errorf("The data URI should be decoded, got %q", attachments[1].data)
+	}
+	if attachments[1].dataURL() != pngDataURL {
+		t.Errorf("dataURL = %q", attachments[1].dataURL())
+	}
+
+	if _, err := loadAttachments([]FileInput{{Path: filepath.Join(t.TempDir(), "missing.txt")}}); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+	if err := rejectPDFs("Ollama", []attachment{{path: "spec.pdf", mimeType: "application/pdf"}}); err == nil || !strings.Contains(err.Error(), "spec.pdf") {
+		t.Errorf("Expected a PDF error, got %v", err)
+	}
+}
+
+func TestAnthropicSendPromptWithFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("anthropic-beta"); got != anthropicPDFBeta {
+			t.Errorf("anthropic-beta = %q, want the PDF beta", got)
+		}
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		var types []string
+		for _, block := range req.Messages[0].Content {
+			types = append(types, block.Type)
+		}
+		if got := strings.Join(types, ","); got != "text,image,text,document,text,text" {
+			t.Errorf("Content blocks = %s", got)
+		}
+		if last := req.Messages[0].Content[len(types)-1]; last.Text != "Compare them" {
+			t.Errorf("The prompt should come last, got %q", last.Text)
+		}
+		w.Write([]byte(`{"content":[{"type":"text","text":"They differ"}]}`))
+	}))
+	defer server.Close()
+	t.Setenv("ANTHROPIC_BASE_URL", server.URL)
+
+	provider := NewAnthropicProvider()
+	provider.Configure("test-key")
+	response, err := provider.SendPromptWithFiles("claude-sonnet-4-5", "Compare them", []FileInput{
+		{Path: "before.png", MimeType: "image/png", Data: []byte(pngDataURL)},
+		{Path: "spec.pdf", MimeType: "application/pdf", Data: []byte("%PDF-1.4")},
+		writeAttachment(t, "notes.txt", "notes"),
+	})
+	if err != nil || response != "They differ" {
+		t.Errorf("SendPromptWithFiles = %q, %v", response, err)
+	}
+}
+
+func TestCompatibleSendPromptWithFiles(t *testing.T) {
+	server := newCompatibleServer(t, nil, func(req map[string]interface{}) {
+		message := req["messages"].([]interface{})[0].(map[string]interface{})
+		parts := message["content"].([]interface{})
+		var types []string
+		for _, part := range parts {
+			types = append(types, part.(map[string]interface{})["type"].(string))
+		}
+		if got := strings.Join(types, ","); got != "text,image_url,text,image_url,text" {
+			t.Errorf("Message parts = %s", got)
+		}
+	})
+	defer server.Close()
+
+	provider := NewOpenAICompatibleProvider(OpenAICompatibleConfig{Name: "local", BaseURL: server.URL + "/v1", Auth: AuthNone})
+	provider.Configure("")
+	image := FileInput{Path: "a.png", MimeType: "image/png", Data: []byte(pngDataURL)}
+	second := image
+	second.Path = "b.png"
+	if _, err := provider.SendPromptWithFiles("llava", "Which is newer?", []FileInput{image, second}); err != nil {
+		t.Errorf("SendPromptWithFiles failed: %v", err)
+	}
+}
+
+func TestOllamaSendPromptWithFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OllamaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if len(req.Images) != 1 || req.Images[0] != "iVBORw0KGgo=" {
+			t.Errorf("Images = %v", req.Images)
+		}
+		if !strings.Contains(req.Prompt, "diagram.png): [image 1]") || !strings.Contains(req.Prompt, "spec contents") {
+			t.Errorf("Unexpected prompt: %s", req.Prompt)
+		}
+		json.NewEncoder(w).Encode(OllamaResponse{Response: "ok", Done: true})
+	}))
+	defer server.Close()
+
+	provider := NewOllamaHostProvider(EndpointConfig{Name: "ollama", Endpoint: server.URL})
+	response, err := provider.SendPromptWithFiles("llava", "Does the diagram match the spec?", []FileInput{
+		writeAttachment(t, "spec.txt", "spec contents"),
+		{Path: "diagram.png", MimeType: "image/png", Data: []byte(pngDataURL)},
+	})
+	if err != nil || response != "ok" {
+		t.Errorf("SendPromptWithFiles = %q, %v", response, err)
+	}
+}
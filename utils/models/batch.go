@@ -0,0 +1,113 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// BatchRequest is one request of an asynchronous provider batch
+type BatchRequest struct {
+	// CustomID identifies the request in the batch results
+	CustomID string
+	Model    string
+	Prompt   string
+	// Files are attached to the request like SendPromptWithFiles does
+	Files []FileInput
+}
+
+// BatchResult is the outcome of one request of a batch
+type BatchResult struct {
+	CustomID string
+	Response string
+	// Error is set when the request failed; Response is empty then
+	Error string
+}
+
+// Batch states, normalized across providers
+const (
+	BatchInProgress = "in_progress" // Submitted and not finished yet
+	BatchCompleted  = "completed"   // Finished; results are available
+	BatchFailed     = "failed"      // Failed, expired or cancelled as a whole
+)
+
+// BatchStatus describes the progress of a batch
+type BatchStatus struct {
+	ID        string
+	State     string
+	Total     int
+	Completed int
+	Failed    int
+	// Message explains a failed batch
+	Message string
+}
+
+// Done reports whether the batch has finished, successfully or not
+func (s BatchStatus) Done() bool {
+	return s.State != BatchInProgress
+}
+
+// String summarizes the progress, e.g. "in_progress (12/300 done, 1 failed)"
+func (s BatchStatus) String() string {
+	summary := fmt.Sprintf("%s (%d/%d done, %d failed)", s.State, s.Completed+s.Failed, s.Total, s.Failed)
+	if s.Message != "" {
+		summary += ": " + s.Message
+	}
+	return summary
+}
+
+// BatchProvider extends Provider with discounted asynchronous batch processing,
+// for large offline jobs that don't need real-time answers
+type BatchProvider interface {
+	Provider
+	// SubmitBatch submits the requests as one batch and returns its ID
+	SubmitBatch(requests []BatchRequest) (string, error)
+	// GetBatch returns the progress of a batch
+	GetBatch(batchID string) (BatchStatus, error)
+	// BatchResults returns the results of a finished batch
+	BatchResults(batchID string) ([]BatchResult, error)
+}
+
+// batchChatMessage builds the chat completions message of a batch request.
+// Images are sent as vision content and text files as part of the prompt.
+func batchChatMessage(request BatchRequest) (openai.ChatCompletionMessage, error) {
+	if len(request.Files) == 0 {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: request.Prompt}, nil
+	}
+	attachments, err := loadAttachments(request.Files)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	if err := rejectPDFs("OpenAI", attachments); err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	if hasImages(attachments) {
+		return chatAttachmentMessage(request.Prompt, attachments), nil
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: batchRequestPrompt(request.Prompt, attachments)}, nil
+}
+
+// batchRequestPrompt builds the text of a batch request without images, in the
+// format SendPromptWithFile uses for a single text file
+func batchRequestPrompt(prompt string, attachments []attachment) string {
+	if len(attachments) == 1 {
+		return fmt.Sprintf("File content:\n%s\n\nUser prompt: %s", string(attachments[0].data), prompt)
+	}
+	var sections []string
+	for i, a := range attachments {
+		sections = append(sections, a.text(i))
+	}
+	sections = append(sections, "User prompt: "+prompt)
+	return strings.Join(sections, "\n\n")
+}
+
+// hasImages reports whether any attachment is an image
+func hasImages(attachments []attachment) bool {
+	for _, a := range attachments {
+		if a.isImage() {
+			return true
+		}
+	}
+	return false
+}
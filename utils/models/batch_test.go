@@ -0,0 +1,111 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models/batchtest"
+)
+
+// runBatch submits requests, polls the batch until it is done and returns its results
+func runBatch(t *testing.T, provider BatchProvider, requests []BatchRequest) (BatchStatus, []BatchResult) {
+	batchID, err := provider.SubmitBatch(requests)
+	if err != nil {
+		t.Fatalf("SubmitBatch failed: %v", err)
+	}
+	status, err := provider.GetBatch(batchID)
+	if err != nil {
+		t.Fatalf("GetBatch failed: %v", err)
+	}
+	if status.Done() {
+		t.Fatalf("The batch should still be in progress, got %s", status)
+	}
+	if status, err = provider.GetBatch(batchID); err != nil {
+		t.Fatalf("GetBatch failed: %v", err)
+	}
+	if status.State != BatchCompleted {
+		t.Fatalf("The batch should be completed, got %s", status)
+	}
+	results, err := provider.BatchResults(batchID)
+	if err != nil {
+		t.Fatalf("BatchResults failed: %v", err)
+	}
+	return status, results
+}
+
+// batchRequests returns two requests with a text file each; the second one fails on the server
+func batchRequests(t *testing.T, server *batchtest.Server, model string) []BatchRequest {
+	server.PollsUntilDone = 1
+	server.Respond = func(customID string, prompt string) (string, error) {
+		if customID == "file-1" {
+			return "", fmt.Errorf("overloaded")
+		}
+		return "summary of " + customID, nil
+	}
+	return []BatchRequest{
+		{CustomID: "file-0", Model: model, Prompt: "Summarize", Files: []FileInput{writeAttachment(t, "a.txt", "first file")}},
+		{CustomID: "file-1", Model: model, Prompt: "Summarize", Files: []FileInput{writeAttachment(t, "b.txt", "second file")}},
+	}
+}
+
+// checkBatchResults verifies the results of the requests from batchRequests
+func checkBatchResults(t *testing.T, server *batchtest.Server, status BatchStatus, results []BatchResult) {
+	if status.Completed != 1 || status.Failed != 1 {
+		t.Errorf("Unexpected counts: %s", status)
+	}
+	byID := make(map[string]BatchResult)
+	for _, result := range results {
+		byID[result.CustomID] = result
+	}
+	if byID["file-0"].Response != "summary of file-0" || byID["file-0"].Error != "" {
+		t.Errorf("Unexpected result for file-0: %+v", byID["file-0"])
+	}
+	if !strings.Contains(byID["file-1"].Error, "overloaded") {
+		t.Errorf("Expected an error for file-1, got %+v", byID["file-1"])
+	}
+	requests := server.Requests()
+	if len(requests) != 2 || !strings.Contains(requests[0].Prompt, "first file") || !strings.Contains(requests[0].Prompt, "Summarize") {
+		t.Errorf("The file contents and prompt should be sent, got %+v", requests)
+	}
+}
+
+func TestOpenAIBatch(t *testing.T) {
+	server := batchtest.NewServer()
+	defer server.Close()
+	t.Setenv("OPENAI_BASE_URL", server.OpenAIBaseURL())
+
+	provider := NewOpenAIProvider()
+	provider.Configure("test-key")
+	requests := batchRequests(t, server, "gpt-4o-mini")
+	status, results := runBatch(t, provider, requests)
+	checkBatchResults(t, server, status, results)
+	if model := server.Requests()[0].Model; model != "gpt-4o-mini" {
+		t.Errorf("Model = %q", model)
+	}
+}
+
+func TestAnthropicBatch(t *testing.T) {
+	server := batchtest.NewServer()
+	defer server.Close()
+	t.Setenv("ANTHROPIC_BASE_URL", server.AnthropicBaseURL())
+
+	provider := NewAnthropicProvider()
+	provider.Configure("test-key")
+	requests := batchRequests(t, server, "claude-sonnet-4-5")
+	status, results := runBatch(t, provider, requests)
+	checkBatchResults(t, server, status, results)
+}
+
+func TestBatchChatMessage(t *testing.T) {
+	message, err := batchChatMessage(BatchRequest{Prompt: "Describe it", Files: []FileInput{{Path: "shot.png", MimeType: "image/png", Data: []byte(pngDataURL)}}})
+	if err != nil {
+		t.Fatalf("batchChatMessage failed: %v", err)
+	}
+	if len(message.MultiContent) != 3 || message.MultiContent[1].ImageURL == nil {
+		t.Errorf("Images should be sent as vision content, got %+v", message.MultiContent)
+	}
+	if _, err := batchChatMessage(BatchRequest{Prompt: "Read it", Files: []FileInput{{Path: "spec.pdf", MimeType: "application/pdf", Data: []byte("%PDF")}}}); err == nil {
+		t.Error("Expected an error for a PDF attachment")
+	}
+}
@@ -0,0 +1,378 @@
+// Package batchtest provides a local mock of the OpenAI and Anthropic batch
+// APIs for testing workflows that use execution: batch without network access.
+//
+// Point the providers at the server with environment variables:
+//
+//	server := batchtest.NewServer()
+//	defer server.Close()
+//	os.Setenv("OPENAI_BASE_URL", server.OpenAIBaseURL())
+//	os.Setenv("ANTHROPIC_BASE_URL", server.AnthropicBaseURL())
+package batchtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Server answers batch requests locally. Each batch reports itself in progress
+// for PollsUntilDone status checks and then completes with the answers of Respond.
+type Server struct {
+	*httptest.Server
+
+	// Respond returns the answer to one request of a batch; an error marks the
+	// request as failed. The default echoes the custom ID.
+	Respond func(customID string, prompt string) (string, error)
+	// PollsUntilDone is the number of status checks that report a batch as in
+	// progress before it completes
+	PollsUntilDone int
+
+	mu      sync.Mutex
+	files   map[string][]byte
+	batches map[string]*batch
+	nextID  int
+}
+
+// Request is a request received in a batch
+type Request struct {
+	CustomID string
+	Model    string
+	Prompt   string // The text parts of the user message, joined by newlines
+}
+
+// result is the answer to one request
+type result struct {
+	customID string
+	response string
+	err      string
+}
+
+// batch is a submitted batch
+type batch struct {
+	id       string
+	requests []Request
+	results  []result
+	polls    int
+}
+
+// NewServer starts a mock batch server
+func NewServer() *Server {
+	s := &Server{
+		files:   make(map[string][]byte),
+		batches: make(map[string]*batch),
+		Respond: func(customID string, prompt string) (string, error) {
+			return "response to " + customID, nil
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/files", s.handleOpenAIUpload)
+	mux.HandleFunc("/v1/files/", s.handleOpenAIFileContent)
+	mux.HandleFunc("/v1/batches", s.handleOpenAICreate)
+	mux.HandleFunc("/v1/batches/", s.handleOpenAIRetrieve)
+	mux.HandleFunc("/v1/messages/batches", s.handleAnthropicCreate)
+	mux.HandleFunc("/v1/messages/batches/", s.handleAnthropicBatch)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// OpenAIBaseURL returns the value for OPENAI_BASE_URL
+func (s *Server) OpenAIBaseURL() string {
+	return s.URL + "/v1"
+}
+
+// AnthropicBaseURL returns the value for ANTHROPIC_BASE_URL
+func (s *Server) AnthropicBaseURL() string {
+	return s.URL
+}
+
+// Batches returns the number of batches submitted
+func (s *Server) Batches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.batches)
+}
+
+// Requests returns the requests of all submitted batches in submission order
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var requests []Request
+	for i := 1; i <= s.nextID; i++ {
+		if b, ok := s.batches[fmt.Sprintf("batch_%d", i)]; ok {
+			requests = append(requests, b.requests...)
+		}
+	}
+	return requests
+}
+
+// submit answers the requests of a new batch and returns it
+func (s *Server) submit(requests []Request) *batch {
+	b := &batch{requests: requests}
+	for _, request := range requests {
+		response, err := s.Respond(request.CustomID, request.Prompt)
+		r := result{customID: request.CustomID, response: response}
+		if err != nil {
+			r.err = err.Error()
+		}
+		b.results = append(b.results, r)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	b.id = fmt.Sprintf("batch_%d", s.nextID)
+	s.batches[b.id] = b
+	return b
+}
+
+// poll counts a status check and reports whether the batch has completed
+func (s *Server) poll(id string) (*batch, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.batches[id]
+	if !ok {
+		return nil, false
+	}
+	b.polls++
+	return b, b.polls > s.PollsUntilDone
+}
+
+// lookup returns a batch without counting a status check
+func (s *Server) lookup(id string) (*batch, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.batches[id]
+	return b, ok && b.polls > s.PollsUntilDone
+}
+
+// counts returns the number of succeeded and failed requests of a batch
+func (b *batch) counts() (succeeded int, failed int) {
+	for _, r := range b.results {
+		if r.err != "" {
+			failed++
+		} else {
+			succeeded++
+		}
+	}
+	return succeeded, failed
+}
+
+// messageText joins the text of a message whose content is a string or a list
+// of parts with a "text" field
+func messageText(content json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(content, &parts)
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// chatRequest is the part of a chat or messages request the server reads
+type chatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+}
+
+// prompt returns the text of the last message
+func (r chatRequest) prompt() string {
+	if len(r.Messages) == 0 {
+		return ""
+	}
+	return messageText(r.Messages[len(r.Messages)-1].Content)
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func (s *Server) handleOpenAIUpload(w http.ResponseWriter, r *http.Request) {
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, _ := io.ReadAll(file)
+
+	s.mu.Lock()
+	id := fmt.Sprintf("file-%d", len(s.files)+1)
+	s.files[id] = data
+	s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{"id": id, "object": "file", "purpose": r.FormValue("purpose")})
+}
+
+func (s *Server) handleOpenAICreate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		InputFileID string `json:"input_file_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	data, ok := s.files[body.InputFileID]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown input file", http.StatusNotFound)
+		return
+	}
+
+	var requests []Request
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	for decoder.More() {
+		var line struct {
+			CustomID string      `json:"custom_id"`
+			Body     chatRequest `json:"body"`
+		}
+		if err := decoder.Decode(&line); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, Request{CustomID: line.CustomID, Model: line.Body.Model, Prompt: line.Body.prompt()})
+	}
+	b := s.submit(requests)
+	writeJSON(w, s.openAIBatch(b, false))
+}
+
+func (s *Server) handleOpenAIRetrieve(w http.ResponseWriter, r *http.Request) {
+	b, done := s.poll(strings.TrimPrefix(r.URL.Path, "/v1/batches/"))
+	if b == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, s.openAIBatch(b, done))
+}
+
+// openAIBatch describes a batch as the OpenAI API does
+func (s *Server) openAIBatch(b *batch, done bool) map[string]interface{} {
+	succeeded, failed := b.counts()
+	response := map[string]interface{}{
+		"id":             b.id,
+		"object":         "batch",
+		"status":         "in_progress",
+		"request_counts": map[string]int{"total": len(b.requests)},
+	}
+	if done {
+		response["status"] = "completed"
+		response["output_file_id"] = b.id + "-output"
+		response["request_counts"] = map[string]int{"total": len(b.requests), "completed": succeeded, "failed": failed}
+	}
+	return response
+}
+
+func (s *Server) handleOpenAIFileContent(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/files/"), "/content")
+	b, done := s.lookup(strings.TrimSuffix(id, "-output"))
+	if b == nil || !done {
+		http.NotFound(w, r)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	for _, result := range b.results {
+		line := map[string]interface{}{"custom_id": result.customID}
+		if result.err != "" {
+			line["error"] = map[string]string{"message": result.err}
+		} else {
+			line["response"] = map[string]interface{}{
+				"status_code": http.StatusOK,
+				"body": map[string]interface{}{
+					"choices": []map[string]interface{}{
+						{"index": 0, "message": map[string]string{"role": "assistant", "content": result.response}},
+					},
+				},
+			}
+		}
+		encoder.Encode(line)
+	}
+}
+
+func (s *Server) handleAnthropicCreate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Requests []struct {
+			CustomID string      `json:"custom_id"`
+			Params   chatRequest `json:"params"`
+		} `json:"requests"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var requests []Request
+	for _, request := range body.Requests {
+		requests = append(requests, Request{CustomID: request.CustomID, Model: request.Params.Model, Prompt: request.Params.prompt()})
+	}
+	b := s.submit(requests)
+	writeJSON(w, s.anthropicBatch(b, false))
+}
+
+func (s *Server) handleAnthropicBatch(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/messages/batches/")
+	if id, ok := strings.CutSuffix(path, "/results"); ok {
+		s.writeAnthropicResults(w, r, id)
+		return
+	}
+	b, done := s.poll(path)
+	if b == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, s.anthropicBatch(b, done))
+}
+
+// anthropicBatch describes a batch as the Anthropic API does
+func (s *Server) anthropicBatch(b *batch, done bool) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":                b.id,
+		"type":              "message_batch",
+		"processing_status": "in_progress",
+		"request_counts":    map[string]int{"processing": len(b.requests)},
+	}
+	if done {
+		succeeded, failed := b.counts()
+		response["processing_status"] = "ended"
+		response["request_counts"] = map[string]int{"succeeded": succeeded, "errored": failed}
+		response["results_url"] = fmt.Sprintf("%s/v1/messages/batches/%s/results", s.URL, b.id)
+	}
+	return response
+}
+
+func (s *Server) writeAnthropicResults(w http.ResponseWriter, r *http.Request, id string) {
+	b, done := s.lookup(id)
+	if b == nil || !done {
+		http.NotFound(w, r)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	for _, result := range b.results {
+		outcome := map[string]interface{}{"type": "succeeded"}
+		if result.err != "" {
+			outcome = map[string]interface{}{
+				"type":  "errored",
+				"error": map[string]interface{}{"type": "error", "error": map[string]string{"type": "api_error", "message": result.err}},
+			}
+		} else {
+			outcome["message"] = map[string]interface{}{
+				"content": []map[string]string{{"type": "text", "text": result.response}},
+			}
+		}
+		encoder.Encode(map[string]interface{}{"custom_id": result.customID, "result": outcome})
+	}
+}
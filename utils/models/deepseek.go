@@ -32,6 +32,18 @@ func NewDeepseekProvider() *DeepseekProvider {
 	}
 }
 
+func init() {
+	Register(ProviderFactory{
+		Name:         "deepseek",
+		DisplayName:  "Deepseek",
+		New:          func() Provider { return NewDeepseekProvider() },
+		Priority:     60,
+		ConfigSchema: []ConfigField{apiKeyField},
+		Discover:     registryModels("deepseek"),
+		Capabilities: []Capability{CapabilityText, CapabilityVision},
+	})
+}
+
 // Name returns the provider name
 func (d *DeepseekProvider) Name() string {
 	return "deepseek"
@@ -112,11 +124,22 @@ func (d *DeepseekProvider) createChatCompletionRequest(modelName string, message
 		req.MaxTokens = d.config.MaxTokens
 		req.Temperature = float32(d.config.Temperature)
 		req.TopP = float32(d.config.TopP)
+	} else if d.config.Params.MaxTokens != nil {
+		req.MaxTokens = d.config.MaxTokens
 	}
+	applyChatParams(&req, d.config)
 
 	return req
 }
 
+// SupportedParams lists the generation parameters the model accepts
+func (d *DeepseekProvider) SupportedParams(modelName string) []string {
+	if strings.HasSuffix(modelName, "reasoner") {
+		return fixedSamplingParams
+	}
+	return samplingParams
+}
+
 // SendPrompt sends a prompt to the specified model and returns the response
 func (d *DeepseekProvider) SendPrompt(modelName string, prompt string) (string, error) {
 	d.debugf("Preparing to send prompt to model: %s", modelName)
@@ -150,7 +173,7 @@ func (d *DeepseekProvider) SendPrompt(modelName string, prompt string) (string,
 			resp, err := client.CreateChatCompletion(context.Background(), req)
 
 			if err != nil {
-				return "", fmt.Errorf("Deepseek API error: %v", err)
+				return "", fmt.Errorf("Deepseek API error: %w", err)
 			}
 
 			if len(resp.Choices) == 0 {
@@ -219,7 +242,7 @@ func (d *DeepseekProvider) SendPromptWithFile(modelName string, prompt string, f
 			resp, err := client.CreateChatCompletion(context.Background(), req)
 
 			if err != nil {
-				return "", fmt.Errorf("Deepseek API error: %v", err)
+				return "", fmt.Errorf("Deepseek API error: %w", err)
 			}
 
 			if len(resp.Choices) == 0 {
@@ -290,7 +313,7 @@ func (d *DeepseekProvider) handleFileAsVision(client *openai.Client, prompt stri
 	resp, err := client.CreateChatCompletion(context.Background(), req)
 
 	if err != nil {
-		return "", fmt.Errorf("Deepseek Vision API error: %v", err)
+		return "", fmt.Errorf("Deepseek Vision API error: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
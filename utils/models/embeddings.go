@@ -0,0 +1,78 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/retry"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// embeddingBatchSize is the number of texts sent per embeddings request
+const embeddingBatchSize = 100
+
+// EmbeddingProvider extends Provider with text embedding capabilities
+type EmbeddingProvider interface {
+	Provider
+	Embed(modelName string, texts []string) ([][]float32, error)
+}
+
+// DetectEmbedderFunc is the type for the embedding provider detection function
+type DetectEmbedderFunc func(modelName string, providerName string) EmbeddingProvider
+
+// DetectEmbedder determines the embedding backend for a model. An explicit provider
+// name takes precedence over the model name; any registered provider with the
+// embeddings capability can be named.
+var DetectEmbedder DetectEmbedderFunc = defaultDetectEmbedder
+
+// defaultDetectEmbedder is the default implementation of DetectEmbedder
+func defaultDetectEmbedder(modelName string, providerName string) EmbeddingProvider {
+	config.DebugLog("[Embeddings] Detecting backend for model=%s provider=%s", modelName, providerName)
+	embedder, _ := NewCapableProvider(CapabilityEmbeddings, modelName, providerName).(EmbeddingProvider)
+	return embedder
+}
+
+// embedOpenAICompatible requests embeddings from an OpenAI-compatible endpoint,
+// splitting the texts into batches
+func embedOpenAICompatible(client *openai.Client, modelName string, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		end := start + embeddingBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch := texts[start:end]
+
+		result, err := retry.WithRetry(
+			func() (interface{}, error) {
+				resp, err := client.CreateEmbeddings(context.Background(), openai.EmbeddingRequest{
+					Input: batch,
+					Model: openai.EmbeddingModel(modelName),
+				})
+				if err != nil {
+					return nil, fmt.Errorf("embeddings API error: %w", err)
+				}
+				if len(resp.Data) != len(batch) {
+					return nil, fmt.Errorf("expected %d embeddings, got %d", len(batch), len(resp.Data))
+				}
+				return resp, nil
+			},
+			retry.Is429Error,
+			retry.DefaultRetryConfig,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		batchVectors := make([][]float32, len(batch))
+		for _, data := range result.(openai.EmbeddingResponse).Data {
+			if data.Index < 0 || data.Index >= len(batch) {
+				return nil, fmt.Errorf("embedding index %d out of range", data.Index)
+			}
+			batchVectors[data.Index] = data.Embedding
+		}
+		vectors = append(vectors, batchVectors...)
+	}
+	return vectors, nil
+}
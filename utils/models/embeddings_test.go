@@ -0,0 +1,38 @@
+package models
+
+import "testing"
+
+func TestDetectEmbedder(t *testing.T) {
+	// No local Ollama server, so local embedding models are not detected
+	t.Setenv("OLLAMA_HOST", "http://127.0.0.1:1")
+
+	tests := []struct {
+		model    string
+		provider string
+		expected string
+	}{
+		{"text-embedding-3-small", "", "openai"},
+		{"text-embedding-3-large", "", "openai"},
+		{"text-embedding-ada-002", "", "openai"},
+		{"text-embedding-004", "", "google"},
+		{"text-embedding-005", "", "google"},
+		{"gemini-embedding-001", "", "google"},
+		{"embedding-001", "", "google"},
+		{"nomic-embed-text", "ollama", "ollama"},
+		{"text-embedding-3-small", "vllm", "vllm"},
+		{"nomic-embed-text", "", ""},
+		{"gpt-4o", "", ""},
+		{"text-embedding-3-small", "anthropic", ""},
+	}
+
+	for _, tt := range tests {
+		provider := defaultDetectEmbedder(tt.model, tt.provider)
+		got := ""
+		if provider != nil {
+			got = provider.Name()
+		}
+		if got != tt.expected {
+			t.Errorf("defaultDetectEmbedder(%q, %q) = %q, want %q", tt.model, tt.provider, got, tt.expected)
+		}
+	}
+}
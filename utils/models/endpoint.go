@@ -0,0 +1,189 @@
+package models
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/cassette"
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// Default addresses of the self-hosted providers
+const (
+	defaultOllamaEndpoint = "http://localhost:11434"
+	defaultVLLMEndpoint   = "http://localhost:8000"
+)
+
+// EndpointConfig holds the connection settings of a self-hosted provider or of
+// one named host of it
+type EndpointConfig struct {
+	Name     string
+	Endpoint string
+	Headers  map[string]string
+	TLS      *config.TLSConfig
+	Models   []string
+}
+
+// EndpointConfigFrom converts a provider entry of the environment configuration
+func EndpointConfigFrom(name string, provider *config.Provider) EndpointConfig {
+	cfg := EndpointConfig{
+		Name:     name,
+		Endpoint: normalizeEndpoint(provider.Endpoint),
+		Headers:  provider.Headers,
+		TLS:      provider.TLS,
+	}
+	for _, model := range provider.Models {
+		cfg.Models = append(cfg.Models, model.Name)
+	}
+	return cfg
+}
+
+// normalizeEndpoint adds a missing scheme and removes trailing slashes, so that
+// values such as OLLAMA_HOST=gpu-box:11434 work as they do for the Ollama CLI
+func normalizeEndpoint(endpoint string) string {
+	endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if endpoint != "" && !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	return endpoint
+}
+
+// listsModel reports whether the model is routed to this endpoint by its model list
+func (e EndpointConfig) listsModel(modelName string) bool {
+	for _, model := range e.Models {
+		if strings.EqualFold(model, modelName) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpClient returns a client that applies the endpoint's headers and TLS settings
+func (e EndpointConfig) httpClient(timeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport
+	if e.TLS != nil {
+		tlsConfig, err := buildTLSConfig(e.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS settings for %s: %w", e.Name, err)
+		}
+		base := cassette.BaseTransport()
+		base.TLSClientConfig = tlsConfig
+		transport = cassette.Wrap(base)
+	}
+	if len(e.Headers) > 0 {
+		transport = &headerTransport{base: transport, headers: e.Headers}
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// buildTLSConfig loads the certificates referenced by the TLS settings
+func buildTLSConfig(settings *config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: settings.InsecureSkipVerify, // #nosec G402 -- explicit opt-in for self-signed lab servers
+	}
+
+	if settings.CACert != "" {
+		pem, err := os.ReadFile(settings.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca_cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_cert %s contains no PEM certificates", settings.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if settings.ClientCert != "" || settings.ClientKey != "" {
+		if settings.ClientCert == "" || settings.ClientKey == "" {
+			return nil, fmt.Errorf("client_cert and client_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(settings.ClientCert, settings.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// headerTransport adds fixed headers to every request
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// LoadProviderConfig applies the provider settings of the environment
+// configuration: openai-compatible endpoints, the Ollama and vLLM endpoints,
+// named Ollama hosts and model aliases. It also starts a new detection cache, so
+// it should be called whenever the configuration is loaded.
+func LoadProviderConfig(envConfig *config.EnvConfig) {
+	routing := NewRouting(envConfig)
+	routingMu.Lock()
+	defer routingMu.Unlock()
+	loadedRouting = routing
+}
+
+// builtinEndpoint returns the settings of a built-in self-hosted provider. The
+// address comes from the configuration, then the environment variable, then the default.
+func builtinEndpoint(name, envVar, fallback string) EndpointConfig {
+	cfg, ok := currentRouting().builtins[name]
+	if !ok {
+		cfg = EndpointConfig{Name: name}
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = normalizeEndpoint(os.Getenv(envVar))
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fallback
+	}
+	return cfg
+}
+
+// findOllamaHost returns the named Ollama host whose model list contains the model
+func (r *Routing) findOllamaHost(modelName string) (EndpointConfig, bool) {
+	for _, host := range r.hosts {
+		if host.listsModel(modelName) {
+			return host, true
+		}
+	}
+	return EndpointConfig{}, false
+}
+
+// lookupOllamaHost returns the named Ollama host with the given name
+func (r *Routing) lookupOllamaHost(name string) (EndpointConfig, bool) {
+	for _, host := range r.hosts {
+		if host.Name == name {
+			return host, true
+		}
+	}
+	return EndpointConfig{}, false
+}
+
+// NewConfiguredProvider creates the provider for an entry of the environment
+// configuration, honouring its type and connection settings
+func NewConfiguredProvider(name string, provider *config.Provider) (Provider, error) {
+	switch kind := provider.Kind(name); {
+	case provider.IsOpenAICompatible():
+		return NewOpenAICompatibleProvider(OpenAICompatibleConfigFrom(name, provider)), nil
+	case kind == "ollama" && name != "ollama":
+		return NewOllamaHostProvider(EndpointConfigFrom(name, provider)), nil
+	default:
+		return NewProviderByName(kind)
+	}
+}
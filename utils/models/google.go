@@ -1,16 +1,24 @@
 package models
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/generative-ai-go/genai"
+	"github.com/kris-hansen/comanda/utils/cassette"
 	"github.com/kris-hansen/comanda/utils/fileutil"
 	"github.com/kris-hansen/comanda/utils/retry"
 	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 )
 
 // GoogleProvider handles Google AI (Gemini) family of models
@@ -32,6 +40,42 @@ func NewGoogleProvider() *GoogleProvider {
 	}
 }
 
+func init() {
+	Register(ProviderFactory{
+		Name:         "google",
+		DisplayName:  "Google",
+		New:          func() Provider { return NewGoogleProvider() },
+		Priority:     30,
+		ConfigSchema: []ConfigField{apiKeyField},
+		Discover:     registryModels("google"),
+		Capabilities: []Capability{CapabilityText, CapabilityVision, CapabilityEmbeddings,
+			CapabilityImageGeneration, CapabilityTranscription},
+		DetectCapability: detectGoogleCapability,
+	})
+}
+
+// googleTextEmbedding matches Google's numbered embedding models such as text-embedding-004
+var googleTextEmbedding = regexp.MustCompile(`^text-embedding-00[0-9]`)
+
+// detectGoogleCapability reports whether a model is a Google embedding, image
+// or transcription model
+func detectGoogleCapability(capability Capability, modelName string) bool {
+	modelName = strings.ToLower(modelName)
+	switch capability {
+	case CapabilityEmbeddings:
+		// OpenAI's text-embedding-3-* and -ada-002 are left to OpenAI
+		return strings.HasPrefix(modelName, "gemini-embedding") ||
+			googleTextEmbedding.MatchString(modelName) ||
+			strings.HasPrefix(modelName, "embedding-")
+	case CapabilityImageGeneration:
+		return strings.HasPrefix(modelName, "gemini-") && strings.Contains(modelName, "image")
+	case CapabilityTranscription:
+		// Gemini models transcribe audio through their multimodal prompts
+		return strings.HasPrefix(modelName, "gemini-")
+	}
+	return false
+}
+
 // Name returns the provider name
 func (g *GoogleProvider) Name() string {
 	return "google"
@@ -78,6 +122,20 @@ func (g *GoogleProvider) Configure(apiKey string) error {
 	return nil
 }
 
+// newClient creates a Gemini client. The client does not use
+// http.DefaultTransport on its own, so while a cassette is installed it is
+// given a client sending its requests through it.
+func (g *GoogleProvider) newClient(ctx context.Context) (*genai.Client, error) {
+	if cassette.Installed() == nil {
+		return genai.NewClient(ctx, option.WithAPIKey(g.apiKey))
+	}
+	transport, err := htransport.NewTransport(ctx, http.DefaultTransport, option.WithAPIKey(g.apiKey))
+	if err != nil {
+		return nil, err
+	}
+	return genai.NewClient(ctx, option.WithHTTPClient(&http.Client{Transport: transport}))
+}
+
 // SendPrompt sends a prompt to the specified model and returns the response
 func (g *GoogleProvider) SendPrompt(modelName string, prompt string) (string, error) {
 	g.debugf("Preparing to send prompt to model: %s", modelName)
@@ -99,7 +157,7 @@ func (g *GoogleProvider) SendPrompt(modelName string, prompt string) (string, er
 	result, err := retry.WithRetry(
 		func() (interface{}, error) {
 			ctx := context.Background()
-			client, err := genai.NewClient(ctx, option.WithAPIKey(g.apiKey))
+			client, err := g.newClient(ctx)
 			if err != nil {
 				return "", fmt.Errorf("failed to create Google AI client: %v", err)
 			}
@@ -107,14 +165,12 @@ func (g *GoogleProvider) SendPrompt(modelName string, prompt string) (string, er
 
 			// Initialize the model
 			model := client.GenerativeModel(modelName)
-			model.SetTemperature(float32(g.config.Temperature))
-			model.SetTopP(float32(g.config.TopP))
-			model.SetMaxOutputTokens(int32(g.config.MaxTokens))
+			g.configureModel(model)
 
 			// Generate content
 			resp, err := model.GenerateContent(ctx, genai.Text(prompt))
 			if err != nil {
-				return "", fmt.Errorf("Google AI API error: %v", err)
+				return "", fmt.Errorf("Google AI API error: %w", err)
 			}
 
 			if len(resp.Candidates) == 0 {
@@ -168,7 +224,7 @@ func (g *GoogleProvider) SendPromptWithFile(modelName string, prompt string, fil
 	result, err := retry.WithRetry(
 		func() (interface{}, error) {
 			ctx := context.Background()
-			client, err := genai.NewClient(ctx, option.WithAPIKey(g.apiKey))
+			client, err := g.newClient(ctx)
 			if err != nil {
 				return "", fmt.Errorf("failed to create Google AI client: %v", err)
 			}
@@ -176,9 +232,7 @@ func (g *GoogleProvider) SendPromptWithFile(modelName string, prompt string, fil
 
 			// Initialize the model
 			model := client.GenerativeModel(modelName)
-			model.SetTemperature(float32(g.config.Temperature))
-			model.SetTopP(float32(g.config.TopP))
-			model.SetMaxOutputTokens(int32(g.config.MaxTokens))
+			g.configureModel(model)
 
 			// Generate content with file
 			resp, err := model.GenerateContent(ctx,
@@ -192,7 +246,81 @@ func (g *GoogleProvider) SendPromptWithFile(modelName string, prompt string, fil
 				if strings.Contains(err.Error(), "invalid UTF-8") {
 					return "", fmt.Errorf("encoding error in file %s: invalid UTF-8 characters detected", file.Path)
 				}
-				return "", fmt.Errorf("Google AI API error: %v", err)
+				return "", fmt.Errorf("Google AI API error: %w", err)
+			}
+
+			if len(resp.Candidates) == 0 {
+				return "", fmt.Errorf("no response candidates returned from Google AI")
+			}
+
+			// Extract the response text from the first candidate
+			var response string
+			for _, part := range resp.Candidates[0].Content.Parts {
+				if text, ok := part.(genai.Text); ok {
+					response += string(text)
+				}
+			}
+
+			return response, nil
+		},
+		retry.Is429Error,
+		retry.DefaultRetryConfig,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	response := result.(string)
+	g.debugf("API call completed, response length: %d characters", len(response))
+
+	return response, nil
+}
+
+// SendPromptWithFiles sends a prompt with several files in a single request.
+// Images and PDFs are attached as inline data and other files as labelled text.
+func (g *GoogleProvider) SendPromptWithFiles(modelName string, prompt string, files []FileInput) (string, error) {
+	g.debugf("Preparing to send prompt with %d files to model: %s", len(files), modelName)
+
+	if g.apiKey == "" {
+		return "", fmt.Errorf("Google provider not configured: missing API key")
+	}
+
+	if !g.ValidateModel(modelName) {
+		return "", fmt.Errorf("invalid Google model: %s", modelName)
+	}
+
+	attachments, err := loadAttachments(files)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []genai.Part
+	for i, file := range attachments {
+		if file.isImage() || file.isPDF() {
+			parts = append(parts, genai.Text(file.label(i)), genai.Blob{MIMEType: file.mimeType, Data: file.data})
+			continue
+		}
+		parts = append(parts, genai.Text(file.text(i)))
+	}
+	parts = append(parts, genai.Text(prompt))
+
+	// Use retry mechanism for API calls
+	result, err := retry.WithRetry(
+		func() (interface{}, error) {
+			ctx := context.Background()
+			client, err := g.newClient(ctx)
+			if err != nil {
+				return "", fmt.Errorf("failed to create Google AI client: %v", err)
+			}
+			defer client.Close()
+
+			model := client.GenerativeModel(modelName)
+			g.configureModel(model)
+
+			resp, err := model.GenerateContent(ctx, parts...)
+			if err != nil {
+				return "", fmt.Errorf("Google AI API error: %w", err)
 			}
 
 			if len(resp.Candidates) == 0 {
@@ -223,7 +351,336 @@ func (g *GoogleProvider) SendPromptWithFile(modelName string, prompt string, fil
 	return response, nil
 }
 
+// configureModel applies the generation parameters to a model
+func (g *GoogleProvider) configureModel(model *genai.GenerativeModel) {
+	model.SetTemperature(float32(g.config.Temperature))
+	model.SetTopP(float32(g.config.TopP))
+	model.SetMaxOutputTokens(int32(g.config.MaxTokens))
+	if len(g.config.Params.Stop) > 0 {
+		model.StopSequences = g.config.Params.Stop
+	}
+}
+
+// SetConfig updates the provider configuration
+func (g *GoogleProvider) SetConfig(config ModelConfig) {
+	g.config = config
+}
+
+// GetConfig returns the current provider configuration
+func (g *GoogleProvider) GetConfig() ModelConfig {
+	return g.config
+}
+
+// SupportedParams lists the generation parameters the model accepts
+func (g *GoogleProvider) SupportedParams(modelName string) []string {
+	return samplingParams
+}
+
 // SetVerbose enables or disables verbose mode
 func (g *GoogleProvider) SetVerbose(verbose bool) {
 	g.verbose = verbose
 }
+
+// geminiTranscriptionPrompt asks Gemini for a verbatim transcript
+const geminiTranscriptionPrompt = "Transcribe the speech in this recording verbatim. Output only the transcript."
+
+// geminiSegmentsPrompt asks Gemini for a timed, speaker-labelled transcript as JSON
+const geminiSegmentsPrompt = `Transcribe the speech in this recording verbatim.
+Respond with a JSON array only. Each element is one utterance with the fields
+"start" and "end" (seconds from the beginning, as numbers), "speaker" (a stable
+label such as "Speaker 1") and "text".`
+
+// Transcribe converts an audio or video file to text using Gemini's native audio understanding
+func (g *GoogleProvider) Transcribe(modelName string, file FileInput, opts TranscriptionOptions) (*Transcript, error) {
+	g.debugf("Preparing to transcribe %s with model: %s", file.Path, modelName)
+
+	if g.apiKey == "" {
+		return nil, fmt.Errorf("Google provider not configured: missing API key")
+	}
+
+	if !g.ValidateModel(modelName) {
+		return nil, fmt.Errorf("invalid Google model: %s", modelName)
+	}
+
+	fileData, err := fileutil.SafeReadFile(file.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	prompt := geminiTranscriptionPrompt
+	wantSegments := opts.Segments || opts.Speakers
+	if wantSegments {
+		prompt = geminiSegmentsPrompt
+	}
+	if opts.Language != "" {
+		prompt += fmt.Sprintf("\nThe spoken language is %s.", opts.Language)
+	}
+	if opts.Prompt != "" {
+		prompt += "\nContext: " + opts.Prompt
+	}
+
+	result, err := retry.WithRetry(
+		func() (interface{}, error) {
+			ctx := context.Background()
+			client, err := g.newClient(ctx)
+			if err != nil {
+				return "", fmt.Errorf("failed to create Google AI client: %v", err)
+			}
+			defer client.Close()
+
+			model := client.GenerativeModel(modelName)
+			model.SetTemperature(0)
+			if wantSegments {
+				model.ResponseMIMEType = "application/json"
+			}
+
+			resp, err := model.GenerateContent(ctx,
+				genai.Text(prompt),
+				genai.Blob{
+					MIMEType: file.MimeType,
+					Data:     fileData,
+				})
+			if err != nil {
+				return "", fmt.Errorf("Google AI API error: %w", err)
+			}
+
+			if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+				return "", fmt.Errorf("no response candidates returned from Google AI")
+			}
+
+			var response string
+			for _, part := range resp.Candidates[0].Content.Parts {
+				if text, ok := part.(genai.Text); ok {
+					response += string(text)
+				}
+			}
+
+			return response, nil
+		},
+		retry.Is429Error,
+		retry.DefaultRetryConfig,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	response := result.(string)
+	transcript := &Transcript{Text: strings.TrimSpace(response), Language: opts.Language}
+
+	if wantSegments {
+		var segments []TranscriptSegment
+		if err := json.Unmarshal([]byte(response), &segments); err != nil {
+			// Keep the raw response rather than failing the whole step
+			g.debugf("Could not parse segmented transcript, using raw text: %v", err)
+			return transcript, nil
+		}
+		texts := make([]string, len(segments))
+		for i, segment := range segments {
+			texts[i] = strings.TrimSpace(segment.Text)
+		}
+		transcript.Segments = segments
+		transcript.Text = strings.Join(texts, " ")
+		if len(segments) > 0 {
+			transcript.Duration = segments[len(segments)-1].End
+		}
+	}
+
+	g.debugf("Transcription completed, %d characters, %d segments", len(transcript.Text), len(transcript.Segments))
+	return transcript, nil
+}
+
+// Embed returns an embedding vector for each text using the Gemini embedding models
+func (g *GoogleProvider) Embed(modelName string, texts []string) ([][]float32, error) {
+	g.debugf("Preparing to embed %d text(s) with model: %s", len(texts), modelName)
+
+	if g.apiKey == "" {
+		return nil, fmt.Errorf("Google provider not configured: missing API key")
+	}
+
+	ctx := context.Background()
+	client, err := g.newClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google AI client: %v", err)
+	}
+	defer client.Close()
+	model := client.EmbeddingModel(modelName)
+
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		end := start + embeddingBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+
+		batch := model.NewBatch()
+		for _, text := range texts[start:end] {
+			batch.AddContent(genai.Text(text))
+		}
+
+		result, err := retry.WithRetry(
+			func() (interface{}, error) {
+				resp, err := model.BatchEmbedContents(ctx, batch)
+				if err != nil {
+					return nil, fmt.Errorf("Google AI API error: %w", err)
+				}
+				if len(resp.Embeddings) != end-start {
+					return nil, fmt.Errorf("expected %d embeddings, got %d", end-start, len(resp.Embeddings))
+				}
+				return resp, nil
+			},
+			retry.Is429Error,
+			retry.DefaultRetryConfig,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, embedding := range result.(*genai.BatchEmbedContentsResponse).Embeddings {
+			vectors = append(vectors, embedding.Values)
+		}
+	}
+
+	g.debugf("Embedding completed, %d vector(s)", len(vectors))
+	return vectors, nil
+}
+
+// googleAPIBaseURL is the REST endpoint for the Gemini API. The genai client
+// does not expose image response modalities, so image generation calls the
+// REST API directly.
+var googleAPIBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// geminiImageResponse is the subset of a generateContent response needed for image output
+type geminiImageResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text       string `json:"text,omitempty"`
+				InlineData *struct {
+					MimeType string `json:"mimeType"`
+					Data     string `json:"data"`
+				} `json:"inlineData,omitempty"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+}
+
+// GenerateImage creates images from a prompt using Gemini's native image output.
+// Gemini returns one image per request, so Count issues that many requests.
+func (g *GoogleProvider) GenerateImage(modelName string, prompt string, opts ImageOptions) ([]GeneratedImage, error) {
+	g.debugf("Preparing to generate image with model: %s", modelName)
+
+	if g.apiKey == "" {
+		return nil, fmt.Errorf("Google provider not configured: missing API key")
+	}
+
+	generationConfig := map[string]interface{}{
+		"responseModalities": []string{"TEXT", "IMAGE"},
+	}
+	if opts.Size != "" {
+		width, height, err := parseImageSize(opts.Size)
+		if err != nil {
+			return nil, err
+		}
+		divisor := gcd(width, height)
+		generationConfig["imageConfig"] = map[string]interface{}{
+			"aspectRatio": fmt.Sprintf("%d:%d", width/divisor, height/divisor),
+		}
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{"parts": []map[string]interface{}{{"text": prompt}}},
+		},
+		"generationConfig": generationConfig,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %v", err)
+	}
+
+	count := opts.Count
+	if count < 1 {
+		count = 1
+	}
+
+	var images []GeneratedImage
+	for i := 0; i < count; i++ {
+		result, err := retry.WithRetry(
+			func() (interface{}, error) {
+				url := fmt.Sprintf("%s/models/%s:generateContent", googleAPIBaseURL, modelName)
+				req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(jsonData))
+				if err != nil {
+					return nil, fmt.Errorf("error creating request: %v", err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("x-goog-api-key", g.apiKey)
+
+				client := &http.Client{Timeout: 5 * time.Minute}
+				resp, err := client.Do(req)
+				if err != nil {
+					return nil, fmt.Errorf("Google AI API error: %w", err)
+				}
+				defer resp.Body.Close()
+
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					return nil, fmt.Errorf("error reading response: %v", err)
+				}
+				if resp.StatusCode != http.StatusOK {
+					if resp.StatusCode == http.StatusTooManyRequests {
+						return nil, fmt.Errorf("API request failed with status 429: %s", string(body))
+					}
+					return nil, fmt.Errorf("Google AI API error (status %d): %s", resp.StatusCode, string(body))
+				}
+
+				var parsed geminiImageResponse
+				if err := json.Unmarshal(body, &parsed); err != nil {
+					return nil, fmt.Errorf("error parsing response: %v", err)
+				}
+				return parsed, nil
+			},
+			retry.Is429Error,
+			retry.DefaultRetryConfig,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed := result.(geminiImageResponse)
+		found := false
+		for _, candidate := range parsed.Candidates {
+			var text strings.Builder
+			for _, part := range candidate.Content.Parts {
+				if part.InlineData == nil {
+					text.WriteString(part.Text)
+					continue
+				}
+				image, err := decodeBase64Image(part.InlineData.Data, part.InlineData.MimeType)
+				if err != nil {
+					return nil, err
+				}
+				images = append(images, image)
+				found = true
+			}
+			if found && text.Len() > 0 {
+				images[len(images)-1].RevisedPrompt = strings.TrimSpace(text.String())
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no image returned from Google AI for model %s", modelName)
+		}
+	}
+
+	g.debugf("Generated %d image(s)", len(images))
+	return images, nil
+}
+
+// gcd returns the greatest common divisor of two positive integers
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	if a == 0 {
+		return 1
+	}
+	return a
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// ImageOptions controls how images are generated
+type ImageOptions struct {
+	Size    string // Image dimensions as WIDTHxHEIGHT (e.g. "1024x1024")
+	Quality string // Backend-specific quality setting (e.g. "standard", "hd", "high")
+	Count   int    // Number of images to generate (defaults to 1)
+}
+
+// GeneratedImage is a single image returned by an image generation backend
+type GeneratedImage struct {
+	Data          []byte
+	MimeType      string
+	RevisedPrompt string
+}
+
+// ImageGenerationProvider extends Provider with text-to-image capabilities
+type ImageGenerationProvider interface {
+	Provider
+	GenerateImage(modelName string, prompt string, opts ImageOptions) ([]GeneratedImage, error)
+}
+
+// DetectImageGeneratorFunc is the type for the image generation provider detection function
+type DetectImageGeneratorFunc func(modelName string, providerName string) ImageGenerationProvider
+
+// DetectImageGenerator determines the image generation backend for a model. An explicit
+// provider name ("openai", "google" or "stable-diffusion") takes precedence over the model name.
+var DetectImageGenerator DetectImageGeneratorFunc = defaultDetectImageGenerator
+
+// defaultDetectImageGenerator is the default implementation of DetectImageGenerator
+func defaultDetectImageGenerator(modelName string, providerName string) ImageGenerationProvider {
+	config.DebugLog("[ImageGeneration] Detecting backend for model=%s provider=%s", modelName, providerName)
+	generator, _ := NewCapableProvider(CapabilityImageGeneration, modelName, providerName).(ImageGenerationProvider)
+	return generator
+}
+
+// parseImageSize splits a WIDTHxHEIGHT size string into its dimensions
+func parseImageSize(size string) (int, int, error) {
+	parts := strings.Split(strings.ToLower(size), "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid image size %q: expected WIDTHxHEIGHT", size)
+	}
+	width, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid image width in %q: %v", size, err)
+	}
+	height, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid image height in %q: %v", size, err)
+	}
+	return width, height, nil
+}
+
+// decodeBase64Image decodes base64 image data and detects its MIME type when
+// the backend does not report one
+func decodeBase64Image(encoded string, mimeType string) (GeneratedImage, error) {
+	// Some servers return data URLs rather than bare base64
+	if idx := strings.Index(encoded, ";base64,"); idx != -1 && strings.HasPrefix(encoded, "data:") {
+		mimeType = strings.TrimPrefix(encoded[:idx], "data:")
+		encoded = encoded[idx+len(";base64,"):]
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return GeneratedImage{}, fmt.Errorf("error decoding image data: %v", err)
+	}
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	return GeneratedImage{Data: data, MimeType: mimeType}, nil
+}
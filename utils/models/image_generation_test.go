@@ -0,0 +1,107 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// onePixelPNG is a valid 1x1 PNG image
+var onePixelPNG, _ = base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg==")
+
+func TestParseImageSize(t *testing.T) {
+	width, height, err := parseImageSize("1792x1024")
+	if err != nil || width != 1792 || height != 1024 {
+		t.Errorf("parseImageSize(1792x1024) = %d, %d, %v", width, height, err)
+	}
+
+	for _, size := range []string{"1024", "axb", "1024x"} {
+		if _, _, err := parseImageSize(size); err == nil {
+			t.Errorf("Expected error for size %q", size)
+		}
+	}
+}
+
+func TestDecodeBase64Image(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(onePixelPNG)
+
+	image, err := decodeBase64Image(encoded, "")
+	if err != nil {
+		t.Fatalf("decodeBase64Image returned error: %v", err)
+	}
+	if image.MimeType != "image/png" {
+		t.Errorf("Expected detected MIME type image/png, got %s", image.MimeType)
+	}
+
+	image, err = decodeBase64Image("data:image/webp;base64,"+encoded, "")
+	if err != nil {
+		t.Fatalf("decodeBase64Image returned error for data URL: %v", err)
+	}
+	if image.MimeType != "image/webp" || len(image.Data) != len(onePixelPNG) {
+		t.Errorf("Unexpected data URL decoding result: %s, %d bytes", image.MimeType, len(image.Data))
+	}
+}
+
+func TestStableDiffusionGenerateImage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sdapi/v1/txt2img" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		var req stableDiffusionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if req.Prompt != "a lighthouse" || req.Width != 512 || req.Height != 768 || req.BatchSize != 2 {
+			t.Errorf("Unexpected request: %+v", req)
+		}
+		if req.OverrideSettings["sd_model_checkpoint"] != "sdxl" {
+			t.Errorf("Expected checkpoint override, got %v", req.OverrideSettings)
+		}
+
+		encoded := base64.StdEncoding.EncodeToString(onePixelPNG)
+		json.NewEncoder(w).Encode(stableDiffusionResponse{Images: []string{encoded, encoded}})
+	}))
+	defer server.Close()
+
+	t.Setenv("STABLE_DIFFUSION_ENDPOINT", server.URL)
+	provider := NewStableDiffusionProvider()
+	if err := provider.Configure("LOCAL"); err != nil {
+		t.Fatalf("Configure returned error: %v", err)
+	}
+
+	images, err := provider.GenerateImage("sdxl", "a lighthouse", ImageOptions{Size: "512x768", Count: 2})
+	if err != nil {
+		t.Fatalf("GenerateImage returned error: %v", err)
+	}
+	if len(images) != 2 || images[0].MimeType != "image/png" {
+		t.Errorf("Unexpected images: %d, %+v", len(images), images)
+	}
+}
+
+func TestDetectImageGenerator(t *testing.T) {
+	tests := []struct {
+		model    string
+		provider string
+		expected string
+	}{
+		{"dall-e-3", "", "openai"},
+		{"gpt-image-1", "", "openai"},
+		{"gemini-2.5-flash-image", "", "google"},
+		{"gemini-2.5-flash", "", ""},
+		{"sdxl", "stable-diffusion", "stable-diffusion"},
+		{"claude-sonnet-4-5", "", ""},
+	}
+
+	for _, tt := range tests {
+		provider := defaultDetectImageGenerator(tt.model, tt.provider)
+		got := ""
+		if provider != nil {
+			got = provider.Name()
+		}
+		if got != tt.expected {
+			t.Errorf("defaultDetectImageGenerator(%q, %q) = %q, want %q", tt.model, tt.provider, got, tt.expected)
+		}
+	}
+}
@@ -38,6 +38,18 @@ func NewMoonshotProvider() *MoonshotProvider {
 	}
 }
 
+func init() {
+	Register(ProviderFactory{
+		Name:         "moonshot",
+		DisplayName:  "Moonshot",
+		New:          func() Provider { return NewMoonshotProvider() },
+		Priority:     70,
+		ConfigSchema: []ConfigField{apiKeyField},
+		Discover:     registryModels("moonshot"),
+		Capabilities: []Capability{CapabilityText, CapabilityResponses},
+	})
+}
+
 // Name returns the provider name
 func (o *MoonshotProvider) Name() string {
 	return "moonshot"
@@ -103,20 +115,25 @@ func (o *MoonshotProvider) createChatCompletionRequest(modelName string, message
 		Messages: messages,
 	}
 
-	// Moonshot API only supports temperature in range [0, 1]
-	temperature := float32(o.config.Temperature)
-	if temperature > 1.0 {
-		temperature = 1.0
-	}
-
 	req.MaxTokens = o.config.MaxTokens
-	req.Temperature = temperature
+	req.Temperature = float32(o.config.Temperature)
 	req.TopP = float32(o.config.TopP)
-	o.debugf("Using configured parameters: Temperature=%.2f, TopP=%.2f", temperature, o.config.TopP)
+	applyChatParams(&req, o.config)
+
+	// Moonshot API only supports temperature in range [0, 1]
+	if req.Temperature > 1.0 {
+		req.Temperature = 1.0
+	}
+	o.debugf("Using configured parameters: Temperature=%.2f, TopP=%.2f", req.Temperature, req.TopP)
 
 	return req
 }
 
+// SupportedParams lists the generation parameters the model accepts
+func (o *MoonshotProvider) SupportedParams(modelName string) []string {
+	return samplingParams
+}
+
 // SendPrompt sends a prompt to the specified model and returns the response
 func (o *MoonshotProvider) SendPrompt(modelName string, prompt string) (string, error) {
 	o.debugf("Preparing to send prompt to model: %s", modelName)
@@ -151,7 +168,7 @@ func (o *MoonshotProvider) SendPrompt(modelName string, prompt string) (string,
 			resp, err := client.CreateChatCompletion(context.Background(), req)
 
 			if err != nil {
-				return "", fmt.Errorf("Moonshot API error: %v", err)
+				return "", fmt.Errorf("Moonshot API error: %w", err)
 			}
 
 			if len(resp.Choices) == 0 {
@@ -216,7 +233,7 @@ func (o *MoonshotProvider) SendPromptWithFile(modelName string, prompt string, f
 			resp, err := client.CreateChatCompletion(context.Background(), req)
 
 			if err != nil {
-				return "", fmt.Errorf("Moonshot API error: %v", err)
+				return "", fmt.Errorf("Moonshot API error: %w", err)
 			}
 
 			if len(resp.Choices) == 0 {
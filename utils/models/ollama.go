@@ -4,8 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"log"
 	"io"
+	"log"
 	"net/http"
 	"strings"
 	"sync"
@@ -15,17 +15,22 @@ import (
 	"github.com/kris-hansen/comanda/utils/retry"
 )
 
-// OllamaProvider handles Ollama family of models
+// OllamaProvider handles Ollama family of models. Each instance talks to one
+// Ollama host: the default "ollama" entry or a named host from the configuration.
 type OllamaProvider struct {
+	host    EndpointConfig
+	config  ModelConfig
 	verbose bool
 	mu      sync.Mutex
 }
 
 // OllamaRequest represents the request structure for Ollama API
 type OllamaRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-	Stream bool   `json:"stream"`
+	Model   string                 `json:"model"`
+	Prompt  string                 `json:"prompt"`
+	Stream  bool                   `json:"stream"`
+	Options map[string]interface{} `json:"options,omitempty"`
+	Images  []string               `json:"images,omitempty"` // Base64-encoded images for vision models
 }
 
 // OllamaResponse represents the response structure from Ollama API
@@ -34,14 +39,145 @@ type OllamaResponse struct {
 	Done     bool   `json:"done"`
 }
 
-// NewOllamaProvider creates a new Ollama provider instance
+// NewOllamaProvider creates a provider for the default Ollama host, taken from
+// the "ollama" endpoint setting, OLLAMA_HOST, or http://localhost:11434
 func NewOllamaProvider() *OllamaProvider {
-	return &OllamaProvider{}
+	return &OllamaProvider{host: defaultOllamaHost()}
+}
+
+// NewOllamaHostProvider creates a provider for a named Ollama host. Hosts without
+// an endpoint use the default Ollama address.
+func NewOllamaHostProvider(host EndpointConfig) *OllamaProvider {
+	if host.Endpoint == "" {
+		host.Endpoint = defaultOllamaHost().Endpoint
+	}
+	return &OllamaProvider{host: host}
+}
+
+// defaultOllamaHost returns the settings of the default Ollama host
+func defaultOllamaHost() EndpointConfig {
+	return builtinEndpoint("ollama", "OLLAMA_HOST", defaultOllamaEndpoint)
+}
+
+func init() {
+	Register(ProviderFactory{
+		Name:        "ollama",
+		DisplayName: "Ollama",
+		New:         func() Provider { return NewOllamaProvider() },
+		Priority:    10,
+		// Only claim models that are actually pulled locally
+		Detect: func(modelName string) bool {
+			return NewOllamaProvider().SupportsModel(modelName) && isModelAvailableLocally(modelName)
+		},
+		Local: true,
+		ConfigSchema: []ConfigField{{Key: "endpoint",
+			Description: "Ollama endpoint (leave empty for OLLAMA_HOST or " + defaultOllamaEndpoint + ")"}},
+		Discover:     func(string) ([]string, error) { return NewOllamaProvider().ListModels() },
+		Capabilities: []Capability{CapabilityText, CapabilityEmbeddings},
+		// Local embedding models such as nomic-embed-text or mxbai-embed-large
+		DetectCapability: func(capability Capability, modelName string) bool {
+			return strings.Contains(strings.ToLower(modelName), "embed") && isModelAvailableLocally(modelName)
+		},
+	})
 }
 
-// Name returns the provider name
+// Name returns the provider name: "ollama" or the name of the configured host
 func (o *OllamaProvider) Name() string {
-	return "ollama"
+	return o.host.Name
+}
+
+// Endpoint returns the address of the Ollama host
+func (o *OllamaProvider) Endpoint() string {
+	return o.host.Endpoint
+}
+
+// post sends a JSON request to the Ollama host
+func (o *OllamaProvider) post(path string, body []byte, timeout time.Duration) (*http.Response, error) {
+	client, err := o.host.httpClient(timeout)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Post(o.host.Endpoint+path, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("error calling Ollama API at %s: %v", o.host.Endpoint, err)
+	}
+	return resp, nil
+}
+
+// ListModels returns the names of the models pulled on the Ollama host
+func (o *OllamaProvider) ListModels() ([]string, error) {
+	client, err := o.host.httpClient(10 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(o.host.Endpoint + "/api/tags")
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to Ollama API at %s: %v", o.host.Endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Ollama response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var tagsResponse OllamaTagsResponse
+	if err := json.Unmarshal(body, &tagsResponse); err != nil {
+		return nil, fmt.Errorf("error decoding Ollama response: %v", err)
+	}
+
+	names := make([]string, len(tagsResponse.Models))
+	for i, model := range tagsResponse.Models {
+		names[i] = model.Name
+	}
+	return names, nil
+}
+
+// CheckModel verifies that a model tag is pulled on the Ollama host and returns
+// a descriptive error otherwise
+func (o *OllamaProvider) CheckModel(modelName string) error {
+	available, err := o.ListModels()
+	if err != nil {
+		return fmt.Errorf("failed to verify model '%s' on Ollama host %s (%s): %w. Is Ollama running?", modelName, o.host.Name, o.host.Endpoint, err)
+	}
+	if matchOllamaModel(modelName, available) == "" {
+		return fmt.Errorf("model tag '%s' not found on Ollama host %s (%s). Available models: %v. Try running 'ollama pull %s'",
+			modelName, o.host.Name, o.host.Endpoint, available, modelName)
+	}
+	return nil
+}
+
+// matchOllamaModel returns the pulled model that a requested name refers to, or ""
+func matchOllamaModel(modelName string, available []string) string {
+	modelNameLower := strings.ToLower(modelName)
+	for _, localModel := range available {
+		modelFullName := strings.ToLower(localModel)
+
+		// First check exact match
+		if modelFullName == modelNameLower {
+			return localModel
+		}
+
+		// Then check if the requested model matches the base name (before :tag)
+		// e.g., "gpt-oss" should match "gpt-oss:latest"
+		if strings.Contains(modelFullName, ":") && strings.Split(modelFullName, ":")[0] == modelNameLower {
+			return localModel
+		}
+
+		// Also check if the full model name starts with the requested name
+		// e.g., "llama3" should match "llama3.2:latest"
+		if strings.HasPrefix(modelFullName, modelNameLower) {
+			// Make sure we're not matching partial names unintentionally
+			nextChar := modelFullName[len(modelNameLower):]
+			if strings.HasPrefix(nextChar, ":") || strings.HasPrefix(nextChar, ".") {
+				return localModel
+			}
+		}
+	}
+	return ""
 }
 
 // debugf prints debug information if verbose mode is enabled (thread-safe)
@@ -58,6 +194,11 @@ func (o *OllamaProvider) debugf(format string, args ...interface{}) {
 func (o *OllamaProvider) SupportsModel(modelName string) bool {
 	o.debugf("Checking if model is supported: %s", modelName)
 
+	// Named hosts only serve the models routed to them
+	if o.host.Name != "ollama" && len(o.host.Models) > 0 {
+		return o.host.listsModel(modelName)
+	}
+
 	// Ollama can potentially support any model that users have pulled locally
 	// The actual validation happens in isModelAvailableLocally() or checkOllamaModelExists()
 	o.debugf("Ollama provider can support model: %s (will check local availability)", modelName)
@@ -84,9 +225,10 @@ func (o *OllamaProvider) SendPrompt(modelName string, prompt string) (string, er
 	o.debugf("Prompt length: %d characters", len(prompt))
 
 	reqBody := OllamaRequest{
-		Model:  modelName,
-		Prompt: prompt,
-		Stream: false,
+		Model:   modelName,
+		Prompt:  prompt,
+		Stream:  false,
+		Options: o.requestOptions(),
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -99,11 +241,10 @@ func (o *OllamaProvider) SendPrompt(modelName string, prompt string) (string, er
 	// Use retry mechanism for API calls
 	result, err := retry.WithRetry(
 		func() (interface{}, error) {
-			client := &http.Client{Timeout: 30 * time.Second} // Add a 30-second timeout
-			resp, err := client.Post("http://localhost:11434/api/generate", "application/json", bytes.NewBuffer(jsonData))
+			resp, err := o.post("/api/generate", jsonData, 30*time.Second)
 			if err != nil {
 				o.debugf("Error calling Ollama API: %v", err)
-				return "", fmt.Errorf("error calling Ollama API: %v (is Ollama running?)", err)
+				return "", fmt.Errorf("%v (is Ollama running?)", err)
 			}
 			defer resp.Body.Close()
 
@@ -170,11 +311,53 @@ func (o *OllamaProvider) SendPromptWithFile(modelName string, prompt string, fil
 	combinedPrompt := fmt.Sprintf("File content:\n%s\n\nUser prompt: %s", fileContent, prompt)
 
 	reqBody := OllamaRequest{
-		Model:  modelName,
-		Prompt: combinedPrompt,
-		Stream: false,
+		Model:   modelName,
+		Prompt:  combinedPrompt,
+		Stream:  false,
+		Options: o.requestOptions(),
+	}
+	return o.generate(reqBody)
+}
+
+// SendPromptWithFiles sends a prompt with several files in a single request.
+// Images are passed to vision models such as llava and other files are included
+// in the prompt as labelled text.
+func (o *OllamaProvider) SendPromptWithFiles(modelName string, prompt string, files []FileInput) (string, error) {
+	o.debugf("Preparing to send prompt with %d files to model: %s", len(files), modelName)
+
+	attachments, err := loadAttachments(files)
+	if err != nil {
+		return "", err
+	}
+	if err := rejectPDFs("Ollama", attachments); err != nil {
+		return "", err
+	}
+
+	var sections []string
+	var images []string
+	for i, file := range attachments {
+		if file.isImage() {
+			// Ollama takes images separately, in the order they are labelled
+			sections = append(sections, fmt.Sprintf("%s [image %d]", file.label(i), len(images)+1))
+			images = append(images, file.base64Data())
+			continue
+		}
+		sections = append(sections, file.text(i))
+	}
+	sections = append(sections, "User prompt: "+prompt)
+
+	reqBody := OllamaRequest{
+		Model:   modelName,
+		Prompt:  strings.Join(sections, "\n\n"),
+		Stream:  false,
+		Options: o.requestOptions(),
+		Images:  images,
 	}
+	return o.generate(reqBody)
+}
 
+// generate sends a request to the generate endpoint and returns the response
+func (o *OllamaProvider) generate(reqBody OllamaRequest) (string, error) {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return "", fmt.Errorf("error marshaling request: %v", err)
@@ -183,10 +366,9 @@ func (o *OllamaProvider) SendPromptWithFile(modelName string, prompt string, fil
 	// Use retry mechanism for API calls
 	result, err := retry.WithRetry(
 		func() (interface{}, error) {
-			client := &http.Client{Timeout: 30 * time.Second} // Add a 30-second timeout
-			resp, err := client.Post("http://localhost:11434/api/generate", "application/json", bytes.NewBuffer(jsonData))
+			resp, err := o.post("/api/generate", jsonData, 30*time.Second)
 			if err != nil {
-				return "", fmt.Errorf("error calling Ollama API: %v", err)
+				return "", err
 			}
 			defer resp.Body.Close()
 
@@ -254,7 +436,114 @@ func (o *OllamaProvider) ValidateModel(modelName string) bool {
 	return isValid
 }
 
+// requestOptions maps the parameters set for the request to Ollama model
+// options. The model's defaults apply to every parameter a step does not set.
+func (o *OllamaProvider) requestOptions() map[string]interface{} {
+	params := o.config.Params
+	options := map[string]interface{}{}
+	if params.Temperature != nil {
+		options["temperature"] = *params.Temperature
+	}
+	if params.TopP != nil {
+		options["top_p"] = *params.TopP
+	}
+	if params.MaxTokens != nil {
+		options["num_predict"] = *params.MaxTokens
+	}
+	if len(params.Stop) > 0 {
+		options["stop"] = params.Stop
+	}
+	if params.Seed != nil {
+		options["seed"] = *params.Seed
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+// SetConfig updates the provider configuration
+func (o *OllamaProvider) SetConfig(config ModelConfig) {
+	o.config = config
+}
+
+// GetConfig returns the current provider configuration
+func (o *OllamaProvider) GetConfig() ModelConfig {
+	return o.config
+}
+
+// SupportedParams lists the generation parameters the model accepts
+func (o *OllamaProvider) SupportedParams(modelName string) []string {
+	return seededSamplingParams
+}
+
 // SetVerbose enables or disables verbose mode
 func (o *OllamaProvider) SetVerbose(verbose bool) {
 	o.verbose = verbose
 }
+
+// OllamaEmbedRequest represents the request structure for the Ollama embed API
+type OllamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// OllamaEmbedResponse represents the response structure from the Ollama embed API
+type OllamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Embed returns an embedding vector for each text using the Ollama embed API
+func (o *OllamaProvider) Embed(modelName string, texts []string) ([][]float32, error) {
+	o.debugf("Preparing to embed %d text(s) with model: %s", len(texts), modelName)
+
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		end := start + embeddingBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch := texts[start:end]
+
+		jsonData, err := json.Marshal(OllamaEmbedRequest{Model: modelName, Input: batch})
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling request: %v", err)
+		}
+
+		result, err := retry.WithRetry(
+			func() (interface{}, error) {
+				resp, err := o.post("/api/embed", jsonData, 5*time.Minute)
+				if err != nil {
+					return nil, err
+				}
+				defer resp.Body.Close()
+
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					return nil, fmt.Errorf("error reading response: %v", err)
+				}
+				if resp.StatusCode != http.StatusOK {
+					return nil, fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, string(body))
+				}
+
+				var embedResp OllamaEmbedResponse
+				if err := json.Unmarshal(body, &embedResp); err != nil {
+					return nil, fmt.Errorf("error parsing response: %v", err)
+				}
+				if len(embedResp.Embeddings) != len(batch) {
+					return nil, fmt.Errorf("expected %d embeddings, got %d", len(batch), len(embedResp.Embeddings))
+				}
+				return embedResp.Embeddings, nil
+			},
+			retry.Is429Error,
+			retry.DefaultRetryConfig,
+		)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, result.([][]float32)...)
+	}
+
+	o.debugf("Embedding completed, %d vector(s)", len(vectors))
+	return vectors, nil
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// newOllamaServer returns an Ollama API server with the given pulled models that
+// checks the expected headers
+func newOllamaServer(t *testing.T, pulled []string, wantHeaders map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range wantHeaders {
+			if got := r.Header.Get(name); got != value {
+				t.Errorf("Header %s = %q, want %q", name, got, value)
+			}
+		}
+		switch r.URL.Path {
+		case "/api/tags":
+			var resp OllamaTagsResponse
+			for _, name := range pulled {
+				resp.Models = append(resp.Models, OllamaModelTag{Name: name})
+			}
+			json.NewEncoder(w).Encode(resp)
+		case "/api/generate":
+			var req OllamaRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("Failed to decode request: %v", err)
+			}
+			json.NewEncoder(w).Encode(OllamaResponse{Response: "hello from " + req.Model, Done: true})
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestNormalizeEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"":                          "",
+		"gpu-box:11434":             "http://gpu-box:11434",
+		"http://gpu-box:11434/":     "http://gpu-box:11434",
+		" https://ollama.internal ": "https://ollama.internal",
+	}
+	for input, want := range tests {
+		if got := normalizeEndpoint(input); got != want {
+			t.Errorf("normalizeEndpoint(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestOllamaEndpointFromConfig(t *testing.T) {
+	server := newOllamaServer(t, []string{"llama3.2:latest"}, map[string]string{"Authorization": "Bearer secret"})
+	defer server.Close()
+
+	t.Setenv("OLLAMA_HOST", "unused-host:1")
+	LoadProviderConfig(&config.EnvConfig{Providers: map[string]*config.Provider{
+		"ollama": {Endpoint: server.URL + "/", Headers: map[string]string{"Authorization": "Bearer secret"}},
+	}})
+	defer LoadProviderConfig(nil)
+
+	provider := NewOllamaProvider()
+	if provider.Endpoint() != server.URL {
+		t.Errorf("Endpoint = %q, want %q", provider.Endpoint(), server.URL)
+	}
+	if err := provider.CheckModel("llama3.2"); err != nil {
+		t.Errorf("CheckModel failed: %v", err)
+	}
+	response, err := provider.SendPrompt("llama3.2", "hi")
+	if err != nil || response != "hello from llama3.2" {
+		t.Errorf("SendPrompt = %q, %v", response, err)
+	}
+
+	err = provider.CheckModel("mistral")
+	if err == nil || !strings.Contains(err.Error(), server.URL) || !strings.Contains(err.Error(), "ollama pull mistral") {
+		t.Errorf("Expected a descriptive missing-model error, got %v", err)
+	}
+}
+
+func TestOllamaEndpointFromEnvironment(t *testing.T) {
+	LoadProviderConfig(nil)
+	t.Setenv("OLLAMA_HOST", "gpu-box:11434")
+	if got := NewOllamaProvider().Endpoint(); got != "http://gpu-box:11434" {
+		t.Errorf("Endpoint = %q, want the OLLAMA_HOST value", got)
+	}
+
+	t.Setenv("OLLAMA_HOST", "")
+	if got := NewOllamaProvider().Endpoint(); got != defaultOllamaEndpoint {
+		t.Errorf("Endpoint = %q, want %q", got, defaultOllamaEndpoint)
+	}
+}
+
+func TestNamedOllamaHostRouting(t *testing.T) {
+	server := newOllamaServer(t, []string{"qwen2.5:72b"}, map[string]string{"X-Team": "research"})
+	defer server.Close()
+
+	LoadProviderConfig(&config.EnvConfig{Providers: map[string]*config.Provider{
+		"gpu-box": {
+			Type:     "ollama",
+			Endpoint: server.URL,
+			Headers:  map[string]string{"X-Team": "research"},
+			Models:   []config.Model{{Name: "qwen2.5:72b", Type: "external"}},
+		},
+	}})
+	defer LoadProviderConfig(nil)
+
+	provider := DetectProvider("qwen2.5:72b")
+	ollama, ok := provider.(*OllamaProvider)
+	if !ok || ollama.Name() != "gpu-box" || ollama.Endpoint() != server.URL {
+		t.Fatalf("Expected the gpu-box host to be detected, got %v", provider)
+	}
+	if ollama.SupportsModel("llama3.2") {
+		t.Error("A named host should only serve the models routed to it")
+	}
+	if err := ollama.CheckModel("qwen2.5:72b"); err != nil {
+		t.Errorf("CheckModel failed: %v", err)
+	}
+
+	discovered, err := DiscoverModels("gpu-box", "")
+	if err != nil || len(discovered) != 1 || discovered[0] != "qwen2.5:72b" {
+		t.Errorf("DiscoverModels = %v, %v", discovered, err)
+	}
+
+	configured, err := NewConfiguredProvider("gpu-box", &config.Provider{Type: "ollama", Endpoint: server.URL})
+	if err != nil || configured.Name() != "gpu-box" {
+		t.Errorf("NewConfiguredProvider = %v, %v", configured, err)
+	}
+}
+
+func TestOllamaInvalidTLSSettings(t *testing.T) {
+	provider := NewOllamaHostProvider(EndpointConfig{
+		Name:     "secure",
+		Endpoint: "https://ollama.invalid",
+		TLS:      &config.TLSConfig{CACert: "/nonexistent/ca.pem"},
+	})
+	_, err := provider.ListModels()
+	if err == nil || !strings.Contains(err.Error(), "ca_cert") {
+		t.Errorf("Expected a ca_cert error, got %v", err)
+	}
+
+	provider = NewOllamaHostProvider(EndpointConfig{
+		Name: "secure",
+		TLS:  &config.TLSConfig{ClientCert: "client.pem"},
+	})
+	if _, err := provider.ListModels(); err == nil || !strings.Contains(err.Error(), "client_key") {
+		t.Errorf("Expected a client_key error, got %v", err)
+	}
+}
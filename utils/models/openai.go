@@ -9,6 +9,8 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +20,25 @@ import (
 	openai "github.com/sashabaranov/go-openai"
 )
 
+// defaultOpenAIBaseURL is the root of the OpenAI API
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// openAIBaseURL returns the API root. OPENAI_BASE_URL points requests at another
+// server, such as a proxy or a local mock server in tests.
+func openAIBaseURL() string {
+	if baseURL := strings.TrimRight(os.Getenv("OPENAI_BASE_URL"), "/"); baseURL != "" {
+		return baseURL
+	}
+	return defaultOpenAIBaseURL
+}
+
+// newOpenAIClient returns an API client for the configured API root
+func newOpenAIClient(apiKey string) *openai.Client {
+	clientConfig := openai.DefaultConfig(apiKey)
+	clientConfig.BaseURL = openAIBaseURL()
+	return openai.NewClientWithConfig(clientConfig)
+}
+
 // OpenAIProvider handles OpenAI family of models
 type OpenAIProvider struct {
 	apiKey  string
@@ -38,6 +59,109 @@ func NewOpenAIProvider() *OpenAIProvider {
 	}
 }
 
+func init() {
+	Register(ProviderFactory{
+		Name:           "openai",
+		DisplayName:    "OpenAI",
+		New:            func() Provider { return NewOpenAIProvider() },
+		Priority:       80,
+		ConfigSchema:   []ConfigField{apiKeyField},
+		Discover:       discoverOpenAIModels,
+		FeaturedModels: featuredOpenAIModels,
+		Capabilities: []Capability{CapabilityText, CapabilityVision, CapabilityResponses,
+			CapabilityEmbeddings, CapabilityImageGeneration, CapabilityTranscription},
+		DetectCapability: detectOpenAICapability,
+	})
+}
+
+// detectOpenAICapability reports whether a model is an OpenAI embedding, image
+// or transcription model
+func detectOpenAICapability(capability Capability, modelName string) bool {
+	modelName = strings.ToLower(modelName)
+	switch capability {
+	case CapabilityEmbeddings:
+		return strings.HasPrefix(modelName, "text-embedding-3-") || modelName == "text-embedding-ada-002"
+	case CapabilityImageGeneration:
+		return strings.HasPrefix(modelName, "dall-e-") || strings.HasPrefix(modelName, "gpt-image-")
+	case CapabilityTranscription:
+		return strings.HasPrefix(modelName, "whisper-") || strings.Contains(modelName, "-transcribe")
+	}
+	return false
+}
+
+// featuredOpenAIModels are the latest o-series and flagship models, listed first
+// during configuration even if the models endpoint does not return them
+var featuredOpenAIModels = []string{
+	"gpt-4o",
+	"gpt-4o-audio-preview",
+	"o1",
+	"o3-mini",
+	"o1-pro",
+	"o4-mini",
+	"gpt-4.1",
+	"o3-pro", // Responses API only model
+	"o3",
+	"chatgpt-4o-latest",
+	"gpt-5",
+	"gpt-5-mini",
+	"gpt-5-nano",
+}
+
+// unsupportedOpenAIModelPatterns exclude models that cannot be used for chat steps
+var unsupportedOpenAIModelPatterns = []string{
+	"dall-e",      // Image generation
+	"tts-",        // Text-to-speech
+	"whisper-",    // Speech-to-text
+	"embedding",   // Text embeddings
+	"moderation",  // Content moderation
+	"babbage-002", // Older completion models
+	"davinci-002", // Older completion models
+}
+
+// isUnsupportedOpenAIModel checks if a model should be excluded from selection
+func isUnsupportedOpenAIModel(modelName string) bool {
+	modelName = strings.ToLower(modelName)
+	for _, pattern := range unsupportedOpenAIModelPatterns {
+		if strings.Contains(modelName, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// discoverOpenAIModels lists the chat models available to the API key: the
+// featured models first, then the other supported models alphabetically
+func discoverOpenAIModels(apiKey string) ([]string, error) {
+	if apiKey == "" {
+		return nil, ErrAPIKeyRequired
+	}
+	modelsList, err := newOpenAIClient(apiKey).ListModels(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error fetching OpenAI models: %v", err)
+	}
+
+	provider := NewOpenAIProvider()
+	var discovered []string
+	seen := make(map[string]bool)
+	for _, modelID := range featuredOpenAIModels {
+		if !isUnsupportedOpenAIModel(modelID) && provider.SupportsModel(modelID) {
+			discovered = append(discovered, modelID)
+			seen[modelID] = true
+		}
+	}
+
+	var others []string
+	for _, model := range modelsList.Models {
+		if seen[model.ID] || isUnsupportedOpenAIModel(model.ID) || !provider.SupportsModel(model.ID) {
+			continue
+		}
+		others = append(others, model.ID)
+		seen[model.ID] = true
+	}
+	sort.Strings(others)
+	return append(discovered, others...), nil
+}
+
 // Name returns the provider name
 func (o *OpenAIProvider) Name() string {
 	return "openai"
@@ -132,7 +256,7 @@ func (o *OpenAIProvider) createChatCompletionRequest(modelName string, messages
 	}
 
 	if o.isNewModelSeries(modelName) {
-		// New model series (4o and o1) have fixed parameters
+		// New model series (4o and o1) have fixed parameters unless a step sets them
 		req.MaxCompletionTokens = o.config.MaxCompletionTokens
 		req.Temperature = 1.0
 		req.TopP = 1.0
@@ -146,10 +270,29 @@ func (o *OpenAIProvider) createChatCompletionRequest(modelName string, messages
 		req.TopP = float32(o.config.TopP)
 		o.debugf("Using configured parameters for legacy model: Temperature=%.2f, TopP=%.2f", o.config.Temperature, o.config.TopP)
 	}
+	applyChatParams(&req, o.config)
 
 	return req
 }
 
+// isReasoningModel checks if the model is a reasoning model (o1, o3, o4, gpt-5),
+// which accepts a reasoning effort but no sampling parameters
+func isReasoningModel(modelName string) bool {
+	modelName = strings.ToLower(modelName)
+	return strings.HasPrefix(modelName, "o1") ||
+		strings.HasPrefix(modelName, "o3") ||
+		strings.HasPrefix(modelName, "o4-") ||
+		strings.HasPrefix(modelName, "gpt-5")
+}
+
+// SupportedParams lists the generation parameters the model accepts
+func (o *OpenAIProvider) SupportedParams(modelName string) []string {
+	if isReasoningModel(modelName) {
+		return reasoningParams
+	}
+	return seededSamplingParams
+}
+
 // SendPrompt sends a prompt to the specified model and returns the response
 func (o *OpenAIProvider) SendPrompt(modelName string, prompt string) (string, error) {
 	o.debugf("Preparing to send prompt to model: %s", modelName)
@@ -166,7 +309,7 @@ func (o *OpenAIProvider) SendPrompt(modelName string, prompt string) (string, er
 
 	o.debugf("Model validation passed, preparing API call")
 
-	client := openai.NewClient(o.apiKey)
+	client := newOpenAIClient(o.apiKey)
 
 	// Check if this is a vision input by looking for base64 image data
 	if strings.HasPrefix(modelName, "gpt-4") && strings.Contains(prompt, ";base64,") {
@@ -187,7 +330,7 @@ func (o *OpenAIProvider) SendPrompt(modelName string, prompt string) (string, er
 			resp, err := client.CreateChatCompletion(context.Background(), req)
 
 			if err != nil {
-				return "", fmt.Errorf("OpenAI API error: %v", err)
+				return "", fmt.Errorf("OpenAI API error: %w", err)
 			}
 
 			if len(resp.Choices) == 0 {
@@ -247,7 +390,7 @@ func (o *OpenAIProvider) SendPromptWithFile(modelName string, prompt string, fil
 		return "", fmt.Errorf("failed to read file: %v", err)
 	}
 
-	client := openai.NewClient(o.apiKey)
+	client := newOpenAIClient(o.apiKey)
 
 	// For GPT-4 Vision, handle image files
 	if strings.HasPrefix(modelName, "gpt-4") && strings.HasPrefix(file.MimeType, "image/") {
@@ -272,7 +415,60 @@ func (o *OpenAIProvider) SendPromptWithFile(modelName string, prompt string, fil
 			resp, err := client.CreateChatCompletion(context.Background(), req)
 
 			if err != nil {
-				return "", fmt.Errorf("OpenAI API error: %v", err)
+				return "", fmt.Errorf("OpenAI API error: %w", err)
+			}
+
+			if len(resp.Choices) == 0 {
+				return "", fmt.Errorf("no response choices returned from OpenAI")
+			}
+
+			return resp.Choices[0].Message.Content, nil
+		},
+		retry.Is429Error,
+		retry.DefaultRetryConfig,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	response := result.(string)
+	o.debugf("API call completed, response length: %d characters", len(response))
+
+	return response, nil
+}
+
+// SendPromptWithFiles sends a prompt with several files in a single request.
+// Images are sent as vision content and other files as labelled text.
+func (o *OpenAIProvider) SendPromptWithFiles(modelName string, prompt string, files []FileInput) (string, error) {
+	o.debugf("Preparing to send prompt with %d files to model: %s", len(files), modelName)
+
+	if o.apiKey == "" {
+		return "", fmt.Errorf("OpenAI provider not configured: missing API key")
+	}
+
+	if !o.SupportsModel(modelName) {
+		return "", fmt.Errorf("invalid OpenAI model: %s", modelName)
+	}
+
+	attachments, err := loadAttachments(files)
+	if err != nil {
+		return "", err
+	}
+	if err := rejectPDFs("OpenAI", attachments); err != nil {
+		return "", err
+	}
+
+	client := newOpenAIClient(o.apiKey)
+	messages := []openai.ChatCompletionMessage{chatAttachmentMessage(prompt, attachments)}
+
+	// Use retry mechanism for API calls
+	result, err := retry.WithRetry(
+		func() (interface{}, error) {
+			req := o.createChatCompletionRequest(modelName, messages)
+			resp, err := client.CreateChatCompletion(context.Background(), req)
+			if err != nil {
+				return "", fmt.Errorf("OpenAI API error: %w", err)
 			}
 
 			if len(resp.Choices) == 0 {
@@ -343,7 +539,7 @@ func (o *OpenAIProvider) handleFileAsVision(client *openai.Client, prompt string
 	resp, err := client.CreateChatCompletion(context.Background(), req)
 
 	if err != nil {
-		return "", fmt.Errorf("OpenAI Vision API error: %v", err)
+		return "", fmt.Errorf("OpenAI Vision API error: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
@@ -403,7 +599,7 @@ func (o *OpenAIProvider) handleVisionPrompt(client *openai.Client, prompt string
 	resp, err := client.CreateChatCompletion(context.Background(), req)
 
 	if err != nil {
-		return "", fmt.Errorf("OpenAI Vision API error: %v", err)
+		return "", fmt.Errorf("OpenAI Vision API error: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
@@ -454,6 +650,231 @@ func (o *OpenAIProvider) SetVerbose(verbose bool) {
 	o.verbose = verbose
 }
 
+// Transcribe converts an audio or video file to text using the OpenAI audio API
+func (o *OpenAIProvider) Transcribe(modelName string, file FileInput, opts TranscriptionOptions) (*Transcript, error) {
+	o.debugf("Preparing to transcribe %s with model: %s", file.Path, modelName)
+
+	if o.apiKey == "" {
+		return nil, fmt.Errorf("OpenAI provider not configured: missing API key")
+	}
+
+	transcript, err := transcribeOpenAICompatible(openAIBaseURL(), o.apiKey, modelName, file, opts)
+	if err != nil {
+		return nil, fmt.Errorf("OpenAI transcription error: %w", err)
+	}
+
+	o.debugf("Transcription completed, %d characters, %d segments", len(transcript.Text), len(transcript.Segments))
+	return transcript, nil
+}
+
+// GenerateImage creates images from a prompt using the OpenAI images API
+func (o *OpenAIProvider) GenerateImage(modelName string, prompt string, opts ImageOptions) ([]GeneratedImage, error) {
+	o.debugf("Preparing to generate image with model: %s", modelName)
+
+	if o.apiKey == "" {
+		return nil, fmt.Errorf("OpenAI provider not configured: missing API key")
+	}
+
+	req := openai.ImageRequest{
+		Prompt:  prompt,
+		Model:   modelName,
+		N:       opts.Count,
+		Size:    opts.Size,
+		Quality: opts.Quality,
+	}
+	// gpt-image models always return base64 data and reject response_format
+	if !strings.HasPrefix(strings.ToLower(modelName), "gpt-image-") {
+		req.ResponseFormat = openai.CreateImageResponseFormatB64JSON
+	}
+
+	client := newOpenAIClient(o.apiKey)
+	result, err := retry.WithRetry(
+		func() (interface{}, error) {
+			resp, err := client.CreateImage(context.Background(), req)
+			if err != nil {
+				return nil, fmt.Errorf("OpenAI API error: %w", err)
+			}
+			if len(resp.Data) == 0 {
+				return nil, fmt.Errorf("no images returned from OpenAI")
+			}
+			return resp, nil
+		},
+		retry.Is429Error,
+		retry.DefaultRetryConfig,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []GeneratedImage
+	for _, data := range result.(openai.ImageResponse).Data {
+		image, err := decodeBase64Image(data.B64JSON, "")
+		if err != nil {
+			return nil, err
+		}
+		image.RevisedPrompt = data.RevisedPrompt
+		images = append(images, image)
+	}
+
+	o.debugf("Generated %d image(s)", len(images))
+	return images, nil
+}
+
+// Embed returns an embedding vector for each text using the OpenAI embeddings API
+func (o *OpenAIProvider) Embed(modelName string, texts []string) ([][]float32, error) {
+	o.debugf("Preparing to embed %d text(s) with model: %s", len(texts), modelName)
+
+	if o.apiKey == "" {
+		return nil, fmt.Errorf("OpenAI provider not configured: missing API key")
+	}
+
+	vectors, err := embedOpenAICompatible(newOpenAIClient(o.apiKey), modelName, texts)
+	if err != nil {
+		return nil, fmt.Errorf("OpenAI embeddings error: %w", err)
+	}
+
+	o.debugf("Embedding completed, %d vector(s)", len(vectors))
+	return vectors, nil
+}
+
+// SubmitBatch uploads the requests as a JSONL file and creates a chat completions
+// batch, which is processed within 24 hours at a discount
+func (o *OpenAIProvider) SubmitBatch(requests []BatchRequest) (string, error) {
+	o.debugf("Submitting batch of %d requests", len(requests))
+
+	if o.apiKey == "" {
+		return "", fmt.Errorf("OpenAI provider not configured: missing API key")
+	}
+
+	upload := openai.UploadBatchFileRequest{FileName: "comanda-batch.jsonl"}
+	for _, request := range requests {
+		if !o.SupportsModel(request.Model) {
+			return "", fmt.Errorf("invalid OpenAI model: %s", request.Model)
+		}
+		message, err := batchChatMessage(request)
+		if err != nil {
+			return "", fmt.Errorf("batch request %s: %w", request.CustomID, err)
+		}
+		upload.AddChatCompletion(request.CustomID, o.createChatCompletionRequest(request.Model, []openai.ChatCompletionMessage{message}))
+	}
+
+	ctx := context.Background()
+	client := newOpenAIClient(o.apiKey)
+	file, err := client.UploadBatchFile(ctx, upload)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload batch file: %w", err)
+	}
+	batch, err := client.CreateBatch(ctx, openai.CreateBatchRequest{
+		InputFileID:      file.ID,
+		Endpoint:         openai.BatchEndpointChatCompletions,
+		CompletionWindow: "24h",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create batch: %w", err)
+	}
+
+	o.debugf("Created batch %s from file %s", batch.ID, file.ID)
+	return batch.ID, nil
+}
+
+// GetBatch returns the progress of a batch
+func (o *OpenAIProvider) GetBatch(batchID string) (BatchStatus, error) {
+	batch, err := newOpenAIClient(o.apiKey).RetrieveBatch(context.Background(), batchID)
+	if err != nil {
+		return BatchStatus{}, fmt.Errorf("failed to retrieve batch %s: %w", batchID, err)
+	}
+
+	status := BatchStatus{
+		ID:        batch.ID,
+		State:     BatchInProgress,
+		Total:     batch.RequestCounts.Total,
+		Completed: batch.RequestCounts.Completed,
+		Failed:    batch.RequestCounts.Failed,
+	}
+	switch batch.Status {
+	case "completed":
+		status.State = BatchCompleted
+	case "failed", "expired", "cancelled":
+		status.State = BatchFailed
+		status.Message = "batch " + batch.Status
+		if batch.Errors != nil {
+			for _, e := range batch.Errors.Data {
+				status.Message += "; " + e.Message
+			}
+		}
+	}
+	return status, nil
+}
+
+// openAIBatchLine is a line of a batch output or error file
+type openAIBatchLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int                           `json:"status_code"`
+		Body       openai.ChatCompletionResponse `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// BatchResults downloads the output and error files of a finished batch
+func (o *OpenAIProvider) BatchResults(batchID string) ([]BatchResult, error) {
+	ctx := context.Background()
+	client := newOpenAIClient(o.apiKey)
+	batch, err := client.RetrieveBatch(ctx, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve batch %s: %w", batchID, err)
+	}
+
+	var results []BatchResult
+	for _, fileID := range []*string{batch.OutputFileID, batch.ErrorFileID} {
+		if fileID == nil || *fileID == "" {
+			continue
+		}
+		content, err := client.GetFileContent(ctx, *fileID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download batch results %s: %w", *fileID, err)
+		}
+		scanner := bufio.NewScanner(content)
+		scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var line openAIBatchLine
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				content.Close()
+				return nil, fmt.Errorf("failed to parse batch results: %w", err)
+			}
+			results = append(results, line.result())
+		}
+		content.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read batch results: %w", err)
+		}
+	}
+	return results, nil
+}
+
+// result converts a batch output line to a BatchResult
+func (l openAIBatchLine) result() BatchResult {
+	result := BatchResult{CustomID: l.CustomID}
+	switch {
+	case l.Error != nil:
+		result.Error = l.Error.Message
+	case l.Response == nil:
+		result.Error = "no response"
+	case l.Response.StatusCode != http.StatusOK:
+		result.Error = fmt.Sprintf("request failed with status %d", l.Response.StatusCode)
+	case len(l.Response.Body.Choices) == 0:
+		result.Error = "no response choices returned"
+	default:
+		result.Response = l.Response.Body.Choices[0].Message.Content
+	}
+	return result
+}
+
 // prepareResponsesRequestBody prepares the request body for the Responses API
 func (o *OpenAIProvider) prepareResponsesRequestBody(config ResponsesConfig) (map[string]interface{}, error) {
 	// Build the request body
@@ -488,6 +909,10 @@ func (o *OpenAIProvider) prepareResponsesRequestBody(config ResponsesConfig) (ma
 		requestBody["top_p"] = config.TopP
 	}
 
+	if config.ReasoningEffort != "" {
+		requestBody["reasoning"] = map[string]interface{}{"effort": config.ReasoningEffort}
+	}
+
 	if len(config.Tools) > 0 {
 		// Format tools correctly for the API
 		var formattedTools []map[string]interface{}
@@ -622,7 +1047,7 @@ func (o *OpenAIProvider) SendPromptWithResponses(config ResponsesConfig) (string
 	// Use our generic retry mechanism instead of custom implementation
 	result, err := retry.WithRetry(
 		func() (interface{}, error) {
-			req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/responses", bytes.NewBuffer(jsonData))
+			req, err := http.NewRequestWithContext(ctx, "POST", openAIBaseURL()+"/responses", bytes.NewBuffer(jsonData))
 			if err != nil {
 				return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 			}
@@ -727,7 +1152,7 @@ func (o *OpenAIProvider) SendPromptWithResponsesStream(config ResponsesConfig, h
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/responses", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", openAIBaseURL()+"/responses", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create HTTP request: %w", err)
 	}
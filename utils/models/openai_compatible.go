@@ -0,0 +1,425 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/fileutil"
+	"github.com/kris-hansen/comanda/utils/retry"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// OpenAICompatibleType is the provider type for user-defined OpenAI-compatible endpoints
+const OpenAICompatibleType = "openai-compatible"
+
+// Auth schemes for OpenAI-compatible endpoints
+const (
+	AuthBearer = "bearer"  // Authorization: Bearer <key> (default)
+	AuthAPIKey = "api-key" // api-key: <key>, as used by Azure-style gateways
+	AuthNone   = "none"    // No credentials
+	// "header:<Name>" sends the key in a custom header, e.g. header:X-API-Key
+)
+
+// OpenAICompatibleConfig describes a named OpenAI-compatible endpoint such as
+// a LiteLLM proxy, LM Studio, OpenRouter, Groq or an internal gateway
+type OpenAICompatibleConfig struct {
+	Name    string
+	BaseURL string
+	Headers map[string]string
+	Auth    string
+	TLS     *config.TLSConfig
+	Models  []string
+}
+
+// OpenAICompatibleProvider handles any endpoint that implements the OpenAI chat
+// completions API. Each configured instance is a separate provider.
+type OpenAICompatibleProvider struct {
+	cfg     OpenAICompatibleConfig
+	apiKey  string
+	config  ModelConfig
+	verbose bool
+	mu      sync.Mutex
+}
+
+// OpenAICompatibleConfigFrom converts a provider entry of the environment configuration
+func OpenAICompatibleConfigFrom(name string, provider *config.Provider) OpenAICompatibleConfig {
+	cfg := OpenAICompatibleConfig{
+		Name:    name,
+		BaseURL: provider.BaseURL,
+		Headers: provider.Headers,
+		Auth:    provider.Auth,
+		TLS:     provider.TLS,
+	}
+	for _, model := range provider.Models {
+		cfg.Models = append(cfg.Models, model.Name)
+	}
+	return cfg
+}
+
+// lookupOpenAICompatible returns the configured openai-compatible endpoint with the given name
+func (r *Routing) lookupOpenAICompatible(name string) (OpenAICompatibleConfig, bool) {
+	for _, cfg := range r.compatible {
+		if cfg.Name == name {
+			return cfg, true
+		}
+	}
+	return OpenAICompatibleConfig{}, false
+}
+
+// findOpenAICompatibleProvider returns the configured endpoint that lists the model
+func (r *Routing) findOpenAICompatibleProvider(modelName string) *OpenAICompatibleProvider {
+	for _, cfg := range r.compatible {
+		provider := NewOpenAICompatibleProvider(cfg)
+		if provider.SupportsModel(modelName) {
+			return provider
+		}
+	}
+	return nil
+}
+
+// NewOpenAICompatibleProvider creates a provider for a configured endpoint
+func NewOpenAICompatibleProvider(cfg OpenAICompatibleConfig) *OpenAICompatibleProvider {
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.Auth == "" {
+		cfg.Auth = AuthBearer
+	}
+	return &OpenAICompatibleProvider{cfg: cfg}
+}
+
+// Name returns the configured instance name
+func (c *OpenAICompatibleProvider) Name() string {
+	return c.cfg.Name
+}
+
+// debugf prints debug information if verbose mode is enabled (thread-safe)
+func (c *OpenAICompatibleProvider) debugf(format string, args ...interface{}) {
+	if c.verbose {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		log.Printf("[DEBUG]["+c.cfg.Name+"] "+format+"\n", args...)
+	}
+}
+
+// SupportsModel reports whether the model is in the instance's model list
+func (c *OpenAICompatibleProvider) SupportsModel(modelName string) bool {
+	for _, model := range c.cfg.Models {
+		if strings.EqualFold(model, modelName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Configure validates the endpoint settings and stores the API key. The key may
+// be empty only when the auth scheme is "none".
+func (c *OpenAICompatibleProvider) Configure(apiKey string) error {
+	c.debugf("Configuring openai-compatible provider at %s", c.cfg.BaseURL)
+	if c.cfg.BaseURL == "" {
+		return fmt.Errorf("provider %s requires a base_url", c.cfg.Name)
+	}
+	if _, err := c.authHeader(); err != nil {
+		return err
+	}
+	if apiKey == "" && c.cfg.Auth != AuthNone {
+		return fmt.Errorf("API key is required for provider %s (set auth: none for endpoints without authentication)", c.cfg.Name)
+	}
+	c.apiKey = apiKey
+	return nil
+}
+
+// authHeader returns the header that carries the API key, or "" for bearer and no auth
+func (c *OpenAICompatibleProvider) authHeader() (string, error) {
+	switch auth := c.cfg.Auth; {
+	case auth == AuthBearer, auth == AuthNone:
+		return "", nil
+	case auth == AuthAPIKey:
+		return "api-key", nil
+	case strings.HasPrefix(auth, "header:") && strings.TrimSpace(strings.TrimPrefix(auth, "header:")) != "":
+		return strings.TrimSpace(strings.TrimPrefix(auth, "header:")), nil
+	default:
+		return "", fmt.Errorf("invalid auth '%s' for provider %s: must be bearer, api-key, none or header:<Name>", auth, c.cfg.Name)
+	}
+}
+
+// newClient creates a chat client for the endpoint with its headers and auth applied
+func (c *OpenAICompatibleProvider) newClient() (*openai.Client, error) {
+	headers := make(map[string]string, len(c.cfg.Headers)+1)
+	for name, value := range c.cfg.Headers {
+		headers[name] = value
+	}
+
+	token := ""
+	headerName, err := c.authHeader()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c.cfg.Auth == AuthBearer:
+		token = c.apiKey
+	case headerName != "":
+		headers[headerName] = c.apiKey
+	}
+
+	httpClient, err := EndpointConfig{Name: c.cfg.Name, Headers: headers, TLS: c.cfg.TLS}.httpClient(0)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConfig := openai.DefaultConfig(token)
+	clientConfig.BaseURL = c.cfg.BaseURL
+	clientConfig.HTTPClient = httpClient
+	return openai.NewClientWithConfig(clientConfig), nil
+}
+
+// userMessage builds the user message for a prompt. Prompts that embed a base64
+// image in the processor's "Input: ... Action: ..." format become vision messages.
+func userMessage(prompt string) openai.ChatCompletionMessage {
+	if strings.Contains(prompt, ";base64,") {
+		parts := strings.SplitN(prompt, "\n\nAction: ", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[0], "Input:\n") {
+			imageData := strings.TrimSpace(strings.TrimPrefix(parts[0], "Input:\n"))
+			if strings.HasPrefix(imageData, "data:image/") {
+				return imageMessage(strings.TrimSpace(parts[1]), imageData)
+			}
+		}
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: prompt}
+}
+
+// imageMessage builds a user message with text and an image data URI
+func imageMessage(text string, imageURL string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleUser,
+		MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: text},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: imageURL}},
+		},
+	}
+}
+
+// chat sends a chat completion request with retries and returns the first choice
+func (c *OpenAICompatibleProvider) chat(req openai.ChatCompletionRequest) (string, error) {
+	client, err := c.newClient()
+	if err != nil {
+		return "", err
+	}
+	c.applyParams(&req)
+
+	result, err := retry.WithRetry(
+		func() (interface{}, error) {
+			resp, err := client.CreateChatCompletion(context.Background(), req)
+			if err != nil {
+				return "", fmt.Errorf("%s API error: %w", c.cfg.Name, err)
+			}
+			if len(resp.Choices) == 0 {
+				return "", fmt.Errorf("no response choices returned from %s", c.cfg.Name)
+			}
+			return resp.Choices[0].Message.Content, nil
+		},
+		retry.Is429Error,
+		retry.DefaultRetryConfig,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	response := result.(string)
+	c.debugf("API call completed, response length: %d characters", len(response))
+	return response, nil
+}
+
+// SendPrompt sends a prompt to the specified model and returns the response
+func (c *OpenAICompatibleProvider) SendPrompt(modelName string, prompt string) (string, error) {
+	c.debugf("Preparing to send prompt to model: %s", modelName)
+	c.debugf("Prompt length: %d characters", len(prompt))
+
+	return c.chat(openai.ChatCompletionRequest{
+		Model:    modelName,
+		Messages: []openai.ChatCompletionMessage{userMessage(prompt)},
+	})
+}
+
+// SendPromptWithFile sends a prompt along with a file. Images are sent as
+// vision content; other files are included in the prompt as text.
+func (c *OpenAICompatibleProvider) SendPromptWithFile(modelName string, prompt string, file FileInput) (string, error) {
+	c.debugf("Preparing to send prompt with file to model: %s", modelName)
+	c.debugf("File path: %s", file.Path)
+
+	fileData, err := fileutil.SafeReadFile(file.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+
+	var message openai.ChatCompletionMessage
+	if strings.HasPrefix(file.MimeType, "image/") {
+		imageURL := string(fileData)
+		if !strings.HasPrefix(imageURL, "data:") {
+			imageURL = fmt.Sprintf("data:%s;base64,%s", file.MimeType, base64.StdEncoding.EncodeToString(fileData))
+		}
+		message = imageMessage(prompt, imageURL)
+	} else {
+		message = openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: fmt.Sprintf("File content:\n%s\n\nUser prompt: %s", string(fileData), prompt),
+		}
+	}
+
+	return c.chat(openai.ChatCompletionRequest{
+		Model:    modelName,
+		Messages: []openai.ChatCompletionMessage{message},
+	})
+}
+
+// SendPromptWithFiles sends a prompt with several files in a single request.
+// Images are sent as vision content and other files as labelled text.
+func (c *OpenAICompatibleProvider) SendPromptWithFiles(modelName string, prompt string, files []FileInput) (string, error) {
+	c.debugf("Preparing to send prompt with %d files to model: %s", len(files), modelName)
+
+	attachments, err := loadAttachments(files)
+	if err != nil {
+		return "", err
+	}
+	if err := rejectPDFs(c.Name(), attachments); err != nil {
+		return "", err
+	}
+
+	return c.chat(openai.ChatCompletionRequest{
+		Model:    modelName,
+		Messages: []openai.ChatCompletionMessage{chatAttachmentMessage(prompt, attachments)},
+	})
+}
+
+// applyParams adds the parameters set for the request. The endpoint's defaults
+// apply to every parameter a step does not set.
+func (c *OpenAICompatibleProvider) applyParams(req *openai.ChatCompletionRequest) {
+	if c.config.Params.MaxTokens != nil {
+		req.MaxTokens = c.config.MaxTokens
+	}
+	applyChatParams(req, c.config)
+}
+
+// SetConfig updates the provider configuration
+func (c *OpenAICompatibleProvider) SetConfig(config ModelConfig) {
+	c.config = config
+}
+
+// GetConfig returns the current provider configuration
+func (c *OpenAICompatibleProvider) GetConfig() ModelConfig {
+	return c.config
+}
+
+// SupportedParams lists the generation parameters the model accepts. Endpoints
+// are passed everything except a thinking budget, which chat completions lack.
+func (c *OpenAICompatibleProvider) SupportedParams(modelName string) []string {
+	return tunableReasoningParams
+}
+
+// responsesRequest maps a Responses API configuration onto a chat completion request
+func (c *OpenAICompatibleProvider) responsesRequest(cfg ResponsesConfig) (openai.ChatCompletionRequest, error) {
+	if len(cfg.Tools) > 0 {
+		return openai.ChatCompletionRequest{}, fmt.Errorf("provider %s does not support tools", c.cfg.Name)
+	}
+	if cfg.PreviousResponseID != "" {
+		return openai.ChatCompletionRequest{}, fmt.Errorf("provider %s does not support previous_response_id", c.cfg.Name)
+	}
+
+	var messages []openai.ChatCompletionMessage
+	if cfg.Instructions != "" {
+		messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: cfg.Instructions})
+	}
+	messages = append(messages, userMessage(cfg.Input))
+
+	req := openai.ChatCompletionRequest{
+		Model:       cfg.Model,
+		Messages:    messages,
+		MaxTokens:   cfg.MaxOutputTokens,
+		Temperature: float32(cfg.Temperature),
+		TopP:        float32(cfg.TopP),
+	}
+
+	if cfg.ResponseFormat != nil {
+		formatType, _ := cfg.ResponseFormat["type"].(string)
+		switch formatType {
+		case "json_object":
+			req.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+		case "text", "":
+		default:
+			return openai.ChatCompletionRequest{}, fmt.Errorf("provider %s does not support response_format type '%s'", c.cfg.Name, formatType)
+		}
+	}
+	return req, nil
+}
+
+// SendPromptWithResponses runs an openai-responses step against the chat
+// completions endpoint and returns the response text
+func (c *OpenAICompatibleProvider) SendPromptWithResponses(cfg ResponsesConfig) (string, error) {
+	req, err := c.responsesRequest(cfg)
+	if err != nil {
+		return "", err
+	}
+	return c.chat(req)
+}
+
+// SendPromptWithResponsesStream streams an openai-responses step, reporting each
+// text delta to the handler as it arrives
+func (c *OpenAICompatibleProvider) SendPromptWithResponsesStream(cfg ResponsesConfig, handler ResponsesStreamHandler) error {
+	req, err := c.responsesRequest(cfg)
+	if err != nil {
+		return err
+	}
+	req.Stream = true
+
+	client, err := c.newClient()
+	if err != nil {
+		return err
+	}
+
+	c.applyParams(&req)
+	stream, err := client.CreateChatCompletionStream(context.Background(), req)
+	if err != nil {
+		err = fmt.Errorf("%s API error: %w", c.cfg.Name, err)
+		handler.OnError(err)
+		return err
+	}
+	defer stream.Close()
+
+	var text strings.Builder
+	created := false
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			err = fmt.Errorf("%s stream error: %v", c.cfg.Name, err)
+			handler.OnError(err)
+			return err
+		}
+		if !created {
+			handler.OnResponseCreated(map[string]interface{}{"id": chunk.ID, "model": chunk.Model})
+			created = true
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				text.WriteString(choice.Delta.Content)
+				handler.OnOutputTextDelta(chunk.ID, choice.Index, 0, choice.Delta.Content)
+			}
+		}
+	}
+
+	c.debugf("Stream completed, response length: %d characters", text.Len())
+	handler.OnResponseCompleted(map[string]interface{}{"output": text.String()})
+	return nil
+}
+
+// SetVerbose enables or disables verbose mode
+func (c *OpenAICompatibleProvider) SetVerbose(verbose bool) {
+	c.verbose = verbose
+}
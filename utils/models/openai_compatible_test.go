@@ -0,0 +1,210 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// compatibleStreamHandler records streamed deltas
+type compatibleStreamHandler struct {
+	created   map[string]interface{}
+	deltas    []string
+	completed map[string]interface{}
+	err       error
+}
+
+func (h *compatibleStreamHandler) OnResponseCreated(response map[string]interface{}) {
+	h.created = response
+}
+func (h *compatibleStreamHandler) OnResponseInProgress(response map[string]interface{})     {}
+func (h *compatibleStreamHandler) OnOutputItemAdded(index int, item map[string]interface{}) {}
+func (h *compatibleStreamHandler) OnOutputTextDelta(itemID string, index int, contentIndex int, delta string) {
+	h.deltas = append(h.deltas, delta)
+}
+func (h *compatibleStreamHandler) OnResponseCompleted(response map[string]interface{}) {
+	h.completed = response
+}
+func (h *compatibleStreamHandler) OnError(err error) { h.err = err }
+
+// newCompatibleServer returns a chat completions server that checks headers and
+// hands each decoded request to inspect
+func newCompatibleServer(t *testing.T, wantHeaders map[string]string, inspect func(req map[string]interface{})) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		for name, value := range wantHeaders {
+			if got := r.Header.Get(name); got != value {
+				t.Errorf("Header %s = %q, want %q", name, got, value)
+			}
+		}
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if inspect != nil {
+			inspect(req)
+		}
+
+		if stream, _ := req["stream"].(bool); stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, delta := range []string{"Hel", "lo"} {
+				fmt.Fprintf(w, "data: {\"id\":\"chatcmpl-1\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", delta)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"}}]}`)
+	}))
+}
+
+func TestOpenAICompatibleAuthSchemes(t *testing.T) {
+	tests := []struct {
+		auth        string
+		wantHeaders map[string]string
+	}{
+		{"", map[string]string{"Authorization": "Bearer secret", "X-Team": "docs"}},
+		{AuthAPIKey, map[string]string{"api-key": "secret", "Authorization": ""}},
+		{"header:X-API-Key", map[string]string{"X-API-Key": "secret", "Authorization": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.auth, func(t *testing.T) {
+			server := newCompatibleServer(t, tt.wantHeaders, nil)
+			defer server.Close()
+
+			provider := NewOpenAICompatibleProvider(OpenAICompatibleConfig{
+				Name:    "gateway",
+				BaseURL: server.URL + "/v1/",
+				Headers: map[string]string{"X-Team": "docs"},
+				Auth:    tt.auth,
+				Models:  []string{"llama-3.1-70b"},
+			})
+			if err := provider.Configure("secret"); err != nil {
+				t.Fatalf("Configure failed: %v", err)
+			}
+			response, err := provider.SendPrompt("llama-3.1-70b", "Hi")
+			if err != nil || response != "Hello" {
+				t.Errorf("SendPrompt = %q, %v", response, err)
+			}
+		})
+	}
+}
+
+func TestOpenAICompatibleConfigure(t *testing.T) {
+	provider := NewOpenAICompatibleProvider(OpenAICompatibleConfig{Name: "groq", BaseURL: "https://api.groq.com/openai/v1"})
+	if err := provider.Configure(""); err == nil {
+		t.Error("Expected an error for a missing API key")
+	}
+
+	provider = NewOpenAICompatibleProvider(OpenAICompatibleConfig{Name: "lmstudio", BaseURL: "http://localhost:1234/v1", Auth: AuthNone})
+	if err := provider.Configure(""); err != nil {
+		t.Errorf("Expected auth none to work without a key, got %v", err)
+	}
+
+	provider = NewOpenAICompatibleProvider(OpenAICompatibleConfig{Name: "bad", BaseURL: "http://localhost", Auth: "basic"})
+	if err := provider.Configure("key"); err == nil {
+		t.Error("Expected an error for an invalid auth scheme")
+	}
+
+	provider = NewOpenAICompatibleProvider(OpenAICompatibleConfig{Name: "nourl"})
+	if err := provider.Configure("key"); err == nil {
+		t.Error("Expected an error for a missing base_url")
+	}
+}
+
+func TestOpenAICompatibleVision(t *testing.T) {
+	var content []interface{}
+	server := newCompatibleServer(t, nil, func(req map[string]interface{}) {
+		messages := req["messages"].([]interface{})
+		content, _ = messages[0].(map[string]interface{})["content"].([]interface{})
+	})
+	defer server.Close()
+
+	provider := NewOpenAICompatibleProvider(OpenAICompatibleConfig{Name: "lmstudio", BaseURL: server.URL + "/v1", Auth: AuthNone})
+	if err := provider.Configure(""); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	imagePath := filepath.Join(t.TempDir(), "pixel.png")
+	if err := os.WriteFile(imagePath, onePixelPNG, 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+	if _, err := provider.SendPromptWithFile("llava", "Describe", FileInput{Path: imagePath, MimeType: "image/png"}); err != nil {
+		t.Fatalf("SendPromptWithFile failed: %v", err)
+	}
+	if len(content) != 2 {
+		t.Fatalf("Expected text and image parts, got %v", content)
+	}
+	imageURL := content[1].(map[string]interface{})["image_url"].(map[string]interface{})["url"].(string)
+	if !strings.HasPrefix(imageURL, "data:image/png;base64,") {
+		t.Errorf("Unexpected image URL: %s", imageURL)
+	}
+
+	// Images inlined by the processor as data URIs are sent as vision content too
+	content = nil
+	if _, err := provider.SendPrompt("llava", "Input:\n"+imageURL+"\n\nAction: Describe"); err != nil {
+		t.Fatalf("SendPrompt failed: %v", err)
+	}
+	if len(content) != 2 || content[0].(map[string]interface{})["text"] != "Describe" {
+		t.Errorf("Expected a vision message, got %v", content)
+	}
+}
+
+func TestOpenAICompatibleResponsesStream(t *testing.T) {
+	var system string
+	server := newCompatibleServer(t, nil, func(req map[string]interface{}) {
+		messages := req["messages"].([]interface{})
+		system, _ = messages[0].(map[string]interface{})["content"].(string)
+	})
+	defer server.Close()
+
+	provider := NewOpenAICompatibleProvider(OpenAICompatibleConfig{Name: "openrouter", BaseURL: server.URL + "/v1"})
+	if err := provider.Configure("key"); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	handler := &compatibleStreamHandler{}
+	cfg := ResponsesConfig{Model: "m", Input: "Hi", Instructions: "Be brief", Stream: true}
+	if err := provider.SendPromptWithResponsesStream(cfg, handler); err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if system != "Be brief" {
+		t.Errorf("Expected instructions as the system message, got %q", system)
+	}
+	if strings.Join(handler.deltas, "") != "Hello" || handler.created["id"] != "chatcmpl-1" || handler.completed["output"] != "Hello" {
+		t.Errorf("Unexpected stream events: %+v", handler)
+	}
+
+	cfg.Tools = []map[string]interface{}{{"type": "web_search"}}
+	if _, err := provider.SendPromptWithResponses(cfg); err == nil {
+		t.Error("Expected an error for unsupported tools")
+	}
+}
+
+func TestOpenAICompatibleDetection(t *testing.T) {
+	envConfig := &config.EnvConfig{Providers: map[string]*config.Provider{
+		"litellm": {
+			Type:    OpenAICompatibleType,
+			BaseURL: "http://localhost:4000/v1",
+			Models:  []config.Model{{Name: "team-gpt"}},
+		},
+		"openai": {APIKey: "key", Models: []config.Model{{Name: "gpt-4o"}}},
+	}}
+	routing := NewRouting(envConfig)
+
+	if provider := routing.findOpenAICompatibleProvider("TEAM-GPT"); provider == nil || provider.Name() != "litellm" {
+		t.Errorf("Expected litellm for team-gpt, got %v", provider)
+	}
+	if provider := routing.findOpenAICompatibleProvider("gpt-4o"); provider != nil {
+		t.Errorf("Expected no compatible provider for gpt-4o, got %s", provider.Name())
+	}
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ParamsProvider is implemented by providers whose generation parameters can be
+// set per request
+type ParamsProvider interface {
+	Provider
+	SetConfig(config ModelConfig)
+	GetConfig() ModelConfig
+	// SupportedParams lists the generation parameters the model accepts
+	SupportedParams(modelName string) []string
+}
+
+// Parameter sets shared by several providers
+var (
+	// samplingParams are accepted by every chat model
+	samplingParams = []string{config.ParamTemperature, config.ParamTopP, config.ParamMaxTokens, config.ParamStop}
+	// seededSamplingParams adds a sampling seed for deterministic output
+	seededSamplingParams = append(append([]string{}, samplingParams...), config.ParamSeed)
+	// tunableReasoningParams are accepted by reasoning models that also honour sampling settings
+	tunableReasoningParams = append(append([]string{}, seededSamplingParams...), config.ParamReasoningEffort)
+	// fixedSamplingParams are accepted by models that ignore sampling settings
+	fixedSamplingParams = []string{config.ParamMaxTokens, config.ParamStop}
+	// reasoningParams are accepted by reasoning models, which sample with fixed settings
+	reasoningParams = []string{config.ParamMaxTokens, config.ParamSeed, config.ParamReasoningEffort}
+	// thinkingParams adds an extended thinking budget to the sampling parameters
+	thinkingParams = append(append([]string{}, samplingParams...), config.ParamThinkingBudget)
+)
+
+// WithParams returns the configuration with the explicitly set parameters applied
+func (c ModelConfig) WithParams(params config.ModelParams) ModelConfig {
+	if params.Temperature != nil {
+		c.Temperature = *params.Temperature
+	}
+	if params.TopP != nil {
+		c.TopP = *params.TopP
+	}
+	if params.MaxTokens != nil {
+		c.MaxTokens = *params.MaxTokens
+		c.MaxCompletionTokens = *params.MaxTokens
+	}
+	c.Params = c.Params.Merge(params)
+	return c
+}
+
+// ConfigureParams checks that the model accepts the parameters and applies them
+// to the provider. The provider should be an instance used only for the request.
+func ConfigureParams(provider Provider, modelName string, params config.ModelParams) error {
+	if params.IsZero() {
+		return nil
+	}
+	if err := params.Validate(); err != nil {
+		return fmt.Errorf("invalid params for model %s: %w", modelName, err)
+	}
+
+	paramsProvider, ok := provider.(ParamsProvider)
+	if !ok {
+		return fmt.Errorf("provider %s does not support generation parameters (got %s)",
+			provider.Name(), strings.Join(params.Names(), ", "))
+	}
+
+	supported := paramsProvider.SupportedParams(modelName)
+	var rejected []string
+	for _, name := range params.Names() {
+		if !containsString(supported, name) {
+			rejected = append(rejected, name)
+		}
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("model %s (%s) does not support parameter(s) %s; supported parameters: %s",
+			modelName, provider.Name(), strings.Join(rejected, ", "), strings.Join(supported, ", "))
+	}
+
+	paramsProvider.SetConfig(paramsProvider.GetConfig().WithParams(params))
+	return nil
+}
+
+// paramAPINames are the names providers use for each parameter in their APIs
+// and error messages
+var paramAPINames = map[string][]string{
+	config.ParamTemperature:     {"temperature"},
+	config.ParamTopP:            {"top_p", "topp"},
+	config.ParamMaxTokens:       {"max_tokens", "max_completion_tokens", "max_output_tokens", "maxoutputtokens", "num_predict"},
+	config.ParamStop:            {"stop_sequences", "stopsequences", "'stop'", "\"stop\""},
+	config.ParamSeed:            {"seed"},
+	config.ParamReasoningEffort: {"reasoning_effort", "reasoning.effort"},
+	config.ParamThinkingBudget:  {"thinking", "budget_tokens"},
+}
+
+// ExplainParamError names the parameters an API error refers to, so that a
+// request rejected because of a step's params says which parameter to change
+func ExplainParamError(err error, modelName string, params config.ModelParams) error {
+	if err == nil || params.IsZero() {
+		return err
+	}
+	message := strings.ToLower(err.Error())
+	var rejected []string
+	for _, name := range params.Names() {
+		for _, apiName := range paramAPINames[name] {
+			if strings.Contains(message, apiName) {
+				rejected = append(rejected, name)
+				break
+			}
+		}
+	}
+	if len(rejected) == 0 {
+		return err
+	}
+	return fmt.Errorf("model %s rejected parameter(s) %s: %w", modelName, strings.Join(rejected, ", "), err)
+}
+
+// applyChatParams adds the explicitly set parameters that the chat completions
+// request does not carry by default. go-openai omits a zero temperature, so an
+// explicit 0 is sent as the smallest positive value instead.
+func applyChatParams(req *openai.ChatCompletionRequest, cfg ModelConfig) {
+	params := cfg.Params
+	if params.Temperature != nil {
+		req.Temperature = float32(*params.Temperature)
+		if req.Temperature == 0 {
+			req.Temperature = math.SmallestNonzeroFloat32
+		}
+	}
+	if params.TopP != nil {
+		req.TopP = float32(*params.TopP)
+	}
+	if len(params.Stop) > 0 {
+		req.Stop = params.Stop
+	}
+	if params.Seed != nil {
+		seed := *params.Seed
+		req.Seed = &seed
+	}
+	if params.ReasoningEffort != "" {
+		req.ReasoningEffort = params.ReasoningEffort
+	}
+}
+
+// responsesParams are accepted by the Responses API
+var responsesParams = []string{config.ParamTemperature, config.ParamTopP, config.ParamMaxTokens, config.ParamReasoningEffort}
+
+// CheckResponsesParams reports parameters that the Responses API does not accept
+func CheckResponsesParams(params config.ModelParams) error {
+	if err := params.Validate(); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	var rejected []string
+	for _, name := range params.Names() {
+		if !containsString(responsesParams, name) {
+			rejected = append(rejected, name)
+		}
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("openai-responses steps do not support parameter(s) %s; supported parameters: %s",
+			strings.Join(rejected, ", "), strings.Join(responsesParams, ", "))
+	}
+	return nil
+}
+
+// ApplyParams sets the explicitly set parameters on the request. An explicit
+// temperature of 0 is sent as the smallest positive value, since a zero
+// temperature means the API default.
+func (c *ResponsesConfig) ApplyParams(params config.ModelParams) {
+	if params.Temperature != nil {
+		c.Temperature = *params.Temperature
+		if c.Temperature == 0 {
+			c.Temperature = math.SmallestNonzeroFloat32
+		}
+	}
+	if params.TopP != nil {
+		c.TopP = *params.TopP
+	}
+	if params.MaxTokens != nil {
+		c.MaxOutputTokens = *params.MaxTokens
+	}
+	c.ReasoningEffort = params.ReasoningEffort
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func floatParam(v float64) *float64 { return &v }
+func intParam(v int) *int           { return &v }
+
+func TestConfigureParamsRejectsUnsupported(t *testing.T) {
+	err := ConfigureParams(NewAnthropicProvider(), "claude-sonnet-4-5", config.ModelParams{Seed: intParam(7)})
+	if err == nil || !strings.Contains(err.Error(), "seed") || !strings.Contains(err.Error(), "supported parameters") {
+		t.Errorf("Expected seed to be rejected for Anthropic, got %v", err)
+	}
+
+	err = ConfigureParams(NewOpenAIProvider(), "o3-mini", config.ModelParams{Temperature: floatParam(0)})
+	if err == nil || !strings.Contains(err.Error(), "temperature") {
+		t.Errorf("Expected temperature to be rejected for a reasoning model, got %v", err)
+	}
+
+	err = ConfigureParams(NewOpenAIProvider(), "gpt-4o", config.ModelParams{Temperature: floatParam(3)})
+	if err == nil || !strings.Contains(err.Error(), "between 0 and 2") {
+		t.Errorf("Expected an out-of-range error, got %v", err)
+	}
+
+	provider := NewOpenAIProvider()
+	if err := ConfigureParams(provider, "gpt-4o", config.ModelParams{Temperature: floatParam(0.2), Seed: intParam(7)}); err != nil {
+		t.Fatalf("ConfigureParams failed: %v", err)
+	}
+	if cfg := provider.GetConfig(); cfg.Temperature != 0.2 || cfg.Params.Seed == nil || *cfg.Params.Seed != 7 {
+		t.Errorf("Params not applied: %+v", cfg)
+	}
+}
+
+func TestCompatibleProviderSendsParams(t *testing.T) {
+	server := newCompatibleServer(t, nil, func(req map[string]interface{}) {
+		if temperature, ok := req["temperature"].(float64); !ok || temperature > 0.001 {
+			t.Errorf("temperature = %v, want an explicit value near 0", req["temperature"])
+		}
+		if seed, _ := req["seed"].(float64); seed != 42 {
+			t.Errorf("seed = %v, want 42", req["seed"])
+		}
+		if stop, _ := req["stop"].([]interface{}); len(stop) != 1 || stop[0] != "END" {
+			t.Errorf("stop = %v, want [END]", req["stop"])
+		}
+		if maxTokens, _ := req["max_tokens"].(float64); maxTokens != 64 {
+			t.Errorf("max_tokens = %v, want 64", req["max_tokens"])
+		}
+	})
+	defer server.Close()
+
+	provider := NewOpenAICompatibleProvider(OpenAICompatibleConfig{Name: "local", BaseURL: server.URL + "/v1", Auth: AuthNone})
+	if err := provider.Configure(""); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	params := config.ModelParams{
+		Temperature: floatParam(0),
+		Seed:        intParam(42),
+		Stop:        []string{"END"},
+		MaxTokens:   intParam(64),
+	}
+	if err := ConfigureParams(provider, "llama", params); err != nil {
+		t.Fatalf("ConfigureParams failed: %v", err)
+	}
+	if _, err := provider.SendPrompt("llama", "Hi"); err != nil {
+		t.Errorf("SendPrompt failed: %v", err)
+	}
+}
+
+func TestOllamaRequestOptions(t *testing.T) {
+	provider := NewOllamaProvider()
+	if options := provider.requestOptions(); options != nil && len(options) != 0 {
+		t.Errorf("Expected no options without params, got %v", options)
+	}
+	provider.SetConfig(provider.GetConfig().WithParams(config.ModelParams{
+		Temperature: floatParam(0),
+		MaxTokens:   intParam(128),
+		Seed:        intParam(1),
+	}))
+	options := provider.requestOptions()
+	if options["temperature"] != 0.0 || options["num_predict"] != 128 || options["seed"] != 1 {
+		t.Errorf("Unexpected options: %v", options)
+	}
+}
+
+func TestAnthropicApplyParams(t *testing.T) {
+	provider := NewAnthropicProvider()
+	provider.SetConfig(provider.GetConfig().WithParams(config.ModelParams{Temperature: floatParam(0)}))
+	req := anthropicRequest{MaxTokens: provider.GetConfig().MaxTokens}
+	provider.applyParams(&req)
+	body, _ := json.Marshal(req)
+	if !strings.Contains(string(body), `"temperature":0`) || strings.Contains(string(body), "top_p") {
+		t.Errorf("Expected an explicit zero temperature only, got %s", body)
+	}
+
+	provider = NewAnthropicProvider()
+	provider.SetConfig(provider.GetConfig().WithParams(config.ModelParams{ThinkingBudget: intParam(8000), MaxTokens: intParam(2000)}))
+	req = anthropicRequest{MaxTokens: provider.GetConfig().MaxTokens}
+	provider.applyParams(&req)
+	if req.Thinking == nil || req.Thinking.BudgetTokens != 8000 {
+		t.Fatalf("Expected thinking to be enabled, got %+v", req.Thinking)
+	}
+	if req.MaxTokens != 10000 || req.Temperature != nil {
+		t.Errorf("max_tokens = %d, temperature = %v; want 10000 and no temperature", req.MaxTokens, req.Temperature)
+	}
+}
+
+func TestResponsesParams(t *testing.T) {
+	if err := CheckResponsesParams(config.ModelParams{Seed: intParam(1)}); err == nil || !strings.Contains(err.Error(), "seed") {
+		t.Errorf("Expected seed to be rejected, got %v", err)
+	}
+	var cfg ResponsesConfig
+	cfg.ApplyParams(config.ModelParams{Temperature: floatParam(0), MaxTokens: intParam(50), ReasoningEffort: "low"})
+	if cfg.Temperature <= 0 || cfg.MaxOutputTokens != 50 || cfg.ReasoningEffort != "low" {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+}
+
+func TestExplainParamError(t *testing.T) {
+	params := config.ModelParams{Seed: intParam(1), TopP: floatParam(0.5)}
+	err := ExplainParamError(errors.New("400 Bad Request: unknown field 'seed'"), "gpt-4o", params)
+	if err == nil || !strings.Contains(err.Error(), "rejected parameter(s) seed") || strings.Contains(err.Error(), "top_p,") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	original := errors.New("rate limited")
+	if got := ExplainParamError(original, "gpt-4o", params); got != original {
+		t.Errorf("Unrelated errors should be returned unchanged, got %v", got)
+	}
+}
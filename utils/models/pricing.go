@@ -0,0 +1,78 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// modelPrices are the list prices of hosted models in US dollars per million
+// tokens. Names match by prefix, so dated versions such as gpt-4o-2024-08-06 are
+// priced like their family; the longest matching prefix wins. Prices change, so
+// they can be overridden with pricing in a model's configuration.
+var modelPrices = map[string]config.Pricing{
+	// OpenAI
+	"gpt-5":                  {Input: 1.25, Output: 10},
+	"gpt-5-mini":             {Input: 0.25, Output: 2},
+	"gpt-5-nano":             {Input: 0.05, Output: 0.4},
+	"gpt-4.1":                {Input: 2, Output: 8},
+	"gpt-4.1-mini":           {Input: 0.4, Output: 1.6},
+	"gpt-4.1-nano":           {Input: 0.1, Output: 0.4},
+	"gpt-4o":                 {Input: 2.5, Output: 10},
+	"gpt-4o-mini":            {Input: 0.15, Output: 0.6},
+	"gpt-4-turbo":            {Input: 10, Output: 30},
+	"gpt-3.5-turbo":          {Input: 0.5, Output: 1.5},
+	"o1":                     {Input: 15, Output: 60},
+	"o1-mini":                {Input: 1.1, Output: 4.4},
+	"o1-pro":                 {Input: 150, Output: 600},
+	"o3":                     {Input: 2, Output: 8},
+	"o3-mini":                {Input: 1.1, Output: 4.4},
+	"o3-pro":                 {Input: 20, Output: 80},
+	"o4-mini":                {Input: 1.1, Output: 4.4},
+	"text-embedding-3-small": {Input: 0.02},
+	"text-embedding-3-large": {Input: 0.13},
+
+	// Anthropic
+	"claude-opus-4":     {Input: 15, Output: 75},
+	"claude-opus-4-5":   {Input: 5, Output: 25},
+	"claude-3-opus":     {Input: 15, Output: 75},
+	"claude-sonnet-4":   {Input: 3, Output: 15},
+	"claude-3-7-sonnet": {Input: 3, Output: 15},
+	"claude-3-5-sonnet": {Input: 3, Output: 15},
+	"claude-haiku-4-5":  {Input: 1, Output: 5},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4},
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25},
+
+	// Google
+	"gemini-2.5-pro":        {Input: 1.25, Output: 10},
+	"gemini-2.5-flash":      {Input: 0.3, Output: 2.5},
+	"gemini-2.5-flash-lite": {Input: 0.1, Output: 0.4},
+	"gemini-2.0-flash":      {Input: 0.1, Output: 0.4},
+	"gemini-2.0-flash-lite": {Input: 0.075, Output: 0.3},
+	"gemini-1.5-pro":        {Input: 1.25, Output: 5},
+	"gemini-1.5-flash":      {Input: 0.075, Output: 0.3},
+
+	// DeepSeek, xAI and Moonshot
+	"deepseek-chat":     {Input: 0.27, Output: 1.1},
+	"deepseek-reasoner": {Input: 0.55, Output: 2.19},
+	"grok-4":            {Input: 3, Output: 15},
+	"grok-3":            {Input: 3, Output: 15},
+	"grok-3-mini":       {Input: 0.3, Output: 0.5},
+	"kimi-k2":           {Input: 0.6, Output: 2.5},
+}
+
+// LookupPrice returns the built-in list price of a model, by the name the
+// provider's API expects. It reports false for models without a known price.
+func LookupPrice(modelName string) (config.Pricing, bool) {
+	name := strings.ToLower(modelName)
+	best := ""
+	for prefix := range modelPrices {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return config.Pricing{}, false
+	}
+	return modelPrices[best], true
+}
@@ -0,0 +1,28 @@
+package models
+
+import "testing"
+
+func TestLookupPrice(t *testing.T) {
+	tests := []struct {
+		model  string
+		input  float64
+		output float64
+		found  bool
+	}{
+		{model: "gpt-4o", input: 2.5, output: 10, found: true},
+		{model: "gpt-4o-mini", input: 0.15, output: 0.6, found: true},
+		{model: "gpt-4o-2024-08-06", input: 2.5, output: 10, found: true},
+		{model: "claude-sonnet-4-5", input: 3, output: 15, found: true},
+		{model: "claude-opus-4-5-20251101", input: 5, output: 25, found: true},
+		{model: "claude-opus-4-1", input: 15, output: 75, found: true},
+		{model: "llama3", found: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			price, found := LookupPrice(tt.model)
+			if found != tt.found || price.Input != tt.input || price.Output != tt.output {
+				t.Errorf("LookupPrice(%q) = %+v, %v; want {%v %v}, %v", tt.model, price, found, tt.input, tt.output, tt.found)
+			}
+		})
+	}
+}
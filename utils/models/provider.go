@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -16,12 +17,18 @@ type ModelConfig struct {
 	MaxTokens           int
 	MaxCompletionTokens int
 	TopP                float64
+	// Params holds the parameters set explicitly for the request, including
+	// those without a field above such as stop sequences and seed
+	Params config.ModelParams
 }
 
 // FileInput represents a file to be processed by the model
 type FileInput struct {
 	Path     string
 	MimeType string
+	// Data holds the contents when they are already loaded, e.g. a resized image
+	// as a data URI. Multi-file requests read Path when it is nil.
+	Data []byte
 }
 
 // ResponsesConfig represents configuration for OpenAI Responses API
@@ -33,6 +40,7 @@ type ResponsesConfig struct {
 	MaxOutputTokens    int
 	Temperature        float64
 	TopP               float64
+	ReasoningEffort    string
 	Stream             bool
 	Tools              []map[string]interface{}
 	ResponseFormat     map[string]interface{}
@@ -65,6 +73,14 @@ type ResponsesProvider interface {
 	SendPromptWithResponsesStream(config ResponsesConfig, handler ResponsesStreamHandler) error
 }
 
+// StepProvider is implemented by providers that answer the requests of each
+// workflow step differently, such as the scripted providers of workflow tests
+type StepProvider interface {
+	Provider
+	// ForStep returns the provider that sends the requests of the named step
+	ForStep(step string) Provider
+}
+
 // OllamaTagsResponse represents the response from Ollama's /api/tags endpoint
 type OllamaTagsResponse struct {
 	Models []OllamaModelTag `json:"models"`
@@ -75,65 +91,17 @@ type OllamaModelTag struct {
 	Name string `json:"name"`
 }
 
-// isModelAvailableLocally checks if a model is available in the local Ollama instance
+// isModelAvailableLocally checks if a model is pulled on the default Ollama host
 func isModelAvailableLocally(modelName string) bool {
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get("http://localhost:11434/api/tags")
+	available, err := NewOllamaProvider().ListModels()
 	if err != nil {
-		config.DebugLog("[Provider] Failed to connect to Ollama: %v", err)
-		return false
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		config.DebugLog("[Provider] Ollama API returned status %d", resp.StatusCode)
+		config.DebugLog("[Provider] Failed to list Ollama models: %v", err)
 		return false
 	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		config.DebugLog("[Provider] Failed to read Ollama response: %v", err)
-		return false
-	}
-
-	var tagsResponse OllamaTagsResponse
-	if err := json.Unmarshal(body, &tagsResponse); err != nil {
-		config.DebugLog("[Provider] Failed to parse Ollama response: %v", err)
-		return false
+	if match := matchOllamaModel(modelName, available); match != "" {
+		config.DebugLog("[Provider] Found local model: %s -> %s", modelName, match)
+		return true
 	}
-
-	modelNameLower := strings.ToLower(modelName)
-	for _, model := range tagsResponse.Models {
-		modelFullName := strings.ToLower(model.Name)
-
-		// First check exact match
-		if modelFullName == modelNameLower {
-			config.DebugLog("[Provider] Found local model (exact match): %s", modelName)
-			return true
-		}
-
-		// Then check if the requested model matches the base name (before :tag)
-		// e.g., "gpt-oss" should match "gpt-oss:latest"
-		if strings.Contains(modelFullName, ":") {
-			baseName := strings.Split(modelFullName, ":")[0]
-			if baseName == modelNameLower {
-				config.DebugLog("[Provider] Found local model (tag match): %s -> %s", modelName, model.Name)
-				return true
-			}
-		}
-
-		// Also check if the full model name starts with the requested name
-		// e.g., "llama3" should match "llama3.2:latest"
-		if strings.HasPrefix(modelFullName, modelNameLower) {
-			// Make sure we're not matching partial names unintentionally
-			nextChar := modelFullName[len(modelNameLower):]
-			if strings.HasPrefix(nextChar, ":") || strings.HasPrefix(nextChar, ".") {
-				config.DebugLog("[Provider] Found local model (prefix match): %s -> %s", modelName, model.Name)
-				return true
-			}
-		}
-	}
-
 	config.DebugLog("[Provider] Model %s not found locally", modelName)
 	return false
 }
@@ -148,44 +116,51 @@ type VLLMModelInfo struct {
 	ID string `json:"id"`
 }
 
-// isModelAvailableOnVLLM checks if a model is available on the local vLLM instance
-func isModelAvailableOnVLLM(modelName string) bool {
-	// Get vLLM endpoint from environment or use default
-	endpoint := "http://localhost:8000"
-	// Note: endpoint customization can be done via VLLM_ENDPOINT environment variable
-	// which is read in the VLLMProvider itself
+// listVLLMModels returns the IDs of the models served by the local vLLM instance
+func listVLLMModels() ([]string, error) {
+	vllm := NewVLLMProvider()
+	endpoint := vllm.endpoint
 
-	client := &http.Client{Timeout: 5 * time.Second}
+	client, err := vllm.host.httpClient(5 * time.Second)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := client.Get(endpoint + "/v1/models")
 	if err != nil {
-		config.DebugLog("[Provider] Failed to connect to vLLM: %v", err)
-		return false
+		return nil, fmt.Errorf("error connecting to vLLM API at %s: %v", endpoint, err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		config.DebugLog("[Provider] vLLM API returned status %d", resp.StatusCode)
-		return false
-	}
-
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		config.DebugLog("[Provider] Failed to read vLLM response: %v", err)
-		return false
+		return nil, fmt.Errorf("error reading vLLM response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vLLM API error (status %d): %s", resp.StatusCode, string(body))
 	}
 
 	var modelsResponse VLLMModelsResponse
 	if err := json.Unmarshal(body, &modelsResponse); err != nil {
-		config.DebugLog("[Provider] Failed to parse vLLM response: %v", err)
-		return false
+		return nil, fmt.Errorf("error decoding vLLM response: %v", err)
 	}
 
-	modelNameLower := strings.ToLower(modelName)
-	for _, model := range modelsResponse.Data {
-		modelIDLower := strings.ToLower(model.ID)
+	ids := make([]string, len(modelsResponse.Data))
+	for i, model := range modelsResponse.Data {
+		ids[i] = model.ID
+	}
+	return ids, nil
+}
+
+// isModelAvailableOnVLLM checks if a model is available on the local vLLM instance
+func isModelAvailableOnVLLM(modelName string) bool {
+	vllmModels, err := listVLLMModels()
+	if err != nil {
+		config.DebugLog("[Provider] Failed to list vLLM models: %v", err)
+		return false
+	}
 
-		// Check for exact match
-		if modelIDLower == modelNameLower {
+	for _, id := range vllmModels {
+		if strings.EqualFold(id, modelName) {
 			config.DebugLog("[Provider] Found vLLM model (exact match): %s", modelName)
 			return true
 		}
@@ -201,51 +176,8 @@ type DetectProviderFunc func(modelName string) Provider
 // DetectProvider determines the appropriate provider based on the model name
 var DetectProvider DetectProviderFunc = defaultDetectProvider
 
-// defaultDetectProvider is the default implementation of DetectProvider
+// defaultDetectProvider is the default implementation of DetectProvider. It
+// returns nil when the model cannot be resolved; use ResolveModel for the reason.
 func defaultDetectProvider(modelName string) Provider {
-	config.DebugLog("[Provider] Attempting to detect provider for model: %s", modelName)
-
-	// First, check local providers (Ollama and vLLM)
-	// This prioritizes local models over third-party providers
-
-	// Check Ollama
-	ollamaProvider := NewOllamaProvider()
-	if ollamaProvider.SupportsModel(modelName) {
-		// Check if the model actually exists locally
-		if isModelAvailableLocally(modelName) {
-			config.DebugLog("[Provider] Found local Ollama provider for model %s", modelName)
-			return ollamaProvider
-		}
-	}
-
-	// Check vLLM
-	vllmProvider := NewVLLMProvider()
-	if vllmProvider.SupportsModel(modelName) {
-		// Check if the model actually exists on vLLM server
-		if isModelAvailableOnVLLM(modelName) {
-			config.DebugLog("[Provider] Found local vLLM provider for model %s", modelName)
-			return vllmProvider
-		}
-	}
-
-	// Order third-party providers from most specific to most general
-	providers := []Provider{
-		NewGoogleProvider(),    // Handles gemini- models
-		NewAnthropicProvider(), // Handles claude- models
-		NewXAIProvider(),       // Handles grok- models
-		NewDeepseekProvider(),  // Handles deepseek- models
-		NewMoonshotProvider(),  // Handles moonshot- models
-		NewOpenAIProvider(),    // Handles gpt- models
-	}
-
-	for _, provider := range providers {
-		if provider.SupportsModel(modelName) {
-			config.DebugLog("[Provider] Found provider %s for model %s", provider.Name(), modelName)
-			return provider
-		}
-	}
-
-	// If no third-party provider supports it, fall back to Ollama as a catch-all
-	config.DebugLog("[Provider] No third-party provider found, using Ollama as fallback for model %s", modelName)
-	return ollamaProvider
+	return currentRouting().DetectProvider(modelName)
 }
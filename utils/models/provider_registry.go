@@ -0,0 +1,208 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Capability is a feature a provider offers beyond plain text prompts
+type Capability string
+
+// Provider capabilities
+const (
+	CapabilityText            Capability = "text"
+	CapabilityVision          Capability = "vision"
+	CapabilityResponses       Capability = "responses"
+	CapabilityEmbeddings      Capability = "embeddings"
+	CapabilityImageGeneration Capability = "image-generation"
+	CapabilityTranscription   Capability = "transcription"
+)
+
+// ErrAPIKeyRequired is returned by discovery functions that need credentials
+var ErrAPIKeyRequired = errors.New("API key is required")
+
+// ConfigField describes a setting a provider needs in the environment configuration
+type ConfigField struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Secret      bool   `json:"secret"`
+}
+
+// apiKeyField is the configuration schema shared by hosted providers
+var apiKeyField = ConfigField{Key: "api_key", Description: "API key", Required: true, Secret: true}
+
+// ProviderFactory declares a provider to the rest of comanda: how to create it,
+// which models it serves, what it needs to be configured and what it can do.
+// Providers add themselves with Register, usually from an init function.
+type ProviderFactory struct {
+	// Name is the provider key used in the environment configuration
+	Name string
+	// DisplayName is shown in prompts and messages; defaults to Name
+	DisplayName string
+	// New creates an unconfigured provider instance
+	New func() Provider
+	// Priority orders detection; lower values are tried first
+	Priority int
+	// Detect reports whether the provider serves a model. When nil, the
+	// provider's SupportsModel is used.
+	Detect func(modelName string) bool
+	// Local providers run on the user's machine, need no API key and are
+	// configured with "LOCAL"
+	Local bool
+	// ConfigSchema lists the settings the provider reads from the configuration
+	ConfigSchema []ConfigField
+	// Discover lists the models available from the provider
+	Discover func(apiKey string) ([]string, error)
+	// FeaturedModels are listed first when choosing models during configuration
+	FeaturedModels []string
+	// Capabilities lists the features the provider implements
+	Capabilities []Capability
+	// DetectCapability reports whether the provider serves a model for one of
+	// its capabilities other than text, such as an embedding model. Without
+	// it, the provider is only used for those capabilities when named.
+	DetectCapability func(capability Capability, modelName string) bool
+}
+
+// Label returns the display name of the provider
+func (f ProviderFactory) Label() string {
+	if f.DisplayName != "" {
+		return f.DisplayName
+	}
+	return f.Name
+}
+
+// HasCapability reports whether the provider declares a capability
+func (f ProviderFactory) HasCapability(capability Capability) bool {
+	for _, c := range f.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Detects reports whether the provider serves the model
+func (f ProviderFactory) Detects(modelName string) bool {
+	if f.Detect != nil {
+		return f.Detect(modelName)
+	}
+	return f.New().SupportsModel(modelName)
+}
+
+// DetectsFor reports whether the provider serves the model for a capability
+func (f ProviderFactory) DetectsFor(capability Capability, modelName string) bool {
+	return f.HasCapability(capability) && f.DetectCapability != nil && f.DetectCapability(capability, modelName)
+}
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]ProviderFactory)
+)
+
+// Register makes a provider available for detection, configuration and
+// discovery. It panics if the factory has no name or constructor, or if a
+// provider with the same name is already registered.
+func Register(factory ProviderFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory.Name == "" || factory.New == nil {
+		panic("models: Register requires a provider name and constructor")
+	}
+	if _, exists := factories[factory.Name]; exists {
+		panic("models: Register called twice for provider " + factory.Name)
+	}
+	factories[factory.Name] = factory
+}
+
+// RegisteredProviders returns all registered providers in detection order
+func RegisteredProviders() []ProviderFactory {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	list := make([]ProviderFactory, 0, len(factories))
+	for _, factory := range factories {
+		list = append(list, factory)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Priority != list[j].Priority {
+			return list[i].Priority < list[j].Priority
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// NewCapableProvider creates an unconfigured instance of the provider serving a
+// model for a capability: the named provider if it declares the capability, or
+// else the first registered provider that detects the model for it. It
+// returns nil if no provider serves the model.
+func NewCapableProvider(capability Capability, modelName string, providerName string) Provider {
+	if providerName != "" {
+		factory, ok := LookupProvider(strings.ToLower(providerName))
+		if !ok || !factory.HasCapability(capability) {
+			return nil
+		}
+		return factory.New()
+	}
+	for _, factory := range RegisteredProviders() {
+		if factory.DetectsFor(capability, modelName) {
+			return factory.New()
+		}
+	}
+	return nil
+}
+
+// ProviderNames returns the names of all registered providers in detection order
+func ProviderNames() []string {
+	var names []string
+	for _, factory := range RegisteredProviders() {
+		names = append(names, factory.Name)
+	}
+	return names
+}
+
+// LookupProvider returns the registered provider with the given name
+func LookupProvider(name string) (ProviderFactory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	factory, ok := factories[name]
+	return factory, ok
+}
+
+// NewProviderByName creates an unconfigured instance of a registered provider
+func NewProviderByName(name string) (Provider, error) {
+	factory, ok := LookupProvider(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown provider: %s", name)
+	}
+	return factory.New(), nil
+}
+
+// DiscoverModels lists the models available from a registered provider or a
+// named Ollama host
+func DiscoverModels(name string, apiKey string) ([]string, error) {
+	if host, ok := currentRouting().lookupOllamaHost(name); ok {
+		return NewOllamaHostProvider(host).ListModels()
+	}
+	factory, ok := LookupProvider(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown provider: %s", name)
+	}
+	if factory.Discover == nil {
+		return nil, fmt.Errorf("provider %s does not support model discovery", name)
+	}
+	return factory.Discover(apiKey)
+}
+
+// registryModels returns a discovery function for the models listed in the
+// central model registry
+func registryModels(providerName string) func(string) ([]string, error) {
+	return func(string) ([]string, error) {
+		return GetRegistry().GetModels(providerName), nil
+	}
+}
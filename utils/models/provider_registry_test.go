@@ -0,0 +1,136 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+// forkProvider is a minimal provider registered the way an out-of-tree provider would be
+type forkProvider struct{ OllamaProvider }
+
+func (f *forkProvider) Name() string                        { return "fork" }
+func (f *forkProvider) SupportsModel(modelName string) bool { return modelName == "fork-model-1" }
+
+func TestBuiltinProvidersRegistered(t *testing.T) {
+	for _, name := range []string{"openai", "anthropic", "google", "xai", "deepseek", "moonshot", "ollama", "vllm"} {
+		factory, ok := LookupProvider(name)
+		if !ok {
+			t.Errorf("Provider %s is not registered", name)
+			continue
+		}
+		provider := factory.New()
+		if provider.Name() != name {
+			t.Errorf("Factory %s creates provider named %s", name, provider.Name())
+		}
+		if factory.Discover == nil {
+			t.Errorf("Provider %s has no discovery function", name)
+		}
+		if !factory.Local && len(factory.ConfigSchema) == 0 {
+			t.Errorf("Hosted provider %s declares no configuration", name)
+		}
+
+		// Declared capabilities must match the implemented interfaces
+		checks := []struct {
+			capability Capability
+			implements bool
+		}{
+			{CapabilityResponses, isResponsesProvider(provider)},
+			{CapabilityEmbeddings, isEmbeddingProvider(provider)},
+			{CapabilityImageGeneration, isImageGenerationProvider(provider)},
+			{CapabilityTranscription, isTranscriptionProvider(provider)},
+		}
+		for _, check := range checks {
+			if factory.HasCapability(check.capability) != check.implements {
+				t.Errorf("Provider %s: declared %s=%v but implements=%v", name, check.capability,
+					factory.HasCapability(check.capability), check.implements)
+			}
+		}
+	}
+}
+
+func isResponsesProvider(p Provider) bool       { _, ok := p.(ResponsesProvider); return ok }
+func isEmbeddingProvider(p Provider) bool       { _, ok := p.(EmbeddingProvider); return ok }
+func isImageGenerationProvider(p Provider) bool { _, ok := p.(ImageGenerationProvider); return ok }
+func isTranscriptionProvider(p Provider) bool   { _, ok := p.(TranscriptionProvider); return ok }
+
+func TestRegisterCustomProvider(t *testing.T) {
+	Register(ProviderFactory{
+		Name:         "fork",
+		New:          func() Provider { return &forkProvider{} },
+		Priority:     5,
+		Discover:     func(string) ([]string, error) { return []string{"fork-model-1"}, nil },
+		Capabilities: []Capability{CapabilityText},
+	})
+
+	if provider := DetectProvider("fork-model-1"); provider == nil || provider.Name() != "fork" {
+		t.Errorf("Expected the registered provider to be detected, got %v", provider)
+	}
+	if provider := DetectProvider("claude-3-5-sonnet-latest"); provider == nil || provider.Name() != "anthropic" {
+		t.Errorf("Expected anthropic for a claude model, got %v", provider)
+	}
+	if discovered, err := DiscoverModels("fork", ""); err != nil || len(discovered) != 1 {
+		t.Errorf("DiscoverModels = %v, %v", discovered, err)
+	}
+	if _, err := NewProviderByName("fork"); err != nil {
+		t.Errorf("NewProviderByName failed: %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic when registering a provider twice")
+		}
+	}()
+	Register(ProviderFactory{Name: "fork", New: func() Provider { return &forkProvider{} }})
+}
+
+func TestNewCapableProvider(t *testing.T) {
+	Register(ProviderFactory{
+		Name:         "fork-embeddings",
+		New:          func() Provider { return &forkProvider{} },
+		Priority:     5,
+		Detect:       func(string) bool { return false },
+		Capabilities: []Capability{CapabilityEmbeddings},
+		DetectCapability: func(capability Capability, modelName string) bool {
+			return modelName == "fork-embed-1"
+		},
+	})
+
+	// Registered providers are found by the capability they declare
+	if embedder := DetectEmbedder("fork-embed-1", ""); embedder == nil || embedder.Name() != "fork" {
+		t.Errorf("Expected the registered embedding provider, got %v", embedder)
+	}
+	if embedder := DetectEmbedder("fork-embed-1", "fork-embeddings"); embedder == nil {
+		t.Error("Expected the named embedding provider")
+	}
+	if provider := NewCapableProvider(CapabilityTranscription, "fork-embed-1", ""); provider != nil {
+		t.Errorf("Expected no transcription provider, got %s", provider.Name())
+	}
+
+	// A named provider must declare the capability
+	if embedder := DetectEmbedder("claude-sonnet-4-5", "anthropic"); embedder != nil {
+		t.Errorf("Expected no embedder for a provider without embeddings, got %s", embedder.Name())
+	}
+	if generator := DetectImageGenerator("large-v3", "whisper"); generator != nil {
+		t.Errorf("Expected no image generator for whisper, got %s", generator.Name())
+	}
+
+	// Local transcription and image servers never claim text models
+	for _, name := range []string{"whisper", "stable-diffusion"} {
+		factory, ok := LookupProvider(name)
+		if !ok || !factory.Local || factory.Detects("llama3") {
+			t.Errorf("Expected %s to be a registered local provider that detects no text models", name)
+		}
+	}
+}
+
+func TestProviderLookupErrors(t *testing.T) {
+	if _, err := NewProviderByName("nope"); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+	if _, err := DiscoverModels("nope", ""); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+	if _, err := DiscoverModels("openai", ""); !errors.Is(err, ErrAPIKeyRequired) {
+		t.Errorf("Expected ErrAPIKeyRequired, got %v", err)
+	}
+}
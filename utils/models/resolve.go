@@ -0,0 +1,285 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// ErrUnknownModel is returned when no provider serves a model name
+var ErrUnknownModel = errors.New("unknown model")
+
+// ModelRef identifies a model together with the provider that serves it
+type ModelRef struct {
+	// Provider is the provider name: a registered provider, an
+	// openai-compatible endpoint or a named Ollama host
+	Provider string
+	// Model is the model name as the provider's API expects it
+	Model string
+}
+
+// String returns the provider-qualified model name
+func (r ModelRef) String() string {
+	return r.Provider + "/" + r.Model
+}
+
+// detection is a cached result of resolving a model name
+type detection struct {
+	ref         ModelRef
+	newProvider func() Provider
+	err         error
+}
+
+// Routing holds the provider settings that model names are resolved with:
+// openai-compatible endpoints, the Ollama and vLLM endpoints, named Ollama
+// hosts, aliases and the models enabled per provider. Each routing keeps its
+// own detection cache, so that local servers are queried at most once per model
+// name. Routings are not changed once created.
+type Routing struct {
+	compatible []OpenAICompatibleConfig
+	builtins   map[string]EndpointConfig
+	hosts      []EndpointConfig
+	// aliases maps user-defined names such as "fast" to model names
+	aliases map[string]string
+	// enabled maps the models enabled in the configuration to the providers
+	// they are listed under
+	enabled map[string][]string
+
+	mu    sync.Mutex
+	cache map[string]detection
+}
+
+var (
+	routingMu sync.RWMutex
+	// loadedRouting is the routing of the loaded configuration
+	loadedRouting = NewRouting(nil)
+)
+
+// NewRouting creates the routing for the provider settings of an environment
+// configuration. Use it for runs whose settings differ from the loaded
+// configuration, such as workflows with a config: block.
+func NewRouting(envConfig *config.EnvConfig) *Routing {
+	r := &Routing{
+		builtins: make(map[string]EndpointConfig),
+		aliases:  make(map[string]string),
+		enabled:  make(map[string][]string),
+		cache:    make(map[string]detection),
+	}
+	if envConfig == nil {
+		return r
+	}
+	for alias, target := range envConfig.Aliases {
+		r.aliases[alias] = strings.TrimSpace(target)
+	}
+	for name, provider := range envConfig.Providers {
+		if provider == nil {
+			continue
+		}
+		if provider.IsOpenAICompatible() {
+			r.compatible = append(r.compatible, OpenAICompatibleConfigFrom(name, provider))
+		}
+		switch {
+		case name == "ollama" || name == "vllm":
+			r.builtins[name] = EndpointConfigFrom(name, provider)
+		case provider.Kind(name) == "ollama":
+			r.hosts = append(r.hosts, EndpointConfigFrom(name, provider))
+		}
+		for _, model := range provider.Models {
+			r.enabled[model.Name] = append(r.enabled[model.Name], name)
+		}
+	}
+	for _, providers := range r.enabled {
+		sort.Strings(providers)
+	}
+	// Map iteration order is random; keep the endpoints in a stable order
+	sort.Slice(r.compatible, func(i, j int) bool { return r.compatible[i].Name < r.compatible[j].Name })
+	sort.Slice(r.hosts, func(i, j int) bool { return r.hosts[i].Name < r.hosts[j].Name })
+	return r
+}
+
+// currentRouting returns the routing of the loaded configuration
+func currentRouting() *Routing {
+	routingMu.RLock()
+	defer routingMu.RUnlock()
+	return loadedRouting
+}
+
+// ResetDetectionCache forgets the detection results of the current run
+func ResetDetectionCache() {
+	r := currentRouting()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = make(map[string]detection)
+}
+
+// expandAlias follows user-defined aliases until it reaches a model name
+func (r *Routing) expandAlias(name string) (string, error) {
+	seen := map[string]bool{}
+	for {
+		target, ok := r.aliases[name]
+		if !ok {
+			return name, nil
+		}
+		if seen[name] {
+			return "", fmt.Errorf("model alias %q refers to itself", name)
+		}
+		seen[name] = true
+		name = target
+	}
+}
+
+// providerConstructor returns a constructor for the provider with the given
+// name: an openai-compatible endpoint, a named Ollama host or a registered provider
+func (r *Routing) providerConstructor(name string) (func() Provider, bool) {
+	if cfg, ok := r.lookupOpenAICompatible(name); ok {
+		return func() Provider { return NewOpenAICompatibleProvider(cfg) }, true
+	}
+	if host, ok := r.lookupOllamaHost(name); ok {
+		return func() Provider { return NewOllamaHostProvider(host) }, true
+	}
+	if factory, ok := LookupProvider(name); ok {
+		return factory.New, true
+	}
+	return nil, false
+}
+
+// SplitModelName expands aliases and separates a provider prefix, as in
+// "anthropic/claude-sonnet-4-5", from the model name. The provider is empty when
+// the name is not qualified with a known provider, so model names that contain a
+// slash themselves, such as "meta-llama/Llama-3.1-8B", are left intact.
+func SplitModelName(name string) (provider string, model string, err error) {
+	return currentRouting().SplitModelName(name)
+}
+
+// SplitModelName is SplitModelName with this routing
+func (r *Routing) SplitModelName(name string) (provider string, model string, err error) {
+	name, err = r.expandAlias(name)
+	if err != nil {
+		return "", "", err
+	}
+	if i := strings.Index(name, "/"); i > 0 && i < len(name)-1 {
+		if _, ok := r.providerConstructor(name[:i]); ok {
+			return name[:i], name[i+1:], nil
+		}
+	}
+	return "", name, nil
+}
+
+// ResolveModel determines the provider that serves a model name. Names may be
+// aliases or qualified with their provider; other names are detected from the
+// configured endpoints, the registered providers and the models enabled in the
+// configuration. Results are cached for the rest of the run.
+func ResolveModel(name string) (ModelRef, error) {
+	return currentRouting().ResolveModel(name)
+}
+
+// ResolveModel is ResolveModel with this routing
+func (r *Routing) ResolveModel(name string) (ModelRef, error) {
+	d := r.detect(name)
+	return d.ref, d.err
+}
+
+// BareModelName returns the model name to send to the provider's API, without
+// alias or provider prefix. Names that cannot be resolved are returned unchanged.
+func BareModelName(name string) string {
+	return currentRouting().BareModelName(name)
+}
+
+// BareModelName is BareModelName with this routing
+func (r *Routing) BareModelName(name string) string {
+	ref, err := r.ResolveModel(name)
+	if err != nil {
+		return name
+	}
+	return ref.Model
+}
+
+// detect returns the cached detection result for a model name
+func (r *Routing) detect(name string) detection {
+	r.mu.Lock()
+	d, ok := r.cache[name]
+	r.mu.Unlock()
+	if ok {
+		return d
+	}
+
+	d = r.detectUncached(name)
+
+	r.mu.Lock()
+	r.cache[name] = d
+	r.mu.Unlock()
+	return d
+}
+
+// DetectProvider returns the provider for a model name, or nil when the model
+// cannot be resolved; use ResolveModel for the reason
+func (r *Routing) DetectProvider(modelName string) Provider {
+	d := r.detect(modelName)
+	if d.err != nil {
+		config.DebugLog("[Provider] %v", d.err)
+		return nil
+	}
+	return d.newProvider()
+}
+
+// detectUncached resolves a model name without consulting the cache
+func (r *Routing) detectUncached(name string) detection {
+	config.DebugLog("[Provider] Attempting to detect provider for model: %s", name)
+
+	expanded, err := r.expandAlias(name)
+	if err != nil {
+		return detection{err: err}
+	}
+	found := func(provider string, model string, newProvider func() Provider) detection {
+		config.DebugLog("[Provider] Found provider %s for model %s", provider, name)
+		return detection{ref: ModelRef{Provider: provider, Model: model}, newProvider: newProvider}
+	}
+
+	// Explicitly configured openai-compatible endpoints take precedence, so
+	// that names such as "openai/gpt-4o" listed under a router stay intact
+	if compatible := r.findOpenAICompatibleProvider(expanded); compatible != nil {
+		newProvider, _ := r.providerConstructor(compatible.Name())
+		return found(compatible.Name(), expanded, newProvider)
+	}
+
+	// Models listed under a named Ollama host are routed to that host
+	if host, ok := r.findOllamaHost(expanded); ok {
+		return found(host.Name, expanded, func() Provider { return NewOllamaHostProvider(host) })
+	}
+
+	// Provider-qualified names need no detection
+	if providerName, model, _ := r.SplitModelName(expanded); providerName != "" {
+		newProvider, _ := r.providerConstructor(providerName)
+		return found(providerName, model, newProvider)
+	}
+
+	// Then try the registered providers in priority order. Local providers
+	// come first so that models served locally win over hosted ones.
+	for _, factory := range RegisteredProviders() {
+		if factory.Detects(expanded) {
+			return found(factory.Name, expanded, factory.New)
+		}
+	}
+
+	// Finally use the provider the model is enabled for in the configuration
+	providers := r.enabled[expanded]
+	switch len(providers) {
+	case 0:
+	case 1:
+		kind := providers[0]
+		if newProvider, ok := r.providerConstructor(kind); ok {
+			return found(kind, expanded, newProvider)
+		}
+	default:
+		return detection{err: fmt.Errorf("model %q is enabled for several providers (%s); qualify it as provider/model, e.g. %s/%s",
+			expanded, strings.Join(providers, ", "), providers[0], expanded)}
+	}
+
+	config.DebugLog("[Provider] No provider found for model %s", name)
+	return detection{err: fmt.Errorf("%w %q: no configured provider serves it. Qualify it with its provider (e.g. ollama/%s or vllm/%s), "+
+		"define an alias, or add it with 'comanda configure'", ErrUnknownModel, expanded, expanded, expanded)}
+}
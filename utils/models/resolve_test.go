@@ -0,0 +1,176 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// newEmptyLocalServer stands in for local Ollama and vLLM servers that serve no
+// models and counts the requests they receive
+func newEmptyLocalServer(t *testing.T, requests *int32) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		switch r.URL.Path {
+		case "/api/tags":
+			w.Write([]byte(`{"models":[]}`))
+		case "/v1/models":
+			w.Write([]byte(`{"data":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("OLLAMA_HOST", server.URL)
+	t.Setenv("VLLM_ENDPOINT", server.URL)
+}
+
+func TestResolveQualifiedModelNames(t *testing.T) {
+	var requests int32
+	newEmptyLocalServer(t, &requests)
+	LoadProviderConfig(nil)
+	defer LoadProviderConfig(nil)
+
+	tests := []struct {
+		name     string
+		provider string
+		model    string
+	}{
+		{"anthropic/claude-sonnet-4-5", "anthropic", "claude-sonnet-4-5"},
+		{"vllm/llama3", "vllm", "llama3"},
+		{"ollama/qwen2.5:72b", "ollama", "qwen2.5:72b"},
+	}
+	for _, tt := range tests {
+		ref, err := ResolveModel(tt.name)
+		if err != nil {
+			t.Errorf("ResolveModel(%q) failed: %v", tt.name, err)
+			continue
+		}
+		if ref.Provider != tt.provider || ref.Model != tt.model {
+			t.Errorf("ResolveModel(%q) = %s, want %s/%s", tt.name, ref, tt.provider, tt.model)
+		}
+		if provider := DetectProvider(tt.name); provider == nil || provider.Name() != tt.provider {
+			t.Errorf("DetectProvider(%q) = %v, want %s", tt.name, provider, tt.provider)
+		}
+	}
+
+	// Qualified names must not query the local servers
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Errorf("Qualified names caused %d local server requests", requests)
+	}
+	if ref, err := ResolveModel("claude-3-5-sonnet-latest"); err != nil || ref.Provider != "anthropic" {
+		t.Errorf("ResolveModel(claude-3-5-sonnet-latest) = %s, %v", ref, err)
+	}
+
+	// Slashes that are not a provider prefix are part of the model name
+	provider, model, err := SplitModelName("meta-llama/Llama-3.1-8B")
+	if err != nil || provider != "" || model != "meta-llama/Llama-3.1-8B" {
+		t.Errorf("SplitModelName = %q, %q, %v", provider, model, err)
+	}
+}
+
+func TestResolveAliases(t *testing.T) {
+	LoadProviderConfig(&config.EnvConfig{Aliases: map[string]string{
+		"fast":  "anthropic/claude-haiku-4-5",
+		"smart": "fast",
+		"loop":  "loop2",
+		"loop2": "loop",
+	}})
+	defer LoadProviderConfig(nil)
+
+	ref, err := ResolveModel("smart")
+	if err != nil || ref.Provider != "anthropic" || ref.Model != "claude-haiku-4-5" {
+		t.Errorf("ResolveModel(smart) = %s, %v", ref, err)
+	}
+	if got := BareModelName("fast"); got != "claude-haiku-4-5" {
+		t.Errorf("BareModelName(fast) = %q", got)
+	}
+	if _, err := ResolveModel("loop"); err == nil || !strings.Contains(err.Error(), "alias") {
+		t.Errorf("Expected an alias cycle error, got %v", err)
+	}
+}
+
+func TestRoutingLeavesLoadedConfigAlone(t *testing.T) {
+	LoadProviderConfig(&config.EnvConfig{Aliases: map[string]string{"fast": "anthropic/claude-haiku-4-5"}})
+	defer LoadProviderConfig(nil)
+
+	routing := NewRouting(&config.EnvConfig{Aliases: map[string]string{"fast": "openai/gpt-4o-mini"}})
+	if ref, err := routing.ResolveModel("fast"); err != nil || ref.String() != "openai/gpt-4o-mini" {
+		t.Errorf("routing.ResolveModel(fast) = %s, %v", ref, err)
+	}
+	if provider := routing.DetectProvider("fast"); provider == nil || provider.Name() != "openai" {
+		t.Errorf("Expected openai from the routing, got %v", provider)
+	}
+	if ref, err := ResolveModel("fast"); err != nil || ref.String() != "anthropic/claude-haiku-4-5" {
+		t.Errorf("Expected the loaded alias to be unchanged, got %s, %v", ref, err)
+	}
+}
+
+func TestResolveUnknownModel(t *testing.T) {
+	var requests int32
+	newEmptyLocalServer(t, &requests)
+	LoadProviderConfig(nil)
+	defer LoadProviderConfig(nil)
+
+	_, err := ResolveModel("no-such-model")
+	if !errors.Is(err, ErrUnknownModel) || !strings.Contains(err.Error(), "no-such-model") {
+		t.Fatalf("Expected ErrUnknownModel, got %v", err)
+	}
+	if provider := DetectProvider("no-such-model"); provider != nil {
+		t.Errorf("Expected no provider for an unknown model, got %s", provider.Name())
+	}
+
+	// The result is cached for the rest of the run
+	afterFirst := atomic.LoadInt32(&requests)
+	if afterFirst == 0 {
+		t.Fatal("Expected the local servers to be queried")
+	}
+	ResolveModel("no-such-model")
+	if got := atomic.LoadInt32(&requests); got != afterFirst {
+		t.Errorf("Cached detection queried the local servers again (%d -> %d requests)", afterFirst, got)
+	}
+
+	ResetDetectionCache()
+	ResolveModel("no-such-model")
+	if got := atomic.LoadInt32(&requests); got == afterFirst {
+		t.Error("Expected a new detection after resetting the cache")
+	}
+}
+
+func TestResolveModelsEnabledInConfig(t *testing.T) {
+	var requests int32
+	newEmptyLocalServer(t, &requests)
+	LoadProviderConfig(&config.EnvConfig{Providers: map[string]*config.Provider{
+		"vllm":   {APIKey: "LOCAL", Models: []config.Model{{Name: "served-later"}, {Name: "shared"}}},
+		"ollama": {APIKey: "LOCAL", Models: []config.Model{{Name: "shared"}}},
+		"openrouter": {
+			Type:    "openai-compatible",
+			BaseURL: "https://openrouter.example/api/v1",
+			Models:  []config.Model{{Name: "openai/gpt-4o"}},
+		},
+	}})
+	defer LoadProviderConfig(nil)
+
+	if ref, err := ResolveModel("served-later"); err != nil || ref.Provider != "vllm" {
+		t.Errorf("ResolveModel(served-later) = %s, %v", ref, err)
+	}
+	if _, err := ResolveModel("shared"); err == nil || !strings.Contains(err.Error(), "qualify it") {
+		t.Errorf("Expected an ambiguity error, got %v", err)
+	}
+	if ref, err := ResolveModel("ollama/shared"); err != nil || ref.Provider != "ollama" {
+		t.Errorf("ResolveModel(ollama/shared) = %s, %v", ref, err)
+	}
+
+	// Models listed under an endpoint keep their slashes
+	if ref, err := ResolveModel("openai/gpt-4o"); err != nil || ref.Provider != "openrouter" || ref.Model != "openai/gpt-4o" {
+		t.Errorf("ResolveModel(openai/gpt-4o) = %s, %v", ref, err)
+	}
+	if ref, err := ResolveModel("openrouter/meta-llama/llama-3.1-70b"); err != nil || ref.Provider != "openrouter" || ref.Model != "meta-llama/llama-3.1-70b" {
+		t.Errorf("ResolveModel(openrouter/...) = %s, %v", ref, err)
+	}
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StableDiffusionProvider handles a locally-served stable-diffusion HTTP API
+// compatible with the AUTOMATIC1111/Forge txt2img endpoint. It only supports
+// image generation.
+type StableDiffusionProvider struct {
+	verbose  bool
+	endpoint string
+	mu       sync.Mutex
+}
+
+// NewStableDiffusionProvider creates a new local stable-diffusion provider instance
+func NewStableDiffusionProvider() *StableDiffusionProvider {
+	endpoint := os.Getenv("STABLE_DIFFUSION_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://localhost:7860"
+	}
+	return &StableDiffusionProvider{
+		endpoint: strings.TrimRight(endpoint, "/"),
+	}
+}
+
+func init() {
+	Register(ProviderFactory{
+		Name:        "stable-diffusion",
+		DisplayName: "Stable Diffusion",
+		New:         func() Provider { return NewStableDiffusionProvider() },
+		Priority:    90,
+		// Only used for image generation when named; it never claims text models
+		Detect:       func(string) bool { return false },
+		Local:        true,
+		Capabilities: []Capability{CapabilityImageGeneration},
+	})
+}
+
+// Name returns the provider name
+func (s *StableDiffusionProvider) Name() string {
+	return "stable-diffusion"
+}
+
+// debugf prints debug information if verbose mode is enabled (thread-safe)
+func (s *StableDiffusionProvider) debugf(format string, args ...interface{}) {
+	if s.verbose {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		log.Printf("[DEBUG][StableDiffusion] "+format+"\n", args...)
+	}
+}
+
+// SupportsModel accepts any model name; the local server decides which checkpoint it uses
+func (s *StableDiffusionProvider) SupportsModel(modelName string) bool {
+	return true
+}
+
+// Configure sets up the provider. Like the other local providers, it expects "LOCAL".
+func (s *StableDiffusionProvider) Configure(apiKey string) error {
+	s.debugf("Configuring stable-diffusion provider")
+	if apiKey != "LOCAL" {
+		return fmt.Errorf("invalid API key for stable-diffusion: must be 'LOCAL' to indicate local service")
+	}
+	return nil
+}
+
+// SendPrompt is not supported; the stable-diffusion provider only generates images
+func (s *StableDiffusionProvider) SendPrompt(modelName string, prompt string) (string, error) {
+	return "", fmt.Errorf("stable-diffusion provider only supports image generation")
+}
+
+// SendPromptWithFile is not supported; the stable-diffusion provider only generates images
+func (s *StableDiffusionProvider) SendPromptWithFile(modelName string, prompt string, file FileInput) (string, error) {
+	return "", fmt.Errorf("stable-diffusion provider only supports image generation")
+}
+
+// stableDiffusionRequest is the txt2img request body
+type stableDiffusionRequest struct {
+	Prompt           string                 `json:"prompt"`
+	Width            int                    `json:"width,omitempty"`
+	Height           int                    `json:"height,omitempty"`
+	BatchSize        int                    `json:"batch_size,omitempty"`
+	Steps            int                    `json:"steps,omitempty"`
+	OverrideSettings map[string]interface{} `json:"override_settings,omitempty"`
+}
+
+// stableDiffusionResponse is the txt2img response body
+type stableDiffusionResponse struct {
+	Images []string `json:"images"`
+}
+
+// GenerateImage creates images from a prompt using the local txt2img endpoint.
+// The model name selects the checkpoint unless it is "default".
+func (s *StableDiffusionProvider) GenerateImage(modelName string, prompt string, opts ImageOptions) ([]GeneratedImage, error) {
+	s.debugf("Preparing to generate image with model %s at %s", modelName, s.endpoint)
+
+	reqBody := stableDiffusionRequest{
+		Prompt:    prompt,
+		BatchSize: opts.Count,
+	}
+	if opts.Size != "" {
+		width, height, err := parseImageSize(opts.Size)
+		if err != nil {
+			return nil, err
+		}
+		reqBody.Width = width
+		reqBody.Height = height
+	}
+	// Map the generic quality levels onto sampling steps
+	switch strings.ToLower(opts.Quality) {
+	case "low", "draft":
+		reqBody.Steps = 15
+	case "high", "hd":
+		reqBody.Steps = 50
+	}
+	if modelName != "" && modelName != "default" {
+		reqBody.OverrideSettings = map[string]interface{}{"sd_model_checkpoint": modelName}
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %v", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Post(s.endpoint+"/sdapi/v1/txt2img", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error calling stable-diffusion API: %v (is the server running at %s?)", err, s.endpoint)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("stable-diffusion API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var parsed stableDiffusionResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(parsed.Images) == 0 {
+		return nil, fmt.Errorf("no images returned from stable-diffusion")
+	}
+
+	var images []GeneratedImage
+	for _, encoded := range parsed.Images {
+		image, err := decodeBase64Image(encoded, "")
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	s.debugf("Generated %d image(s)", len(images))
+	return images, nil
+}
+
+// SetVerbose enables or disables verbose mode
+func (s *StableDiffusionProvider) SetVerbose(verbose bool) {
+	s.verbose = verbose
+}
@@ -0,0 +1,266 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/retry"
+)
+
+// TranscriptionOptions controls how an audio or video file is transcribed
+type TranscriptionOptions struct {
+	Language string // Optional ISO-639-1 language hint (e.g. "en")
+	Prompt   string // Optional vocabulary/context hint for the backend
+	Segments bool   // Request timed segments (needed for timestamps, speakers and duration chunking)
+	Speakers bool   // Request speaker labels where the backend supports diarization
+}
+
+// TranscriptSegment is a timed slice of a transcript
+type TranscriptSegment struct {
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+	Speaker string  `json:"speaker,omitempty"`
+	Text    string  `json:"text"`
+}
+
+// Transcript holds the result of transcribing an audio or video file
+type Transcript struct {
+	Text     string
+	Language string
+	Duration float64
+	Segments []TranscriptSegment
+}
+
+// TranscriptionProvider extends Provider with speech-to-text capabilities
+type TranscriptionProvider interface {
+	Provider
+	Transcribe(modelName string, file FileInput, opts TranscriptionOptions) (*Transcript, error)
+}
+
+// DetectTranscriberFunc is the type for the transcription provider detection function
+type DetectTranscriberFunc func(modelName string, providerName string) TranscriptionProvider
+
+// DetectTranscriber determines the transcription backend for a model. An explicit
+// provider name ("openai", "google" or "whisper") takes precedence over the model name.
+var DetectTranscriber DetectTranscriberFunc = defaultDetectTranscriber
+
+// defaultDetectTranscriber is the default implementation of DetectTranscriber
+func defaultDetectTranscriber(modelName string, providerName string) TranscriptionProvider {
+	config.DebugLog("[Transcription] Detecting backend for model=%s provider=%s", modelName, providerName)
+	transcriber, _ := NewCapableProvider(CapabilityTranscription, modelName, providerName).(TranscriptionProvider)
+	return transcriber
+}
+
+// Format renders the transcript as plain text, optionally prefixing each
+// segment with its start time and speaker label
+func (t *Transcript) Format(timestamps bool, speakers bool) string {
+	if len(t.Segments) == 0 || (!timestamps && !speakers) {
+		return strings.TrimSpace(t.Text)
+	}
+
+	var sb strings.Builder
+	for _, segment := range t.Segments {
+		if timestamps {
+			sb.WriteString(fmt.Sprintf("[%s] ", formatTimestamp(segment.Start)))
+		}
+		if speakers && segment.Speaker != "" {
+			sb.WriteString(segment.Speaker)
+			sb.WriteString(": ")
+		}
+		sb.WriteString(strings.TrimSpace(segment.Text))
+		sb.WriteString("\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// SplitByDuration groups the transcript segments into consecutive windows of
+// the given length in seconds. A transcript without segments is returned as a
+// single chunk.
+func (t *Transcript) SplitByDuration(seconds float64) []*Transcript {
+	if seconds <= 0 || len(t.Segments) == 0 {
+		return []*Transcript{t}
+	}
+
+	var chunks []*Transcript
+	var current *Transcript
+	windowEnd := 0.0
+
+	for _, segment := range t.Segments {
+		if current == nil || segment.Start >= windowEnd {
+			current = &Transcript{Language: t.Language}
+			chunks = append(chunks, current)
+			windowStart := float64(int(segment.Start/seconds)) * seconds
+			windowEnd = windowStart + seconds
+		}
+		current.Segments = append(current.Segments, segment)
+		current.Duration = segment.End - current.Segments[0].Start
+	}
+
+	for _, chunk := range chunks {
+		texts := make([]string, len(chunk.Segments))
+		for i, segment := range chunk.Segments {
+			texts[i] = strings.TrimSpace(segment.Text)
+		}
+		chunk.Text = strings.Join(texts, " ")
+	}
+
+	return chunks
+}
+
+// formatTimestamp formats seconds as mm:ss, or hh:mm:ss for long recordings
+func formatTimestamp(seconds float64) string {
+	total := int(seconds)
+	hours := total / 3600
+	minutes := (total % 3600) / 60
+	secs := total % 60
+	if hours > 0 {
+		return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, secs)
+	}
+	return fmt.Sprintf("%02d:%02d", minutes, secs)
+}
+
+// openAITranscriptionResponse covers the json, verbose_json and diarized_json
+// response formats of the OpenAI audio API and compatible local servers
+type openAITranscriptionResponse struct {
+	Text     string              `json:"text"`
+	Language string              `json:"language"`
+	Duration float64             `json:"duration"`
+	Segments []TranscriptSegment `json:"segments"`
+}
+
+// transcribeOpenAICompatible posts a file to an OpenAI-compatible
+// /audio/transcriptions endpoint. baseURL must include the API version prefix
+// (e.g. https://api.openai.com/v1). apiKey may be empty for local servers.
+func transcribeOpenAICompatible(baseURL, apiKey, modelName string, file FileInput, opts TranscriptionOptions) (*Transcript, error) {
+	responseFormat := "json"
+	if opts.Segments || opts.Speakers {
+		responseFormat = "verbose_json"
+	}
+	// The gpt-4o transcription models only return plain json, without the
+	// segments that were asked for; diarization models use their own format.
+	// Only diarization models label speakers.
+	modelNameLower := strings.ToLower(modelName)
+	if strings.Contains(modelNameLower, "diarize") {
+		responseFormat = "diarized_json"
+	} else if strings.Contains(modelNameLower, "-transcribe") {
+		if opts.Segments || opts.Speakers {
+			return nil, fmt.Errorf("model %s returns no timed segments, which timestamps, speakers and chunking by duration need; use whisper-1 or a diarize model", modelName)
+		}
+		responseFormat = "json"
+	} else if opts.Speakers {
+		return nil, fmt.Errorf("model %s returns no speaker labels; use a diarize model such as gpt-4o-transcribe-diarize", modelName)
+	}
+
+	result, err := retry.WithRetry(
+		func() (interface{}, error) {
+			body, contentType, err := buildTranscriptionForm(modelName, file, opts, responseFormat)
+			if err != nil {
+				return nil, err
+			}
+
+			req, err := http.NewRequest(http.MethodPost, strings.TrimRight(baseURL, "/")+"/audio/transcriptions", body)
+			if err != nil {
+				return nil, fmt.Errorf("error creating transcription request: %v", err)
+			}
+			req.Header.Set("Content-Type", contentType)
+			if apiKey != "" {
+				req.Header.Set("Authorization", "Bearer "+apiKey)
+			}
+
+			client := &http.Client{Timeout: 10 * time.Minute}
+			resp, err := client.Do(req)
+			if err != nil {
+				return nil, fmt.Errorf("error calling transcription API: %v", err)
+			}
+			defer resp.Body.Close()
+
+			respBody, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return nil, fmt.Errorf("error reading transcription response: %v", err)
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				if resp.StatusCode == http.StatusTooManyRequests {
+					return nil, fmt.Errorf("API request failed with status 429: %s", string(respBody))
+				}
+				return nil, fmt.Errorf("transcription API error (status %d): %s", resp.StatusCode, string(respBody))
+			}
+
+			var parsed openAITranscriptionResponse
+			if err := json.Unmarshal(respBody, &parsed); err != nil {
+				return nil, fmt.Errorf("error parsing transcription response: %v", err)
+			}
+
+			return &Transcript{
+				Text:     parsed.Text,
+				Language: parsed.Language,
+				Duration: parsed.Duration,
+				Segments: parsed.Segments,
+			}, nil
+		},
+		retry.Is429Error,
+		retry.DefaultRetryConfig,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*Transcript), nil
+}
+
+// buildTranscriptionForm builds the multipart body for a transcription request
+func buildTranscriptionForm(modelName string, file FileInput, opts TranscriptionOptions, responseFormat string) (io.Reader, string, error) {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open media file: %v", err)
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile("file", filepath.Base(file.Path))
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating form file: %v", err)
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return nil, "", fmt.Errorf("error writing media file to request: %v", err)
+	}
+
+	fields := map[string]string{
+		"model":           modelName,
+		"response_format": responseFormat,
+	}
+	if opts.Language != "" {
+		fields["language"] = opts.Language
+	}
+	if opts.Prompt != "" {
+		fields["prompt"] = opts.Prompt
+	}
+	if responseFormat == "verbose_json" {
+		fields["timestamp_granularities[]"] = "segment"
+	}
+	if responseFormat == "diarized_json" {
+		fields["chunking_strategy"] = "auto"
+	}
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			return nil, "", fmt.Errorf("error writing form field %s: %v", key, err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("error finalizing form: %v", err)
+	}
+
+	return &body, writer.FormDataContentType(), nil
+}
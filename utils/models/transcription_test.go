@@ -0,0 +1,194 @@
+package models
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranscriptFormat(t *testing.T) {
+	transcript := &Transcript{
+		Text: "Hello there. Hi, welcome.",
+		Segments: []TranscriptSegment{
+			{Start: 0, End: 2.5, Speaker: "Speaker 1", Text: " Hello there."},
+			{Start: 65.2, End: 68, Speaker: "Speaker 2", Text: " Hi, welcome."},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		timestamps bool
+		speakers   bool
+		expected   string
+	}{
+		{"plain text", false, false, "Hello there. Hi, welcome."},
+		{"timestamps", true, false, "[00:00] Hello there.\n[01:05] Hi, welcome."},
+		{"speakers", false, true, "Speaker 1: Hello there.\nSpeaker 2: Hi, welcome."},
+		{"both", true, true, "[00:00] Speaker 1: Hello there.\n[01:05] Speaker 2: Hi, welcome."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transcript.Format(tt.timestamps, tt.speakers); got != tt.expected {
+				t.Errorf("Format(%v, %v) = %q, want %q", tt.timestamps, tt.speakers, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTranscriptSplitByDuration(t *testing.T) {
+	transcript := &Transcript{
+		Segments: []TranscriptSegment{
+			{Start: 0, End: 20, Text: "one"},
+			{Start: 20, End: 55, Text: "two"},
+			{Start: 61, End: 90, Text: "three"},
+			{Start: 190, End: 200, Text: "four"},
+		},
+	}
+
+	chunks := transcript.SplitByDuration(60)
+	if len(chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", len(chunks))
+	}
+
+	expected := []string{"one two", "three", "four"}
+	for i, chunk := range chunks {
+		if chunk.Text != expected[i] {
+			t.Errorf("Chunk %d text = %q, want %q", i, chunk.Text, expected[i])
+		}
+	}
+
+	// Without segments the transcript cannot be split
+	plain := &Transcript{Text: "no timing information"}
+	if chunks := plain.SplitByDuration(60); len(chunks) != 1 || chunks[0] != plain {
+		t.Errorf("Expected transcript without segments to be returned as a single chunk")
+	}
+}
+
+func TestTranscribeOpenAICompatible(t *testing.T) {
+	tempDir := t.TempDir()
+	audioPath := filepath.Join(tempDir, "meeting.mp3")
+	if err := os.WriteFile(audioPath, []byte("fake audio"), 0644); err != nil {
+		t.Fatalf("Failed to write audio file: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Unexpected Authorization header: %q", got)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("Failed to parse multipart form: %v", err)
+		}
+		if got := r.FormValue("model"); got != "whisper-1" {
+			t.Errorf("Expected model whisper-1, got %q", got)
+		}
+		if got := r.FormValue("response_format"); got != "verbose_json" {
+			t.Errorf("Expected verbose_json response format, got %q", got)
+		}
+		if got := r.FormValue("language"); got != "en" {
+			t.Errorf("Expected language en, got %q", got)
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("Expected uploaded file: %v", err)
+		}
+		data, _ := io.ReadAll(file)
+		if string(data) != "fake audio" {
+			t.Errorf("Unexpected file contents: %q", string(data))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"text":"Hello world","language":"english","duration":3.2,"segments":[{"start":0,"end":3.2,"text":"Hello world","speaker":"A"}]}`))
+	}))
+	defer server.Close()
+
+	transcript, err := transcribeOpenAICompatible(server.URL+"/v1", "test-key", "whisper-1",
+		FileInput{Path: audioPath, MimeType: "audio/mpeg"},
+		TranscriptionOptions{Language: "en", Segments: true})
+	if err != nil {
+		t.Fatalf("transcribeOpenAICompatible returned error: %v", err)
+	}
+
+	if transcript.Text != "Hello world" {
+		t.Errorf("Unexpected transcript text: %q", transcript.Text)
+	}
+	if len(transcript.Segments) != 1 || transcript.Segments[0].Speaker != "A" {
+		t.Errorf("Unexpected segments: %+v", transcript.Segments)
+	}
+	if !strings.Contains(transcript.Format(true, true), "[00:00] A: Hello world") {
+		t.Errorf("Unexpected formatted transcript: %q", transcript.Format(true, true))
+	}
+}
+
+func TestTranscribeOpenAICompatibleWithoutSegments(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"text":"Hello world"}`))
+	}))
+	defer server.Close()
+
+	audioPath := filepath.Join(t.TempDir(), "meeting.mp3")
+	if err := os.WriteFile(audioPath, []byte("fake audio"), 0644); err != nil {
+		t.Fatalf("Failed to write audio file: %v", err)
+	}
+	file := FileInput{Path: audioPath, MimeType: "audio/mpeg"}
+
+	// gpt-4o transcription models cannot return the segments that were asked for
+	_, err := transcribeOpenAICompatible(server.URL+"/v1", "test-key", "gpt-4o-transcribe", file, TranscriptionOptions{Segments: true})
+	if err == nil || !strings.Contains(err.Error(), "no timed segments") {
+		t.Errorf("Expected an error for segments from gpt-4o-transcribe, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request to be sent, got %d", requests)
+	}
+
+	// whisper-1 returns segments, but no speaker labels
+	_, err = transcribeOpenAICompatible(server.URL+"/v1", "test-key", "whisper-1", file, TranscriptionOptions{Segments: true, Speakers: true})
+	if err == nil || !strings.Contains(err.Error(), "no speaker labels") {
+		t.Errorf("Expected an error for speakers from whisper-1, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request to be sent, got %d", requests)
+	}
+
+	transcript, err := transcribeOpenAICompatible(server.URL+"/v1", "test-key", "gpt-4o-transcribe", file, TranscriptionOptions{})
+	if err != nil || transcript.Text != "Hello world" {
+		t.Errorf("Expected a plain transcript, got %+v, %v", transcript, err)
+	}
+}
+
+func TestDetectTranscriber(t *testing.T) {
+	tests := []struct {
+		model    string
+		provider string
+		expected string
+	}{
+		{"whisper-1", "", "openai"},
+		{"gpt-4o-transcribe", "", "openai"},
+		{"gemini-2.5-flash", "", "google"},
+		{"large-v3", "whisper", "whisper"},
+		{"whisper-1", "google", "google"},
+		{"claude-sonnet-4-5", "", ""},
+		{"whisper-1", "unknown", ""},
+	}
+
+	for _, tt := range tests {
+		provider := defaultDetectTranscriber(tt.model, tt.provider)
+		got := ""
+		if provider != nil {
+			got = provider.Name()
+		}
+		if got != tt.expected {
+			t.Errorf("defaultDetectTranscriber(%q, %q) = %q, want %q", tt.model, tt.provider, got, tt.expected)
+		}
+	}
+}
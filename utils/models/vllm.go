@@ -6,7 +6,6 @@ import (
 	"log"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 	"sync"
 	"time"
@@ -20,18 +19,49 @@ import (
 type VLLMProvider struct {
 	verbose  bool
 	endpoint string
+	host     EndpointConfig
+	config   ModelConfig
 	mu       sync.Mutex
 }
 
-// NewVLLMProvider creates a new vLLM provider instance
+// NewVLLMProvider creates a new vLLM provider instance. The server address comes
+// from the "vllm" endpoint setting, VLLM_ENDPOINT, or http://localhost:8000.
 func NewVLLMProvider() *VLLMProvider {
-	endpoint := os.Getenv("VLLM_ENDPOINT")
-	if endpoint == "" {
-		endpoint = "http://localhost:8000"
-	}
+	host := builtinEndpoint("vllm", "VLLM_ENDPOINT", defaultVLLMEndpoint)
 	return &VLLMProvider{
-		endpoint: endpoint,
+		endpoint: host.Endpoint,
+		host:     host,
+	}
+}
+
+// clientConfig returns the OpenAI client configuration for the vLLM server
+func (v *VLLMProvider) clientConfig() (openai.ClientConfig, error) {
+	httpClient, err := v.host.httpClient(0)
+	if err != nil {
+		return openai.ClientConfig{}, err
 	}
+	config := openai.DefaultConfig("")
+	config.BaseURL = v.endpoint + "/v1"
+	config.HTTPClient = httpClient
+	return config, nil
+}
+
+func init() {
+	Register(ProviderFactory{
+		Name:        "vllm",
+		DisplayName: "vLLM",
+		New:         func() Provider { return NewVLLMProvider() },
+		Priority:    20,
+		// Only claim models that the vLLM server is serving
+		Detect: func(modelName string) bool {
+			return NewVLLMProvider().SupportsModel(modelName) && isModelAvailableOnVLLM(modelName)
+		},
+		Local: true,
+		ConfigSchema: []ConfigField{{Key: "endpoint",
+			Description: "vLLM endpoint (leave empty for VLLM_ENDPOINT or " + defaultVLLMEndpoint + ")"}},
+		Discover:     func(string) ([]string, error) { return listVLLMModels() },
+		Capabilities: []Capability{CapabilityText, CapabilityEmbeddings},
+	})
 }
 
 // Name returns the provider name
@@ -76,8 +106,10 @@ func (v *VLLMProvider) SendPrompt(modelName string, prompt string) (string, erro
 	v.debugf("Prompt length: %d characters", len(prompt))
 
 	// Use the OpenAI-compatible client
-	config := openai.DefaultConfig("")
-	config.BaseURL = v.endpoint + "/v1"
+	config, err := v.clientConfig()
+	if err != nil {
+		return "", err
+	}
 	client := openai.NewClientWithConfig(config)
 
 	// Use retry mechanism for API calls
@@ -88,15 +120,7 @@ func (v *VLLMProvider) SendPrompt(modelName string, prompt string) (string, erro
 
 			resp, err := client.CreateChatCompletion(
 				ctx,
-				openai.ChatCompletionRequest{
-					Model: modelName,
-					Messages: []openai.ChatCompletionMessage{
-						{
-							Role:    openai.ChatMessageRoleUser,
-							Content: prompt,
-						},
-					},
-				},
+				v.chatRequest(modelName, prompt),
 			)
 
 			if err != nil {
@@ -167,6 +191,40 @@ func (v *VLLMProvider) ValidateModel(modelName string) bool {
 	return isValid
 }
 
+// chatRequest creates a chat completions request. The server's defaults apply
+// to every parameter a step does not set.
+func (v *VLLMProvider) chatRequest(modelName string, prompt string) openai.ChatCompletionRequest {
+	req := openai.ChatCompletionRequest{
+		Model: modelName,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
+			},
+		},
+	}
+	if v.config.Params.MaxTokens != nil {
+		req.MaxTokens = v.config.MaxTokens
+	}
+	applyChatParams(&req, v.config)
+	return req
+}
+
+// SetConfig updates the provider configuration
+func (v *VLLMProvider) SetConfig(config ModelConfig) {
+	v.config = config
+}
+
+// GetConfig returns the current provider configuration
+func (v *VLLMProvider) GetConfig() ModelConfig {
+	return v.config
+}
+
+// SupportedParams lists the generation parameters the model accepts
+func (v *VLLMProvider) SupportedParams(modelName string) []string {
+	return seededSamplingParams
+}
+
 // SetVerbose enables or disables verbose mode
 func (v *VLLMProvider) SetVerbose(verbose bool) {
 	v.verbose = verbose
@@ -179,7 +237,10 @@ func (v *VLLMProvider) getVLLMEndpoint() string {
 
 // checkVLLMServerHealth checks if the vLLM server is running and responsive
 func (v *VLLMProvider) checkVLLMServerHealth() error {
-	client := &http.Client{Timeout: 5 * time.Second}
+	client, err := v.host.httpClient(5 * time.Second)
+	if err != nil {
+		return err
+	}
 
 	// Try to fetch models to verify server is running
 	resp, err := client.Get(v.endpoint + "/v1/models")
@@ -195,3 +256,22 @@ func (v *VLLMProvider) checkVLLMServerHealth() error {
 
 	return nil
 }
+
+// Embed returns an embedding vector for each text using the server's
+// OpenAI-compatible embeddings endpoint
+func (v *VLLMProvider) Embed(modelName string, texts []string) ([][]float32, error) {
+	v.debugf("Preparing to embed %d text(s) with model: %s", len(texts), modelName)
+
+	config, err := v.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	vectors, err := embedOpenAICompatible(openai.NewClientWithConfig(config), modelName, texts)
+	if err != nil {
+		return nil, fmt.Errorf("vLLM embeddings error: %w", err)
+	}
+
+	v.debugf("Embedding completed, %d vector(s)", len(vectors))
+	return vectors, nil
+}
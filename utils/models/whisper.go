@@ -0,0 +1,97 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// WhisperProvider handles a locally-served, OpenAI-compatible speech-to-text
+// server such as faster-whisper-server/speaches or whisper.cpp's server mode.
+// It only supports transcription.
+type WhisperProvider struct {
+	verbose  bool
+	endpoint string
+	mu       sync.Mutex
+}
+
+// NewWhisperProvider creates a new local whisper provider instance
+func NewWhisperProvider() *WhisperProvider {
+	endpoint := os.Getenv("WHISPER_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://localhost:8000"
+	}
+	return &WhisperProvider{
+		endpoint: endpoint,
+	}
+}
+
+func init() {
+	Register(ProviderFactory{
+		Name:        "whisper",
+		DisplayName: "Whisper",
+		New:         func() Provider { return NewWhisperProvider() },
+		Priority:    90,
+		// Only used for transcription when named; it never claims text models
+		Detect:       func(string) bool { return false },
+		Local:        true,
+		Capabilities: []Capability{CapabilityTranscription},
+	})
+}
+
+// Name returns the provider name
+func (w *WhisperProvider) Name() string {
+	return "whisper"
+}
+
+// debugf prints debug information if verbose mode is enabled (thread-safe)
+func (w *WhisperProvider) debugf(format string, args ...interface{}) {
+	if w.verbose {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		log.Printf("[DEBUG][Whisper] "+format+"\n", args...)
+	}
+}
+
+// SupportsModel accepts any model name; the local server decides which models it serves
+func (w *WhisperProvider) SupportsModel(modelName string) bool {
+	return true
+}
+
+// Configure sets up the provider. Like the other local providers, it expects "LOCAL".
+func (w *WhisperProvider) Configure(apiKey string) error {
+	w.debugf("Configuring whisper provider")
+	if apiKey != "LOCAL" {
+		return fmt.Errorf("invalid API key for whisper: must be 'LOCAL' to indicate local service")
+	}
+	return nil
+}
+
+// SendPrompt is not supported; the whisper provider only transcribes audio
+func (w *WhisperProvider) SendPrompt(modelName string, prompt string) (string, error) {
+	return "", fmt.Errorf("whisper provider only supports transcription")
+}
+
+// SendPromptWithFile is not supported; the whisper provider only transcribes audio
+func (w *WhisperProvider) SendPromptWithFile(modelName string, prompt string, file FileInput) (string, error) {
+	return "", fmt.Errorf("whisper provider only supports transcription")
+}
+
+// Transcribe converts an audio or video file to text using the local server
+func (w *WhisperProvider) Transcribe(modelName string, file FileInput, opts TranscriptionOptions) (*Transcript, error) {
+	w.debugf("Preparing to transcribe %s with model %s at %s", file.Path, modelName, w.endpoint)
+
+	transcript, err := transcribeOpenAICompatible(w.endpoint+"/v1", "", modelName, file, opts)
+	if err != nil {
+		return nil, fmt.Errorf("whisper transcription error: %w (is the whisper server running at %s?)", err, w.endpoint)
+	}
+
+	w.debugf("Transcription completed, %d characters, %d segments", len(transcript.Text), len(transcript.Segments))
+	return transcript, nil
+}
+
+// SetVerbose enables or disables verbose mode
+func (w *WhisperProvider) SetVerbose(verbose bool) {
+	w.verbose = verbose
+}
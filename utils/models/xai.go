@@ -40,6 +40,18 @@ func NewXAIProvider() *XAIProvider {
 	}
 }
 
+func init() {
+	Register(ProviderFactory{
+		Name:         "xai",
+		DisplayName:  "X.AI",
+		New:          func() Provider { return NewXAIProvider() },
+		Priority:     50,
+		ConfigSchema: []ConfigField{apiKeyField},
+		Discover:     registryModels("xai"),
+		Capabilities: []Capability{CapabilityText, CapabilityVision},
+	})
+}
+
 // Name returns the provider name
 func (x *XAIProvider) Name() string {
 	return "xai"
@@ -139,7 +151,7 @@ func (x *XAIProvider) SendPrompt(modelName string, prompt string) (string, error
 
 			resp, err := client.CreateChatCompletion(
 				ctx,
-				openai.ChatCompletionRequest{
+				x.withParams(openai.ChatCompletionRequest{
 					Model: modelName,
 					Messages: []openai.ChatCompletionMessage{
 						{
@@ -150,14 +162,14 @@ func (x *XAIProvider) SendPrompt(modelName string, prompt string) (string, error
 					Temperature: float32(x.config.Temperature),
 					MaxTokens:   x.config.MaxTokens,
 					TopP:        float32(x.config.TopP),
-				},
+				}),
 			)
 
 			if err != nil {
 				if ctx.Err() == context.DeadlineExceeded {
 					return "", fmt.Errorf("request timed out after %v", defaultTimeout)
 				}
-				return "", fmt.Errorf("X.AI API error: %v", err)
+				return "", fmt.Errorf("X.AI API error: %w", err)
 			}
 
 			if len(resp.Choices) == 0 {
@@ -229,7 +241,7 @@ func (x *XAIProvider) SendPromptWithFile(modelName string, prompt string, file F
 
 				resp, err := client.CreateChatCompletion(
 					ctx,
-					openai.ChatCompletionRequest{
+					x.withParams(openai.ChatCompletionRequest{
 						Model: modelName,
 						Messages: []openai.ChatCompletionMessage{
 							{
@@ -238,14 +250,14 @@ func (x *XAIProvider) SendPromptWithFile(modelName string, prompt string, file F
 							},
 						},
 						MaxTokens: x.config.MaxTokens,
-					},
+					}),
 				)
 
 				if err != nil {
 					if ctx.Err() == context.DeadlineExceeded {
 						return "", fmt.Errorf("request timed out after %v", defaultTimeout)
 					}
-					return "", fmt.Errorf("X.AI API error: %v", err)
+					return "", fmt.Errorf("X.AI API error: %w", err)
 				}
 
 				if len(resp.Choices) == 0 {
@@ -287,7 +299,7 @@ func (x *XAIProvider) SendPromptWithFile(modelName string, prompt string, file F
 
 			resp, err := client.CreateChatCompletion(
 				ctx,
-				openai.ChatCompletionRequest{
+				x.withParams(openai.ChatCompletionRequest{
 					Model: modelName,
 					Messages: []openai.ChatCompletionMessage{
 						{
@@ -298,14 +310,14 @@ func (x *XAIProvider) SendPromptWithFile(modelName string, prompt string, file F
 					Temperature: float32(x.config.Temperature),
 					MaxTokens:   x.config.MaxTokens,
 					TopP:        float32(x.config.TopP),
-				},
+				}),
 			)
 
 			if err != nil {
 				if ctx.Err() == context.DeadlineExceeded {
 					return "", fmt.Errorf("request timed out after %v", defaultTimeout)
 				}
-				return "", fmt.Errorf("X.AI API error: %v", err)
+				return "", fmt.Errorf("X.AI API error: %w", err)
 			}
 
 			if len(resp.Choices) == 0 {
@@ -349,6 +361,23 @@ func (x *XAIProvider) ValidateModel(modelName string) bool {
 	return isValid
 }
 
+// withParams adds the parameters set for the request to a chat completions request
+func (x *XAIProvider) withParams(req openai.ChatCompletionRequest) openai.ChatCompletionRequest {
+	if x.config.Params.MaxTokens != nil {
+		req.MaxTokens = x.config.MaxTokens
+	}
+	applyChatParams(&req, x.config)
+	return req
+}
+
+// SupportedParams lists the generation parameters the model accepts
+func (x *XAIProvider) SupportedParams(modelName string) []string {
+	if strings.Contains(strings.ToLower(modelName), "grok-3-mini") {
+		return tunableReasoningParams
+	}
+	return seededSamplingParams
+}
+
 // SetConfig updates the provider configuration
 func (x *XAIProvider) SetConfig(config ModelConfig) {
 	x.debugf("Updating provider configuration")
@@ -3,6 +3,7 @@ package processor
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/kris-hansen/comanda/utils/fileutil"
 	"github.com/kris-hansen/comanda/utils/input"
@@ -27,11 +28,14 @@ type ActionResult struct {
 
 	// Whether this contains individual results
 	HasIndividualResults bool
+
+	// Time spent waiting for client-side rate limits
+	RateLimitWait time.Duration
 }
 
-// processActions handles the action section of the DSL
+// processActions handles the action section of the DSL for a step
 // Returns ActionResult which may contain either combined or individual results
-func (p *Processor) processActions(modelNames []string, actions []string) (*ActionResult, error) {
+func (p *Processor) processActions(modelNames []string, actions []string, step Step) (actionResult *ActionResult, actionErr error) {
 	if len(modelNames) == 0 {
 		return nil, fmt.Errorf("no model specified for actions")
 	}
@@ -59,7 +63,7 @@ func (p *Processor) processActions(modelNames []string, actions []string) (*Acti
 	}
 
 	// Get provider by detecting it from the model name
-	provider := models.DetectProvider(modelName)
+	provider := p.detectProvider(modelName)
 	if provider == nil {
 		return nil, fmt.Errorf("provider not found for model: %s", modelName)
 	}
@@ -70,7 +74,31 @@ func (p *Processor) processActions(modelNames []string, actions []string) (*Acti
 		return nil, fmt.Errorf("provider %s not configured", provider.Name())
 	}
 
-	p.debugf("Using model %s with provider %s", modelName, configuredProvider.Name())
+	// Send the name the provider knows, without alias or provider prefix
+	apiModel := p.bareModelName(modelName)
+
+	// Generation parameters and API key rotation are applied to a provider
+	// instance of this step only
+	params := p.modelParams(provider.Name(), apiModel, stepParams(step.Config))
+	if !params.IsZero() || p.rotatesKeys(provider.Name()) {
+		var err error
+		if configuredProvider, err = p.providerWithParams(provider, apiModel, params); err != nil {
+			return nil, err
+		}
+	}
+	configuredProvider = stepProvider(configuredProvider, step.Name)
+	p.debugf("Using model %s with provider %s", apiModel, configuredProvider.Name())
+
+	// Requests wait for the configured rate limits of the provider and model
+	limiter, err := p.newThrottle(provider.Name(), apiModel, configuredProvider)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if actionResult != nil {
+			actionResult.RateLimitWait = limiter.waited
+		}
+	}()
 	p.debugf("Processing %d action(s)", len(actions))
 
 	for i, action := range actions {
@@ -89,9 +117,11 @@ func (p *Processor) processActions(modelNames []string, actions []string) (*Acti
 		inputs := p.handler.GetInputs()
 		if len(inputs) == 0 {
 			// If there are no inputs, just send the action directly
-			result, err := configuredProvider.SendPrompt(modelName, action)
+			result, err := limiter.send(action, nil, func() (string, error) {
+				return configuredProvider.SendPrompt(apiModel, action)
+			})
 			if err != nil {
-				return nil, err
+				return nil, models.ExplainParamError(err, apiModel, params)
 			}
 			return &ActionResult{
 				CombinedResult:       result,
@@ -99,6 +129,11 @@ func (p *Processor) processActions(modelNames []string, actions []string) (*Acti
 			}, nil
 		}
 
+		// In multimodal mode and batches images are attached to the requests
+		// instead of being included in the prompt
+		multimodal := step.Config.BatchMode == "multimodal"
+		attachImages := multimodal || step.Config.Execution == ExecutionBatch
+
 		// Process inputs based on their type
 		var fileInputs []models.FileInput
 		var nonFileInputs []string
@@ -110,6 +145,16 @@ func (p *Processor) processActions(modelNames []string, actions []string) (*Acti
 					Path:     inputItem.Path,
 					MimeType: inputItem.MimeType,
 				})
+			case input.ImageInput, input.ScreenshotInput:
+				if attachImages {
+					fileInputs = append(fileInputs, models.FileInput{
+						Path:     inputItem.Path,
+						MimeType: inputItem.MimeType,
+						Data:     inputItem.Contents,
+					})
+				} else {
+					nonFileInputs = append(nonFileInputs, string(inputItem.Contents))
+				}
 			case input.WebScrapeInput:
 				// Handle scraping input
 				scraper := scraper.NewScraper()
@@ -145,12 +190,37 @@ func (p *Processor) processActions(modelNames []string, actions []string) (*Acti
 			}
 		}
 
+		// Attach all files to a single request in multimodal mode
+		if multimodal && len(fileInputs) > 0 {
+			result, err := limiter.send(action+strings.Join(nonFileInputs, "\n\n"), fileInputs, func() (string, error) {
+				return p.sendMultimodal(configuredProvider, apiModel, action, fileInputs, nonFileInputs)
+			})
+			if err != nil {
+				return nil, models.ExplainParamError(err, apiModel, params)
+			}
+			return &ActionResult{
+				CombinedResult:       result,
+				HasIndividualResults: false,
+			}, nil
+		}
+
+		// Send one request per file as an asynchronous provider batch
+		if step.Config.Execution == ExecutionBatch && len(fileInputs) > 0 {
+			result, err := p.processBatch(step, configuredProvider, apiModel, action, fileInputs)
+			if err != nil {
+				return nil, models.ExplainParamError(err, apiModel, params)
+			}
+			return result, nil
+		}
+
 		// If we have file inputs, use SendPromptWithFile
 		if len(fileInputs) > 0 {
 			if len(fileInputs) == 1 {
-				result, err := configuredProvider.SendPromptWithFile(modelName, action, fileInputs[0])
+				result, err := limiter.send(action, fileInputs, func() (string, error) {
+					return configuredProvider.SendPromptWithFile(apiModel, action, fileInputs[0])
+				})
 				if err != nil {
-					return nil, err
+					return nil, models.ExplainParamError(err, apiModel, params)
 				}
 				return &ActionResult{
 					CombinedResult:       result,
@@ -159,8 +229,8 @@ func (p *Processor) processActions(modelNames []string, actions []string) (*Acti
 			}
 
 			// Check if we should use combined or individual processing mode
-			batchMode := p.getCurrentStepConfig().BatchMode
-			skipErrors := p.getCurrentStepConfig().SkipErrors
+			batchMode := step.Config.BatchMode
+			skipErrors := step.Config.SkipErrors
 
 			p.debugf("Multiple files detected. BatchMode=%s, SkipErrors=%v", batchMode, skipErrors)
 
@@ -177,9 +247,11 @@ func (p *Processor) processActions(modelNames []string, actions []string) (*Acti
 					combinedPrompt += fmt.Sprintf("File %d (%s):\n%s\n\n", i+1, file.Path, string(content))
 				}
 				combinedPrompt += fmt.Sprintf("\nAction: %s", action)
-				result, err := configuredProvider.SendPrompt(modelName, combinedPrompt)
+				result, err := limiter.send(combinedPrompt, nil, func() (string, error) {
+					return configuredProvider.SendPrompt(apiModel, combinedPrompt)
+				})
 				if err != nil {
-					return nil, err
+					return nil, models.ExplainParamError(err, apiModel, params)
 				}
 				return &ActionResult{
 					CombinedResult:       result,
@@ -200,8 +272,10 @@ func (p *Processor) processActions(modelNames []string, actions []string) (*Acti
 				// Build a clean prompt that discourages metadata wrapping
 				// Detect output format from action to provide appropriate instructions
 				// Try to process each file individually
-				result, err := configuredProvider.SendPromptWithFile(modelName,
-					fmt.Sprintf("%sFor this file: %s", PromptPrefix, action), file)
+				prompt := filePrompt(action)
+				result, err := limiter.send(prompt, []models.FileInput{file}, func() (string, error) {
+					return configuredProvider.SendPromptWithFile(apiModel, prompt, file)
+				})
 
 				if err != nil {
 					// Log error but continue with other files if skipErrors is true
@@ -237,10 +311,12 @@ func (p *Processor) processActions(modelNames []string, actions []string) (*Acti
 
 		// If we have non-file inputs, combine them and use SendPrompt
 		if len(nonFileInputs) > 0 {
-			combinedInput := strings.Join(nonFileInputs, "\n\n")
-			result, err := configuredProvider.SendPrompt(modelName, fmt.Sprintf("Input:\n%s\n\nAction: %s", combinedInput, action))
+			prompt := textPrompt(nonFileInputs, action)
+			result, err := limiter.send(prompt, nil, func() (string, error) {
+				return configuredProvider.SendPrompt(apiModel, prompt)
+			})
 			if err != nil {
-				return nil, err
+				return nil, models.ExplainParamError(err, apiModel, params)
 			}
 			return &ActionResult{
 				CombinedResult:       result,
@@ -251,3 +327,33 @@ func (p *Processor) processActions(modelNames []string, actions []string) (*Acti
 
 	return nil, fmt.Errorf("no actions processed")
 }
+
+// filePrompt is the prompt sent with each file of a step that processes its
+// files individually
+func filePrompt(action string) string {
+	return fmt.Sprintf("%sFor this file: %s", PromptPrefix, action)
+}
+
+// textPrompt is the prompt that includes a step's text inputs, such as source
+// code or scraped pages, before the action
+func textPrompt(inputs []string, action string) string {
+	return fmt.Sprintf("Input:\n%s\n\nAction: %s", strings.Join(inputs, "\n\n"), action)
+}
+
+// sendMultimodal sends the action with all files attached to one request, for
+// steps with batch_mode: multimodal. Text inputs such as STDIN are included in
+// the prompt.
+func (p *Processor) sendMultimodal(provider models.Provider, modelName string, action string, files []models.FileInput, textInputs []string) (string, error) {
+	multiFile, ok := provider.(models.MultiFileProvider)
+	if !ok {
+		return "", fmt.Errorf("provider %s does not support batch_mode: multimodal; use combined or individual instead", provider.Name())
+	}
+
+	prompt := action
+	if len(textInputs) > 0 {
+		prompt = textPrompt(textInputs, action)
+	}
+
+	p.debugf("Using multimodal batch mode: attaching %d file(s) to one request", len(files))
+	return multiFile.SendPromptWithFiles(modelName, prompt, files)
+}
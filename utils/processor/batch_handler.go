@@ -0,0 +1,255 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/fileutil"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// Defaults for steps with execution: batch
+const (
+	defaultBatchPollInterval = 30 * time.Second
+	defaultBatchWait         = 24 * time.Hour
+	defaultBatchStateDir     = ".comanda/batches"
+)
+
+// batchState records a submitted batch so that a later run of the workflow
+// resumes it instead of submitting the requests again
+type batchState struct {
+	BatchID     string    `json:"batch_id"`
+	Provider    string    `json:"provider"`
+	Model       string    `json:"model"`
+	Fingerprint string    `json:"fingerprint"` // Identifies the requests; a change submits a new batch
+	Inputs      []string  `json:"inputs"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// unsafeStepNameChars are replaced in state file names
+var unsafeStepNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// processBatch sends one request per file as an asynchronous provider batch,
+// waits for it to finish and returns the results in input order, like
+// batch_mode: individual does for real-time requests
+func (p *Processor) processBatch(step Step, provider models.Provider, modelName string, action string, files []models.FileInput) (*ActionResult, error) {
+	batchProvider, ok := provider.(models.BatchProvider)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not support execution: batch", provider.Name())
+	}
+	pollInterval, wait, stateDir, err := batchOptions(step.Config.Batch)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]models.BatchRequest, len(files))
+	var inputs []string
+	for i, file := range files {
+		requests[i] = models.BatchRequest{
+			CustomID: fmt.Sprintf("file-%d", i),
+			Model:    modelName,
+			Prompt:   filePrompt(action),
+			Files:    []models.FileInput{file},
+		}
+		inputs = append(inputs, file.Path)
+	}
+	fingerprint, err := batchFingerprint(provider.Name(), requests)
+	if err != nil {
+		return nil, err
+	}
+
+	// In server mode the state lives under the data directory, like outputs
+	stateDir = p.resolveOutputPath(stateDir)
+	statePath := filepath.Join(stateDir, unsafeStepNameChars.ReplaceAllString(step.Name, "_")+".json")
+	state, err := loadBatchState(statePath)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil && state.Fingerprint == fingerprint {
+		p.debugf("Resuming batch %s submitted at %s", state.BatchID, state.SubmittedAt.Format(time.RFC3339))
+		p.sendProgressUpdate(ProgressUpdate{Type: ProgressStep, Message: fmt.Sprintf("Resuming %s batch %s", provider.Name(), state.BatchID)})
+	} else {
+		batchID, err := batchProvider.SubmitBatch(requests)
+		if err != nil {
+			return nil, fmt.Errorf("failed to submit batch: %w", err)
+		}
+		state = &batchState{
+			BatchID:     batchID,
+			Provider:    provider.Name(),
+			Model:       modelName,
+			Fingerprint: fingerprint,
+			Inputs:      inputs,
+			SubmittedAt: time.Now(),
+		}
+		if err := saveBatchState(statePath, state); err != nil {
+			return nil, err
+		}
+		p.sendProgressUpdate(ProgressUpdate{Type: ProgressStep, Message: fmt.Sprintf("Submitted %d requests as %s batch %s", len(requests), provider.Name(), batchID)})
+	}
+
+	status, err := p.waitForBatch(batchProvider, state.BatchID, pollInterval, wait)
+	if err != nil {
+		return nil, err
+	}
+	if status.State == models.BatchFailed {
+		os.Remove(statePath)
+		return nil, fmt.Errorf("batch %s did not complete: %s", state.BatchID, status)
+	}
+
+	batchResults, err := batchProvider.BatchResults(state.BatchID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.BatchResult, len(batchResults))
+	for _, result := range batchResults {
+		byID[result.CustomID] = result
+	}
+
+	// Map the results back to the inputs; failed requests fail the step unless
+	// skip_errors is set
+	var results []string
+	var inputPaths []string
+	var failures []string
+	for i, request := range requests {
+		result, ok := byID[request.CustomID]
+		switch {
+		case !ok:
+			failures = append(failures, fmt.Sprintf("Error processing file %s: no result in batch", files[i].Path))
+		case result.Error != "":
+			failures = append(failures, fmt.Sprintf("Error processing file %s: %s", files[i].Path, result.Error))
+		default:
+			results = append(results, result.Response)
+			inputPaths = append(inputPaths, files[i].Path)
+		}
+	}
+	for _, failure := range failures {
+		p.debugf(failure)
+	}
+
+	// The results are collected, so a later run submits a new batch
+	if err := os.Remove(statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		p.debugf("Failed to remove batch state %s: %v", statePath, err)
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("all files failed processing: %s", strings.Join(failures, "; "))
+	}
+	if len(failures) > 0 && !step.Config.SkipErrors {
+		return nil, fmt.Errorf("%d of %d batch requests failed (set skip_errors: true to keep the other results): %s",
+			len(failures), len(requests), strings.Join(failures, "; "))
+	}
+
+	return &ActionResult{
+		IndividualResults:    results,
+		InputPaths:           inputPaths,
+		HasIndividualResults: true,
+	}, nil
+}
+
+// waitForBatch polls a batch until it finishes or the wait time is used up. A
+// batch that is still running is left for a later run to resume.
+func (p *Processor) waitForBatch(provider models.BatchProvider, batchID string, pollInterval time.Duration, wait time.Duration) (models.BatchStatus, error) {
+	deadline := time.Now().Add(wait)
+	var lastState string
+	for {
+		status, err := provider.GetBatch(batchID)
+		if err != nil {
+			return status, err
+		}
+		p.debugf("Batch %s: %s", batchID, status)
+		if status.Done() {
+			return status, nil
+		}
+		if status.String() != lastState {
+			p.sendProgressUpdate(ProgressUpdate{Type: ProgressStep, Message: fmt.Sprintf("Batch %s: %s", batchID, status)})
+			lastState = status.String()
+		}
+		if time.Now().Add(pollInterval).After(deadline) {
+			return status, fmt.Errorf("batch %s is still %s after waiting %s; run the workflow again to resume it", batchID, status, wait)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// batchOptions returns the options of a batch step with their defaults applied
+func batchOptions(cfg *BatchConfig) (pollInterval time.Duration, wait time.Duration, stateDir string, err error) {
+	pollInterval, wait, stateDir = defaultBatchPollInterval, defaultBatchWait, defaultBatchStateDir
+	if cfg == nil {
+		return pollInterval, wait, stateDir, nil
+	}
+	if cfg.PollInterval != "" {
+		if pollInterval, err = time.ParseDuration(cfg.PollInterval); err != nil || pollInterval <= 0 {
+			return 0, 0, "", fmt.Errorf("invalid batch poll_interval '%s': must be a positive duration such as 30s", cfg.PollInterval)
+		}
+	}
+	if cfg.Wait != "" {
+		if wait, err = time.ParseDuration(cfg.Wait); err != nil || wait < 0 {
+			return 0, 0, "", fmt.Errorf("invalid batch wait '%s': must be a duration such as 2h", cfg.Wait)
+		}
+	}
+	if cfg.StateDir != "" {
+		stateDir = cfg.StateDir
+	}
+	return pollInterval, wait, stateDir, nil
+}
+
+// batchFingerprint identifies a set of batch requests by provider, model,
+// prompts and file contents
+func batchFingerprint(providerName string, requests []models.BatchRequest) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n", providerName)
+	for _, request := range requests {
+		fmt.Fprintf(hash, "%s\n%s\n%s\n", request.CustomID, request.Model, request.Prompt)
+		for _, file := range request.Files {
+			data := file.Data
+			if data == nil {
+				var err error
+				if data, err = fileutil.SafeReadFile(file.Path); err != nil {
+					return "", fmt.Errorf("failed to read file %s: %w", file.Path, err)
+				}
+			}
+			fmt.Fprintf(hash, "%s\n", file.Path)
+			hash.Write(data)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// loadBatchState reads a batch state file; it returns nil when there is none
+func loadBatchState(path string) (*batchState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch state %s: %w", path, err)
+	}
+	var state batchState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse batch state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// saveBatchState writes a batch state file
+func saveBatchState(path string, state *batchState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create batch state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode batch state: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write batch state %s: %w", path, err)
+	}
+	return nil
+}
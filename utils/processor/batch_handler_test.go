@@ -0,0 +1,180 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/models/batchtest"
+)
+
+// batchWorkflow returns a workflow that summarizes three files with execution: batch
+func batchWorkflow(t *testing.T, wait string) (*DSLConfig, string, string) {
+	tmpDir := t.TempDir()
+	var inputs []interface{}
+	for i := 0; i < 3; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("doc_%d.txt", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("Document %d", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, path)
+	}
+	stateDir := filepath.Join(tmpDir, "batches")
+	config := &DSLConfig{
+		Steps: []Step{
+			{
+				Name: "summarize docs",
+				Config: StepConfig{
+					Input:     inputs,
+					BatchMode: "individual",
+					Execution: ExecutionBatch,
+					Batch:     &BatchConfig{PollInterval: "1ms", Wait: wait, StateDir: stateDir},
+					Model:     "claude-3-5-sonnet-latest",
+					Action:    "Summarize this document",
+					Output:    filepath.Join(tmpDir, "summary_{{ file_index }}.txt"),
+				},
+			},
+		},
+	}
+	return config, tmpDir, stateDir
+}
+
+// useBatchServer starts a mock batch server and points the Anthropic provider at it
+func useBatchServer(t *testing.T) *batchtest.Server {
+	server := batchtest.NewServer()
+	t.Cleanup(server.Close)
+	t.Setenv("ANTHROPIC_BASE_URL", server.AnthropicBaseURL())
+	server.Respond = func(customID string, prompt string) (string, error) {
+		return "summary of " + prompt[strings.Index(prompt, "Document"):][:len("Document 0")], nil
+	}
+
+	detect := models.DetectProvider
+	t.Cleanup(func() { models.DetectProvider = detect })
+	models.DetectProvider = func(modelName string) models.Provider { return models.NewAnthropicProvider() }
+	return server
+}
+
+func TestProcessBatchExecution(t *testing.T) {
+	server := useBatchServer(t)
+	server.PollsUntilDone = 2
+	config, tmpDir, stateDir := batchWorkflow(t, "")
+
+	processor := NewProcessor(config, createTestEnvConfig(), createTestServerConfig(), false, "")
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() failed: %v", err)
+	}
+
+	if server.Batches() != 1 || len(server.Requests()) != 3 {
+		t.Fatalf("Expected one batch with 3 requests, got %d batches and %d requests", server.Batches(), len(server.Requests()))
+	}
+	for i := 0; i < 3; i++ {
+		output, err := os.ReadFile(filepath.Join(tmpDir, fmt.Sprintf("summary_%d.txt", i)))
+		if err != nil {
+			t.Fatalf("Missing output %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("summary of Document %d", i); string(output) != want {
+			t.Errorf("Output %d = %q, want %q", i, output, want)
+		}
+	}
+	if entries, _ := os.ReadDir(stateDir); len(entries) != 0 {
+		t.Errorf("The batch state should be removed after the results are collected, got %d files", len(entries))
+	}
+}
+
+func TestProcessBatchExecutionResume(t *testing.T) {
+	server := useBatchServer(t)
+	server.PollsUntilDone = 1
+	config, tmpDir, stateDir := batchWorkflow(t, "0s")
+
+	// The batch is still in progress when the wait time is used up
+	processor := NewProcessor(config, createTestEnvConfig(), createTestServerConfig(), false, "")
+	err := processor.Process()
+	if err == nil || !strings.Contains(err.Error(), "resume") {
+		t.Fatalf("Expected an error asking to resume the batch, got %v", err)
+	}
+	state, err := loadBatchState(filepath.Join(stateDir, "summarize_docs.json"))
+	if err != nil || state == nil || state.BatchID != "batch_1" {
+		t.Fatalf("Expected the batch ID to be stored, got %+v, %v", state, err)
+	}
+
+	// Running the workflow again resumes the stored batch
+	processor = NewProcessor(config, createTestEnvConfig(), createTestServerConfig(), false, "")
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() failed on resume: %v", err)
+	}
+	if server.Batches() != 1 {
+		t.Errorf("The batch should be resumed, not submitted again; got %d batches", server.Batches())
+	}
+	if output, err := os.ReadFile(filepath.Join(tmpDir, "summary_2.txt")); err != nil || string(output) != "summary of Document 2" {
+		t.Errorf("Output 2 = %q, %v", output, err)
+	}
+}
+
+func TestBatchOptions(t *testing.T) {
+	pollInterval, wait, stateDir, err := batchOptions(nil)
+	if err != nil || pollInterval != defaultBatchPollInterval || wait != defaultBatchWait || stateDir != defaultBatchStateDir {
+		t.Errorf("Unexpected defaults: %v %v %q %v", pollInterval, wait, stateDir, err)
+	}
+	if _, _, _, err := batchOptions(&BatchConfig{PollInterval: "soon"}); err == nil {
+		t.Error("Expected an error for an invalid poll_interval")
+	}
+	if _, _, _, err := batchOptions(&BatchConfig{Wait: "-1h"}); err == nil {
+		t.Error("Expected an error for a negative wait")
+	}
+}
+
+func TestProcessBatchExecutionFailedRequests(t *testing.T) {
+	server := useBatchServer(t)
+	respond := server.Respond
+	server.Respond = func(customID string, prompt string) (string, error) {
+		if customID == "file-1" {
+			return "", fmt.Errorf("overloaded")
+		}
+		return respond(customID, prompt)
+	}
+	config, tmpDir, stateDir := batchWorkflow(t, "")
+
+	// A failed request fails the step by default
+	processor := NewProcessor(config, createTestEnvConfig(), createTestServerConfig(), false, "")
+	err := processor.Process()
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 batch requests failed") || !strings.Contains(err.Error(), "overloaded") {
+		t.Fatalf("Expected an error for the failed request, got %v", err)
+	}
+	if entries, _ := os.ReadDir(stateDir); len(entries) != 0 {
+		t.Errorf("The batch state should be removed after the results are collected, got %d files", len(entries))
+	}
+
+	// With skip_errors the other results are kept
+	config.Steps[0].Config.SkipErrors = true
+	processor = NewProcessor(config, createTestEnvConfig(), createTestServerConfig(), false, "")
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() failed with skip_errors: %v", err)
+	}
+	if output, err := os.ReadFile(filepath.Join(tmpDir, "summary_0.txt")); err != nil || string(output) != "summary of Document 0" {
+		t.Errorf("Output 0 = %q, %v", output, err)
+	}
+}
+
+func TestProcessBatchStateDirInServerMode(t *testing.T) {
+	server := useBatchServer(t)
+	server.PollsUntilDone = 1
+	config, _, _ := batchWorkflow(t, "0s")
+	config.Steps[0].Config.Batch.StateDir = ""
+
+	dataDir := t.TempDir()
+	serverConfig := createTestServerConfig()
+	serverConfig.DataDir = dataDir
+	processor := NewProcessor(config, createTestEnvConfig(), serverConfig, false, "run")
+	if err := processor.Process(); err == nil || !strings.Contains(err.Error(), "resume") {
+		t.Fatalf("Expected an error asking to resume the batch, got %v", err)
+	}
+
+	// The state is kept under the runtime directory, not the working directory
+	statePath := filepath.Join(dataDir, "run", defaultBatchStateDir, "summarize_docs.json")
+	if state, err := loadBatchState(statePath); err != nil || state == nil {
+		t.Errorf("Expected the batch state at %s, got %+v, %v", statePath, state, err)
+	}
+}
@@ -47,6 +47,10 @@ type Processor struct {
 	progress     ProgressWriter    // Progress writer for streaming updates
 	runtimeDir   string            // Runtime directory for file operations
 	memory       *MemoryManager    // Memory manager for COMANDA.md file
+	project      string            // Project selecting project-scoped API keys
+	routing      *models.Routing   // Model routing of the workflow's config: block, nil to use the loaded configuration
+	params       map[string]string // Param values given by the caller
+	paramValues  map[string]string // Validated param values, with defaults
 	mu           sync.Mutex        // Mutex for thread-safe debug logging
 }
 
@@ -87,6 +91,24 @@ func (c *DSLConfig) UnmarshalYAML(node *yaml.Node) error {
 
 			// Assign deferred steps to the config
 			c.Defer = deferredSteps
+		case "config":
+			var overrides map[string]interface{}
+			if err := valueNode.Decode(&overrides); err != nil {
+				return fmt.Errorf("failed to decode workflow config: %w", err)
+			}
+			if err := config.ValidateWorkflowConfig(overrides); err != nil {
+				return fmt.Errorf("line %d: %w", keyNode.Line, err)
+			}
+			c.Config = overrides
+		case "workflow":
+			var meta WorkflowMeta
+			if err := valueNode.Decode(&meta); err != nil {
+				return fmt.Errorf("failed to decode workflow block: %w", err)
+			}
+			if err := meta.validate(); err != nil {
+				return fmt.Errorf("line %d: %w", keyNode.Line, err)
+			}
+			c.Workflow = &meta
 		default:
 			// Try to decode as a standard step config first
 			var stepConfig StepConfig
@@ -167,6 +189,24 @@ func NewProcessor(dslConfig *DSLConfig, envConfig *config.EnvConfig, serverConfi
 		rd = runtimeDir[0]
 	}
 
+	// The workflow's config: block overrides the loaded configuration. Its
+	// aliases and models are routed by this processor alone, so that they do
+	// not leak into other runs.
+	var routing *models.Routing
+	if dslConfig != nil && len(dslConfig.Config) > 0 {
+		if envConfig == nil {
+			envConfig = &config.EnvConfig{}
+		}
+		if err := config.ValidateWorkflowConfig(dslConfig.Config); err != nil {
+			log.Printf("Warning: ignoring workflow config: %v\n", err)
+		} else if merged, err := envConfig.WithLayer(config.LayerWorkflow, "", dslConfig.Config); err != nil {
+			log.Printf("Warning: ignoring workflow config: %v\n", err)
+		} else {
+			envConfig = merged
+			routing = models.NewRouting(merged)
+		}
+	}
+
 	p := &Processor{
 		config:       dslConfig,
 		envConfig:    envConfig,
@@ -178,6 +218,15 @@ func NewProcessor(dslConfig *DSLConfig, envConfig *config.EnvConfig, serverConfi
 		spinner:      NewSpinner(),
 		variables:    make(map[string]string),
 		runtimeDir:   rd, // Store runtime directory
+		project:      config.GetProject(envConfig),
+		routing:      routing,
+	}
+
+	// Apply provider endpoints from the configuration (openai-compatible
+	// endpoints, Ollama and vLLM addresses, named Ollama hosts). Configurations
+	// that include a workflow's config: block are only routed per processor.
+	if envConfig == nil || !envConfig.HasLayer(config.LayerWorkflow) {
+		models.LoadProviderConfig(envConfig)
 	}
 
 	// Store runtime directory as-is (relative or empty)
@@ -199,7 +248,7 @@ func NewProcessor(dslConfig *DSLConfig, envConfig *config.EnvConfig, serverConfi
 	// Initialize memory manager
 	memoryPath := config.GetMemoryPath(envConfig)
 	if memoryPath != "" {
-		memoryMgr, err := NewMemoryManager(memoryPath)
+		memoryMgr, err := NewNamespacedMemoryManager(memoryPath, config.GetMemoryNamespace(envConfig))
 		if err != nil {
 			// Provide detailed diagnostic information about the failure
 			p.debugf("Warning: Failed to initialize memory manager")
@@ -224,7 +273,8 @@ func NewProcessor(dslConfig *DSLConfig, envConfig *config.EnvConfig, serverConfi
 			p.debugf("  Memory features will be disabled for this session")
 		} else {
 			p.memory = memoryMgr
-			p.debugf("Memory manager initialized with file: %s", memoryPath)
+			p.memory.SetCompactor(p.summarizeMemory)
+			p.debugf("Memory manager initialized with file: %s", memoryMgr.GetFilePath())
 		}
 	} else {
 		p.debugf("No memory file configured")
@@ -255,6 +305,43 @@ func (p *Processor) LastOutput() string {
 	return p.lastOutput
 }
 
+// Variables returns a copy of the workflow's variables, e.g. for the
+// assertions of workflow tests
+func (p *Processor) Variables() map[string]string {
+	variables := make(map[string]string, len(p.variables))
+	for name, value := range p.variables {
+		variables[name] = value
+	}
+	return variables
+}
+
+// SetMemoryNamespace switches the processor to a namespace of the memory file,
+// e.g. a per-user namespace for server requests. The empty namespace is the main document.
+func (p *Processor) SetMemoryNamespace(namespace string) error {
+	if p.memory == nil {
+		if namespace == "" {
+			return nil
+		}
+		return fmt.Errorf("memory namespace '%s' requested but no memory file is configured", namespace)
+	}
+
+	memoryMgr, err := NewNamespacedMemoryManager(p.memory.filePath, namespace)
+	if err != nil {
+		return err
+	}
+	memoryMgr.SetCompactor(p.summarizeMemory)
+	p.memory = memoryMgr
+	p.debugf("Using memory namespace '%s': %s", namespace, memoryMgr.GetFilePath())
+	return nil
+}
+
+// SetProject selects the project whose API keys the processor uses, e.g. the
+// cost center of a server request
+func (p *Processor) SetProject(project string) {
+	p.project = project
+	p.debugf("Using API keys of project '%s'", project)
+}
+
 // GetMemoryFilePath returns the path to the memory file, or empty string if not configured
 func (p *Processor) GetMemoryFilePath() string {
 	if p.memory == nil {
@@ -349,8 +436,27 @@ func (p *Processor) substituteVariables(text string) string {
 	return text
 }
 
+// usesStandaloneModel reports whether a step's model is resolved by a dedicated
+// backend (image generation or embeddings) rather than the chat model registry
+func usesStandaloneModel(config StepConfig) bool {
+	switch config.Type {
+	case "image-generation", "index", "retrieve":
+		return true
+	}
+	return false
+}
+
 // validateStepConfig checks if all required fields are present in a step
 func (p *Processor) validateStepConfig(stepName string, config StepConfig) error {
+	if errors := p.stepConfigErrors(config); len(errors) > 0 {
+		return fmt.Errorf("validation errors in step '%s':\n- %s", stepName, strings.Join(errors, "\n- "))
+	}
+	return nil
+}
+
+// stepConfigErrors returns the problems of a step's configuration that can be
+// found without contacting any provider
+func (p *Processor) stepConfigErrors(config StepConfig) []string {
 	var errors []string
 
 	isGenerateStep := config.Generate != nil
@@ -405,6 +511,15 @@ func (p *Processor) validateStepConfig(stepName string, config StepConfig) error
 		if len(outputs) == 0 {
 			errors = append(errors, "output is required for standard steps (can be STDOUT for console output)")
 		}
+		switch config.Execution {
+		case "":
+		case ExecutionBatch:
+			if config.BatchMode == "combined" || config.BatchMode == "multimodal" {
+				errors = append(errors, fmt.Sprintf("execution: batch sends one request per file and cannot be combined with batch_mode: %s", config.BatchMode))
+			}
+		default:
+			errors = append(errors, fmt.Sprintf("unknown execution '%s' (must be batch or omitted)", config.Execution))
+		}
 	} else if isOpenAIResponsesStep {
 		// Validation specific to openai-responses type
 		// For example, 'instructions' might be required instead of 'action'
@@ -425,11 +540,7 @@ func (p *Processor) validateStepConfig(stepName string, config StepConfig) error
 		}
 	}
 
-	if len(errors) > 0 {
-		return fmt.Errorf("validation errors in step '%s':\n- %s", stepName, strings.Join(errors, "\n- "))
-	}
-
-	return nil
+	return errors
 }
 
 // validateDependencies checks for dependencies between steps and ensures parallel steps don't depend on each other
@@ -559,6 +670,18 @@ func (p *Processor) Process() error {
 	p.debugf("Initial validation passed: found %d sequential steps and %d parallel step groups",
 		len(p.config.Steps), len(p.config.ParallelSteps))
 
+	// Validate the params before any model is called; they are available to steps as $name
+	params, err := p.resolveParams()
+	if err != nil {
+		p.debugf("Param validation error: %v", err)
+		p.emitError(err)
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	p.paramValues = params
+	for name, value := range params {
+		p.variables[name] = value
+	}
+
 	// First validate all steps before processing
 	p.spinner.Start("Validating DSL configuration")
 
@@ -577,7 +700,7 @@ func (p *Processor) Process() error {
 		}
 
 		// Validate model names only for standard or relevant steps
-		if step.Config.Generate == nil && step.Config.Process == nil && step.Config.Type != "openai-responses" {
+		if step.Config.Generate == nil && step.Config.Process == nil && step.Config.Type != "openai-responses" && !usesStandaloneModel(step.Config) {
 			modelNames := p.NormalizeStringSlice(step.Config.Model)
 			p.debugf("Normalized model names for step %s: %v", step.Name, modelNames)
 			if err := p.validateModel(modelNames, []string{"STDIN"}); err != nil { // STDIN is a placeholder here
@@ -606,7 +729,7 @@ func (p *Processor) Process() error {
 			}
 
 			// Validate model names only for standard or relevant steps
-			if step.Config.Generate == nil && step.Config.Process == nil && step.Config.Type != "openai-responses" {
+			if step.Config.Generate == nil && step.Config.Process == nil && step.Config.Type != "openai-responses" && !usesStandaloneModel(step.Config) {
 				modelNames := p.NormalizeStringSlice(step.Config.Model)
 				p.debugf("Normalized model names for parallel step %s: %v", step.Name, modelNames)
 				if err := p.validateModel(modelNames, []string{"STDIN"}); err != nil { // STDIN is a placeholder
@@ -772,6 +895,19 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 		return p.processResponsesStep(step, isParallel, parallelID)
 	}
 
+	// Check if this is an image-generation step
+	if isImageGenerationStep(step.Config) {
+		return p.processImageGenerationStep(step, isParallel, parallelID)
+	}
+
+	// Check if this is an index or retrieve step
+	if step.Config.Type == "index" {
+		return p.processIndexStep(step, isParallel, parallelID)
+	}
+	if step.Config.Type == "retrieve" {
+		return p.processRetrieveStep(step, isParallel, parallelID)
+	}
+
 	// Handle generate step
 	if step.Config.Generate != nil {
 		return p.processGenerateStep(step, isParallel, parallelID, metrics, startTime)
@@ -850,6 +986,11 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 		inputs = p.NormalizeStringSlice(step.Config.Input)
 	}
 
+	// Inputs may name file params, e.g. input: $document
+	if err := p.substituteInputParams(inputs); err != nil {
+		return "", fmt.Errorf("step '%s': %w", step.Name, err)
+	}
+
 	modelNames := p.NormalizeStringSlice(step.Config.Model)
 	actions := p.NormalizeStringSlice(step.Config.Action)
 
@@ -900,8 +1041,8 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 
 	// Check if chunking is enabled for this step
 	var chunkResult *chunker.ChunkResult
-	if step.Config.Chunk != nil && len(inputs) == 1 {
-		// Only apply chunking to a single file input
+	if step.Config.Chunk != nil && len(inputs) == 1 && !isDurationChunking(step) {
+		// Only apply chunking to a single file input (duration chunking happens during transcription)
 		inputFile := inputs[0]
 
 		// Skip chunking for special inputs like STDIN
@@ -979,6 +1120,13 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 		p.debugf("Provider configuration successful for step: %s", step.Name)
 	}
 
+	// Transcribe audio and video inputs so the actions operate on text
+	cleanupTranscripts, err := p.transcribeMediaInputs(step)
+	if err != nil {
+		return "", fmt.Errorf("transcription error: %w", err)
+	}
+	defer cleanupTranscripts()
+
 	// Process actions with detailed logging
 	p.debugf("Processing actions for step '%s'", step.Name)
 
@@ -1016,13 +1164,15 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 		}
 
 		// If memory is enabled for this step, inject memory content
-		if step.Config.Memory && p.memory != nil && p.memory.HasMemory() {
-			memoryContent := p.memory.GetMemory()
+		if step.Config.Memory.Enabled && p.memory != nil && p.memory.HasMemory() {
+			memoryContent, err := p.buildMemoryContext(step.Config.Memory, substituted)
+			if err != nil {
+				return "", fmt.Errorf("memory error in step %s: %w", step.Name, err)
+			}
 			if memoryContent != "" {
 				// Prepend memory context to the action
-				memoryPrefix := fmt.Sprintf("Context from project memory:\n---\n%s\n---\n\n", memoryContent)
-				substituted = memoryPrefix + substituted
-				p.debugf("Injected memory context into action (memory length: %d chars)", len(memoryContent))
+				substituted = withMemoryContext(memoryContent, substituted)
+				p.debugf("Injected memory context into action (mode: %s, memory length: %d chars)", step.Config.Memory.Mode, len(memoryContent))
 			}
 		}
 
@@ -1033,7 +1183,7 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 	}
 
 	p.debugf("Executing actions: models=%v actions=%v", modelNames, substitutedActions)
-	actionResult, err := p.processActions(modelNames, substitutedActions)
+	actionResult, err := p.processActions(modelNames, substitutedActions, step)
 	if err != nil {
 		errMsg := fmt.Sprintf("Action processing failed for step '%s': %v (models=%v actions=%v)",
 			step.Name, err, modelNames, substitutedActions)
@@ -1044,7 +1194,8 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 
 	// Record action processing time
 	metrics.ActionProcessingTime = time.Since(actionStartTime).Milliseconds()
-	p.debugf("Action processing completed in %d ms", metrics.ActionProcessingTime)
+	metrics.RateLimitWaitTime = actionResult.RateLimitWait.Milliseconds()
+	p.debugf("Action processing completed in %d ms (%d ms waiting for rate limits)", metrics.ActionProcessingTime, metrics.RateLimitWaitTime)
 
 	// Start output processing time tracking
 	outputStartTime := time.Now()
@@ -1198,6 +1349,7 @@ func (p *Processor) processStep(step Step, isParallel bool, parallelID string) (
 	p.debugf("- Input processing: %d ms", metrics.InputProcessingTime)
 	p.debugf("- Model processing: %d ms", metrics.ModelProcessingTime)
 	p.debugf("- Action processing: %d ms", metrics.ActionProcessingTime)
+	p.debugf("- Rate limit wait: %d ms", metrics.RateLimitWaitTime)
 	p.debugf("- Output processing: %d ms", metrics.OutputProcessingTime)
 	p.debugf("- Total processing: %d ms", metrics.TotalProcessingTime)
 
@@ -1303,38 +1455,14 @@ func (p *Processor) processGenerateStep(step Step, isParallel bool, parallelID s
 		contextFilesContent.WriteString("\n\n")
 	}
 
-	// Get list of configured models
-	configuredModels := p.envConfig.GetAllConfiguredModels()
-	var modelsList string
-	if len(configuredModels) > 0 {
-		modelsList = fmt.Sprintf("\n--- CONFIGURED MODELS ---\nThe following models are configured and available for use:\n%s\n--- END CONFIGURED MODELS ---\n", strings.Join(configuredModels, "\n"))
-	} else {
-		modelsList = "\n--- CONFIGURED MODELS ---\nNo models are currently configured. Use 'NA' for model fields.\n--- END CONFIGURED MODELS ---\n"
-	}
-
-	// Create a more forceful prompt that emphasizes YAML-only output
-	fullPrompt := fmt.Sprintf(`SYSTEM: You are a YAML generator. You MUST output ONLY valid YAML content. No explanations, no markdown, no code blocks, no commentary - just raw YAML.
-
---- BEGIN COMANDA DSL SPECIFICATION ---
-%s
---- END COMANDA DSL SPECIFICATION ---
-%s
-User's request: %s
-
-Additional Context (if any):
-%s
-%s
-
-CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be directly saved to a .yaml file. Do not include ANY text before or after the YAML content. Start your response with the first line of YAML and end with the last line of YAML.
-
-IMPORTANT: When specifying models in the generated YAML, you MUST use one of the configured models listed above, or use 'NA' if no model is needed for a step.`,
-		string(dslGuide), modelsList, userAction, contextInput, contextFilesContent.String())
+	fullPrompt := p.generationPrompt(string(dslGuide), userAction, contextInput, contextFilesContent.String())
 
 	// 3. Call the LLM
 	provider, err := p.getProviderForModel(genModelName)
 	if err != nil {
 		return "", fmt.Errorf("failed to get provider for model '%s' in generate step '%s': %w", genModelName, step.Name, err)
 	}
+	provider = stepProvider(provider, step.Name)
 
 	// Create a temporary input.Input for the LLM call
 	// tempLLMInput := &input.Input{ // Not needed if SendPrompt takes a string
@@ -1345,7 +1473,7 @@ IMPORTANT: When specifying models in the generated YAML, you MUST use one of the
 	// }
 
 	// Assuming provider is already configured via configureProviders() or similar mechanism
-	generatedResponse, err := provider.SendPrompt(genModelName, fullPrompt)
+	generatedResponse, err := provider.SendPrompt(p.bareModelName(genModelName), fullPrompt)
 	if err != nil {
 		return "", fmt.Errorf("LLM execution failed for generate step '%s' with model '%s': %w", step.Name, genModelName, err)
 	}
@@ -1407,6 +1535,37 @@ IMPORTANT: When specifying models in the generated YAML, you MUST use one of the
 	return fmt.Sprintf("Generated workflow saved to %s", outputFilePath), nil
 }
 
+// generationPrompt is the prompt of a generate step: the DSL guide, the
+// configured models, the user's request and its context
+func (p *Processor) generationPrompt(dslGuide, userAction, contextInput, contextFiles string) string {
+	// Get list of configured models
+	configuredModels := p.envConfig.GetAllConfiguredModels()
+	var modelsList string
+	if len(configuredModels) > 0 {
+		modelsList = fmt.Sprintf("\n--- CONFIGURED MODELS ---\nThe following models are configured and available for use:\n%s\n--- END CONFIGURED MODELS ---\n", strings.Join(configuredModels, "\n"))
+	} else {
+		modelsList = "\n--- CONFIGURED MODELS ---\nNo models are currently configured. Use 'NA' for model fields.\n--- END CONFIGURED MODELS ---\n"
+	}
+
+	// Create a more forceful prompt that emphasizes YAML-only output
+	return fmt.Sprintf(`SYSTEM: You are a YAML generator. You MUST output ONLY valid YAML content. No explanations, no markdown, no code blocks, no commentary - just raw YAML.
+
+--- BEGIN COMANDA DSL SPECIFICATION ---
+%s
+--- END COMANDA DSL SPECIFICATION ---
+%s
+User's request: %s
+
+Additional Context (if any):
+%s
+%s
+
+CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be directly saved to a .yaml file. Do not include ANY text before or after the YAML content. Start your response with the first line of YAML and end with the last line of YAML.
+
+IMPORTANT: When specifying models in the generated YAML, you MUST use one of the configured models listed above, or use 'NA' if no model is needed for a step.`,
+		dslGuide, modelsList, userAction, contextInput, contextFiles)
+}
+
 // processProcessStep handles the logic for a 'process' step
 func (p *Processor) processProcessStep(step Step, isParallel bool, parallelID string, metrics *PerformanceMetrics, startTime time.Time) (string, error) {
 	stepInfo := &StepInfo{
@@ -1439,21 +1598,25 @@ func (p *Processor) processProcessStep(step Step, isParallel bool, parallelID st
 	//    The runtimeDir for the sub-processor could be the directory of the sub-workflow file or inherited.
 	//    For now, let's assume it inherits the parent's runtimeDir.
 	subProcessor := NewProcessor(&subDSLConfig, p.envConfig, p.serverConfig, p.verbose, p.runtimeDir)
+	if subProcessor.routing == nil {
+		// The parent's config: block applies to sub-workflows without their own
+		subProcessor.routing = p.routing
+	}
 	if p.progress != nil { // Propagate progress writer if available
 		subProcessor.SetProgressWriter(p.progress)
 	}
 
 	// 3. Handle inputs for the sub-workflow (optional)
+	//    They are passed as params, checked against the sub-workflow's workflow: block
+	//    if it has one, and set as variables in the sub-processor.
 	if step.Config.Process.Inputs != nil {
+		inputs := make(map[string]string, len(step.Config.Process.Inputs))
 		for key, value := range step.Config.Process.Inputs {
-			// How these inputs are made available to the sub-workflow needs careful design.
-			// Option 1: Set them as initial variables in the sub-processor.
-			subProcessor.variables[key] = fmt.Sprintf("%v", value) // Convert value to string
+			inputs[key] = p.substituteParams(fmt.Sprintf("%v", value)) // Convert value to string
 			p.debugf("Passing input '%s' (value: '%v') to sub-workflow '%s'", key, value, subWorkflowPath)
-
-			// Option 2: If the first step of sub-workflow expects STDIN and is named,
-			// we could set p.lastOutput. This is more complex.
-			// For now, using variables is simpler.
+		}
+		if err := subProcessor.SetParams(inputs); err != nil {
+			return "", fmt.Errorf("invalid inputs for sub-workflow '%s' in step '%s': %w", subWorkflowPath, step.Name, err)
 		}
 	}
 
@@ -1593,11 +1756,12 @@ func (p *Processor) validateGeneratedWorkflow(yamlContent string) error {
 		p.debugf("Checking if model '%s' in generated workflow is valid", modelName)
 
 		// Check if provider exists for this model
-		provider := models.DetectProvider(modelName)
+		provider := p.detectProvider(modelName)
 		if provider == nil {
 			invalidModels = append(invalidModels, fmt.Sprintf("%s (no provider found)", modelName))
 			continue
 		}
+		modelName := p.bareModelName(modelName)
 
 		// Check if provider supports this model
 		if !provider.SupportsModel(modelName) {
@@ -1682,50 +1846,38 @@ func (p *Processor) handleDeferredStep() error {
 
 // getProviderForModel retrieves a model provider based on the model name
 func (p *Processor) getProviderForModel(modelName string) (models.Provider, error) {
-	// First, check if the provider is already initialized
-	for _, provider := range p.providers {
-		if provider.SupportsModel(modelName) {
-			return provider, nil
-		}
-	}
-
-	// If not initialized, find the provider in the environment configuration
-	for providerName, providerConfig := range p.envConfig.Providers {
-		for _, model := range providerConfig.Models {
-			if model.Name == modelName {
-				// Initialize the provider if it's not already in the map
-				if _, ok := p.providers[providerName]; !ok {
-					var newProvider models.Provider
-					switch providerName {
-					case "openai":
-						newProvider = models.NewOpenAIProvider()
-					case "anthropic":
-						newProvider = models.NewAnthropicProvider()
-					case "google":
-						newProvider = models.NewGoogleProvider()
-					case "xai":
-						newProvider = models.NewXAIProvider()
-					case "deepseek":
-						newProvider = models.NewDeepseekProvider()
-					case "moonshot":
-						newProvider = models.NewMoonshotProvider()
-					case "ollama":
-						newProvider = models.NewOllamaProvider()
-					case "vllm":
-						newProvider = models.NewVLLMProvider()
-					default:
-						return nil, fmt.Errorf("unknown provider: %s", providerName)
-					}
-					if err := newProvider.Configure(providerConfig.APIKey); err != nil {
-						return nil, fmt.Errorf("failed to configure provider %s: %w", providerName, err)
-					}
-					newProvider.SetVerbose(p.verbose)
-					p.providers[providerName] = newProvider
-				}
-				return p.providers[providerName], nil
-			}
+	detected := p.detectProvider(modelName)
+	if detected == nil {
+		_, err := p.resolveModel(modelName)
+		if err == nil {
+			err = fmt.Errorf("no provider configured or found for model %s", modelName)
 		}
+		return nil, err
 	}
+	providerName := detected.Name()
 
-	return nil, fmt.Errorf("no provider configured or found for model %s", modelName)
+	// First, check if the provider is already initialized
+	if provider, ok := p.providers[providerName]; ok {
+		return provider, nil
+	}
+
+	// If not initialized, create it from the environment configuration
+	if providerConfig, ok := p.envConfig.Providers[providerName]; !ok || providerConfig == nil {
+		return nil, fmt.Errorf("no provider configured or found for model %s (provider %s is not configured)", modelName, providerName)
+	}
+	// Decrypts the provider's encrypted secrets on first use
+	providerConfig, err := p.envConfig.GetProviderConfig(providerName)
+	if err != nil {
+		return nil, err
+	}
+	newProvider, err := models.NewConfiguredProvider(providerName, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.configureProvider(providerName, newProvider); err != nil {
+		return nil, err
+	}
+	newProvider.SetVerbose(p.verbose)
+	p.providers[providerName] = newProvider
+	return newProvider, nil
 }
@@ -108,3 +108,18 @@ func (m *MockProvider) SendPromptWithFile(model, prompt string, file models.File
 func (m *MockProvider) SetVerbose(verbose bool) {
 	m.verbose = verbose
 }
+
+// MultiFileMockProvider is a MockProvider that accepts several files per request
+// and records the files it received
+type MultiFileMockProvider struct {
+	MockProvider
+	files []models.FileInput
+}
+
+func (m *MultiFileMockProvider) SendPromptWithFiles(model, prompt string, files []models.FileInput) (string, error) {
+	if !m.configured {
+		return "", fmt.Errorf("provider not configured")
+	}
+	m.files = files
+	return fmt.Sprintf("mock response for %d files", len(files)), nil
+}
@@ -2,6 +2,8 @@ package processor
 
 import (
 	"fmt"
+	"image"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -189,6 +191,31 @@ func TestValidateStepConfig(t *testing.T) {
 			},
 			expectedError: "",
 		},
+		{
+			name:     "unknown execution",
+			stepName: "test_step",
+			config: StepConfig{
+				Input:     "test.txt",
+				Model:     "gpt-4o-mini",
+				Action:    "analyze",
+				Output:    "STDOUT",
+				Execution: "async",
+			},
+			expectedError: "unknown execution 'async'",
+		},
+		{
+			name:     "batch execution with combined batch mode",
+			stepName: "test_step",
+			config: StepConfig{
+				Input:     []interface{}{"a.txt", "b.txt"},
+				Model:     "gpt-4o-mini",
+				Action:    "analyze",
+				Output:    "STDOUT",
+				BatchMode: "combined",
+				Execution: ExecutionBatch,
+			},
+			expectedError: "cannot be combined with batch_mode: combined",
+		},
 	}
 
 	for _, tt := range tests {
@@ -520,6 +547,70 @@ func TestBatchModeIndividualWithTemplateVariables(t *testing.T) {
 	}
 }
 
+func TestBatchModeMultimodal(t *testing.T) {
+	tmpDir := t.TempDir()
+	specPath := filepath.Join(tmpDir, "spec.txt")
+	if err := os.WriteFile(specPath, []byte("The button is blue"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	imagePath := filepath.Join(tmpDir, "screen.png")
+	imageFile, err := os.Create(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(imageFile, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	imageFile.Close()
+
+	outputPath := filepath.Join(tmpDir, "result.txt")
+	config := DSLConfig{
+		Steps: []Step{
+			{
+				Name: "compare",
+				Config: StepConfig{
+					Input:     []interface{}{specPath, imagePath},
+					BatchMode: "multimodal",
+					Model:     "gpt-4o",
+					Action:    "Does the screenshot match the spec?",
+					Output:    outputPath,
+				},
+			},
+		},
+	}
+
+	var provider models.Provider
+	mockProvider := &MultiFileMockProvider{MockProvider: MockProvider{name: "openai"}}
+	provider = mockProvider
+	detect := models.DetectProvider
+	defer func() { models.DetectProvider = detect }()
+	models.DetectProvider = func(modelName string) models.Provider { return provider }
+
+	processor := NewProcessor(&config, createTestEnvConfig(), createTestServerConfig(), false, "")
+
+	if err := processor.Process(); err != nil {
+		t.Fatalf("Process() failed: %v", err)
+	}
+
+	if len(mockProvider.files) != 2 {
+		t.Fatalf("Expected both inputs in one request, got %d files", len(mockProvider.files))
+	}
+	if image := mockProvider.files[1]; image.MimeType != "image/png" || !strings.HasPrefix(string(image.Data), "data:image/png;base64,") {
+		t.Errorf("Expected the image to be attached with its data, got %s (%d bytes)", image.MimeType, len(image.Data))
+	}
+	output, err := os.ReadFile(outputPath)
+	if err != nil || string(output) != "mock response for 2 files" {
+		t.Errorf("Output = %q, %v", output, err)
+	}
+
+	// Providers without multi-file support report an error
+	provider = NewMockProvider("openai")
+	processor = NewProcessor(&config, createTestEnvConfig(), createTestServerConfig(), false, "")
+	if err := processor.Process(); err == nil || !strings.Contains(err.Error(), "multimodal") {
+		t.Errorf("Expected a multimodal support error, got %v", err)
+	}
+}
+
 func TestDebugf(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -727,6 +818,38 @@ defer:
 	}
 }
 
+func TestWorkflowConfigRoutingIsPerProcessor(t *testing.T) {
+	envConfig := createTestEnvConfig()
+	envConfig.Aliases = map[string]string{"fast": "anthropic/claude-haiku-4-5"}
+	defer models.LoadProviderConfig(nil)
+
+	parent := NewProcessor(&DSLConfig{}, envConfig, nil, false)
+	workflow := NewProcessor(&DSLConfig{Config: map[string]interface{}{
+		"aliases": map[string]interface{}{"fast": "openai/gpt-4o-mini"},
+	}}, envConfig, nil, false)
+
+	if ref, err := workflow.resolveModel("fast"); err != nil || ref.String() != "openai/gpt-4o-mini" {
+		t.Errorf("Expected the workflow's alias, got %s, %v", ref, err)
+	}
+	for name, resolve := range map[string]func(string) (models.ModelRef, error){
+		"parent processor":     parent.resolveModel,
+		"loaded configuration": models.ResolveModel,
+	} {
+		if ref, err := resolve("fast"); err != nil || ref.String() != "anthropic/claude-haiku-4-5" {
+			t.Errorf("Expected the %s to keep its alias, got %s, %v", name, ref, err)
+		}
+	}
+
+	// Connection settings of the workflow layer are rejected as a whole
+	redirect := NewProcessor(&DSLConfig{Config: map[string]interface{}{
+		"aliases":   map[string]interface{}{"fast": "openai/gpt-4o-mini"},
+		"providers": map[string]interface{}{"openai": map[string]interface{}{"base_url": "http://attacker/v1"}},
+	}}, envConfig, nil, false)
+	if redirect.routing != nil || redirect.envConfig.HasLayer(config.LayerWorkflow) {
+		t.Error("Expected a workflow config that sets base_url to be ignored")
+	}
+}
+
 func TestIsURL(t *testing.T) {
 	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, "")
 
@@ -72,6 +72,21 @@ another_step_name:
   # ... step definition ...
 ` + "```" + `
 
+A workflow may start with a reserved ` + "`workflow:`" + ` block (it is not a step) holding metadata and typed params:
+
+` + "```yaml" + `
+workflow:
+  name: summarize
+  version: "1.0"
+  description: Summarize a document
+  params:
+    document: {type: file, required: true}
+    style: {type: enum, values: [short, detailed], default: short}
+    max_words: {type: int, default: 200}
+` + "```" + `
+
+Param types are ` + "`string`" + ` (default), ` + "`int`" + `, ` + "`bool`" + `, ` + "`file`" + ` (an existing file) and ` + "`enum`" + ` (requires ` + "`values`" + `). Steps reference params as ` + "`$name`" + ` in ` + "`action`" + ` and ` + "`input`" + ` (e.g. ` + "`input: $document`" + `). Values come from ` + "`comanda process wf.yaml --param key=value`" + `, a server request's JSON ` + "`params`" + `, or a parent's ` + "`process.inputs`" + `, and are validated before any model is called. On the server, ` + "`file`" + ` params and inputs built from params must stay within the data directory.
+
 ## 1. Standard Processing Step Definition
 
 This is the most common step type.
@@ -84,7 +99,7 @@ step_name:
   action: [action to perform / prompt provided]
   output: [output destination]
   type: [optional, e.g., "openai-responses"] # Specifies specialized handling
-  batch_mode: [individual|combined] # Optional, for multi-file inputs
+  batch_mode: [individual|combined|multimodal] # Optional, for multi-file inputs
   skip_errors: [true|false] # Optional, for multi-file inputs
   # ... other type-specific fields for "openai-responses" like 'instructions', 'tools', etc.
 ` + "```" + `
@@ -94,9 +109,16 @@ step_name:
 - ` + "`model`" + `: (Required, can be ` + "`NA`" + `) LLM model to use. See "Models".
 - ` + "`action`" + `: (Required for most) Instructions or operations. See "Actions".
 - ` + "`output`" + `: (Required) Destination for results. See "Outputs".
-- ` + "`type`" + `: (Optional) Specifies a specialized handler for the step, e.g., ` + "`openai-responses`" + `. If omitted, it's a general-purpose LLM or NA step.
-- ` + "`batch_mode`" + `: (Optional, default: ` + "`combined`" + `) For steps with multiple file inputs, defines if files are processed ` + "`combined`" + ` into one LLM call or ` + "`individual`" + `ly.
+- ` + "`type`" + `: (Optional) Specifies a specialized handler for the step, e.g., ` + "`openai-responses`" + `, ` + "`image-generation`" + `, ` + "`index`" + ` or ` + "`retrieve`" + `. If omitted, it's a general-purpose LLM or NA step.
+- ` + "`batch_mode`" + `: (Optional, default: ` + "`combined`" + `) For steps with multiple file inputs, defines if files are processed ` + "`combined`" + ` into one LLM call, ` + "`individual`" + `ly, or ` + "`multimodal`" + ` (all files, including images and screenshots, attached to a single request, e.g. to compare two screenshots; supported by OpenAI, Anthropic, Google, Ollama vision models and openai-compatible endpoints).
 - ` + "`skip_errors`" + `: (Optional, default: ` + "`false`" + `) If ` + "`batch_mode: individual`" + `, determines if processing continues if one file fails.
+- ` + "`execution`" + `: (Optional) ` + "`batch`" + ` sends the per-file requests of a ` + "`batch_mode: individual`" + ` step as one discounted asynchronous OpenAI or Anthropic batch and writes the results to the same ` + "`{{ file_index }}`" + ` outputs. ` + "`batch: { poll_interval: 30s, wait: 24h, state_dir: .comanda/batches }`" + ` tunes polling; the batch ID is stored so that running the workflow again resumes a batch that is still in progress. A failed request fails the step unless ` + "`skip_errors: true`" + `.
+- ` + "`memory`" + `: (Optional) Injects the project memory file (` + "`COMANDA.md`" + `) into the action. ` + "`true`" + ` injects the whole file; ` + "`{ mode: sections, sections: [Name, ...] }`" + ` injects only those ` + "`## Name`" + ` sections; ` + "`relevant`" + ` (or ` + "`{ mode: relevant, max_tokens: 2000, model: <embedding model> }`" + `) injects the entries most relevant to the action within a token budget, ranked by keywords or, when ` + "`model`" + ` is set, by embeddings.
+
+- ` + "`params`" + `: (Optional) Generation parameters for the model call: ` + "`temperature`" + ` (0-2, ` + "`0`" + ` for deterministic output), ` + "`top_p`" + `, ` + "`max_tokens`" + `, ` + "`stop`" + ` (list), ` + "`seed`" + `, ` + "`reasoning_effort`" + ` (` + "`minimal|low|medium|high`" + `, reasoning models) and ` + "`thinking_budget`" + ` (Anthropic extended thinking). They override per-model defaults from the env file. A parameter the model does not support is an error, e.g. ` + "`temperature`" + ` on o3 or ` + "`seed`" + ` on Claude.
+- Rate limits are configured in the env file, not in workflows: ` + "`rate_limit: { requests_per_minute: N, tokens_per_minute: N }`" + ` on a provider (shared by its models) or a model. comanda queues requests to stay within them, so parallel steps do not need manual throttling.
+- API keys are also configured in the env file: a provider's ` + "`api_keys`" + ` list (` + "`name`" + `, ` + "`key`" + `, optional ` + "`project`" + `) with ` + "`key_selection: round-robin|least-used`" + ` spreads requests over several keys. Any key, header value, database password or ` + "`bearerToken`" + ` may be a reference resolved when the env file is loaded: ` + "`env:VAR`" + `, ` + "`file:/path`" + ` or ` + "`cmd:command`" + `. Workflows never contain keys; run them for a project with ` + "`comanda process --project <name>`" + ` to use that project's keys.
+- A workflow may have a top-level ` + "`config:`" + ` block that overrides the user (` + "`~/.comanda/config.yaml`" + `), project (` + "`.comanda/config.yaml`" + `) and env file configuration for that run, e.g. ` + "`config: { aliases: { fast: anthropic/claude-haiku-4-5 }, providers: { openai: { rate_limit: { requests_per_minute: 20 } } } }`" + `. It applies to that workflow and its sub-workflows only, and must not contain API keys, provider connection settings (` + "`base_url`" + `, ` + "`endpoint`" + `, ` + "`headers`" + `, ` + "`auth`" + `, ` + "`tls`" + `), databases or server settings; ` + "`--set path=value`" + ` flags override it.
 
 **OpenAI Responses API Specific Fields (used when ` + "`type: openai-responses`" + `):**
 - ` + "`instructions`" + `: (string) System message for the LLM.
@@ -145,7 +167,7 @@ step_name_for_processing:
 ` + "```" + `
 **` + "`process`" + ` Block Attributes:**
 - ` + "`workflow_file`" + `: (string, required) The path to the Comanda workflow YAML file to be executed. This can be a statically defined path or the output of a ` + "`generate`" + ` step.
-- ` + "`inputs`" + `: (map, optional) A map of key-value pairs to pass as initial variables to the sub-workflow. These can be accessed within the sub-workflow (e.g., as ` + "`$parent.key1`" + `).
+- ` + "`inputs`" + `: (map, optional) A map of key-value pairs to pass as initial variables to the sub-workflow. These can be accessed within the sub-workflow (e.g., as ` + "`$key1`" + `). If the sub-workflow has a ` + "`workflow:`" + ` block, the inputs are its params and are validated against it.
 - **Note:** The ` + "`input`" + ` field for a ` + "`process`" + ` step is optional. If ` + "`input: STDIN`" + ` is used, the output of the previous step in the parent workflow will be available as the initial ` + "`STDIN`" + ` for the *first* step of the sub-workflow if that first step expects ` + "`STDIN`" + `.
 
 ## Common Elements (for Standard Steps)
@@ -159,6 +181,7 @@ step_name_for_processing:
 - No input: ` + "`input: NA`" + `
 - Input with alias for variable: ` + "`input: path/to/file.txt as $my_var`" + `
 - List with aliases: ` + "`input: [file1.txt as $file1_content, file2.txt as $file2_content]`" + `
+- Audio/video files: ` + "`input: meeting.mp3`" + ` (` + "`.mp3`" + `, ` + "`.wav`" + `, ` + "`.m4a`" + `, ` + "`.mp4`" + `). Media is transcribed to text before the action runs. See "Transcription".
 
 ### Chunking
 For processing large files, you can use the ` + "`chunk`" + ` configuration to split the input into manageable pieces:
@@ -168,7 +191,7 @@ For processing large files, you can use the ` + "`chunk`" + ` configuration to s
 step_name:
   input: "large_file.txt"
   chunk:
-    by: lines  # or "tokens"
+    by: lines  # or "tokens", or "duration" for audio/video inputs
     size: 1000  # number of lines or tokens per chunk
     overlap: 50  # optional: number of lines or tokens to overlap between chunks
     max_chunks: 10  # optional: limit the total number of chunks processed
@@ -180,8 +203,8 @@ step_name:
 
 **Key Elements:**
 - ` + "`chunk`" + `: (Optional) Configuration block for chunking a large input file.
-  - ` + "`by`" + `: (Required) Chunking method - either ` + "`lines`" + ` or ` + "`tokens`" + `.
-  - ` + "`size`" + `: (Required) Number of lines or tokens per chunk.
+  - ` + "`by`" + `: (Required) Chunking method - ` + "`lines`" + `, ` + "`tokens`" + `, or ` + "`duration`" + ` (audio/video transcripts only).
+  - ` + "`size`" + `: (Required) Number of lines or tokens per chunk, or seconds per chunk when chunking by ` + "`duration`" + `.
   - ` + "`overlap`" + `: (Optional) Number of lines or tokens to include from the previous chunk, providing context continuity.
   - ` + "`max_chunks`" + `: (Optional) Maximum number of chunks to process, useful for testing or limiting processing.
 - ` + "`batch_mode: individual`" + `: Required when using chunking to process each chunk as a separate LLM call.
@@ -211,10 +234,106 @@ consolidate_results:
   output: "final_summary.txt"
 ` + "```" + `
 
+### Transcription
+Audio and video inputs are transcribed before the step's action runs, and the transcript replaces the media file as the step input. Without a ` + "`transcription`" + ` block the OpenAI ` + "`whisper-1`" + ` model is used.
+
+` + "```yaml" + `
+summarize_meeting:
+  input: recordings/standup.mp3
+  transcription:
+    model: gpt-4o-transcribe-diarize  # or whisper-1, gpt-4o-transcribe, gemini-2.5-flash, or a local whisper model
+    provider: openai      # optional: openai, google, or whisper (local server at WHISPER_ENDPOINT)
+    language: en          # optional language hint
+    timestamps: true      # prefix each segment with [mm:ss]
+    speakers: true        # prefix each segment with the speaker label (diarize models)
+  chunk:
+    by: duration
+    size: 600             # 10-minute windows
+  batch_mode: individual
+  model: gpt-4o-mini
+  action: "Summarize this part of the meeting."
+  output: "summary_{{ chunk_index }}.txt"
+` + "```" + `
+
+- ` + "`transcription`" + `: (Optional) Configures the speech-to-text backend for audio/video inputs.
+  - ` + "`model`" + `: Transcription model (default ` + "`whisper-1`" + `).
+  - ` + "`provider`" + `: (Optional) Forces the backend; otherwise it is detected from the model name.
+  - ` + "`language`" + `, ` + "`prompt`" + `: (Optional) Hints passed to the backend.
+  - ` + "`timestamps`" + `, ` + "`speakers`" + `: (Optional) Include segment timestamps and speaker labels in the transcript. These and ` + "`chunk: { by: duration }`" + ` need a model that returns timed segments, such as ` + "`whisper-1`" + `; with ` + "`gpt-4o-transcribe`" + ` the step fails instead of dropping them. ` + "`speakers`" + ` on OpenAI and local whisper backends needs a diarize model such as ` + "`gpt-4o-transcribe-diarize`" + `.
+- ` + "`chunk.by: duration`" + ` splits the transcript into windows of ` + "`size`" + ` seconds; each window is processed like a text chunk.
+
+### Image Generation
+A step with ` + "`type: image-generation`" + ` sends its action as an image prompt and writes the generated images to its file outputs. Text inputs (including ` + "`STDIN`" + `) are appended to the prompt as context. The written file paths become the step's output, so later steps can use the images as inputs for vision models.
+
+` + "```yaml" + `
+create_logo:
+  type: image-generation
+  input: NA
+  model: gpt-image-1       # or dall-e-3, gemini-2.5-flash-image, or a local stable-diffusion checkpoint
+  action: "A minimalist fox logo, flat colors"
+  image:
+    provider: openai       # optional: openai, google, or stable-diffusion (local server at STABLE_DIFFUSION_ENDPOINT)
+    size: 1024x1024        # optional WIDTHxHEIGHT
+    quality: high          # optional, backend-specific
+    count: 2               # optional, default 1
+    format: png            # optional: png or jpeg (default: from the output extension)
+  output: "logo_{{ image_index }}.png"
+
+review_logo:
+  input: "logo_0.png"
+  model: gpt-4o
+  action: "Critique this logo."
+  output: STDOUT
+` + "```" + `
+
+- ` + "`{{ image_index }}`" + `: Index of the generated image (0-based) in output paths. Without it, multiple images are saved as ` + "`name-0.png`" + `, ` + "`name-1.png`" + `, ... Variables such as ` + "`$name`" + ` are also expanded in output paths.
+- At least one file output is required; ` + "`STDOUT`" + ` and ` + "`MEMORY`" + ` outputs receive the list of written paths.
+
+### Retrieval (RAG)
+Two step types provide retrieval over a local, file-backed vector index:
+- ` + "`type: index`" + ` chunks its text inputs, embeds each chunk, and stores the vectors in ` + "`index.path`" + `. Re-indexing a file replaces its earlier chunks.
+- ` + "`type: retrieve`" + ` embeds its action (plus any text inputs) as a query and returns the ` + "`top_k`" + ` most similar chunks. The result is the step's output, so the next step can use it through ` + "`STDIN`" + `.
+
+` + "```yaml" + `
+index_docs:
+  type: index
+  input: "docs/*.md"
+  model: text-embedding-3-small   # embedding model (OpenAI, Google, Ollama or vLLM)
+  index:
+    path: .comanda/docs.index.json
+    provider: openai               # optional: openai, google, ollama, or vllm
+  chunk:                            # optional, default 500 tokens with 50 overlap
+    by: tokens
+    size: 500
+    overlap: 50
+  output: STDOUT
+
+find_context:
+  type: retrieve
+  input: NA
+  model: text-embedding-3-small    # must match the model used to build the index
+  action: "How do I configure the server port?"
+  retrieve:
+    index: .comanda/docs.index.json
+    top_k: 5
+    min_score: 0.2                 # optional
+  output: STDOUT
+
+answer:
+  input: STDIN
+  model: gpt-4o-mini
+  action: "Answer the question 'How do I configure the server port?' using only this context."
+  output: STDOUT
+` + "```" + `
+
 ### Models
 - Single model: ` + "`model: gpt-4o-mini`" + `
 - No model (for non-LLM operations): ` + "`model: NA`" + `
 - Multiple models (for comparison): ` + "`model: [gpt-4o-mini, claude-3-opus-20240229]`" + `
+- Models served by an ` + "`openai-compatible`" + ` provider in the env file (LiteLLM, LM Studio, OpenRouter, Groq, gateways) are used by the exact name listed there, e.g. ` + "`model: meta-llama/llama-3.1-70b-instruct`" + `. They support text, images and ` + "`openai-responses`" + ` steps (without ` + "`tools`" + ` or ` + "`previous_response_id`" + `).
+- Provider-qualified model: ` + "`model: anthropic/claude-sonnet-4-5`" + ` or ` + "`model: vllm/llama3`" + ` picks the provider explicitly; use this when the same model name could be served by several providers.
+- Aliases defined in the env file (e.g. ` + "`fast`" + `, ` + "`smart`" + `, ` + "`local`" + `) can be used wherever a model is named: ` + "`model: fast`" + `.
+- An unknown model name is an error; it is never sent to Ollama by default.
 
 ### Actions
 - Single instruction: ` + "`action: \"Summarize this text.\"`" + `
@@ -251,6 +370,8 @@ consolidate_results:
     *   ` + "`process.inputs`" + ` is optional.
     *   Top-level ` + "`input`" + ` for the step is optional (can be ` + "`NA`" + ` or ` + "`STDIN`" + ` to pipe to sub-workflow).
 
+Check a workflow against these rules without running it with ` + "`comanda validate workflow.yaml`" + `, which reports each problem as ` + "`file:line:column: severity: message [rule]`" + `. ` + "`comanda schema`" + ` prints a JSON Schema of the format. ` + "`comanda process --dry-run workflow.yaml`" + ` shows the prompts each step would send and the estimated tokens and cost without calling any model. ` + "`comanda test`" + ` runs ` + "`*.test.yaml`" + ` files that check a workflow's outputs against scripted model responses, ` + "`comanda eval`" + ` scores a workflow over a CSV or JSONL dataset per model, and ` + "`--record <dir>`" + ` / ` + "`--replay <dir>`" + ` capture a run's provider requests and replay them offline.
+
 ## Chaining and Examples
 
 Steps can be "chained together" by either passing STDOUT from one step to STDIN of the next step or by writing to a file and then having subsequent steps take this file as input.
@@ -344,6 +465,21 @@ another_step_name:
   # ... step definition ...
 ` + "```" + `
 
+A workflow may start with a reserved ` + "`workflow:`" + ` block (it is not a step) holding metadata and typed params:
+
+` + "```yaml" + `
+workflow:
+  name: summarize
+  version: "1.0"
+  description: Summarize a document
+  params:
+    document: {type: file, required: true}
+    style: {type: enum, values: [short, detailed], default: short}
+    max_words: {type: int, default: 200}
+` + "```" + `
+
+Param types are ` + "`string`" + ` (default), ` + "`int`" + `, ` + "`bool`" + `, ` + "`file`" + ` (an existing file) and ` + "`enum`" + ` (requires ` + "`values`" + `). Steps reference params as ` + "`$name`" + ` in ` + "`action`" + ` and ` + "`input`" + ` (e.g. ` + "`input: $document`" + `). Values come from ` + "`comanda process wf.yaml --param key=value`" + `, a server request's JSON ` + "`params`" + `, or a parent's ` + "`process.inputs`" + `, and are validated before any model is called. On the server, ` + "`file`" + ` params and inputs built from params must stay within the data directory.
+
 ## 1. Standard Processing Step Definition
 
 This is the most common step type.
@@ -356,7 +492,7 @@ step_name:
   action: [action to perform / prompt provided]
   output: [output destination]
   type: [optional, e.g., "openai-responses"] # Specifies specialized handling
-  batch_mode: [individual|combined] # Optional, for multi-file inputs
+  batch_mode: [individual|combined|multimodal] # Optional, for multi-file inputs
   skip_errors: [true|false] # Optional, for multi-file inputs
   # ... other type-specific fields for "openai-responses" like 'instructions', 'tools', etc.
 ` + "```" + `
@@ -366,9 +502,16 @@ step_name:
 - ` + "`model`" + `: (Required, can be ` + "`NA`" + `) LLM model to use. See "Models".
 - ` + "`action`" + `: (Required for most) Instructions or operations. See "Actions".
 - ` + "`output`" + `: (Required) Destination for results. See "Outputs".
-- ` + "`type`" + `: (Optional) Specifies a specialized handler for the step, e.g., ` + "`openai-responses`" + `. If omitted, it's a general-purpose LLM or NA step.
-- ` + "`batch_mode`" + `: (Optional, default: ` + "`combined`" + `) For steps with multiple file inputs, defines if files are processed ` + "`combined`" + ` into one LLM call or ` + "`individual`" + `ly.
+- ` + "`type`" + `: (Optional) Specifies a specialized handler for the step, e.g., ` + "`openai-responses`" + `, ` + "`image-generation`" + `, ` + "`index`" + ` or ` + "`retrieve`" + `. If omitted, it's a general-purpose LLM or NA step.
+- ` + "`batch_mode`" + `: (Optional, default: ` + "`combined`" + `) For steps with multiple file inputs, defines if files are processed ` + "`combined`" + ` into one LLM call, ` + "`individual`" + `ly, or ` + "`multimodal`" + ` (all files, including images and screenshots, attached to a single request, e.g. to compare two screenshots; supported by OpenAI, Anthropic, Google, Ollama vision models and openai-compatible endpoints).
 - ` + "`skip_errors`" + `: (Optional, default: ` + "`false`" + `) If ` + "`batch_mode: individual`" + `, determines if processing continues if one file fails.
+- ` + "`execution`" + `: (Optional) ` + "`batch`" + ` sends the per-file requests of a ` + "`batch_mode: individual`" + ` step as one discounted asynchronous OpenAI or Anthropic batch and writes the results to the same ` + "`{{ file_index }}`" + ` outputs. ` + "`batch: { poll_interval: 30s, wait: 24h, state_dir: .comanda/batches }`" + ` tunes polling; the batch ID is stored so that running the workflow again resumes a batch that is still in progress. A failed request fails the step unless ` + "`skip_errors: true`" + `.
+- ` + "`memory`" + `: (Optional) Injects the project memory file (` + "`COMANDA.md`" + `) into the action. ` + "`true`" + ` injects the whole file; ` + "`{ mode: sections, sections: [Name, ...] }`" + ` injects only those ` + "`## Name`" + ` sections; ` + "`relevant`" + ` (or ` + "`{ mode: relevant, max_tokens: 2000, model: <embedding model> }`" + `) injects the entries most relevant to the action within a token budget, ranked by keywords or, when ` + "`model`" + ` is set, by embeddings.
+
+- ` + "`params`" + `: (Optional) Generation parameters for the model call: ` + "`temperature`" + ` (0-2, ` + "`0`" + ` for deterministic output), ` + "`top_p`" + `, ` + "`max_tokens`" + `, ` + "`stop`" + ` (list), ` + "`seed`" + `, ` + "`reasoning_effort`" + ` (` + "`minimal|low|medium|high`" + `, reasoning models) and ` + "`thinking_budget`" + ` (Anthropic extended thinking). They override per-model defaults from the env file. A parameter the model does not support is an error, e.g. ` + "`temperature`" + ` on o3 or ` + "`seed`" + ` on Claude.
+- Rate limits are configured in the env file, not in workflows: ` + "`rate_limit: { requests_per_minute: N, tokens_per_minute: N }`" + ` on a provider (shared by its models) or a model. comanda queues requests to stay within them, so parallel steps do not need manual throttling.
+- API keys are also configured in the env file: a provider's ` + "`api_keys`" + ` list (` + "`name`" + `, ` + "`key`" + `, optional ` + "`project`" + `) with ` + "`key_selection: round-robin|least-used`" + ` spreads requests over several keys. Any key, header value, database password or ` + "`bearerToken`" + ` may be a reference resolved when the env file is loaded: ` + "`env:VAR`" + `, ` + "`file:/path`" + ` or ` + "`cmd:command`" + `. Workflows never contain keys; run them for a project with ` + "`comanda process --project <name>`" + ` to use that project's keys.
+- A workflow may have a top-level ` + "`config:`" + ` block that overrides the user (` + "`~/.comanda/config.yaml`" + `), project (` + "`.comanda/config.yaml`" + `) and env file configuration for that run, e.g. ` + "`config: { aliases: { fast: anthropic/claude-haiku-4-5 }, providers: { openai: { rate_limit: { requests_per_minute: 20 } } } }`" + `. It applies to that workflow and its sub-workflows only, and must not contain API keys, provider connection settings (` + "`base_url`" + `, ` + "`endpoint`" + `, ` + "`headers`" + `, ` + "`auth`" + `, ` + "`tls`" + `), databases or server settings; ` + "`--set path=value`" + ` flags override it.
 
 **OpenAI Responses API Specific Fields (used when ` + "`type: openai-responses`" + `):**
 - ` + "`instructions`" + `: (string) System message for the LLM.
@@ -417,7 +560,7 @@ step_name_for_processing:
 ` + "```" + `
 **` + "`process`" + ` Block Attributes:**
 - ` + "`workflow_file`" + `: (string, required) The path to the Comanda workflow YAML file to be executed. This can be a statically defined path or the output of a ` + "`generate`" + ` step.
-- ` + "`inputs`" + `: (map, optional) A map of key-value pairs to pass as initial variables to the sub-workflow. These can be accessed within the sub-workflow (e.g., as ` + "`$parent.key1`" + `).
+- ` + "`inputs`" + `: (map, optional) A map of key-value pairs to pass as initial variables to the sub-workflow. These can be accessed within the sub-workflow (e.g., as ` + "`$key1`" + `). If the sub-workflow has a ` + "`workflow:`" + ` block, the inputs are its params and are validated against it.
 - **Note:** The ` + "`input`" + ` field for a ` + "`process`" + ` step is optional. If ` + "`input: STDIN`" + ` is used, the output of the previous step in the parent workflow will be available as the initial ` + "`STDIN`" + ` for the *first* step of the sub-workflow if that first step expects ` + "`STDIN`" + `.
 
 ## Common Elements (for Standard Steps)
@@ -431,11 +574,108 @@ step_name_for_processing:
 - No input: ` + "`input: NA`" + `
 - Input with alias for variable: ` + "`input: path/to/file.txt as $my_var`" + `
 - List with aliases: ` + "`input: [file1.txt as $file1_content, file2.txt as $file2_content]`" + `
+- Audio/video files: ` + "`input: meeting.mp3`" + ` (` + "`.mp3`" + `, ` + "`.wav`" + `, ` + "`.m4a`" + `, ` + "`.mp4`" + `). Media is transcribed to text before the action runs. See "Transcription".
+
+### Transcription
+Audio and video inputs are transcribed before the step's action runs, and the transcript replaces the media file as the step input. Without a ` + "`transcription`" + ` block the OpenAI ` + "`whisper-1`" + ` model is used.
+
+` + "```yaml" + `
+summarize_meeting:
+  input: recordings/standup.mp3
+  transcription:
+    model: gpt-4o-transcribe-diarize  # or whisper-1, gpt-4o-transcribe, gemini-2.5-flash, or a local whisper model
+    provider: openai      # optional: openai, google, or whisper (local server at WHISPER_ENDPOINT)
+    language: en          # optional language hint
+    timestamps: true      # prefix each segment with [mm:ss]
+    speakers: true        # prefix each segment with the speaker label (diarize models)
+  chunk:
+    by: duration
+    size: 600             # 10-minute windows
+  batch_mode: individual
+  model: gpt-4o-mini
+  action: "Summarize this part of the meeting."
+  output: "summary_{{ chunk_index }}.txt"
+` + "```" + `
+
+- ` + "`transcription`" + `: (Optional) Configures the speech-to-text backend for audio/video inputs.
+  - ` + "`model`" + `: Transcription model (default ` + "`whisper-1`" + `).
+  - ` + "`provider`" + `: (Optional) Forces the backend; otherwise it is detected from the model name.
+  - ` + "`language`" + `, ` + "`prompt`" + `: (Optional) Hints passed to the backend.
+  - ` + "`timestamps`" + `, ` + "`speakers`" + `: (Optional) Include segment timestamps and speaker labels in the transcript. These and ` + "`chunk: { by: duration }`" + ` need a model that returns timed segments, such as ` + "`whisper-1`" + `; with ` + "`gpt-4o-transcribe`" + ` the step fails instead of dropping them. ` + "`speakers`" + ` on OpenAI and local whisper backends needs a diarize model such as ` + "`gpt-4o-transcribe-diarize`" + `.
+- ` + "`chunk.by: duration`" + ` splits the transcript into windows of ` + "`size`" + ` seconds; each window is processed like a text chunk.
+
+### Image Generation
+A step with ` + "`type: image-generation`" + ` sends its action as an image prompt and writes the generated images to its file outputs. Text inputs (including ` + "`STDIN`" + `) are appended to the prompt as context. The written file paths become the step's output, so later steps can use the images as inputs for vision models.
+
+` + "```yaml" + `
+create_logo:
+  type: image-generation
+  input: NA
+  model: gpt-image-1       # or dall-e-3, gemini-2.5-flash-image, or a local stable-diffusion checkpoint
+  action: "A minimalist fox logo, flat colors"
+  image:
+    provider: openai       # optional: openai, google, or stable-diffusion (local server at STABLE_DIFFUSION_ENDPOINT)
+    size: 1024x1024        # optional WIDTHxHEIGHT
+    quality: high          # optional, backend-specific
+    count: 2               # optional, default 1
+    format: png            # optional: png or jpeg (default: from the output extension)
+  output: "logo_{{ image_index }}.png"
+
+review_logo:
+  input: "logo_0.png"
+  model: gpt-4o
+  action: "Critique this logo."
+  output: STDOUT
+` + "```" + `
+
+- ` + "`{{ image_index }}`" + `: Index of the generated image (0-based) in output paths. Without it, multiple images are saved as ` + "`name-0.png`" + `, ` + "`name-1.png`" + `, ... Variables such as ` + "`$name`" + ` are also expanded in output paths.
+- At least one file output is required; ` + "`STDOUT`" + ` and ` + "`MEMORY`" + ` outputs receive the list of written paths.
+
+### Retrieval (RAG)
+Two step types provide retrieval over a local, file-backed vector index:
+- ` + "`type: index`" + ` chunks its text inputs, embeds each chunk, and stores the vectors in ` + "`index.path`" + `. Re-indexing a file replaces its earlier chunks.
+- ` + "`type: retrieve`" + ` embeds its action (plus any text inputs) as a query and returns the ` + "`top_k`" + ` most similar chunks. The result is the step's output, so the next step can use it through ` + "`STDIN`" + `.
+
+` + "```yaml" + `
+index_docs:
+  type: index
+  input: "docs/*.md"
+  model: text-embedding-3-small   # embedding model (OpenAI, Google, Ollama or vLLM)
+  index:
+    path: .comanda/docs.index.json
+    provider: openai               # optional: openai, google, ollama, or vllm
+  chunk:                            # optional, default 500 tokens with 50 overlap
+    by: tokens
+    size: 500
+    overlap: 50
+  output: STDOUT
+
+find_context:
+  type: retrieve
+  input: NA
+  model: text-embedding-3-small    # must match the model used to build the index
+  action: "How do I configure the server port?"
+  retrieve:
+    index: .comanda/docs.index.json
+    top_k: 5
+    min_score: 0.2                 # optional
+  output: STDOUT
+
+answer:
+  input: STDIN
+  model: gpt-4o-mini
+  action: "Answer the question 'How do I configure the server port?' using only this context."
+  output: STDOUT
+` + "```" + `
 
 ### Models
 - Single model: ` + "`model: gpt-4o-mini`" + `
 - No model (for non-LLM operations): ` + "`model: NA`" + `
 - Multiple models (for comparison): ` + "`model: [gpt-4o-mini, claude-3-opus-20240229]`" + `
+- Models served by an ` + "`openai-compatible`" + ` provider in the env file (LiteLLM, LM Studio, OpenRouter, Groq, gateways) are used by the exact name listed there, e.g. ` + "`model: meta-llama/llama-3.1-70b-instruct`" + `. They support text, images and ` + "`openai-responses`" + ` steps (without ` + "`tools`" + ` or ` + "`previous_response_id`" + `).
+- Provider-qualified model: ` + "`model: anthropic/claude-sonnet-4-5`" + ` or ` + "`model: vllm/llama3`" + ` picks the provider explicitly; use this when the same model name could be served by several providers.
+- Aliases defined in the env file (e.g. ` + "`fast`" + `, ` + "`smart`" + `, ` + "`local`" + `) can be used wherever a model is named: ` + "`model: fast`" + `.
+- An unknown model name is an error; it is never sent to Ollama by default.
 - **IMPORTANT**: When specifying a model, you **must** use one of the supported models listed below. Do not use model names that are not in this list.
 
 ### Supported Models
@@ -477,6 +717,8 @@ step_name_for_processing:
     *   ` + "`process.inputs`" + ` is optional.
     *   Top-level ` + "`input`" + ` for the step is optional (can be ` + "`NA`" + ` or ` + "`STDIN`" + ` to pipe to sub-workflow).
 
+Check a workflow against these rules without running it with ` + "`comanda validate workflow.yaml`" + `, which reports each problem as ` + "`file:line:column: severity: message [rule]`" + `. ` + "`comanda schema`" + ` prints a JSON Schema of the format. ` + "`comanda process --dry-run workflow.yaml`" + ` shows the prompts each step would send and the estimated tokens and cost without calling any model. ` + "`comanda test`" + ` runs ` + "`*.test.yaml`" + ` files that check a workflow's outputs against scripted model responses, ` + "`comanda eval`" + ` scores a workflow over a CSV or JSONL dataset per model, and ` + "`--record <dir>`" + ` / ` + "`--replay <dir>`" + ` capture a run's provider requests and replay them offline.
+
 ## Chaining and Examples
 
 Steps can be "chained together" by either passing STDOUT from one step to STDIN of the next step or by writing to a file and then having subsequent steps take this file as input.
@@ -0,0 +1,362 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultExpectedColumn is the dataset column with the expected outputs
+const defaultExpectedColumn = "expected"
+
+// EvalFile runs a workflow over the rows of a dataset, once per model, and
+// scores each output. Paths in it are relative to the file.
+type EvalFile struct {
+	Path     string            `yaml:"-"`
+	Workflow string            `yaml:"workflow"` // Workflow under evaluation
+	Dataset  string            `yaml:"dataset"`  // CSV file with a header row, or JSONL file of objects
+	Input    string            `yaml:"input"`    // Column piped to the workflow as STDIN
+	Expected string            `yaml:"expected"` // Column with the expected output, "expected" by default
+	Output   string            `yaml:"output"`   // STDOUT (default) or a workflow variable such as $answer
+	Params   map[string]string `yaml:"params"`   // Params of every run, like --param
+	Models   []string          `yaml:"models"`   // Models replacing the models of the workflow's steps, one run each
+	Scorers  []EvalScorer      `yaml:"scorers"`
+
+	dir string // Absolute directory of the file
+}
+
+// EvalOptions controls an evaluation run
+type EvalOptions struct {
+	Models  []string // Overrides the models of the eval file
+	Limit   int      // Evaluates only the first rows of the dataset
+	Verbose bool
+
+	// OnCase is called after each case is scored
+	OnCase func(run *EvalRun, c *EvalCase)
+}
+
+// EvalRow is a row of an evaluation dataset, by column
+type EvalRow map[string]string
+
+// LoadEvalFile reads an eval file and checks its scorers
+func LoadEvalFile(path string) (*EvalFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file EvalFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid eval file %s: %w", path, err)
+	}
+	if file.Workflow == "" {
+		return nil, fmt.Errorf("eval file %s: workflow is required", path)
+	}
+	if file.Dataset == "" {
+		return nil, fmt.Errorf("eval file %s: dataset is required", path)
+	}
+	if len(file.Scorers) == 0 {
+		return nil, fmt.Errorf("eval file %s: no scorers defined", path)
+	}
+	if file.Expected == "" {
+		file.Expected = defaultExpectedColumn
+	}
+	if file.Output == "" {
+		file.Output = "STDOUT"
+	}
+	if file.Output != "STDOUT" && !strings.HasPrefix(file.Output, "$") {
+		return nil, fmt.Errorf("eval file %s: output must be STDOUT or a variable such as $answer, got '%s'", path, file.Output)
+	}
+
+	names := make(map[string]bool)
+	for i := range file.Scorers {
+		scorer := &file.Scorers[i]
+		if err := scorer.validate(); err != nil {
+			return nil, fmt.Errorf("eval file %s: scorer %d: %w", path, i+1, err)
+		}
+		if names[scorer.Name] {
+			return nil, fmt.Errorf("eval file %s: duplicate scorer name '%s'", path, scorer.Name)
+		}
+		names[scorer.Name] = true
+	}
+
+	file.Path = path
+	if file.dir, err = filepath.Abs(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// LoadDataset reads the rows of a CSV file with a header row or of a JSONL
+// file with one object per line. JSON values other than strings are kept in
+// their JSON form.
+func LoadDataset(path string) ([]EvalRow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rows []EvalRow
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid dataset %s: %w", path, err)
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("dataset %s has no header row", path)
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			row := make(EvalRow, len(header))
+			for i, column := range header {
+				row[column] = record[i]
+			}
+			rows = append(rows, row)
+		}
+	case ".jsonl", ".ndjson":
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var object map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(text), &object); err != nil {
+				return nil, fmt.Errorf("invalid dataset %s, line %d: %w", path, line, err)
+			}
+			row := make(EvalRow, len(object))
+			for column, raw := range object {
+				var value string
+				if json.Unmarshal(raw, &value) != nil {
+					value = string(raw)
+				}
+				row[column] = value
+			}
+			rows = append(rows, row)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported dataset format '%s' (must be .csv or .jsonl)", filepath.Ext(path))
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("dataset %s has no rows", path)
+	}
+	return rows, nil
+}
+
+// Run evaluates the workflow on every row of the dataset, once per model. Runs
+// use the working directory and configuration of the process like comanda
+// process; models.DetectProvider is left alone, so requests reach the providers.
+func (f *EvalFile) Run(envConfig *config.EnvConfig, opts EvalOptions) (*EvalReport, error) {
+	workflowData, err := os.ReadFile(resolveTestPath(f.dir, f.Workflow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow: %w", err)
+	}
+	var dslConfig DSLConfig
+	if err := yaml.Unmarshal(workflowData, &dslConfig); err != nil {
+		return nil, fmt.Errorf("invalid workflow: %w", err)
+	}
+	rows, err := LoadDataset(resolveTestPath(f.dir, f.Dataset))
+	if err != nil {
+		return nil, err
+	}
+	if opts.Limit > 0 && opts.Limit < len(rows) {
+		rows = rows[:opts.Limit]
+	}
+
+	modelNames := opts.Models
+	if len(modelNames) == 0 {
+		modelNames = f.Models
+	}
+	if len(modelNames) == 0 {
+		// A single run with the models of the workflow
+		modelNames = []string{""}
+	}
+
+	if !opts.Verbose {
+		logOutput := log.Writer()
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(logOutput)
+	}
+
+	report := &EvalReport{
+		Workflow: f.Workflow,
+		Dataset:  f.Dataset,
+		Started:  time.Now().UTC().Truncate(time.Second),
+	}
+	for _, scorer := range f.Scorers {
+		report.Scorers = append(report.Scorers, scorer.Name)
+	}
+	scoring := &evalScoring{proc: NewProcessor(&DSLConfig{}, envConfig, nil, opts.Verbose)}
+
+	for _, modelName := range modelNames {
+		run := &EvalRun{Model: modelName}
+		if run.Model == "" {
+			run.Model = workflowModelsLabel
+		}
+		for i, row := range rows {
+			c := f.runCase(workflowData, modelName, envConfig, row, opts.Verbose)
+			c.Row = i + 1
+			if c.Error == "" {
+				f.score(scoring, row, c)
+			}
+			run.Cases = append(run.Cases, c)
+			if opts.OnCase != nil {
+				opts.OnCase(run, c)
+			}
+		}
+		run.aggregate(report.Scorers)
+		report.Runs = append(report.Runs, run)
+	}
+	return report, nil
+}
+
+// workflowModelsLabel names the run with the workflow's own models
+const workflowModelsLabel = "workflow"
+
+// runCase runs the workflow on a row of the dataset
+func (f *EvalFile) runCase(workflowData []byte, modelName string, envConfig *config.EnvConfig, row EvalRow, verbose bool) *EvalCase {
+	c := &EvalCase{Input: f.rowInput(row), Expected: row[f.Expected], Scores: make(map[string]float64)}
+	start := time.Now()
+	defer func() { c.Duration = time.Since(start) }()
+
+	// Each case parses the workflow anew, since processing may change the steps
+	var dslConfig DSLConfig
+	if err := yaml.Unmarshal(workflowData, &dslConfig); err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	if modelName != "" {
+		setWorkflowModel(&dslConfig, modelName)
+	}
+
+	proc := NewProcessor(&dslConfig, envConfig, nil, verbose)
+	stdout := &stdoutRecorder{}
+	proc.SetProgressWriter(stdout)
+	if err := proc.SetParams(f.rowParams(&dslConfig, row)); err != nil {
+		c.Error = fmt.Sprintf("invalid params: %v", err)
+		return c
+	}
+	if f.Input != "" {
+		proc.SetLastOutput(row[f.Input])
+	}
+	if err := proc.Process(); err != nil {
+		c.Error = err.Error()
+		return c
+	}
+
+	if f.Output == "STDOUT" {
+		c.Output = strings.TrimSuffix(stdout.String(), "\n")
+		return c
+	}
+	name := strings.TrimPrefix(f.Output, "$")
+	value, ok := proc.Variables()[name]
+	if !ok {
+		c.Error = fmt.Sprintf("the workflow did not set variable %s", name)
+	}
+	c.Output = value
+	return c
+}
+
+// rowInput describes the input of a case for reports and judges: the input
+// column, or the other columns of the row
+func (f *EvalFile) rowInput(row EvalRow) string {
+	if f.Input != "" {
+		return row[f.Input]
+	}
+	var lines []string
+	for _, column := range sortedKeys(row) {
+		if column != f.Expected {
+			lines = append(lines, column+": "+row[column])
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rowParams returns the params of a case: the params of the eval file and the
+// columns of the row named like params of the workflow. Without a workflow
+// block, every column other than the input and expected ones is a param.
+func (f *EvalFile) rowParams(dslConfig *DSLConfig, row EvalRow) map[string]string {
+	params := make(map[string]string, len(f.Params)+len(row))
+	for name, value := range f.Params {
+		params[name] = value
+	}
+	for column, value := range row {
+		if column == f.Input || column == f.Expected {
+			continue
+		}
+		if dslConfig.Workflow != nil && len(dslConfig.Workflow.Params) > 0 {
+			if _, ok := dslConfig.Workflow.Params[column]; !ok {
+				continue
+			}
+		}
+		params[column] = value
+	}
+	return params
+}
+
+// score applies the scorers to the output of a case. Scorers that need an
+// expected value skip rows without one, and failing scorers leave a note
+// instead of a score.
+func (f *EvalFile) score(scoring *evalScoring, row EvalRow, c *EvalCase) {
+	for _, scorer := range f.Scorers {
+		expected := c.Expected
+		if scorer.Expected != "" {
+			expected = row[scorer.Expected]
+		}
+		score, note, err := scoring.score(scorer, c, expected)
+		switch {
+		case err != nil:
+			c.setNote(scorer.Name, "error: "+err.Error())
+		case score != nil:
+			c.Scores[scorer.Name] = *score
+			if note != "" {
+				c.setNote(scorer.Name, note)
+			}
+		}
+	}
+}
+
+// setWorkflowModel replaces the model of every step that prompts a model.
+// Embedding and image generation steps, generate steps and sub-workflows keep
+// their models.
+func setWorkflowModel(dslConfig *DSLConfig, modelName string) {
+	set := func(stepConfig *StepConfig) {
+		if stepConfig.Type != "" && stepConfig.Type != "openai-responses" {
+			return
+		}
+		if stepConfig.Generate != nil || stepConfig.Process != nil {
+			return
+		}
+		names := (&Processor{}).NormalizeStringSlice(stepConfig.Model)
+		if len(names) == 0 || names[0] == "NA" {
+			return
+		}
+		stepConfig.Model = modelName
+	}
+	for i := range dslConfig.Steps {
+		set(&dslConfig.Steps[i].Config)
+	}
+	for _, steps := range dslConfig.ParallelSteps {
+		for i := range steps {
+			set(&steps[i].Config)
+		}
+	}
+	for name, stepConfig := range dslConfig.Defer {
+		set(&stepConfig)
+		dslConfig.Defer[name] = stepConfig
+	}
+}
@@ -0,0 +1,270 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// EvalReport holds the scored runs of an evaluation, one per model
+type EvalReport struct {
+	Workflow string     `json:"workflow"`
+	Dataset  string     `json:"dataset"`
+	Started  time.Time  `json:"started"`
+	Scorers  []string   `json:"scorers"`
+	Runs     []*EvalRun `json:"runs"`
+
+	Baseline string `json:"baseline,omitempty"` // Report the runs are compared with
+}
+
+// EvalRun is the evaluation of one model over the dataset
+type EvalRun struct {
+	Model        string             `json:"model"`
+	Score        float64            `json:"score"`  // Mean of the scorer means
+	Scores       map[string]float64 `json:"scores"` // Mean score by scorer
+	Errors       int                `json:"errors"` // Cases whose workflow failed
+	MeanDuration time.Duration      `json:"mean_duration_ns"`
+	Cases        []*EvalCase        `json:"cases"`
+
+	// Scores of the same model in the baseline report, if it has them
+	BaselineScore  *float64           `json:"baseline_score,omitempty"`
+	BaselineScores map[string]float64 `json:"baseline_scores,omitempty"`
+}
+
+// EvalCase is the output and scores of the workflow on a row of the dataset
+type EvalCase struct {
+	Row      int                `json:"row"`
+	Input    string             `json:"input,omitempty"`
+	Expected string             `json:"expected,omitempty"`
+	Output   string             `json:"output"`
+	Error    string             `json:"error,omitempty"`
+	Scores   map[string]float64 `json:"scores"`
+	Notes    map[string]string  `json:"notes,omitempty"` // Explanations by scorer, e.g. the judge's reason
+	Duration time.Duration      `json:"duration_ns"`
+}
+
+func (c *EvalCase) setNote(scorer, note string) {
+	if c.Notes == nil {
+		c.Notes = make(map[string]string)
+	}
+	c.Notes[scorer] = note
+}
+
+// aggregate computes the mean scores of the run. Cases whose workflow failed
+// score 0 with every scorer; scorers that did not apply to a case are left out
+// of its means.
+func (r *EvalRun) aggregate(scorers []string) {
+	r.Scores = make(map[string]float64)
+	r.Errors = 0
+	var total time.Duration
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, c := range r.Cases {
+		total += c.Duration
+		if c.Error != "" {
+			r.Errors++
+			for _, scorer := range scorers {
+				counts[scorer]++
+			}
+			continue
+		}
+		for scorer, score := range c.Scores {
+			sums[scorer] += score
+			counts[scorer]++
+		}
+	}
+	if len(r.Cases) > 0 {
+		r.MeanDuration = total / time.Duration(len(r.Cases))
+	}
+
+	r.Score = 0
+	scored := 0
+	for _, scorer := range scorers {
+		if counts[scorer] == 0 {
+			continue
+		}
+		r.Scores[scorer] = sums[scorer] / float64(counts[scorer])
+		r.Score += r.Scores[scorer]
+		scored++
+	}
+	if scored > 0 {
+		r.Score /= float64(scored)
+	}
+}
+
+// LoadEvalReport reads a JSON report written by WriteReport
+func LoadEvalReport(path string) (*EvalReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report EvalReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid eval report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// SetBaseline compares the runs with the runs of the same models in an
+// earlier report
+func (r *EvalReport) SetBaseline(path string, baseline *EvalReport) {
+	r.Baseline = path
+	for _, run := range r.Runs {
+		for _, previous := range baseline.Runs {
+			if previous.Model != run.Model {
+				continue
+			}
+			score := previous.Score
+			run.BaselineScore = &score
+			run.BaselineScores = previous.Scores
+		}
+	}
+}
+
+// WriteSummary writes a table of the mean scores of each model
+func (r *EvalReport) WriteSummary(w io.Writer) {
+	out := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(out, "MODEL\t%s\tSCORE\tERRORS\tMEAN TIME\n", strings.ToUpper(strings.Join(r.Scorers, "\t")))
+	for _, run := range r.Runs {
+		fmt.Fprintf(out, "%s", run.Model)
+		for _, scorer := range r.Scorers {
+			fmt.Fprintf(out, "\t%s", run.scoreText(scorer))
+		}
+		fmt.Fprintf(out, "\t%s\t%d/%d\t%s\n", run.scoreText(""), run.Errors, len(run.Cases), run.MeanDuration.Round(10*time.Millisecond))
+	}
+	out.Flush()
+	if r.Baseline != "" {
+		fmt.Fprintf(w, "Changes in parentheses are against %s\n", r.Baseline)
+	}
+}
+
+// scoreText formats the mean score of a scorer, or the overall score for "",
+// with the change against the baseline
+func (r *EvalRun) scoreText(scorer string) string {
+	score, ok := r.Score, true
+	baseline, hasBaseline := 0.0, r.BaselineScore != nil
+	if scorer != "" {
+		score, ok = r.Scores[scorer]
+		baseline, hasBaseline = r.BaselineScores[scorer]
+	} else if hasBaseline {
+		baseline = *r.BaselineScore
+	}
+	if !ok {
+		return "-"
+	}
+	text := fmt.Sprintf("%.2f", score)
+	if hasBaseline {
+		text += fmt.Sprintf(" (%+.2f)", score-baseline)
+	}
+	return text
+}
+
+// WriteReport writes the report as JSON or HTML, chosen by the extension of
+// the path
+func (r *EvalReport) WriteReport(path string) error {
+	var data []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var err error
+		if data, err = json.MarshalIndent(r, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	case ".html", ".htm":
+		var html strings.Builder
+		if err := r.WriteHTML(&html); err != nil {
+			return err
+		}
+		data = []byte(html.String())
+	default:
+		return fmt.Errorf("unsupported report format '%s' (must be .json or .html)", filepath.Ext(path))
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// WriteHTML writes the report as a standalone HTML page comparing the models
+// side by side, case by case
+func (r *EvalReport) WriteHTML(w io.Writer) error {
+	rows := 0
+	for _, run := range r.Runs {
+		rows = max(rows, len(run.Cases))
+	}
+	var cases [][]*EvalCase
+	for i := 0; i < rows; i++ {
+		row := make([]*EvalCase, len(r.Runs))
+		for j, run := range r.Runs {
+			if i < len(run.Cases) {
+				row[j] = run.Cases[i]
+			}
+		}
+		cases = append(cases, row)
+	}
+	return evalHTML.Execute(w, struct {
+		*EvalReport
+		Cases [][]*EvalCase
+	}{r, cases})
+}
+
+var evalHTML = template.Must(template.New("eval").Funcs(template.FuncMap{
+	"score": func(run *EvalRun, scorer string) string { return run.scoreText(scorer) },
+	"caseScore": func(c *EvalCase, scorer string) string {
+		if score, ok := c.Scores[scorer]; ok {
+			return fmt.Sprintf("%.2f", score)
+		}
+		return "-"
+	},
+	"seconds": func(d time.Duration) string {
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>comanda eval: {{.Workflow}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.4em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+pre { white-space: pre-wrap; margin: 0; max-width: 40em; }
+.error { color: #b00; }
+.note { color: #555; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>{{.Workflow}}</h1>
+<p>Dataset {{.Dataset}}, run {{.Started.Format "2006-01-02 15:04:05 UTC"}}{{if .Baseline}}, compared with {{.Baseline}}{{end}}</p>
+<table>
+<tr><th>Model</th>{{range .Scorers}}<th>{{.}}</th>{{end}}<th>Score</th><th>Errors</th><th>Mean time</th></tr>
+{{- range $run := .Runs}}
+<tr><td>{{$run.Model}}</td>{{range $.Scorers}}<td>{{score $run .}}</td>{{end}}<td><b>{{score $run ""}}</b></td><td>{{$run.Errors}}/{{len $run.Cases}}</td><td>{{seconds $run.MeanDuration}}</td></tr>
+{{- end}}
+</table>
+<table>
+<tr><th>Row</th><th>Input</th><th>Expected</th>{{range .Runs}}<th>{{.Model}}</th>{{end}}</tr>
+{{- range $row := .Cases}}
+{{- with index $row 0}}
+<tr><td>{{.Row}}</td><td><pre>{{.Input}}</pre></td><td><pre>{{.Expected}}</pre></td>
+{{- end}}
+{{- range $row}}
+<td>{{if .}}{{if .Error}}<div class="error">{{.Error}}</div>{{else}}<pre>{{.Output}}</pre>{{end}}
+{{- $c := .}}
+<div class="note">{{range $.Scorers}}{{.}}: {{caseScore $c .}}{{with index $c.Notes .}} ({{.}}){{end}}<br>{{end}}{{seconds .Duration}}</div>{{end}}</td>
+{{- end}}
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,297 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/vectorindex"
+)
+
+// Scorer types
+const (
+	ScorerExact      = "exact"      // The output equals the expected value
+	ScorerRegex      = "regex"      // The output matches a pattern
+	ScorerJSONField  = "json_field" // A field of the JSON output equals the expected value
+	ScorerSimilarity = "similarity" // Cosine similarity of the embeddings of output and expected value
+	ScorerJudge      = "judge"      // A judge model grades the output against a rubric
+)
+
+// defaultJudgeScale is the highest grade a judge model gives
+const defaultJudgeScale = 5
+
+// EvalScorer scores the outputs of an evaluation between 0 and 1
+type EvalScorer struct {
+	Name       string `yaml:"name"`        // Label in reports, the type by default
+	Type       string `yaml:"type"`        // exact, regex, json_field, similarity or judge
+	Expected   string `yaml:"expected"`    // Column with the expected value, instead of the eval's
+	IgnoreCase bool   `yaml:"ignore_case"` // exact and json_field: compare case-insensitively
+	Pattern    string `yaml:"pattern"`     // regex: pattern, the expected value by default
+	Field      string `yaml:"field"`       // json_field: dotted path such as result.label or items.0
+	Model      string `yaml:"model"`       // similarity: embedding model; judge: judge model
+	Rubric     string `yaml:"rubric"`      // judge: what makes a good output
+	Scale      int    `yaml:"scale"`       // judge: highest grade, 5 by default
+
+	pattern *regexp.Regexp
+}
+
+// validate checks the options of the scorer and fills in defaults
+func (s *EvalScorer) validate() error {
+	if s.Name == "" {
+		s.Name = s.Type
+	}
+	switch s.Type {
+	case ScorerExact:
+	case ScorerRegex:
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern: %w", err)
+			}
+			s.pattern = re
+		}
+	case ScorerJSONField:
+		if s.Field == "" {
+			return fmt.Errorf("json_field scorer requires a field")
+		}
+	case ScorerSimilarity:
+		if s.Model == "" {
+			return fmt.Errorf("similarity scorer requires an embedding model")
+		}
+	case ScorerJudge:
+		if s.Model == "" {
+			return fmt.Errorf("judge scorer requires a model")
+		}
+		if s.Rubric == "" {
+			return fmt.Errorf("judge scorer requires a rubric")
+		}
+		if s.Scale == 0 {
+			s.Scale = defaultJudgeScale
+		}
+		if s.Scale < 1 {
+			return fmt.Errorf("judge scale must be positive, got %d", s.Scale)
+		}
+	case "":
+		return fmt.Errorf("type is required (exact, regex, json_field, similarity or judge)")
+	default:
+		return fmt.Errorf("unknown type '%s' (must be exact, regex, json_field, similarity or judge)", s.Type)
+	}
+	return nil
+}
+
+// evalScoring applies scorers, configuring the embedding and judge models
+// like the steps of a workflow
+type evalScoring struct {
+	proc *Processor
+}
+
+// score returns the score of an output and a note explaining it. The score is
+// nil when the scorer does not apply, e.g. without an expected value.
+func (e *evalScoring) score(scorer EvalScorer, c *EvalCase, expected string) (*float64, string, error) {
+	output := strings.TrimSpace(c.Output)
+	expected = strings.TrimSpace(expected)
+
+	switch scorer.Type {
+	case ScorerExact:
+		if expected == "" {
+			return nil, "", nil
+		}
+		return boolScore(equalText(output, expected, scorer.IgnoreCase))
+
+	case ScorerRegex:
+		re := scorer.pattern
+		if re == nil {
+			if expected == "" {
+				return nil, "", nil
+			}
+			var err error
+			if re, err = regexp.Compile(expected); err != nil {
+				return nil, "", fmt.Errorf("invalid expected pattern: %w", err)
+			}
+		}
+		return boolScore(re.MatchString(output))
+
+	case ScorerJSONField:
+		value, err := jsonField(output, scorer.Field)
+		if err != nil {
+			return floatPtr(0), err.Error(), nil
+		}
+		if expected == "" {
+			// Without an expected value, the field only has to exist
+			return floatPtr(1), "", nil
+		}
+		if !equalText(value, expected, scorer.IgnoreCase) {
+			return floatPtr(0), fmt.Sprintf("%s is %s", scorer.Field, value), nil
+		}
+		return floatPtr(1), "", nil
+
+	case ScorerSimilarity:
+		if expected == "" {
+			return nil, "", nil
+		}
+		similarity, err := e.similarity(scorer.Model, output, expected)
+		if err != nil {
+			return nil, "", err
+		}
+		return floatPtr(similarity), "", nil
+
+	case ScorerJudge:
+		return e.judge(scorer, c.Input, expected, output)
+	}
+	return nil, "", fmt.Errorf("unknown scorer type '%s'", scorer.Type)
+}
+
+// similarity returns the cosine similarity of the embeddings of two texts,
+// with negative similarities scored 0
+func (e *evalScoring) similarity(modelName, a, b string) (float64, error) {
+	modelName, providerName, err := e.proc.splitStepModel(modelName, "")
+	if err != nil {
+		return 0, err
+	}
+	embedder := models.DetectEmbedder(modelName, providerName)
+	if embedder == nil {
+		return 0, fmt.Errorf("no embedding backend found for model %s", modelName)
+	}
+	if err := e.proc.configureStandaloneProvider(embedder); err != nil {
+		return 0, err
+	}
+	vectors, err := embedder.Embed(modelName, []string{a, b})
+	if err != nil {
+		return 0, fmt.Errorf("failed to embed output: %w", err)
+	}
+	if len(vectors) != 2 {
+		return 0, fmt.Errorf("expected 2 embeddings, got %d", len(vectors))
+	}
+	return math.Max(0, vectorindex.CosineSimilarity(vectors[0], vectors[1])), nil
+}
+
+// judgePrompt asks a judge model for a grade on its first line
+const judgePrompt = `You are grading the output of an AI workflow.
+
+Rubric:
+%s
+
+Input:
+%s
+
+Expected output:
+%s
+
+Actual output:
+%s
+
+Grade the actual output against the rubric. Reply with an integer grade from 0 to %d on the first line, followed by a one-sentence reason.`
+
+// judgeGrade finds the grade at the start of a judge's reply
+var judgeGrade = regexp.MustCompile(`^\D*?(\d+(?:\.\d+)?)`)
+
+// judge asks the judge model to grade an output; the grade is scaled to 0-1
+// and the reason is kept as the note
+func (e *evalScoring) judge(scorer EvalScorer, input, expected, output string) (*float64, string, error) {
+	provider := e.proc.detectProvider(scorer.Model)
+	if provider == nil {
+		return nil, "", fmt.Errorf("no provider found for judge model %s", scorer.Model)
+	}
+	if err := e.proc.configureStandaloneProvider(provider); err != nil {
+		return nil, "", err
+	}
+
+	orNone := func(text string) string {
+		if text == "" {
+			return "(none)"
+		}
+		return text
+	}
+	prompt := fmt.Sprintf(judgePrompt, scorer.Rubric, orNone(input), orNone(expected), orNone(output), scorer.Scale)
+	reply, err := provider.SendPrompt(e.proc.bareModelName(scorer.Model), prompt)
+	if err != nil {
+		return nil, "", fmt.Errorf("judge model %s failed: %w", scorer.Model, err)
+	}
+
+	reply = strings.TrimSpace(reply)
+	match := judgeGrade.FindStringSubmatch(reply)
+	if match == nil {
+		return nil, "", fmt.Errorf("judge reply has no grade: %s", firstLine(reply))
+	}
+	grade, _ := strconv.ParseFloat(match[1], 64)
+	score := math.Min(grade/float64(scorer.Scale), 1)
+	// The reason follows the grade line; a single line is kept whole
+	gradeLine, reason, _ := strings.Cut(reply, "\n")
+	note := strings.TrimSpace(reason)
+	if note == "" {
+		note = gradeLine
+	}
+	return &score, note, nil
+}
+
+// jsonField returns a field of the JSON object in an output, which may be
+// wrapped in a Markdown code block. Fields are named by a dotted path, with
+// numbers indexing arrays; values other than strings are returned as JSON.
+func jsonField(output, path string) (string, error) {
+	text := strings.TrimSpace(output)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text[strings.IndexByte(text+"\n", '\n'):], "\n")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return "", fmt.Errorf("output is not JSON")
+	}
+
+	for _, part := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			child, ok := node[part]
+			if !ok {
+				return "", fmt.Errorf("%s is missing", path)
+			}
+			value = child
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", fmt.Errorf("%s is missing", path)
+			}
+			value = node[i]
+		default:
+			return "", fmt.Errorf("%s is missing", path)
+		}
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// equalText compares trimmed texts
+func equalText(a, b string, ignoreCase bool) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if ignoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+func boolScore(ok bool) (*float64, string, error) {
+	if ok {
+		return floatPtr(1), "", nil
+	}
+	return floatPtr(0), "", nil
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+// firstLine returns the first line of a text
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
@@ -0,0 +1,263 @@
+package processor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// scriptModels answers the model requests of the test from mocks
+func scriptModels(t *testing.T, mocks []MockResponse) {
+	t.Helper()
+	script := newScript(mocks, t.TempDir())
+	detect := models.DetectProvider
+	t.Cleanup(func() { models.DetectProvider = detect })
+	models.DetectProvider = func(modelName string) models.Provider {
+		provider := detect(modelName)
+		if provider == nil {
+			return nil
+		}
+		return &scriptedProvider{real: provider, script: script}
+	}
+}
+
+// writeEval writes an eval file with its workflow and dataset and loads it.
+// Runs use the working directory, so the test moves to the file's directory
+// to keep any files the workflow writes out of the package.
+func writeEval(t *testing.T, eval, workflow, datasetName, dataset string) *EvalFile {
+	t.Helper()
+	dir := t.TempDir()
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(oldDir) })
+	writePlanFile(t, dir, "workflow.yaml", workflow)
+	writePlanFile(t, dir, datasetName, dataset)
+	writePlanFile(t, dir, "triage.eval.yaml", eval)
+	file, err := LoadEvalFile(filepath.Join(dir, "triage.eval.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load eval file: %v", err)
+	}
+	return file
+}
+
+func TestEvalRun(t *testing.T) {
+	scriptModels(t, []MockResponse{
+		{Model: "gpt-4o", PromptContains: "You are grading", Responses: []string{"4\nMostly right.", "Grade: 1/5"}},
+		{Model: "gpt-4o-mini", Responses: []string{"billing", "bug"}},
+		{Model: "claude-3-5-haiku-latest", Responses: []string{"Billing", "crash"}},
+	})
+	file := writeEval(t, `
+workflow: workflow.yaml
+dataset: tickets.jsonl
+input: ticket
+expected: label
+models: [gpt-4o-mini, claude-3-5-haiku-latest]
+scorers:
+  - type: exact
+  - name: known label
+    type: regex
+    pattern: "^(bug|billing|feature)$"
+  - type: judge
+    model: gpt-4o
+    rubric: The label fits the ticket
+`, `
+classify:
+  input: STDIN
+  model: gpt-4o
+  action: Label this ticket
+  output: STDOUT
+`, "tickets.jsonl", `{"ticket": "Please refund my order", "label": "billing"}
+
+{"ticket": "The app crashes on start", "label": "bug"}
+`)
+
+	var seen []string
+	report, err := file.Run(createTestEnvConfig(), EvalOptions{OnCase: func(run *EvalRun, c *EvalCase) {
+		seen = append(seen, run.Model)
+	}})
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if len(seen) != 4 || len(report.Runs) != 2 {
+		t.Fatalf("Expected 2 runs of 2 cases, got %v", seen)
+	}
+
+	gpt := report.Runs[0]
+	if gpt.Model != "gpt-4o-mini" || gpt.Cases[0].Output != "billing" || gpt.Cases[1].Output != "bug" {
+		t.Errorf("Expected the steps to use gpt-4o-mini, got %+v", gpt.Cases[0])
+	}
+	if gpt.Scores["exact"] != 1 || gpt.Scores["known label"] != 1 || gpt.Scores["judge"] != 0.5 || gpt.Score != 5.0/6 {
+		t.Errorf("Unexpected scores for gpt-4o-mini: %v (%v)", gpt.Scores, gpt.Score)
+	}
+	if gpt.Cases[0].Notes["judge"] != "Mostly right." || gpt.Cases[1].Scores["judge"] != 0.2 {
+		t.Errorf("Expected the judge grades and reasons, got %+v and %+v", gpt.Cases[0], gpt.Cases[1])
+	}
+
+	claude := report.Runs[1]
+	if claude.Model != "claude-3-5-haiku-latest" || claude.Cases[0].Output != "Billing" {
+		t.Errorf("Expected the steps to use claude-3-5-haiku-latest, got %+v", claude.Cases[0])
+	}
+	if claude.Scores["exact"] != 0 || claude.Scores["known label"] != 0 {
+		t.Errorf("Unexpected scores for claude-3-5-haiku-latest: %v", claude.Scores)
+	}
+}
+
+func TestEvalParamsAndVariables(t *testing.T) {
+	scriptModels(t, []MockResponse{
+		{Step: "announce", Response: "Announced"},
+		{PromptContains: "in French", Response: `{"greeting": {"text": "Bonjour"}}`},
+		{PromptContains: "in Spanish", Error: "overloaded"},
+		{Response: "```json\n{\"greeting\": {\"text\": \"Hello\"}}\n```"},
+	})
+	file := writeEval(t, `
+workflow: workflow.yaml
+dataset: greetings.csv
+output: $greeting
+scorers:
+  - type: json_field
+    field: greeting.text
+    ignore_case: true
+`, `
+workflow:
+  params:
+    language:
+      type: enum
+      values: [English, French, Spanish]
+greet:
+  input: NA
+  model: gpt-4o
+  action: Greet in $language
+  output: STDOUT
+announce:
+  input: STDIN as $greeting
+  model: gpt-4o
+  action: Announce $greeting
+  output: STDOUT
+`, "greetings.csv", "language,expected,note\nFrench,bonjour,formal\nEnglish,Hi,casual\nSpanish,hola,casual\n")
+
+	report, err := file.Run(createTestEnvConfig(), EvalOptions{})
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	run := report.Runs[0]
+	if run.Model != "workflow" || run.Errors != 1 || !strings.Contains(run.Cases[2].Error, "overloaded") {
+		t.Fatalf("Expected a run with the workflow's models and one failed case, got %+v", run)
+	}
+	// The failed case scores 0
+	if run.Scores["json_field"] != 1.0/3 {
+		t.Errorf("Expected a mean score of 1/3, got %v", run.Scores)
+	}
+	if run.Cases[0].Scores["json_field"] != 1 || run.Cases[1].Scores["json_field"] != 0 {
+		t.Errorf("Expected the French greeting to match, got %+v and %+v", run.Cases[0], run.Cases[1])
+	}
+	if run.Cases[1].Notes["json_field"] != "greeting.text is Hello" {
+		t.Errorf("Expected a note with the actual field, got %v", run.Cases[1].Notes)
+	}
+	if run.Cases[0].Input != "language: French\nnote: formal" {
+		t.Errorf("Expected the columns as input, got %q", run.Cases[0].Input)
+	}
+}
+
+func TestEvalSimilarity(t *testing.T) {
+	embedder := &mockEmbedder{MockProvider: *NewMockProvider("openai")}
+	originalDetect := models.DetectEmbedder
+	models.DetectEmbedder = func(modelName string, providerName string) models.EmbeddingProvider {
+		return embedder
+	}
+	defer func() { models.DetectEmbedder = originalDetect }()
+
+	scoring := &evalScoring{proc: NewProcessor(&DSLConfig{}, createTestEnvConfig(), nil, false)}
+	scorer := EvalScorer{Type: ScorerSimilarity, Model: "text-embedding-3-small"}
+	for output, want := range map[string]float64{"a cat": 1, "a dog": 0} {
+		score, _, err := scoring.score(scorer, &EvalCase{Output: output}, "the cat")
+		if err != nil || score == nil || *score != want {
+			t.Errorf("Expected similarity %v for %q, got %v (%v)", want, output, score, err)
+		}
+	}
+	if score, _, _ := scoring.score(scorer, &EvalCase{Output: "a cat"}, ""); score != nil {
+		t.Errorf("Expected no score without an expected value, got %v", *score)
+	}
+}
+
+func TestLoadEvalFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	for content, want := range map[string]string{
+		"dataset: d.csv\nscorers: [{type: exact}]\n":                                    "workflow is required",
+		"workflow: w.yaml\nscorers: [{type: exact}]\n":                                  "dataset is required",
+		"workflow: w.yaml\ndataset: d.csv\n":                                            "no scorers defined",
+		"workflow: w.yaml\ndataset: d.csv\nscorers: [{type: fuzzy}]\n":                  "unknown type 'fuzzy'",
+		"workflow: w.yaml\ndataset: d.csv\nscorers: [{type: judge}]\n":                  "judge scorer requires a model",
+		"workflow: w.yaml\ndataset: d.csv\nscorers: [{type: json_field}]\n":             "requires a field",
+		"workflow: w.yaml\ndataset: d.csv\nscorers: [{type: exact}, {type: exact}]\n":   "duplicate scorer name 'exact'",
+		"workflow: w.yaml\ndataset: d.csv\noutput: out.txt\nscorers: [{type: exact}]\n": "output must be STDOUT or a variable",
+	} {
+		writePlanFile(t, dir, "e.eval.yaml", content)
+		if _, err := LoadEvalFile(filepath.Join(dir, "e.eval.yaml")); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected an error containing %q for:\n%s\ngot %v", want, content, err)
+		}
+	}
+
+	writePlanFile(t, dir, "d.txt", "a\n")
+	writePlanFile(t, dir, "empty.csv", "question,expected\n")
+	writePlanFile(t, dir, "bad.jsonl", "{\"a\": 1}\nnot json\n")
+	for name, want := range map[string]string{
+		"d.txt":     "unsupported dataset format '.txt'",
+		"empty.csv": "has no rows",
+		"bad.jsonl": "line 2",
+	} {
+		if _, err := LoadDataset(filepath.Join(dir, name)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, want, err)
+		}
+	}
+}
+
+func TestEvalReport(t *testing.T) {
+	run := &EvalRun{Model: "gpt-4o", Cases: []*EvalCase{
+		{Row: 1, Input: "<ticket>", Output: "bug", Scores: map[string]float64{"exact": 1}},
+		{Row: 2, Error: "timeout", Scores: map[string]float64{}},
+	}}
+	run.aggregate([]string{"exact"})
+	report := &EvalReport{Workflow: "triage.yaml", Dataset: "tickets.jsonl", Scorers: []string{"exact"}, Runs: []*EvalRun{run}}
+
+	dir := t.TempDir()
+	baselinePath := filepath.Join(dir, "reports", "last.json")
+	if err := report.WriteReport(baselinePath); err != nil {
+		t.Fatalf("Failed to write JSON report: %v", err)
+	}
+	baseline, err := LoadEvalReport(baselinePath)
+	if err != nil || len(baseline.Runs) != 1 || baseline.Runs[0].Score != 0.5 {
+		t.Fatalf("Expected the report to round-trip, got %+v (%v)", baseline, err)
+	}
+
+	baseline.Runs[0].Score = 0.25
+	baseline.Runs[0].Scores["exact"] = 0.25
+	report.SetBaseline("last.json", baseline)
+	var summary bytes.Buffer
+	report.WriteSummary(&summary)
+	if !strings.Contains(summary.String(), "0.50 (+0.25)") || !strings.Contains(summary.String(), "1/2") {
+		t.Errorf("Expected the summary to show the change and errors, got:\n%s", summary.String())
+	}
+
+	htmlPath := filepath.Join(dir, "report.html")
+	if err := report.WriteReport(htmlPath); err != nil {
+		t.Fatalf("Failed to write HTML report: %v", err)
+	}
+	html, _ := os.ReadFile(htmlPath)
+	for _, want := range []string{"&lt;ticket&gt;", "timeout", "compared with last.json", "exact: 1.00"} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("Expected the HTML report to contain %q", want)
+		}
+	}
+	if err := report.WriteReport(filepath.Join(dir, "report.txt")); err == nil {
+		t.Error("Expected an unsupported report format to fail")
+	}
+}
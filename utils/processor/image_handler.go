@@ -0,0 +1,215 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// isImageGenerationStep reports whether a step produces images rather than text
+func isImageGenerationStep(config StepConfig) bool {
+	return config.Type == "image-generation"
+}
+
+// imageOutputPath expands the {{ image_index }} placeholder in an output path.
+// When several images are generated and the path has no placeholder, the index
+// is appended to the file name so that images do not overwrite each other.
+func imageOutputPath(output string, index int, total int) string {
+	if strings.Contains(output, "{{ image_index }}") || strings.Contains(output, "{{image_index}}") {
+		output = strings.ReplaceAll(output, "{{ image_index }}", fmt.Sprintf("%d", index))
+		return strings.ReplaceAll(output, "{{image_index}}", fmt.Sprintf("%d", index))
+	}
+	if total <= 1 {
+		return output
+	}
+	ext := filepath.Ext(output)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(output, ext), index, ext)
+}
+
+// imageFormatForPath picks the output encoding from the configured format or the file extension
+func imageFormatForPath(path string, format string) string {
+	switch strings.ToLower(format) {
+	case "jpg", "jpeg":
+		return "jpeg"
+	case "png":
+		return "png"
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return "jpeg"
+	case ".png":
+		return "png"
+	}
+	return ""
+}
+
+// encodeImage re-encodes image data as PNG or JPEG when it is not already in that format
+func encodeImage(generated models.GeneratedImage, format string) ([]byte, error) {
+	if format == "" || generated.MimeType == "image/"+format {
+		return generated.Data, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(generated.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode generated image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	case "png":
+		err = png.Encode(&buf, img)
+	default:
+		return nil, fmt.Errorf("unsupported image format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image as %s: %w", format, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// processImageGenerationStep handles the image-generation step type. The step's
+// action is the image prompt; any text inputs are appended to it as context.
+// Generated images are written to the file outputs, and the list of written
+// paths becomes the step's output for STDOUT, MEMORY and the next step.
+func (p *Processor) processImageGenerationStep(step Step, isParallel bool, parallelID string) (string, error) {
+	p.debugf("Processing image-generation step: %s", step.Name)
+	startTime := time.Now()
+	metrics := &PerformanceMetrics{}
+
+	modelNames := p.NormalizeStringSlice(step.Config.Model)
+	if len(modelNames) == 0 || modelNames[0] == "NA" {
+		return "", fmt.Errorf("image-generation step requires an image model")
+	}
+	modelName := modelNames[0]
+
+	actions := p.NormalizeStringSlice(step.Config.Action)
+	stepInfo := &StepInfo{Name: step.Name, Model: modelName, Action: strings.Join(actions, "\n")}
+	p.sendProgressUpdate(ProgressUpdate{
+		Type:       ProgressStep,
+		Message:    fmt.Sprintf("Starting image generation step: %s", step.Name),
+		Step:       stepInfo,
+		IsParallel: isParallel,
+		ParallelID: parallelID,
+	})
+
+	cfg := ImageConfig{}
+	if step.Config.Image != nil {
+		cfg = *step.Config.Image
+	}
+	if cfg.Count < 1 {
+		cfg.Count = 1
+	}
+
+	// Gather text context from the inputs
+	inputStartTime := time.Now()
+	textInputs, err := p.gatherTextInputs(step)
+	if err != nil {
+		return "", err
+	}
+	var contextParts []string
+	for _, textInput := range textInputs {
+		contextParts = append(contextParts, textInput.Text)
+	}
+	metrics.InputProcessingTime = time.Since(inputStartTime).Milliseconds()
+
+	if len(actions) == 0 {
+		return "", fmt.Errorf("image-generation step requires an action describing the image")
+	}
+	prompt := p.substituteVariables(strings.Join(actions, "\n"))
+	if len(contextParts) > 0 {
+		prompt += "\n\n" + strings.Join(contextParts, "\n\n")
+	}
+
+	modelStartTime := time.Now()
+	modelName, providerName, err := p.splitStepModel(modelName, cfg.Provider)
+	if err != nil {
+		return "", err
+	}
+	generator := models.DetectImageGenerator(modelName, providerName)
+	if generator == nil {
+		return "", fmt.Errorf("no image generation backend found for model %s (set image.provider to openai, google or stable-diffusion)", modelName)
+	}
+	if err := p.configureStandaloneProvider(generator); err != nil {
+		return "", err
+	}
+	metrics.ModelProcessingTime = time.Since(modelStartTime).Milliseconds()
+
+	p.sendProgressUpdate(ProgressUpdate{
+		Type:       ProgressStep,
+		Message:    fmt.Sprintf("Generating %d image(s) with %s", cfg.Count, modelName),
+		Step:       stepInfo,
+		IsParallel: isParallel,
+		ParallelID: parallelID,
+	})
+
+	actionStartTime := time.Now()
+	images, err := generator.GenerateImage(modelName, prompt, models.ImageOptions{
+		Size:    cfg.Size,
+		Quality: cfg.Quality,
+		Count:   cfg.Count,
+	})
+	if err != nil {
+		return "", fmt.Errorf("image generation failed for step %s: %w", step.Name, err)
+	}
+	metrics.ActionProcessingTime = time.Since(actionStartTime).Milliseconds()
+
+	// Write the images to every file output; other outputs receive the list of paths
+	outputStartTime := time.Now()
+	outputs := p.NormalizeStringSlice(step.Config.Output)
+	var written []string
+	var otherOutputs []string
+	for _, output := range outputs {
+		if output == "STDOUT" || output == "MEMORY" || strings.HasPrefix(output, "MEMORY:") {
+			otherOutputs = append(otherOutputs, output)
+			continue
+		}
+		// Variables such as $name are expanded before the image index
+		output = p.substituteVariables(output)
+		for i, generated := range images {
+			outputPath := imageOutputPath(output, i, len(images))
+			data, err := encodeImage(generated, imageFormatForPath(outputPath, cfg.Format))
+			if err != nil {
+				return "", err
+			}
+			resolvedPath, err := p.writeOutputFile(outputPath, data)
+			if err != nil {
+				return "", err
+			}
+			written = append(written, resolvedPath)
+			log.Printf("\nImage written to file: %s\n", resolvedPath)
+		}
+	}
+	if len(written) == 0 {
+		return "", fmt.Errorf("image-generation step %s requires at least one file output", step.Name)
+	}
+
+	result := strings.Join(written, "\n")
+	if len(otherOutputs) > 0 {
+		if err := p.handleOutput(modelName, result, otherOutputs, metrics); err != nil {
+			return "", fmt.Errorf("output handling error: %w", err)
+		}
+	}
+	metrics.OutputProcessingTime = time.Since(outputStartTime).Milliseconds()
+	metrics.TotalProcessingTime = time.Since(startTime).Milliseconds()
+
+	p.sendProgressUpdate(ProgressUpdate{
+		Type:               ProgressComplete,
+		Message:            fmt.Sprintf("Completed image generation step: %s", step.Name),
+		Step:               stepInfo,
+		IsParallel:         isParallel,
+		ParallelID:         parallelID,
+		PerformanceMetrics: metrics,
+	})
+
+	return result, nil
+}
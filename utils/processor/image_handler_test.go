@@ -0,0 +1,163 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// mockImageGenerator implements models.ImageGenerationProvider for testing
+type mockImageGenerator struct {
+	MockProvider
+	prompt string
+	opts   models.ImageOptions
+}
+
+func (m *mockImageGenerator) GenerateImage(modelName string, prompt string, opts models.ImageOptions) ([]models.GeneratedImage, error) {
+	m.prompt = prompt
+	m.opts = opts
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	var images []models.GeneratedImage
+	for i := 0; i < opts.Count; i++ {
+		images = append(images, models.GeneratedImage{Data: buf.Bytes(), MimeType: "image/png"})
+	}
+	return images, nil
+}
+
+func TestImageOutputPath(t *testing.T) {
+	tests := []struct {
+		output   string
+		index    int
+		total    int
+		expected string
+	}{
+		{"logo.png", 0, 1, "logo.png"},
+		{"logo.png", 1, 3, "logo-1.png"},
+		{"logo_{{ image_index }}.png", 2, 3, "logo_2.png"},
+		{"logo_{{image_index}}.jpg", 0, 1, "logo_0.jpg"},
+	}
+
+	for _, tt := range tests {
+		if got := imageOutputPath(tt.output, tt.index, tt.total); got != tt.expected {
+			t.Errorf("imageOutputPath(%q, %d, %d) = %q, want %q", tt.output, tt.index, tt.total, got, tt.expected)
+		}
+	}
+}
+
+func TestProcessImageGenerationStep(t *testing.T) {
+	generator := &mockImageGenerator{MockProvider: *NewMockProvider("openai")}
+	originalDetect := models.DetectImageGenerator
+	models.DetectImageGenerator = func(modelName string, providerName string) models.ImageGenerationProvider {
+		return generator
+	}
+	defer func() { models.DetectImageGenerator = originalDetect }()
+
+	outputDir := t.TempDir()
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, "")
+	processor.SetLastOutput("A red fox in the snow")
+
+	step := Step{
+		Name: "illustrate",
+		Config: StepConfig{
+			Type:   "image-generation",
+			Input:  "STDIN",
+			Model:  "gpt-image-1",
+			Action: "Draw this scene as a watercolor:",
+			Output: filepath.Join(outputDir, "scene_{{ image_index }}.jpg"),
+			Image:  &ImageConfig{Size: "1024x1024", Quality: "high", Count: 2},
+		},
+	}
+
+	result, err := processor.processStep(step, false, "")
+	if err != nil {
+		t.Fatalf("processStep returned error: %v", err)
+	}
+
+	if generator.apiKey != "test-openai-key" {
+		t.Errorf("Expected generator to be configured with the openai key, got %q", generator.apiKey)
+	}
+	if !strings.Contains(generator.prompt, "watercolor") || !strings.Contains(generator.prompt, "A red fox in the snow") {
+		t.Errorf("Expected prompt to contain the action and STDIN context, got %q", generator.prompt)
+	}
+	if generator.opts.Size != "1024x1024" || generator.opts.Quality != "high" || generator.opts.Count != 2 {
+		t.Errorf("Unexpected image options: %+v", generator.opts)
+	}
+
+	paths := strings.Split(result, "\n")
+	if len(paths) != 2 {
+		t.Fatalf("Expected 2 image paths, got %q", result)
+	}
+	for i, path := range paths {
+		if filepath.Base(path) != []string{"scene_0.jpg", "scene_1.jpg"}[i] {
+			t.Errorf("Unexpected image path: %s", path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read generated image: %v", err)
+		}
+		// The PNG from the backend is re-encoded to match the .jpg extension
+		if mimeType := http.DetectContentType(data); mimeType != "image/jpeg" {
+			t.Errorf("Expected image/jpeg output, got %s", mimeType)
+		}
+	}
+}
+
+func TestImageGenerationStepVariablesAndInputs(t *testing.T) {
+	generator := &mockImageGenerator{MockProvider: *NewMockProvider("openai")}
+	originalDetect := models.DetectImageGenerator
+	models.DetectImageGenerator = func(modelName string, providerName string) models.ImageGenerationProvider {
+		return generator
+	}
+	defer func() { models.DetectImageGenerator = originalDetect }()
+
+	outputDir := t.TempDir()
+	previousInput := filepath.Join(outputDir, "previous.txt")
+	if err := os.WriteFile(previousInput, []byte("Input of the previous step"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, "")
+	processor.variables["subject"] = "fox"
+	// Inputs left over from a previous step are not part of the prompt
+	if err := processor.processInputs([]string{previousInput}); err != nil {
+		t.Fatalf("Failed to process input: %v", err)
+	}
+
+	step := Step{
+		Name: "illustrate",
+		Config: StepConfig{
+			Type:   "image-generation",
+			Input:  "NA",
+			Model:  "gpt-image-1",
+			Action: "Draw a $subject",
+			Output: filepath.Join(outputDir, "$subject_{{ image_index }}.png"),
+			Image:  &ImageConfig{Count: 2},
+		},
+	}
+	result, err := processor.processStep(step, false, "")
+	if err != nil {
+		t.Fatalf("processStep returned error: %v", err)
+	}
+	if strings.Contains(generator.prompt, "previous step") {
+		t.Errorf("Expected the prompt without the previous step's input, got %q", generator.prompt)
+	}
+	paths := strings.Split(result, "\n")
+	if len(paths) != 2 || filepath.Base(paths[0]) != "fox_0.png" || filepath.Base(paths[1]) != "fox_1.png" {
+		t.Errorf("Expected the variable and index in the image paths, got %q", result)
+	}
+}
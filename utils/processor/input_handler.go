@@ -13,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/kris-hansen/comanda/utils/cassette"
 	"github.com/kris-hansen/comanda/utils/input"
 )
 
@@ -57,7 +58,8 @@ func (p *Processor) fetchURL(urlStr string) (string, error) {
 	host := parsedURL.Hostname()
 
 	// Skip DNS resolution for localhost/127.0.0.1 and test server URLs
-	if !strings.HasPrefix(host, "localhost") && !strings.HasPrefix(host, "127.0.0.1") && !strings.Contains(urlStr, ".that.does.not.exist") {
+	// and when responses are replayed from a cassette
+	if !strings.HasPrefix(host, "localhost") && !strings.HasPrefix(host, "127.0.0.1") && !strings.Contains(urlStr, ".that.does.not.exist") && !cassette.Replaying() {
 		// Try to resolve the host first with timeout
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -87,13 +89,13 @@ func (p *Processor) fetchURL(urlStr string) (string, error) {
 	// Create a custom HTTP client with timeout
 	client := &http.Client{
 		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
+		Transport: cassette.Wrap(&http.Transport{
 			DialContext: (&net.Dialer{
 				Timeout: 5 * time.Second,
 			}).DialContext,
 			TLSHandshakeTimeout:   5 * time.Second,
 			ResponseHeaderTimeout: 5 * time.Second,
-		},
+		}),
 	}
 
 	resp, err := client.Get(urlStr)
@@ -475,3 +477,43 @@ func (p *Processor) processFile(path string) error {
 	p.debugf("Successfully processed file/glob: %s", path)
 	return nil
 }
+
+// textInput is the text of a single step input together with where it came from
+type textInput struct {
+	Source string
+	Text   string
+}
+
+// gatherTextInputs resolves a step's inputs for step types that only consume
+// text. STDIN yields the previous step's output; image, audio and video inputs
+// are skipped.
+func (p *Processor) gatherTextInputs(step Step) ([]textInput, error) {
+	// Start from a new handler like processStep, so that the inputs of the
+	// previous step are not gathered again
+	p.handler = input.NewHandler()
+
+	var textInputs []textInput
+	for _, inputPath := range p.NormalizeStringSlice(step.Config.Input) {
+		if strings.HasPrefix(inputPath, "STDIN") {
+			if _, varName := p.parseVariableAssignment(inputPath); varName != "" {
+				p.variables[varName] = p.lastOutput
+			}
+			if p.lastOutput != "" {
+				textInputs = append(textInputs, textInput{Source: "STDIN", Text: p.lastOutput})
+			}
+			continue
+		}
+		if err := p.processInputs([]string{inputPath}); err != nil {
+			return nil, fmt.Errorf("input processing error in step %s: %w", step.Name, err)
+		}
+	}
+
+	for _, inputItem := range p.handler.GetInputs() {
+		if inputItem.Type == input.ImageInput || inputItem.IsMedia() {
+			p.debugf("Ignoring non-text input %s in step %s", inputItem.Path, step.Name)
+			continue
+		}
+		textInputs = append(textInputs, textInput{Source: inputItem.Path, Text: string(inputItem.Contents)})
+	}
+	return textInputs, nil
+}
@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/kris-hansen/comanda/utils/keypool"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// keyRotation sends the requests of a step with the API keys of its provider,
+// taking the next key for every request and retrying with another key when
+// the provider rejects one
+type keyRotation struct {
+	pool     *keypool.Pool
+	provider models.Provider // A provider instance of this step, reconfigured per request
+	project  string
+}
+
+// rotatesKeys reports whether a provider has several API keys to rotate through
+func (p *Processor) rotatesKeys(providerName string) bool {
+	providerConfig, err := p.envConfig.GetProviderConfig(providerName)
+	return err == nil && len(providerConfig.Keys()) > 1
+}
+
+// newKeyRotation returns the key rotation of a provider instance, or nil for
+// providers without API keys
+func (p *Processor) newKeyRotation(providerName string, provider models.Provider) *keyRotation {
+	providerConfig, err := p.envConfig.GetProviderConfig(providerName)
+	if err != nil || !providerConfig.HasAPIKey() {
+		return nil
+	}
+	return &keyRotation{
+		pool:     keypool.Get(providerName, providerConfig),
+		provider: provider,
+		project:  p.project,
+	}
+}
+
+// send makes a request with the next key and counts it. When a key is taken
+// out of rotation, the request is repeated with the next one.
+func (r *keyRotation) send(request func() (string, error)) (string, error) {
+	if r == nil {
+		return request()
+	}
+	var lastErr error
+	for attempt := 0; attempt < r.pool.Size(); attempt++ {
+		key, err := r.pool.Select(r.project)
+		if err != nil {
+			if lastErr != nil {
+				return "", fmt.Errorf("%w; %v", lastErr, err)
+			}
+			return "", err
+		}
+		// A single key was configured with the provider already
+		if r.pool.Size() > 1 {
+			if err := r.provider.Configure(key.Key); err != nil {
+				return "", err
+			}
+		}
+		response, err := request()
+		if !r.pool.Report(key.Name, err) {
+			return response, err
+		}
+		lastErr = fmt.Errorf("API key %s was rejected: %w", key.Name, err)
+	}
+	return "", lastErr
+}
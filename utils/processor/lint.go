@@ -0,0 +1,652 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Diagnostic severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Lint rules, reported with each diagnostic
+const (
+	RuleSyntax            = "syntax"             // The file is not valid YAML or cannot be decoded
+	RuleUnknownKey        = "unknown-key"        // A key that comanda does not read
+	RuleIgnoredKey        = "ignored-key"        // A known key that has no effect where it is used
+	RuleStep              = "step"               // A step is missing required fields or has invalid values
+	RuleWorkflow          = "workflow"           // The workflow: or config: block is invalid
+	RuleUnreachableDefer  = "unreachable-defer"  // A deferred step that no step can call
+	RuleUndefinedVariable = "undefined-variable" // A $variable that is never defined
+	RuleOutputConflict    = "output-conflict"    // Steps writing the same file
+	RuleUnknownModel      = "unknown-model"      // A model that is not enabled in the env config
+)
+
+// Diagnostic is a problem found in a workflow file by Lint
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Step     string `json:"step,omitempty"`
+	Message  string `json:"message"`
+}
+
+// String formats the diagnostic as file:line:column: severity: message [rule]
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s [%s]", d.File, d.Line, d.Column, d.Severity, d.Message, d.Rule)
+}
+
+// stepTypes are the values of a step's type field; the empty type is a standard step
+var stepTypes = []string{"openai-responses", "image-generation", "index", "retrieve"}
+
+// responsesOnlyKeys are step keys that only openai-responses steps use
+var responsesOnlyKeys = []string{"instructions", "tools", "previous_response_id", "response_format", "stream"}
+
+// lineNumber finds the line number in YAML error messages such as "yaml: line 3: ..."
+var lineNumber = regexp.MustCompile(`line (\d+)`)
+
+// variableRef matches $name references, including $step.response_id
+var variableRef = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)`)
+
+// lintStep is a step of the workflow with the YAML nodes it was read from
+type lintStep struct {
+	name   string
+	group  string // The parallel group, or "defer" for deferred steps
+	key    *yaml.Node
+	value  *yaml.Node
+	config StepConfig
+}
+
+// linter collects the diagnostics of one workflow file
+type linter struct {
+	file        string
+	envConfig   *config.EnvConfig
+	proc        *Processor // Used for its pure helpers; it never runs steps
+	steps       []lintStep
+	params      map[string]bool
+	diagnostics []Diagnostic
+}
+
+// Lint checks a workflow file without running it or contacting any provider.
+// It reports YAML errors, unknown keys, invalid steps, deferred steps that
+// cannot be reached, undefined variables, steps writing the same file and,
+// when envConfig is not nil, models that are not enabled in it. Diagnostics
+// are sorted by position.
+func Lint(file string, data []byte, envConfig *config.EnvConfig) []Diagnostic {
+	l := &linter{
+		file:      file,
+		envConfig: envConfig,
+		proc:      &Processor{},
+		params:    make(map[string]bool),
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		l.addAt(errorLine(err, 1), 1, SeverityError, RuleSyntax, "", err.Error())
+		return l.diagnostics
+	}
+	if len(doc.Content) == 0 {
+		l.addAt(1, 1, SeverityError, RuleWorkflow, "", "workflow is empty")
+		return l.diagnostics
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		l.add(root, SeverityError, RuleWorkflow, "", "workflow must be a mapping of step names to steps")
+		return l.diagnostics
+	}
+
+	l.collect(root)
+	if len(l.steps) == 0 {
+		l.add(root, SeverityError, RuleWorkflow, "", "no steps defined")
+	}
+	l.checkSteps()
+	l.checkDeferred()
+	l.checkVariables()
+	l.checkOutputs()
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		a, b := l.diagnostics[i], l.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return l.diagnostics
+}
+
+func (l *linter) add(node *yaml.Node, severity, rule, step, message string) {
+	l.addAt(node.Line, node.Column, severity, rule, step, message)
+}
+
+func (l *linter) addAt(line, column int, severity, rule, step, message string) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		File:     l.file,
+		Line:     line,
+		Column:   column,
+		Severity: severity,
+		Rule:     rule,
+		Step:     step,
+		Message:  message,
+	})
+}
+
+// addDecodeError reports an error decoding a node, at the lines yaml reports
+func (l *linter) addDecodeError(node *yaml.Node, step string, err error) {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for _, msg := range typeErr.Errors {
+			line := errorLine(errors.New(msg), node.Line)
+			l.addAt(line, 1, SeverityError, RuleSyntax, step, strings.TrimPrefix(msg, fmt.Sprintf("line %d: ", line)))
+		}
+		return
+	}
+	l.addAt(errorLine(err, node.Line), node.Column, SeverityError, RuleSyntax, step, err.Error())
+}
+
+// errorLine returns the line number of a YAML error message, or def
+func errorLine(err error, def int) int {
+	if m := lineNumber.FindStringSubmatch(err.Error()); m != nil {
+		if line, convErr := strconv.Atoi(m[1]); convErr == nil {
+			return line
+		}
+	}
+	return def
+}
+
+// collect reads the reserved blocks and the steps of the workflow
+func (l *linter) collect(root *yaml.Node) {
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "workflow":
+			l.checkKeys(value, reflect.TypeOf(WorkflowMeta{}), "", "workflow")
+			var meta WorkflowMeta
+			if err := value.Decode(&meta); err != nil {
+				l.addDecodeError(value, "", err)
+				continue
+			}
+			if err := meta.validate(); err != nil {
+				l.add(key, SeverityError, RuleWorkflow, "", err.Error())
+			}
+			for name := range meta.Params {
+				l.params[name] = true
+			}
+		case "config":
+			var overrides map[string]interface{}
+			if err := value.Decode(&overrides); err != nil {
+				l.addDecodeError(value, "", err)
+				continue
+			}
+			if err := config.ValidateWorkflowConfig(overrides); err != nil {
+				l.add(key, SeverityError, RuleWorkflow, "", err.Error())
+			}
+		case "defer":
+			if value.Kind != yaml.MappingNode {
+				l.add(value, SeverityError, RuleWorkflow, "", "defer must be a mapping of step names to steps")
+				continue
+			}
+			for j := 0; j < len(value.Content); j += 2 {
+				l.addStep(value.Content[j], value.Content[j+1], "defer")
+			}
+		case "parallel":
+			// The legacy form: group name to a list of {name, config} steps
+			var groups map[string][]Step
+			if err := value.Decode(&groups); err != nil {
+				l.addDecodeError(value, "", err)
+				continue
+			}
+			for j := 0; j < len(value.Content); j += 2 {
+				for _, item := range value.Content[j+1].Content {
+					if nameNode, configNode := mappingValue(item, "name"), mappingValue(item, "config"); nameNode != nil && configNode != nil {
+						l.addStep(nameNode, configNode, value.Content[j].Value)
+					}
+				}
+			}
+		default:
+			if (&DSLConfig{}).isParallelStepGroup(value) {
+				for j := 0; j < len(value.Content); j += 2 {
+					l.addStep(value.Content[j], value.Content[j+1], key.Value)
+				}
+				continue
+			}
+			l.addStep(key, value, "")
+		}
+	}
+}
+
+// addStep checks the keys of a step and decodes it
+func (l *linter) addStep(key, value *yaml.Node, group string) {
+	name := key.Value
+	if value.Kind != yaml.MappingNode {
+		l.add(value, SeverityError, RuleStep, name, fmt.Sprintf("step '%s' must be a mapping", name))
+		return
+	}
+	l.checkKeys(value, reflect.TypeOf(StepConfig{}), name, name)
+
+	var stepConfig StepConfig
+	if err := value.Decode(&stepConfig); err != nil {
+		l.addDecodeError(value, name, err)
+		return
+	}
+	l.steps = append(l.steps, lintStep{name: name, group: group, key: key, value: value, config: stepConfig})
+}
+
+// checkKeys reports the keys of a mapping that the type it is decoded into
+// does not have, recursing into nested blocks
+func (l *linter) checkKeys(node *yaml.Node, t reflect.Type, step string, where string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		for i := 0; i < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				message := fmt.Sprintf("unknown key '%s' in %s", key.Value, where)
+				if suggestion := closestName(key.Value, fields); suggestion != "" {
+					message += fmt.Sprintf(" (did you mean '%s'?)", suggestion)
+				}
+				l.add(key, SeverityError, RuleUnknownKey, step, message)
+				continue
+			}
+			l.checkKeys(value, fieldType, step, where+"."+key.Value)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i < len(node.Content); i += 2 {
+			l.checkKeys(node.Content[i+1], t.Elem(), step, where+"."+node.Content[i].Value)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for _, item := range node.Content {
+			l.checkKeys(item, t.Elem(), step, where)
+		}
+	}
+}
+
+// yamlFields returns the YAML keys of a struct type with their field types
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// closestName returns the known key closest to a misspelled one, if any is close
+func closestName(name string, known map[string]reflect.Type) string {
+	best, bestDistance := "", len(name)/3+1
+	for candidate := range known {
+		if d := editDistance(name, candidate); d < bestDistance || (d == bestDistance && best != "" && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(min(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// mappingValue returns the value of a key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mappingKey returns the key node of a key in a mapping node, or nil
+func mappingKey(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+// scalars returns the scalar nodes of a string or a list of strings
+func scalars(node *yaml.Node) []*yaml.Node {
+	if node == nil {
+		return nil
+	}
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return []*yaml.Node{node}
+	case yaml.SequenceNode:
+		var nodes []*yaml.Node
+		for _, item := range node.Content {
+			if item.Kind == yaml.ScalarNode {
+				nodes = append(nodes, item)
+			}
+		}
+		return nodes
+	}
+	return nil
+}
+
+// checkSteps reports invalid steps, keys without effect and unknown models
+func (l *linter) checkSteps() {
+	for _, step := range l.steps {
+		for _, problem := range l.proc.stepConfigErrors(step.config) {
+			l.add(step.key, SeverityError, RuleStep, step.name, fmt.Sprintf("step '%s': %s", step.name, problem))
+		}
+
+		if step.config.Type != "" && !containsString(stepTypes, step.config.Type) {
+			l.add(mappingValue(step.value, "type"), SeverityError, RuleStep, step.name,
+				fmt.Sprintf("unknown step type '%s' (must be %s, or omitted for a standard step)", step.config.Type, strings.Join(stepTypes, ", ")))
+		}
+
+		for _, node := range scalars(mappingValue(step.value, "output")) {
+			if _, variable := l.proc.parseVariableAssignment(node.Value); variable != "" {
+				l.add(node, SeverityWarning, RuleStep, step.name,
+					fmt.Sprintf("outputs cannot assign variables, so this writes a file named '%s'; assign it in the next step with 'input: STDIN as $%s'", node.Value, variable))
+			}
+		}
+
+		if key := mappingKey(step.value, "next-action"); key != nil {
+			l.add(key, SeverityWarning, RuleIgnoredKey, step.name, "next-action is not run; it is only shown in the configuration summary")
+		}
+		if step.config.Type != "openai-responses" {
+			for _, name := range responsesOnlyKeys {
+				if key := mappingKey(step.value, name); key != nil {
+					l.add(key, SeverityWarning, RuleIgnoredKey, step.name, fmt.Sprintf("'%s' is only used by steps with type: openai-responses", name))
+				}
+			}
+		}
+
+		l.checkModels(step)
+	}
+}
+
+// checkModels reports the models of a step that are not enabled in the env config
+func (l *linter) checkModels(step lintStep) {
+	if l.envConfig == nil || usesStandaloneModel(step.config) || step.config.Process != nil {
+		return
+	}
+	modelNode := mappingValue(step.value, "model")
+	if step.config.Generate != nil {
+		modelNode = mappingValue(mappingValue(step.value, "generate"), "model")
+	}
+	for _, node := range scalars(modelNode) {
+		if node.Value == "" || node.Value == "NA" {
+			continue
+		}
+		if problem := l.modelProblem(node.Value); problem != "" {
+			l.add(node, SeverityError, RuleUnknownModel, step.name, problem)
+		}
+	}
+}
+
+// modelProblem explains why a model name does not resolve to a model enabled
+// in the env config, following aliases and provider prefixes, or returns ""
+func (l *linter) modelProblem(name string) string {
+	original := name
+	seen := make(map[string]bool)
+	for {
+		target, ok := l.envConfig.Aliases[name]
+		if !ok {
+			break
+		}
+		if seen[name] {
+			return fmt.Sprintf("model alias '%s' refers to itself", name)
+		}
+		seen[name] = true
+		name = strings.TrimSpace(target)
+	}
+	described := fmt.Sprintf("'%s'", name)
+	if name != original {
+		described = fmt.Sprintf("'%s' (alias '%s')", name, original)
+	}
+
+	if l.modelEnabled("", name) {
+		return ""
+	}
+	if i := strings.Index(name, "/"); i > 0 && i < len(name)-1 {
+		providerName, model := name[:i], name[i+1:]
+		if _, ok := l.envConfig.Providers[providerName]; ok {
+			if l.modelEnabled(providerName, model) {
+				return ""
+			}
+			return fmt.Sprintf("model %s is not enabled for provider '%s' in the env config; use 'comanda configure' to add it", described, providerName)
+		}
+		if _, ok := models.LookupProvider(providerName); ok {
+			return fmt.Sprintf("model %s uses provider '%s', which is not configured in the env config", described, providerName)
+		}
+	}
+	return fmt.Sprintf("model %s is not enabled in the env config; use 'comanda configure' to add it", described)
+}
+
+// modelEnabled reports whether a model is listed under a provider in the env
+// config, or under any provider when providerName is empty
+func (l *linter) modelEnabled(providerName, model string) bool {
+	for name, provider := range l.envConfig.Providers {
+		if provider == nil || (providerName != "" && name != providerName) {
+			continue
+		}
+		for _, m := range provider.Models {
+			if m.Name == model {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkDeferred reports deferred steps that no other step mentions. A deferred
+// step runs when a step outputs {"step": "<name>", ...}, so a step whose
+// action never names it cannot trigger it.
+func (l *linter) checkDeferred() {
+	for _, deferred := range l.steps {
+		if deferred.group != "defer" {
+			continue
+		}
+		mentioned := false
+		for _, step := range l.steps {
+			if step.name == deferred.name && step.group == "defer" {
+				continue
+			}
+			if strings.Contains(l.stepText(step), deferred.name) {
+				mentioned = true
+				break
+			}
+		}
+		if !mentioned {
+			l.add(deferred.key, SeverityWarning, RuleUnreachableDefer, deferred.name,
+				fmt.Sprintf("deferred step '%s' is never called: no step mentions it, so no output can trigger it with {\"step\": \"%s\"}", deferred.name, deferred.name))
+		}
+	}
+}
+
+// stepText returns the prompts of a step, which may name deferred steps
+func (l *linter) stepText(step lintStep) string {
+	var parts []string
+	parts = append(parts, l.proc.NormalizeStringSlice(step.config.Action)...)
+	parts = append(parts, l.proc.NormalizeStringSlice(step.config.NextAction)...)
+	parts = append(parts, step.config.Instructions)
+	if step.config.Generate != nil {
+		parts = append(parts, l.proc.NormalizeStringSlice(step.config.Generate.Action)...)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// checkVariables reports $variables that are neither params, assigned with
+// "input: ... as $name" nor the response ID of an openai-responses step
+func (l *linter) checkVariables() {
+	defined := make(map[string]bool)
+	for name := range l.params {
+		defined[name] = true
+	}
+	for _, step := range l.steps {
+		for _, input := range l.proc.NormalizeStringSlice(step.config.Input) {
+			if _, variable := l.proc.parseVariableAssignment(input); variable != "" {
+				defined[variable] = true
+			}
+		}
+		if step.config.Type == "openai-responses" {
+			defined[step.name+".response_id"] = true
+		}
+	}
+
+	for _, step := range l.steps {
+		var nodes []*yaml.Node
+		for _, field := range []string{"action", "instructions", "previous_response_id"} {
+			nodes = append(nodes, scalars(mappingValue(step.value, field))...)
+		}
+		for _, node := range scalars(mappingValue(step.value, "input")) {
+			if path, _ := l.proc.parseVariableAssignment(node.Value); !strings.HasPrefix(path, "STDIN") {
+				nodes = append(nodes, node)
+			}
+		}
+		nodes = append(nodes, scalars(mappingValue(mappingValue(step.value, "generate"), "action"))...)
+		if inputs := mappingValue(mappingValue(step.value, "process"), "inputs"); inputs != nil && inputs.Kind == yaml.MappingNode {
+			for i := 1; i < len(inputs.Content); i += 2 {
+				nodes = append(nodes, scalars(inputs.Content[i])...)
+			}
+		}
+
+		for _, node := range nodes {
+			text, _ := l.proc.parseVariableAssignment(node.Value)
+			for _, match := range variableRef.FindAllStringSubmatch(text, -1) {
+				if !isDefined(match[1], defined) {
+					l.add(node, SeverityWarning, RuleUndefinedVariable, step.name,
+						fmt.Sprintf("undefined variable '$%s'; assign it with 'input: <file> as $%s' or declare it in the workflow: params", match[1], match[1]))
+				}
+			}
+		}
+	}
+}
+
+// isDefined reports whether a reference such as "a.b" or one of its prefixes
+// ("a") is a defined variable, since "$a" is replaced within "$a.b"
+func isDefined(ref string, defined map[string]bool) bool {
+	for {
+		if defined[ref] {
+			return true
+		}
+		i := strings.LastIndex(ref, ".")
+		if i < 0 {
+			return false
+		}
+		ref = ref[:i]
+	}
+}
+
+// checkOutputs reports parallel steps that write or read the same files, and
+// sequential steps that overwrite each other's output
+func (l *linter) checkOutputs() {
+	written := make(map[string]string)                 // file -> sequential step
+	groupWritten := make(map[string]map[string]string) // group -> file -> step
+
+	for _, step := range l.steps {
+		if step.group == "defer" {
+			continue
+		}
+		outputs := scalars(mappingValue(step.value, "output"))
+		if step.group == "" {
+			for _, node := range outputs {
+				if !isFileOutput(node.Value) {
+					continue
+				}
+				if previous, ok := written[node.Value]; ok && previous != step.name {
+					l.add(node, SeverityWarning, RuleOutputConflict, step.name,
+						fmt.Sprintf("step '%s' overwrites '%s', which step '%s' also writes", step.name, node.Value, previous))
+				}
+				written[node.Value] = step.name
+			}
+			continue
+		}
+
+		if groupWritten[step.group] == nil {
+			groupWritten[step.group] = make(map[string]string)
+		}
+		for _, node := range outputs {
+			if !isFileOutput(node.Value) {
+				continue
+			}
+			if previous, ok := groupWritten[step.group][node.Value]; ok {
+				l.add(node, SeverityError, RuleOutputConflict, step.name,
+					fmt.Sprintf("parallel steps '%s' and '%s' both write '%s'", previous, step.name, node.Value))
+				continue
+			}
+			groupWritten[step.group][node.Value] = step.name
+		}
+	}
+
+	// Parallel steps run at the same time, so none can read another's output
+	for _, step := range l.steps {
+		if step.group == "" || step.group == "defer" {
+			continue
+		}
+		for _, node := range scalars(mappingValue(step.value, "input")) {
+			if producer, ok := groupWritten[step.group][node.Value]; ok && producer != step.name {
+				l.add(node, SeverityError, RuleOutputConflict, step.name,
+					fmt.Sprintf("parallel step '%s' reads '%s', which parallel step '%s' of the same group writes", step.name, node.Value, producer))
+			}
+		}
+	}
+}
+
+// isFileOutput reports whether an output names a file rather than STDOUT or memory
+func isFileOutput(output string) bool {
+	return output != "" && output != "STDOUT" && output != "MEMORY" && !strings.HasPrefix(output, "MEMORY:")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package processor
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// findDiagnostic returns the first diagnostic of a rule whose message contains text
+func findDiagnostic(diagnostics []Diagnostic, rule, text string) *Diagnostic {
+	for i := range diagnostics {
+		if diagnostics[i].Rule == rule && strings.Contains(diagnostics[i].Message, text) {
+			return &diagnostics[i]
+		}
+	}
+	return nil
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		workflow string
+		rule     string
+		severity string
+		text     string
+		line     int
+		step     string
+	}{
+		{
+			name:     "invalid YAML",
+			workflow: "step:\n  input: a\n   model: b\n",
+			rule:     RuleSyntax,
+			severity: SeverityError,
+			text:     "mapping values are not allowed",
+			line:     3,
+		},
+		{
+			name:     "unknown key with suggestion",
+			workflow: "summarize:\n  input: NA\n  model: gpt-4o\n  acton: Summarize\n  output: STDOUT\n",
+			rule:     RuleUnknownKey,
+			severity: SeverityError,
+			text:     "did you mean 'action'?",
+			line:     4,
+			step:     "summarize",
+		},
+		{
+			name:     "unknown nested key",
+			workflow: "summarize:\n  input: doc.txt\n  model: gpt-4o\n  action: Summarize\n  output: STDOUT\n  chunk:\n    sise: 100\n",
+			rule:     RuleUnknownKey,
+			severity: SeverityError,
+			text:     "unknown key 'sise' in summarize.chunk (did you mean 'size'?)",
+			line:     7,
+		},
+		{
+			name:     "missing step fields",
+			workflow: "summarize:\n  input: NA\n  output: STDOUT\n",
+			rule:     RuleStep,
+			severity: SeverityError,
+			text:     "model is required",
+			line:     1,
+			step:     "summarize",
+		},
+		{
+			name:     "unknown step type",
+			workflow: "search:\n  type: serch\n  input: NA\n  model: gpt-4o\n  action: Search\n  output: STDOUT\n",
+			rule:     RuleStep,
+			severity: SeverityError,
+			text:     "unknown step type 'serch'",
+			line:     2,
+		},
+		{
+			name:     "output assigning a variable",
+			workflow: "draft:\n  input: NA\n  model: gpt-4o\n  action: Write\n  output: STDOUT as $draft\n",
+			rule:     RuleStep,
+			severity: SeverityWarning,
+			text:     "outputs cannot assign variables",
+			line:     5,
+		},
+		{
+			name:     "next-action has no effect",
+			workflow: "draft:\n  input: NA\n  model: gpt-4o\n  action: Write\n  next-action: Review\n  output: STDOUT\n",
+			rule:     RuleIgnoredKey,
+			severity: SeverityWarning,
+			text:     "next-action is not run",
+			line:     5,
+		},
+		{
+			name:     "responses key on a standard step",
+			workflow: "draft:\n  input: NA\n  model: gpt-4o\n  action: Write\n  instructions: Be brief\n  output: STDOUT\n",
+			rule:     RuleIgnoredKey,
+			severity: SeverityWarning,
+			text:     "'instructions' is only used by steps with type: openai-responses",
+			line:     5,
+		},
+		{
+			name:     "unreachable deferred step",
+			workflow: "draft:\n  input: NA\n  model: gpt-4o\n  action: Write\n  output: STDOUT\ndefer:\n  polish:\n    input: STDIN\n    model: gpt-4o\n    action: Polish\n    output: STDOUT\n",
+			rule:     RuleUnreachableDefer,
+			severity: SeverityWarning,
+			text:     "deferred step 'polish' is never called",
+			line:     7,
+		},
+		{
+			name:     "undefined variable",
+			workflow: "load:\n  input: doc.txt as $doc\n  model: gpt-4o\n  action: Summarize $doc for $audience\n  output: STDOUT\n",
+			rule:     RuleUndefinedVariable,
+			severity: SeverityWarning,
+			text:     "undefined variable '$audience'",
+			line:     4,
+		},
+		{
+			name:     "parallel steps writing the same file",
+			workflow: "parallel-process:\n  a:\n    input: NA\n    model: gpt-4o\n    action: A\n    output: out.txt\n  b:\n    input: NA\n    model: gpt-4o\n    action: B\n    output: out.txt\n",
+			rule:     RuleOutputConflict,
+			severity: SeverityError,
+			text:     "parallel steps 'a' and 'b' both write 'out.txt'",
+			line:     11,
+		},
+		{
+			name:     "parallel step reading a sibling's output",
+			workflow: "parallel-process:\n  a:\n    input: NA\n    model: gpt-4o\n    action: A\n    output: a.txt\n  b:\n    input: a.txt\n    model: gpt-4o\n    action: B\n    output: b.txt\n",
+			rule:     RuleOutputConflict,
+			severity: SeverityError,
+			text:     "parallel step 'b' reads 'a.txt'",
+			line:     8,
+		},
+		{
+			name:     "sequential steps overwriting a file",
+			workflow: "a:\n  input: NA\n  model: gpt-4o\n  action: A\n  output: out.txt\nb:\n  input: NA\n  model: gpt-4o\n  action: B\n  output: out.txt\n",
+			rule:     RuleOutputConflict,
+			severity: SeverityWarning,
+			text:     "step 'b' overwrites 'out.txt'",
+			line:     10,
+		},
+		{
+			name:     "invalid workflow block",
+			workflow: "workflow:\n  params:\n    size:\n      type: enum\nstep:\n  input: NA\n  model: gpt-4o\n  action: A\n  output: STDOUT\n",
+			rule:     RuleWorkflow,
+			severity: SeverityError,
+			text:     "requires a list of values",
+			line:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := Lint("wf.yaml", []byte(tt.workflow), nil)
+			d := findDiagnostic(diagnostics, tt.rule, tt.text)
+			if d == nil {
+				t.Fatalf("Expected a %s diagnostic containing %q, got %v", tt.rule, tt.text, diagnostics)
+			}
+			if d.Severity != tt.severity {
+				t.Errorf("Expected severity %s, got %s", tt.severity, d.Severity)
+			}
+			if d.Line != tt.line {
+				t.Errorf("Expected line %d, got %d (%s)", tt.line, d.Line, d)
+			}
+			if tt.step != "" && d.Step != tt.step {
+				t.Errorf("Expected step %q, got %q", tt.step, d.Step)
+			}
+			if d.File != "wf.yaml" {
+				t.Errorf("Expected file wf.yaml, got %q", d.File)
+			}
+		})
+	}
+}
+
+func TestLintCleanWorkflow(t *testing.T) {
+	workflow := `
+workflow:
+  params:
+    audience:
+      default: engineers
+
+load:
+  input: doc.txt as $doc
+  model: gpt-4o
+  action: Summarize $doc for $audience
+  output: summary.txt
+
+review:
+  input: summary.txt
+  model: gpt-4o
+  action: 'If it needs work, reply with {"step": "polish", "input": "..."}'
+  output: STDOUT
+
+defer:
+  polish:
+    input: STDIN
+    model: gpt-4o
+    action: Polish the summary
+    output: STDOUT
+`
+	if diagnostics := Lint("wf.yaml", []byte(workflow), nil); len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", diagnostics)
+	}
+}
+
+func TestLintModels(t *testing.T) {
+	envConfig := &config.EnvConfig{
+		Providers: map[string]*config.Provider{
+			"openai": {Models: []config.Model{{Name: "gpt-4o"}}},
+		},
+		Aliases: map[string]string{"fast": "gpt-4o", "smart": "gpt-5"},
+	}
+	workflow := `
+a:
+  input: NA
+  model: fast
+  action: A
+  output: STDOUT
+b:
+  input: NA
+  model: smart
+  action: B
+  output: STDOUT
+c:
+  input: NA
+  model: anthropic/claude-sonnet-4
+  action: C
+  output: STDOUT
+d:
+  input: NA
+  model: openai/gpt-4o
+  action: D
+  output: STDOUT
+`
+	diagnostics := Lint("wf.yaml", []byte(workflow), envConfig)
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %v", diagnostics)
+	}
+	if d := findDiagnostic(diagnostics, RuleUnknownModel, "'gpt-5' (alias 'smart')"); d == nil || d.Line != 9 {
+		t.Errorf("Expected the alias to be followed, got %v", diagnostics)
+	}
+	if d := findDiagnostic(diagnostics, RuleUnknownModel, "provider 'anthropic', which is not configured"); d == nil || d.Line != 14 {
+		t.Errorf("Expected the unconfigured provider to be reported, got %v", diagnostics)
+	}
+
+	if diagnostics := Lint("wf.yaml", []byte(workflow), nil); len(diagnostics) != 0 {
+		t.Errorf("Expected models to be skipped without an env config, got %v", diagnostics)
+	}
+}
+
+func TestDiagnosticFormat(t *testing.T) {
+	d := Diagnostic{File: "wf.yaml", Line: 3, Column: 5, Severity: SeverityError, Rule: RuleUnknownKey, Step: "a", Message: "unknown key 'x' in a"}
+	if got, want := d.String(), "wf.yaml:3:5: error: unknown key 'x' in a [unknown-key]"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"file":"wf.yaml","line":3,"column":5,"severity":"error","rule":"unknown-key","step":"a","message":"unknown key 'x' in a"}`
+	if string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/kris-hansen/comanda/utils/memory"
 )
 
 const (
@@ -19,21 +21,52 @@ const (
 	MaxMemorySizeWarningBytes = 400 * 1024
 )
 
-// MemoryManager handles reading from and writing to the COMANDA.md memory file
+// compactedSectionName is the section that holds summaries of compacted entries
+const compactedSectionName = "Compacted History"
+
+// Compactor summarizes memory entries that are removed during compaction
+type Compactor func(content string) (string, error)
+
+// MemoryManager handles reading from and writing to the COMANDA.md memory file.
+// Writes go through a memory.Store, which locks the file across processes and
+// records each change in the memory history.
 type MemoryManager struct {
-	filePath string
-	content  string
-	mu       sync.RWMutex // Thread-safe for parallel step execution
+	filePath  string
+	store     memory.Store
+	content   string
+	compactor Compactor
+	mu        sync.RWMutex // Thread-safe for parallel step execution
+}
+
+// MemoryEntry is a block of the memory file: the preamble, a "## section", or
+// an entry appended with a "---" / "*Updated: ...*" separator
+type MemoryEntry struct {
+	Section  string // Section name for "## section" blocks
+	Updated  string // Timestamp from the "*Updated: ...*" line, if any
+	Content  string // Block text without the heading and timestamp lines
+	Appended bool   // True for entries written with a plain MEMORY output
+	raw      string
 }
 
-// NewMemoryManager creates a new memory manager
+// NewMemoryManager creates a new memory manager for the default namespace
 func NewMemoryManager(filePath string) (*MemoryManager, error) {
+	return NewNamespacedMemoryManager(filePath, "")
+}
+
+// NewNamespacedMemoryManager creates a memory manager for a namespace of the
+// memory file. The empty namespace is the default one.
+func NewNamespacedMemoryManager(filePath string, namespace string) (*MemoryManager, error) {
 	m := &MemoryManager{
 		filePath: filePath,
 	}
 
 	// Load initial content if file exists
 	if filePath != "" {
+		store, err := memory.Open(filePath, namespace)
+		if err != nil {
+			return nil, err
+		}
+		m.store = store
 		if err := m.Load(); err != nil {
 			return nil, fmt.Errorf("failed to load memory file: %w", err)
 		}
@@ -47,21 +80,16 @@ func (m *MemoryManager) Load() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.filePath == "" {
+	if m.store == nil {
 		m.content = ""
 		return nil
 	}
 
-	data, err := os.ReadFile(m.filePath)
+	content, err := m.store.Read()
 	if err != nil {
-		if os.IsNotExist(err) {
-			m.content = ""
-			return nil
-		}
 		return err
 	}
-
-	m.content = string(data)
+	m.content = content
 	return nil
 }
 
@@ -77,35 +105,7 @@ func (m *MemoryManager) GetMemory() string {
 func (m *MemoryManager) GetMemorySection(sectionName string) string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-
-	if m.content == "" {
-		return ""
-	}
-
-	lines := strings.Split(m.content, "\n")
-	sectionHeader := "## " + sectionName
-	var sectionContent []string
-	inSection := false
-
-	for _, line := range lines {
-		// Check if we've found the target section
-		if strings.HasPrefix(line, sectionHeader) {
-			inSection = true
-			continue
-		}
-
-		// If we're in the section and hit another ## header, stop
-		if inSection && strings.HasPrefix(line, "## ") {
-			break
-		}
-
-		// If we're in the section, collect the line
-		if inSection {
-			sectionContent = append(sectionContent, line)
-		}
-	}
-
-	return strings.TrimSpace(strings.Join(sectionContent, "\n"))
+	return memory.Section(m.content, sectionName)
 }
 
 // AppendMemory appends content to the memory file
@@ -113,7 +113,7 @@ func (m *MemoryManager) AppendMemory(content string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.filePath == "" {
+	if m.store == nil {
 		return fmt.Errorf("no memory file configured")
 	}
 
@@ -126,24 +126,52 @@ func (m *MemoryManager) AppendMemory(content string) error {
 	separator := fmt.Sprintf("\n---\n*Updated: %s*\n\n", getCurrentTimestamp())
 	fullContent := separator + content
 
-	// Check if appending would exceed size limit
-	newSize := len(m.content) + len(fullContent)
-	if newSize > MaxMemorySizeBytes {
-		return fmt.Errorf("appending content would exceed maximum memory size of %d bytes (current: %d, new: %d). Consider archiving or removing old entries",
-			MaxMemorySizeBytes, len(m.content), newSize)
+	// Compact old entries once the warning threshold is reached
+	edit, err := m.compacting(func(current string) (string, error) {
+		return current + fullContent, nil
+	})
+	if err != nil {
+		return err
 	}
 
-	// Warn if approaching size limit
-	if newSize > MaxMemorySizeWarningBytes && len(m.content) <= MaxMemorySizeWarningBytes {
-		fmt.Fprintf(os.Stderr, "Warning: Memory file size (%d bytes) is approaching the maximum limit (%d bytes). Consider archiving old entries.\n",
-			newSize, MaxMemorySizeBytes)
-	}
+	// Build on the file's current content, which another process may have changed
+	return m.update("append entry", func(current string) (string, error) {
+		newContent, err := edit(current)
+		if err != nil {
+			return "", err
+		}
+
+		// Check if appending would exceed size limit
+		newSize := len(newContent)
+		if newSize > MaxMemorySizeBytes {
+			return "", fmt.Errorf("appending content would exceed maximum memory size of %d bytes (current: %d, new: %d). Consider archiving or removing old entries",
+				MaxMemorySizeBytes, len(current), newSize)
+		}
+
+		// Warn if approaching size limit
+		if newSize > MaxMemorySizeWarningBytes && len(current) <= MaxMemorySizeWarningBytes {
+			fmt.Fprintf(os.Stderr, "Warning: Memory file size (%d bytes) is approaching the maximum limit (%d bytes). Consider archiving old entries.\n",
+				newSize, MaxMemorySizeBytes)
+		}
 
-	// Append to current content
-	m.content = m.content + fullContent
+		return newContent, nil
+	})
+}
 
-	// Write to file
-	return os.WriteFile(m.filePath, []byte(m.content), 0644)
+// update applies fn to the stored content through the store and caches the
+// result. Callers must hold the lock.
+func (m *MemoryManager) update(message string, fn memory.UpdateFunc) error {
+	var updated string
+	err := m.store.Update(message, func(current string) (string, error) {
+		newContent, err := fn(current)
+		updated = newContent
+		return newContent, err
+	})
+	if err != nil {
+		return err
+	}
+	m.content = updated
+	return nil
 }
 
 // WriteMemorySection writes or updates a specific section in the memory file
@@ -151,11 +179,46 @@ func (m *MemoryManager) WriteMemorySection(sectionName, content string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.filePath == "" {
+	if m.store == nil {
 		return fmt.Errorf("no memory file configured")
 	}
 
-	lines := strings.Split(m.content, "\n")
+	// Compact old entries once the warning threshold is reached
+	edit, err := m.compacting(func(current string) (string, error) {
+		return replaceMemorySection(current, sectionName, content)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Build on the file's current content, which another process may have changed
+	return m.update("update section "+sectionName, func(current string) (string, error) {
+		newContent, err := edit(current)
+		if err != nil {
+			return "", err
+		}
+
+		// Check if new content would exceed size limit
+		newSize := len(newContent)
+		if newSize > MaxMemorySizeBytes {
+			return "", fmt.Errorf("updated content would exceed maximum memory size of %d bytes (new size: %d). Consider archiving or removing old entries",
+				MaxMemorySizeBytes, newSize)
+		}
+
+		// Warn if approaching size limit
+		if newSize > MaxMemorySizeWarningBytes && len(current) <= MaxMemorySizeWarningBytes {
+			fmt.Fprintf(os.Stderr, "Warning: Memory file size (%d bytes) is approaching the maximum limit (%d bytes). Consider archiving old entries.\n",
+				newSize, MaxMemorySizeBytes)
+		}
+
+		return newContent, nil
+	})
+}
+
+// replaceMemorySection returns current with the section's content replaced,
+// adding the section at the end if it does not exist
+func replaceMemorySection(current, sectionName, content string) (string, error) {
+	lines := strings.Split(current, "\n")
 	sectionHeader := "## " + sectionName
 	var newLines []string
 	inSection := false
@@ -202,7 +265,7 @@ func (m *MemoryManager) WriteMemorySection(sectionName, content string) error {
 	}
 
 	// If content was empty and section wasn't found, create it
-	if !sectionFound && m.content == "" {
+	if !sectionFound && current == "" {
 		newLines = []string{
 			"# Project Memory",
 			"",
@@ -215,40 +278,231 @@ func (m *MemoryManager) WriteMemorySection(sectionName, content string) error {
 	}
 
 	if !sectionWritten {
-		return fmt.Errorf("failed to write section %s", sectionName)
+		return "", fmt.Errorf("failed to write section %s", sectionName)
 	}
 
-	newContent := strings.Join(newLines, "\n")
+	return strings.Join(newLines, "\n"), nil
+}
+
+// SetCompactor sets the function used to summarize old entries when the memory
+// file reaches MaxMemorySizeWarningBytes. Without a compactor no compaction happens.
+func (m *MemoryManager) SetCompactor(compactor Compactor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.compactor = compactor
+}
+
+// Entries returns the memory file split into entries
+func (m *MemoryManager) Entries() []MemoryEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return parseMemoryEntries(m.content)
+}
 
-	// Check if new content would exceed size limit
-	newSize := len(newContent)
-	if newSize > MaxMemorySizeBytes {
-		return fmt.Errorf("updated content would exceed maximum memory size of %d bytes (new size: %d). Consider archiving or removing old entries",
-			MaxMemorySizeBytes, newSize)
+// Compact summarizes old appended entries into the "Compacted History" section
+// and writes the result to the memory file
+func (m *MemoryManager) Compact() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.store == nil {
+		return fmt.Errorf("no memory file configured")
+	}
+	if m.compactor == nil {
+		return fmt.Errorf("no compactor configured")
+	}
+
+	// Summarize without holding the file lock, since the compactor calls a model
+	base, err := m.store.Read()
+	if err != nil {
+		return err
+	}
+	compacted, err := compactMemory(base, m.compactor, MaxMemorySizeWarningBytes/2)
+	if err != nil {
+		return err
+	}
+	return m.update("compact", func(current string) (string, error) {
+		if current != base {
+			return "", fmt.Errorf("memory file changed during compaction, try again")
+		}
+		return compacted, nil
+	})
+}
+
+// compacting returns edit with old entries compacted once the edited content
+// grows past the warning threshold. The summary is made from the file as it
+// is now, before the file lock is taken, since the compactor calls a model. The
+// returned function uses it only if the file is unchanged when the lock is
+// held, and otherwise applies edit alone, leaving compaction to a later write.
+// Compaction failures are reported but never block a write. Callers must hold
+// the mutex.
+func (m *MemoryManager) compacting(edit memory.UpdateFunc) (memory.UpdateFunc, error) {
+	if m.compactor == nil {
+		return edit, nil
+	}
+	base, err := m.store.Read()
+	if err != nil {
+		return nil, err
+	}
+	edited, err := edit(base)
+	if err != nil || len(edited) <= MaxMemorySizeWarningBytes {
+		return edit, nil
+	}
+
+	compacted, err := compactMemory(edited, m.compactor, MaxMemorySizeWarningBytes/2)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to compact memory file: %v\n", err)
+		return edit, nil
+	}
+	return func(current string) (string, error) {
+		if current != base {
+			return edit(current)
+		}
+		return compacted, nil
+	}, nil
+}
+
+// parseMemoryEntries splits memory content into entries. Joining the raw text of
+// the entries with newlines reproduces the original content.
+func parseMemoryEntries(content string) []MemoryEntry {
+	if content == "" {
+		return nil
+	}
+
+	lines := strings.Split(content, "\n")
+	var entries []MemoryEntry
+	var current []string
+
+	flush := func() {
+		if len(current) > 0 {
+			entries = append(entries, newMemoryEntry(current))
+		}
+		current = nil
 	}
 
-	// Warn if approaching size limit
-	if newSize > MaxMemorySizeWarningBytes && len(m.content) <= MaxMemorySizeWarningBytes {
-		fmt.Fprintf(os.Stderr, "Warning: Memory file size (%d bytes) is approaching the maximum limit (%d bytes). Consider archiving old entries.\n",
-			newSize, MaxMemorySizeBytes)
+	for i, line := range lines {
+		isSeparator := line == "---" && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "*Updated:")
+		if strings.HasPrefix(line, "## ") || isSeparator {
+			flush()
+		}
+		current = append(current, line)
+	}
+	flush()
+
+	return entries
+}
+
+// newMemoryEntry builds an entry from its lines
+func newMemoryEntry(lines []string) MemoryEntry {
+	entry := MemoryEntry{raw: strings.Join(lines, "\n")}
+	body := lines
+
+	switch {
+	case strings.HasPrefix(lines[0], "## "):
+		entry.Section = strings.TrimSpace(strings.TrimPrefix(lines[0], "## "))
+		body = lines[1:]
+	case lines[0] == "---":
+		entry.Appended = true
+		body = lines[1:]
+	}
+
+	if len(body) > 0 && strings.HasPrefix(body[0], "*Updated:") {
+		entry.Updated = strings.TrimSuffix(strings.TrimPrefix(body[0], "*Updated: "), "*")
+		body = body[1:]
 	}
 
-	m.content = newContent
-	return os.WriteFile(m.filePath, []byte(m.content), 0644)
+	entry.Content = strings.TrimSpace(strings.Join(body, "\n"))
+	return entry
+}
+
+// String renders the entry as it appears in the memory file
+func (e MemoryEntry) String() string {
+	return strings.TrimSpace(e.raw)
+}
+
+// compactMemory keeps the newest appended entries that fit in keepBytes and
+// replaces the older ones, together with any previous compacted history, by a
+// summary in the "Compacted History" section. Named sections are kept as they are.
+func compactMemory(content string, compactor Compactor, keepBytes int) (string, error) {
+	entries := parseMemoryEntries(content)
+
+	// Walk appended entries from newest to oldest to decide which to keep
+	keep := make(map[int]bool)
+	kept := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Appended {
+			continue
+		}
+		size := len(entries[i].raw)
+		if len(keep) > 0 && kept+size > keepBytes {
+			break
+		}
+		keep[i] = true
+		kept += size
+	}
+
+	var toSummarize []string
+	var blocks []string
+	var recent []string
+	for i, entry := range entries {
+		switch {
+		case entry.Section == compactedSectionName:
+			toSummarize = append(toSummarize, entry.Content)
+		case entry.Appended && keep[i]:
+			recent = append(recent, entry.String())
+		case entry.Appended:
+			text := entry.Content
+			if entry.Updated != "" {
+				text = fmt.Sprintf("(%s) %s", entry.Updated, text)
+			}
+			toSummarize = append(toSummarize, text)
+		case entry.String() != "":
+			blocks = append(blocks, entry.String())
+		}
+	}
+
+	// Nothing old enough to compact
+	if !hasOldAppendedEntries(entries, keep) {
+		return content, nil
+	}
+
+	summary, err := compactor(strings.Join(toSummarize, "\n\n"))
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize memory entries: %w", err)
+	}
+
+	compacted := fmt.Sprintf("## %s\n*Updated: %s*\n\n%s", compactedSectionName, getCurrentTimestamp(), strings.TrimSpace(summary))
+	blocks = append(blocks, compacted)
+	blocks = append(blocks, recent...)
+	return strings.Join(blocks, "\n\n") + "\n", nil
+}
+
+// hasOldAppendedEntries reports whether any appended entry falls outside the kept set
+func hasOldAppendedEntries(entries []MemoryEntry, keep map[int]bool) bool {
+	for i, entry := range entries {
+		if entry.Appended && !keep[i] {
+			return true
+		}
+	}
+	return false
 }
 
 // HasMemory returns true if a memory file is configured
 func (m *MemoryManager) HasMemory() bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.filePath != ""
+	return m.store != nil
 }
 
-// GetFilePath returns the path to the memory file
+// GetFilePath returns where the memory is stored: the memory file, or the
+// namespace's file or location within it
 func (m *MemoryManager) GetFilePath() string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.filePath
+	if m.store == nil {
+		return m.filePath
+	}
+	return m.store.Location()
 }
 
 // getCurrentTimestamp returns a formatted timestamp for memory updates
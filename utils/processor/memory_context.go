@@ -0,0 +1,245 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/vectorindex"
+)
+
+// defaultMemoryMaxTokens is the token budget for "relevant" memory injection
+const defaultMemoryMaxTokens = 2000
+
+// memoryCompactionPrompt asks a model to condense old memory entries
+const memoryCompactionPrompt = `The following are older entries from a project memory file. Condense them into a concise
+summary that preserves decisions, facts, names, numbers and open questions. Drop repetition
+and transient details. Respond with the summary only, as Markdown bullet points.
+
+`
+
+// memoryStopWords are ignored when ranking memory entries by keywords
+var memoryStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "that": true, "this": true,
+	"from": true, "are": true, "was": true, "were": true, "have": true, "has": true,
+	"not": true, "but": true, "you": true, "your": true, "our": true, "into": true,
+	"about": true, "what": true, "which": true, "when": true, "will": true, "can": true,
+}
+
+// withMemoryContext prepends the project memory context to an action
+func withMemoryContext(memoryContent, action string) string {
+	return fmt.Sprintf("Context from project memory:\n---\n%s\n---\n\n", memoryContent) + action
+}
+
+// buildMemoryContext returns the memory content to inject for a step, according
+// to its memory mode. query is the action the memory is injected into.
+func (p *Processor) buildMemoryContext(cfg MemoryConfig, query string) (string, error) {
+	switch cfg.Mode {
+	case MemoryModeSections:
+		// Use parsed entries so that entries appended after a section are not included in it
+		entries := p.memory.Entries()
+		var parts []string
+		for _, section := range cfg.Sections {
+			found := false
+			for _, entry := range entries {
+				if entry.Section == section && entry.Content != "" {
+					parts = append(parts, fmt.Sprintf("## %s\n%s", section, entry.Content))
+					found = true
+				}
+			}
+			if !found {
+				p.debugf("Memory section '%s' is empty or missing", section)
+			}
+		}
+		return strings.Join(parts, "\n\n"), nil
+
+	case MemoryModeRelevant:
+		entries := p.memory.Entries()
+		var candidates []MemoryEntry
+		for _, entry := range entries {
+			if entry.Content != "" {
+				candidates = append(candidates, entry)
+			}
+		}
+		if len(candidates) == 0 {
+			return "", nil
+		}
+
+		var scores []float64
+		if cfg.Model != "" {
+			var err error
+			scores, err = p.rankMemoryByEmbeddings(cfg.Model, candidates, query)
+			if err != nil {
+				return "", err
+			}
+		} else {
+			scores = rankMemoryByKeywords(candidates, query)
+		}
+
+		maxTokens := cfg.MaxTokens
+		if maxTokens <= 0 {
+			maxTokens = defaultMemoryMaxTokens
+		}
+		selected := selectMemoryEntries(candidates, scores, maxTokens*4) // ~4 characters per token
+		p.debugf("Selected %d of %d memory entries for relevant mode", len(selected), len(candidates))
+
+		parts := make([]string, len(selected))
+		for i, entry := range selected {
+			parts[i] = entry.String()
+		}
+		return strings.Join(parts, "\n\n"), nil
+
+	default:
+		return p.memory.GetMemory(), nil
+	}
+}
+
+// memoryTerms splits text into lowercase keywords, ignoring short words and stop words
+func memoryTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var terms []string
+	for _, word := range words {
+		if len(word) >= 3 && !memoryStopWords[word] {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// rankMemoryByKeywords scores entries by how many of the query's keywords they
+// contain, weighting rare keywords higher and normalizing by entry length
+func rankMemoryByKeywords(entries []MemoryEntry, query string) []float64 {
+	queryTerms := make(map[string]bool)
+	for _, term := range memoryTerms(query) {
+		queryTerms[term] = true
+	}
+
+	entryTerms := make([]map[string]int, len(entries))
+	documentFrequency := make(map[string]int)
+	for i, entry := range entries {
+		counts := make(map[string]int)
+		for _, term := range memoryTerms(entry.Section + " " + entry.Content) {
+			counts[term]++
+		}
+		entryTerms[i] = counts
+		for term := range counts {
+			documentFrequency[term]++
+		}
+	}
+
+	scores := make([]float64, len(entries))
+	for i, counts := range entryTerms {
+		total := 0
+		for _, count := range counts {
+			total += count
+		}
+		if total == 0 {
+			continue
+		}
+		for term := range queryTerms {
+			if counts[term] == 0 {
+				continue
+			}
+			idf := 1.0 + float64(len(entries))/float64(documentFrequency[term])
+			scores[i] += float64(counts[term]) * idf
+		}
+		scores[i] /= float64(total)
+	}
+	return scores
+}
+
+// rankMemoryByEmbeddings scores entries by the cosine similarity of their embeddings to the query
+func (p *Processor) rankMemoryByEmbeddings(modelName string, entries []MemoryEntry, query string) ([]float64, error) {
+	modelName, providerName, err := p.splitStepModel(modelName, "")
+	if err != nil {
+		return nil, err
+	}
+	embedder := models.DetectEmbedder(modelName, providerName)
+	if embedder == nil {
+		return nil, fmt.Errorf("no embedding backend found for memory model %s", modelName)
+	}
+	if err := p.configureStandaloneProvider(embedder); err != nil {
+		return nil, err
+	}
+
+	texts := make([]string, 0, len(entries)+1)
+	texts = append(texts, query)
+	for _, entry := range entries {
+		texts = append(texts, entry.String())
+	}
+
+	vectors, err := embedder.Embed(modelName, texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed memory entries: %w", err)
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(vectors))
+	}
+
+	scores := make([]float64, len(entries))
+	for i := range entries {
+		scores[i] = vectorindex.CosineSimilarity(vectors[0], vectors[i+1])
+	}
+	return scores, nil
+}
+
+// selectMemoryEntries picks the highest-scoring entries that fit in maxChars and
+// returns them in their original order. Entries with no relevance are skipped.
+func selectMemoryEntries(entries []MemoryEntry, scores []float64, maxChars int) []MemoryEntry {
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+
+	chosen := make(map[int]bool)
+	used := 0
+	for _, i := range order {
+		if scores[i] <= 0 {
+			break
+		}
+		size := len(entries[i].String())
+		if used+size > maxChars {
+			continue
+		}
+		chosen[i] = true
+		used += size
+	}
+
+	var selected []MemoryEntry
+	for i, entry := range entries {
+		if chosen[i] {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
+
+// summarizeMemory is the memory compactor. It uses memory_compaction_model, or
+// default_generation_model when that is not set.
+func (p *Processor) summarizeMemory(content string) (string, error) {
+	modelName := p.envConfig.MemoryCompactionModel
+	if modelName == "" {
+		modelName = p.envConfig.DefaultGenerationModel
+	}
+	if modelName == "" {
+		return "", fmt.Errorf("no model available for memory compaction (set memory_compaction_model or default_generation_model)")
+	}
+
+	provider := p.detectProvider(modelName)
+	if provider == nil {
+		return "", fmt.Errorf("no provider found for memory compaction model %s", modelName)
+	}
+	if err := p.configureStandaloneProvider(provider); err != nil {
+		return "", err
+	}
+
+	p.debugf("Compacting memory with model %s (%d chars)", modelName, len(content))
+	return provider.SendPrompt(p.bareModelName(modelName), memoryCompactionPrompt+content)
+}
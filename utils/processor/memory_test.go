@@ -0,0 +1,348 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+	"gopkg.in/yaml.v3"
+)
+
+const testMemoryContent = `# Project Memory
+
+## Architecture
+The API gateway forwards requests to the billing service.
+
+## Preferences
+Use tabs for indentation.
+
+---
+*Updated: 2026-01-01 10:00:00*
+
+Decided to migrate the database to Postgres.
+
+---
+*Updated: 2026-01-02 10:00:00*
+
+The frontend team prefers React with TypeScript.
+`
+
+func TestMemoryConfigUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    MemoryConfig
+		wantErr bool
+	}{
+		{"bool true", "memory: true", MemoryConfig{Enabled: true, Mode: MemoryModeFull}, false},
+		{"bool false", "memory: false", MemoryConfig{Enabled: false, Mode: MemoryModeFull}, false},
+		{"mode name", "memory: relevant", MemoryConfig{Enabled: true, Mode: MemoryModeRelevant}, false},
+		{"sections mapping", "memory:\n  sections: [Architecture]", MemoryConfig{Enabled: true, Mode: MemoryModeSections, Sections: []string{"Architecture"}}, false},
+		{"relevant mapping", "memory:\n  mode: relevant\n  max_tokens: 500", MemoryConfig{Enabled: true, Mode: MemoryModeRelevant, MaxTokens: 500}, false},
+		{"unknown mode", "memory: everything", MemoryConfig{}, true},
+		{"sections without list", "memory: sections", MemoryConfig{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config StepConfig
+			err := yaml.Unmarshal([]byte(tt.yaml), &config)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected error, got config %+v", config.Memory)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got := config.Memory
+			if got.Enabled != tt.want.Enabled || got.Mode != tt.want.Mode || got.MaxTokens != tt.want.MaxTokens ||
+				strings.Join(got.Sections, ",") != strings.Join(tt.want.Sections, ",") {
+				t.Errorf("Got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMemoryEntries(t *testing.T) {
+	entries := parseMemoryEntries(testMemoryContent)
+	if len(entries) != 5 {
+		t.Fatalf("Expected 5 entries, got %d", len(entries))
+	}
+
+	if entries[1].Section != "Architecture" || entries[1].Appended {
+		t.Errorf("Expected Architecture section, got %+v", entries[1])
+	}
+	if !entries[3].Appended || entries[3].Updated != "2026-01-01 10:00:00" {
+		t.Errorf("Expected appended entry with timestamp, got %+v", entries[3])
+	}
+	if entries[3].Content != "Decided to migrate the database to Postgres." {
+		t.Errorf("Unexpected entry content: %q", entries[3].Content)
+	}
+
+	// Joining the raw entries reproduces the content
+	var raw []string
+	for _, entry := range entries {
+		raw = append(raw, entry.raw)
+	}
+	if strings.Join(raw, "\n") != testMemoryContent {
+		t.Error("Expected entries to reproduce the original content")
+	}
+}
+
+func TestCompactMemory(t *testing.T) {
+	var summarized string
+	compactor := func(content string) (string, error) {
+		summarized = content
+		return "- Migrating to Postgres", nil
+	}
+
+	// A budget that only fits the newest entry
+	compacted, err := compactMemory(testMemoryContent, compactor, 100)
+	if err != nil {
+		t.Fatalf("compactMemory failed: %v", err)
+	}
+
+	if !strings.Contains(summarized, "Decided to migrate the database to Postgres.") {
+		t.Errorf("Expected the oldest entry to be summarized, got %q", summarized)
+	}
+	if strings.Contains(summarized, "React") {
+		t.Error("Expected the newest entry to be kept, not summarized")
+	}
+	for _, want := range []string{"## Architecture", "## Preferences", "## Compacted History", "- Migrating to Postgres", "React with TypeScript"} {
+		if !strings.Contains(compacted, want) {
+			t.Errorf("Expected compacted memory to contain %q:\n%s", want, compacted)
+		}
+	}
+	if strings.Contains(compacted, "Decided to migrate") {
+		t.Error("Expected the summarized entry to be removed")
+	}
+
+	// Compacting again folds the previous summary into the new one
+	summarized = ""
+	if _, err := compactMemory(compacted+"\n---\n*Updated: 2026-01-03 10:00:00*\n\nAnother note.\n", compactor, 30); err != nil {
+		t.Fatalf("Second compaction failed: %v", err)
+	}
+	if !strings.Contains(summarized, "- Migrating to Postgres") {
+		t.Errorf("Expected previous summary to be re-summarized, got %q", summarized)
+	}
+}
+
+func TestCompactMemoryNothingToCompact(t *testing.T) {
+	compactor := func(content string) (string, error) {
+		t.Fatal("Compactor should not be called")
+		return "", nil
+	}
+	compacted, err := compactMemory(testMemoryContent, compactor, len(testMemoryContent))
+	if err != nil {
+		t.Fatalf("compactMemory failed: %v", err)
+	}
+	if compacted != testMemoryContent {
+		t.Error("Expected content to be unchanged")
+	}
+}
+
+func TestBuildMemoryContext(t *testing.T) {
+	memoryPath := filepath.Join(t.TempDir(), "COMANDA.md")
+	if err := os.WriteFile(memoryPath, []byte(testMemoryContent), 0644); err != nil {
+		t.Fatalf("Failed to write memory file: %v", err)
+	}
+	memory, err := NewMemoryManager(memoryPath)
+	if err != nil {
+		t.Fatalf("Failed to create memory manager: %v", err)
+	}
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, "")
+	processor.memory = memory
+
+	t.Run("full", func(t *testing.T) {
+		got, err := processor.buildMemoryContext(MemoryConfig{Enabled: true, Mode: MemoryModeFull}, "anything")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got != testMemoryContent {
+			t.Errorf("Expected full memory, got %q", got)
+		}
+	})
+
+	t.Run("sections", func(t *testing.T) {
+		got, err := processor.buildMemoryContext(MemoryConfig{Enabled: true, Mode: MemoryModeSections, Sections: []string{"Preferences", "Missing"}}, "anything")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got != "## Preferences\nUse tabs for indentation." {
+			t.Errorf("Unexpected sections context: %q", got)
+		}
+	})
+
+	t.Run("relevant", func(t *testing.T) {
+		got, err := processor.buildMemoryContext(MemoryConfig{Enabled: true, Mode: MemoryModeRelevant}, "Which database are we migrating to?")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(got, "Postgres") {
+			t.Errorf("Expected the database entry, got %q", got)
+		}
+		if strings.Contains(got, "React") || strings.Contains(got, "billing") {
+			t.Errorf("Expected unrelated entries to be excluded, got %q", got)
+		}
+	})
+
+	t.Run("relevant with embeddings and budget", func(t *testing.T) {
+		// The test embedder counts cat/dog/bird, so only animal entries score
+		animalsPath := filepath.Join(t.TempDir(), "COMANDA.md")
+		content := "## Cats\nThe cat sleeps all day.\n\n## Dogs\nThe dog barks at the bird. The dog runs.\n"
+		if err := os.WriteFile(animalsPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write memory file: %v", err)
+		}
+		animals, err := NewMemoryManager(animalsPath)
+		if err != nil {
+			t.Fatalf("Failed to create memory manager: %v", err)
+		}
+		processor.memory = animals
+		defer func() { processor.memory = memory }()
+
+		embedder := &mockEmbedder{MockProvider: *NewMockProvider("openai")}
+		originalDetect := models.DetectEmbedder
+		models.DetectEmbedder = func(modelName string, providerName string) models.EmbeddingProvider {
+			return embedder
+		}
+		defer func() { models.DetectEmbedder = originalDetect }()
+
+		got, err := processor.buildMemoryContext(MemoryConfig{Enabled: true, Mode: MemoryModeRelevant, Model: "text-embedding-3-small", MaxTokens: 20}, "tell me about the dog")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if embedder.calls != 1 {
+			t.Errorf("Expected one embedding call, got %d", embedder.calls)
+		}
+		if !strings.HasPrefix(got, "## Dogs") || strings.Contains(got, "Cats") {
+			t.Errorf("Expected only the dog entry, got %q", got)
+		}
+	})
+}
+
+func TestMemoryManagersShareFile(t *testing.T) {
+	memoryPath := filepath.Join(t.TempDir(), "COMANDA.md")
+	if err := os.WriteFile(memoryPath, []byte("# Project Memory\n"), 0644); err != nil {
+		t.Fatalf("Failed to write memory file: %v", err)
+	}
+
+	// Two managers stand in for two comanda processes using the same file
+	first, err := NewMemoryManager(memoryPath)
+	if err != nil {
+		t.Fatalf("Failed to create memory manager: %v", err)
+	}
+	second, err := NewMemoryManager(memoryPath)
+	if err != nil {
+		t.Fatalf("Failed to create memory manager: %v", err)
+	}
+
+	if err := first.WriteMemorySection("Status", "first run"); err != nil {
+		t.Fatalf("WriteMemorySection failed: %v", err)
+	}
+	if err := second.AppendMemory("second run"); err != nil {
+		t.Fatalf("AppendMemory failed: %v", err)
+	}
+
+	data, err := os.ReadFile(memoryPath)
+	if err != nil {
+		t.Fatalf("Failed to read memory file: %v", err)
+	}
+	if !strings.Contains(string(data), "first run") || !strings.Contains(string(data), "second run") {
+		t.Errorf("Expected both writes to be kept, got:\n%s", data)
+	}
+	if !strings.Contains(second.GetMemorySection("Status"), "first run") {
+		t.Errorf("Expected the second manager to see the first write, got %q", second.GetMemorySection("Status"))
+	}
+}
+
+func TestCompactionOutsideFileLock(t *testing.T) {
+	memoryPath := filepath.Join(t.TempDir(), "COMANDA.md")
+	var content strings.Builder
+	content.WriteString("# Project Memory\n")
+	for content.Len() <= MaxMemorySizeWarningBytes {
+		content.WriteString("\n---\n*Updated: 2026-01-01 10:00:00*\n\n" + strings.Repeat("old note ", 1000) + "\n")
+	}
+	if err := os.WriteFile(memoryPath, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to write memory file: %v", err)
+	}
+
+	first, err := NewMemoryManager(memoryPath)
+	if err != nil {
+		t.Fatalf("Failed to create memory manager: %v", err)
+	}
+	other, err := NewMemoryManager(memoryPath)
+	if err != nil {
+		t.Fatalf("Failed to create memory manager: %v", err)
+	}
+
+	// Another process writes while the summary is made; holding the file lock
+	// here would block it
+	calls := 0
+	first.SetCompactor(func(content string) (string, error) {
+		calls++
+		if calls == 1 {
+			if err := other.AppendMemory("concurrent note"); err != nil {
+				t.Errorf("Concurrent write failed: %v", err)
+			}
+		}
+		return "- old notes", nil
+	})
+
+	// The file changed during the summary, so it is not applied
+	if err := first.AppendMemory("first note"); err != nil {
+		t.Fatalf("AppendMemory failed: %v", err)
+	}
+	memory := first.GetMemory()
+	if !strings.Contains(memory, "concurrent note") || !strings.Contains(memory, "first note") {
+		t.Fatal("Expected both writes to be kept")
+	}
+	if strings.Contains(memory, compactedSectionName) {
+		t.Error("Expected a stale compaction not to be applied")
+	}
+
+	// The next write compacts the unchanged file
+	if err := first.AppendMemory("second note"); err != nil {
+		t.Fatalf("AppendMemory failed: %v", err)
+	}
+	memory = first.GetMemory()
+	if calls != 2 || !strings.Contains(memory, "- old notes") || !strings.Contains(memory, "second note") {
+		t.Errorf("Expected the memory to be compacted, got %d calls and %d bytes", calls, len(memory))
+	}
+	if len(memory) > MaxMemorySizeWarningBytes {
+		t.Errorf("Expected compaction to shrink the memory, got %d bytes", len(memory))
+	}
+}
+
+func TestNamespacedMemoryManager(t *testing.T) {
+	memoryPath := filepath.Join(t.TempDir(), "COMANDA.md")
+	if err := os.WriteFile(memoryPath, []byte(testMemoryContent), 0644); err != nil {
+		t.Fatalf("Failed to write memory file: %v", err)
+	}
+
+	manager, err := NewNamespacedMemoryManager(memoryPath, "alice")
+	if err != nil {
+		t.Fatalf("Failed to create memory manager: %v", err)
+	}
+	if manager.GetMemory() != "" {
+		t.Error("Expected a new namespace to start empty")
+	}
+	if err := manager.AppendMemory("alice's note"); err != nil {
+		t.Fatalf("AppendMemory failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(memoryPath)
+	if strings.Contains(string(data), "alice") {
+		t.Error("Expected the namespace write to leave the main memory file unchanged")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(memoryPath), "COMANDA.alice.md")); err != nil {
+		t.Errorf("Expected the namespace file to be created: %v", err)
+	}
+
+	if _, err := NewNamespacedMemoryManager(memoryPath, "../bob"); err == nil {
+		t.Error("Expected an invalid namespace to be rejected")
+	}
+}
@@ -1,97 +1,15 @@
 package processor
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
-	"time"
 
+	"github.com/kris-hansen/comanda/utils/cassette"
 	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/keypool"
 	"github.com/kris-hansen/comanda/utils/models"
 )
 
-// --- Ollama specific types (copied from ollama.go for local check) ---
-
-// OllamaTagsResponse represents the top-level structure of Ollama's /api/tags response
-type OllamaTagsResponse struct {
-	Models []OllamaModelTag `json:"models"`
-}
-
-// OllamaModelTag represents the details of a single model tag from /api/tags
-type OllamaModelTag struct {
-	Name string `json:"name"`
-}
-
-// --- Helper function to check local Ollama models ---
-
-// checkOllamaModelExists queries the local Ollama instance to see if a model tag exists.
-func checkOllamaModelExists(modelName string) (bool, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get("http://localhost:11434/api/tags")
-	if err != nil {
-		if strings.Contains(err.Error(), "connection refused") {
-			return false, fmt.Errorf("failed to connect to Ollama at http://localhost:11434 to verify model '%s'. Is Ollama running?", modelName)
-		}
-		return false, fmt.Errorf("error calling Ollama /api/tags to verify model '%s': %v", modelName, err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("Ollama /api/tags returned non-OK status %d while verifying model '%s': %s", resp.StatusCode, modelName, string(bodyBytes))
-	}
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, fmt.Errorf("error reading Ollama /api/tags response body while verifying model '%s': %v", modelName, err)
-	}
-
-	var tagsResponse OllamaTagsResponse
-	if err := json.Unmarshal(bodyBytes, &tagsResponse); err != nil {
-		return false, fmt.Errorf("error unmarshaling Ollama /api/tags response while verifying model '%s': %v. Body: %s", modelName, err, string(bodyBytes))
-	}
-
-	modelNameLower := strings.ToLower(modelName)
-	for _, model := range tagsResponse.Models {
-		modelFullName := strings.ToLower(model.Name)
-
-		// First check exact match
-		if modelFullName == modelNameLower {
-			return true, nil // Model found (exact match)
-		}
-
-		// Then check if the requested model matches the base name (before :tag)
-		// e.g., "gpt-oss" should match "gpt-oss:latest"
-		if strings.Contains(modelFullName, ":") {
-			baseName := strings.Split(modelFullName, ":")[0]
-			if baseName == modelNameLower {
-				return true, nil // Model found (tag match)
-			}
-		}
-
-		// Also check if the full model name starts with the requested name
-		// e.g., "llama3" should match "llama3.2:latest"
-		if strings.HasPrefix(modelFullName, modelNameLower) {
-			// Make sure we're not matching partial names unintentionally
-			nextChar := modelFullName[len(modelNameLower):]
-			if strings.HasPrefix(nextChar, ":") || strings.HasPrefix(nextChar, ".") {
-				return true, nil // Model found (prefix match)
-			}
-		}
-	}
-
-	// Model not found in the list
-	// Construct a helpful error message suggesting how to pull the model
-	availableModels := make([]string, len(tagsResponse.Models))
-	for i, m := range tagsResponse.Models {
-		availableModels[i] = m.Name
-	}
-	errMsg := fmt.Sprintf("model tag '%s' not found in local Ollama instance. Available models: %v. Try running 'ollama pull %s'", modelName, availableModels, modelName)
-	return false, fmt.Errorf(errMsg)
-}
-
 // validateModel checks if the specified model is supported and has the required capabilities
 func (p *Processor) validateModel(modelNames []string, inputs []string) error {
 	if len(modelNames) == 0 {
@@ -108,12 +26,23 @@ func (p *Processor) validateModel(modelNames []string, inputs []string) error {
 	for _, modelName := range modelNames {
 		p.debugf("Starting validation for model: %s", modelName)
 		p.debugf("Attempting provider detection for model: %s", modelName)
-		provider := models.DetectProvider(modelName)
+		provider := p.detectProvider(modelName)
 		p.debugf("Provider detection result for %s: found=%v", modelName, provider != nil)
 		if provider == nil {
-			errMsg := fmt.Sprintf("unsupported model: %s (no provider found)", modelName)
-			p.debugf("Validation failed: %s", errMsg)
-			return fmt.Errorf(errMsg)
+			// Report why the name could not be resolved, e.g. an unknown model or alias
+			_, err := p.resolveModel(modelName)
+			if err == nil {
+				err = fmt.Errorf("unsupported model: %s (no provider found)", modelName)
+			}
+			p.debugf("Validation failed: %v", err)
+			return err
+		}
+
+		// Aliases and provider prefixes are not part of the name the provider knows
+		qualifiedName := modelName
+		modelName := p.bareModelName(modelName)
+		if modelName != qualifiedName {
+			p.debugf("Model %s resolved to %s/%s", qualifiedName, provider.Name(), modelName)
 		}
 
 		// Check if the provider actually supports this model
@@ -128,25 +57,15 @@ func (p *Processor) validateModel(modelNames []string, inputs []string) error {
 		// Get provider name
 		providerName := provider.Name()
 
-		// --- Add Ollama specific local check ---
-		if providerName == "ollama" {
-			p.debugf("Performing local check for Ollama model tag: %s", modelName)
-			exists, err := checkOllamaModelExists(modelName)
-			if err != nil {
-				// Error occurred during check (e.g., connection refused, API error)
-				p.debugf("Ollama local check failed for %s: %v", modelName, err)
-				return fmt.Errorf("Ollama check failed: %w", err) // Wrap the specific error
-			}
-			if !exists {
-				// Model tag specifically not found in the list from /api/tags
-				// The error from checkOllamaModelExists already contains the helpful message
-				p.debugf("Ollama model tag %s not found locally.", modelName)
-				// The error from checkOllamaModelExists includes the suggestion to pull
-				return fmt.Errorf("model tag '%s' not found locally via Ollama API", modelName)
+		// Ollama models must be pulled on the host they are routed to
+		if ollamaProvider, ok := provider.(*models.OllamaProvider); ok {
+			p.debugf("Checking Ollama host %s (%s) for model tag: %s", providerName, ollamaProvider.Endpoint(), modelName)
+			if err := ollamaProvider.CheckModel(modelName); err != nil {
+				p.debugf("Ollama check failed for %s: %v", modelName, err)
+				return err
 			}
-			p.debugf("Ollama model tag %s confirmed to exist locally.", modelName)
+			p.debugf("Ollama model tag %s confirmed to exist.", modelName)
 		}
-		// --- End Ollama specific check ---
 
 		// Get model configuration from environment
 		p.debugf("Getting model configuration for %s from provider %s", modelName, providerName)
@@ -200,56 +119,185 @@ func (p *Processor) configureProviders() error {
 	p.debugf("Configuring providers")
 
 	for providerName, provider := range p.providers {
-		p.debugf("Configuring provider %s", providerName)
+		if err := p.configureProvider(providerName, provider); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		// Handle Ollama provider separately since it doesn't need an API key, but expects "LOCAL"
-		if providerName == "ollama" {
-			if err := provider.Configure("LOCAL"); err != nil { // Pass "LOCAL" as expected by OllamaProvider.Configure
+// configureProvider configures one provider instance. Entries with a type in the
+// configuration (openai-compatible endpoints, named Ollama hosts) are resolved
+// by their instance name; local providers are configured with "LOCAL".
+func (p *Processor) configureProvider(providerName string, provider models.Provider) error {
+	p.debugf("Configuring provider %s", providerName)
+
+	kind := providerName
+	providerConfig, configErr := p.envConfig.GetProviderConfig(providerName)
+	if configErr == nil {
+		if err := providerConfig.ValidateKeys(); err != nil {
+			return fmt.Errorf("invalid API keys for provider %s: %w", providerName, err)
+		}
+		// Generic OpenAI-compatible endpoints handle their own auth schemes
+		if providerConfig.IsOpenAICompatible() {
+			var apiKey string
+			if providerConfig.HasAPIKey() {
+				key, err := keypool.Get(providerName, providerConfig).Select(p.project)
+				if err != nil {
+					return err
+				}
+				apiKey = key.Key
+			}
+			if err := provider.Configure(apiKey); err != nil {
 				return fmt.Errorf("failed to configure provider %s: %w", providerName, err)
 			}
-			p.debugf("Successfully configured local provider %s", providerName)
-			continue
-		}
-
-		var providerConfig *config.Provider
-		var err error
-
-		switch providerName {
-		case "anthropic":
-			providerConfig, err = p.envConfig.GetProviderConfig("anthropic")
-		case "openai":
-			providerConfig, err = p.envConfig.GetProviderConfig("openai")
-		case "google":
-			providerConfig, err = p.envConfig.GetProviderConfig("google")
-		case "xai":
-			providerConfig, err = p.envConfig.GetProviderConfig("xai")
-		case "deepseek":
-			providerConfig, err = p.envConfig.GetProviderConfig("deepseek")
-		case "moonshot":
-			providerConfig, err = p.envConfig.GetProviderConfig("moonshot")
-		default:
-			return fmt.Errorf("unknown provider: %s", providerName)
+			p.debugf("Successfully configured openai-compatible provider %s", providerName)
+			return nil
 		}
+		kind = providerConfig.Kind(providerName)
+	}
 
-		if err != nil {
-			return fmt.Errorf("failed to get config for provider %s: %w", providerName, err)
-		}
+	factory, ok := models.LookupProvider(kind)
+	if !ok {
+		return fmt.Errorf("unknown provider: %s", providerName)
+	}
 
-		if providerConfig.APIKey == "" {
-			return fmt.Errorf("missing API key for provider %s", providerName)
+	// Local providers don't need an API key, but expect "LOCAL"
+	if factory.Local {
+		if err := provider.Configure("LOCAL"); err != nil {
+			return fmt.Errorf("failed to configure provider %s: %w", providerName, err)
 		}
+		p.debugf("Successfully configured local provider %s", providerName)
+		return nil
+	}
 
-		p.debugf("Found API key for provider %s", providerName)
+	if configErr != nil {
+		return fmt.Errorf("failed to get config for provider %s: %w", providerName, configErr)
+	}
 
-		if err := provider.Configure(providerConfig.APIKey); err != nil {
-			return fmt.Errorf("failed to configure provider %s: %w", providerName, err)
+	if !providerConfig.HasAPIKey() {
+		// Replayed requests are answered without authentication
+		if cassette.Replaying() {
+			if err := provider.Configure(cassette.ReplayKey); err != nil {
+				return fmt.Errorf("failed to configure provider %s: %w", providerName, err)
+			}
+			p.debugf("Configured provider %s without an API key for replaying", providerName)
+			return nil
 		}
+		return fmt.Errorf("missing API key for provider %s", providerName)
+	}
 
-		p.debugf("Successfully configured provider %s", providerName)
+	// Providers with several keys start with the next key of the project;
+	// requests rotate through the keys from there
+	key, err := keypool.Get(providerName, providerConfig).Select(p.project)
+	if err != nil {
+		return err
 	}
+	p.debugf("Found API key %s for provider %s", key.Name, providerName)
+
+	if err := provider.Configure(key.Key); err != nil {
+		return fmt.Errorf("failed to configure provider %s: %w", providerName, err)
+	}
+
+	p.debugf("Successfully configured provider %s", providerName)
 	return nil
 }
 
+// stepParams returns the generation parameters of a step. The temperature,
+// top_p and max_output_tokens fields of openai-responses steps are shorthands
+// for the params block.
+func stepParams(step StepConfig) config.ModelParams {
+	params := step.Params
+	if params.Temperature == nil && step.Temperature != 0 {
+		temperature := step.Temperature
+		params.Temperature = &temperature
+	}
+	if params.TopP == nil && step.TopP != 0 {
+		topP := step.TopP
+		params.TopP = &topP
+	}
+	if params.MaxTokens == nil && step.MaxOutputTokens != 0 {
+		maxTokens := step.MaxOutputTokens
+		params.MaxTokens = &maxTokens
+	}
+	return params
+}
+
+// modelParams merges the model's default parameters from the environment
+// configuration with the parameters of a step, which take precedence
+func (p *Processor) modelParams(providerName string, modelName string, stepParams config.ModelParams) config.ModelParams {
+	var params config.ModelParams
+	if modelConfig, err := p.envConfig.GetModelConfig(providerName, modelName); err == nil {
+		params = modelConfig.Params
+	}
+	return params.Merge(stepParams)
+}
+
+// providerWithParams configures a new provider instance with generation
+// parameters, so that they do not leak into other steps using the same provider
+func (p *Processor) providerWithParams(provider models.Provider, modelName string, params config.ModelParams) (models.Provider, error) {
+	if err := p.configureProvider(provider.Name(), provider); err != nil {
+		return nil, err
+	}
+	provider.SetVerbose(p.verbose)
+	if err := models.ConfigureParams(provider, modelName, params); err != nil {
+		return nil, err
+	}
+	p.debugf("Using params %s for model %s", strings.Join(params.Names(), ", "), modelName)
+	return provider, nil
+}
+
+// stepProvider returns the provider that sends the requests of a step
+func stepProvider(provider models.Provider, step string) models.Provider {
+	if sp, ok := provider.(models.StepProvider); ok {
+		return sp.ForStep(step)
+	}
+	return provider
+}
+
+// detectProvider returns the provider for a model name. Workflows with a config:
+// block resolve models with their own routing; others use the loaded configuration.
+func (p *Processor) detectProvider(modelName string) models.Provider {
+	if p.routing != nil {
+		return p.routing.DetectProvider(modelName)
+	}
+	return models.DetectProvider(modelName)
+}
+
+// resolveModel determines the provider that serves a model name, as detectProvider does
+func (p *Processor) resolveModel(modelName string) (models.ModelRef, error) {
+	if p.routing != nil {
+		return p.routing.ResolveModel(modelName)
+	}
+	return models.ResolveModel(modelName)
+}
+
+// bareModelName returns the model name to send to the provider's API
+func (p *Processor) bareModelName(modelName string) string {
+	if p.routing != nil {
+		return p.routing.BareModelName(modelName)
+	}
+	return models.BareModelName(modelName)
+}
+
+// splitStepModel expands aliases and a provider prefix for the backends that are
+// chosen by provider name (embeddings, image generation and transcription). An
+// explicit provider setting takes precedence over the prefix.
+func (p *Processor) splitStepModel(modelName string, providerName string) (string, string, error) {
+	split := models.SplitModelName
+	if p.routing != nil {
+		split = p.routing.SplitModelName
+	}
+	prefix, bare, err := split(modelName)
+	if err != nil {
+		return "", "", err
+	}
+	if providerName == "" {
+		providerName = prefix
+	}
+	return bare, providerName, nil
+}
+
 // GetModelProvider returns the provider for the specified model
 func (p *Processor) GetModelProvider(modelName string) models.Provider {
 	// Special case: if model is "NA", return nil since no provider is needed
@@ -257,7 +305,7 @@ func (p *Processor) GetModelProvider(modelName string) models.Provider {
 		return nil
 	}
 
-	provider := models.DetectProvider(modelName)
+	provider := p.detectProvider(modelName)
 	if provider == nil {
 		return nil
 	}
@@ -1,7 +1,14 @@
 package processor
 
 import (
+	"fmt"
 	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/keypool"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/ratelimit"
 )
 
 func TestValidateModel(t *testing.T) {
@@ -138,3 +145,108 @@ func TestConfigureProviders(t *testing.T) {
 	// Restore original DetectProvider after tests
 	restoreDetectProvider()
 }
+
+func TestModelParams(t *testing.T) {
+	envConfig := createTestEnvConfig()
+	defaultTemperature := 0.2
+	defaultSeed := 7
+	envConfig.Providers["openai"].Models[1].Params = config.ModelParams{Temperature: &defaultTemperature, Seed: &defaultSeed}
+	processor := NewProcessor(&DSLConfig{}, envConfig, createTestServerConfig(), false, "")
+
+	zero := 0.0
+	step := StepConfig{MaxOutputTokens: 100, Params: config.ModelParams{Temperature: &zero}}
+	params := processor.modelParams("openai", "gpt-4o", stepParams(step))
+
+	if params.Temperature == nil || *params.Temperature != 0 {
+		t.Errorf("Step temperature should override the model default, got %v", params.Temperature)
+	}
+	if params.Seed == nil || *params.Seed != 7 {
+		t.Errorf("Model default seed should be kept, got %v", params.Seed)
+	}
+	if params.MaxTokens == nil || *params.MaxTokens != 100 {
+		t.Errorf("max_output_tokens should become max_tokens, got %v", params.MaxTokens)
+	}
+
+	if _, err := processor.providerWithParams(models.NewAnthropicProvider(), "claude-3-5-sonnet-latest", config.ModelParams{Seed: &defaultSeed}); err == nil {
+		t.Error("Expected seed to be rejected for an Anthropic model")
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	ratelimit.Reset()
+	defer ratelimit.Reset()
+	envConfig := createTestEnvConfig()
+	envConfig.Providers["openai"].RateLimit = &config.RateLimit{RequestsPerMinute: 1200} // One request per 50ms
+	processor := NewProcessor(&DSLConfig{}, envConfig, createTestServerConfig(), false, "")
+
+	limiter, err := processor.newThrottle("openai", "gpt-4o", NewMockProvider("openai"))
+	if err != nil {
+		t.Fatalf("newThrottle failed: %v", err)
+	}
+	// Use up the bucket so that the next requests wait for the refill
+	for i := 0; i < 1200; i++ {
+		ratelimit.Get("openai", *envConfig.Providers["openai"].RateLimit).Reserve(0)
+	}
+
+	for i := 0; i < 2; i++ {
+		response, err := limiter.send("prompt", nil, func() (string, error) { return "ok", nil })
+		if err != nil || response != "ok" {
+			t.Fatalf("send = %q, %v", response, err)
+		}
+	}
+	if limiter.waited < 50*time.Millisecond {
+		t.Errorf("The throttle should record the time spent waiting, got %v", limiter.waited)
+	}
+
+	// Models without limits are not throttled
+	unlimited, err := processor.newThrottle("anthropic", "claude-3-5-sonnet-latest", NewMockProvider("anthropic"))
+	if err != nil || len(unlimited.limits) != 0 {
+		t.Errorf("Expected no limits for anthropic, got %+v, %v", unlimited, err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	keypool.Reset()
+	defer keypool.Reset()
+	envConfig := createTestEnvConfig()
+	envConfig.Providers["openai"].APIKeys = []config.APIKey{
+		{Name: "revoked", Key: "sk-revoked"},
+		{Name: "working", Key: "sk-working"},
+		{Name: "research", Key: "sk-research", Project: "research"},
+	}
+	processor := NewProcessor(&DSLConfig{}, envConfig, createTestServerConfig(), false, "")
+
+	provider := NewMockProvider("openai")
+	limiter, err := processor.newThrottle("openai", "gpt-4o", provider)
+	if err != nil {
+		t.Fatalf("newThrottle failed: %v", err)
+	}
+	request := func() (string, error) {
+		if provider.apiKey == "sk-revoked" {
+			return "", fmt.Errorf("error, status code: 401, message: Incorrect API key provided")
+		}
+		return "sent with " + provider.apiKey, nil
+	}
+
+	// The revoked key is taken out of rotation and the request repeated
+	for i := 0; i < 3; i++ {
+		response, err := limiter.send("prompt", nil, request)
+		if err != nil || response != "sent with sk-working" {
+			t.Fatalf("Request %d: %q, %v", i, response, err)
+		}
+	}
+	usage := keypool.AllUsage()
+	if len(usage) != 3 || !usage[1].Disabled || usage[1].Requests != 1 || usage[2].Requests != 3 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	// A project uses only its own keys
+	processor.SetProject("research")
+	limiter, _ = processor.newThrottle("openai", "gpt-4o", provider)
+	if response, err := limiter.send("prompt", nil, request); err != nil || response != "sent with sk-research" {
+		t.Errorf("Project request: %q, %v", response, err)
+	}
+	if !processor.rotatesKeys("openai") || processor.rotatesKeys("anthropic") {
+		t.Error("Only providers with several keys should rotate")
+	}
+}
@@ -60,11 +60,13 @@ func (p *Processor) handleOutput(modelName string, response string, outputs []st
 						"- Input processing: %d ms\n"+
 						"- Model processing: %d ms\n"+
 						"- Action processing: %d ms\n"+
+						"%s"+
 						"- Output processing: (in progress)\n"+
 						"- Total processing: (in progress)\n",
 						metrics.InputProcessingTime,
 						metrics.ModelProcessingTime,
-						metrics.ActionProcessingTime)
+						metrics.ActionProcessingTime,
+						rateLimitWaitLine(metrics))
 				}
 
 				// Add performance metrics to the output
@@ -92,47 +94,24 @@ func (p *Processor) handleOutput(modelName string, response string, outputs []st
 						"- Input processing: %d ms\n"+
 						"- Model processing: %d ms\n"+
 						"- Action processing: %d ms\n"+
+						"%s"+
 						"- Output processing: (in progress)\n"+
 						"- Total processing: (in progress)\n",
 						metrics.InputProcessingTime,
 						metrics.ModelProcessingTime,
-						metrics.ActionProcessingTime)
+						metrics.ActionProcessingTime,
+						rateLimitWaitLine(metrics))
 				}
 			}
 			p.debugf("[%s] Response written to STDOUT", modelName)
 		} else {
-			// Determine the output path based on server mode and runtime directory
-			outputPath := output
-			if p.serverConfig != nil {
-				if p.runtimeDir != "" {
-					// When runtime directory is set, treat all output paths as relative to it
-					p.debugf("Using runtime directory: %s, output path: %s", p.runtimeDir, output)
-					outputPath = filepath.Join(p.serverConfig.DataDir, p.runtimeDir, output)
-				} else {
-					// No runtime directory, use DataDir directly
-					outputPath = filepath.Join(p.serverConfig.DataDir, output)
-				}
-				p.debugf("Resolved output path: %s", outputPath)
-			}
-
-			// Create directory if it doesn't exist
-			dir := filepath.Dir(outputPath)
-			if dir != "." {
-				p.debugf("Creating directory if it doesn't exist: %s", dir)
-				if err := os.MkdirAll(dir, 0755); err != nil {
-					return fmt.Errorf("failed to create directory %s: %w", dir, err)
-				}
-			}
-
-			// Write to file
-				p.debugf("[%s] Writing response to file: %s", modelName, outputPath)
+			p.debugf("[%s] Writing response to file: %s", modelName, output)
 			p.debugf("[%s] Response length: %d characters", modelName, len(response))
 			p.debugf("[%s] First 100 characters: %s", modelName, response[:min(100, len(response))])
 
-			if err := os.WriteFile(outputPath, []byte(response), 0644); err != nil {
-				errMsg := fmt.Sprintf("failed to write response to file %s: %v", outputPath, err)
-				p.debugf(errMsg)
-				return fmt.Errorf(errMsg)
+			outputPath, err := p.writeOutputFile(output, []byte(response))
+			if err != nil {
+				return err
 			}
 			p.debugf("[%s] Response successfully written to file: %s", modelName, outputPath)
 
@@ -142,3 +121,53 @@ func (p *Processor) handleOutput(modelName string, response string, outputs []st
 	}
 	return nil
 }
+
+// resolveOutputPath maps an output file name to its location on disk, placing
+// it under the server data directory (and runtime directory) in server mode
+func (p *Processor) resolveOutputPath(output string) string {
+	if p.serverConfig == nil {
+		return output
+	}
+	var outputPath string
+	if p.runtimeDir != "" {
+		// When runtime directory is set, treat all output paths as relative to it
+		p.debugf("Using runtime directory: %s, output path: %s", p.runtimeDir, output)
+		outputPath = filepath.Join(p.serverConfig.DataDir, p.runtimeDir, output)
+	} else {
+		// No runtime directory, use DataDir directly
+		outputPath = filepath.Join(p.serverConfig.DataDir, output)
+	}
+	p.debugf("Resolved output path: %s", outputPath)
+	return outputPath
+}
+
+// writeOutputFile writes data to an output file, creating parent directories
+// as needed, and returns the resolved path
+func (p *Processor) writeOutputFile(output string, data []byte) (string, error) {
+	outputPath := p.resolveOutputPath(output)
+
+	// Create directory if it doesn't exist
+	dir := filepath.Dir(outputPath)
+	if dir != "." {
+		p.debugf("Creating directory if it doesn't exist: %s", dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		errMsg := fmt.Sprintf("failed to write response to file %s: %v", outputPath, err)
+		p.debugf(errMsg)
+		return "", fmt.Errorf(errMsg)
+	}
+	return outputPath, nil
+}
+
+// rateLimitWaitLine returns the metrics line for the time spent waiting for rate
+// limits, or nothing when the step did not wait
+func rateLimitWaitLine(metrics *PerformanceMetrics) string {
+	if metrics.RateLimitWaitTime == 0 {
+		return ""
+	}
+	return fmt.Sprintf("- Rate limit wait: %d ms\n", metrics.RateLimitWaitTime)
+}
@@ -17,6 +17,13 @@ func TestHandleOutput(t *testing.T) {
 	}
 	defer os.RemoveAll(tempDir)
 
+	// CLI mode cases change into tempDir; restore the working directory before it is removed
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
 	// Get absolute path for DataDir
 	absDataDir, err := filepath.Abs(tempDir)
 	if err != nil {
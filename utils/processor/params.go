@@ -0,0 +1,238 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseParams parses --param flags of the form key=value
+func ParseParams(flags []string) (map[string]string, error) {
+	params := make(map[string]string)
+	for _, flag := range flags {
+		key, value, ok := strings.Cut(flag, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid param '%s': expected key=value", flag)
+		}
+		params[key] = value
+	}
+	return params, nil
+}
+
+// paramNames returns the names of the declared params in a stable order
+func (m *WorkflowMeta) paramNames() []string {
+	names := make([]string, 0, len(m.Params))
+	for name := range m.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validate checks the param declarations of the workflow block
+func (m *WorkflowMeta) validate() error {
+	for _, name := range m.paramNames() {
+		spec := m.Params[name]
+		if spec.Type == "" {
+			spec.Type = ParamString
+			m.Params[name] = spec
+		}
+		switch spec.Type {
+		case ParamString, ParamInt, ParamBool, ParamFile:
+		case ParamEnum:
+			if len(spec.Values) == 0 {
+				return fmt.Errorf("param '%s' of type enum requires a list of values", name)
+			}
+		default:
+			return fmt.Errorf("param '%s' has unknown type '%s' (must be string, int, bool, file or enum)", name, spec.Type)
+		}
+		if spec.Default != nil && spec.Type != ParamFile {
+			if err := checkParamValue(spec, fmt.Sprint(spec.Default)); err != nil {
+				return fmt.Errorf("default of param '%s': %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkParamValue checks that a value matches the type of a param; file params
+// are checked by the processor, which knows where paths are resolved
+func checkParamValue(spec ParamSpec, value string) error {
+	switch spec.Type {
+	case ParamInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("must be an int, got '%s'", value)
+		}
+	case ParamBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("must be true or false, got '%s'", value)
+		}
+	case ParamEnum:
+		for _, allowed := range spec.Values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s, got '%s'", strings.Join(spec.Values, ", "), value)
+	}
+	return nil
+}
+
+// SetParams sets the values of the workflow's params, e.g. from --param flags
+// or a server request, and reports values that do not match the workflow block
+func (p *Processor) SetParams(values map[string]string) error {
+	p.params = values
+	_, err := p.resolveParams()
+	return err
+}
+
+// resolveParams validates the given params against the workflow block and
+// fills in defaults. Without a workflow block the values are used as given.
+func (p *Processor) resolveParams() (map[string]string, error) {
+	if p.config == nil || p.config.Workflow == nil || len(p.config.Workflow.Params) == 0 {
+		return p.params, nil
+	}
+	meta := p.config.Workflow
+
+	var problems []string
+	var unknown []string
+	for name := range p.params {
+		if _, ok := meta.Params[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, fmt.Sprintf("unknown param '%s' (declared: %s)", name, strings.Join(meta.paramNames(), ", ")))
+	}
+
+	resolved := make(map[string]string, len(meta.Params))
+	for _, name := range meta.paramNames() {
+		spec := meta.Params[name]
+		value, ok := p.params[name]
+		if ok && value == "" && spec.Required {
+			ok = false
+		}
+		if !ok {
+			switch {
+			case spec.Default != nil:
+				value = fmt.Sprint(spec.Default)
+			case spec.Required:
+				problem := fmt.Sprintf("missing required param '%s'", name)
+				if spec.Description != "" {
+					problem += fmt.Sprintf(" (%s)", spec.Description)
+				}
+				problems = append(problems, problem)
+				continue
+			default:
+				value = ""
+			}
+		}
+		if spec.Type == ParamFile && value != "" {
+			if err := p.checkParamPath(value); err != nil {
+				problems = append(problems, fmt.Sprintf("param '%s' %v", name, err))
+				continue
+			}
+			if info, err := os.Stat(p.resolveParamPath(value)); err != nil || info.IsDir() {
+				problems = append(problems, fmt.Sprintf("param '%s' must be an existing file, got '%s'", name, value))
+				continue
+			}
+		} else if value != "" || ok {
+			if err := checkParamValue(spec, value); err != nil {
+				problems = append(problems, fmt.Sprintf("param '%s' %v", name, err))
+				continue
+			}
+		}
+		resolved[name] = value
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid params: %s", strings.Join(problems, "; "))
+	}
+	return resolved, nil
+}
+
+// resolveParamPath returns where a file param is read from, following the
+// rules of step inputs: relative to the runtime directory and, in server mode,
+// to the data directory
+func (p *Processor) resolveParamPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if p.serverConfig != nil && (p.serverConfig.Enabled || p.runtimeDir != "") && p.serverConfig.DataDir != "" {
+		return filepath.Join(p.serverConfig.DataDir, p.runtimeDir, path)
+	}
+	if p.runtimeDir != "" {
+		return filepath.Join(p.runtimeDir, path)
+	}
+	return path
+}
+
+// checkParamPath rejects, in server mode, a path given through params that
+// resolves outside the data directory, e.g. /etc/passwd or ../../secrets, so
+// that callers cannot read other files of the server into a prompt
+func (p *Processor) checkParamPath(path string) error {
+	if p.serverConfig == nil || !(p.serverConfig.Enabled || p.runtimeDir != "") {
+		return nil
+	}
+	base := filepath.Join(p.serverConfig.DataDir, p.runtimeDir)
+	if base == "" {
+		base = "."
+	}
+	resolved := path
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(base, resolved)
+	}
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return err
+	}
+	absResolved, err := filepath.Abs(resolved)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(absBase, absResolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("must be a path within the data directory, got '%s'", path)
+	}
+	return nil
+}
+
+// substituteInputParams replaces params in step inputs, e.g. input: $document.
+// Inputs that params turn into paths are checked with checkParamPath.
+func (p *Processor) substituteInputParams(inputs []string) error {
+	for i, input := range inputs {
+		if strings.HasPrefix(input, "STDIN") {
+			continue
+		}
+		substituted := p.substituteParams(input)
+		if substituted != input && !p.isURL(substituted) {
+			if err := p.checkParamPath(substituted); err != nil {
+				return fmt.Errorf("input '%s' %w", input, err)
+			}
+		}
+		inputs[i] = substituted
+	}
+	return nil
+}
+
+// substituteParams replaces $name references to the workflow's params, e.g. in
+// step inputs; longer names go first so that $topic does not match $topic_hint
+func (p *Processor) substituteParams(text string) string {
+	if len(p.paramValues) == 0 || !strings.Contains(text, "$") {
+		return text
+	}
+	names := make([]string, 0, len(p.paramValues))
+	for name := range p.paramValues {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	for _, name := range names {
+		text = strings.ReplaceAll(text, "$"+name, p.paramValues[name])
+	}
+	return text
+}
@@ -0,0 +1,231 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"gopkg.in/yaml.v3"
+)
+
+func TestWorkflowParams(t *testing.T) {
+	tmpDir := t.TempDir()
+	document := filepath.Join(tmpDir, "doc.txt")
+	if err := os.WriteFile(document, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	workflow := `
+workflow:
+  name: summarize
+  version: "1.2"
+  description: Summarize a document
+  params:
+    document:
+      type: file
+      required: true
+    style:
+      type: enum
+      values: [short, long]
+      default: short
+    words:
+      type: int
+      default: 100
+    cite:
+      type: bool
+    audience:
+      description: Who the summary is for
+
+summarize:
+  input: $document
+  model: gpt-4o
+  action: Summarize in a $style form with at most $words words for $audience
+  output: STDOUT
+`
+	var dslConfig DSLConfig
+	if err := yaml.Unmarshal([]byte(workflow), &dslConfig); err != nil {
+		t.Fatalf("Failed to parse workflow: %v", err)
+	}
+	if dslConfig.Workflow == nil || dslConfig.Workflow.Name != "summarize" || dslConfig.Workflow.Version != "1.2" {
+		t.Fatalf("Expected the workflow block to be parsed, got %+v", dslConfig.Workflow)
+	}
+	if len(dslConfig.Steps) != 1 {
+		t.Fatalf("The workflow block should not be a step, got %d steps", len(dslConfig.Steps))
+	}
+	if dslConfig.Workflow.Params["audience"].Type != ParamString {
+		t.Errorf("Expected params to default to type string, got %q", dslConfig.Workflow.Params["audience"].Type)
+	}
+
+	tests := []struct {
+		name     string
+		params   map[string]string
+		expected map[string]string
+		errors   []string
+	}{
+		{
+			name:     "defaults",
+			params:   map[string]string{"document": document},
+			expected: map[string]string{"document": document, "style": "short", "words": "100", "cite": "", "audience": ""},
+		},
+		{
+			name:     "given values",
+			params:   map[string]string{"document": document, "style": "long", "words": "250", "cite": "true", "audience": "engineers"},
+			expected: map[string]string{"document": document, "style": "long", "words": "250", "cite": "true", "audience": "engineers"},
+		},
+		{
+			name:   "all problems are reported",
+			params: map[string]string{"style": "medium", "words": "many", "cite": "maybe", "pages": "3"},
+			errors: []string{
+				"unknown param 'pages'",
+				"missing required param 'document'",
+				"param 'style' must be one of short, long, got 'medium'",
+				"param 'words' must be an int, got 'many'",
+				"param 'cite' must be true or false, got 'maybe'",
+			},
+		},
+		{
+			name:   "missing file",
+			params: map[string]string{"document": filepath.Join(tmpDir, "missing.txt")},
+			errors: []string{"param 'document' must be an existing file"},
+		},
+		{
+			name:   "empty required value",
+			params: map[string]string{"document": ""},
+			errors: []string{"missing required param 'document'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewProcessor(&dslConfig, createTestEnvConfig(), nil, false)
+			err := processor.SetParams(tt.params)
+			if len(tt.errors) > 0 {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+				for _, expected := range tt.errors {
+					if !strings.Contains(err.Error(), expected) {
+						t.Errorf("Expected error to contain %q, got %v", expected, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetParams failed: %v", err)
+			}
+			resolved, _ := processor.resolveParams()
+			for name, value := range tt.expected {
+				if resolved[name] != value {
+					t.Errorf("Expected %s=%q, got %q", name, value, resolved[name])
+				}
+			}
+		})
+	}
+
+	t.Run("params are substituted in inputs", func(t *testing.T) {
+		processor := NewProcessor(&dslConfig, createTestEnvConfig(), nil, false)
+		processor.paramValues = map[string]string{"doc": "short.txt", "document": document}
+		if got := processor.substituteParams("$document"); got != document {
+			t.Errorf("Expected the longer param name to be substituted first, got %q", got)
+		}
+	})
+}
+
+func TestParamPathsInServerMode(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{
+		filepath.Join(dataDir, "doc.txt"): "inside",
+		filepath.Join(root, "secret.txt"): "outside",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var dslConfig DSLConfig
+	workflow := "workflow:\n  params:\n    document:\n      type: file\n    topic: {}\n"
+	if err := yaml.Unmarshal([]byte(workflow), &dslConfig); err != nil {
+		t.Fatalf("Failed to parse workflow: %v", err)
+	}
+	serverConfig := &config.ServerConfig{Enabled: true, DataDir: dataDir}
+
+	for _, document := range []string{"../secret.txt", filepath.Join(root, "secret.txt")} {
+		processor := NewProcessor(&dslConfig, createTestEnvConfig(), serverConfig, false)
+		if err := processor.SetParams(map[string]string{"document": document}); err == nil || !strings.Contains(err.Error(), "within the data directory") {
+			t.Errorf("Expected file param %q to be rejected, got %v", document, err)
+		}
+	}
+	processor := NewProcessor(&dslConfig, createTestEnvConfig(), serverConfig, false)
+	if err := processor.SetParams(map[string]string{"document": "doc.txt"}); err != nil {
+		t.Errorf("Expected a file in the data directory to be accepted, got %v", err)
+	}
+
+	processor.paramValues = map[string]string{"topic": "../../secrets"}
+	if err := processor.substituteInputParams([]string{"notes/$topic.md"}); err == nil || !strings.Contains(err.Error(), "within the data directory") {
+		t.Errorf("Expected an input leaving the data directory to be rejected, got %v", err)
+	}
+	processor.paramValues = map[string]string{"topic": "cats"}
+	inputs := []string{"notes/$topic.md", "/var/shared/notes.md"}
+	if err := processor.substituteInputParams(inputs); err != nil || inputs[0] != "notes/cats.md" {
+		t.Errorf("Expected the param to be substituted, got %v, %v", inputs, err)
+	}
+
+	// Outside server mode params may name any file
+	cli := NewProcessor(&dslConfig, createTestEnvConfig(), nil, false)
+	if err := cli.SetParams(map[string]string{"document": filepath.Join(root, "secret.txt")}); err != nil {
+		t.Errorf("Expected any file to be accepted outside server mode, got %v", err)
+	}
+}
+
+func TestWorkflowBlockValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		workflow string
+		expected string
+	}{
+		{
+			name:     "unknown type",
+			workflow: "workflow:\n  params:\n    count:\n      type: number\n",
+			expected: "param 'count' has unknown type 'number'",
+		},
+		{
+			name:     "enum without values",
+			workflow: "workflow:\n  params:\n    mode:\n      type: enum\n",
+			expected: "param 'mode' of type enum requires a list of values",
+		},
+		{
+			name:     "default of the wrong type",
+			workflow: "workflow:\n  params:\n    count:\n      type: int\n      default: lots\n",
+			expected: "default of param 'count': must be an int",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dslConfig DSLConfig
+			err := yaml.Unmarshal([]byte(tt.workflow), &dslConfig)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) || !strings.Contains(err.Error(), "line 1") {
+				t.Errorf("Expected an error containing %q at line 1, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	params, err := ParseParams([]string{"topic=go generics", "filter=a=b", "empty="})
+	if err != nil {
+		t.Fatalf("ParseParams failed: %v", err)
+	}
+	if params["topic"] != "go generics" || params["filter"] != "a=b" || params["empty"] != "" {
+		t.Errorf("Unexpected params %v", params)
+	}
+	if _, err := ParseParams([]string{"topic"}); err == nil {
+		t.Error("Expected an error for a param without a value")
+	}
+}
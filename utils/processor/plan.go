@@ -0,0 +1,1216 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/chunker"
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/fileutil"
+	"github.com/kris-hansen/comanda/utils/input"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/ratelimit"
+	"gopkg.in/yaml.v3"
+)
+
+// planOutputTokens is the number of output tokens assumed per request when
+// neither the step nor the model configuration sets max_tokens
+const planOutputTokens = 1000
+
+// planImageTokens is the number of input tokens assumed per attached image
+const planImageTokens = 1000
+
+// batchPriceFactor is the share of the real-time price that providers bill
+// for requests sent as a batch
+const batchPriceFactor = 0.5
+
+// Plan is the execution plan of a workflow: the requests a run would send and
+// their estimated tokens and cost. Planning reads the inputs but calls no model.
+type Plan struct {
+	Stages []PlanStage // In execution order
+	// Deferred steps run only when a step's output calls them; they are not
+	// included in the totals
+	Deferred []*PlanStep
+
+	Requests     int
+	InputTokens  int
+	OutputTokens int
+	Cost         float64  // In US dollars, without the unpriced models
+	Unpriced     []string // Models without a known price
+}
+
+// PlanStage is a sequential step or a group of steps that run concurrently
+type PlanStage struct {
+	Group string // Name of the parallel group, empty for a sequential step
+	Steps []*PlanStep
+}
+
+// PlanStep describes how a step would run
+type PlanStep struct {
+	Name     string
+	Type     string // standard, generate, process, openai-responses, image-generation, index or retrieve
+	Model    string // As written in the workflow
+	Provider string // Provider the model resolves to
+	APIModel string // Model name sent to the provider
+	Inputs   []PlanInput
+	Outputs  []string
+	Calls    []PlanCall
+	Notes    []string
+	Workflow *Plan // Plan of the sub-workflow of a process step
+
+	InputTokens  int
+	OutputTokens int
+	Cost         float64
+	Priced       bool // Whether the model has a known price
+}
+
+// PlanInput is a resolved input of a step
+type PlanInput struct {
+	Source string // File, chunk, URL or STDIN
+	Tokens int    // Estimated tokens, 0 when only known at run time
+	Note   string
+}
+
+// PlanCall is a request a step would send to its model
+type PlanCall struct {
+	Prompt       string   // With input contents shown as <placeholders>
+	Files        []string // Inputs attached to the request
+	InputTokens  int
+	OutputTokens int
+}
+
+// Item kinds of a planned step input, matching how processActions sends them
+const (
+	itemFile  = iota // Attached to the request
+	itemImage        // Attached in multimodal and batch steps, in the prompt otherwise
+	itemText         // Included in the prompt
+)
+
+// planItem is a resolved input of a step
+type planItem struct {
+	source string
+	kind   int
+	text   string // Placeholder for the contents in prompts
+	tokens int
+	note   string
+}
+
+// planValue is text the plan passes between steps: known text such as piped
+// STDIN, or a placeholder for text produced at run time
+type planValue struct {
+	text    string
+	tokens  int
+	step    string // Step that produces the text
+	runtime bool   // Whether text is a placeholder
+}
+
+// planner holds the state of planning a workflow
+type planner struct {
+	p            *Processor
+	lastOutput   planValue
+	files        map[string]planValue // Files written by the steps planned so far
+	placeholders map[string]int       // Tokens of the text each placeholder stands for
+}
+
+// Plan resolves the inputs, templates and models of the workflow the way
+// Process would and returns the execution plan, without calling any model.
+// URLs, databases and screenshots are read only at run time.
+func (p *Processor) Plan() (*Plan, error) {
+	pl := &planner{
+		p:            p,
+		files:        make(map[string]planValue),
+		placeholders: make(map[string]int),
+	}
+	if p.lastOutput != "" {
+		pl.lastOutput = planValue{text: p.lastOutput, tokens: ratelimit.EstimateTokens(p.lastOutput)}
+	}
+	return pl.plan()
+}
+
+// checkWorkflow runs the checks of Process that need no provider: the params,
+// the step configurations and the dependencies between steps
+func (p *Processor) checkWorkflow() error {
+	if len(p.config.Steps) == 0 && len(p.config.ParallelSteps) == 0 {
+		return fmt.Errorf("validation failed: no steps defined in DSL configuration")
+	}
+	params, err := p.resolveParams()
+	if err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	p.paramValues = params
+	for name, value := range params {
+		p.variables[name] = value
+	}
+
+	steps := append([]Step{}, p.config.Steps...)
+	for _, group := range sortedGroups(p.config.ParallelSteps) {
+		steps = append(steps, p.config.ParallelSteps[group]...)
+	}
+	for _, step := range steps {
+		if err := p.validateStepConfig(step.Name, step.Config); err != nil {
+			return fmt.Errorf("validation error: %w", err)
+		}
+	}
+	if err := p.validateDependencies(); err != nil {
+		return fmt.Errorf("dependency validation error: %w", err)
+	}
+	return nil
+}
+
+// sortedGroups returns the names of the parallel step groups in a stable order
+func sortedGroups(groups map[string][]Step) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// plan plans the steps in execution order: the parallel groups first, then the
+// sequential steps, then the deferred steps on their own
+func (pl *planner) plan() (*Plan, error) {
+	p := pl.p
+	if err := p.checkWorkflow(); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	for _, group := range sortedGroups(p.config.ParallelSteps) {
+		stage := PlanStage{Group: group}
+		for _, step := range p.config.ParallelSteps[group] {
+			ps, _, err := pl.planStep(step)
+			if err != nil {
+				return nil, fmt.Errorf("error in parallel step '%s': %w", step.Name, err)
+			}
+			stage.Steps = append(stage.Steps, ps)
+		}
+		plan.add(stage)
+	}
+
+	for _, step := range p.config.Steps {
+		ps, output, err := pl.planStep(step)
+		if err != nil {
+			return nil, fmt.Errorf("error in step '%s': %w", step.Name, err)
+		}
+		pl.lastOutput = output
+		plan.add(PlanStage{Steps: []*PlanStep{ps}})
+	}
+
+	// A deferred step's input is chosen by the model that calls it
+	lastOutput := pl.lastOutput
+	names := make([]string, 0, len(p.config.Defer))
+	for name := range p.config.Defer {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pl.lastOutput = pl.runtimeValue(fmt.Sprintf("<input given by the calling step, ~%d tokens>", planOutputTokens), planOutputTokens, "")
+		ps, _, err := pl.planStep(Step{Name: name, Config: p.config.Defer[name]})
+		if err != nil {
+			return nil, fmt.Errorf("error in deferred step '%s': %w", name, err)
+		}
+		plan.Deferred = append(plan.Deferred, ps)
+	}
+	pl.lastOutput = lastOutput
+	return plan, nil
+}
+
+// add appends a stage and adds its steps to the totals
+func (plan *Plan) add(stage PlanStage) {
+	plan.Stages = append(plan.Stages, stage)
+	for _, ps := range stage.Steps {
+		plan.Requests += len(ps.Calls)
+		plan.InputTokens += ps.InputTokens
+		plan.OutputTokens += ps.OutputTokens
+		plan.Cost += ps.Cost
+		var unpriced []string
+		if ps.Workflow != nil {
+			plan.Requests += ps.Workflow.Requests
+			unpriced = ps.Workflow.Unpriced
+		}
+		if !ps.Priced && len(ps.Calls) > 0 {
+			unpriced = append(unpriced, ps.modelLabel())
+		}
+		for _, model := range unpriced {
+			if !containsString(plan.Unpriced, model) {
+				plan.Unpriced = append(plan.Unpriced, model)
+			}
+		}
+	}
+}
+
+// modelLabel returns the provider-qualified model of a step
+func (ps *PlanStep) modelLabel() string {
+	if ps.Provider == "" {
+		return ps.Model
+	}
+	return ps.Provider + "/" + ps.APIModel
+}
+
+// placeholder registers a placeholder for text of the given size
+func (pl *planner) placeholder(text string, tokens int) string {
+	pl.placeholders[text] = tokens
+	return text
+}
+
+// runtimeValue returns a placeholder value for text produced at run time
+func (pl *planner) runtimeValue(text string, tokens int, step string) planValue {
+	return planValue{text: pl.placeholder(text, tokens), tokens: tokens, step: step, runtime: true}
+}
+
+// tokens estimates the tokens of a prompt, counting placeholders as the text
+// they stand for
+func (pl *planner) tokens(text string) int {
+	n := ratelimit.EstimateTokens(text)
+	for placeholder, tokens := range pl.placeholders {
+		if count := strings.Count(text, placeholder); count > 0 {
+			n += count * (tokens - ratelimit.EstimateTokens(placeholder))
+		}
+	}
+	return n
+}
+
+// written returns the planned contents of a file written by an earlier step
+func (pl *planner) written(path string) (planValue, bool) {
+	if value, ok := pl.files[path]; ok {
+		return value, true
+	}
+	return planValue{}, false
+}
+
+// planStep plans a step and returns the value of its output for the next step
+func (pl *planner) planStep(step Step) (*PlanStep, planValue, error) {
+	p := pl.p
+	p.handler = input.NewHandler()
+	ps := &PlanStep{Name: step.Name, Type: "standard", Priced: true}
+
+	var output planValue
+	var err error
+	switch {
+	case step.Config.Type == "openai-responses":
+		ps.Type = step.Config.Type
+		output, err = pl.planResponsesStep(step, ps)
+	case isImageGenerationStep(step.Config):
+		ps.Type = step.Config.Type
+		output, err = pl.planImageStep(step, ps)
+	case step.Config.Type == "index" || step.Config.Type == "retrieve":
+		ps.Type = step.Config.Type
+		output, err = pl.planRetrievalStep(step, ps)
+	case step.Config.Generate != nil:
+		ps.Type = "generate"
+		output, err = pl.planGenerateStep(step, ps)
+	case step.Config.Process != nil:
+		ps.Type = "process"
+		output, err = pl.planProcessStep(step, ps)
+	default:
+		output, err = pl.planStandardStep(step, ps)
+	}
+	if err != nil {
+		return nil, planValue{}, err
+	}
+
+	for _, call := range ps.Calls {
+		ps.InputTokens += call.InputTokens
+		ps.OutputTokens += call.OutputTokens
+	}
+	if ps.Workflow != nil {
+		ps.InputTokens += ps.Workflow.InputTokens
+		ps.OutputTokens += ps.Workflow.OutputTokens
+		ps.Cost += ps.Workflow.Cost
+	}
+	return ps, output, nil
+}
+
+// resolveModel resolves a step's model to its provider and checks that it is
+// enabled, like validateModel, without contacting local servers
+func (pl *planner) resolveModel(ps *PlanStep, modelName string) error {
+	ref, err := pl.p.resolveModel(modelName)
+	if err != nil {
+		return err
+	}
+	ps.Provider = ref.Provider
+	ps.APIModel = ref.Model
+	if pl.modelConfig(ref.Provider, ref.Model) == nil {
+		return fmt.Errorf("model %s is supported by provider %s but is not enabled in your configuration. Use 'comanda configure' to add it.", ref.Model, ref.Provider)
+	}
+	return nil
+}
+
+// modelConfig returns the configuration of an enabled model, without
+// decrypting the provider's secrets as GetModelConfig does
+func (pl *planner) modelConfig(providerName, modelName string) *config.Model {
+	if pl.p.envConfig == nil {
+		return nil
+	}
+	provider := pl.p.envConfig.Providers[providerName]
+	if provider == nil {
+		return nil
+	}
+	for i := range provider.Models {
+		model := &provider.Models[i]
+		if model.Name == modelName || strings.Split(model.Name, ":")[0] == modelName {
+			return model
+		}
+	}
+	return nil
+}
+
+// price returns the price of a model: the pricing in its configuration,
+// nothing for local providers, or the built-in list price
+func (pl *planner) price(providerName, modelName string) (config.Pricing, bool) {
+	if model := pl.modelConfig(providerName, modelName); model != nil && model.Pricing != nil {
+		return *model.Pricing, true
+	}
+	kind := providerName
+	if pl.p.envConfig != nil {
+		if provider := pl.p.envConfig.Providers[providerName]; provider != nil {
+			kind = provider.Kind(providerName)
+		}
+	}
+	if factory, ok := models.LookupProvider(kind); ok && factory.Local {
+		return config.Pricing{}, true
+	}
+	return models.LookupPrice(modelName)
+}
+
+// setCost sets the cost of a step's calls from its model's price
+func (pl *planner) setCost(ps *PlanStep, factor float64) {
+	price, ok := pl.price(ps.Provider, ps.APIModel)
+	if !ok {
+		ps.Priced = false
+		return
+	}
+	for _, call := range ps.Calls {
+		ps.Cost += factor * (float64(call.InputTokens)*price.Input + float64(call.OutputTokens)*price.Output) / 1e6
+	}
+}
+
+// maxOutputTokens returns the output tokens assumed per request of a step
+func (pl *planner) maxOutputTokens(ps *PlanStep, step Step) int {
+	var params config.ModelParams
+	if model := pl.modelConfig(ps.Provider, ps.APIModel); model != nil {
+		params = model.Params
+	}
+	params = params.Merge(stepParams(step.Config))
+	if params.MaxTokens != nil && *params.MaxTokens > 0 {
+		return *params.MaxTokens
+	}
+	return planOutputTokens
+}
+
+// call returns a planned request
+func (pl *planner) call(prompt string, files []planItem, outputTokens int) PlanCall {
+	call := PlanCall{Prompt: prompt, InputTokens: pl.tokens(prompt), OutputTokens: outputTokens}
+	for _, file := range files {
+		call.Files = append(call.Files, file.source)
+		call.InputTokens += file.tokens
+	}
+	return call
+}
+
+// addInputs lists resolved inputs on a step
+func (ps *PlanStep) addInputs(items []planItem) {
+	for _, item := range items {
+		ps.Inputs = append(ps.Inputs, PlanInput{Source: item.source, Tokens: item.tokens, Note: item.note})
+	}
+}
+
+// fileItem returns an input item for file contents of the given size
+func (pl *planner) fileItem(source string, kind int, tokens int, note string) planItem {
+	text := pl.placeholder(fmt.Sprintf("<contents of %s, ~%d tokens>", source, tokens), tokens)
+	return planItem{source: source, kind: kind, text: text, tokens: tokens, note: note}
+}
+
+// resolvePath resolves one input path of a step like processInputs: globs and
+// directories are expanded and files are read. Files written by earlier steps
+// are estimated from those steps; URLs and screenshots are read at run time.
+func (pl *planner) resolvePath(ps *PlanStep, path string) ([]planItem, error) {
+	p := pl.p
+	switch {
+	case path == "" || path == "NA" || path == "STDIN":
+		return nil, nil
+	case path == "screenshot":
+		item := pl.fileItem(path, itemImage, planImageTokens, "captured at run time")
+		return []planItem{item}, nil
+	case p.isURL(path):
+		return []planItem{pl.fileItem(path, itemFile, 0, "fetched at run time")}, nil
+	}
+	if value, ok := pl.written(path); ok {
+		return []planItem{pl.fileItem(path, itemFile, value.tokens, "written by step "+value.step)}, nil
+	}
+
+	before := len(p.handler.GetInputs())
+	if err := p.processInputs([]string{path}); err != nil {
+		return nil, err
+	}
+	resolved := p.handler.GetInputs()[before:]
+	if len(resolved) == 0 {
+		ps.Notes = append(ps.Notes, fmt.Sprintf("input %s does not exist yet and is skipped; it is written by another step", path))
+		return nil, nil
+	}
+
+	var items []planItem
+	for _, in := range resolved {
+		switch {
+		case in.Type == input.ImageInput || in.Type == input.ScreenshotInput:
+			items = append(items, pl.fileItem(in.Path, itemImage, planImageTokens, ""))
+		case in.IsMedia():
+			items = append(items, pl.fileItem(in.Path, itemFile, 0, "transcribed at run time"))
+		case in.Type == input.FileInput:
+			items = append(items, pl.fileItem(in.Path, itemFile, ratelimit.EstimateTokensForSize(int64(len(in.Contents))), ""))
+		default:
+			items = append(items, pl.fileItem(in.Path, itemText, ratelimit.EstimateTokensForSize(int64(len(in.Contents))), ""))
+		}
+	}
+	return items, nil
+}
+
+// stdinItem returns the input item of the previous step's output
+func (pl *planner) stdinItem() planItem {
+	note := ""
+	if pl.lastOutput.step != "" {
+		note = "output of step " + pl.lastOutput.step
+	}
+	if !pl.lastOutput.runtime {
+		return pl.fileItem("STDIN", itemFile, pl.lastOutput.tokens, note)
+	}
+	return planItem{source: "STDIN", kind: itemFile, text: pl.lastOutput.text, tokens: pl.lastOutput.tokens, note: note}
+}
+
+// stepChunks is the planned chunking of a step's input
+type stepChunks struct {
+	first string // Placeholder for the first chunk
+	total int
+}
+
+// standardInputs resolves the inputs of a standard step, including STDIN and
+// the chunking of a single input
+func (pl *planner) standardInputs(step Step, ps *PlanStep) ([]planItem, *stepChunks, error) {
+	p := pl.p
+	var inputs []string
+	switch v := step.Config.Input.(type) {
+	case map[string]interface{}:
+		if _, hasDB := v["database"]; hasDB {
+			item := pl.fileItem("database query", itemFile, 0, "queried at run time")
+			return []planItem{item}, nil, nil
+		} else if url, ok := v["url"].(string); ok {
+			item := pl.fileItem(url, itemText, 0, "scraped at run time")
+			return []planItem{item}, nil, nil
+		}
+		inputs = p.NormalizeStringSlice(step.Config.Input)
+	default:
+		inputs = p.NormalizeStringSlice(step.Config.Input)
+	}
+	if err := p.substituteInputParams(inputs); err != nil {
+		return nil, nil, err
+	}
+
+	chunked := step.Config.Chunk != nil && len(inputs) == 1 && !isDurationChunking(step) && inputs[0] != "NA"
+	if len(inputs) == 1 && strings.HasPrefix(inputs[0], "STDIN") {
+		if _, varName := p.parseVariableAssignment(inputs[0]); varName != "" {
+			p.variables[varName] = pl.lastOutput.text
+		}
+		if chunked && !pl.lastOutput.runtime {
+			return pl.chunkText(step, "STDIN", pl.lastOutput.text)
+		}
+		if chunked {
+			ps.Notes = append(ps.Notes, "STDIN is split into chunks at run time; it is estimated as one request")
+		}
+		return []planItem{pl.stdinItem()}, nil, nil
+	}
+
+	if chunked {
+		if _, ok := pl.written(inputs[0]); ok {
+			ps.Notes = append(ps.Notes, fmt.Sprintf("%s is split into chunks at run time; it is estimated as one request", inputs[0]))
+		} else {
+			return pl.chunkFile(step, inputs[0], inputs[0])
+		}
+	}
+
+	var items []planItem
+	for _, path := range inputs {
+		resolved, err := pl.resolvePath(ps, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, resolved...)
+	}
+	return items, nil, nil
+}
+
+// chunkText splits known text, such as piped STDIN, like a step's chunk setting
+func (pl *planner) chunkText(step Step, source string, text string) ([]planItem, *stepChunks, error) {
+	tmpFile, err := os.CreateTemp("", "comanda-stdin-*.txt")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temp file for STDIN: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+	if _, err := tmpFile.WriteString(text); err != nil {
+		tmpFile.Close()
+		return nil, nil, fmt.Errorf("failed to write to temp file: %w", err)
+	}
+	tmpFile.Close()
+	return pl.chunkFile(step, source, tmpPath)
+}
+
+// chunkFile splits a file like a step's chunk setting and returns the chunks
+func (pl *planner) chunkFile(step Step, source string, path string) ([]planItem, *stepChunks, error) {
+	result, err := chunker.SplitFile(path, chunker.ChunkConfig{
+		By:        step.Config.Chunk.By,
+		Size:      step.Config.Chunk.Size,
+		Overlap:   step.Config.Chunk.Overlap,
+		MaxChunks: step.Config.Chunk.MaxChunks,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to chunk file '%s' for step '%s': %v", source, step.Name, err)
+	}
+	defer chunker.CleanupChunks(result)
+
+	var items []planItem
+	for i, chunkPath := range result.ChunkPaths {
+		content, err := fileutil.SafeReadFile(chunkPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		tokens := ratelimit.EstimateTokens(string(content))
+		label := fmt.Sprintf("%s (chunk %d/%d)", source, i+1, result.TotalChunks)
+		items = append(items, pl.fileItem(label, itemFile, tokens, ""))
+	}
+	chunks := &stepChunks{total: result.TotalChunks}
+	if len(items) > 0 {
+		chunks.first = items[0].text
+	}
+	return items, chunks, nil
+}
+
+// planStandardStep plans a step that sends its inputs and action to a model,
+// mirroring processStep and processActions
+func (pl *planner) planStandardStep(step Step, ps *PlanStep) (planValue, error) {
+	p := pl.p
+	modelNames := p.NormalizeStringSlice(step.Config.Model)
+	actions := p.NormalizeStringSlice(step.Config.Action)
+	if len(modelNames) == 0 {
+		return planValue{}, fmt.Errorf("no model specified for actions")
+	}
+	ps.Model = modelNames[0]
+	if len(modelNames) > 1 {
+		ps.Notes = append(ps.Notes, fmt.Sprintf("only the first model, %s, is used", modelNames[0]))
+	}
+	passThrough := ps.Model == "NA"
+	if !passThrough {
+		if err := pl.resolveModel(ps, ps.Model); err != nil {
+			return planValue{}, err
+		}
+	}
+
+	items, chunks, err := pl.standardInputs(step, ps)
+	if err != nil {
+		return planValue{}, err
+	}
+	ps.addInputs(items)
+
+	// A model of NA passes the inputs through without a request
+	if passThrough {
+		tokens := 0
+		for _, item := range items {
+			tokens += item.tokens
+		}
+		ps.Notes = append(ps.Notes, "model NA: the inputs are passed through without a model call")
+		output := pl.runtimeValue(fmt.Sprintf("<output of %s, ~%d tokens>", step.Name, tokens), tokens, step.Name)
+		pl.planOutputs(step, ps, output, nil)
+		return output, nil
+	}
+
+	if len(actions) == 0 {
+		return planValue{}, fmt.Errorf("no actions processed")
+	}
+	if len(actions) > 1 {
+		ps.Notes = append(ps.Notes, "only the first action is run")
+	}
+	action := p.substituteVariables(actions[0])
+	if chunks != nil {
+		action = strings.ReplaceAll(action, "{{ chunk_index }}", "1")
+		action = strings.ReplaceAll(action, "{{ total_chunks }}", fmt.Sprintf("%d", chunks.total))
+		action = strings.ReplaceAll(action, "{{ current_chunk }}", chunks.first)
+	}
+	if step.Config.Memory.Enabled && p.memory != nil && p.memory.HasMemory() {
+		memory, err := pl.memoryContext(step, action)
+		if err != nil {
+			return planValue{}, fmt.Errorf("memory error in step %s: %w", step.Name, err)
+		}
+		if memory != "" {
+			action = withMemoryContext(memory, action)
+		}
+	}
+	if strings.HasSuffix(strings.ToLower(action), ".md") {
+		content, err := fileutil.SafeReadFile(action)
+		if err != nil {
+			return planValue{}, fmt.Errorf("failed to read markdown file %s: %w", action, err)
+		}
+		action = string(content)
+	}
+
+	outputTokens := pl.maxOutputTokens(ps, step)
+	individual := pl.planCalls(step, ps, action, items, outputTokens)
+	factor := 1.0
+	if step.Config.Execution == ExecutionBatch && individual {
+		factor = batchPriceFactor
+		ps.Notes = append(ps.Notes, "the requests are sent as a provider batch, billed at half price")
+	}
+	pl.setCost(ps, factor)
+
+	tokens := outputTokens * len(ps.Calls)
+	output := pl.runtimeValue(fmt.Sprintf("<output of %s, ~%d tokens>", step.Name, tokens), tokens, step.Name)
+	if individual {
+		pl.planOutputs(step, ps, output, ps.Calls)
+	} else {
+		pl.planOutputs(step, ps, output, nil)
+	}
+	return output, nil
+}
+
+// planCalls plans the requests of a standard step like processActions and
+// reports whether each file is sent in its own request
+func (pl *planner) planCalls(step Step, ps *PlanStep, action string, items []planItem, outputTokens int) bool {
+	if len(items) == 0 {
+		ps.Calls = append(ps.Calls, pl.call(action, nil, outputTokens))
+		return false
+	}
+
+	multimodal := step.Config.BatchMode == "multimodal"
+	attachImages := multimodal || step.Config.Execution == ExecutionBatch
+	var files []planItem
+	var texts []string
+	var textSources []string
+	for _, item := range items {
+		if item.kind == itemFile || (item.kind == itemImage && attachImages) {
+			files = append(files, item)
+		} else {
+			texts = append(texts, item.text)
+			textSources = append(textSources, item.source)
+		}
+	}
+
+	switch {
+	case multimodal && len(files) > 0:
+		prompt := action
+		if len(texts) > 0 {
+			prompt = textPrompt(texts, action)
+		}
+		ps.Calls = append(ps.Calls, pl.call(prompt, files, outputTokens))
+		return false
+	case len(files) > 0 && len(texts) > 0:
+		ps.Notes = append(ps.Notes, fmt.Sprintf("inputs %s are not sent because the step also has file inputs", strings.Join(textSources, ", ")))
+	case len(files) == 0:
+		ps.Calls = append(ps.Calls, pl.call(textPrompt(texts, action), nil, outputTokens))
+		return false
+	}
+
+	if step.Config.Execution != ExecutionBatch {
+		if len(files) == 1 {
+			ps.Calls = append(ps.Calls, pl.call(action, files, outputTokens))
+			return false
+		}
+		if step.Config.BatchMode == "combined" {
+			var prompt string
+			for i, file := range files {
+				prompt += fmt.Sprintf("File %d (%s):\n%s\n\n", i+1, file.source, file.text)
+			}
+			prompt += fmt.Sprintf("\nAction: %s", action)
+			ps.Calls = append(ps.Calls, pl.call(prompt, nil, outputTokens))
+			return false
+		}
+	}
+	for _, file := range files {
+		ps.Calls = append(ps.Calls, pl.call(filePrompt(action), []planItem{file}, outputTokens))
+	}
+	return true
+}
+
+// memoryContext returns the project memory a step's action would include.
+// Memory ranked by embeddings is shown as a placeholder of its token budget.
+func (pl *planner) memoryContext(step Step, action string) (string, error) {
+	cfg := step.Config.Memory
+	if cfg.Mode == MemoryModeRelevant && cfg.Model != "" {
+		maxTokens := cfg.MaxTokens
+		if maxTokens <= 0 {
+			maxTokens = defaultMemoryMaxTokens
+		}
+		return pl.placeholder(fmt.Sprintf("<memory entries most relevant to the action, up to ~%d tokens>", maxTokens), maxTokens), nil
+	}
+	memory, err := pl.p.buildMemoryContext(cfg, action)
+	if err != nil || memory == "" {
+		return "", err
+	}
+	tokens := ratelimit.EstimateTokens(memory)
+	return pl.placeholder(fmt.Sprintf("<project memory, ~%d tokens>", tokens), tokens), nil
+}
+
+// planOutputs lists a step's outputs and records the files it writes. When
+// each file was sent in its own request, the output names are expanded per
+// result like processStep does.
+func (pl *planner) planOutputs(step Step, ps *PlanStep, output planValue, individual []PlanCall) {
+	if v, ok := step.Config.Output.(map[string]interface{}); ok {
+		if _, hasDB := v["database"]; hasDB {
+			ps.Outputs = append(ps.Outputs, "database")
+			return
+		}
+	}
+	outputs := pl.p.NormalizeStringSlice(step.Config.Output)
+	if len(individual) == 0 {
+		for _, out := range outputs {
+			ps.Outputs = append(ps.Outputs, out)
+			if out != "STDOUT" && !strings.HasPrefix(out, "MEMORY") {
+				pl.files[out] = output
+			}
+		}
+		return
+	}
+
+	total := fmt.Sprintf("%d", len(individual))
+	for i, call := range individual {
+		index := fmt.Sprintf("%d", i)
+		value := pl.runtimeValue(fmt.Sprintf("<output of %s for %s, ~%d tokens>", step.Name, strings.Join(call.Files, ", "), call.OutputTokens), call.OutputTokens, step.Name)
+		for _, out := range outputs {
+			name := strings.ReplaceAll(out, "{{ chunk_index }}", index)
+			name = strings.ReplaceAll(name, "{{ total_chunks }}", total)
+			name = strings.ReplaceAll(name, "{{ file_index }}", index)
+			name = strings.ReplaceAll(name, "{{ total_files }}", total)
+			if !containsString(ps.Outputs, name) {
+				ps.Outputs = append(ps.Outputs, name)
+			}
+			if name == "STDOUT" || strings.HasPrefix(name, "MEMORY") {
+				continue
+			}
+			// Results written to the same file overwrite each other
+			pl.files[name] = value
+		}
+	}
+}
+
+// textItems resolves the inputs of steps that only consume text, like
+// gatherTextInputs: STDIN is the previous output and images and recordings are
+// skipped
+func (pl *planner) textItems(step Step, ps *PlanStep) ([]planItem, error) {
+	var items []planItem
+	for _, path := range pl.p.NormalizeStringSlice(step.Config.Input) {
+		if strings.HasPrefix(path, "STDIN") {
+			if _, varName := pl.p.parseVariableAssignment(path); varName != "" {
+				pl.p.variables[varName] = pl.lastOutput.text
+			}
+			if pl.lastOutput.text != "" {
+				items = append(items, pl.stdinItem())
+			}
+			continue
+		}
+		resolved, err := pl.resolvePath(ps, path)
+		if err != nil {
+			return nil, fmt.Errorf("input processing error in step %s: %w", step.Name, err)
+		}
+		for _, item := range resolved {
+			if item.kind == itemImage || item.note == "transcribed at run time" {
+				ps.Notes = append(ps.Notes, fmt.Sprintf("input %s is not text and is skipped", item.source))
+				continue
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// planResponsesStep plans an openai-responses step, which sends one request
+// with its inputs, action and instructions
+func (pl *planner) planResponsesStep(step Step, ps *PlanStep) (planValue, error) {
+	p := pl.p
+	modelNames := p.NormalizeStringSlice(step.Config.Model)
+	if len(modelNames) == 0 {
+		return planValue{}, fmt.Errorf("no model specified for openai-responses step")
+	}
+	ps.Model = modelNames[0]
+	if err := pl.resolveModel(ps, ps.Model); err != nil {
+		return planValue{}, err
+	}
+
+	inputs := p.NormalizeStringSlice(step.Config.Input)
+	isNAInput := len(inputs) == 1 && inputs[0] == "NA"
+	var items []planItem
+	for _, path := range inputs {
+		if strings.HasPrefix(path, "STDIN") {
+			ps.Notes = append(ps.Notes, "STDIN is not read by openai-responses steps")
+			continue
+		}
+		resolved, err := pl.resolvePath(ps, path)
+		if err != nil {
+			return planValue{}, fmt.Errorf("input processing error in step %s: %w", step.Name, err)
+		}
+		items = append(items, resolved...)
+	}
+	if len(items) == 0 && !isNAInput {
+		return planValue{}, fmt.Errorf("no inputs provided for openai-responses step")
+	}
+	ps.addInputs(items)
+
+	var contents []string
+	for _, item := range items {
+		contents = append(contents, item.text)
+	}
+	combinedInput := strings.Join(contents, "\n\n")
+	if isNAInput {
+		combinedInput = "Please follow the instructions."
+	}
+	actions := p.NormalizeStringSlice(step.Config.Action)
+	if len(actions) == 0 && step.Config.Instructions == "" {
+		return planValue{}, fmt.Errorf("no actions or instructions provided for openai-responses step")
+	}
+	prompt := combinedInput
+	if len(actions) > 0 {
+		prompt = textPrompt([]string{combinedInput}, strings.Join(actions, "\n"))
+	}
+	if step.Config.Instructions != "" {
+		prompt = "Instructions: " + step.Config.Instructions + "\n\n" + prompt
+	}
+
+	outputTokens := pl.maxOutputTokens(ps, step)
+	ps.Calls = append(ps.Calls, pl.call(prompt, nil, outputTokens))
+	pl.setCost(ps, 1)
+	output := pl.runtimeValue(fmt.Sprintf("<output of %s, ~%d tokens>", step.Name, outputTokens), outputTokens, step.Name)
+	pl.planOutputs(step, ps, output, nil)
+	return output, nil
+}
+
+// planImageStep plans an image-generation step. Images are priced per image,
+// so the step is listed as unpriced.
+func (pl *planner) planImageStep(step Step, ps *PlanStep) (planValue, error) {
+	p := pl.p
+	modelNames := p.NormalizeStringSlice(step.Config.Model)
+	if len(modelNames) == 0 || modelNames[0] == "NA" {
+		return planValue{}, fmt.Errorf("image-generation step requires an image model")
+	}
+	cfg := ImageConfig{}
+	if step.Config.Image != nil {
+		cfg = *step.Config.Image
+	}
+	if cfg.Count < 1 {
+		cfg.Count = 1
+	}
+
+	items, err := pl.textItems(step, ps)
+	if err != nil {
+		return planValue{}, err
+	}
+	ps.addInputs(items)
+	actions := p.NormalizeStringSlice(step.Config.Action)
+	if len(actions) == 0 {
+		return planValue{}, fmt.Errorf("image-generation step requires an action describing the image")
+	}
+	prompt := p.substituteVariables(strings.Join(actions, "\n"))
+	for _, item := range items {
+		prompt += "\n\n" + item.text
+	}
+
+	ps.Model = modelNames[0]
+	modelName, providerName, err := pl.p.splitStepModel(ps.Model, cfg.Provider)
+	if err != nil {
+		return planValue{}, err
+	}
+	generator := models.DetectImageGenerator(modelName, providerName)
+	if generator == nil {
+		return planValue{}, fmt.Errorf("no image generation backend found for model %s (set image.provider to openai, google or stable-diffusion)", modelName)
+	}
+	ps.Provider = generator.Name()
+	ps.APIModel = modelName
+	for i := 0; i < cfg.Count; i++ {
+		ps.Calls = append(ps.Calls, pl.call(prompt, nil, 0))
+	}
+	ps.Priced = false
+	ps.Notes = append(ps.Notes, fmt.Sprintf("generates %d image(s), priced per image", cfg.Count))
+	output := planValue{text: "", step: step.Name}
+	for _, out := range p.NormalizeStringSlice(step.Config.Output) {
+		ps.Outputs = append(ps.Outputs, out)
+	}
+	return output, nil
+}
+
+// planRetrievalStep plans an index or retrieve step, which embeds its text
+func (pl *planner) planRetrievalStep(step Step, ps *PlanStep) (planValue, error) {
+	p := pl.p
+	providerName := ""
+	if step.Config.Type == "index" {
+		if step.Config.Index == nil || step.Config.Index.Path == "" {
+			return planValue{}, fmt.Errorf("index step %s requires index.path", step.Name)
+		}
+		providerName = step.Config.Index.Provider
+	} else {
+		if step.Config.Retrieve == nil || step.Config.Retrieve.Index == "" {
+			return planValue{}, fmt.Errorf("retrieve step %s requires retrieve.index", step.Name)
+		}
+		providerName = step.Config.Retrieve.Provider
+	}
+	modelNames := p.NormalizeStringSlice(step.Config.Model)
+	if len(modelNames) == 0 || modelNames[0] == "NA" {
+		return planValue{}, fmt.Errorf("%s step %s requires an embedding model", step.Config.Type, step.Name)
+	}
+	ps.Model = modelNames[0]
+	modelName, providerName, err := pl.p.splitStepModel(ps.Model, providerName)
+	if err != nil {
+		return planValue{}, err
+	}
+	embedder := models.DetectEmbedder(modelName, providerName)
+	if embedder == nil {
+		return planValue{}, fmt.Errorf("no embedding backend found for model %s (set provider to openai, google, ollama or vllm)", modelName)
+	}
+	ps.Provider = embedder.Name()
+	ps.APIModel = modelName
+
+	items, err := pl.textItems(step, ps)
+	if err != nil {
+		return planValue{}, err
+	}
+	ps.addInputs(items)
+
+	var output planValue
+	if step.Config.Type == "index" {
+		if len(items) == 0 {
+			return planValue{}, fmt.Errorf("index step %s has no text inputs", step.Name)
+		}
+		for _, item := range items {
+			ps.Calls = append(ps.Calls, pl.call("", []planItem{item}, 0))
+		}
+		ps.Notes = append(ps.Notes, fmt.Sprintf("embeds the inputs in chunks into %s", step.Config.Index.Path))
+		output = planValue{text: fmt.Sprintf("Indexed %d input(s) into %s", len(items), step.Config.Index.Path), tokens: 10, step: step.Name}
+	} else {
+		var query []string
+		if actions := p.NormalizeStringSlice(step.Config.Action); len(actions) > 0 {
+			query = append(query, p.substituteVariables(strings.Join(actions, "\n")))
+		}
+		for _, item := range items {
+			query = append(query, item.text)
+		}
+		ps.Calls = append(ps.Calls, pl.call(strings.Join(query, "\n\n"), nil, 0))
+		topK := step.Config.Retrieve.TopK
+		if topK <= 0 {
+			topK = defaultRetrieveTopK
+		}
+		tokens := topK * defaultIndexChunkSize
+		ps.Notes = append(ps.Notes, fmt.Sprintf("returns up to %d chunks from %s", topK, step.Config.Retrieve.Index))
+		output = pl.runtimeValue(fmt.Sprintf("<chunks retrieved by %s, ~%d tokens>", step.Name, tokens), tokens, step.Name)
+	}
+	pl.setCost(ps, 1)
+	pl.planOutputs(step, ps, output, nil)
+	return output, nil
+}
+
+// planGenerateStep plans a generate step, which asks a model for a workflow
+func (pl *planner) planGenerateStep(step Step, ps *PlanStep) (planValue, error) {
+	p := pl.p
+	if modelNames := p.NormalizeStringSlice(step.Config.Generate.Model); len(modelNames) > 0 {
+		ps.Model = modelNames[0]
+	}
+	if ps.Model == "" && p.envConfig != nil {
+		ps.Model = p.envConfig.DefaultGenerationModel
+	}
+	if ps.Model == "" {
+		return planValue{}, fmt.Errorf("no model specified for generate step '%s' and no default_generation_model configured", step.Name)
+	}
+	if err := pl.resolveModel(ps, ps.Model); err != nil {
+		return planValue{}, err
+	}
+	userAction := ""
+	if actions := p.NormalizeStringSlice(step.Config.Generate.Action); len(actions) > 0 {
+		userAction = actions[0]
+	}
+	if userAction == "" {
+		return planValue{}, fmt.Errorf("action for generate step '%s' is empty", step.Name)
+	}
+
+	// Unreadable inputs and context files are skipped, as in processGenerateStep
+	var contextInput, contextFiles string
+	if step.Config.Input != nil {
+		inputValStr := fmt.Sprintf("%v", step.Config.Input)
+		if inputValStr == "STDIN" {
+			item := pl.stdinItem()
+			ps.addInputs([]planItem{item})
+			contextInput = item.text
+		} else if inputValStr != "NA" && inputValStr != "" {
+			for _, path := range p.NormalizeStringSlice(step.Config.Input) {
+				if item, ok := pl.contextFile(path); ok {
+					ps.addInputs([]planItem{item})
+					contextInput += item.text + "\n\n"
+				}
+			}
+		}
+	}
+	for _, path := range step.Config.Generate.ContextFiles {
+		if item, ok := pl.contextFile(path); ok {
+			ps.addInputs([]planItem{item})
+			contextFiles += item.text + "\n\n"
+		}
+	}
+
+	guide := GetEmbeddedLLMGuide()
+	guideTokens := ratelimit.EstimateTokens(guide)
+	placeholder := pl.placeholder(fmt.Sprintf("<comanda workflow guide, ~%d tokens>", guideTokens), guideTokens)
+	prompt := p.generationPrompt(placeholder, userAction, contextInput, contextFiles)
+	outputTokens := pl.maxOutputTokens(ps, step)
+	ps.Calls = append(ps.Calls, pl.call(prompt, nil, outputTokens))
+	pl.setCost(ps, 1)
+
+	out := step.Config.Generate.Output
+	ps.Outputs = append(ps.Outputs, out)
+	pl.files[out] = pl.runtimeValue(fmt.Sprintf("<workflow generated by %s, ~%d tokens>", step.Name, outputTokens), outputTokens, step.Name)
+	message := fmt.Sprintf("Generated workflow saved to %s", out)
+	return planValue{text: message, tokens: ratelimit.EstimateTokens(message), step: step.Name}, nil
+}
+
+// contextFile resolves a file read directly by a generate step
+func (pl *planner) contextFile(path string) (planItem, bool) {
+	if value, ok := pl.written(path); ok {
+		return pl.fileItem(path, itemText, value.tokens, "written by step "+value.step), true
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return planItem{}, false
+	}
+	return pl.fileItem(path, itemText, ratelimit.EstimateTokensForSize(info.Size()), ""), true
+}
+
+// planProcessStep plans the sub-workflow of a process step
+func (pl *planner) planProcessStep(step Step, ps *PlanStep) (planValue, error) {
+	p := pl.p
+	subWorkflowPath := step.Config.Process.WorkflowFile
+	ps.Model = "N/A"
+	ps.Inputs = append(ps.Inputs, PlanInput{Source: subWorkflowPath, Note: "sub-workflow"})
+	yamlFile, err := os.ReadFile(subWorkflowPath)
+	if err != nil {
+		return planValue{}, fmt.Errorf("failed to read sub-workflow file '%s' for process step '%s': %w", subWorkflowPath, step.Name, err)
+	}
+	var subDSLConfig DSLConfig
+	if err := yaml.Unmarshal(yamlFile, &subDSLConfig); err != nil {
+		return planValue{}, fmt.Errorf("failed to unmarshal sub-workflow YAML '%s' for process step '%s': %w", subWorkflowPath, step.Name, err)
+	}
+
+	subProcessor := NewProcessor(&subDSLConfig, p.envConfig, p.serverConfig, p.verbose, p.runtimeDir)
+	if step.Config.Process.Inputs != nil {
+		inputs := make(map[string]string, len(step.Config.Process.Inputs))
+		for key, value := range step.Config.Process.Inputs {
+			inputs[key] = p.substituteParams(fmt.Sprintf("%v", value))
+		}
+		if err := subProcessor.SetParams(inputs); err != nil {
+			return planValue{}, fmt.Errorf("invalid inputs for sub-workflow '%s' in step '%s': %w", subWorkflowPath, step.Name, err)
+		}
+	}
+
+	sub := &planner{p: subProcessor, files: pl.files, placeholders: pl.placeholders}
+	if fmt.Sprintf("%v", step.Config.Input) == "STDIN" {
+		sub.lastOutput = pl.lastOutput
+	}
+	subPlan, err := sub.plan()
+	if err != nil {
+		return planValue{}, fmt.Errorf("error planning sub-workflow '%s' in step '%s': %w", subWorkflowPath, step.Name, err)
+	}
+	ps.Workflow = subPlan
+	return sub.lastOutput, nil
+}
+
+// planShownCalls is the number of requests shown per step; steps that send one
+// request per file or chunk list the rest as a count
+const planShownCalls = 3
+
+// Write prints the plan in a readable form
+func (plan *Plan) Write(w io.Writer) {
+	fmt.Fprintln(w, "Execution plan (no models are called)")
+	plan.write(w, "")
+
+	fmt.Fprintf(w, "\nTotal: %d request(s), ~%d input tokens, ~%d output tokens, estimated cost $%.4f\n",
+		plan.Requests, plan.InputTokens, plan.OutputTokens, plan.Cost)
+	if len(plan.Unpriced) > 0 {
+		fmt.Fprintf(w, "Not priced: %s (set pricing on the model in the configuration)\n", strings.Join(plan.Unpriced, ", "))
+	}
+	fmt.Fprintf(w, "Output tokens assume max_tokens per request, or %d when it is not set. Tokens are estimated at 4 characters per token.\n", planOutputTokens)
+}
+
+// write prints the stages and deferred steps of a plan with an indent
+func (plan *Plan) write(w io.Writer, indent string) {
+	for i, stage := range plan.Stages {
+		if stage.Group != "" {
+			fmt.Fprintf(w, "\n%s%d. Parallel group %s (%d steps run concurrently)\n", indent, i+1, stage.Group, len(stage.Steps))
+			for _, ps := range stage.Steps {
+				ps.write(w, indent+"   ", "- ")
+			}
+		} else {
+			fmt.Fprintln(w)
+			ps := stage.Steps[0]
+			ps.write(w, indent, fmt.Sprintf("%d. ", i+1))
+		}
+	}
+	if len(plan.Deferred) > 0 {
+		fmt.Fprintf(w, "\n%sDeferred steps (run only when a step's output calls them, not included in the total):\n", indent)
+		for _, ps := range plan.Deferred {
+			ps.write(w, indent+"   ", "- ")
+		}
+	}
+}
+
+// write prints a step
+func (ps *PlanStep) write(w io.Writer, indent string, bullet string) {
+	fmt.Fprintf(w, "%s%sStep %s (%s)\n", indent, bullet, ps.Name, ps.Type)
+	indent += strings.Repeat(" ", len(bullet))
+	if ps.Provider != "" {
+		fmt.Fprintf(w, "%sModel: %s -> %s/%s\n", indent, ps.Model, ps.Provider, ps.APIModel)
+	} else if ps.Model != "" {
+		fmt.Fprintf(w, "%sModel: %s\n", indent, ps.Model)
+	}
+	if len(ps.Inputs) > 0 {
+		fmt.Fprintf(w, "%sInputs:\n", indent)
+		for _, in := range ps.Inputs {
+			detail := fmt.Sprintf("~%d tokens", in.Tokens)
+			if in.Tokens == 0 && in.Note != "" {
+				detail = in.Note
+			} else if in.Note != "" {
+				detail += ", " + in.Note
+			}
+			fmt.Fprintf(w, "%s  - %s (%s)\n", indent, in.Source, detail)
+		}
+	}
+	if len(ps.Outputs) > 0 {
+		fmt.Fprintf(w, "%sOutputs: %s\n", indent, strings.Join(ps.Outputs, ", "))
+	}
+	for _, note := range ps.Notes {
+		fmt.Fprintf(w, "%sNote: %s\n", indent, note)
+	}
+	for i, call := range ps.Calls {
+		if i == planShownCalls {
+			fmt.Fprintf(w, "%s... and %d more request(s) like these\n", indent, len(ps.Calls)-planShownCalls)
+			break
+		}
+		fmt.Fprintf(w, "%sRequest %d: ~%d input tokens, ~%d output tokens\n", indent, i+1, call.InputTokens, call.OutputTokens)
+		if len(call.Files) > 0 {
+			fmt.Fprintf(w, "%s  Attached: %s\n", indent, strings.Join(call.Files, ", "))
+		}
+		if call.Prompt != "" {
+			for _, line := range strings.Split(call.Prompt, "\n") {
+				fmt.Fprintf(w, "%s  | %s\n", indent, line)
+			}
+		}
+	}
+	if ps.Workflow != nil {
+		ps.Workflow.write(w, indent+"   ")
+	}
+	requests := len(ps.Calls)
+	cost := "not priced"
+	if ps.Priced {
+		cost = fmt.Sprintf("$%.4f", ps.Cost)
+	}
+	if ps.Workflow != nil {
+		requests += ps.Workflow.Requests
+		if len(ps.Workflow.Unpriced) > 0 {
+			cost += " plus unpriced models"
+		}
+	}
+	fmt.Fprintf(w, "%sEstimate: %d request(s), ~%d input tokens, ~%d output tokens, %s\n", indent, requests, ps.InputTokens, ps.OutputTokens, cost)
+}
@@ -0,0 +1,245 @@
+package processor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"gopkg.in/yaml.v3"
+)
+
+// newPlanProcessor parses a workflow whose DIR placeholders name a directory
+// and returns a processor for it
+func newPlanProcessor(t *testing.T, workflow string, dir string, envConfig *config.EnvConfig) *Processor {
+	t.Helper()
+	var dslConfig DSLConfig
+	if err := yaml.Unmarshal([]byte(strings.ReplaceAll(workflow, "DIR", dir)), &dslConfig); err != nil {
+		t.Fatalf("Failed to parse workflow: %v", err)
+	}
+	return NewProcessor(&dslConfig, envConfig, nil, false)
+}
+
+// writePlanFile writes a file in dir
+func writePlanFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	dir := t.TempDir()
+	writePlanFile(t, dir, "a.txt", strings.Repeat("a", 400))
+	writePlanFile(t, dir, "b.txt", strings.Repeat("b", 40))
+
+	workflow := `
+workflow:
+  params:
+    audience:
+      default: engineers
+parallel-process:
+  summarize:
+    input: DIR/*.txt
+    model: gpt-4o-mini
+    action: Summarize for $audience
+    output: DIR/summary_{{ file_index }}.txt
+  draft:
+    input: NA
+    model: gpt-4o
+    action: Write an outline
+    output: DIR/outline.txt
+review:
+  input: DIR/outline.txt
+  model: gpt-4o
+  action: Review the outline
+  params:
+    max_tokens: 200
+  output: STDOUT
+polish:
+  input: STDIN as $review
+  model: gpt-4o
+  action: Apply $review
+  output: STDOUT
+defer:
+  fix:
+    input: STDIN
+    model: gpt-4o
+    action: Fix it
+    output: STDOUT
+`
+	proc := newPlanProcessor(t, workflow, dir, createTestEnvConfig())
+	plan, err := proc.Plan()
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+
+	if len(plan.Stages) != 3 || plan.Stages[0].Group != "parallel-process" || len(plan.Stages[0].Steps) != 2 {
+		t.Fatalf("Expected the parallel group and then two steps, got %+v", plan.Stages)
+	}
+	// Steps of a parallel group have no order
+	summarize := plan.Stages[0].Steps[0]
+	if summarize.Name != "summarize" {
+		summarize = plan.Stages[0].Steps[1]
+	}
+	if summarize.Provider != "openai" || summarize.APIModel != "gpt-4o-mini" {
+		t.Errorf("Expected gpt-4o-mini to resolve to openai, got %s/%s", summarize.Provider, summarize.APIModel)
+	}
+	if len(summarize.Calls) != 2 || len(summarize.Inputs) != 2 {
+		t.Fatalf("Expected one request per matched file, got %d requests for %d inputs", len(summarize.Calls), len(summarize.Inputs))
+	}
+	if got := summarize.Calls[0].Prompt; got != filePrompt("Summarize for engineers") {
+		t.Errorf("Expected the param to be expanded in the prompt, got %q", got)
+	}
+	if summarize.Inputs[0].Tokens != 100 {
+		t.Errorf("Expected 400 characters to be ~100 tokens, got %d", summarize.Inputs[0].Tokens)
+	}
+	wantOutputs := []string{filepath.Join(dir, "summary_0.txt"), filepath.Join(dir, "summary_1.txt")}
+	if strings.Join(summarize.Outputs, ",") != strings.Join(wantOutputs, ",") {
+		t.Errorf("Expected outputs %v, got %v", wantOutputs, summarize.Outputs)
+	}
+
+	review := plan.Stages[1].Steps[0]
+	if len(review.Inputs) != 1 || review.Inputs[0].Tokens != planOutputTokens || review.Inputs[0].Note != "written by step draft" {
+		t.Errorf("Expected the outline to be estimated from the draft step, got %+v", review.Inputs)
+	}
+	if review.Calls[0].OutputTokens != 200 {
+		t.Errorf("Expected max_tokens to bound the output, got %d", review.Calls[0].OutputTokens)
+	}
+
+	polish := plan.Stages[2].Steps[0]
+	if got, want := polish.Calls[0].Prompt, "Apply <output of review, ~200 tokens>"; got != want {
+		t.Errorf("Expected prompt %q, got %q", want, got)
+	}
+	// The variable and the attached STDIN are both the review's output
+	if got := polish.Calls[0].InputTokens; got < 400 || got > 410 {
+		t.Errorf("Expected ~400 input tokens, got %d", got)
+	}
+
+	if len(plan.Deferred) != 1 || plan.Deferred[0].Name != "fix" {
+		t.Errorf("Expected the deferred step to be listed separately, got %+v", plan.Deferred)
+	}
+	if plan.Requests != 5 {
+		t.Errorf("Expected 5 requests without the deferred step, got %d", plan.Requests)
+	}
+	if plan.Cost <= 0 || len(plan.Unpriced) != 0 {
+		t.Errorf("Expected a priced estimate, got $%f with unpriced %v", plan.Cost, plan.Unpriced)
+	}
+
+	var out bytes.Buffer
+	plan.Write(&out)
+	for _, want := range []string{"1. Parallel group parallel-process (2 steps run concurrently)", "Model: gpt-4o-mini -> openai/gpt-4o-mini", "| Apply <output of review, ~200 tokens>", "Deferred steps", "Total: 5 request(s)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected the plan to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestPlanChunks(t *testing.T) {
+	dir := t.TempDir()
+	writePlanFile(t, dir, "log.txt", strings.Repeat("line of the log\n", 10))
+
+	workflow := `
+extract:
+  input: DIR/log.txt
+  model: gpt-4o
+  action: "Extract errors from chunk {{ chunk_index }} of {{ total_chunks }}"
+  chunk:
+    by: lines
+    size: 4
+  output: DIR/errors_{{ chunk_index }}.txt
+`
+	plan, err := newPlanProcessor(t, workflow, dir, createTestEnvConfig()).Plan()
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	step := plan.Stages[0].Steps[0]
+	if len(step.Calls) != 3 {
+		t.Fatalf("Expected 10 lines in chunks of 4 to be 3 requests, got %d", len(step.Calls))
+	}
+	if got, want := step.Calls[0].Files[0], filepath.Join(dir, "log.txt")+" (chunk 1/3)"; got != want {
+		t.Errorf("Expected attachment %q, got %q", want, got)
+	}
+	if !strings.HasSuffix(step.Calls[0].Prompt, "Extract errors from chunk 1 of 3") {
+		t.Errorf("Expected the chunk placeholders to be expanded, got %q", step.Calls[0].Prompt)
+	}
+	if got := step.Outputs[2]; got != filepath.Join(dir, "errors_2.txt") {
+		t.Errorf("Expected one output per chunk, got %v", step.Outputs)
+	}
+}
+
+func TestPlanPricing(t *testing.T) {
+	envConfig := createTestEnvConfig()
+	envConfig.Providers["openai"].Models = append(envConfig.Providers["openai"].Models,
+		config.Model{Name: "gpt-custom", Pricing: &config.Pricing{Input: 1000, Output: 2000}},
+		config.Model{Name: "ft-unknown"})
+	envConfig.Providers["ollama"] = &config.Provider{Models: []config.Model{{Name: "llama3"}}}
+
+	workflow := `
+priced:
+  input: NA
+  model: openai/gpt-custom
+  action: "` + strings.Repeat("x", 4000) + `"
+  params:
+    max_tokens: 1000
+  output: STDOUT
+local:
+  input: NA
+  model: ollama/llama3
+  action: Hello
+  output: STDOUT
+unknown:
+  input: NA
+  model: openai/ft-unknown
+  action: Hello
+  output: STDOUT
+`
+	plan, err := newPlanProcessor(t, workflow, "", envConfig).Plan()
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	// 1000 input tokens at $1000/M and 1000 output tokens at $2000/M
+	if got := plan.Stages[0].Steps[0].Cost; got != 3 {
+		t.Errorf("Expected the configured pricing to cost $3, got $%f", got)
+	}
+	if local := plan.Stages[1].Steps[0]; !local.Priced || local.Cost != 0 {
+		t.Errorf("Expected local models to be free, got priced=%v cost=%f", local.Priced, local.Cost)
+	}
+	if len(plan.Unpriced) != 1 || plan.Unpriced[0] != "openai/ft-unknown" {
+		t.Errorf("Expected the unknown model to be unpriced, got %v", plan.Unpriced)
+	}
+}
+
+func TestPlanErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		workflow string
+		err      string
+	}{
+		{
+			name:     "model not enabled",
+			workflow: "step:\n  input: NA\n  model: gpt-4o-2024-08-06\n  action: A\n  output: STDOUT\n",
+			err:      "not enabled in your configuration",
+		},
+		{
+			name:     "missing input file",
+			workflow: "step:\n  input: DIR/missing.txt\n  model: gpt-4o\n  action: A\n  output: STDOUT\n",
+			err:      "not found",
+		},
+		{
+			name:     "missing param",
+			workflow: "workflow:\n  params:\n    doc:\n      required: true\nstep:\n  input: NA\n  model: gpt-4o\n  action: A\n  output: STDOUT\n",
+			err:      "validation failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newPlanProcessor(t, tt.workflow, t.TempDir(), createTestEnvConfig()).Plan()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"os"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/ratelimit"
+)
+
+// throttle applies the configured rate limits of a model and the key rotation
+// of its provider to the requests of a step. The limiters and key pools are
+// shared by all steps and server requests in the process; the throttle only
+// adds up the time this step spent waiting.
+type throttle struct {
+	limits map[string]config.RateLimit
+	keys   *keyRotation
+	waited time.Duration
+}
+
+// newThrottle returns the throttle for a model of a provider. The provider
+// instance is reconfigured per request when the provider has several API keys.
+func (p *Processor) newThrottle(providerName string, modelName string, provider models.Provider) (*throttle, error) {
+	limits, err := p.envConfig.GetRateLimits(providerName, modelName)
+	if err != nil {
+		return nil, err
+	}
+	if len(limits) > 0 {
+		p.debugf("Rate limits for %s/%s: %v", providerName, modelName, limits)
+	}
+	return &throttle{limits: limits, keys: p.newKeyRotation(providerName, provider)}, nil
+}
+
+// send waits until the rate limits allow a request with the given prompt and
+// files, sends it and charges the tokens of the response
+func (t *throttle) send(prompt string, files []models.FileInput, request func() (string, error)) (string, error) {
+	if t == nil {
+		return request()
+	}
+	if len(t.limits) == 0 {
+		return t.keys.send(request)
+	}
+	t.waited += ratelimit.Wait(t.limits, ratelimit.EstimateTokens(prompt)+fileTokens(files))
+	response, err := t.keys.send(request)
+	if err == nil {
+		ratelimit.Charge(t.limits, ratelimit.EstimateTokens(response))
+	}
+	return response, err
+}
+
+// fileTokens estimates the tokens of attached files from their size
+func fileTokens(files []models.FileInput) int {
+	var size int64
+	for _, file := range files {
+		if file.Data != nil {
+			size += int64(len(file.Data))
+		} else if info, err := os.Stat(file.Path); err == nil {
+			size += info.Size()
+		}
+	}
+	return ratelimit.EstimateTokensForSize(size)
+}
@@ -372,16 +372,19 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 	}
 	modelName := modelNames[0]
 
-	// Get the OpenAI provider
-	provider := models.DetectProvider(modelName)
-	if provider == nil || provider.Name() != "openai" {
-		return "", fmt.Errorf("openai-responses step requires an OpenAI model, got: %s", modelName)
+	// Get a provider that implements the Responses API (OpenAI or an openai-compatible endpoint)
+	provider := p.detectProvider(modelName)
+	if _, ok := provider.(models.ResponsesProvider); !ok {
+		return "", fmt.Errorf("openai-responses step requires an OpenAI or openai-compatible model, got: %s", modelName)
 	}
 
+	// Send the name the provider knows, without alias or provider prefix
+	apiModel := p.bareModelName(modelName)
+
 	// Check if this is a model that requires the responses API
-	isResponsesAPIModel := strings.HasPrefix(modelName, "o1-pro") ||
-		strings.HasPrefix(modelName, "o3-") ||
-		strings.HasPrefix(modelName, "o4-")
+	isResponsesAPIModel := strings.HasPrefix(apiModel, "o1-pro") ||
+		strings.HasPrefix(apiModel, "o3-") ||
+		strings.HasPrefix(apiModel, "o4-")
 
 	// Log a warning if a model requires the responses API but doesn't have a response format
 	if isResponsesAPIModel && step.Config.ResponseFormat == nil {
@@ -426,6 +429,27 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 		return "", fmt.Errorf("OpenAI provider not configured")
 	}
 
+	// API key rotation reconfigures a provider instance of this step only
+	if p.rotatesKeys(configuredProvider.Name()) {
+		detected := p.detectProvider(modelName)
+		if detected == nil {
+			return "", fmt.Errorf("provider not found for model: %s", modelName)
+		}
+		if err := p.configureProvider(detected.Name(), detected); err != nil {
+			return "", err
+		}
+		detected.SetVerbose(p.verbose)
+		configuredProvider = detected
+	}
+	configuredProvider = stepProvider(configuredProvider, step.Name)
+
+	// Merge the model's default params with the step's and check that the
+	// Responses API accepts them
+	params := p.modelParams(configuredProvider.Name(), apiModel, stepParams(step.Config))
+	if err := models.CheckResponsesParams(params); err != nil {
+		return "", fmt.Errorf("step %s: %w", step.Name, err)
+	}
+
 	// Check if the provider implements ResponsesProvider interface
 	responsesProvider, ok := configuredProvider.(models.ResponsesProvider)
 	if !ok {
@@ -488,16 +512,14 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 
 	// Create ResponsesConfig
 	config := models.ResponsesConfig{
-		Model:              modelName,
+		Model:              apiModel,
 		Input:              prompt,
 		Instructions:       step.Config.Instructions,
 		PreviousResponseID: step.Config.PreviousResponseID,
-		MaxOutputTokens:    step.Config.MaxOutputTokens,
-		Temperature:        step.Config.Temperature,
-		TopP:               step.Config.TopP,
 		Stream:             step.Config.Stream,
 		Tools:              step.Config.Tools,
 	}
+	config.ApplyParams(params)
 
 	// Log the configuration details for debugging
 	p.debugf("ResponsesConfig details:")
@@ -506,6 +528,7 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 	p.debugf("- MaxOutputTokens: %d", config.MaxOutputTokens)
 	p.debugf("- Temperature: %f", config.Temperature)
 	p.debugf("- TopP: %f", config.TopP)
+	p.debugf("- ReasoningEffort: %s", config.ReasoningEffort)
 	p.debugf("- Stream: %v", config.Stream)
 	p.debugf("- Has Tools: %v", config.Tools != nil)
 	p.debugf("- Has PreviousResponseID: %v", config.PreviousResponseID != "")
@@ -540,6 +563,12 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 		ParallelID: parallelID,
 	})
 
+	// Requests wait for the configured rate limits of the provider and model
+	limiter, err := p.newThrottle(configuredProvider.Name(), apiModel, configuredProvider)
+	if err != nil {
+		return "", err
+	}
+
 	var response string
 
 	// Check if streaming is enabled
@@ -559,17 +588,22 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 		}
 
 		// Send the request with streaming
-		err = responsesProvider.SendPromptWithResponsesStream(config, streamHandler)
+		_, err = limiter.send(prompt+config.Instructions, nil, func() (string, error) {
+			err := responsesProvider.SendPromptWithResponsesStream(config, streamHandler)
+			return responseBuffer.String(), err
+		})
 		if err != nil {
-			return "", fmt.Errorf("streaming error: %w", err)
+			return "", fmt.Errorf("streaming error: %w", models.ExplainParamError(err, modelName, params))
 		}
 
 		response = responseBuffer.String()
 	} else {
 		// Non-streaming path
-		response, err = responsesProvider.SendPromptWithResponses(config)
+		response, err = limiter.send(prompt+config.Instructions, nil, func() (string, error) {
+			return responsesProvider.SendPromptWithResponses(config)
+		})
 		if err != nil {
-			return "", err
+			return "", models.ExplainParamError(err, modelName, params)
 		}
 
 		// Extract and store the response ID for potential future use
@@ -584,6 +618,7 @@ func (p *Processor) processResponsesStep(step Step, isParallel bool, parallelID
 	// Calculate performance metrics
 	elapsedTime := time.Since(startTime)
 	metrics := &PerformanceMetrics{
+		RateLimitWaitTime:   limiter.waited.Milliseconds(),
 		TotalProcessingTime: elapsedTime.Milliseconds(),
 	}
 
@@ -0,0 +1,332 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/chunker"
+	"github.com/kris-hansen/comanda/utils/models"
+	"github.com/kris-hansen/comanda/utils/vectorindex"
+)
+
+// Defaults for index and retrieve steps
+const (
+	defaultIndexChunkBy      = "tokens"
+	defaultIndexChunkSize    = 500
+	defaultIndexChunkOverlap = 50
+	defaultIndexMaxChunks    = 10000
+	defaultRetrieveTopK      = 5
+)
+
+// getEmbedder resolves and configures the embedding backend for a step
+func (p *Processor) getEmbedder(step Step, providerName string) (models.EmbeddingProvider, string, error) {
+	modelNames := p.NormalizeStringSlice(step.Config.Model)
+	if len(modelNames) == 0 || modelNames[0] == "NA" {
+		return nil, "", fmt.Errorf("%s step %s requires an embedding model", step.Config.Type, step.Name)
+	}
+	modelName, providerName, err := p.splitStepModel(modelNames[0], providerName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	embedder := models.DetectEmbedder(modelName, providerName)
+	if embedder == nil {
+		return nil, "", fmt.Errorf("no embedding backend found for model %s (set provider to openai, google, ollama or vllm)", modelName)
+	}
+
+	if err := p.configureStandaloneProvider(embedder); err != nil {
+		return nil, "", err
+	}
+	return embedder, modelName, nil
+}
+
+// chunkText splits text into chunks using the step's chunk configuration,
+// defaulting to 500-token chunks with a 50-token overlap. Options left out of
+// the chunk block keep their defaults, so "by: lines" alone makes 500-line chunks.
+func (p *Processor) chunkText(step Step, text string) ([]string, error) {
+	chunkConfig := chunker.ChunkConfig{
+		By:        defaultIndexChunkBy,
+		Size:      defaultIndexChunkSize,
+		Overlap:   defaultIndexChunkOverlap,
+		MaxChunks: defaultIndexMaxChunks,
+	}
+	if step.Config.Chunk != nil {
+		if step.Config.Chunk.By != "" {
+			chunkConfig.By = step.Config.Chunk.By
+		}
+		// An explicit size comes with its own overlap, which may be none
+		if step.Config.Chunk.Size > 0 {
+			chunkConfig.Size = step.Config.Chunk.Size
+			chunkConfig.Overlap = step.Config.Chunk.Overlap
+		}
+		if step.Config.Chunk.MaxChunks > 0 {
+			chunkConfig.MaxChunks = step.Config.Chunk.MaxChunks
+		}
+	}
+
+	// The chunker works on files, so stage the text in a temp file
+	tmpFile, err := os.CreateTemp("", "comanda-index-*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file for chunking: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+	if _, err := tmpFile.WriteString(text); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("failed to write temp file for chunking: %w", err)
+	}
+	tmpFile.Close()
+
+	chunkResult, err := chunker.SplitFile(tmpPath, chunkConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split input into chunks: %w", err)
+	}
+	defer chunker.CleanupChunks(chunkResult)
+
+	var chunks []string
+	for _, chunkPath := range chunkResult.ChunkPaths {
+		data, err := os.ReadFile(chunkPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chunk %s: %w", chunkPath, err)
+		}
+		if strings.TrimSpace(string(data)) != "" {
+			chunks = append(chunks, string(data))
+		}
+	}
+	return chunks, nil
+}
+
+// processIndexStep handles the index step type: each input is chunked, embedded
+// and stored in the local vector index, replacing earlier chunks of the same source
+func (p *Processor) processIndexStep(step Step, isParallel bool, parallelID string) (string, error) {
+	p.debugf("Processing index step: %s", step.Name)
+	startTime := time.Now()
+	metrics := &PerformanceMetrics{}
+
+	cfg := IndexConfig{}
+	if step.Config.Index != nil {
+		cfg = *step.Config.Index
+	}
+	if cfg.Path == "" {
+		return "", fmt.Errorf("index step %s requires index.path", step.Name)
+	}
+
+	stepInfo := &StepInfo{Name: step.Name, Model: fmt.Sprintf("%v", step.Config.Model), Action: "Index into " + cfg.Path}
+	p.sendProgressUpdate(ProgressUpdate{
+		Type:       ProgressStep,
+		Message:    fmt.Sprintf("Starting index step: %s", step.Name),
+		Step:       stepInfo,
+		IsParallel: isParallel,
+		ParallelID: parallelID,
+	})
+
+	inputStartTime := time.Now()
+	textInputs, err := p.gatherTextInputs(step)
+	if err != nil {
+		return "", err
+	}
+	if len(textInputs) == 0 {
+		return "", fmt.Errorf("index step %s has no text inputs", step.Name)
+	}
+	metrics.InputProcessingTime = time.Since(inputStartTime).Milliseconds()
+
+	modelStartTime := time.Now()
+	embedder, modelName, err := p.getEmbedder(step, cfg.Provider)
+	if err != nil {
+		return "", err
+	}
+
+	indexPath := p.resolveOutputPath(cfg.Path)
+	index, err := vectorindex.Open(indexPath)
+	if err != nil {
+		return "", err
+	}
+	if err := index.CheckModel(modelName); err != nil {
+		return "", err
+	}
+	metrics.ModelProcessingTime = time.Since(modelStartTime).Milliseconds()
+
+	actionStartTime := time.Now()
+	totalChunks := 0
+	for _, textInput := range textInputs {
+		chunks, err := p.chunkText(step, textInput.Text)
+		if err != nil {
+			return "", fmt.Errorf("failed to chunk %s: %w", textInput.Source, err)
+		}
+		if len(chunks) == 0 {
+			p.debugf("Skipping empty input %s", textInput.Source)
+			continue
+		}
+
+		p.debugf("Embedding %d chunk(s) from %s", len(chunks), textInput.Source)
+		vectors, err := embedder.Embed(modelName, chunks)
+		if err != nil {
+			return "", fmt.Errorf("failed to embed %s: %w", textInput.Source, err)
+		}
+		if len(vectors) != len(chunks) {
+			return "", fmt.Errorf("expected %d embeddings for %s, got %d", len(chunks), textInput.Source, len(vectors))
+		}
+
+		entries := make([]vectorindex.Entry, len(chunks))
+		for i, chunk := range chunks {
+			entries[i] = vectorindex.Entry{
+				ID:     fmt.Sprintf("%s#%d", textInput.Source, i),
+				Source: textInput.Source,
+				Chunk:  i,
+				Text:   chunk,
+				Vector: vectors[i],
+			}
+		}
+		if err := index.ReplaceSource(textInput.Source, entries); err != nil {
+			return "", err
+		}
+		totalChunks += len(chunks)
+	}
+
+	if err := index.Save(); err != nil {
+		return "", err
+	}
+	metrics.ActionProcessingTime = time.Since(actionStartTime).Milliseconds()
+
+	summary := fmt.Sprintf("Indexed %d chunk(s) from %d input(s) into %s (%d chunk(s) from %d source(s) in total)",
+		totalChunks, len(textInputs), cfg.Path, index.Len(), len(index.Sources()))
+
+	outputStartTime := time.Now()
+	if outputs := p.NormalizeStringSlice(step.Config.Output); len(outputs) > 0 {
+		if err := p.handleOutput(modelName, summary, outputs, metrics); err != nil {
+			return "", fmt.Errorf("output handling error: %w", err)
+		}
+	}
+	metrics.OutputProcessingTime = time.Since(outputStartTime).Milliseconds()
+	metrics.TotalProcessingTime = time.Since(startTime).Milliseconds()
+
+	p.sendProgressUpdate(ProgressUpdate{
+		Type:               ProgressComplete,
+		Message:            fmt.Sprintf("Completed index step: %s", step.Name),
+		Step:               stepInfo,
+		IsParallel:         isParallel,
+		ParallelID:         parallelID,
+		PerformanceMetrics: metrics,
+	})
+
+	return summary, nil
+}
+
+// formatRetrievalResults renders retrieved chunks as numbered context blocks
+func formatRetrievalResults(results []vectorindex.Result) string {
+	var sb strings.Builder
+	for i, result := range results {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString(fmt.Sprintf("[%d] %s (chunk %d, score %.3f)\n", i+1, result.Source, result.Chunk, result.Score))
+		sb.WriteString(strings.TrimSpace(result.Text))
+	}
+	return sb.String()
+}
+
+// processRetrieveStep handles the retrieve step type. The action (plus any text
+// inputs) is the query; the top-k matching chunks become the step's output so
+// that the next step can use them as STDIN.
+func (p *Processor) processRetrieveStep(step Step, isParallel bool, parallelID string) (string, error) {
+	p.debugf("Processing retrieve step: %s", step.Name)
+	startTime := time.Now()
+	metrics := &PerformanceMetrics{}
+
+	cfg := RetrieveConfig{}
+	if step.Config.Retrieve != nil {
+		cfg = *step.Config.Retrieve
+	}
+	if cfg.Index == "" {
+		return "", fmt.Errorf("retrieve step %s requires retrieve.index", step.Name)
+	}
+	if cfg.TopK <= 0 {
+		cfg.TopK = defaultRetrieveTopK
+	}
+
+	actions := p.NormalizeStringSlice(step.Config.Action)
+	stepInfo := &StepInfo{Name: step.Name, Model: fmt.Sprintf("%v", step.Config.Model), Action: strings.Join(actions, "\n")}
+	p.sendProgressUpdate(ProgressUpdate{
+		Type:       ProgressStep,
+		Message:    fmt.Sprintf("Starting retrieve step: %s", step.Name),
+		Step:       stepInfo,
+		IsParallel: isParallel,
+		ParallelID: parallelID,
+	})
+
+	inputStartTime := time.Now()
+	textInputs, err := p.gatherTextInputs(step)
+	if err != nil {
+		return "", err
+	}
+	var queryParts []string
+	if len(actions) > 0 {
+		queryParts = append(queryParts, p.substituteVariables(strings.Join(actions, "\n")))
+	}
+	for _, textInput := range textInputs {
+		queryParts = append(queryParts, textInput.Text)
+	}
+	query := strings.TrimSpace(strings.Join(queryParts, "\n\n"))
+	if query == "" {
+		return "", fmt.Errorf("retrieve step %s has an empty query", step.Name)
+	}
+	metrics.InputProcessingTime = time.Since(inputStartTime).Milliseconds()
+
+	modelStartTime := time.Now()
+	embedder, modelName, err := p.getEmbedder(step, cfg.Provider)
+	if err != nil {
+		return "", err
+	}
+
+	index, err := vectorindex.Open(p.resolveOutputPath(cfg.Index))
+	if err != nil {
+		return "", err
+	}
+	if index.Len() == 0 {
+		return "", fmt.Errorf("index %s is empty or does not exist; run an index step first", cfg.Index)
+	}
+	if err := index.CheckModel(modelName); err != nil {
+		return "", err
+	}
+	metrics.ModelProcessingTime = time.Since(modelStartTime).Milliseconds()
+
+	actionStartTime := time.Now()
+	vectors, err := embedder.Embed(modelName, []string{query})
+	if err != nil {
+		return "", fmt.Errorf("failed to embed query: %w", err)
+	}
+	if len(vectors) != 1 {
+		return "", fmt.Errorf("expected 1 query embedding, got %d", len(vectors))
+	}
+
+	results, err := index.Search(vectors[0], cfg.TopK, cfg.MinScore)
+	if err != nil {
+		return "", err
+	}
+	p.debugf("Retrieved %d chunk(s) from %s", len(results), cfg.Index)
+	metrics.ActionProcessingTime = time.Since(actionStartTime).Milliseconds()
+
+	result := formatRetrievalResults(results)
+
+	outputStartTime := time.Now()
+	if outputs := p.NormalizeStringSlice(step.Config.Output); len(outputs) > 0 {
+		if err := p.handleOutput(modelName, result, outputs, metrics); err != nil {
+			return "", fmt.Errorf("output handling error: %w", err)
+		}
+	}
+	metrics.OutputProcessingTime = time.Since(outputStartTime).Milliseconds()
+	metrics.TotalProcessingTime = time.Since(startTime).Milliseconds()
+
+	p.sendProgressUpdate(ProgressUpdate{
+		Type:               ProgressComplete,
+		Message:            fmt.Sprintf("Completed retrieve step: %s", step.Name),
+		Step:               stepInfo,
+		IsParallel:         isParallel,
+		ParallelID:         parallelID,
+		PerformanceMetrics: metrics,
+	})
+
+	return result, nil
+}
@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// mockEmbedder implements models.EmbeddingProvider with a tiny keyword-count embedding
+type mockEmbedder struct {
+	MockProvider
+	calls int
+}
+
+func (m *mockEmbedder) Embed(modelName string, texts []string) ([][]float32, error) {
+	m.calls++
+	keywords := []string{"cat", "dog", "bird"}
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, len(keywords))
+		for j, keyword := range keywords {
+			vector[j] = float32(strings.Count(strings.ToLower(text), keyword))
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+func TestIndexAndRetrieveSteps(t *testing.T) {
+	embedder := &mockEmbedder{MockProvider: *NewMockProvider("openai")}
+	originalDetect := models.DetectEmbedder
+	models.DetectEmbedder = func(modelName string, providerName string) models.EmbeddingProvider {
+		return embedder
+	}
+	defer func() { models.DetectEmbedder = originalDetect }()
+
+	dir := t.TempDir()
+	catsPath := filepath.Join(dir, "cats.md")
+	dogsPath := filepath.Join(dir, "dogs.md")
+	if err := os.WriteFile(catsPath, []byte("The cat sleeps. A cat purrs."), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(dogsPath, []byte("The dog barks at the bird."), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	indexPath := filepath.Join(dir, "docs.index.json")
+
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, "")
+
+	indexStep := Step{
+		Name: "index_docs",
+		Config: StepConfig{
+			Type:  "index",
+			Input: []interface{}{catsPath, dogsPath},
+			Model: "text-embedding-3-small",
+			Index: &IndexConfig{Path: indexPath},
+		},
+	}
+	summary, err := processor.processStep(indexStep, false, "")
+	if err != nil {
+		t.Fatalf("index step returned error: %v", err)
+	}
+	if !strings.Contains(summary, "Indexed 2 chunk(s) from 2 input(s)") {
+		t.Errorf("Unexpected index summary: %s", summary)
+	}
+	if embedder.apiKey != "test-openai-key" {
+		t.Errorf("Expected embedder to be configured with the openai key")
+	}
+
+	retrieveStep := Step{
+		Name: "find_context",
+		Config: StepConfig{
+			Type:     "retrieve",
+			Input:    "NA",
+			Model:    "text-embedding-3-small",
+			Action:   "Tell me about the cat",
+			Retrieve: &RetrieveConfig{Index: indexPath, TopK: 1},
+		},
+	}
+	result, err := processor.processStep(retrieveStep, false, "")
+	if err != nil {
+		t.Fatalf("retrieve step returned error: %v", err)
+	}
+	if !strings.Contains(result, "cats.md") || !strings.Contains(result, "A cat purrs.") || strings.Contains(result, "dogs.md") {
+		t.Errorf("Unexpected retrieval result: %s", result)
+	}
+
+	// A different embedding model cannot query the index
+	retrieveStep.Config.Model = "text-embedding-3-large"
+	if _, err := processor.processStep(retrieveStep, false, ""); err == nil || !strings.Contains(err.Error(), "built with model") {
+		t.Errorf("Expected model mismatch error, got %v", err)
+	}
+}
+
+func TestIndexStepInputsAndChunkDefaults(t *testing.T) {
+	embedder := &mockEmbedder{MockProvider: *NewMockProvider("openai")}
+	originalDetect := models.DetectEmbedder
+	models.DetectEmbedder = func(modelName string, providerName string) models.EmbeddingProvider {
+		return embedder
+	}
+	defer func() { models.DetectEmbedder = originalDetect }()
+
+	dir := t.TempDir()
+	catsPath := filepath.Join(dir, "cats.md")
+	dogsPath := filepath.Join(dir, "dogs.md")
+	if err := os.WriteFile(catsPath, []byte("The cat sleeps.\nA cat purrs.\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(dogsPath, []byte("The dog barks.\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, "")
+	for _, step := range []Step{
+		{Name: "index_cats", Config: StepConfig{Type: "index", Input: catsPath, Model: "text-embedding-3-small",
+			Index: &IndexConfig{Path: filepath.Join(dir, "cats.index.json")}}},
+		// Chunking by lines without a size uses the default size
+		{Name: "index_dogs", Config: StepConfig{Type: "index", Input: dogsPath, Model: "text-embedding-3-small",
+			Chunk: &ChunkConfig{By: "lines"}, Index: &IndexConfig{Path: filepath.Join(dir, "dogs.index.json")}}},
+	} {
+		summary, err := processor.processStep(step, false, "")
+		if err != nil {
+			t.Fatalf("%s returned error: %v", step.Name, err)
+		}
+		// Each step indexes only its own input
+		if !strings.Contains(summary, "Indexed 1 chunk(s) from 1 input(s)") {
+			t.Errorf("Unexpected summary for %s: %s", step.Name, summary)
+		}
+	}
+}
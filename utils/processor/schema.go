@@ -0,0 +1,331 @@
+package processor
+
+import (
+	"reflect"
+	"strings"
+)
+
+// fieldDocs describes the keys of the workflow DSL, by type name and YAML key.
+// Every field of a type in the schema needs an entry; the schema tests check it.
+var fieldDocs = map[string]string{
+	"StepConfig.type":                 "Step type: openai-responses, image-generation, index or retrieve; omit it for a standard step",
+	"StepConfig.input":                "Input file(s), NA, STDIN, a URL, a database or a scraper configuration; 'file as $name' assigns a variable",
+	"StepConfig.model":                "Model name or alias, a list of models to compare, or NA for steps without a model",
+	"StepConfig.action":               "Prompt (or list of prompts) sent to the model with the input",
+	"StepConfig.output":               "Where the result goes: STDOUT, a file, MEMORY, MEMORY:<section> or a list of these",
+	"StepConfig.next-action":          "Shown in the configuration summary only; it is not run",
+	"StepConfig.batch_mode":           "How multiple input files are sent: combined (default), individual or multimodal",
+	"StepConfig.skip_errors":          "Continue with the other files when some files fail",
+	"StepConfig.chunk":                "Split a large input file into chunks processed one by one",
+	"StepConfig.memory":               "Include project memory in the action: true, a mode name (full, sections, relevant) or a mapping",
+	"StepConfig.execution":            "batch sends the per-file requests as one asynchronous provider batch",
+	"StepConfig.batch":                "Options for steps with execution: batch",
+	"StepConfig.params":               "Generation parameters overriding the model's defaults from the configuration",
+	"StepConfig.transcription":        "How audio and video inputs are transcribed",
+	"StepConfig.image":                "Options for image-generation steps",
+	"StepConfig.index":                "Options for index steps, which embed their inputs into a local vector index",
+	"StepConfig.retrieve":             "Options for retrieve steps, which look up the chunks most similar to the input",
+	"StepConfig.instructions":         "System message of an openai-responses step",
+	"StepConfig.tools":                "Tools available to an openai-responses step",
+	"StepConfig.previous_response_id": "Response ID to continue from in an openai-responses step, e.g. $step.response_id",
+	"StepConfig.max_output_tokens":    "Token limit of an openai-responses step",
+	"StepConfig.temperature":          "Temperature of an openai-responses step",
+	"StepConfig.top_p":                "Top-p sampling of an openai-responses step",
+	"StepConfig.stream":               "Stream the response of an openai-responses step",
+	"StepConfig.response_format":      "Response format of an openai-responses step, e.g. {type: json_object}",
+	"StepConfig.generate":             "Generate a workflow file from a prompt",
+	"StepConfig.process":              "Run another workflow file as a sub-workflow",
+
+	"ChunkConfig.by":         "How to split the file: lines, bytes, tokens or duration (audio/video)",
+	"ChunkConfig.size":       "Chunk size in units of by, e.g. 10000 lines or seconds when chunking by duration",
+	"ChunkConfig.overlap":    "Lines or bytes repeated between chunks for context",
+	"ChunkConfig.max_chunks": "Limit on the number of chunks",
+
+	"MemoryConfig.mode":       "full (default), sections or relevant",
+	"MemoryConfig.sections":   "Section names for sections mode",
+	"MemoryConfig.max_tokens": "Token budget for relevant mode (default 2000)",
+	"MemoryConfig.model":      "Embedding model for relevant mode; keyword ranking is used otherwise",
+
+	"BatchConfig.poll_interval": "How often to check the batch status, e.g. 1m (default 30s)",
+	"BatchConfig.wait":          "How long to wait for results before exiting, e.g. 2h (default 24h); a later run resumes the batch",
+	"BatchConfig.state_dir":     "Where submitted batch IDs are stored for resuming (default .comanda/batches)",
+
+	"ModelParams.temperature":      "Sampling temperature",
+	"ModelParams.top_p":            "Nucleus sampling probability",
+	"ModelParams.max_tokens":       "Maximum number of tokens to generate",
+	"ModelParams.stop":             "Sequences that stop generation",
+	"ModelParams.seed":             "Seed for reproducible sampling, where supported",
+	"ModelParams.reasoning_effort": "Reasoning effort: minimal, low, medium or high",
+	"ModelParams.thinking_budget":  "Tokens for extended thinking",
+
+	"TranscriptionConfig.model":      "Transcription model, e.g. whisper-1, gpt-4o-transcribe or gemini-2.5-flash",
+	"TranscriptionConfig.provider":   "Backend override: openai, google or whisper (local server)",
+	"TranscriptionConfig.language":   "ISO-639-1 language hint",
+	"TranscriptionConfig.prompt":     "Vocabulary or context hint passed to the backend",
+	"TranscriptionConfig.timestamps": "Prefix each transcript line with its start time",
+	"TranscriptionConfig.speakers":   "Label transcript lines with speakers where the backend supports it",
+
+	"ImageConfig.provider": "Backend override: openai, google or stable-diffusion (local server)",
+	"ImageConfig.size":     "Image dimensions as WIDTHxHEIGHT, e.g. 1024x1024",
+	"ImageConfig.quality":  "Backend-specific quality, e.g. standard, hd, low, medium, high",
+	"ImageConfig.count":    "Number of images to generate (default 1)",
+	"ImageConfig.format":   "Output encoding: png or jpeg (default: from the output file extension)",
+
+	"IndexConfig.path":     "Index file, e.g. .comanda/docs.index.json",
+	"IndexConfig.provider": "Embedding backend override: openai, google, ollama or vllm",
+
+	"RetrieveConfig.index":     "Index file written by an index step",
+	"RetrieveConfig.provider":  "Embedding backend override",
+	"RetrieveConfig.top_k":     "Number of chunks to return (default 5)",
+	"RetrieveConfig.min_score": "Minimum cosine similarity of the returned chunks",
+
+	"GenerateStepConfig.model":         "Model that writes the workflow (default: the default generation model)",
+	"GenerateStepConfig.action":        "Description of the workflow to generate",
+	"GenerateStepConfig.output":        "File the generated workflow is written to",
+	"GenerateStepConfig.context_files": "Files given to the model as additional context",
+
+	"ProcessStepConfig.workflow_file":   "Workflow file to run",
+	"ProcessStepConfig.inputs":          "Params passed to the sub-workflow",
+	"ProcessStepConfig.capture_outputs": "Outputs of the sub-workflow to capture",
+
+	"WorkflowMeta.name":        "Name of the workflow",
+	"WorkflowMeta.version":     "Version of the workflow",
+	"WorkflowMeta.description": "What the workflow does",
+	"WorkflowMeta.params":      "Typed inputs of the workflow, available to steps as $name",
+
+	"ParamSpec.type":        "string (default), int, bool, file or enum",
+	"ParamSpec.description": "Shown in errors about the param",
+	"ParamSpec.required":    "Whether the caller must provide a value",
+	"ParamSpec.default":     "Value used when none is provided",
+	"ParamSpec.values":      "Allowed values of an enum param",
+}
+
+// fieldEnums lists the allowed values of string fields
+var fieldEnums = map[string][]string{
+	"StepConfig.type":              stepTypes,
+	"StepConfig.batch_mode":        {"combined", "individual", "multimodal"},
+	"StepConfig.execution":         {ExecutionBatch},
+	"ChunkConfig.by":               {"lines", "bytes", "tokens", "duration"},
+	"MemoryConfig.mode":            {MemoryModeFull, MemoryModeSections, MemoryModeRelevant},
+	"ModelParams.reasoning_effort": {"minimal", "low", "medium", "high"},
+	"ImageConfig.format":           {"png", "jpeg"},
+	"ParamSpec.type":               {ParamString, ParamInt, ParamBool, ParamFile, ParamEnum},
+}
+
+// stringOrList is the schema of fields that take a string or a list of strings
+var stringOrList = map[string]interface{}{
+	"anyOf": []interface{}{
+		map[string]interface{}{"type": "string"},
+		map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+	},
+}
+
+// fieldSchemas are the schemas of fields whose Go type does not describe their YAML form
+var fieldSchemas = map[string]map[string]interface{}{
+	"StepConfig.input": {
+		"anyOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			map[string]interface{}{"type": "object"},
+		},
+	},
+	"StepConfig.model":          stringOrList,
+	"StepConfig.action":         stringOrList,
+	"StepConfig.output":         stringOrList,
+	"StepConfig.next-action":    stringOrList,
+	"GenerateStepConfig.model":  stringOrList,
+	"GenerateStepConfig.action": stringOrList,
+	"ParamSpec.default":         {"type": []string{"string", "integer", "boolean"}},
+}
+
+// WorkflowSchema returns a JSON Schema (draft-07) of the workflow DSL, derived
+// from the step configuration types, for editors and other tools
+func WorkflowSchema() map[string]interface{} {
+	b := &schemaBuilder{definitions: make(map[string]interface{})}
+	step := b.typeSchema(reflect.TypeOf(StepConfig{}))
+	steps := map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": step,
+	}
+
+	return map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "comanda workflow",
+		"description": "A comanda workflow: named steps run in order, parallel groups of steps and reserved blocks",
+		"type":        "object",
+		"properties": map[string]interface{}{
+			"workflow": withDescription(b.typeSchema(reflect.TypeOf(WorkflowMeta{})), "Metadata and typed params of the workflow"),
+			"config": map[string]interface{}{
+				"type":        "object",
+				"description": "Configuration overrides for this workflow, in the format of the env file; secrets are not allowed",
+			},
+			"defer": withDescription(steps, "Steps run only when a step outputs {\"step\": \"<name>\", \"input\": ...}"),
+			"parallel": map[string]interface{}{
+				"type":        "object",
+				"description": "Legacy form of parallel groups: group name to a list of {name, config} steps",
+				"additionalProperties": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"name":   map[string]interface{}{"type": "string"},
+							"config": step,
+						},
+					},
+				},
+			},
+		},
+		"additionalProperties": map[string]interface{}{
+			"anyOf": []interface{}{
+				step,
+				withDescription(steps, "A group of steps run in parallel"),
+			},
+		},
+		"definitions": b.definitions,
+	}
+}
+
+// withDescription returns a copy of a schema with a description
+func withDescription(schema map[string]interface{}, description string) map[string]interface{} {
+	if _, ok := schema["$ref"]; ok {
+		// Keywords next to a $ref are ignored in draft-07
+		return map[string]interface{}{"allOf": []interface{}{schema}, "description": description}
+	}
+	described := make(map[string]interface{}, len(schema)+1)
+	for k, v := range schema {
+		described[k] = v
+	}
+	described["description"] = description
+	return described
+}
+
+// schemaBuilder collects the definitions of the struct types of the schema
+type schemaBuilder struct {
+	definitions map[string]interface{}
+}
+
+// typeSchema returns the schema of a Go type; structs become definitions
+func (b *schemaBuilder) typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": b.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.typeSchema(t.Elem())}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+		if _, ok := b.definitions[t.Name()]; ok {
+			return ref
+		}
+		b.definitions[t.Name()] = nil // Reserve the name for recursive types
+		b.definitions[t.Name()] = b.structSchema(t)
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema returns the object schema of a struct type
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for name, fieldType := range yamlFields(t) {
+		key := t.Name() + "." + name
+		schema, ok := fieldSchemas[key]
+		if !ok {
+			schema = b.typeSchema(fieldType)
+		}
+		if values, ok := fieldEnums[key]; ok {
+			schema = withEnum(schema, values)
+		}
+		properties[name] = withDescription(schema, fieldDocs[key])
+	}
+	object := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+
+	// memory: also takes a bool or a mode name
+	if t == reflect.TypeOf(MemoryConfig{}) {
+		return map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"type": "boolean"},
+				map[string]interface{}{"type": "string", "enum": fieldEnums["MemoryConfig.mode"]},
+				object,
+			},
+		}
+	}
+	return object
+}
+
+// withEnum returns a copy of a schema restricted to the given values
+func withEnum(schema map[string]interface{}, values []string) map[string]interface{} {
+	restricted := withDescription(schema, "")
+	delete(restricted, "description")
+	restricted["enum"] = values
+	return restricted
+}
+
+// SchemaDescription returns the description of the key at a path of a workflow,
+// such as ["summarize", "chunk", "size"], following the workflow schema
+func SchemaDescription(path []string) string {
+	schema := WorkflowSchema()
+	definitions := schema["definitions"].(map[string]interface{})
+	node := schema
+	for i, key := range path {
+		node = resolveSchema(node, definitions)
+		next := schemaProperty(node, key, definitions)
+		if next == nil {
+			return ""
+		}
+		node = next
+		if i == len(path)-1 {
+			description, _ := node["description"].(string)
+			return description
+		}
+	}
+	return ""
+}
+
+// schemaProperty returns the schema of a key within an object schema, trying
+// each alternative of an anyOf in turn
+func schemaProperty(node map[string]interface{}, key string, definitions map[string]interface{}) map[string]interface{} {
+	if properties, ok := node["properties"].(map[string]interface{}); ok {
+		if property, ok := properties[key].(map[string]interface{}); ok {
+			return property
+		}
+	}
+	if alternatives, ok := node["anyOf"].([]interface{}); ok {
+		for _, alternative := range alternatives {
+			if property := schemaProperty(resolveSchema(alternative.(map[string]interface{}), definitions), key, definitions); property != nil {
+				return property
+			}
+		}
+	}
+	if additional, ok := node["additionalProperties"].(map[string]interface{}); ok {
+		return additional
+	}
+	return nil
+}
+
+// resolveSchema follows a $ref, possibly wrapped in an allOf, to its definition
+func resolveSchema(node map[string]interface{}, definitions map[string]interface{}) map[string]interface{} {
+	if all, ok := node["allOf"].([]interface{}); ok && len(all) == 1 {
+		node = all[0].(map[string]interface{})
+	}
+	if ref, ok := node["$ref"].(string); ok {
+		if definition, ok := definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{}); ok {
+			return definition
+		}
+	}
+	return node
+}
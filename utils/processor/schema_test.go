@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestWorkflowSchemaDocumentsEveryField(t *testing.T) {
+	schema := WorkflowSchema()
+	definitions := schema["definitions"].(map[string]interface{})
+
+	for _, name := range []string{"StepConfig", "ChunkConfig", "GenerateStepConfig", "ProcessStepConfig", "MemoryConfig", "WorkflowMeta", "ParamSpec"} {
+		if _, ok := definitions[name]; !ok {
+			t.Errorf("Expected a definition of %s", name)
+		}
+	}
+
+	// A field added to a step type without a description fails here
+	for name, definition := range definitions {
+		object := resolveObject(definition.(map[string]interface{}))
+		properties, ok := object["properties"].(map[string]interface{})
+		if !ok {
+			t.Errorf("Definition %s has no properties", name)
+			continue
+		}
+		for key, property := range properties {
+			if description, _ := property.(map[string]interface{})["description"].(string); description == "" {
+				t.Errorf("Field %s.%s has no description; add it to fieldDocs", name, key)
+			}
+		}
+	}
+
+	// Every YAML key of a step is in the schema
+	step := definitions["StepConfig"].(map[string]interface{})["properties"].(map[string]interface{})
+	for key := range yamlFields(reflect.TypeOf(StepConfig{})) {
+		if _, ok := step[key]; !ok {
+			t.Errorf("Step key %s is missing from the schema", key)
+		}
+	}
+
+	if _, err := json.Marshal(schema); err != nil {
+		t.Fatalf("Schema is not valid JSON: %v", err)
+	}
+}
+
+// resolveObject returns the object alternative of a schema such as MemoryConfig's
+func resolveObject(schema map[string]interface{}) map[string]interface{} {
+	if alternatives, ok := schema["anyOf"].([]interface{}); ok {
+		for _, alternative := range alternatives {
+			if a := alternative.(map[string]interface{}); a["type"] == "object" {
+				return a
+			}
+		}
+	}
+	return schema
+}
+
+func TestWorkflowSchemaShapes(t *testing.T) {
+	schema := WorkflowSchema()
+	definitions := schema["definitions"].(map[string]interface{})
+	step := definitions["StepConfig"].(map[string]interface{})
+	properties := step["properties"].(map[string]interface{})
+
+	if step["additionalProperties"] != false {
+		t.Errorf("Expected steps to reject unknown keys")
+	}
+	if enum, _ := properties["type"].(map[string]interface{})["enum"].([]string); !reflect.DeepEqual(enum, stepTypes) {
+		t.Errorf("Expected the step types as enum, got %v", enum)
+	}
+	if _, ok := properties["model"].(map[string]interface{})["anyOf"]; !ok {
+		t.Errorf("Expected model to take a string or a list")
+	}
+	if chunk := properties["chunk"].(map[string]interface{}); chunk["allOf"] == nil {
+		t.Errorf("Expected chunk to refer to ChunkConfig with a description, got %v", chunk)
+	}
+	memory := definitions["MemoryConfig"].(map[string]interface{})
+	if alternatives, _ := memory["anyOf"].([]interface{}); len(alternatives) != 3 {
+		t.Errorf("Expected memory to take a bool, a mode or a mapping, got %v", memory)
+	}
+}
+
+func TestSchemaDescription(t *testing.T) {
+	tests := []struct {
+		path []string
+		want string
+	}{
+		{[]string{"summarize", "model"}, fieldDocs["StepConfig.model"]},
+		{[]string{"summarize", "chunk", "size"}, fieldDocs["ChunkConfig.size"]},
+		{[]string{"summarize", "memory", "mode"}, fieldDocs["MemoryConfig.mode"]},
+		{[]string{"parallel-process", "a", "output"}, fieldDocs["StepConfig.output"]},
+		{[]string{"defer", "polish", "action"}, fieldDocs["StepConfig.action"]},
+		{[]string{"workflow", "params", "style", "values"}, fieldDocs["ParamSpec.values"]},
+		{[]string{"summarize", "generate", "context_files"}, fieldDocs["GenerateStepConfig.context_files"]},
+		{[]string{"summarize", "acton"}, ""},
+	}
+	for _, tt := range tests {
+		if got := SchemaDescription(tt.path); got != tt.want {
+			t.Errorf("SchemaDescription(%v) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// MockResponse scripts the answers of a model in workflow tests. The step,
+// model and prompt filters select the requests it answers; a mock without
+// filters answers every request.
+type MockResponse struct {
+	Step           string   `yaml:"step"`            // Step sending the request
+	Model          string   `yaml:"model"`           // Model the request is sent to
+	PromptContains string   `yaml:"prompt_contains"` // Text the prompt must contain
+	Response       string   `yaml:"response"`        // Answer to every request
+	Responses      []string `yaml:"responses"`       // Answers in order; the last one repeats
+	ResponseFile   string   `yaml:"response_file"`   // File with the answer, relative to the test file
+	Error          string   `yaml:"error"`           // Fails the requests with this error
+}
+
+// matches reports whether the mock answers a request
+func (m MockResponse) matches(step, model, prompt string) bool {
+	if m.Step != "" && m.Step != step {
+		return false
+	}
+	if m.Model != "" && m.Model != model && models.BareModelName(m.Model) != model {
+		return false
+	}
+	return m.PromptContains == "" || strings.Contains(prompt, m.PromptContains)
+}
+
+// answer returns the n-th answer of the mock
+func (m MockResponse) answer(n int, dir string) (string, error) {
+	switch {
+	case m.Error != "":
+		return "", fmt.Errorf("%s", m.Error)
+	case len(m.Responses) > 0:
+		return m.Responses[min(n, len(m.Responses)-1)], nil
+	case m.ResponseFile != "":
+		content, err := os.ReadFile(resolveTestPath(dir, m.ResponseFile))
+		if err != nil {
+			return "", fmt.Errorf("failed to read response file: %w", err)
+		}
+		return string(content), nil
+	}
+	return m.Response, nil
+}
+
+// ScriptedRequest is a model request received by a scripted provider
+type ScriptedRequest struct {
+	Step   string
+	Model  string
+	Prompt string
+	Files  []string
+}
+
+// script answers the model requests of a workflow test from its mocks and
+// records the requests
+type script struct {
+	mu       sync.Mutex
+	mocks    []MockResponse
+	dir      string // Directory of the test file
+	answered []int  // Number of requests answered by each mock
+	requests []ScriptedRequest
+}
+
+func newScript(mocks []MockResponse, dir string) *script {
+	return &script{mocks: mocks, dir: dir, answered: make([]int, len(mocks))}
+}
+
+// answer records a request and answers it with the first matching mock
+func (s *script) answer(step, model, prompt string, files []models.FileInput) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request := ScriptedRequest{Step: step, Model: model, Prompt: prompt}
+	for _, file := range files {
+		request.Files = append(request.Files, file.Path)
+	}
+	s.requests = append(s.requests, request)
+
+	for i, mock := range s.mocks {
+		if mock.matches(step, model, prompt) {
+			s.answered[i]++
+			return mock.answer(s.answered[i]-1, s.dir)
+		}
+	}
+	if step == "" {
+		return "", fmt.Errorf("no mock response for model %s", model)
+	}
+	return "", fmt.Errorf("no mock response for step %s (model %s)", step, model)
+}
+
+// stepRequests returns the recorded requests of a step
+func (s *script) stepRequests(step string) []ScriptedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var requests []ScriptedRequest
+	for _, request := range s.requests {
+		if request.Step == step {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// scriptedProvider stands in for the provider of a model in workflow tests. It
+// reports the name, models and generation parameters of the real provider, so
+// that routing and validation behave as in a real run, and answers from the
+// script instead of calling the API.
+type scriptedProvider struct {
+	real   models.Provider
+	script *script
+	step   string
+	config models.ModelConfig
+}
+
+func (s *scriptedProvider) Name() string {
+	return s.real.Name()
+}
+
+func (s *scriptedProvider) SupportsModel(modelName string) bool {
+	return s.real.SupportsModel(modelName)
+}
+
+func (s *scriptedProvider) Configure(apiKey string) error {
+	return nil
+}
+
+func (s *scriptedProvider) SetVerbose(verbose bool) {}
+
+// ForStep returns a provider recording its requests as sent by the step
+func (s *scriptedProvider) ForStep(step string) models.Provider {
+	stepProvider := *s
+	stepProvider.step = step
+	return &stepProvider
+}
+
+func (s *scriptedProvider) SendPrompt(modelName string, prompt string) (string, error) {
+	return s.script.answer(s.step, modelName, prompt, nil)
+}
+
+func (s *scriptedProvider) SendPromptWithFile(modelName string, prompt string, file models.FileInput) (string, error) {
+	return s.script.answer(s.step, modelName, prompt, []models.FileInput{file})
+}
+
+func (s *scriptedProvider) SendPromptWithFiles(modelName string, prompt string, files []models.FileInput) (string, error) {
+	return s.script.answer(s.step, modelName, prompt, files)
+}
+
+func (s *scriptedProvider) SendPromptWithResponses(config models.ResponsesConfig) (string, error) {
+	return s.script.answer(s.step, config.Model, config.Input, nil)
+}
+
+func (s *scriptedProvider) SendPromptWithResponsesStream(config models.ResponsesConfig, handler models.ResponsesStreamHandler) error {
+	response, err := s.script.answer(s.step, config.Model, config.Input, nil)
+	if err != nil {
+		handler.OnError(err)
+		return err
+	}
+	handler.OnOutputTextDelta("", 0, 0, response)
+	handler.OnResponseCompleted(map[string]interface{}{})
+	return nil
+}
+
+func (s *scriptedProvider) SetConfig(config models.ModelConfig) {
+	s.config = config
+}
+
+func (s *scriptedProvider) GetConfig() models.ModelConfig {
+	return s.config
+}
+
+// SupportedParams lists the parameters the real provider accepts for the model
+func (s *scriptedProvider) SupportedParams(modelName string) []string {
+	if paramsProvider, ok := s.real.(models.ParamsProvider); ok {
+		return paramsProvider.SupportedParams(modelName)
+	}
+	return nil
+}
+
+// resolveTestPath resolves a path of a workflow test file relative to its directory
+func resolveTestPath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
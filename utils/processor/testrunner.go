@@ -0,0 +1,583 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/memory"
+	"github.com/kris-hansen/comanda/utils/models"
+	"gopkg.in/yaml.v3"
+)
+
+// WorkflowTestFile is a file of workflow tests, named *.test.yaml by
+// convention. Paths in it are relative to the file.
+type WorkflowTestFile struct {
+	Path     string         `yaml:"-"`
+	Workflow string         `yaml:"workflow"` // Workflow under test
+	Mocks    []MockResponse `yaml:"mocks"`    // Mocks of all tests, tried after a test's own
+	Tests    []WorkflowTest `yaml:"tests"`
+
+	dir string // Absolute directory of the file
+}
+
+// WorkflowTest runs the workflow in an empty working directory with fixture
+// inputs and scripted model responses, and checks what it produced
+type WorkflowTest struct {
+	Name     string            `yaml:"name"`
+	Params   map[string]string `yaml:"params"`   // Workflow params, like --param
+	Stdin    string            `yaml:"stdin"`    // Input piped to the workflow
+	Files    map[string]string `yaml:"files"`    // Files created in the working directory, by path
+	Fixtures string            `yaml:"fixtures"` // Directory copied into the working directory
+	Memory   string            `yaml:"memory"`   // Initial content of the memory file
+	Mocks    []MockResponse    `yaml:"mocks"`
+	Expect   Expectations      `yaml:"expect"`
+}
+
+// Expectations are the assertions of a workflow test
+type Expectations struct {
+	Error     string                        `yaml:"error"`     // The workflow fails with an error containing this text
+	Stdout    *Match                        `yaml:"stdout"`    // Everything written to STDOUT
+	Files     map[string]Match              `yaml:"files"`     // Files in the working directory, by path
+	Variables map[string]Match              `yaml:"variables"` // Workflow variables, by name
+	Memory    map[string]Match              `yaml:"memory"`    // Sections of the memory file, by name
+	Requests  map[string]RequestExpectation `yaml:"requests"`  // Model requests, by step
+}
+
+// RequestExpectation describes the model requests sent by a step
+type RequestExpectation struct {
+	Count  *int   `yaml:"count"`  // Number of requests
+	Model  string `yaml:"model"`  // Model of every request
+	Prompt *Match `yaml:"prompt"` // The prompts, separated by "\n---\n"
+}
+
+// Match is an assertion on a text. A plain string is shorthand for equals.
+type Match struct {
+	Equals      *string  `yaml:"equals"`
+	Contains    []string `yaml:"contains"`
+	NotContains []string `yaml:"not_contains"`
+	Matches     string   `yaml:"matches"` // Regular expression
+	Golden      string   `yaml:"golden"`  // File with the expected text, rewritten with --update
+	Exists      *bool    `yaml:"exists"`  // Whether the file, variable or section exists
+}
+
+// UnmarshalYAML accepts a plain string and single strings for the lists
+func (m *Match) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*m = Match{Equals: &node.Value}
+		return nil
+	}
+	var raw struct {
+		Equals      *string     `yaml:"equals"`
+		Contains    interface{} `yaml:"contains"`
+		NotContains interface{} `yaml:"not_contains"`
+		Matches     string      `yaml:"matches"`
+		Golden      string      `yaml:"golden"`
+		Exists      *bool       `yaml:"exists"`
+	}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	normalize := (&Processor{}).NormalizeStringSlice
+	*m = Match{
+		Equals:      raw.Equals,
+		Contains:    normalize(raw.Contains),
+		NotContains: normalize(raw.NotContains),
+		Matches:     raw.Matches,
+		Golden:      raw.Golden,
+		Exists:      raw.Exists,
+	}
+	return nil
+}
+
+// TestOptions controls a run of workflow tests
+type TestOptions struct {
+	Update  bool           // Rewrite golden files with the actual output
+	Run     *regexp.Regexp // Runs only the tests whose name matches
+	Verbose bool
+}
+
+// TestResult is the outcome of a workflow test
+type TestResult struct {
+	File     string
+	Name     string
+	Failures []string
+	Updated  []string // Golden files rewritten
+	Duration time.Duration
+}
+
+// Passed reports whether all assertions of the test held
+func (r TestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// FindWorkflowTests returns the workflow test files among the paths,
+// searching directories recursively for *.test.yaml and *.test.yml files
+func FindWorkflowTests(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, entry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && (strings.HasSuffix(file, ".test.yaml") || strings.HasSuffix(file, ".test.yml")) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// LoadWorkflowTests reads a workflow test file
+func LoadWorkflowTests(path string) (*WorkflowTestFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file WorkflowTestFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid test file %s: %w", path, err)
+	}
+	if file.Workflow == "" {
+		return nil, fmt.Errorf("test file %s: workflow is required", path)
+	}
+	if len(file.Tests) == 0 {
+		return nil, fmt.Errorf("test file %s: no tests defined", path)
+	}
+	file.Path = path
+	if file.dir, err = filepath.Abs(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	for i := range file.Tests {
+		if file.Tests[i].Name == "" {
+			file.Tests[i].Name = fmt.Sprintf("test %d", i+1)
+		}
+	}
+	return &file, nil
+}
+
+// Run runs the tests of the file one after another. Each test runs in its
+// own temporary working directory, so the process changes directory while a
+// test runs, and models.DetectProvider is replaced by scripted providers.
+func (f *WorkflowTestFile) Run(opts TestOptions) []TestResult {
+	var results []TestResult
+	for _, test := range f.Tests {
+		if opts.Run != nil && !opts.Run.MatchString(test.Name) {
+			continue
+		}
+		start := time.Now()
+		result := TestResult{File: f.Path, Name: test.Name}
+		f.runTest(test, opts, &result)
+		result.Duration = time.Since(start)
+		results = append(results, result)
+	}
+	return results
+}
+
+// runTest runs a test and records its failures in the result
+func (f *WorkflowTestFile) runTest(test WorkflowTest, opts TestOptions, result *TestResult) {
+	fail := func(format string, args ...interface{}) {
+		result.Failures = append(result.Failures, fmt.Sprintf(format, args...))
+	}
+
+	workflowData, err := os.ReadFile(resolveTestPath(f.dir, f.Workflow))
+	if err != nil {
+		fail("failed to read workflow: %v", err)
+		return
+	}
+	var dslConfig DSLConfig
+	if err := yaml.Unmarshal(workflowData, &dslConfig); err != nil {
+		fail("invalid workflow: %v", err)
+		return
+	}
+
+	workDir, err := os.MkdirTemp("", "comanda-test-")
+	if err != nil {
+		fail("failed to create working directory: %v", err)
+		return
+	}
+	defer os.RemoveAll(workDir)
+	memoryPath := filepath.Join(workDir, "COMANDA.md")
+	if err := f.prepare(test, workDir, memoryPath); err != nil {
+		fail("failed to create fixtures: %v", err)
+		return
+	}
+
+	// Relative inputs and outputs of the workflow refer to the working
+	// directory, and only its memory file is used
+	wd, err := os.Getwd()
+	if err != nil {
+		fail("%v", err)
+		return
+	}
+	if err := os.Chdir(workDir); err != nil {
+		fail("%v", err)
+		return
+	}
+	defer os.Chdir(wd)
+	restoreMemory := setEnv("COMANDA_MEMORY", memoryPath)
+	defer restoreMemory()
+
+	if !opts.Verbose {
+		logOutput := log.Writer()
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(logOutput)
+	}
+
+	mocks := append(append([]MockResponse{}, test.Mocks...), f.Mocks...)
+	script := newScript(mocks, f.dir)
+	detect := models.DetectProvider
+	defer func() { models.DetectProvider = detect }()
+	models.DetectProvider = func(modelName string) models.Provider {
+		provider := detect(modelName)
+		if provider == nil {
+			return nil
+		}
+		return &scriptedProvider{real: provider, script: script}
+	}
+
+	proc := NewProcessor(&dslConfig, testEnvConfig(&dslConfig, mocks), nil, opts.Verbose)
+	// testEnvConfig loaded the routing of the workflow's config: block, so that
+	// the scripted providers above see it
+	proc.routing = nil
+	stdout := &stdoutRecorder{}
+	proc.SetProgressWriter(stdout)
+	if err := proc.SetParams(test.Params); err != nil {
+		fail("invalid params: %v", err)
+		return
+	}
+	if test.Stdin != "" {
+		proc.SetLastOutput(test.Stdin)
+	}
+
+	err = proc.Process()
+	switch {
+	case test.Expect.Error != "" && err == nil:
+		fail("expected the workflow to fail with %q, but it succeeded", test.Expect.Error)
+	case test.Expect.Error != "" && !strings.Contains(err.Error(), test.Expect.Error):
+		fail("expected the workflow to fail with %q, got: %v", test.Expect.Error, err)
+	case test.Expect.Error == "" && err != nil:
+		fail("workflow failed: %v", err)
+		return
+	}
+
+	check := func(label, actual string, exists bool, match Match) {
+		problems, updated := match.check(actual, exists, f.dir, opts.Update)
+		for _, problem := range problems {
+			fail("%s: %s", label, problem)
+		}
+		result.Updated = append(result.Updated, updated...)
+	}
+
+	if test.Expect.Stdout != nil {
+		check("stdout", stdout.String(), true, *test.Expect.Stdout)
+	}
+	for _, path := range sortedKeys(test.Expect.Files) {
+		content, err := os.ReadFile(path)
+		check("file "+path, string(content), err == nil, test.Expect.Files[path])
+	}
+	variables := proc.Variables()
+	for _, name := range sortedKeys(test.Expect.Variables) {
+		value, ok := variables[name]
+		check("variable "+name, value, ok, test.Expect.Variables[name])
+	}
+	if len(test.Expect.Memory) > 0 {
+		store, err := memory.Open(memoryPath, "")
+		if err != nil {
+			fail("failed to open memory: %v", err)
+			return
+		}
+		content, err := store.Read()
+		if err != nil {
+			fail("failed to read memory: %v", err)
+			return
+		}
+		for _, name := range sortedKeys(test.Expect.Memory) {
+			section := memory.Section(content, name)
+			check("memory section "+name, section, section != "", test.Expect.Memory[name])
+		}
+	}
+	for _, step := range sortedKeys(test.Expect.Requests) {
+		expect := test.Expect.Requests[step]
+		requests := script.stepRequests(step)
+		if expect.Count != nil && len(requests) != *expect.Count {
+			fail("step %s sent %d request(s), expected %d", step, len(requests), *expect.Count)
+		}
+		var prompts []string
+		for _, request := range requests {
+			if expect.Model != "" && request.Model != expect.Model && request.Model != models.BareModelName(expect.Model) {
+				fail("step %s sent a request to model %s, expected %s", step, request.Model, expect.Model)
+			}
+			prompts = append(prompts, request.Prompt)
+		}
+		if expect.Prompt != nil {
+			check("prompts of step "+step, strings.Join(prompts, "\n---\n"), len(requests) > 0, *expect.Prompt)
+		}
+	}
+}
+
+// prepare creates the fixture inputs and the memory file of a test
+func (f *WorkflowTestFile) prepare(test WorkflowTest, workDir, memoryPath string) error {
+	if test.Fixtures != "" {
+		if err := copyDir(resolveTestPath(f.dir, test.Fixtures), workDir); err != nil {
+			return err
+		}
+	}
+	for path, content := range test.Files {
+		if !filepath.IsLocal(path) {
+			return fmt.Errorf("file %s is outside the working directory", path)
+		}
+		target := filepath.Join(workDir, path)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	// The memory file exists even when empty, so that no other memory file is found
+	return os.WriteFile(memoryPath, []byte(test.Memory), 0644)
+}
+
+// check applies the assertions to a text and returns the problems found and
+// the golden files rewritten
+func (m Match) check(actual string, exists bool, dir string, update bool) ([]string, []string) {
+	if m.Exists != nil && *m.Exists != exists {
+		if exists {
+			return []string{"exists, expected it not to"}, nil
+		}
+		return []string{"does not exist"}, nil
+	}
+	if !exists {
+		if m.Exists != nil {
+			return nil, nil
+		}
+		return []string{"does not exist"}, nil
+	}
+
+	var problems, updated []string
+	if m.Equals != nil && actual != *m.Equals {
+		problems = append(problems, "does not equal the expected text:\n"+memory.Diff("expected", "actual", *m.Equals, actual))
+	}
+	for _, text := range m.Contains {
+		if !strings.Contains(actual, text) {
+			problems = append(problems, fmt.Sprintf("expected to contain %q, got:\n%s", text, actual))
+		}
+	}
+	for _, text := range m.NotContains {
+		if strings.Contains(actual, text) {
+			problems = append(problems, fmt.Sprintf("expected not to contain %q, got:\n%s", text, actual))
+		}
+	}
+	if m.Matches != "" {
+		re, err := regexp.Compile(m.Matches)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid regular expression: %v", err))
+		} else if !re.MatchString(actual) {
+			problems = append(problems, fmt.Sprintf("expected to match %q, got:\n%s", m.Matches, actual))
+		}
+	}
+	if m.Golden != "" {
+		path := resolveTestPath(dir, m.Golden)
+		if update {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return append(problems, err.Error()), updated
+			}
+			if err := os.WriteFile(path, []byte(actual), 0644); err != nil {
+				return append(problems, err.Error()), updated
+			}
+			return problems, append(updated, path)
+		}
+		golden, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			problems = append(problems, fmt.Sprintf("golden file %s does not exist; run with --update to create it", m.Golden))
+		} else if err != nil {
+			problems = append(problems, err.Error())
+		} else if diff := memory.Diff(m.Golden, "actual", string(golden), actual); diff != "" {
+			problems = append(problems, "differs from the golden file (run with --update to accept):\n"+diff)
+		}
+	}
+	return problems, updated
+}
+
+// stdoutRecorder is a progress writer collecting what a workflow writes to STDOUT
+type stdoutRecorder struct {
+	mu  sync.Mutex
+	out strings.Builder
+}
+
+func (r *stdoutRecorder) WriteProgress(update ProgressUpdate) error {
+	if update.Type != ProgressOutput {
+		return nil
+	}
+	// Performance metrics are appended to the output, but vary between runs
+	stdout := update.Stdout
+	if update.PerformanceMetrics != nil {
+		if i := strings.LastIndex(stdout, "\n\nPerformance Metrics:\n"); i >= 0 {
+			stdout = stdout[:i]
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.out.WriteString(stdout)
+	if !strings.HasSuffix(stdout, "\n") {
+		r.out.WriteString("\n")
+	}
+	return nil
+}
+
+func (r *stdoutRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.out.String()
+}
+
+// testEnvConfig enables the models of the workflow and the mocks with a
+// placeholder API key, so that tests need no configuration
+func testEnvConfig(dslConfig *DSLConfig, mocks []MockResponse) *config.EnvConfig {
+	envConfig := &config.EnvConfig{Providers: make(map[string]*config.Provider)}
+
+	// Aliases and endpoints of the workflow's config block take part in routing
+	routing := envConfig
+	if len(dslConfig.Config) > 0 {
+		if merged, err := envConfig.WithLayer(config.LayerWorkflow, "", dslConfig.Config); err == nil {
+			routing = merged
+		}
+	}
+	models.LoadProviderConfig(routing)
+
+	names := workflowModels(dslConfig, make(map[string]bool))
+	for _, mock := range mocks {
+		if mock.Model != "" {
+			names = append(names, mock.Model)
+		}
+	}
+	for _, name := range names {
+		// Unknown models are left to fail in the workflow as they would in a real run
+		ref, err := models.ResolveModel(name)
+		if err != nil {
+			continue
+		}
+		provider := envConfig.Providers[ref.Provider]
+		if provider == nil {
+			provider = &config.Provider{APIKey: "test"}
+			envConfig.Providers[ref.Provider] = provider
+		}
+		if _, err := envConfig.GetModelConfig(ref.Provider, ref.Model); err != nil {
+			provider.Models = append(provider.Models, config.Model{
+				Name:  ref.Model,
+				Type:  "external",
+				Modes: []config.ModelMode{config.TextMode, config.VisionMode, config.FileMode, config.MultiMode},
+			})
+		}
+	}
+	return envConfig
+}
+
+// workflowModels returns the models named by the steps of a workflow and of
+// the sub-workflows it runs
+func workflowModels(dslConfig *DSLConfig, seen map[string]bool) []string {
+	normalize := (&Processor{}).NormalizeStringSlice
+	var names []string
+	addStep := func(stepConfig StepConfig) {
+		names = append(names, normalize(stepConfig.Model)...)
+		if stepConfig.Generate != nil {
+			names = append(names, normalize(stepConfig.Generate.Model)...)
+		}
+		if stepConfig.Process != nil && stepConfig.Process.WorkflowFile != "" && !seen[stepConfig.Process.WorkflowFile] {
+			seen[stepConfig.Process.WorkflowFile] = true
+			data, err := os.ReadFile(stepConfig.Process.WorkflowFile)
+			if err != nil {
+				return
+			}
+			var subConfig DSLConfig
+			if yaml.Unmarshal(data, &subConfig) == nil {
+				names = append(names, workflowModels(&subConfig, seen)...)
+			}
+		}
+	}
+	for _, step := range dslConfig.Steps {
+		addStep(step.Config)
+	}
+	for _, steps := range dslConfig.ParallelSteps {
+		for _, step := range steps {
+			addStep(step.Config)
+		}
+	}
+	for _, stepConfig := range dslConfig.Defer {
+		addStep(stepConfig)
+	}
+
+	var result []string
+	for _, name := range names {
+		if name != "" && name != "NA" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// copyDir copies the files of a directory into another
+func copyDir(from, to string) error {
+	return filepath.WalkDir(from, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, content, 0644)
+	})
+}
+
+// setEnv sets an environment variable and returns a function restoring it
+func setEnv(name, value string) func() {
+	previous, ok := os.LookupEnv(name)
+	os.Setenv(name, value)
+	return func() {
+		if ok {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,199 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeWorkflowTest writes a workflow and its test file in dir and loads the tests
+func writeWorkflowTest(t *testing.T, dir, workflow, tests string) *WorkflowTestFile {
+	t.Helper()
+	writePlanFile(t, dir, "workflow.yaml", workflow)
+	writePlanFile(t, dir, "workflow.test.yaml", "workflow: workflow.yaml\n"+tests)
+	file, err := LoadWorkflowTests(filepath.Join(dir, "workflow.test.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load tests: %v", err)
+	}
+	return file
+}
+
+const testRunnerWorkflow = `
+draft:
+  input: notes.txt
+  model: gpt-4o-mini
+  action: Draft release notes
+  output: STDOUT
+polish:
+  input: STDIN as $draft
+  model: gpt-4o
+  action: Polish $draft
+  output: [notes.md, MEMORY:Releases]
+`
+
+func TestWorkflowTestRun(t *testing.T) {
+	dir := t.TempDir()
+	file := writeWorkflowTest(t, dir, testRunnerWorkflow, `
+mocks:
+  - step: polish
+    response: Polished notes
+tests:
+  - name: release notes
+    files:
+      notes.txt: fixed the parser
+    memory: |
+      ## Releases
+      none yet
+    mocks:
+      - step: draft
+        model: gpt-4o-mini
+        responses: [Draft notes]
+    expect:
+      stdout: "Draft notes\n"
+      files:
+        notes.md: Polished notes
+        missing.md:
+          exists: false
+      variables:
+        draft:
+          contains: Draft
+      memory:
+        Releases:
+          contains: Polished notes
+      requests:
+        draft:
+          count: 1
+          model: gpt-4o-mini
+          prompt:
+            contains: Draft release notes
+        polish:
+          prompt:
+            matches: "Polish Draft notes$"
+`)
+	wd, _ := os.Getwd()
+	results := file.Run(TestOptions{})
+	if cwd, _ := os.Getwd(); cwd != wd {
+		t.Errorf("Expected the working directory to be restored, got %s", cwd)
+	}
+	if len(results) != 1 || !results[0].Passed() {
+		t.Fatalf("Expected the test to pass, got %+v", results)
+	}
+}
+
+func TestWorkflowTestFailures(t *testing.T) {
+	dir := t.TempDir()
+	file := writeWorkflowTest(t, dir, testRunnerWorkflow, `
+tests:
+  - name: wrong expectations
+    files:
+      notes.txt: fixed the parser
+    mocks:
+      - step: draft
+        response: Draft notes
+      - step: polish
+        response: Polished notes
+    expect:
+      stdout:
+        contains: Final notes
+      files:
+        notes.md:
+          not_contains: Polished
+      variables:
+        other: anything
+      requests:
+        draft:
+          count: 2
+          model: gpt-4o
+  - name: unscripted step
+    files:
+      notes.txt: fixed the parser
+    mocks:
+      - step: draft
+        response: Draft notes
+  - name: expected error
+    mocks:
+      - response: anything
+    expect:
+      error: notes.txt
+`)
+	results := file.Run(TestOptions{})
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	failures := strings.Join(results[0].Failures, "\n")
+	for _, want := range []string{
+		`stdout: expected to contain "Final notes"`,
+		`file notes.md: expected not to contain "Polished"`,
+		"variable other: does not exist",
+		"step draft sent 1 request(s), expected 2",
+		"step draft sent a request to model gpt-4o-mini, expected gpt-4o",
+	} {
+		if !strings.Contains(failures, want) {
+			t.Errorf("Expected a failure containing %q, got:\n%s", want, failures)
+		}
+	}
+	if len(results[0].Failures) != 5 {
+		t.Errorf("Expected 5 failures, got %d:\n%s", len(results[0].Failures), failures)
+	}
+
+	if results[1].Passed() || !strings.Contains(results[1].Failures[0], "no mock response for step polish (model gpt-4o)") {
+		t.Errorf("Expected the unscripted step to fail the workflow, got %v", results[1].Failures)
+	}
+	if !results[2].Passed() {
+		t.Errorf("Expected the expected error to pass, got %v", results[2].Failures)
+	}
+}
+
+func TestWorkflowTestGolden(t *testing.T) {
+	dir := t.TempDir()
+	file := writeWorkflowTest(t, dir, "step:\n  input: NA\n  model: gpt-4o\n  action: Greet\n  output: STDOUT\n", `
+mocks:
+  - response: Hello
+tests:
+  - name: greeting
+    expect:
+      stdout:
+        golden: golden/greeting.txt
+`)
+	golden := filepath.Join(dir, "golden", "greeting.txt")
+
+	results := file.Run(TestOptions{})
+	if results[0].Passed() || !strings.Contains(results[0].Failures[0], "run with --update to create it") {
+		t.Errorf("Expected a missing golden file to fail, got %v", results[0].Failures)
+	}
+
+	results = file.Run(TestOptions{Update: true})
+	if !results[0].Passed() || len(results[0].Updated) != 1 || results[0].Updated[0] != golden {
+		t.Errorf("Expected the golden file to be written, got %+v", results[0])
+	}
+	if content, _ := os.ReadFile(golden); string(content) != "Hello\n" {
+		t.Errorf("Expected the golden file to hold the output, got %q", content)
+	}
+
+	writePlanFile(t, filepath.Join(dir, "golden"), "greeting.txt", "Goodbye\n")
+	results = file.Run(TestOptions{})
+	if results[0].Passed() || !strings.Contains(results[0].Failures[0], "-Goodbye\n+Hello") {
+		t.Errorf("Expected a diff against the golden file, got %v", results[0].Failures)
+	}
+}
+
+func TestLoadWorkflowTestsErrors(t *testing.T) {
+	dir := t.TempDir()
+	writePlanFile(t, dir, "no-workflow.test.yaml", "tests:\n  - name: a\n")
+	writePlanFile(t, dir, "no-tests.test.yaml", "workflow: w.yaml\n")
+	for name, want := range map[string]string{
+		"no-workflow.test.yaml": "workflow is required",
+		"no-tests.test.yaml":    "no tests defined",
+	} {
+		if _, err := LoadWorkflowTests(filepath.Join(dir, name)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, want, err)
+		}
+	}
+
+	files, err := FindWorkflowTests([]string{dir})
+	if err != nil || len(files) != 2 {
+		t.Errorf("Expected to find 2 test files, got %v (%v)", files, err)
+	}
+}
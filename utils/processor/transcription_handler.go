@@ -0,0 +1,156 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kris-hansen/comanda/utils/input"
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// DefaultTranscriptionModel is used for audio and video inputs when a step has no transcription block
+const DefaultTranscriptionModel = "whisper-1"
+
+// isDurationChunking reports whether the step splits media transcripts into time windows
+func isDurationChunking(step Step) bool {
+	return step.Config.Chunk != nil && strings.EqualFold(step.Config.Chunk.By, "duration")
+}
+
+// configureStandaloneProvider configures a provider that is resolved by
+// capability rather than by text model, such as a transcription or image
+// backend. Local providers are configured with "LOCAL"; hosted providers use
+// their API key.
+func (p *Processor) configureStandaloneProvider(provider models.Provider) error {
+	if err := p.configureProvider(provider.Name(), provider); err != nil {
+		return err
+	}
+	provider.SetVerbose(p.verbose)
+	return nil
+}
+
+// getTranscriber resolves and configures the transcription backend for a step
+func (p *Processor) getTranscriber(cfg TranscriptionConfig) (models.TranscriptionProvider, error) {
+	provider := models.DetectTranscriber(cfg.Model, cfg.Provider)
+	if provider == nil {
+		return nil, fmt.Errorf("no transcription backend found for model %s (set transcription.provider to openai, google or whisper)", cfg.Model)
+	}
+	if err := p.configureStandaloneProvider(provider); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+// transcribeMediaInputs replaces the audio and video inputs of the current step
+// with plain-text transcripts so that the step's actions see ordinary text files.
+// When the step chunks by duration, each time window becomes its own input.
+// The returned function removes the temporary transcript files.
+func (p *Processor) transcribeMediaInputs(step Step) (func(), error) {
+	noop := func() {}
+
+	inputs := p.handler.GetInputs()
+	hasMedia := false
+	for _, inputItem := range inputs {
+		if inputItem.IsMedia() {
+			hasMedia = true
+			break
+		}
+	}
+	if !hasMedia {
+		return noop, nil
+	}
+
+	cfg := TranscriptionConfig{}
+	if step.Config.Transcription != nil {
+		cfg = *step.Config.Transcription
+	}
+	if cfg.Model == "" {
+		cfg.Model = DefaultTranscriptionModel
+	}
+	model, providerName, err := p.splitStepModel(cfg.Model, cfg.Provider)
+	if err != nil {
+		return noop, err
+	}
+	cfg.Model, cfg.Provider = model, providerName
+
+	transcriber, err := p.getTranscriber(cfg)
+	if err != nil {
+		return noop, err
+	}
+
+	durationChunking := isDurationChunking(step)
+	opts := models.TranscriptionOptions{
+		Language: cfg.Language,
+		Prompt:   cfg.Prompt,
+		Segments: cfg.Timestamps || cfg.Speakers || durationChunking,
+		Speakers: cfg.Speakers,
+	}
+
+	tempDir, err := os.MkdirTemp("", "comanda-transcripts-*")
+	if err != nil {
+		return noop, fmt.Errorf("failed to create temp directory for transcripts: %w", err)
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			p.debugf("Error cleaning up transcripts for step '%s': %v", step.Name, err)
+		}
+	}
+
+	var newInputs []*input.Input
+	for _, inputItem := range inputs {
+		if !inputItem.IsMedia() {
+			newInputs = append(newInputs, inputItem)
+			continue
+		}
+
+		p.debugf("Transcribing %s with %s (%s)", inputItem.Path, cfg.Model, transcriber.Name())
+		transcript, err := transcriber.Transcribe(cfg.Model, models.FileInput{
+			Path:     inputItem.Path,
+			MimeType: inputItem.MimeType,
+		}, opts)
+		if err != nil {
+			cleanup()
+			return noop, fmt.Errorf("failed to transcribe %s: %w", inputItem.Path, err)
+		}
+
+		// Without segments, timestamps and speakers would be silently left out
+		// and duration chunking would yield a single chunk
+		if opts.Segments && len(transcript.Segments) == 0 && strings.TrimSpace(transcript.Text) != "" {
+			cleanup()
+			return noop, fmt.Errorf("%s returned no timed segments for %s, which timestamps, speakers and chunking by duration need; use a model that returns them, such as whisper-1", cfg.Model, inputItem.Path)
+		}
+
+		pieces := []*models.Transcript{transcript}
+		if durationChunking {
+			pieces = transcript.SplitByDuration(float64(step.Config.Chunk.Size))
+			if maxChunks := step.Config.Chunk.MaxChunks; maxChunks > 0 && len(pieces) > maxChunks {
+				pieces = pieces[:maxChunks]
+			}
+			p.debugf("Split transcript of %s into %d chunk(s) of %d seconds", inputItem.Path, len(pieces), step.Config.Chunk.Size)
+		}
+
+		baseName := strings.TrimSuffix(filepath.Base(inputItem.Path), filepath.Ext(inputItem.Path))
+		for i, piece := range pieces {
+			text := piece.Format(cfg.Timestamps, cfg.Speakers)
+			transcriptPath := filepath.Join(tempDir, fmt.Sprintf("%s-transcript-%03d.txt", baseName, i))
+			if err := os.WriteFile(transcriptPath, []byte(text), 0644); err != nil {
+				cleanup()
+				return noop, fmt.Errorf("failed to write transcript for %s: %w", inputItem.Path, err)
+			}
+
+			newInputs = append(newInputs, &input.Input{
+				Path:     transcriptPath,
+				Type:     input.FileInput,
+				Contents: []byte(text),
+				MimeType: "text/plain",
+				Metadata: map[string]interface{}{
+					"source": inputItem.Path,
+				},
+			})
+		}
+	}
+
+	p.handler.SetInputs(newInputs)
+	return cleanup, nil
+}
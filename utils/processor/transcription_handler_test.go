@@ -0,0 +1,151 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kris-hansen/comanda/utils/models"
+)
+
+// mockTranscriber implements models.TranscriptionProvider for testing
+type mockTranscriber struct {
+	MockProvider
+	opts       models.TranscriptionOptions
+	noSegments bool // Returns plain text, like models without timed segments
+}
+
+func (m *mockTranscriber) Transcribe(modelName string, file models.FileInput, opts models.TranscriptionOptions) (*models.Transcript, error) {
+	m.opts = opts
+	if m.noSegments {
+		return &models.Transcript{Text: "first part second part"}, nil
+	}
+	return &models.Transcript{
+		Text: "first part second part",
+		Segments: []models.TranscriptSegment{
+			{Start: 0, End: 30, Speaker: "A", Text: "first part"},
+			{Start: 70, End: 90, Speaker: "B", Text: "second part"},
+		},
+	}, nil
+}
+
+func setupMediaProcessor(t *testing.T) (*Processor, *mockTranscriber) {
+	t.Helper()
+
+	audioPath := filepath.Join(t.TempDir(), "meeting.mp3")
+	if err := os.WriteFile(audioPath, []byte("fake audio"), 0644); err != nil {
+		t.Fatalf("Failed to write audio file: %v", err)
+	}
+
+	transcriber := &mockTranscriber{MockProvider: *NewMockProvider("openai")}
+	originalDetect := models.DetectTranscriber
+	models.DetectTranscriber = func(modelName string, providerName string) models.TranscriptionProvider {
+		return transcriber
+	}
+	t.Cleanup(func() { models.DetectTranscriber = originalDetect })
+
+	processor := NewProcessor(&DSLConfig{}, createTestEnvConfig(), createTestServerConfig(), false, "")
+	if err := processor.handler.ProcessPath(audioPath); err != nil {
+		t.Fatalf("Failed to add audio input: %v", err)
+	}
+	return processor, transcriber
+}
+
+func TestTranscribeMediaInputs(t *testing.T) {
+	processor, transcriber := setupMediaProcessor(t)
+
+	step := Step{
+		Name: "transcribe",
+		Config: StepConfig{
+			Transcription: &TranscriptionConfig{Timestamps: true, Speakers: true},
+		},
+	}
+
+	cleanup, err := processor.transcribeMediaInputs(step)
+	if err != nil {
+		t.Fatalf("transcribeMediaInputs returned error: %v", err)
+	}
+	defer cleanup()
+
+	if !transcriber.configured || transcriber.apiKey != "test-openai-key" {
+		t.Errorf("Expected transcriber to be configured with the openai key")
+	}
+	if !transcriber.opts.Segments || !transcriber.opts.Speakers {
+		t.Errorf("Expected segments and speakers to be requested, got %+v", transcriber.opts)
+	}
+
+	inputs := processor.handler.GetInputs()
+	if len(inputs) != 1 {
+		t.Fatalf("Expected 1 transcript input, got %d", len(inputs))
+	}
+	if inputs[0].IsMedia() {
+		t.Errorf("Expected media input to be replaced by a text transcript")
+	}
+	expected := "[00:00] A: first part\n[01:10] B: second part"
+	if string(inputs[0].Contents) != expected {
+		t.Errorf("Transcript = %q, want %q", string(inputs[0].Contents), expected)
+	}
+	if !strings.HasSuffix(inputs[0].Path, "meeting-transcript-000.txt") {
+		t.Errorf("Unexpected transcript path: %s", inputs[0].Path)
+	}
+}
+
+func TestTranscribeMediaInputsDurationChunking(t *testing.T) {
+	processor, transcriber := setupMediaProcessor(t)
+
+	step := Step{
+		Name: "transcribe",
+		Config: StepConfig{
+			Chunk: &ChunkConfig{By: "duration", Size: 60},
+		},
+	}
+
+	cleanup, err := processor.transcribeMediaInputs(step)
+	if err != nil {
+		t.Fatalf("transcribeMediaInputs returned error: %v", err)
+	}
+
+	if !transcriber.opts.Segments {
+		t.Errorf("Expected segments to be requested for duration chunking")
+	}
+
+	inputs := processor.handler.GetInputs()
+	if len(inputs) != 2 {
+		t.Fatalf("Expected 2 transcript chunks, got %d", len(inputs))
+	}
+	if string(inputs[0].Contents) != "first part" || string(inputs[1].Contents) != "second part" {
+		t.Errorf("Unexpected chunk contents: %q, %q", inputs[0].Contents, inputs[1].Contents)
+	}
+
+	cleanup()
+	if _, err := os.Stat(inputs[0].Path); !os.IsNotExist(err) {
+		t.Errorf("Expected transcript files to be removed by cleanup")
+	}
+}
+
+func TestTranscribeMediaInputsWithoutSegments(t *testing.T) {
+	for _, step := range []Step{
+		{Name: "timestamps", Config: StepConfig{Transcription: &TranscriptionConfig{Timestamps: true}}},
+		{Name: "speakers", Config: StepConfig{Transcription: &TranscriptionConfig{Speakers: true}}},
+		{Name: "chunks", Config: StepConfig{Chunk: &ChunkConfig{By: "duration", Size: 60}}},
+	} {
+		processor, transcriber := setupMediaProcessor(t)
+		transcriber.noSegments = true
+		if _, err := processor.transcribeMediaInputs(step); err == nil || !strings.Contains(err.Error(), "no timed segments") {
+			t.Errorf("%s: expected an error for a transcript without segments, got %v", step.Name, err)
+		}
+	}
+
+	// Plain transcripts need no segments
+	processor, transcriber := setupMediaProcessor(t)
+	transcriber.noSegments = true
+	cleanup, err := processor.transcribeMediaInputs(Step{Name: "plain"})
+	if err != nil {
+		t.Fatalf("transcribeMediaInputs returned error: %v", err)
+	}
+	defer cleanup()
+	if inputs := processor.handler.GetInputs(); len(inputs) != 1 || string(inputs[0].Contents) != "first part second part" {
+		t.Errorf("Unexpected transcript inputs: %+v", inputs)
+	}
+}
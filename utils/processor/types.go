@@ -1,13 +1,122 @@
 package processor
 
+import (
+	"fmt"
+
+	"github.com/kris-hansen/comanda/utils/config"
+	"gopkg.in/yaml.v3"
+)
+
 // ChunkConfig represents the configuration for chunking a large file
 type ChunkConfig struct {
-	By        string `yaml:"by"`         // How to split the file: "lines", "bytes", or "tokens"
-	Size      int    `yaml:"size"`       // Chunk size (e.g., 10000 lines)
+	By        string `yaml:"by"`         // How to split the file: "lines", "bytes", "tokens", or "duration" (audio/video)
+	Size      int    `yaml:"size"`       // Chunk size (e.g., 10000 lines, or seconds when chunking by duration)
 	Overlap   int    `yaml:"overlap"`    // Lines/bytes to overlap between chunks for context
 	MaxChunks int    `yaml:"max_chunks"` // Limit total chunks to prevent overload
 }
 
+// TranscriptionConfig represents how audio and video inputs are turned into text
+type TranscriptionConfig struct {
+	Model      string `yaml:"model"`      // Transcription model, e.g. whisper-1, gpt-4o-transcribe or gemini-2.5-flash
+	Provider   string `yaml:"provider"`   // Optional backend override: "openai", "google" or "whisper" (local server)
+	Language   string `yaml:"language"`   // Optional ISO-639-1 language hint
+	Prompt     string `yaml:"prompt"`     // Optional vocabulary/context hint passed to the backend
+	Timestamps bool   `yaml:"timestamps"` // Prefix each transcript line with its start time
+	Speakers   bool   `yaml:"speakers"`   // Label transcript lines with speakers where the backend supports it
+}
+
+// ImageConfig represents the options for an image-generation step
+type ImageConfig struct {
+	Provider string `yaml:"provider"` // Optional backend override: "openai", "google" or "stable-diffusion" (local server)
+	Size     string `yaml:"size"`     // Image dimensions as WIDTHxHEIGHT, e.g. 1024x1024
+	Quality  string `yaml:"quality"`  // Backend-specific quality, e.g. standard, hd, low, medium, high
+	Count    int    `yaml:"count"`    // Number of images to generate (default 1)
+	Format   string `yaml:"format"`   // Output encoding: png or jpeg (default: derived from the output file extension)
+}
+
+// Step execution modes
+const (
+	ExecutionBatch = "batch" // Submit the per-file requests as one asynchronous provider batch
+)
+
+// BatchConfig represents the options for steps with execution: batch
+type BatchConfig struct {
+	PollInterval string `yaml:"poll_interval"` // How often to check the batch status, e.g. 1m (default 30s)
+	Wait         string `yaml:"wait"`          // How long to wait for the results before exiting, e.g. 2h (default 24h); a later run resumes the batch
+	StateDir     string `yaml:"state_dir"`     // Where submitted batch IDs are stored for resuming (default .comanda/batches)
+}
+
+// IndexConfig represents the options for an "index" step, which embeds its inputs into a local vector index
+type IndexConfig struct {
+	Path     string `yaml:"path"`     // Index file, e.g. .comanda/docs.index.json
+	Provider string `yaml:"provider"` // Optional embedding backend override: "openai", "google", "ollama" or "vllm"
+}
+
+// RetrieveConfig represents the options for a "retrieve" step, which looks up the chunks most similar to a query
+type RetrieveConfig struct {
+	Index    string  `yaml:"index"`     // Index file written by an index step
+	Provider string  `yaml:"provider"`  // Optional embedding backend override
+	TopK     int     `yaml:"top_k"`     // Number of chunks to return (default 5)
+	MinScore float64 `yaml:"min_score"` // Optional minimum cosine similarity
+}
+
+// Memory injection modes
+const (
+	MemoryModeFull     = "full"     // Inject the whole memory file
+	MemoryModeSections = "sections" // Inject only the listed "## section" blocks
+	MemoryModeRelevant = "relevant" // Inject the entries most relevant to the action, up to a token budget
+)
+
+// MemoryConfig controls how project memory is injected into a step's actions.
+// In YAML it can be a bool (memory: true), a mode name (memory: relevant) or a mapping.
+type MemoryConfig struct {
+	Enabled   bool     `yaml:"-"`
+	Mode      string   `yaml:"mode"`       // "full" (default), "sections" or "relevant"
+	Sections  []string `yaml:"sections"`   // Section names for "sections" mode
+	MaxTokens int      `yaml:"max_tokens"` // Token budget for "relevant" mode (default 2000)
+	Model     string   `yaml:"model"`      // Optional embedding model for "relevant" mode; keyword ranking is used otherwise
+}
+
+// UnmarshalYAML accepts the bool, string and mapping forms of the memory field
+func (m *MemoryConfig) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var enabled bool
+		if err := node.Decode(&enabled); err == nil {
+			*m = MemoryConfig{Enabled: enabled, Mode: MemoryModeFull}
+			return nil
+		}
+		*m = MemoryConfig{Enabled: true, Mode: node.Value}
+	case yaml.MappingNode:
+		type rawMemoryConfig MemoryConfig
+		var raw rawMemoryConfig
+		if err := node.Decode(&raw); err != nil {
+			return err
+		}
+		*m = MemoryConfig(raw)
+		m.Enabled = true
+		if m.Mode == "" {
+			m.Mode = MemoryModeFull
+			if len(m.Sections) > 0 {
+				m.Mode = MemoryModeSections
+			}
+		}
+	default:
+		return fmt.Errorf("line %d: memory must be true/false, a mode name, or a mapping", node.Line)
+	}
+
+	switch m.Mode {
+	case MemoryModeFull, MemoryModeRelevant:
+	case MemoryModeSections:
+		if len(m.Sections) == 0 {
+			return fmt.Errorf("line %d: memory mode 'sections' requires a list of sections", node.Line)
+		}
+	default:
+		return fmt.Errorf("line %d: unknown memory mode '%s' (must be full, sections or relevant)", node.Line, m.Mode)
+	}
+	return nil
+}
+
 // StepConfig represents the configuration for a single step
 type StepConfig struct {
 	Type       string       `yaml:"type"`            // Step type (default is standard LLM step)
@@ -16,10 +125,29 @@ type StepConfig struct {
 	Action     interface{}  `yaml:"action"`          // Can be string or []string
 	Output     interface{}  `yaml:"output"`          // Can be string or []string
 	NextAction interface{}  `yaml:"next-action"`     // Can be string or []string
-	BatchMode  string       `yaml:"batch_mode"`      // How to process multiple files: "combined" (default) or "individual"
+	BatchMode  string       `yaml:"batch_mode"`      // How to process multiple files: "combined" (default), "individual" or "multimodal"
 	SkipErrors bool         `yaml:"skip_errors"`     // Whether to continue processing if some files fail
 	Chunk      *ChunkConfig `yaml:"chunk,omitempty"` // Configuration for chunking large files
-	Memory     bool         `yaml:"memory"`          // Whether to include memory context in this step
+	Memory     MemoryConfig `yaml:"memory"`          // Whether and how to include memory context in this step
+
+	// Execution is "batch" to send the per-file requests of a multi-file step as
+	// one discounted provider batch instead of real-time calls
+	Execution string       `yaml:"execution,omitempty"`
+	Batch     *BatchConfig `yaml:"batch,omitempty"`
+
+	// Generation parameters such as temperature and max_tokens, overriding the
+	// model's defaults from the environment configuration
+	Params config.ModelParams `yaml:"params,omitempty"`
+
+	// Transcription configuration for audio and video inputs
+	Transcription *TranscriptionConfig `yaml:"transcription,omitempty"`
+
+	// Image generation options for "image-generation" steps
+	Image *ImageConfig `yaml:"image,omitempty"`
+
+	// Retrieval options for "index" and "retrieve" steps
+	Index    *IndexConfig    `yaml:"index,omitempty"`
+	Retrieve *RetrieveConfig `yaml:"retrieve,omitempty"`
 
 	// OpenAI Responses API specific fields
 	Instructions       string                   `yaml:"instructions"`         // System message
@@ -42,11 +170,39 @@ type Step struct {
 	Config StepConfig
 }
 
+// Workflow param types
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamBool   = "bool"
+	ParamFile   = "file" // Path of an existing file
+	ParamEnum   = "enum" // One of the listed values
+)
+
+// ParamSpec declares a typed input of a workflow, available to its steps as $name
+type ParamSpec struct {
+	Type        string      `yaml:"type"`        // string (default), int, bool, file or enum
+	Description string      `yaml:"description"` // Shown in errors about the param
+	Required    bool        `yaml:"required"`    // Whether the caller must provide a value
+	Default     interface{} `yaml:"default"`     // Value used when none is provided
+	Values      []string    `yaml:"values"`      // Allowed values of an enum param
+}
+
+// WorkflowMeta represents the reserved workflow: block with the workflow's metadata and params
+type WorkflowMeta struct {
+	Name        string               `yaml:"name"`
+	Version     string               `yaml:"version"`
+	Description string               `yaml:"description"`
+	Params      map[string]ParamSpec `yaml:"params"`
+}
+
 // DSLConfig represents the structure of the DSL configuration
 type DSLConfig struct {
 	Steps         []Step
-	ParallelSteps map[string][]Step     // Steps that can be executed in parallel
-	Defer         map[string]StepConfig `yaml:"defer,omitempty"`
+	ParallelSteps map[string][]Step      // Steps that can be executed in parallel
+	Defer         map[string]StepConfig  `yaml:"defer,omitempty"`
+	Config        map[string]interface{} `yaml:"config,omitempty"`   // Configuration overrides for this workflow
+	Workflow      *WorkflowMeta          `yaml:"workflow,omitempty"` // Metadata and params of the workflow
 }
 
 // StepDependency represents a dependency between steps
@@ -65,6 +221,7 @@ type PerformanceMetrics struct {
 	InputProcessingTime  int64 // Time in milliseconds to process inputs
 	ModelProcessingTime  int64 // Time in milliseconds for model processing
 	ActionProcessingTime int64 // Time in milliseconds for action processing
+	RateLimitWaitTime    int64 // Time in milliseconds spent waiting for rate limits, part of action processing
 	OutputProcessingTime int64 // Time in milliseconds for output processing
 	TotalProcessingTime  int64 // Total time in milliseconds for the step
 }
@@ -0,0 +1,179 @@
+// Package ratelimit throttles model requests on the client side with token
+// buckets, so that parallel steps and concurrent server requests stay within
+// provider limits instead of relying on retries after 429 responses.
+package ratelimit
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+// charsPerToken approximates the number of characters in a token
+const charsPerToken = 4
+
+// EstimateTokens returns a rough token count for text
+func EstimateTokens(text string) int {
+	return EstimateTokensForSize(int64(len(text)))
+}
+
+// EstimateTokensForSize returns a rough token count for size bytes of content
+func EstimateTokensForSize(size int64) int {
+	return int((size + charsPerToken - 1) / charsPerToken)
+}
+
+// bucket is a token bucket that refills continuously up to its capacity. Its
+// level may go below zero: reservations are granted in order and a negative
+// level is the debt later callers wait for.
+type bucket struct {
+	capacity float64
+	level    float64
+	perSec   float64
+	updated  time.Time
+}
+
+// newBucket returns a full bucket holding perMinute units
+func newBucket(perMinute int, now time.Time) *bucket {
+	return &bucket{
+		capacity: float64(perMinute),
+		level:    float64(perMinute),
+		perSec:   float64(perMinute) / 60,
+		updated:  now,
+	}
+}
+
+// refill adds the units accumulated since the last update
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.level += elapsed * b.perSec
+		if b.level > b.capacity {
+			b.level = b.capacity
+		}
+		b.updated = now
+	}
+}
+
+// reserve takes n units and returns how long the caller must wait for them. A
+// request larger than the bucket takes the whole bucket so that it can proceed.
+func (b *bucket) reserve(n float64, now time.Time) time.Duration {
+	b.refill(now)
+	if n > b.capacity {
+		n = b.capacity
+	}
+	b.level -= n
+	if b.level >= 0 {
+		return 0
+	}
+	return time.Duration(-b.level / b.perSec * float64(time.Second))
+}
+
+// Limiter enforces a RateLimit with one bucket for requests and one for tokens
+type Limiter struct {
+	mu       sync.Mutex
+	limit    config.RateLimit
+	requests *bucket
+	tokens   *bucket
+}
+
+// NewLimiter returns a limiter for limit with full buckets
+func NewLimiter(limit config.RateLimit) *Limiter {
+	now := time.Now()
+	l := &Limiter{limit: limit}
+	if limit.RequestsPerMinute > 0 {
+		l.requests = newBucket(limit.RequestsPerMinute, now)
+	}
+	if limit.TokensPerMinute > 0 {
+		l.tokens = newBucket(limit.TokensPerMinute, now)
+	}
+	return l
+}
+
+// Reserve takes one request and the given number of tokens and returns how long
+// the caller must wait before sending the request
+func (l *Limiter) Reserve(tokens int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	var wait time.Duration
+	if l.requests != nil {
+		wait = l.requests.reserve(1, now)
+	}
+	if l.tokens != nil {
+		if tokenWait := l.tokens.reserve(float64(tokens), now); tokenWait > wait {
+			wait = tokenWait
+		}
+	}
+	return wait
+}
+
+// Charge takes tokens that were used without waiting for them, such as the
+// tokens of a response; later requests wait for the debt
+func (l *Limiter) Charge(tokens int) {
+	if l.tokens == nil || tokens <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens.reserve(float64(tokens), time.Now())
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Limiter)
+)
+
+// Get returns the limiter of a scope, such as "openai" or "openai/gpt-4o",
+// shared by every caller in the process. The limiter is replaced when the
+// configured limit changes.
+func Get(scope string, limit config.RateLimit) *Limiter {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if l, ok := registry[scope]; ok && l.limit == limit {
+		return l
+	}
+	l := NewLimiter(limit)
+	registry[scope] = l
+	return l
+}
+
+// Reset removes all limiters, for tests
+func Reset() {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = make(map[string]*Limiter)
+}
+
+// Wait reserves a request with the given number of tokens from the limiters of
+// every scope in limits, sleeps until all of them allow it and returns the time
+// spent waiting
+func Wait(limits map[string]config.RateLimit, tokens int) time.Duration {
+	if len(limits) == 0 {
+		return 0
+	}
+	scopes := make([]string, 0, len(limits))
+	for scope := range limits {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	var wait time.Duration
+	for _, scope := range scopes {
+		if w := Get(scope, limits[scope]).Reserve(tokens); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		config.DebugLog("Rate limit: waiting %v for %v", wait, scopes)
+		time.Sleep(wait)
+	}
+	return wait
+}
+
+// Charge takes tokens from the limiters of every scope in limits without waiting
+func Charge(limits map[string]config.RateLimit, tokens int) {
+	for scope, limit := range limits {
+		Get(scope, limit).Charge(tokens)
+	}
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
+func TestBucketReserve(t *testing.T) {
+	start := time.Now()
+	b := newBucket(60, start) // One unit per second
+
+	for i := 0; i < 60; i++ {
+		if wait := b.reserve(1, start); wait != 0 {
+			t.Fatalf("Reservation %d should not wait, got %v", i, wait)
+		}
+	}
+	if wait := b.reserve(1, start); wait != time.Second {
+		t.Errorf("An empty bucket should wait for one refill, got %v", wait)
+	}
+	if wait := b.reserve(1, start); wait != 2*time.Second {
+		t.Errorf("Reservations should queue up, got %v", wait)
+	}
+
+	// The bucket refills over time but never beyond its capacity
+	later := start.Add(10 * time.Minute)
+	b.refill(later)
+	if b.level != 60 {
+		t.Errorf("level = %v, want the capacity", b.level)
+	}
+
+	// A request larger than the bucket takes the whole bucket
+	if wait := b.reserve(1000, later); wait != 0 {
+		t.Errorf("An oversized request should proceed with a full bucket, got %v", wait)
+	}
+}
+
+func TestLimiterTokensAndCharge(t *testing.T) {
+	l := NewLimiter(config.RateLimit{TokensPerMinute: 6000}) // 100 tokens per second
+	if wait := l.Reserve(6000); wait != 0 {
+		t.Fatalf("The first request should not wait, got %v", wait)
+	}
+	l.Charge(100)
+	wait := l.Reserve(100)
+	if wait < 1900*time.Millisecond || wait > 2*time.Second {
+		t.Errorf("The response tokens should be charged, got a wait of %v", wait)
+	}
+}
+
+func TestGetSharesLimiters(t *testing.T) {
+	Reset()
+	defer Reset()
+	limit := config.RateLimit{RequestsPerMinute: 10}
+	if Get("openai", limit) != Get("openai", limit) {
+		t.Error("Callers should share the limiter of a scope")
+	}
+	if Get("openai", limit) == Get("openai/gpt-4o", limit) {
+		t.Error("Scopes should have separate limiters")
+	}
+	before := Get("openai", limit)
+	if Get("openai", config.RateLimit{RequestsPerMinute: 20}) == before {
+		t.Error("A changed limit should replace the limiter")
+	}
+}
+
+func TestWaitConcurrent(t *testing.T) {
+	Reset()
+	defer Reset()
+	limits := map[string]config.RateLimit{"openai": {RequestsPerMinute: 1200}} // One request per 50ms
+
+	// The bucket starts full, so 1200 requests proceed at once and the next
+	// ones wait for the refill
+	for i := 0; i < 1200; i++ {
+		Get("openai", limits["openai"]).Reserve(0)
+	}
+
+	var wg sync.WaitGroup
+	waits := make([]time.Duration, 4)
+	start := time.Now()
+	for i := range waits {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			waits[i] = Wait(limits, 0)
+		}(i)
+	}
+	wg.Wait()
+
+	var total time.Duration
+	for _, wait := range waits {
+		total += wait
+	}
+	// The goroutines queue up for 50, 100, 150 and 200ms
+	if total < 400*time.Millisecond {
+		t.Errorf("Concurrent callers should share the limiter, total wait %v", total)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("The last caller should wait for about 200ms, elapsed %v", elapsed)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if got := EstimateTokens("abcdefghi"); got != 3 {
+		t.Errorf("EstimateTokens = %d, want 3", got)
+	}
+	if got := EstimateTokens(""); got != 0 {
+		t.Errorf("EstimateTokens of an empty text = %d", got)
+	}
+}
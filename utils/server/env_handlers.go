@@ -17,9 +17,7 @@ func (s *Server) handleEncryptEnv(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Password string `json:"password"`
-	}
+	var req EnvironmentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(EnvironmentResponse{
@@ -51,6 +49,32 @@ func (s *Server) handleEncryptEnv(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Mode != "" && req.Mode != "file" && req.Mode != "fields" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(EnvironmentResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid mode '%s' (must be file or fields)", req.Mode),
+		})
+		return
+	}
+
+	// Encrypt the secret fields
+	if req.Mode == "fields" {
+		if err := config.EncryptConfigFields(envPath, req.Password); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(EnvironmentResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Error encrypting fields: %v", err),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(EnvironmentResponse{
+			Success: true,
+			Message: "Environment file secret fields encrypted successfully",
+		})
+		return
+	}
+
 	// Encrypt the file
 	if err := config.EncryptConfig(envPath, req.Password); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -110,6 +134,23 @@ func (s *Server) handleDecryptEnv(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Decrypt the secret fields of a file encrypted per field
+	if config.IsFieldEncrypted(data) {
+		if err := config.DecryptConfigFields(envPath, req.Password); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(EnvironmentResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Error decrypting fields: %v", err),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(EnvironmentResponse{
+			Success: true,
+			Message: "Environment file secret fields decrypted successfully",
+		})
+		return
+	}
+
 	// Verify file is encrypted
 	if !config.IsEncrypted(data) {
 		w.WriteHeader(http.StatusBadRequest)
@@ -132,7 +173,7 @@ func (s *Server) handleDecryptEnv(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Write decrypted data back to file
-	if err := os.WriteFile(envPath, decrypted, 0644); err != nil {
+	if err := config.WriteConfigFile(envPath, decrypted); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(EnvironmentResponse{
 			Success: false,
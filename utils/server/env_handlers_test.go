@@ -228,3 +228,60 @@ func TestHandleEncryptEnvWithoutPassword(t *testing.T) {
 		t.Errorf("Expected error message 'Password is required', got '%s'", response.Error)
 	}
 }
+
+func TestHandleEncryptEnvFields(t *testing.T) {
+	tempDir := t.TempDir()
+	envPath := filepath.Join(tempDir, ".env")
+	testConfig := &config.EnvConfig{
+		Providers: map[string]*config.Provider{
+			"test": {
+				APIKey: "test-key",
+				Models: []config.Model{{Name: "test-model", Type: "external"}},
+			},
+		},
+	}
+	if err := config.SaveEnvConfig(envPath, testConfig); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("COMANDA_ENV", envPath)
+
+	server := &Server{
+		config:    &config.ServerConfig{DataDir: tempDir, BearerToken: "test-token", Enabled: true},
+		envConfig: testConfig,
+	}
+	send := func(handler http.HandlerFunc, path string, body EnvironmentRequest) EnvironmentResponse {
+		bodyBytes, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Authorization", "Bearer test-token")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		var response EnvironmentResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	if response := send(server.handleEncryptEnv, "/env/encrypt", EnvironmentRequest{Password: "test-password", Mode: "fields"}); !response.Success {
+		t.Fatalf("Expected field encryption to succeed: %s", response.Error)
+	}
+	content, _ := os.ReadFile(envPath)
+	if config.IsEncrypted(content) || !config.IsFieldEncrypted(content) {
+		t.Fatal("Expected only the secret fields to be encrypted")
+	}
+	if bytes.Contains(content, []byte("test-key")) || !bytes.Contains(content, []byte("test-model")) {
+		t.Errorf("Expected the API key sealed and the models in plain text:\n%s", content)
+	}
+
+	if response := send(server.handleDecryptEnv, "/env/decrypt", EnvironmentRequest{Password: "test-password"}); !response.Success {
+		t.Fatalf("Expected field decryption to succeed: %s", response.Error)
+	}
+	content, _ = os.ReadFile(envPath)
+	if config.IsFieldEncrypted(content) || !bytes.Contains(content, []byte("test-key")) {
+		t.Errorf("Expected the API key in plain text after decryption:\n%s", content)
+	}
+
+	if response := send(server.handleEncryptEnv, "/env/encrypt", EnvironmentRequest{Password: "test-password", Mode: "values"}); response.Success {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+}
@@ -761,9 +761,10 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// First unmarshal into a map to preserve step names
-	var rawConfig map[string]processor.StepConfig
-	if err := yaml.Unmarshal([]byte(req.Content), &rawConfig); err != nil {
+	// Unmarshal with the DSL's own unmarshaler, which keeps the step order and
+	// reads the reserved workflow: and config: blocks
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal([]byte(req.Content), &dslConfig); err != nil {
 		if req.Streaming {
 			w.Header().Set("Content-Type", "text/event-stream")
 			w.Header().Set("Cache-Control", "no-cache")
@@ -791,21 +792,41 @@ func (s *Server) handleYAMLProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert map to ordered Steps slice
-	var dslConfig processor.DSLConfig
-	for name, config := range rawConfig {
-		dslConfig.Steps = append(dslConfig.Steps, processor.Step{
-			Name:   name,
-			Config: config,
-		})
-	}
-
 	// Get runtime directory from query parameter
 	runtimeDir := r.URL.Query().Get("runtimeDir")
 
 	// Create processor instance with validation enabled and runtime directory
 	proc := processor.NewProcessor(&dslConfig, s.envConfig, s.config, true, runtimeDir)
 
+	// Bill the request's API calls to a project's keys, if requested
+	if project := r.URL.Query().Get("project"); project != "" {
+		proc.SetProject(project)
+	}
+
+	// Select a memory namespace, e.g. one per user, if requested
+	if memoryNamespace := r.URL.Query().Get("memoryNamespace"); memoryNamespace != "" {
+		if err := proc.SetMemoryNamespace(memoryNamespace); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ProcessResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Error selecting memory namespace: %v", err),
+			})
+			return
+		}
+	}
+
+	// Check the workflow params before any model is called
+	if err := proc.SetParams(paramValues(req.Params)); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ProcessResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
 	// Set input if provided
 	if req.Input != "" {
 		proc.SetLastOutput(req.Input)
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/keypool"
 	"github.com/kris-hansen/comanda/utils/models"
 	"github.com/kris-hansen/comanda/utils/processor"
 )
@@ -90,10 +91,14 @@ CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be
 	// Get the provider
 	provider := models.DetectProvider(modelForGeneration)
 	if provider == nil {
+		message := fmt.Sprintf("Could not detect provider for model: %s", modelForGeneration)
+		if _, err := models.ResolveModel(modelForGeneration); err != nil {
+			message = fmt.Sprintf("Could not detect provider for model: %v", err)
+		}
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(GenerateResponse{
 			Success: false,
-			Error:   fmt.Sprintf("Could not detect provider for model: %s", modelForGeneration),
+			Error:   message,
 		})
 		return
 	}
@@ -104,7 +109,16 @@ CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be
 		// If provider is not in envConfig, it might be a public one like Ollama
 		config.VerboseLog("Provider %s not found in env configuration. Assuming it does not require an API key.", provider.Name())
 	} else {
-		if err := provider.Configure(providerConfig.APIKey); err != nil {
+		apiKey, err := keypool.Key(provider.Name(), providerConfig, projectParam(r, s.envConfig))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(GenerateResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		if err := provider.Configure(apiKey); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(GenerateResponse{
 				Success: false,
@@ -117,7 +131,7 @@ CRITICAL INSTRUCTION: Your entire response must be valid YAML syntax that can be
 
 	// Call the LLM
 	config.DebugLog("Sending prompt to LLM: model=%s, prompt_length=%d", modelForGeneration, len(fullPrompt))
-	generatedResponse, err := provider.SendPrompt(modelForGeneration, fullPrompt)
+	generatedResponse, err := provider.SendPrompt(models.BareModelName(modelForGeneration), fullPrompt)
 	if err != nil {
 		config.VerboseLog("LLM execution failed: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
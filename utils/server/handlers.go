@@ -222,9 +222,10 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 	// Log YAML content details before parsing
 	config.DebugLog("Processing YAML content: length=%d bytes", len(yamlContent))
 
-	// First unmarshal into a map to preserve step names (same as CLI)
-	var rawConfig map[string]processor.StepConfig
-	if err := yaml.Unmarshal(yamlContent, &rawConfig); err != nil {
+	// Unmarshal with the DSL's own unmarshaler (same as CLI), which keeps the step
+	// order and reads the reserved workflow: and config: blocks
+	var dslConfig processor.DSLConfig
+	if err := yaml.Unmarshal(yamlContent, &dslConfig); err != nil {
 		config.VerboseLog("Error parsing YAML: %v", err)
 		config.DebugLog("YAML parse error: content_preview='%s' error=%v", truncateString(string(yamlContent), 200), err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -249,15 +250,9 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 		return
 	}
 
-	// Convert map to ordered Steps slice (same as CLI)
-	var dslConfig processor.DSLConfig
-	config.DebugLog("Converting YAML to DSL config: step_count=%d", len(rawConfig))
-	for name, stepConfig := range rawConfig {
-		config.DebugLog("Processing step: name=%s model=%v action=%v", name, stepConfig.Model, stepConfig.Action)
-		dslConfig.Steps = append(dslConfig.Steps, processor.Step{
-			Name:   name,
-			Config: stepConfig,
-		})
+	config.DebugLog("Parsed DSL config: step_count=%d", len(dslConfig.Steps))
+	for _, step := range dslConfig.Steps {
+		config.DebugLog("Processing step: name=%s model=%v action=%v", step.Name, step.Config.Model, step.Config.Action)
 	}
 
 	// Get runtime directory from query parameter or calculate from path
@@ -281,6 +276,24 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 	proc := processor.NewProcessor(&dslConfig, envConfig, serverConfig, true, runtimeDir)
 	config.DebugLog("Processor created successfully with config: steps=%d, runtimeDir=%s", len(dslConfig.Steps), runtimeDir)
 
+	// Bill the request's API calls to a project's keys, if requested
+	if project := r.URL.Query().Get("project"); project != "" {
+		proc.SetProject(project)
+	}
+
+	// Select a memory namespace, e.g. one per user, if requested
+	if memoryNamespace := r.URL.Query().Get("memoryNamespace"); memoryNamespace != "" {
+		if err := proc.SetMemoryNamespace(memoryNamespace); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ProcessResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Error selecting memory namespace: %v", err),
+			})
+			return
+		}
+	}
+
 	// Handle POST input with detailed logging
 	var stdinInput string
 
@@ -290,18 +303,32 @@ func handleProcess(w http.ResponseWriter, r *http.Request, serverConfig *config.
 	stdinInput = r.URL.Query().Get("input")
 
 	// If not in query, check JSON body
+	var params map[string]interface{}
 	if stdinInput == "" && r.Body != nil {
 		var jsonBody struct {
-			Input     string `json:"input"`
-			Streaming bool   `json:"streaming"`
+			Input     string                 `json:"input"`
+			Streaming bool                   `json:"streaming"`
+			Params    map[string]interface{} `json:"params"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&jsonBody); err == nil {
 			stdinInput = jsonBody.Input
 			streaming = jsonBody.Streaming
+			params = jsonBody.Params
 		}
 		config.DebugLog("Extracted input from JSON body")
 	}
 
+	// Check the workflow params before any model is called
+	if err := proc.SetParams(paramValues(params)); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ProcessResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
 	// Always initialize the processor with input (empty string if none provided)
 	if stdinInput != "" {
 		config.VerboseLog("Processing STDIN input")
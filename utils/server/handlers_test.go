@@ -653,3 +653,89 @@ step_one:
 		})
 	}
 }
+
+func TestHandleYAMLProcessParams(t *testing.T) {
+	server := &Server{
+		config: &config.ServerConfig{
+			BearerToken: "test-token",
+			Enabled:     true,
+		},
+		envConfig: &config.EnvConfig{},
+	}
+
+	content := `
+workflow:
+  name: review
+  params:
+    tone:
+      type: enum
+      values: [formal, casual]
+      required: true
+    rounds:
+      type: int
+      default: 1
+
+review:
+  input: NA
+  model: gpt-4o
+  action: "Review in a $tone tone"
+  output: STDOUT`
+
+	tests := []struct {
+		name          string
+		params        map[string]interface{}
+		expectedError string
+	}{
+		{name: "missing required param", expectedError: "missing required param 'tone'"},
+		{name: "value outside the enum", params: map[string]interface{}{"tone": "rude"}, expectedError: "must be one of formal, casual"},
+		{name: "wrong type", params: map[string]interface{}{"tone": "formal", "rounds": "two"}, expectedError: "param 'rounds' must be an int"},
+		{name: "undeclared param", params: map[string]interface{}{"tone": "formal", "extra": true}, expectedError: "unknown param 'extra'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(YAMLRequest{Content: content, Params: tt.params})
+			req := httptest.NewRequest(http.MethodPost, "/yaml/process", bytes.NewBuffer(body))
+			req.Header.Set("Authorization", "Bearer test-token")
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			server.handleYAMLProcess(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var response ProcessResponse
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.False(t, response.Success)
+			assert.Contains(t, response.Error, tt.expectedError)
+		})
+	}
+}
+
+func TestSchemaEndpoint(t *testing.T) {
+	server := &Server{
+		mux: http.NewServeMux(),
+		config: &config.ServerConfig{
+			BearerToken: "test-token",
+			Enabled:     true,
+		},
+		envConfig: &config.EnvConfig{},
+	}
+	server.routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/schema", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/schema+json", w.Header().Get("Content-Type"))
+	var schema map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &schema))
+	assert.Contains(t, schema["definitions"], "StepConfig")
+
+	req = httptest.NewRequest(http.MethodPost, "/schema", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -2,12 +2,15 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings" // Added for path splitting
 
 	"github.com/kris-hansen/comanda/utils/config"
 	"github.com/kris-hansen/comanda/utils/discovery" // Added discovery package
+	"github.com/kris-hansen/comanda/utils/keypool"
 	"github.com/kris-hansen/comanda/utils/models"
 )
 
@@ -31,32 +34,32 @@ func (s *Server) handleGetProviders(w http.ResponseWriter, r *http.Request) {
 
 	providers := []ProviderInfo{}
 
-	// Get provider instances
-	providerList := []struct {
-		name     string
-		provider models.Provider
-	}{
-		{"openai", models.NewOpenAIProvider()},
-		{"anthropic", models.NewAnthropicProvider()},
-		{"google", models.NewGoogleProvider()},
-		{"xai", models.NewXAIProvider()},
-		{"ollama", models.NewOllamaProvider()},
-		{"vllm", models.NewVLLMProvider()},
-	}
-
-	// Get provider configurations
-	for _, p := range providerList {
-		if p.provider != nil {
-			if provider, err := s.envConfig.GetProviderConfig(p.name); err == nil {
-				providers = append(providers, ProviderInfo{
-					Name:    p.name,
-					Models:  getModelNames(provider.Models),
-					Enabled: provider.APIKey != "",
-				})
-			}
+	// Registered providers that are present in the configuration
+	for _, factory := range models.RegisteredProviders() {
+		if provider, err := s.envConfig.GetProviderConfig(factory.Name); err == nil {
+			providers = append(providers, ProviderInfo{
+				Name:         factory.Name,
+				Models:       getModelNames(provider.Models),
+				Enabled:      provider.HasAPIKey(),
+				Capabilities: factory.Capabilities,
+			})
 		}
 	}
 
+	// Named openai-compatible endpoints
+	for _, name := range sortedProviderNames(s.envConfig) {
+		provider := s.envConfig.Providers[name]
+		if provider == nil || !provider.IsOpenAICompatible() {
+			continue
+		}
+		providers = append(providers, ProviderInfo{
+			Name:         name,
+			Models:       getModelNames(provider.Models),
+			Enabled:      provider.HasAPIKey() || provider.Auth == models.AuthNone,
+			Capabilities: []models.Capability{models.CapabilityText, models.CapabilityVision, models.CapabilityResponses},
+		})
+	}
+
 	json.NewEncoder(w).Encode(ProviderListResponse{
 		Success:   true,
 		Providers: providers,
@@ -71,9 +74,8 @@ func (s *Server) handleGetConfiguredModels(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	providerConfig, err := s.envConfig.GetProviderConfig(providerName)
-	if err != nil {
-		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Provider '%s' not found", providerName))
+	providerConfig, ok := s.providerConfig(w, providerName)
+	if !ok {
 		return
 	}
 
@@ -92,6 +94,32 @@ func (s *Server) handleGetConfiguredModels(w http.ResponseWriter, r *http.Reques
 	})
 }
 
+// handleGetKeyUsage returns the per-key usage counters of a provider, including
+// the keys taken out of rotation
+func (s *Server) handleGetKeyUsage(w http.ResponseWriter, r *http.Request, providerName string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !checkAuth(s.config, w, r) {
+		return
+	}
+
+	providerConfig, ok := s.providerConfig(w, providerName)
+	if !ok {
+		return
+	}
+
+	selection := providerConfig.KeySelection
+	if selection == "" {
+		selection = config.KeySelectionRoundRobin
+	}
+	json.NewEncoder(w).Encode(KeyUsageResponse{
+		Success:   true,
+		Provider:  providerName,
+		Selection: selection,
+		Keys:      keypool.Get(providerName, providerConfig).Usage(),
+	})
+}
+
 // handleGetAvailableModels returns the list of models available from the provider's service
 func (s *Server) handleGetAvailableModels(w http.ResponseWriter, r *http.Request, providerName string) {
 	w.Header().Set("Content-Type", "application/json")
@@ -100,19 +128,27 @@ func (s *Server) handleGetAvailableModels(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if _, ok := models.LookupProvider(providerName); !ok {
+		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Unknown provider '%s'", providerName))
+		return
+	}
+
 	// Get API key if needed (e.g., for OpenAI)
-	providerConfig, err := s.envConfig.GetProviderConfig(providerName)
 	apiKey := ""
-	if err == nil { // Provider exists, get its key
-		apiKey = providerConfig.APIKey
-	} else if providerName != "ollama" && providerName != "vllm" && providerName != "anthropic" && providerName != "google" && providerName != "xai" && providerName != "deepseek" {
-		// If provider doesn't exist and requires a key, we can't proceed
-		sendJSONError(w, http.StatusBadRequest, fmt.Sprintf("Provider '%s' not configured or requires an API key to list models", providerName))
-		return
+	if providerConfig, err := s.envConfig.GetProviderConfig(providerName); err == nil {
+		// Any key can list the models
+		if keys := providerConfig.Keys(); len(keys) > 0 {
+			apiKey = keys[0].Key
+		}
 	}
 
 	// Fetch available models using the discovery package
 	modelNames, err := discovery.GetAvailableModels(providerName, apiKey)
+	if errors.Is(err, models.ErrAPIKeyRequired) {
+		// The provider must be configured with a key before its models can be listed
+		sendJSONError(w, http.StatusBadRequest, fmt.Sprintf("Provider '%s' not configured or requires an API key to list models", providerName))
+		return
+	}
 	if err != nil {
 		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error fetching available models for %s: %v", providerName, err))
 		return
@@ -136,6 +172,9 @@ func (s *Server) handleAddModel(w http.ResponseWriter, r *http.Request, provider
 	if !checkAuth(s.config, w, r) {
 		return
 	}
+	if !s.requireEnvFileConfig(w) {
+		return
+	}
 
 	var req AddModelRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -162,7 +201,7 @@ func (s *Server) handleAddModel(w http.ResponseWriter, r *http.Request, provider
 
 	// Determine model type
 	modelType := "external"
-	if providerName == "ollama" || providerName == "vllm" {
+	if factory, ok := models.LookupProvider(providerName); ok && factory.Local {
 		modelType = "local"
 	}
 
@@ -202,6 +241,9 @@ func (s *Server) handleUpdateModel(w http.ResponseWriter, r *http.Request, provi
 	if !checkAuth(s.config, w, r) {
 		return
 	}
+	if !s.requireEnvFileConfig(w) {
+		return
+	}
 
 	var req UpdateModelRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -252,10 +294,12 @@ func (s *Server) handleDeleteModel(w http.ResponseWriter, r *http.Request, provi
 	if !checkAuth(s.config, w, r) {
 		return
 	}
+	if !s.requireEnvFileConfig(w) {
+		return
+	}
 
-	providerConfig, err := s.envConfig.GetProviderConfig(providerName)
-	if err != nil {
-		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Provider '%s' not found", providerName))
+	providerConfig, ok := s.providerConfig(w, providerName)
+	if !ok {
 		return
 	}
 
@@ -308,21 +352,8 @@ func (s *Server) handleValidateProvider(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Create provider instance
-	var provider models.Provider
-	switch req.Name {
-	case "openai":
-		provider = models.NewOpenAIProvider()
-	case "anthropic":
-		provider = models.NewAnthropicProvider()
-	case "google":
-		provider = models.NewGoogleProvider()
-	case "xai":
-		provider = models.NewXAIProvider()
-	case "ollama":
-		provider = models.NewOllamaProvider()
-	case "vllm":
-		provider = models.NewVLLMProvider()
-	default:
+	provider, err := models.NewProviderByName(req.Name)
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{
 			"error": fmt.Sprintf("Unknown provider: %s", req.Name),
@@ -344,6 +375,42 @@ func (s *Server) handleValidateProvider(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// providerConfig returns the configuration of a provider. Only a missing
+// provider is reported as not found; other errors, such as encrypted secrets
+// that cannot be decrypted, are reported as they are.
+func (s *Server) providerConfig(w http.ResponseWriter, name string) (*config.Provider, bool) {
+	if provider, exists := s.envConfig.Providers[name]; !exists || provider == nil {
+		sendJSONError(w, http.StatusNotFound, fmt.Sprintf("Provider '%s' not found", name))
+		return nil, false
+	}
+	provider, err := s.envConfig.GetProviderConfig(name)
+	if err != nil {
+		sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Error reading provider '%s': %v", name, err))
+		return nil, false
+	}
+	return provider, true
+}
+
+// requireEnvFileConfig rejects changes to a configuration merged from several
+// layers, which cannot be saved back to the env file
+func (s *Server) requireEnvFileConfig(w http.ResponseWriter) bool {
+	if s.envConfig.Layered() {
+		sendJSONError(w, http.StatusConflict, "The server configuration is merged from several layers and cannot be edited; edit the env file instead")
+		return false
+	}
+	return true
+}
+
+// sortedProviderNames returns the names of the configured providers in alphabetical order
+func sortedProviderNames(envConfig *config.EnvConfig) []string {
+	names := make([]string, 0, len(envConfig.Providers))
+	for name := range envConfig.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // getModelNames extracts model names from config.Model slice
 func getModelNames(models []config.Model) []string {
 	names := make([]string, len(models))
@@ -360,6 +427,9 @@ func (s *Server) handleUpdateProvider(w http.ResponseWriter, r *http.Request) {
 	if !checkAuth(s.config, w, r) {
 		return
 	}
+	if !s.requireEnvFileConfig(w) {
+		return
+	}
 
 	var req ProviderRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -371,14 +441,29 @@ func (s *Server) handleUpdateProvider(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Secret references run commands or read files when the configuration is
+	// loaded, so they are only accepted from the configuration file itself
+	if config.IsSecretRef(req.APIKey) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid API key: %v", config.ErrSecretRefNotAllowed),
+		})
+		return
+	}
+
 	// Get existing provider or create new one
-	provider, err := s.envConfig.GetProviderConfig(req.Name)
-	if err != nil {
-		// Provider doesn't exist, create new one
-		provider = &config.Provider{
-			Models: make([]config.Model, 0),
+	if _, exists := s.envConfig.Providers[req.Name]; exists {
+		if _, err := s.envConfig.GetProviderConfig(req.Name); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Error reading provider configuration: %v", err),
+			})
+			return
 		}
-		s.envConfig.AddProvider(req.Name, *provider)
+	} else {
+		s.envConfig.AddProvider(req.Name, config.Provider{
+			Models: make([]config.Model, 0),
+		})
 	}
 
 	// Update API key if provided
@@ -392,21 +477,8 @@ func (s *Server) handleUpdateProvider(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Configure the provider with the new API key
-		var provider models.Provider
-		switch req.Name {
-		case "openai":
-			provider = models.NewOpenAIProvider()
-		case "anthropic":
-			provider = models.NewAnthropicProvider()
-		case "google":
-			provider = models.NewGoogleProvider()
-		case "xai":
-			provider = models.NewXAIProvider()
-		case "ollama":
-			provider = models.NewOllamaProvider()
-		case "vllm":
-			provider = models.NewVLLMProvider()
-		default:
+		provider, err := models.NewProviderByName(req.Name)
+		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]string{
 				"error": fmt.Sprintf("Unknown provider: %s", req.Name),
@@ -460,6 +532,9 @@ func (s *Server) handleDeleteProvider(w http.ResponseWriter, r *http.Request, pr
 	if !checkAuth(s.config, w, r) {
 		return
 	}
+	if !s.requireEnvFileConfig(w) {
+		return
+	}
 
 	// Validate provider name
 	if providerName == "" {
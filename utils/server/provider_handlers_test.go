@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/keypool"
 )
 
 func TestHandleDeleteProvider(t *testing.T) {
@@ -238,3 +240,216 @@ func TestProviderRouteHandling(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleGetProvidersUsesRegistry(t *testing.T) {
+	server := &Server{
+		mux:    http.NewServeMux(),
+		config: &config.ServerConfig{BearerToken: "test-token", Enabled: true},
+		envConfig: &config.EnvConfig{
+			Providers: map[string]*config.Provider{
+				"moonshot": {APIKey: "key", Models: []config.Model{{Name: "moonshot-v1-8k"}}},
+				"lmstudio": {Type: "openai-compatible", BaseURL: "http://localhost:1234/v1", Auth: "none",
+					Models: []config.Model{{Name: "qwen2.5-7b-instruct"}}},
+			},
+		},
+	}
+	server.routes()
+
+	req := httptest.NewRequest("GET", "/providers", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rec := httptest.NewRecorder()
+	server.mux.ServeHTTP(rec, req)
+
+	var response ProviderListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	found := make(map[string]ProviderInfo)
+	for _, provider := range response.Providers {
+		found[provider.Name] = provider
+	}
+	if len(found["moonshot"].Capabilities) == 0 {
+		t.Errorf("Expected moonshot with its capabilities, got %+v", response.Providers)
+	}
+	if lmstudio, ok := found["lmstudio"]; !ok || !lmstudio.Enabled {
+		t.Errorf("Expected the openai-compatible provider to be listed and enabled, got %+v", response.Providers)
+	}
+}
+
+func TestHandleGetKeyUsage(t *testing.T) {
+	keypool.Reset()
+	defer keypool.Reset()
+	providerConfig := &config.Provider{
+		KeySelection: config.KeySelectionLeastUsed,
+		APIKeys: []config.APIKey{
+			{Name: "org-a", Key: "sk-secret-a"},
+			{Name: "org-b", Key: "sk-secret-b", Project: "research"},
+		},
+	}
+	server := &Server{
+		mux:       http.NewServeMux(),
+		config:    &config.ServerConfig{BearerToken: "test-token", Enabled: true},
+		envConfig: &config.EnvConfig{Providers: map[string]*config.Provider{"openai": providerConfig}},
+	}
+	server.routes()
+	keypool.Get("openai", providerConfig).Report("org-a", nil)
+
+	req := httptest.NewRequest("GET", "/providers/openai/keys", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rec := httptest.NewRecorder()
+	server.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "sk-secret") {
+		t.Error("The keys themselves must not be returned")
+	}
+	var response KeyUsageResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Selection != config.KeySelectionLeastUsed || len(response.Keys) != 2 || response.Keys[0].Requests != 1 || response.Keys[1].Project != "research" {
+		t.Errorf("Unexpected response: %+v", response)
+	}
+}
+
+func TestHandleUpdateProviderRejectsSecretRefs(t *testing.T) {
+	t.Setenv("COMANDA_ENV", t.TempDir()+"/.env")
+	testConfig := &config.EnvConfig{
+		Providers: map[string]*config.Provider{
+			"openai": {APIKey: "test-key"},
+		},
+	}
+	server := &Server{
+		mux: http.NewServeMux(),
+		config: &config.ServerConfig{
+			BearerToken: "test-token",
+			Enabled:     true,
+		},
+		envConfig: testConfig,
+	}
+	server.routes()
+
+	for _, body := range []string{
+		`{"name": "openai", "apiKey": "cmd:touch /tmp/pwned"}`,
+		`{"name": "anthropic", "apiKey": "file:/etc/passwd"}`,
+	} {
+		req := httptest.NewRequest("PUT", "/providers", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, body, w.Code)
+		}
+		var response map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if !strings.Contains(response["error"], "secret references") {
+			t.Errorf("Expected a secret reference error, got %q", response["error"])
+		}
+	}
+
+	if got := testConfig.Providers["openai"].APIKey; got != "test-key" {
+		t.Errorf("Expected the API key to be unchanged, got %q", got)
+	}
+	if _, exists := testConfig.Providers["anthropic"]; exists {
+		t.Error("Expected no provider to be added by a rejected request")
+	}
+}
+
+func TestProviderChangesRejectedForLayeredConfig(t *testing.T) {
+	t.Setenv("COMANDA_ENV", t.TempDir()+"/.env")
+	base := &config.EnvConfig{
+		Providers: map[string]*config.Provider{
+			"openai": {APIKey: "test-key", Models: []config.Model{{Name: "gpt-4o", Modes: []config.ModelMode{config.TextMode}}}},
+		},
+	}
+	layered, err := base.WithLayer(config.LayerCLI, "", map[string]interface{}{"project": "team"})
+	if err != nil {
+		t.Fatalf("WithLayer failed: %v", err)
+	}
+	server := &Server{
+		mux: http.NewServeMux(),
+		config: &config.ServerConfig{
+			BearerToken: "test-token",
+			Enabled:     true,
+		},
+		envConfig: layered,
+	}
+	server.routes()
+
+	for _, request := range []struct{ method, path, body string }{
+		{"POST", "/providers/openai/models", `{"name": "o3", "modes": ["text"]}`},
+		{"PUT", "/providers/openai/models/gpt-4o", `{"modes": ["text", "vision"]}`},
+		{"DELETE", "/providers/openai/models/gpt-4o", ""},
+		{"PUT", "/providers", `{"name": "anthropic", "apiKey": "sk-test"}`},
+		{"DELETE", "/providers/openai", ""},
+	} {
+		req := httptest.NewRequest(request.method, request.path, strings.NewReader(request.body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status %d for %s %s, got %d: %s", http.StatusConflict, request.method, request.path, w.Code, w.Body.String())
+		}
+	}
+
+	openai := layered.Providers["openai"]
+	if openai == nil || len(openai.Models) != 1 || len(openai.Models[0].Modes) != 1 {
+		t.Errorf("Expected the configuration to be unchanged, got %+v", openai)
+	}
+	if _, exists := layered.Providers["anthropic"]; exists {
+		t.Error("Expected no provider to be added")
+	}
+}
+
+func TestHandleDeleteModelReportsSealedSecretErrors(t *testing.T) {
+	envPath := t.TempDir() + "/.env"
+	t.Setenv("COMANDA_ENV", envPath)
+	if err := config.SaveEnvConfig(envPath, &config.EnvConfig{
+		Providers: map[string]*config.Provider{
+			"openai": {APIKey: "sk-test", Models: []config.Model{{Name: "gpt-4o", Modes: []config.ModelMode{config.TextMode}}}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.EncryptConfigFields(envPath, "password"); err != nil {
+		t.Fatal(err)
+	}
+	// Loaded without a password, so the sealed key cannot be decrypted
+	envConfig, err := config.LoadEnvConfig(envPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		mux: http.NewServeMux(),
+		config: &config.ServerConfig{
+			BearerToken: "test-token",
+			Enabled:     true,
+		},
+		envConfig: envConfig,
+	}
+	server.routes()
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		error  string
+	}{
+		{"/providers/openai/models/gpt-4o", http.StatusInternalServerError, "decrypt"},
+		{"/providers/anthropic/models/claude", http.StatusNotFound, "not found"},
+	} {
+		req := httptest.NewRequest("DELETE", tc.path, nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+
+		if w.Code != tc.status || !strings.Contains(w.Body.String(), tc.error) {
+			t.Errorf("DELETE %s: expected status %d with %q, got %d: %s", tc.path, tc.status, tc.error, w.Code, w.Body.String())
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/kris-hansen/comanda/utils/config"
+	"github.com/kris-hansen/comanda/utils/processor"
 )
 
 // Server represents the HTTP server
@@ -292,6 +293,7 @@ func (s *Server) routes() {
 		// {provider_name} -> DELETE
 		// {provider_name}/models -> GET, POST
 		// {provider_name}/available-models -> GET
+		// {provider_name}/keys -> GET
 		// {provider_name}/models/{model_name} -> PUT, DELETE
 
 		if len(parts) == 0 || parts[0] == "" {
@@ -317,6 +319,12 @@ func (s *Server) routes() {
 				default:
 					sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed for /models path")
 				}
+			} else if parts[1] == "keys" {
+				if r.Method == http.MethodGet {
+					s.handleGetKeyUsage(w, r, providerName)
+				} else {
+					sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed for /keys path")
+				}
 			} else if parts[1] == "available-models" {
 				if r.Method == http.MethodGet {
 					s.handleGetAvailableModels(w, r, providerName)
@@ -382,6 +390,16 @@ func (s *Server) routes() {
 
 	// Generate endpoint - requires auth
 	s.mux.HandleFunc("/generate", s.combinedMiddleware(s.handleGenerate))
+
+	// JSON Schema of workflow files - requires auth
+	s.mux.HandleFunc("/schema", s.combinedMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			sendJSONError(w, http.StatusMethodNotAllowed, "Method not allowed. Use GET.")
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		json.NewEncoder(w).Encode(processor.WorkflowSchema())
+	}))
 }
 
 // Run creates and starts the HTTP server with the given configuration
@@ -10,6 +10,8 @@ import (
 	"time"
 
 	cfg "github.com/kris-hansen/comanda/utils/config" // Added alias cfg
+	"github.com/kris-hansen/comanda/utils/keypool"
+	"github.com/kris-hansen/comanda/utils/models"
 )
 
 // debugLog provides local logging to avoid circular imports
@@ -106,9 +108,10 @@ type RestoreRequest struct {
 
 // ProviderInfo represents information about a provider
 type ProviderInfo struct {
-	Name    string   `json:"name"`
-	Models  []string `json:"models"`
-	Enabled bool     `json:"enabled"`
+	Name         string              `json:"name"`
+	Models       []string            `json:"models"`
+	Enabled      bool                `json:"enabled"`
+	Capabilities []models.Capability `json:"capabilities,omitempty"`
 }
 
 // ProviderListResponse represents the response for provider listing
@@ -129,6 +132,7 @@ type ProviderRequest struct {
 // EnvironmentRequest represents a request for environment operations
 type EnvironmentRequest struct {
 	Password string `json:"password"`
+	Mode     string `json:"mode,omitempty"` // Encryption mode: file (default) or fields
 }
 
 // EnvironmentResponse represents a response for environment operations
@@ -140,9 +144,10 @@ type EnvironmentResponse struct {
 
 // YAMLRequest represents a request for YAML operations
 type YAMLRequest struct {
-	Content   string `json:"content"`
-	Input     string `json:"input"`
-	Streaming bool   `json:"streaming"`
+	Content   string                 `json:"content"`
+	Input     string                 `json:"input"`
+	Streaming bool                   `json:"streaming"`
+	Params    map[string]interface{} `json:"params,omitempty"` // Values of the workflow's params
 }
 
 // flushingResponseWriter implements http.Flusher interface
@@ -258,6 +263,16 @@ type ConfiguredModelListResponse struct {
 	Error   string            `json:"error,omitempty"`
 }
 
+// KeyUsageResponse reports the usage of a provider's API keys. The keys
+// themselves are never returned.
+type KeyUsageResponse struct {
+	Success   bool            `json:"success"`
+	Provider  string          `json:"provider"`
+	Selection string          `json:"selection"`
+	Keys      []keypool.Usage `json:"keys"`
+	Error     string          `json:"error,omitempty"`
+}
+
 // AddModelRequest is the request body for adding a model to a provider's configuration
 type AddModelRequest struct {
 	Name  string          `json:"name"`
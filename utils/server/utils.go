@@ -1,5 +1,12 @@
 package server
 
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kris-hansen/comanda/utils/config"
+)
+
 // maskToken masks a token for secure logging by showing only first and last 4 characters
 func maskToken(token string) string {
 	if len(token) <= 8 {
@@ -15,3 +22,25 @@ func truncateString(s string, maxLen int) string {
 	}
 	return s[:maxLen-3] + "..."
 }
+
+// projectParam returns the project of a request, selecting project-scoped API
+// keys: the project query parameter, then the configured default
+func projectParam(r *http.Request, envConfig *config.EnvConfig) string {
+	if project := r.URL.Query().Get("project"); project != "" {
+		return project
+	}
+	return config.GetProject(envConfig)
+}
+
+// paramValues converts the params of a JSON request, which may be strings,
+// numbers or booleans, to the string values workflows receive
+func paramValues(params map[string]interface{}) map[string]string {
+	if len(params) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(params))
+	for name, value := range params {
+		values[name] = fmt.Sprint(value)
+	}
+	return values
+}
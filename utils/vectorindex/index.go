@@ -0,0 +1,204 @@
+// Package vectorindex provides a small file-backed vector store for
+// retrieval steps. Vectors are kept in memory and searched with cosine
+// similarity, which is fast enough for corpora of tens of thousands of chunks.
+package vectorindex
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// formatVersion is the on-disk format version of an index file
+const formatVersion = 1
+
+// Entry is a single embedded chunk of text
+type Entry struct {
+	ID     string    `json:"id"`
+	Source string    `json:"source"`
+	Chunk  int       `json:"chunk"`
+	Text   string    `json:"text"`
+	Vector []float32 `json:"vector"`
+}
+
+// Result is an entry returned by a search together with its similarity score
+type Result struct {
+	Entry
+	Score float64 `json:"score"`
+}
+
+// Index is a collection of embedded chunks stored in a single JSON file
+type Index struct {
+	Version    int       `json:"version"`
+	Model      string    `json:"model"`
+	Dimensions int       `json:"dimensions"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Entries    []Entry   `json:"entries"`
+
+	path string
+}
+
+// Open loads the index stored at path, or returns an empty index if the file does not exist yet
+func Open(path string) (*Index, error) {
+	index := &Index{Version: formatVersion, path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse index %s: %w", path, err)
+	}
+	if index.Version > formatVersion {
+		return nil, fmt.Errorf("index %s has unsupported format version %d", path, index.Version)
+	}
+	index.path = path
+	return index, nil
+}
+
+// Path returns the file the index is stored in
+func (ix *Index) Path() string {
+	return ix.path
+}
+
+// Len returns the number of entries in the index
+func (ix *Index) Len() int {
+	return len(ix.Entries)
+}
+
+// Sources returns the distinct sources in the index, sorted
+func (ix *Index) Sources() []string {
+	seen := make(map[string]bool)
+	var sources []string
+	for _, entry := range ix.Entries {
+		if !seen[entry.Source] {
+			seen[entry.Source] = true
+			sources = append(sources, entry.Source)
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// CheckModel verifies that the index was built with the given embedding model.
+// An empty index adopts the model.
+func (ix *Index) CheckModel(model string) error {
+	if len(ix.Entries) == 0 {
+		ix.Model = model
+		return nil
+	}
+	if ix.Model != model {
+		return fmt.Errorf("index %s was built with model %s, not %s", ix.path, ix.Model, model)
+	}
+	return nil
+}
+
+// ReplaceSource removes all entries of a source and adds the given entries in their place,
+// so that re-indexing a changed file does not leave stale chunks behind
+func (ix *Index) ReplaceSource(source string, entries []Entry) error {
+	for _, entry := range entries {
+		if ix.Dimensions == 0 {
+			ix.Dimensions = len(entry.Vector)
+		}
+		if len(entry.Vector) != ix.Dimensions {
+			return fmt.Errorf("vector for %s has %d dimensions, index has %d", entry.ID, len(entry.Vector), ix.Dimensions)
+		}
+	}
+
+	kept := ix.Entries[:0]
+	for _, entry := range ix.Entries {
+		if entry.Source != source {
+			kept = append(kept, entry)
+		}
+	}
+	ix.Entries = append(kept, entries...)
+	return nil
+}
+
+// Search returns the k entries most similar to the query vector whose score is
+// at least minScore, best match first
+func (ix *Index) Search(query []float32, k int, minScore float64) ([]Result, error) {
+	if len(ix.Entries) == 0 {
+		return nil, nil
+	}
+	if len(query) != ix.Dimensions {
+		return nil, fmt.Errorf("query vector has %d dimensions, index has %d", len(query), ix.Dimensions)
+	}
+
+	results := make([]Result, 0, len(ix.Entries))
+	for _, entry := range ix.Entries {
+		score := CosineSimilarity(query, entry.Vector)
+		if score >= minScore {
+			results = append(results, Result{Entry: entry, Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// Save writes the index to its file atomically, creating parent directories as needed
+func (ix *Index) Save() error {
+	ix.Version = formatVersion
+	ix.UpdatedAt = time.Now().UTC()
+
+	data, err := json.Marshal(ix)
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+
+	dir := filepath.Dir(ix.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create index directory %s: %w", dir, err)
+	}
+
+	tmpFile, err := os.CreateTemp(dir, ".comanda-index-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for index: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := os.Rename(tmpPath, ix.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace index %s: %w", ix.path, err)
+	}
+	return nil
+}
+
+// CosineSimilarity returns the cosine of the angle between two vectors of equal length
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,92 @@
+package vectorindex
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b     []float32
+		expected float64
+	}{
+		{[]float32{1, 0}, []float32{1, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 1}, 0},
+		{[]float32{1, 1}, []float32{-1, -1}, -1},
+		{[]float32{1, 0}, []float32{1, 0, 0}, 0},
+		{[]float32{0, 0}, []float32{1, 0}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := CosineSimilarity(tt.a, tt.b); math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("CosineSimilarity(%v, %v) = %f, want %f", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestIndexSearchAndPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "docs.index.json")
+
+	index, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	if err := index.CheckModel("embed-model"); err != nil {
+		t.Fatalf("CheckModel returned error: %v", err)
+	}
+
+	if err := index.ReplaceSource("a.md", []Entry{
+		{ID: "a.md#0", Source: "a.md", Text: "cats", Vector: []float32{1, 0, 0}},
+		{ID: "a.md#1", Source: "a.md", Chunk: 1, Text: "dogs", Vector: []float32{0, 1, 0}},
+	}); err != nil {
+		t.Fatalf("ReplaceSource returned error: %v", err)
+	}
+	if err := index.ReplaceSource("b.md", []Entry{
+		{ID: "b.md#0", Source: "b.md", Text: "kittens", Vector: []float32{0.9, 0.1, 0}},
+	}); err != nil {
+		t.Fatalf("ReplaceSource returned error: %v", err)
+	}
+	if err := index.ReplaceSource("c.md", []Entry{{ID: "c.md#0", Source: "c.md", Vector: []float32{1, 0}}}); err == nil {
+		t.Errorf("Expected dimension mismatch error")
+	}
+
+	if err := index.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	reloaded, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open returned error for saved index: %v", err)
+	}
+	if reloaded.Len() != 3 || reloaded.Model != "embed-model" || reloaded.Dimensions != 3 {
+		t.Fatalf("Unexpected reloaded index: len=%d model=%s dims=%d", reloaded.Len(), reloaded.Model, reloaded.Dimensions)
+	}
+	if err := reloaded.CheckModel("other-model"); err == nil {
+		t.Errorf("Expected model mismatch error")
+	}
+
+	results, err := reloaded.Search([]float32{1, 0, 0}, 2, 0)
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if len(results) != 2 || results[0].Text != "cats" || results[1].Text != "kittens" {
+		t.Errorf("Unexpected search results: %+v", results)
+	}
+
+	results, _ = reloaded.Search([]float32{1, 0, 0}, 0, 0.999)
+	if len(results) != 1 {
+		t.Errorf("Expected min score to filter results, got %d", len(results))
+	}
+
+	// Re-indexing a source replaces its chunks
+	if err := reloaded.ReplaceSource("a.md", []Entry{{ID: "a.md#0", Source: "a.md", Text: "birds", Vector: []float32{0, 0, 1}}}); err != nil {
+		t.Fatalf("ReplaceSource returned error: %v", err)
+	}
+	if reloaded.Len() != 2 {
+		t.Errorf("Expected 2 entries after replacing a.md, got %d", reloaded.Len())
+	}
+	if sources := reloaded.Sources(); len(sources) != 2 || sources[0] != "a.md" || sources[1] != "b.md" {
+		t.Errorf("Unexpected sources: %v", sources)
+	}
+}